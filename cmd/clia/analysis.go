@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/yourusername/clia/internal/ai"
+)
+
+// Ways to present the result of an analysis, chosen with --output
+const (
+	analysisOutputTUI  = "tui"  // Browse the rendered result in the analyzer TUI
+	analysisOutputRaw  = "raw"  // Print the answer of the model as it is
+	analysisOutputJSON = "json" // Print the answer with its metadata as JSON
+)
+
+// AnalysisResult is the outcome of analyzing data: the answer of the model
+// and how it was obtained, for the TUI to show or to print for other tools
+type AnalysisResult struct {
+	Command      string          `json:"command"`
+	AnalysisType ai.AnalysisType `json:"analysis_type"`
+	OutputFormat string          `json:"output_format"`
+	Result       string          `json:"result"`
+	Provider     string          `json:"provider,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	InputBytes   int             `json:"input_bytes"`
+	DurationMS   int64           `json:"duration_ms"`
+}
+
+// analyze runs analysisCommand on inputData with aiService, passing the
+// answer to onChunk as it streams in if onChunk is not nil
+func analyze(ctx context.Context, aiService *ai.Service, inputData, analysisCommand string, onChunk func(string)) (*AnalysisResult, error) {
+	start := time.Now()
+	response, err := aiService.StreamAnalysis(ctx, inputData, analysisCommand, onChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	info := aiService.GetProviderInfo()
+	provider, _ := info["name"].(string)
+	model, _ := info["model"].(string)
+	return &AnalysisResult{
+		Command:      analysisCommand,
+		AnalysisType: response.AnalysisType,
+		OutputFormat: response.OutputFormat,
+		Result:       response.Result,
+		Provider:     provider,
+		Model:        model,
+		InputBytes:   len(inputData),
+		DurationMS:   time.Since(start).Milliseconds(),
+	}, nil
+}
+
+// validAnalysisOutput checks the value of --output; empty means the TUI
+func validAnalysisOutput(output string) (string, error) {
+	switch output {
+	case "":
+		return analysisOutputTUI, nil
+	case analysisOutputTUI, analysisOutputRaw, analysisOutputJSON:
+		return output, nil
+	default:
+		return "", fmt.Errorf("--output must be tui, raw or json, got %q", output)
+	}
+}
+
+// writeAnalysisResult prints result to w as raw text or as JSON
+func writeAnalysisResult(w io.Writer, result *AnalysisResult, output string) error {
+	if output == analysisOutputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+
+	text := result.Result
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err := io.WriteString(w, text)
+	return err
+}
+
+// runAnalysisOutput analyzes the data without the TUI and prints the result
+func runAnalysisOutput(w io.Writer, inputData, analysisCommand, output string) error {
+	aiService := ai.NewService().SetFallbackMode(true)
+	if err := configureAIProviders(aiService); err != nil {
+		return fmt.Errorf("failed to configure AI providers: %w", err)
+	}
+
+	result, err := analyze(context.Background(), aiService, inputData, analysisCommand, nil)
+	if err != nil {
+		return err
+	}
+	return writeAnalysisResult(w, result, output)
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -34,7 +35,7 @@ type AnalyzerTUIModel struct {
 	aiService *ai.Service
 
 	// Results
-	analysisResult  *ai.AnalysisResponse
+	analysisResult  *AnalysisResult
 	renderedContent string
 	errorMessage    string
 
@@ -42,15 +43,31 @@ type AnalyzerTUIModel struct {
 	viewport         viewport.Model
 	markdownRenderer *renderer.MarkdownRenderer
 
+	// Streaming, cancelling and re-running with another instruction; the
+	// piped data stays in memory, so re-runs need no new input
+	runID     int // Identifies the current run; events of earlier runs are dropped
+	events    <-chan AnalysisEventMsg
+	cancel    context.CancelFunc
+	partial   string // Result streamed so far
+	cancelled bool   // The last run was cancelled with Esc
+	editing   bool   // The instruction is being edited for a re-run
+	input     textinput.Model
+
 	// Layout
 	width  int
 	height int
 	ready  bool
 }
 
-// AnalysisCompleteMsg represents completion of analysis
-type AnalysisCompleteMsg struct {
-	result *ai.AnalysisResponse
+// startAnalysisMsg starts the first analysis once the program runs
+type startAnalysisMsg struct{}
+
+// AnalysisEventMsg is a piece of a streamed analysis result, or its end
+type AnalysisEventMsg struct {
+	runID  int
+	chunk  string
+	done   bool
+	result *AnalysisResult
 	error  error
 }
 
@@ -64,6 +81,11 @@ func NewAnalyzerTUIModel(inputData, analysisCommand string) (*AnalyzerTUIModel,
 		return nil, fmt.Errorf("failed to configure AI providers: %w", err)
 	}
 
+	return newAnalyzerModel(aiService, inputData, analysisCommand)
+}
+
+// newAnalyzerModel creates an analyzer TUI model using aiService
+func newAnalyzerModel(aiService *ai.Service, inputData, analysisCommand string) (*AnalyzerTUIModel, error) {
 	// Initialize markdown renderer with default options
 	rendererOpts := renderer.DefaultRendererOptions()
 	rendererOpts.Width = 78 // Default width, will be updated on window size
@@ -79,6 +101,11 @@ func NewAnalyzerTUIModel(inputData, analysisCommand string) (*AnalyzerTUIModel,
 		BorderForeground(lipgloss.Color("62")).
 		PaddingRight(2)
 
+	input := textinput.New()
+	input.Prompt = "✏️  "
+	input.Placeholder = "New instruction, e.g. now just the errors"
+	input.CharLimit = 500
+
 	return &AnalyzerTUIModel{
 		state:            StateAnalyzing,
 		inputData:        inputData,
@@ -86,6 +113,7 @@ func NewAnalyzerTUIModel(inputData, analysisCommand string) (*AnalyzerTUIModel,
 		aiService:        aiService,
 		viewport:         vp,
 		markdownRenderer: markdownRenderer,
+		input:            input,
 	}, nil
 }
 
@@ -147,22 +175,140 @@ func getEnvVar(key string) string {
 // Init initializes the analyzer TUI
 func (m AnalyzerTUIModel) Init() tea.Cmd {
 	return tea.Batch(
-		m.startAnalysis(),
+		func() tea.Msg { return startAnalysisMsg{} },
 		m.viewport.Init(),
 	)
 }
 
-// startAnalysis begins the AI analysis process
-func (m AnalyzerTUIModel) startAnalysis() tea.Cmd {
-	return tea.Cmd(func() tea.Msg {
-		ctx := context.Background()
-		result, err := m.aiService.AnalyzeData(ctx, m.inputData, m.analysisCommand)
+// startAnalysis runs the analysis of the current instruction in the
+// background, cancelling a run still in progress
+func (m *AnalyzerTUIModel) startAnalysis() tea.Cmd {
+	m.stopAnalysis()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.runID++
+	m.cancel = cancel
+	m.state = StateAnalyzing
+	m.partial = ""
+	m.cancelled = false
+	m.analysisResult = nil
+	m.errorMessage = ""
+	m.viewport.SetContent("")
+
+	events := make(chan AnalysisEventMsg, 64)
+	runID, aiService, inputData, analysisCommand := m.runID, m.aiService, m.inputData, m.analysisCommand
+	send := func(event AnalysisEventMsg) {
+		// Nobody reads the events of a cancelled run
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(events)
+		result, err := analyze(ctx, aiService, inputData, analysisCommand, func(chunk string) {
+			send(AnalysisEventMsg{runID: runID, chunk: chunk})
+		})
+		send(AnalysisEventMsg{runID: runID, done: true, result: result, error: err})
+	}()
+	m.events = events
+
+	return waitForAnalysisEvent(events)
+}
 
-		return AnalysisCompleteMsg{
-			result: result,
-			error:  err,
+// stopAnalysis cancels the run in progress, if any
+func (m *AnalyzerTUIModel) stopAnalysis() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.cancel = nil
+	m.events = nil
+}
+
+// waitForAnalysisEvent waits for the next piece of the streamed result
+func waitForAnalysisEvent(events <-chan AnalysisEventMsg) tea.Cmd {
+	return func() tea.Msg {
+		event, ok := <-events
+		if !ok {
+			return AnalysisEventMsg{done: true} // Dropped as it matches no run
 		}
-	})
+		return event
+	}
+}
+
+// cancelAnalysis stops the run in progress, keeping what was streamed so far
+func (m *AnalyzerTUIModel) cancelAnalysis() {
+	m.stopAnalysis()
+	m.cancelled = true
+	m.state = StateDisplaying
+	m.viewport.SetContent(m.partial)
+}
+
+// editInstruction starts editing the instruction for a re-run on the same data
+func (m *AnalyzerTUIModel) editInstruction() tea.Cmd {
+	m.editing = true
+	m.input.SetValue(m.analysisCommand)
+	m.input.CursorEnd()
+	return m.input.Focus()
+}
+
+// handleEditKey handles a key while the instruction is edited
+func (m *AnalyzerTUIModel) handleEditKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.editing = false
+		m.input.Blur()
+		return nil
+	case "enter":
+		instruction := strings.TrimSpace(m.input.Value())
+		if instruction == "" {
+			return nil
+		}
+		m.editing = false
+		m.input.Blur()
+		m.analysisCommand = instruction
+		return m.startAnalysis()
+	default:
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return cmd
+	}
+}
+
+// handleAnalysisEvent adds a piece of the result to the view, or shows the finished result
+func (m *AnalyzerTUIModel) handleAnalysisEvent(msg AnalysisEventMsg) tea.Cmd {
+	if msg.runID != m.runID || m.events == nil {
+		return nil // A cancelled or replaced run
+	}
+
+	if !msg.done {
+		m.partial += msg.chunk
+		m.viewport.SetContent(m.partial)
+		m.viewport.GotoBottom()
+		return waitForAnalysisEvent(m.events)
+	}
+
+	m.stopAnalysis()
+	if msg.error != nil {
+		m.state = StateError
+		m.errorMessage = msg.error.Error()
+		return nil
+	}
+
+	m.state = StateDisplaying
+	m.analysisResult = msg.result
+
+	// Render the analysis result with markdown
+	if rendered, err := m.markdownRenderer.Render(msg.result.Result); err == nil {
+		m.renderedContent = rendered
+		m.viewport.SetContent(rendered)
+	} else {
+		// Fallback to plain text if markdown rendering fails
+		m.renderedContent = msg.result.Result
+		m.viewport.SetContent(msg.result.Result)
+	}
+	m.viewport.GotoTop()
+	return nil
 }
 
 // Update handles messages and updates the model
@@ -195,35 +341,45 @@ func (m AnalyzerTUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "q", "ctrl+c", "esc":
+		if msg.String() == "ctrl+c" {
+			m.stopAnalysis()
 			return m, tea.Quit
-		default:
-			// Pass key events to viewport for scrolling
-			var cmd tea.Cmd
-			m.viewport, cmd = m.viewport.Update(msg)
-			return m, cmd
+		}
+		if m.editing {
+			return m, m.handleEditKey(msg)
 		}
 
-	case AnalysisCompleteMsg:
-		if msg.error != nil {
-			m.state = StateError
-			m.errorMessage = msg.error.Error()
-		} else {
-			m.state = StateDisplaying
-			m.analysisResult = msg.result
-
-			// Render the analysis result with markdown
-			if rendered, err := m.markdownRenderer.Render(msg.result.Result); err == nil {
-				m.renderedContent = rendered
-				m.viewport.SetContent(rendered)
-			} else {
-				// Fallback to plain text if markdown rendering fails
-				m.renderedContent = msg.result.Result
-				m.viewport.SetContent(msg.result.Result)
+		switch msg.String() {
+		case "esc":
+			if m.state == StateAnalyzing {
+				m.cancelAnalysis()
+				return m, nil
+			}
+			return m, tea.Quit
+		case "q":
+			m.stopAnalysis()
+			return m, tea.Quit
+		case "e":
+			if m.state != StateAnalyzing {
+				return m, m.editInstruction()
+			}
+		case "r":
+			if m.state != StateAnalyzing {
+				return m, m.startAnalysis()
 			}
 		}
 
+		// Pass key events to viewport for scrolling
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+
+	case startAnalysisMsg:
+		return m, m.startAnalysis()
+
+	case AnalysisEventMsg:
+		return m, m.handleAnalysisEvent(msg)
+
 	default:
 		// Pass other messages to viewport
 		var cmd tea.Cmd
@@ -259,7 +415,12 @@ func (m AnalyzerTUIModel) viewAnalyzing() string {
 		Foreground(lipgloss.Color("62")).
 		Render("🤖 Analyzing Data...")
 
-	info := fmt.Sprintf("Command: %s\nData length: %d bytes",
+	// Show the result as it streams in
+	if m.partial != "" {
+		return fmt.Sprintf("%s\n%s\n%s", title, m.viewport.View(), m.footer("Esc: Cancel • q: Quit"))
+	}
+
+	info := fmt.Sprintf("Command: %s\nData length: %d bytes\n\nEsc: Cancel",
 		m.analysisCommand, len(m.inputData))
 
 	spinner := "⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏"           // Simple spinner chars
@@ -274,18 +435,31 @@ func (m AnalyzerTUIModel) viewAnalyzing() string {
 
 // viewResults renders the analysis results
 func (m AnalyzerTUIModel) viewResults() string {
+	heading := "⏹  Analysis cancelled"
+	if m.analysisResult != nil {
+		heading = fmt.Sprintf("📊 Analysis Results (%s)", m.analysisResult.AnalysisType)
+	} else if m.partial == "" {
+		heading += " before any result arrived"
+	}
 	title := lipgloss.NewStyle().
 		Bold(true).
 		Foreground(lipgloss.Color("62")).
-		Render(fmt.Sprintf("📊 Analysis Results (%s)", m.analysisResult.AnalysisType))
-
-	help := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("241")).
-		Render("↑/↓: Navigate • q: Quit")
+		Render(heading)
 
+	help := m.footer("↑/↓: Navigate • e: Edit instruction • r: Re-run • q: Quit")
 	return fmt.Sprintf("%s\n%s\n%s", title, m.viewport.View(), help)
 }
 
+// footer renders the instruction being edited, or help
+func (m AnalyzerTUIModel) footer(help string) string {
+	if m.editing {
+		return m.input.View()
+	}
+	return lipgloss.NewStyle().
+		Foreground(lipgloss.Color("241")).
+		Render(help)
+}
+
 // viewError renders the error state
 func (m AnalyzerTUIModel) viewError() string {
 	title := lipgloss.NewStyle().
@@ -297,9 +471,7 @@ func (m AnalyzerTUIModel) viewError() string {
 		Foreground(lipgloss.Color("9")).
 		Render(m.errorMessage)
 
-	help := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("241")).
-		Render("q: Quit")
+	help := m.footer("e: Edit instruction • r: Retry • q: Quit")
 
 	suggestions := `
 💡 Troubleshooting suggestions:
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yourusername/clia/internal/tui"
+)
+
+// runAskCommand handles `clia ask <question>`: the answer is printed as
+// plain text while it streams in, or once complete with --buffered or
+// ui.answer_rendering, with no suggestions to run. maxCost is the budget
+// given with --max-cost, or -1 for the one in the config, and modelName the
+// model given with --model before ask, which a --model after it overrides.
+func runAskCommand(args []string, modelName string, offline bool, maxCost float64) error {
+	flags, args, err := parseLeadingFlags(args, []string{"--buffered", "--stream"}, []string{"--model"})
+	if err != nil {
+		return err
+	}
+	if model := flags.value("--model"); model != "" {
+		modelName = model
+	}
+	buffered, stream := flags.isSet("--buffered"), flags.isSet("--stream")
+
+	question := strings.TrimSpace(strings.Join(args, " "))
+	if question == "" {
+		return fmt.Errorf("usage: clia ask <question>")
+	}
+	if offline {
+		return fmt.Errorf("answering questions needs an AI provider (offline mode is on)")
+	}
+
+	service, err := initializeCLIServices(false, maxCost)
+	if err != nil {
+		return fmt.Errorf("failed to initialize services: %w", err)
+	}
+	if !service.hasAIProvider() {
+		return fmt.Errorf("no AI provider configured, run 'clia setup' or set an API key")
+	}
+	if modelName != "" {
+		if err := service.aiService.SwitchModel(modelName); err != nil {
+			return fmt.Errorf("failed to switch model: %w", err)
+		}
+	}
+
+	if !buffered && !stream && service.configManager != nil {
+		buffered = service.configManager.GetConfig().UI.BufferAnswers(tui.TerminalCaps().SSH)
+	}
+
+	var answer strings.Builder
+	endsWithNewline := false
+	response, err := service.aiService.Ask(context.Background(), question, func(chunk string) {
+		if buffered {
+			answer.WriteString(chunk)
+		} else {
+			fmt.Print(chunk)
+		}
+		endsWithNewline = strings.HasSuffix(chunk, "\n")
+	})
+	fmt.Print(answer.String())
+	if err != nil {
+		return err
+	}
+	if !endsWithNewline {
+		fmt.Println()
+	}
+
+	if response.Truncated {
+		fmt.Println("⚠️  The answer was cut off by the token limit (raise api.max_tokens for longer answers)")
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yourusername/clia/internal/ai"
+)
+
+// runCacheCommand handles the `clia cache` subcommands
+func runCacheCommand(args []string) error {
+	cache, err := ai.NewSuggestionCache()
+	if err != nil {
+		return fmt.Errorf("failed to initialize suggestion cache: %w", err)
+	}
+
+	subcommand := "info"
+	if len(args) > 0 {
+		subcommand = strings.ToLower(args[0])
+	}
+
+	switch subcommand {
+	case "info":
+		fmt.Printf("📦 %d cached responses in %s (entries refresh after %d days)\n",
+			cache.Count(), cache.GetDir(), int(ai.DefaultCacheTTL.Hours()/24))
+		return nil
+
+	case "prune":
+		removed, err := cache.Prune()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🧹 Removed %d expired cache entries\n", removed)
+		return nil
+
+	case "clear":
+		removed, err := cache.Clear()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🧹 Removed %d cache entries\n", removed)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown cache command: %s (expected info, prune or clear)", subcommand)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/yourusername/clia/internal/executor"
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// defaultCaptureInterval is how long a captured program runs before its
+// screen is taken, and between the two frames compared by --diff
+const defaultCaptureInterval = time.Second
+
+// runCaptureCommand handles `clia --capture [--diff] [--interval 1s] <command>`:
+// it runs command out of sight and prints the screen it drew after the
+// interval, or with --diff what changed on it during a second interval
+func runCaptureCommand(args []string) error {
+	flags, args, err := parseLeadingFlags(args, []string{"--diff"}, []string{"--interval"})
+	if err != nil {
+		return err
+	}
+	diff, intervalText := flags.isSet("--diff"), flags.value("--interval")
+	command := strings.TrimSpace(strings.Join(args, " "))
+	if command == "" {
+		return fmt.Errorf("usage: clia --capture [--diff] [--interval 1s] <command>")
+	}
+
+	interval := defaultCaptureInterval
+	if intervalText != "" {
+		interval, err = time.ParseDuration(intervalText)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid interval %q, use a duration like 500ms or 2s", intervalText)
+		}
+	}
+
+	count := 1
+	if diff {
+		count = 2
+	}
+
+	// The program gets a screen of the size of the terminal clia runs in
+	width, height, _ := term.GetSize(int(os.Stdout.Fd()))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	frames, err := executor.NewPTYExecutor().CaptureFrames(ctx, command, width, height, interval, count)
+	if err != nil {
+		return fmt.Errorf("failed to capture %s: %w", command, err)
+	}
+
+	output := frames[0]
+	if diff {
+		output = executor.DiffFrames(frames[0], frames[1])
+		if output == "" {
+			fmt.Printf("🖼️  Nothing changed on the screen of %s in %v\n", command, interval)
+			return nil
+		}
+	}
+
+	// Colors only mean something on a terminal
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		output = utils.StripANSI(output)
+	}
+	fmt.Println(output)
+	return nil
+}
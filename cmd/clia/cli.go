@@ -2,22 +2,31 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
 
 	"github.com/yourusername/clia/internal/ai"
 	"github.com/yourusername/clia/internal/config"
 	"github.com/yourusername/clia/internal/executor"
+	"github.com/yourusername/clia/internal/tui"
 	"github.com/yourusername/clia/pkg/memory"
 	"github.com/yourusername/clia/pkg/utils"
 )
 
+// criticalConfirmationPhrase must be typed to run a command assessed as critical
+const criticalConfirmationPhrase = "yes, do it"
+
 // CLIService holds the services needed for CLI mode
 type CLIService struct {
 	aiService     *ai.Service
@@ -25,14 +34,140 @@ type CLIService struct {
 	configManager *config.Manager
 	memoryManager *memory.Manager
 	memoryEnabled bool
+
+	// aiMu serializes the AI requests of clia serve: a request for another
+	// model switches the model of the shared provider while it runs
+	aiMu sync.Mutex
 }
 
-// runCLIMode processes a user request in CLI mode with memory integration
-func runCLIMode(userRequest string) error {
+// recordPresented counts that the memory results were offered as suggestions
+func (s *CLIService) recordPresented(results []memory.SearchResult) {
+	if s.memoryManager == nil {
+		return
+	}
+
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.Entry.ID)
+	}
+	s.memoryManager.RecordPresented(ids...)
+}
+
+// recordAccepted counts that a memory suggestion was chosen
+func (s *CLIService) recordAccepted(entryID string) {
+	if s.memoryManager == nil {
+		return
+	}
+
+	if err := s.memoryManager.RecordAccepted(entryID); err != nil {
+		log.Printf("Failed to record memory acceptance: %v", err)
+	}
+}
+
+// compactSuggestions reports whether the config asks for one line per suggestion
+func (s *CLIService) compactSuggestions() bool {
+	return s.configManager != nil && s.configManager.GetConfig().UI.CompactSuggestions
+}
+
+// rememberedCommand returns the memory result one-shot mode may run without
+// asking: the only command remembered for userRequest, scoring at least
+// minScore, used at least minUses times and successful last time
+func rememberedCommand(userRequest string, results []memory.SearchResult, minUses int, minScore float64) (memory.SearchResult, bool) {
+	request := strings.ToLower(strings.Join(strings.Fields(userRequest), " "))
+
+	var candidate *memory.SearchResult
+	for i, result := range results {
+		if result.MatchType != memory.MatchTypeExact || result.Entry.NormalizedRequest != request {
+			continue
+		}
+		if candidate != nil && ai.CanonicalCommand(candidate.Entry.SelectedCommand) != ai.CanonicalCommand(result.Entry.SelectedCommand) {
+			// Different commands were picked for the request before
+			return memory.SearchResult{}, false
+		}
+		if candidate == nil {
+			candidate = &results[i]
+		}
+	}
+
+	if candidate == nil || candidate.Score < minScore || candidate.Entry.UsageCount < minUses || !candidate.Entry.Success {
+		return memory.SearchResult{}, false
+	}
+	return *candidate, true
+}
+
+// runRemembered runs the command remembered for userRequest attached to the
+// terminal, if memory has one above the auto-run thresholds of the config and
+// it needs no confirmation. It reports whether the command was run, and its exit code.
+func (s *CLIService) runRemembered(userRequest string, results []memory.SearchResult, quiet bool) (int, bool) {
+	if s.configManager == nil || s.configManager.GetConfig().Memory.AutoRunMinUses <= 0 {
+		return 0, false
+	}
+	memoryConfig := s.configManager.GetConfig().Memory
+	result, ok := rememberedCommand(userRequest, results, memoryConfig.AutoRunMinUses, memoryConfig.AutoRunMinScore)
+	if !ok {
+		return 0, false
+	}
+
+	// Risky commands, and every command in paranoid mode, are confirmed as usual
+	command := result.Entry.SelectedCommand
+	danger := s.executor.ExplainDanger(s.executor.Resolve(command))
+	if danger.Level != utils.DangerNone || s.configManager.GetConfig().Behavior.ConfirmAll {
+		if !quiet {
+			fmt.Printf("💭 Not running %s automatically, it needs confirmation\n", command)
+		}
+		return 0, false
+	}
+
+	if !quiet {
+		fmt.Printf("💭 Running the remembered command (used %dx): %s\n", result.Entry.UsageCount, command)
+	}
+	s.recordAccepted(result.Entry.ID)
+
+	// Runs without confirmation are recorded in the history and run logs too
+	run, err := s.executor.RunAttached(context.Background(), command, os.Stdin, os.Stdout, os.Stderr)
+	exitCode := run.ExitCode
+	if err != nil {
+		exitCode = exitCodeNotExecutable
+		fmt.Printf("❌ Failed to run %s: %v\n", command, err)
+	}
+
+	if err := s.memoryManager.Add(userRequest, command, result.Entry.Description, result.Entry.Source, exitCode == 0); err != nil {
+		log.Printf("Failed to update memory: %v", err)
+	}
+	return exitCode, true
+}
+
+// runCLIMode processes a user request in CLI mode with memory integration.
+// modelName may be a model ID or alias; empty keeps the default model.
+// In offline mode only rule-based suggestions are used; noMemory skips memory search;
+// quiet leaves out informational notes; auto runs a command remembered for the
+// request straight away, see runRemembered, and skips the numbered prompt used
+// where the TUI cannot run; maxCost is the budget given with --max-cost, or -1
+// for the one in the config. It returns the exit code clia should terminate with.
+func runCLIMode(userRequest, modelName string, offline, noMemory, quiet, auto bool, maxCost float64) (int, error) {
+	userRequest = strings.TrimSpace(userRequest)
+	if userRequest == "" {
+		return exitCodeError, fmt.Errorf("empty request, usage: clia <request>, e.g. clia find large files")
+	}
+
 	// Initialize services
-	service, err := initializeCLIServices()
+	service, err := initializeCLIServices(offline, maxCost)
 	if err != nil {
-		return fmt.Errorf("failed to initialize services: %w", err)
+		return exitCodeError, fmt.Errorf("failed to initialize services: %w", err)
+	}
+
+	if noMemory {
+		service.memoryEnabled = false
+	}
+
+	if offline {
+		if !quiet {
+			fmt.Println("📴 Offline mode: using rule-based suggestions")
+		}
+	} else if modelName != "" && service.hasAIProvider() {
+		if err := service.aiService.SwitchModel(modelName); err != nil {
+			return exitCodeError, fmt.Errorf("failed to switch model: %w", err)
+		}
 	}
 
 	// Search memory first if enabled
@@ -47,10 +182,22 @@ func runCLIMode(userRequest string) error {
 		} else {
 			memorySuggestions = memResults
 		}
+
+		// Acceptance stats are saved when clia exits
+		defer service.memoryManager.Flush()
+		service.recordPresented(memorySuggestions)
+
+		// A request repeated often enough skips the AI and the selection
+		if auto {
+			if exitCode, ran := service.runRemembered(userRequest, memorySuggestions, quiet); ran {
+				return exitCode, nil
+			}
+		}
 	}
 
-	// Display memory suggestions immediately if any
-	if len(memorySuggestions) > 0 {
+	// Display memory suggestions immediately if any; the numbered prompt
+	// lists them with the others
+	if len(memorySuggestions) > 0 && canRunTUI() {
 		fmt.Printf("💭 Memory suggestions:\n")
 		for i, result := range memorySuggestions {
 			safetyIcon := "✓"
@@ -75,51 +222,115 @@ func runCLIMode(userRequest string) error {
 		fmt.Println()
 	}
 
+	// Offline mode uses the rule-based suggestions straight away
+	if offline {
+		suggestions, err := service.getAISuggestions(userRequest)
+		if err != nil {
+			return exitCodeError, err
+		}
+		return selectAndRun(userRequest, suggestions, memorySuggestions, service, auto)
+	}
+
 	// If we have no memory suggestions and AI is not available, show fallback
 	if len(memorySuggestions) == 0 && !service.hasAIProvider() {
 		if fallbackSuggestions := service.getFallbackSuggestions(userRequest); len(fallbackSuggestions) > 0 {
 			// Use fallback suggestions immediately
-			return runCLITUI(userRequest, fallbackSuggestions, memorySuggestions, service)
+			return selectAndRun(userRequest, fallbackSuggestions, memorySuggestions, service, auto)
 		} else {
 			fmt.Printf("❌ No command suggestions available for: %s\n", userRequest)
-			fmt.Printf("💡 To enable AI suggestions, set an API key:\n")
+			fmt.Printf("💡 To enable AI suggestions, run 'clia setup' or set an API key:\n")
 			fmt.Printf("   export OPENROUTER_API_KEY=\"your-key-here\"\n")
 			fmt.Printf("   export OPENAI_API_KEY=\"your-key-here\"\n")
-			return nil
+			return exitCodeError, nil
 		}
 	}
 
 	// Start CLI TUI immediately with memory suggestions
 	// AI suggestions will be loaded asynchronously within the TUI
-	return runCLITUI(userRequest, []ai.CommandSuggestion{}, memorySuggestions, service)
+	return selectAndRun(userRequest, []ai.CommandSuggestion{}, memorySuggestions, service, auto)
 }
 
-// initializeCLIServices initializes AI service and executor for CLI mode
-func initializeCLIServices() (*CLIService, error) {
+// initializeCLIServices initializes AI service and executor for CLI mode.
+// In offline mode no provider is configured and no API key warnings are shown.
+// A maxCost of 0 or more overrides the session budget of the config.
+func initializeCLIServices(offline bool, maxCost float64) (*CLIService, error) {
 	// Initialize configuration manager
 	configManager, err := config.NewManager()
 	if err != nil {
 		// Warning only, not fatal
 		fmt.Printf("Warning: Failed to initialize config manager: %v\n", err)
+	} else if err := configManager.Load(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else {
+		if migration := configManager.PendingMigration(); migration != nil {
+			fmt.Printf("📄 %s is config version %d, upgraded to %d for this run only. Run 'clia config migrate' to update the file (a backup is kept)\n",
+				configManager.GetConfigPath(), migration.From, migration.To)
+		}
+		if err := tui.ConfigureTerminal(configManager.GetConfig().UI.TerminalSettings()); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		tui.ConfigureColors(configManager.GetConfig().UI.Theme)
 	}
 
 	// Initialize AI service
-	aiService := ai.NewService().SetFallbackMode(true)
+	aiService := ai.NewService().SetFallbackMode(true).SetOffline(offline)
+	if configManager != nil {
+		aiService.SetModelAliases(configManager.GetModelAliases())
+		aiService.SetProviderHeaders(configManager.GetProviderHeaders())
+		aiService.SetProviderEndpoints(configManager.GetProviderEndpoints())
+
+		aiService.SetMaxTokens(configManager.GetConfig().API.MaxTokens)
+		aiService.SetChoices(configManager.GetConfig().API.Choices)
+		aiService.SetTimeout(configManager.GetConfig().API.Timeout)
+		aiService.SetBudget(configManager.GetConfig().API.MaxCost)
+		aiService.SetSuggestionNormalization(configManager.GetConfig().Behavior.NormalizeSuggestions)
+
+		contextConfig := configManager.GetConfig().Context
+		aiService.GetPromptBuilder().GetContextCollector().
+			SetDirectoryListing(contextConfig.IncludeDirectoryListing, contextConfig.MaxListingFiles)
+
+		templates, err := configManager.GetRequestTemplates()
+		if err != nil {
+			fmt.Printf("Warning: Ignoring invalid templates: %v\n", err)
+		}
+		aiService.GetPromptBuilder().SetRequestTemplates(templates)
+
+		dangerPatterns, err := configManager.LoadDangerPatterns()
+		if err != nil {
+			fmt.Printf("Warning: Ignoring invalid danger patterns: %v\n", err)
+		}
+		utils.SetDangerPatterns(dangerPatterns)
+	}
+	if maxCost >= 0 {
+		aiService.SetBudget(maxCost)
+	}
+	if cache, err := ai.NewSuggestionCache(); err == nil {
+		aiService.SetCache(cache)
+	}
 
 	// Initialize executor
 	cmdExecutor := executor.New()
+	if configManager != nil {
+		cmdExecutor.WithRunLog(configManager.GetRunLogDir(), configManager.GetConfig().Behavior.RunLogsStripANSI)
+		cmdExecutor.WithHistory(configManager.GetHistoryPath(), configManager.GetConfig().Logs.HistoryFormat).
+			WithLogRotation(configManager.GetLogRotation())
+	}
 
 	// Initialize memory manager
 	memoryManager, memoryErr := memory.NewManager()
 	memoryEnabled := memoryErr == nil
 	if memoryErr != nil {
 		fmt.Printf("Warning: Failed to initialize memory manager: %v\n", memoryErr)
+	} else if configManager != nil {
+		memoryManager.SetTTL(configManager.GetConfig().Memory.TTL).Expire()
 	}
 
 	// Try to configure providers based on available API keys
 	var initErrors []string
 
-	if apiKey := os.Getenv("OPENROUTER_API_KEY"); apiKey != "" {
+	if offline {
+		// Offline mode never contacts a provider
+	} else if apiKey := os.Getenv("OPENROUTER_API_KEY"); apiKey != "" {
 		config := ai.DefaultProviderConfig(ai.ProviderTypeOpenRouter)
 		config.APIKey = apiKey
 		config.Model = "z-ai/glm-4.5-air:free"
@@ -134,8 +345,20 @@ func initializeCLIServices() (*CLIService, error) {
 		if err := aiService.SetProviderByConfig(ai.ProviderTypeOpenAI, config); err != nil {
 			initErrors = append(initErrors, fmt.Sprintf("Failed to configure OpenAI: %v", err))
 		}
+	} else if provider, apiKey, ok := configManager.GetStoredProvider(); ok {
+		// Provider saved by 'clia setup' or TUI onboarding
+		config := ai.DefaultProviderConfig(ai.ProviderType(provider))
+		config.APIKey = apiKey
+		if provider == string(ai.ProviderTypeOpenRouter) {
+			config.Model = "z-ai/glm-4.5-air:free"
+		}
+
+		if err := aiService.SetProviderByConfig(ai.ProviderType(provider), config); err != nil {
+			initErrors = append(initErrors, fmt.Sprintf("Failed to configure %s: %v", provider, err))
+		}
 	} else {
-		initErrors = append(initErrors, "No API keys found")
+		fmt.Println("💡 No AI provider configured yet. Run 'clia setup' to choose one.")
+		fmt.Println()
 	}
 
 	if len(initErrors) > 0 {
@@ -143,9 +366,7 @@ func initializeCLIServices() (*CLIService, error) {
 		for _, err := range initErrors {
 			fmt.Printf("  • %s\n", err)
 		}
-		fmt.Println("\n💡 To use AI features, set one of these environment variables:")
-		fmt.Println("  export OPENROUTER_API_KEY=\"your-key-here\"")
-		fmt.Println("  export OPENAI_API_KEY=\"your-key-here\"")
+		fmt.Println("\n💡 Run 'clia setup' to reconfigure your provider")
 		fmt.Println()
 	}
 
@@ -160,7 +381,7 @@ func initializeCLIServices() (*CLIService, error) {
 
 // getAISuggestions gets command suggestions from AI
 func (s *CLIService) getAISuggestions(userRequest string) ([]ai.CommandSuggestion, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.aiService.GetTimeout())
 	defer cancel()
 
 	response, err := s.aiService.SuggestCommands(ctx, userRequest)
@@ -308,10 +529,15 @@ func (s *CLIService) getFallbackSuggestions(userRequest string) []ai.CommandSugg
 
 // hasAIProvider checks if AI provider is available and configured
 func (s *CLIService) hasAIProvider() bool {
-	if s.aiService == nil {
+	if s.aiService == nil || s.aiService.IsOffline() {
 		return false
 	}
 
+	// A provider saved by setup counts as well
+	if s.aiService.GetCurrentProviderType() != "" {
+		return true
+	}
+
 	// Check if we have any API keys configured
 	hasOpenRouter := os.Getenv("OPENROUTER_API_KEY") != ""
 	hasOpenAI := os.Getenv("OPENAI_API_KEY") != ""
@@ -321,52 +547,147 @@ func (s *CLIService) hasAIProvider() bool {
 	return hasOpenRouter || hasOpenAI || hasAnthropic || hasOllama
 }
 
-// displaySuggestionsAndGetChoice shows suggestions and gets user choice
-func displaySuggestionsAndGetChoice(suggestions []ai.CommandSuggestion) (int, error) {
-	fmt.Println("🤖 AI Suggestions (sorted by confidence):")
-	fmt.Println()
+// canRunTUI reports whether the selection TUI can draw on this terminal: not
+// when standard output is redirected or the terminal is dumb, as in CI
+func canRunTUI() bool {
+	return term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("TERM") != "dumb"
+}
+
+// selectAndRun lets the user pick one of the suggestions and runs it, in the
+// selection TUI or, where it cannot run, with a numbered prompt. auto skips
+// the prompt and runs the top suggestion. It returns the exit code clia should
+// terminate with.
+func selectAndRun(userRequest string, suggestions []ai.CommandSuggestion, memorySuggestions []memory.SearchResult, service *CLIService, auto bool) (int, error) {
+	if canRunTUI() {
+		return runCLITUI(userRequest, suggestions, memorySuggestions, service)
+	}
+	return runPromptSelection(userRequest, suggestions, memorySuggestions, service, auto)
+}
+
+// runPromptSelection is the selection for terminals the TUI cannot run on:
+// the suggestions are numbered, and a line read from standard input picks one
+func runPromptSelection(userRequest string, suggestions []ai.CommandSuggestion, memorySuggestions []memory.SearchResult, service *CLIService, auto bool) (int, error) {
+	// Without the TUI to load them in the background, AI suggestions are awaited
+	if len(suggestions) == 0 && service.hasAIProvider() {
+		aiSuggestions, err := service.getAISuggestions(userRequest)
+		if err != nil {
+			fmt.Printf("⚠️  AI suggestions failed: %v\n", err)
+		}
+		suggestions = aiSuggestions
+	}
+
+	ranked := ai.RankSuggestions(suggestions, memorySuggestions, ai.RankOptions{PreferSafe: true})
+	if len(ranked) == 0 {
+		fmt.Printf("❌ No command suggestions available for: %s\n", userRequest)
+		return exitCodeError, nil
+	}
 
+	reader := bufio.NewReader(os.Stdin)
+	choice := 0
+	if !auto {
+		choice = displaySuggestionsAndGetChoice(ranked, reader)
+		if choice < 0 {
+			return exitCodeCancelled, nil
+		}
+	}
+
+	item := ranked[choice]
+	if item.Memory != nil {
+		service.recordAccepted(item.Memory.Entry.ID)
+	}
+	return service.executeCommand(item.CommandSuggestion, reader)
+}
+
+// displaySuggestionsAndGetChoice numbers the suggestions and reads the number
+// of the one to run from reader, asking again until it is valid. It returns
+// -1 when the user quits or the input ends.
+func displaySuggestionsAndGetChoice(suggestions ai.RankedItems, reader *bufio.Reader) int {
+	fmt.Println("🤖 Suggestions:")
 	for i, suggestion := range suggestions {
 		safetyIcon := "✅"
 		if !suggestion.Safe {
 			safetyIcon = "⚠️"
 		}
+		source := ""
+		if suggestion.Memory != nil {
+			source = " 💭"
+		}
 
-		confidencePercent := int(suggestion.Confidence * 100)
-		fmt.Printf("%d. %s %-30s - %s (%d%%)\n",
-			i+1, safetyIcon, suggestion.Command, suggestion.Description, confidencePercent)
+		fmt.Printf("%d. %s %s%s\n", i+1, safetyIcon, suggestion.Command, source)
+		if suggestion.Description != "" {
+			fmt.Printf("   %s\n", suggestion.Description)
+		}
 	}
 
-	fmt.Printf("\n🎯 Choose command (1-%d) or 'q' to quit: ", len(suggestions))
+	for {
+		fmt.Printf("\n🎯 Choose command (1-%d) or 'q' to quit: ", len(suggestions))
 
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
-	if err != nil {
-		return -1, fmt.Errorf("failed to read input: %w", err)
-	}
+		line, err := reader.ReadString('\n')
+		input := strings.TrimSpace(line)
+		if input == "q" || input == "quit" || (err != nil && input == "") {
+			return -1
+		}
 
-	input = strings.TrimSpace(input)
-	if input == "q" || input == "quit" {
-		return -1, nil
+		if choice, convErr := strconv.Atoi(input); convErr == nil && choice >= 1 && choice <= len(suggestions) {
+			return choice - 1 // Convert to 0-based index
+		}
+		if err != nil {
+			return -1
+		}
+		fmt.Printf("❌ Invalid choice, enter 1-%d or 'q'\n", len(suggestions))
 	}
+}
 
-	choice, err := strconv.Atoi(input)
-	if err != nil || choice < 1 || choice > len(suggestions) {
-		return -1, fmt.Errorf("invalid choice. Please enter 1-%d or 'q'", len(suggestions))
+// printCommandHelp prints the man page summary or --help output of command
+func (s *CLIService) printCommandHelp(command string) {
+	help, err := s.executor.LookupHelp(context.Background(), command)
+	if err != nil {
+		fmt.Printf("📖 %v\n", err)
+		return
 	}
+	fmt.Printf("📖 %s\n", help)
+}
 
-	return choice - 1, nil // Convert to 0-based index
+// printDeletionPreview prints what command would delete if it deletes files
+// through find or xargs and has a read-only variant
+func (s *CLIService) printDeletionPreview(command string) {
+	if _, ok := utils.DeletionPreview(s.executor.Resolve(command)); !ok {
+		return
+	}
+	impact, err := s.executor.PreviewDeletion(context.Background(), command)
+	if err != nil {
+		fmt.Printf("🔍 Could not check what would be deleted: %v\n", err)
+		return
+	}
+	fmt.Println(executor.FormatDeletionImpact(impact))
 }
 
-// executeCommand executes the selected command with safety checks
-func (s *CLIService) executeCommand(suggestion ai.CommandSuggestion) error {
+// executeCommand executes the selected command with safety checks, reading
+// confirmations from reader, and returns the exit code clia should terminate with
+func (s *CLIService) executeCommand(suggestion ai.CommandSuggestion, reader *bufio.Reader) (int, error) {
 	fmt.Printf("\n🎯 Selected: %s\n", suggestion.Command)
 
-	// Safety check
-	isDangerous := utils.IsDangerousCommand(suggestion.Command)
-	if isDangerous || !suggestion.Safe {
-		fmt.Printf("⚠️  SAFETY WARNING: This command may be dangerous\n")
-		fmt.Printf("🔍 Command: %s\n", suggestion.Command)
+	// Safety check, of what runs if the command is a session alias
+	resolved := s.executor.Resolve(suggestion.Command)
+	danger := s.executor.ExplainDanger(resolved)
+	dangerLevel := danger.Level
+	isDangerous := dangerLevel != utils.DangerNone
+	confirmAll := s.configManager != nil && s.configManager.GetConfig().Behavior.ConfirmAll
+	if isDangerous || !suggestion.Safe || confirmAll {
+		if isDangerous || !suggestion.Safe {
+			fmt.Printf("⚠️  SAFETY WARNING: This command may be dangerous\n")
+		} else {
+			fmt.Printf("🛡️  Paranoid mode: confirm before running\n")
+		}
+		if resolved != suggestion.Command {
+			fmt.Printf("🔍 Command: %s (alias %s)\n", resolved, executor.CommandProgram(suggestion.Command))
+		} else {
+			fmt.Printf("🔍 Command: %s\n", suggestion.Command)
+		}
+		if isDangerous {
+			fmt.Printf("🚩 Reason: %s\n", danger)
+			s.printDeletionPreview(suggestion.Command)
+		}
 
 		if suggestion.Description != "" {
 			fmt.Printf("📝 Description: %s\n", suggestion.Description)
@@ -375,30 +696,60 @@ func (s *CLIService) executeCommand(suggestion ai.CommandSuggestion) error {
 		confidencePercent := int(suggestion.Confidence * 100)
 		fmt.Printf("🎯 AI Confidence: %d%%\n", confidencePercent)
 
-		fmt.Printf("\n❓ Do you want to proceed? (y/N): ")
+		if dangerLevel == utils.DangerCritical {
+			fmt.Printf("🛑 CRITICAL: This command can irreversibly destroy data or the system\n")
+		}
 
-		reader := bufio.NewReader(os.Stdin)
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf("failed to read confirmation: %w", err)
+		var input string
+		for {
+			if dangerLevel == utils.DangerCritical {
+				fmt.Printf("\n⌨️  Type '%s' to proceed, or ? to see what it does: ", criticalConfirmationPhrase)
+			} else {
+				fmt.Printf("\n❓ Do you want to proceed? (y/N, ? for help): ")
+			}
+
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return exitCodeCancelled, fmt.Errorf("failed to read confirmation: %w", err)
+			}
+
+			input = strings.TrimSpace(strings.ToLower(line))
+			if input != "?" {
+				break
+			}
+			s.printCommandHelp(suggestion.Command)
 		}
 
-		input = strings.TrimSpace(strings.ToLower(input))
-		if input != "y" && input != "yes" {
+		confirmed := input == "y" || input == "yes"
+		if dangerLevel == utils.DangerCritical {
+			confirmed = input == criticalConfirmationPhrase
+		}
+		if !confirmed {
 			fmt.Println("❌ Command execution cancelled")
-			return nil
+			return exitCodeCancelled, nil
 		}
 
 		fmt.Println("✅ Command confirmed by user")
 	}
 
+	// Commands waiting for standard input would otherwise see none
+	var stdin io.Reader
+	if executor.ReadsStdin(suggestion.Command) {
+		fmt.Println("\n📥 This command reads standard input; type it and press Ctrl+D to end:")
+		input, err := io.ReadAll(reader)
+		if err != nil {
+			return exitCodeError, fmt.Errorf("failed to read command input: %w", err)
+		}
+		stdin = bytes.NewReader(input)
+	}
+
 	// Execute command
 	fmt.Printf("\n🚀 Executing: %s\n", suggestion.Command)
 
 	ctx := context.Background()
-	result, err := s.executor.Execute(ctx, suggestion.Command)
-	if err != nil {
-		return fmt.Errorf("command execution failed: %w", err)
+	result, err := s.executor.ExecuteWithInput(ctx, suggestion.Command, stdin)
+	if err != nil && result.ExitCode < 0 {
+		return exitCodeNotExecutable, fmt.Errorf("command execution failed: %w", err)
 	}
 
 	// Display results
@@ -425,11 +776,12 @@ func (s *CLIService) executeCommand(suggestion ai.CommandSuggestion) error {
 		fmt.Printf("\n❌ Command failed with exit code %d (%.2fs)\n", result.ExitCode, result.Duration.Seconds())
 	}
 
-	return nil
+	return result.ExitCode, nil
 }
 
 // runCLITUI starts the CLI-style interactive selection with the given suggestions
-func runCLITUI(userRequest string, suggestions []ai.CommandSuggestion, memorySuggestions []memory.SearchResult, service *CLIService) error {
+// and returns the exit code of the executed command
+func runCLITUI(userRequest string, suggestions []ai.CommandSuggestion, memorySuggestions []memory.SearchResult, service *CLIService) (int, error) {
 	// Create the CLI TUI model with memory support
 	model := NewCLITUIModel(userRequest, suggestions, memorySuggestions, service)
 
@@ -442,6 +794,14 @@ func runCLITUI(userRequest string, suggestions []ai.CommandSuggestion, memorySug
 	)
 
 	// Run the program
-	_, err := program.Run()
-	return err
+	finalModel, err := program.Run()
+	if err != nil {
+		return exitCodeError, err
+	}
+
+	if cliModel, ok := finalModel.(CLITUIModel); ok {
+		return cliModel.ExitCode(), nil
+	}
+
+	return exitCodeSuccess, nil
 }
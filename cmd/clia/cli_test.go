@@ -1,17 +1,34 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/yourusername/clia/internal/ai"
+	"github.com/yourusername/clia/internal/config"
+	"github.com/yourusername/clia/internal/executor"
 	"github.com/yourusername/clia/pkg/memory"
+	"github.com/yourusername/clia/pkg/utils"
 )
 
 func TestCLIServiceInitialization(t *testing.T) {
 	// Test service initialization without API keys
-	service, err := initializeCLIServices()
+	service, err := initializeCLIServices(false, -1)
 
 	// Should not return error even without API keys (fallback mode)
 	if err != nil {
@@ -36,7 +53,7 @@ func TestCLIServiceWithAPIKey(t *testing.T) {
 	os.Setenv("OPENROUTER_API_KEY", "test-key-for-testing")
 	defer os.Unsetenv("OPENROUTER_API_KEY")
 
-	service, err := initializeCLIServices()
+	service, err := initializeCLIServices(false, -1)
 
 	if err != nil {
 		t.Errorf("Expected no error with API key set, got: %v", err)
@@ -48,26 +65,52 @@ func TestCLIServiceWithAPIKey(t *testing.T) {
 }
 
 func TestDisplaySuggestionsAndGetChoice(t *testing.T) {
-	// Note: This test would require mocking stdin, which is complex
-	// For now, we just test that the function signature is correct
-	// and it doesn't panic with empty suggestions
+	suggestions := ai.RankSuggestions([]ai.CommandSuggestion{
+		{Command: "ls -la", Safe: true, Confidence: 0.9},
+		{Command: "du -sh .", Safe: true, Confidence: 0.8},
+	}, nil, ai.RankOptions{})
 
-	// Test with empty suggestions - should not panic
-	defer func() {
-		if r := recover(); r != nil {
-			t.Errorf("displaySuggestionsAndGetChoice panicked with empty suggestions: %v", r)
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"1\n", 0},
+		{"2\n", 1},
+		{"9\nfoo\n2\n", 1}, // Asked again until valid
+		{"q\n", -1},
+		{"", -1},  // No input, as in CI
+		{"2", 1},  // Last line without newline
+		{"9", -1}, // Input ends on an invalid choice
+	}
+	for _, tt := range tests {
+		if got := displaySuggestionsAndGetChoice(suggestions, bufio.NewReader(strings.NewReader(tt.input))); got != tt.want {
+			t.Errorf("displaySuggestionsAndGetChoice(%q) = %d, want %d", tt.input, got, tt.want)
 		}
-	}()
+	}
+}
 
-	// This would normally wait for user input, but we can't easily test that
-	// in a unit test without mocking stdin
-	// displaySuggestionsAndGetChoice([]ai.CommandSuggestion{})
+func TestPromptSelection(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("TERM", "dumb")
+	if canRunTUI() {
+		t.Fatal("Expected the TUI not to run on a dumb terminal")
+	}
 
-	// Test passes if we reach here without panicking
+	service, err := initializeCLIServices(true, -1)
+	if err != nil {
+		t.Fatalf("Failed to initialize CLI services: %v", err)
+	}
+	suggestions := []ai.CommandSuggestion{{Command: "exit 3", Safe: true, Confidence: 0.9}}
+
+	exitCode, err := selectAndRun("exit with 3", suggestions, nil, service, true)
+	if err != nil || exitCode != 3 {
+		t.Errorf("Expected --auto to run the top suggestion without asking, got exit code %d, %v", exitCode, err)
+	}
 }
 
 func TestCLIFallbackSuggestions(t *testing.T) {
-	service, err := initializeCLIServices()
+	service, err := initializeCLIServices(false, -1)
 	if err != nil {
 		t.Errorf("Failed to initialize CLI services: %v", err)
 		return
@@ -180,3 +223,811 @@ func TestCLITUIModelCreation(t *testing.T) {
 		t.Error("Expected view to contain CLI-style help text")
 	}
 }
+
+func TestCLITUICompactSuggestions(t *testing.T) {
+	suggestions := []ai.CommandSuggestion{
+		{Command: "ls -la", Description: "List files", Safe: true, Confidence: 0.9},
+		{Command: "find . -type f -size +100M -exec ls -lh {} \\; | sort -k 5 -h", Description: "Find large files", Safe: true, Confidence: 0.8},
+	}
+	model := NewCLITUIModel("test query", suggestions, []memory.SearchResult{}, &CLIService{})
+	model.ready = true
+	model.width = 40
+	model.height = 24
+
+	view := model.View()
+	if !strings.Contains(view, "List files") {
+		t.Error("Expected the selected suggestion to show its description")
+	}
+	if strings.Contains(view, "Find large files") {
+		t.Error("Expected other suggestions to hide their description")
+	}
+	if !strings.Contains(view, "…") {
+		t.Error("Expected long commands to be shortened")
+	}
+
+	// Moving the selection reveals the other description
+	model.selectedIndex = 1
+	view = model.View()
+	if strings.Contains(view, "List files") || !strings.Contains(view, "Find large files") {
+		t.Error("Expected the description to follow the selection")
+	}
+}
+
+func TestCLITUICategoryGroups(t *testing.T) {
+	suggestions := []ai.CommandSuggestion{
+		{Command: "rm -r build", Description: "Remove the build directory", Safe: true, Confidence: 0.9, Category: "file_management"},
+		{Command: "cd ~", Description: "Go home", Safe: true, Confidence: 0.8, Category: "navigation"},
+		{Command: "rm *.tmp", Description: "Remove temporary files", Safe: true, Confidence: 0.7, Category: "file_management"},
+	}
+	model := NewCLITUIModel("clean up and go home", suggestions, []memory.SearchResult{}, &CLIService{})
+	model.ready = true
+	model.width = 100
+
+	view := model.View()
+	files := strings.Index(view, "File management")
+	navigation := strings.Index(view, "Navigation")
+	if files < 0 || navigation < strings.Index(view, "A2.") || !strings.Contains(view, "A3. ✅ cd ~") {
+		t.Errorf("Expected category headers with continuous numbering, got:\n%s", view)
+	}
+
+	model.selectedIndex = 2
+	if command := model.selectedCommand(); command != "cd ~" {
+		t.Errorf("Expected A3 to select 'cd ~', got %q", command)
+	}
+}
+
+func TestCLITUIModelExitCode(t *testing.T) {
+	service := &CLIService{memoryEnabled: false}
+	model := NewCLITUIModel("test query", nil, []memory.SearchResult{}, service)
+
+	// Quitting without executing anything is reported as a cancellation
+	if code := model.ExitCode(); code != exitCodeCancelled {
+		t.Errorf("Expected exit code %d without execution, got %d", exitCodeCancelled, code)
+	}
+
+	model.commandResult = &executor.ExecutionResult{ExitCode: 3}
+	if code := model.ExitCode(); code != 3 {
+		t.Errorf("Expected command exit code 3 to be propagated, got %d", code)
+	}
+
+	model.commandResult = &executor.ExecutionResult{ExitCode: -1}
+	if code := model.ExitCode(); code != exitCodeNotExecutable {
+		t.Errorf("Expected exit code %d for a command that failed to start, got %d", exitCodeNotExecutable, code)
+	}
+}
+
+func TestCLITUIModelConfirmation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	configManager, err := config.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &CLIService{configManager: configManager, executor: executor.New()}
+	suggestions := []ai.CommandSuggestion{
+		{Command: "echo hi", Description: "Say hi", Safe: true, Confidence: 0.9},
+		{Command: "chmod -R 777 .", Description: "Open up permissions", Safe: false, Confidence: 0.5},
+	}
+	key := func(k string) tea.KeyMsg {
+		switch k {
+		case "enter":
+			return tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			return tea.KeyMsg{Type: tea.KeyEsc}
+		}
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+	}
+	press := func(model CLITUIModel, keys ...string) (CLITUIModel, tea.Cmd) {
+		var cmd tea.Cmd
+		for _, k := range keys {
+			var updated tea.Model
+			updated, cmd = model.Update(key(k))
+			model = updated.(CLITUIModel)
+		}
+		return model, cmd
+	}
+
+	// A safe command runs right away
+	model, cmd := press(NewCLITUIModel("say hi", suggestions, nil, service), "enter", "enter")
+	if model.state != StateExecuting || cmd == nil {
+		t.Fatalf("Expected a safe command to run, got state %v", model.state)
+	}
+
+	// An unsafe suggestion waits for y; n goes back to editing
+	model, _ = press(NewCLITUIModel("open up", suggestions, nil, service), "j", "enter", "enter")
+	if model.state != StateConfirming || !strings.Contains(model.View(), "SAFETY WARNING") {
+		t.Fatalf("Expected the unsafe command to need confirmation, got state %v", model.state)
+	}
+	model, _ = press(model, "n")
+	if model.state != StateEditing {
+		t.Errorf("Expected n to go back to editing, got state %v", model.state)
+	}
+	model, cmd = press(model, "enter", "y")
+	if model.state != StateExecuting || cmd == nil {
+		t.Errorf("Expected y to run the command, got state %v", model.state)
+	}
+
+	// Critical commands need the phrase typed out, y is not enough
+	critical := []ai.CommandSuggestion{{Command: "rm -rf /", Description: "Remove everything", Safe: true, Confidence: 0.9}}
+	model, _ = press(NewCLITUIModel("wipe", critical, nil, service), "enter", "enter", "y", "enter")
+	if model.state != StateEditing {
+		t.Errorf("Expected y to cancel a critical command, got state %v", model.state)
+	}
+	model, _ = press(model, "enter")
+	if model.state != StateConfirming || !strings.Contains(model.View(), criticalConfirmationPhrase) {
+		t.Fatalf("Expected the critical command to ask for the phrase, got state %v", model.state)
+	}
+	model, cmd = press(model, criticalConfirmationPhrase, "enter")
+	if model.state != StateExecuting || cmd == nil || model.pendingCommand != "rm -rf /" {
+		t.Errorf("Expected the typed phrase to confirm, got state %v", model.state)
+	}
+
+	// Paranoid mode confirms every command
+	configManager.GetConfig().Behavior.ConfirmAll = true
+	model, _ = press(NewCLITUIModel("say hi", suggestions, nil, service), "enter", "enter")
+	if model.state != StateConfirming || !strings.Contains(model.View(), "Paranoid mode") {
+		t.Errorf("Expected confirm_all to ask before a safe command, got state %v", model.state)
+	}
+}
+
+func TestCLITUIModelUsesServiceExecutor(t *testing.T) {
+	logDir := t.TempDir()
+	service := &CLIService{executor: executor.New().WithRunLog(logDir, true)}
+	model := NewCLITUIModel("say hi", nil, []memory.SearchResult{}, service)
+
+	// Commands run from the TUI keep a run log like those of the CLI
+	msg := model.executeCommand("echo hi")().(commandCompleteMsg)
+	if msg.result.ExitCode != 0 {
+		t.Fatalf("Expected echo to succeed, got %+v", msg.result)
+	}
+	logs, err := os.ReadDir(logDir)
+	if err != nil || len(logs) != 1 {
+		t.Errorf("Expected one run log, got %v (%v)", logs, err)
+	}
+}
+
+func TestCLITUIModelRecordsHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	cmdExecutor := executor.New().WithHistory(path, executor.HistoryFormatJSONL).
+		WithLogRotation(utils.RotationPolicy{MaxSize: 1, MaxFiles: 2})
+	model := NewCLITUIModel("say hi", nil, []memory.SearchResult{}, &CLIService{executor: cmdExecutor})
+
+	// Commands run from the TUI reach the rotating history file
+	model.executeCommand("echo first")()
+	model.executeCommand("echo second")()
+	current, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(current), "echo second") {
+		t.Fatalf("Expected the last command in the history, got %q (%v)", current, err)
+	}
+	rolled, err := os.ReadFile(path + ".1")
+	if err != nil || !strings.Contains(string(rolled), "echo first") {
+		t.Errorf("Expected the earlier command to be rolled over, got %q (%v)", rolled, err)
+	}
+}
+
+func TestCLITUIAttachedRunRecordsHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	service := &CLIService{executor: executor.New().WithHistory(path, executor.HistoryFormatJSONL)}
+	model := NewCLITUIModel("fail", nil, []memory.SearchResult{}, service)
+
+	// Commands attached to the terminal, like sudo, reach the history too
+	run := &attachedRun{executor: model.executor, command: "echo attached; exit 2"}
+	run.SetStdin(strings.NewReader(""))
+	run.SetStdout(io.Discard)
+	run.SetStderr(io.Discard)
+	if err := run.Run(); err != nil || run.result.ExitCode != 2 {
+		t.Fatalf("Expected the attached run to exit with 2, got %+v (%v)", run.result, err)
+	}
+	history, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(history), `"command":"echo attached; exit 2"`) || !strings.Contains(string(history), `"exit_code":2`) {
+		t.Errorf("Expected the attached run in the history, got %q (%v)", history, err)
+	}
+}
+
+func TestParseLeadingFlags(t *testing.T) {
+	boolFlags := []string{"--offline", "--quiet", "--capture"}
+	valueFlags := []string{"--model", "--max-cost"}
+	tests := []struct {
+		args          []string
+		expectedArgs  string
+		expectedModel string
+		quiet         bool
+	}{
+		{[]string{"list", "files"}, "list files", "", false},
+		{[]string{"--model", "fast", "list", "files"}, "list files", "fast", false},
+		{[]string{"--quiet", "--model=smart", "list", "files"}, "list files", "smart", true},
+		{[]string{"--model", "openai/gpt-4", "--", "--model", "x"}, "--model x", "openai/gpt-4", false},
+		// Options of the request are not clia flags
+		{[]string{"git", "commit", "-m", "fix typo"}, "git commit -m fix typo", "", false},
+		{[]string{"-m", "fast", "show", "disk"}, "-m fast show disk", "", false},
+		{[]string{"list", "files", "--model", "smart"}, "list files --model smart", "", false},
+		{[]string{"list", "files", "--model=smart"}, "list files --model=smart", "", false},
+		{[]string{"run", "rsync", "--quiet", "--capture"}, "run rsync --quiet --capture", "", false},
+		{[]string{"--quiet", "run", "rsync", "--offline", "--max-cost", "1"}, "run rsync --offline --max-cost 1", "", true},
+	}
+
+	for _, tt := range tests {
+		flags, args, err := parseLeadingFlags(tt.args, boolFlags, valueFlags)
+		if err != nil {
+			t.Errorf("parseLeadingFlags(%v) returned error: %v", tt.args, err)
+			continue
+		}
+		if strings.Join(args, " ") != tt.expectedArgs || flags.value("--model") != tt.expectedModel || flags.isSet("--quiet") != tt.quiet {
+			t.Errorf("parseLeadingFlags(%v) = %v, %q, quiet %v; expected %q, %q, quiet %v",
+				tt.args, args, flags.value("--model"), flags.isSet("--quiet"), tt.expectedArgs, tt.expectedModel, tt.quiet)
+		}
+		if flags.isSet("--offline") || flags.isSet("--capture") || flags.value("--max-cost") != "" {
+			t.Errorf("parseLeadingFlags(%v) read flags of the request: %+v", tt.args, flags)
+		}
+	}
+
+	if _, _, err := parseLeadingFlags([]string{"--model"}, boolFlags, valueFlags); err == nil {
+		t.Error("Expected error when --model has no value")
+	}
+}
+
+func TestOfflineCLIService(t *testing.T) {
+	flags, args, _ := parseLeadingFlags([]string{"--offline", "show", "disk"}, []string{"--offline"}, nil)
+	if !flags.isSet("--offline") || strings.Join(args, " ") != "show disk" {
+		t.Errorf("parseLeadingFlags = %v, %v; expected [show disk], true", args, flags.isSet("--offline"))
+	}
+
+	service, err := initializeCLIServices(true, -1)
+	if err != nil {
+		t.Fatalf("initializeCLIServices(true, -1) returned error: %v", err)
+	}
+	if service.hasAIProvider() {
+		t.Error("Expected no AI provider in offline mode")
+	}
+
+	suggestions, err := service.getAISuggestions("show disk space")
+	if err != nil {
+		t.Fatalf("Expected offline suggestions, got error: %v", err)
+	}
+	if len(suggestions) == 0 || suggestions[0].Command != "df -h" {
+		t.Errorf("Expected 'df -h' as top offline suggestion, got %v", suggestions)
+	}
+}
+
+func TestRunSetup(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("OPENROUTER_API_KEY", "")
+
+	configManager, err := config.NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create config manager: %v", err)
+	}
+
+	validated := ""
+	validate := func(providerType ai.ProviderType, apiKey string) error {
+		validated = string(providerType) + ":" + apiKey
+		return nil
+	}
+
+	if err := runSetup(strings.NewReader("1\nor-test-key\n"), configManager, validate); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	if validated != "openrouter:or-test-key" {
+		t.Errorf("Expected the key to be validated, got %q", validated)
+	}
+
+	loaded, _ := config.NewManager()
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Failed to load saved config: %v", err)
+	}
+	if provider, key, ok := loaded.GetStoredProvider(); !ok || provider != "openrouter" || key != "or-test-key" {
+		t.Errorf("Expected saved openrouter key, got %q %q %v", provider, key, ok)
+	}
+
+	// A rejected key is not saved
+	reject := func(ai.ProviderType, string) error { return ai.NewAIError(ai.ErrorTypeAuth, "invalid key", nil) }
+	if err := runSetup(strings.NewReader("openai\nbad-key\n"), configManager, reject); err == nil {
+		t.Error("Expected setup to fail for a rejected key")
+	}
+
+	if err := runSetup(strings.NewReader("9\n"), configManager, validate); err == nil {
+		t.Error("Expected setup to fail for an unknown provider")
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	for _, shell := range completionShells {
+		script, err := completionScript(shell)
+		if err != nil {
+			t.Fatalf("completionScript(%s) failed: %v", shell, err)
+		}
+
+		for _, command := range cliCommands {
+			if !strings.Contains(script, command.Name) {
+				t.Errorf("%s script is missing the %s command", shell, command.Name)
+			}
+			for _, subcommand := range command.Subcommands {
+				if !strings.Contains(script, subcommand) {
+					t.Errorf("%s script is missing %s %s", shell, command.Name, subcommand)
+				}
+			}
+		}
+		for _, flag := range cliFlags {
+			if !strings.Contains(script, flag.Name) {
+				t.Errorf("%s script is missing the --%s flag", shell, flag.Name)
+			}
+		}
+	}
+
+	if _, err := completionScript("powershell"); err == nil {
+		t.Error("Expected error for an unsupported shell")
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	if _, err := runCLIMode("  \t ", "", true, true, true, false, -1); err == nil || !strings.Contains(err.Error(), "empty request") {
+		t.Errorf("Expected an empty request error, got %v", err)
+	}
+
+	if err := runAnalysisMode("name,size\n", "   ", analysisOutputTUI); err == nil || !strings.Contains(err.Error(), "analysis command required") {
+		t.Errorf("Expected a missing analysis command error, got %v", err)
+	}
+	if err := runAnalysisMode(" \n\n", "make table", analysisOutputTUI); err == nil || !strings.Contains(err.Error(), "printed nothing") {
+		t.Errorf("Expected an empty input error, got %v", err)
+	}
+
+	if err := runAskCommand([]string{" ", ""}, "", false, -1); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("Expected a usage error for an empty question, got %v", err)
+	}
+}
+
+func TestRunConfigCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	if err := runConfigCommand(nil); err == nil {
+		t.Error("Expected a usage error without a subcommand")
+	}
+	if err := runConfigCommand([]string{"frobnicate"}); err == nil {
+		t.Error("Expected an error for an unknown subcommand")
+	}
+
+	configManager, err := config.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runConfigCommand([]string{"migrate"}); err != nil {
+		t.Errorf("Expected no error without a config file, got %v", err)
+	}
+
+	os.MkdirAll(filepath.Dir(configManager.GetConfigPath()), 0755)
+	os.WriteFile(configManager.GetConfigPath(), []byte("api:\n  key: sk-old\n"), 0600)
+	if err := runConfigCommand([]string{"migrate"}); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if _, err := os.Stat(configManager.GetConfigPath() + ".v1.bak"); err != nil {
+		t.Errorf("Expected a backup of the old file: %v", err)
+	}
+	if err := runConfigCommand([]string{"migrate"}); err != nil {
+		t.Errorf("Expected an up-to-date file to migrate without error, got %v", err)
+	}
+}
+
+func TestAnalyzerRerun(t *testing.T) {
+	mockProvider := ai.NewMockProvider("test", "test-model")
+	mockProvider.SetMockResponse(&ai.CompletionResponse{Content: "Two lines of data"})
+	service := ai.NewService()
+	service.SetProvider(mockProvider)
+
+	analyzer, err := newAnalyzerModel(service, "error: disk full\ninfo: started\n", "summarize")
+	if err != nil {
+		t.Fatalf("newAnalyzerModel failed: %v", err)
+	}
+	var model tea.Model = *analyzer
+	model, _ = model.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+
+	// run feeds messages to the model until no command is left
+	run := func(msg tea.Msg) AnalyzerTUIModel {
+		for msg != nil {
+			var cmd tea.Cmd
+			model, cmd = model.Update(msg)
+			if cmd == nil {
+				break
+			}
+			msg = cmd()
+		}
+		return model.(AnalyzerTUIModel)
+	}
+
+	current := run(startAnalysisMsg{})
+	if current.state != StateDisplaying || current.analysisResult == nil || current.partial != "Two lines of data" {
+		t.Fatalf("Expected the streamed result to be shown, got state %v and %q", current.state, current.partial)
+	}
+
+	// Edit the instruction and re-run it on the data in memory
+	current = run(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	if !current.editing || current.input.Value() != "summarize" {
+		t.Fatalf("Expected to edit the current instruction, got %q", current.input.Value())
+	}
+	current.input.SetValue("now just the errors")
+	model = current
+	model, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	current = model.(AnalyzerTUIModel)
+	if current.editing || current.state != StateAnalyzing || current.analysisCommand != "now just the errors" || cmd == nil {
+		t.Fatalf("Expected a re-run with the new instruction, got state %v and %q", current.state, current.analysisCommand)
+	}
+
+	// Esc cancels the run; its late events are dropped
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	current = model.(AnalyzerTUIModel)
+	if !current.cancelled || current.state != StateDisplaying {
+		t.Fatal("Expected Esc to cancel the analysis")
+	}
+	model, _ = model.Update(AnalysisEventMsg{runID: current.runID, done: true, result: &AnalysisResult{Result: "late"}})
+	if model.(AnalyzerTUIModel).analysisResult != nil {
+		t.Error("Expected the result of a cancelled run to be dropped")
+	}
+	if !strings.Contains(model.View(), "Analysis cancelled") {
+		t.Error("Expected the view to say the analysis was cancelled")
+	}
+
+	// r re-runs the instruction
+	current = run(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	if current.state != StateDisplaying || current.analysisResult == nil || current.runID != 3 {
+		t.Errorf("Expected r to re-run the analysis, got state %v and run %d", current.state, current.runID)
+	}
+}
+
+func TestAnalysisOutput(t *testing.T) {
+	mockProvider := ai.NewMockProvider("test", "test-model")
+	mockProvider.SetMockResponse(&ai.CompletionResponse{Content: "| name | size |"})
+	service := ai.NewService()
+	service.SetProvider(mockProvider)
+
+	var chunks strings.Builder
+	result, err := analyze(context.Background(), service, "name,size\na,1\n", "make table", func(chunk string) {
+		chunks.WriteString(chunk)
+	})
+	if err != nil {
+		t.Fatalf("analyze failed: %v", err)
+	}
+	if result.Result != "| name | size |" || chunks.String() != result.Result {
+		t.Errorf("Expected the answer to stream and be returned, got %q and %q", chunks.String(), result.Result)
+	}
+	if result.AnalysisType != ai.AnalysisTypeTable || result.Model != "test-model" || result.InputBytes != 14 {
+		t.Errorf("Expected the metadata of the analysis, got %+v", result)
+	}
+
+	var raw strings.Builder
+	if err := writeAnalysisResult(&raw, result, analysisOutputRaw); err != nil || raw.String() != "| name | size |\n" {
+		t.Errorf("Expected the raw answer, got %q (%v)", raw.String(), err)
+	}
+	var out strings.Builder
+	if err := writeAnalysisResult(&out, result, analysisOutputJSON); err != nil {
+		t.Fatalf("writeAnalysisResult failed: %v", err)
+	}
+	var decoded AnalysisResult
+	if err := json.Unmarshal([]byte(out.String()), &decoded); err != nil || decoded.Result != result.Result || decoded.Command != "make table" {
+		t.Errorf("Expected the result as JSON, got %s (%v)", out.String(), err)
+	}
+
+	if _, err := analyze(context.Background(), service, "  ", "make table", nil); err == nil {
+		t.Error("Expected an error for empty data")
+	}
+	for output, ok := range map[string]bool{"": true, "raw": true, "json": true, "yaml": false} {
+		if _, err := validAnalysisOutput(output); (err == nil) != ok {
+			t.Errorf("validAnalysisOutput(%q) = %v, expected ok = %v", output, err, ok)
+		}
+	}
+}
+
+func TestServeAPI(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	for addr, ok := range map[string]bool{"127.0.0.1:7878": true, "localhost:0": true, "[::1]:7878": true, "0.0.0.0:7878": false} {
+		if err := checkServeAddr(addr, ""); (err == nil) != ok {
+			t.Errorf("checkServeAddr(%q) = %v, expected ok = %v", addr, err, ok)
+		}
+	}
+	if err := checkServeAddr("0.0.0.0:7878", "secret"); err != nil {
+		t.Errorf("Expected a token to allow other addresses, got %v", err)
+	}
+
+	service, err := initializeCLIServices(true, -1)
+	if err != nil {
+		t.Fatalf("initializeCLIServices(true, -1) returned error: %v", err)
+	}
+	server := httptest.NewServer(service.serveHandler("secret"))
+	defer server.Close()
+
+	send := func(req *http.Request) int {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", req.Method, req.URL.Path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	post := func(path, body, token string) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if status, _ := post("/suggest", `{"input":"show disk space"}`, ""); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", status)
+	}
+	if status, _ := post("/suggest", `{"input":"show disk space"}`, "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong token, got %d", status)
+	}
+
+	status, body := post("/suggest", `{"input":"show disk space"}`, "secret")
+	var suggestions suggestResponse
+	if err := json.Unmarshal([]byte(body), &suggestions); status != http.StatusOK || err != nil {
+		t.Fatalf("Expected suggestions, got %d: %s", status, body)
+	}
+	if len(suggestions.Suggestions) == 0 || suggestions.Suggestions[0].Command != "df -h" {
+		t.Errorf("Expected 'df -h' as top suggestion, got %v", suggestions.Suggestions)
+	}
+
+	if status, _ := post("/suggest", `{"input":""}`, "secret"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for empty input, got %d", status)
+	}
+	if status, _ := post("/explain", `not json`, "secret"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid JSON, got %d", status)
+	}
+
+	// Simple cross-site POSTs and DNS rebinding are refused
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/suggest", strings.NewReader(`{"input":"x"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "text/plain")
+	if status := send(req); status != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for a text/plain body, got %d", status)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "https://example.com")
+	if status := send(req); status != http.StatusForbidden {
+		t.Errorf("Expected 403 with an Origin header, got %d", status)
+	}
+	req, _ = http.NewRequest(http.MethodPost, server.URL+"/suggest", strings.NewReader(`{"input":"x"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+	req.Host = "attacker.example:" + strconv.Itoa(server.Listener.Addr().(*net.TCPAddr).Port)
+	if status := send(req); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for another Host, got %d", status)
+	}
+	req, _ = http.NewRequest(http.MethodPost, server.URL+"/suggest", strings.NewReader(`{"input":"x"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+	req.Host = "127.0.0.1:1"
+	if status := send(req); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for another port, got %d", status)
+	}
+
+	status, body = post("/explain", `{"command":"rm -rf /"}`, "secret")
+	var explanation explainResponse
+	if err := json.Unmarshal([]byte(body), &explanation); status != http.StatusOK || err != nil {
+		t.Fatalf("Expected an explanation, got %d: %s", status, body)
+	}
+	if explanation.Danger != "critical" || explanation.Reason == "" || explanation.Explanation != "" {
+		t.Errorf("Expected a critical assessment without AI explanation offline, got %+v", explanation)
+	}
+}
+
+// switchingProvider is a MockProvider switching between models, which
+// suggests echoing the model it answers with
+type switchingProvider struct {
+	*ai.MockProvider
+	model string
+}
+
+func (p *switchingProvider) Complete(ctx context.Context, req *ai.CompletionRequest) (*ai.CompletionResponse, error) {
+	model := p.model
+	time.Sleep(time.Millisecond) // Lets requests overlap
+	return &ai.CompletionResponse{
+		Suggestions: []ai.CommandSuggestion{{Command: "echo " + model, Confidence: 0.9, Safe: true}},
+		Model:       model,
+	}, nil
+}
+
+func (p *switchingProvider) GetModel() string { return p.model }
+
+func (p *switchingProvider) SwitchModel(modelName string) error {
+	p.model = modelName
+	return nil
+}
+
+func TestServeConcurrentModels(t *testing.T) {
+	provider := &switchingProvider{MockProvider: ai.NewMockProvider("mock", "base"), model: "base"}
+	service := &CLIService{aiService: ai.NewService().SetProvider(provider), executor: executor.New()}
+	server := httptest.NewServer(service.serveHandler(""))
+	defer server.Close()
+
+	// Run with -race: requests for another model must not switch the model
+	// of requests running at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		model := "base"
+		body := fmt.Sprintf(`{"input":"request %d"}`, i)
+		if i%2 == 1 {
+			model = "other"
+			body = fmt.Sprintf(`{"input":"request %d","model":"other"}`, i)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(server.URL+"/suggest", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Errorf("POST /suggest failed: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			var response suggestResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || len(response.Suggestions) == 0 {
+				t.Errorf("Expected suggestions for %s, got %d: %v", body, resp.StatusCode, err)
+				return
+			}
+			if command := response.Suggestions[0].Command; command != "echo "+model {
+				t.Errorf("Expected %s to be answered by %s, got %q", body, model, command)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if provider.model != "base" {
+		t.Errorf("Expected the model to be restored, got %s", provider.model)
+	}
+}
+
+func TestRememberedCommand(t *testing.T) {
+	exact := func(command string, uses int, success bool) memory.SearchResult {
+		return memory.SearchResult{
+			Entry:     memory.MemoryEntry{NormalizedRequest: "list files", SelectedCommand: command, UsageCount: uses, Success: success},
+			Score:     0.95,
+			MatchType: memory.MatchTypeExact,
+		}
+	}
+	fuzzy := exact("ls -la", 9, true)
+	fuzzy.MatchType, fuzzy.Score = memory.MatchTypeFuzzy, 0.8
+	similar := exact("ls -la", 9, true)
+	similar.Entry.NormalizedRequest = "list files here"
+	unpopular := exact("ls -la", 9, true)
+	unpopular.Score = 0.5
+
+	tests := []struct {
+		name    string
+		results []memory.SearchResult
+		want    bool
+	}{
+		{"used often", []memory.SearchResult{exact("ls -la", 5, true), fuzzy}, true},
+		{"same command twice", []memory.SearchResult{exact("ls -la", 5, true), exact("ls -al", 1, true)}, true},
+		{"used rarely", []memory.SearchResult{exact("ls -la", 4, true)}, false},
+		{"failed last time", []memory.SearchResult{exact("ls -la", 9, false)}, false},
+		{"different commands", []memory.SearchResult{exact("ls -la", 9, true), exact("tree", 1, true)}, false},
+		{"no exact match", []memory.SearchResult{fuzzy, similar}, false},
+		{"low score", []memory.SearchResult{unpopular}, false},
+	}
+	for _, tt := range tests {
+		if _, ok := rememberedCommand("List  files", tt.results, 5, 0.8); ok != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, ok)
+		}
+	}
+}
+
+func TestRunRemembered(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	configManager, err := config.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	memoryManager, err := memory.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	historyPath, logDir := filepath.Join(t.TempDir(), "history.jsonl"), t.TempDir()
+	cmdExecutor := executor.New().WithHistory(historyPath, executor.HistoryFormatJSONL).WithRunLog(logDir, true)
+	service := &CLIService{configManager: configManager, memoryManager: memoryManager, memoryEnabled: true, executor: cmdExecutor}
+
+	for i := 0; i < 5; i++ {
+		memoryManager.Add("fail on purpose", "exit 3", "Exit with 3", "ai", true)
+		memoryManager.Add("wipe the disk", "rm -rf /", "Remove everything", "ai", true)
+	}
+	search := func(request string) []memory.SearchResult {
+		options := memory.DefaultSearchOptions()
+		options.IncludeFailures = true
+		results, err := memoryManager.Search(request, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	exitCode, ran := service.runRemembered("fail on purpose", search("fail on purpose"), true)
+	if !ran || exitCode != 3 {
+		t.Fatalf("Expected the remembered command to run with exit code 3, got %d (ran %v)", exitCode, ran)
+	}
+	if entry := search("fail on purpose")[0].Entry; entry.UsageCount != 6 || entry.Success {
+		t.Errorf("Expected the run to be remembered as a failure, got %+v", entry)
+	}
+
+	// Runs without confirmation are in the history and run logs
+	history, err := os.ReadFile(historyPath)
+	if err != nil || !strings.Contains(string(history), `"command":"exit 3"`) || !strings.Contains(string(history), `"exit_code":3`) {
+		t.Errorf("Expected the run in the history, got %q (%v)", history, err)
+	}
+	if logs, err := os.ReadDir(logDir); err != nil || len(logs) != 1 {
+		t.Errorf("Expected one run log, got %v (%v)", logs, err)
+	}
+
+	// A failed command, and a dangerous one, are not run again without asking
+	if _, ran := service.runRemembered("fail on purpose", search("fail on purpose"), true); ran {
+		t.Error("Expected a command that failed last time not to run")
+	}
+	if _, ran := service.runRemembered("wipe the disk", search("wipe the disk"), true); ran {
+		t.Error("Expected a dangerous command not to run automatically")
+	}
+}
+
+func TestReadInputFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.csv")
+	if err := os.WriteFile(path, []byte("name,size\na,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := readInputFile(path)
+	if err != nil || data != "name,size\na,1\n" {
+		t.Errorf("Expected the file contents, got %q, %v", data, err)
+	}
+
+	empty := filepath.Join(dir, "empty.csv")
+	os.WriteFile(empty, []byte("\n"), 0644)
+	for _, bad := range []string{filepath.Join(dir, "missing.csv"), dir, empty} {
+		if _, err := readInputFile(bad); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+}
+
+func TestParseCLIFlags(t *testing.T) {
+	// --output is an option of the request unless there is input to analyze
+	request := []string{"save", "page", "with", "curl", "--output", "page.html"}
+	for _, analysis := range []bool{true, false} {
+		if _, args, err := parseCLIFlags(request, analysis); err != nil || strings.Join(args, " ") != strings.Join(request, " ") {
+			t.Errorf("parseCLIFlags(%v, %v) = %v, %v; expected the request unchanged", request, analysis, args, err)
+		}
+	}
+	leading := []string{"--output", "page.html", "download", "it"}
+	if flags, args, _ := parseCLIFlags(leading, false); flags.value("--output") != "" || len(args) != 4 {
+		t.Errorf("Expected --output to stay in a request without input, got %v, %v", flags.values, args)
+	}
+	if flags, args, _ := parseCLIFlags([]string{"--output", "json", "--input-file", "data.csv", "summarize"}, true); flags.value("--output") != "json" || flags.value("--input-file") != "data.csv" || strings.Join(args, " ") != "summarize" {
+		t.Errorf("Expected the analysis flags to be read, got %v, %v", flags.values, args)
+	}
+	if flags, args, _ := parseCLIFlags([]string{"summarize", "--input-file", "data.csv"}, true); flags.value("--input-file") != "" || len(args) != 3 {
+		t.Errorf("Expected --input-file after the request to stay in it, got %v, %v", flags.values, args)
+	}
+}
+
+func TestParseMaxCost(t *testing.T) {
+	if dollars, err := parseMaxCost("$0.50"); err != nil || dollars != 0.5 {
+		t.Errorf("parseMaxCost($0.50) = %v, %v; expected 0.5", dollars, err)
+	}
+	if dollars, _ := parseMaxCost(""); dollars != -1 {
+		t.Errorf("Expected -1 without the flag, got %v", dollars)
+	}
+	for _, value := range []string{"cheap", "-1"} {
+		if _, err := parseMaxCost(value); err == nil {
+			t.Errorf("Expected --max-cost=%s to be rejected", value)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/textinput"
@@ -11,6 +14,7 @@ import (
 
 	"github.com/yourusername/clia/internal/ai"
 	"github.com/yourusername/clia/internal/executor"
+	"github.com/yourusername/clia/internal/tui"
 	"github.com/yourusername/clia/pkg/memory"
 	"github.com/yourusername/clia/pkg/utils"
 )
@@ -22,6 +26,7 @@ const (
 	StateSelecting  CLITUIState = iota // Selecting from suggestions
 	StateEditing                       // Editing the selected command
 	StateCompleting                    // Path completion mode
+	StateConfirming                    // Confirming a risky command, or any command in paranoid mode
 	StateExecuting                     // Executing command
 	StateCompleted                     // Command completed, ready to exit
 )
@@ -33,6 +38,7 @@ type CLITUIModel struct {
 	userRequest       string
 	suggestions       []ai.CommandSuggestion
 	memorySuggestions []memory.SearchResult
+	ranked            ai.RankedItems // Memory and AI suggestions in the order they are listed
 	service           *CLIService
 
 	// Selection state
@@ -41,6 +47,7 @@ type CLITUIModel struct {
 	// Editing state
 	input          textinput.Model
 	editingCommand string
+	copyNotice     string // Whether the selected command was copied, with copy_on_select
 
 	// Path completion state
 	completionCandidates []string                     // List of completion candidates
@@ -48,6 +55,12 @@ type CLITUIModel struct {
 	completionContext    *utils.PathCompletionContext // Context for current completion
 	inCompletionMode     bool                         // Whether we're in completion mode
 
+	// Confirmation state
+	pendingCommand       string          // Command waiting for confirmation
+	confirmDetails       []string        // Why the command needs confirmation
+	requiredConfirmation string          // Phrase to type for critical commands instead of y
+	confirmInput         textinput.Model // Where the phrase is typed
+
 	// Execution state
 	executor        *executor.Executor
 	executing       bool
@@ -57,6 +70,7 @@ type CLITUIModel struct {
 	// AI processing state
 	aiProcessing bool
 	aiProcessed  bool
+	aiNotice     string // Actionable AI problem shown below the suggestions
 
 	// UI state
 	width  int
@@ -71,7 +85,14 @@ func NewCLITUIModel(userRequest string, suggestions []ai.CommandSuggestion, memo
 	input.CharLimit = 500
 	input.Width = 80
 
-	return CLITUIModel{
+	// Commands run with the executor of the service, which keeps run logs
+	// and the history as configured
+	cmdExecutor := service.executor
+	if cmdExecutor == nil {
+		cmdExecutor = executor.New()
+	}
+
+	model := CLITUIModel{
 		state:             StateSelecting,
 		userRequest:       userRequest,
 		suggestions:       suggestions,
@@ -79,15 +100,37 @@ func NewCLITUIModel(userRequest string, suggestions []ai.CommandSuggestion, memo
 		service:           service,
 		selectedIndex:     0,
 		input:             input,
+		confirmInput:      textinput.New(),
 		// Initialize path completion state
 		completionCandidates: []string{},
 		completionIndex:      0,
 		completionContext:    nil,
 		inCompletionMode:     false,
 		// Initialize execution state
-		executor:        executor.New(),
+		executor:        cmdExecutor,
 		executionOutput: []string{},
 	}
+	model.rank()
+	return model
+}
+
+// rank orders the memory and AI suggestions into one list, safe commands
+// first and those of the same category together
+func (m *CLITUIModel) rank() {
+	m.ranked = ai.RankSuggestions(m.suggestions, m.memorySuggestions, ai.RankOptions{PreferSafe: true}).GroupByCategory()
+}
+
+// ExitCode returns the exit code clia should terminate with after the TUI quits
+func (m CLITUIModel) ExitCode() int {
+	if m.commandResult == nil {
+		return exitCodeCancelled
+	}
+
+	if m.commandResult.ExitCode < 0 {
+		return exitCodeNotExecutable
+	}
+
+	return m.commandResult.ExitCode
 }
 
 // Init initializes the CLI TUI model
@@ -109,6 +152,10 @@ func (m CLITUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.ready = true
 
 	case tea.KeyMsg:
+		if msg.Paste {
+			return m.handlePaste(msg)
+		}
+
 		switch m.state {
 		case StateSelecting:
 			return m.updateSelecting(msg)
@@ -116,12 +163,17 @@ func (m CLITUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateEditing(msg)
 		case StateCompleting:
 			return m.updateCompleting(msg)
+		case StateConfirming:
+			return m.updateConfirming(msg)
 		case StateExecuting:
 			return m.updateExecuting(msg)
 		case StateCompleted:
 			return m.updateCompleted(msg)
 		}
 
+	case tui.EditorFinishedMsg:
+		return m.handleEditorFinished(msg)
+
 	case commandCompleteMsg:
 		m.executing = false
 		m.commandResult = &msg.result
@@ -132,9 +184,16 @@ func (m CLITUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.aiProcessing = false
 		m.aiProcessed = true
 
-		// Add AI suggestions to existing suggestions
+		// Add AI suggestions to existing suggestions and rank them all again
 		if msg.error == nil && len(msg.suggestions) > 0 {
 			m.suggestions = append(m.suggestions, msg.suggestions...)
+			m.rank()
+		}
+
+		// A truncated response can be fixed by the user, so say how
+		var aiErr *ai.AIError
+		if errors.As(msg.error, &aiErr) && aiErr.Type == ai.ErrorTypeTruncated {
+			m.aiNotice = "⚠️  " + aiErr.Error()
 		}
 		return m, nil
 	}
@@ -144,7 +203,7 @@ func (m CLITUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 // updateSelecting handles updates in selection state
 func (m CLITUIModel) updateSelecting(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	totalSuggestions := len(m.memorySuggestions) + len(m.suggestions)
+	totalSuggestions := len(m.ranked)
 
 	switch msg.String() {
 	case "up", "k":
@@ -157,29 +216,18 @@ func (m CLITUIModel) updateSelecting(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 	case "enter":
 		// Move to editing state with selected command
-		if totalSuggestions > 0 {
-			var selectedCommand string
-
-			// Determine if it's a memory suggestion or AI suggestion
-			if m.selectedIndex < len(m.memorySuggestions) {
-				// Memory suggestion
-				memResult := m.memorySuggestions[m.selectedIndex]
-				selectedCommand = memResult.Entry.SelectedCommand
-			} else {
-				// AI suggestion
-				aiIndex := m.selectedIndex - len(m.memorySuggestions)
-				if aiIndex < len(m.suggestions) {
-					aiSuggestion := m.suggestions[aiIndex]
-					selectedCommand = aiSuggestion.Command
-				}
-			}
-
-			if selectedCommand != "" {
-				m.editingCommand = selectedCommand
-				m.input.SetValue(selectedCommand)
-				m.input.Focus()
-				m.state = StateEditing
-			}
+		if selectedCommand := m.selectedCommand(); selectedCommand != "" {
+			m.recordAccepted()
+			m.copyOnSelect(selectedCommand)
+			m.startEditing(selectedCommand)
+		}
+	case "ctrl+o":
+		// Edit the selected command in $EDITOR
+		if selectedCommand := m.selectedCommand(); selectedCommand != "" {
+			m.recordAccepted()
+			m.copyOnSelect(selectedCommand)
+			m.startEditing(selectedCommand)
+			return m, tui.OpenInEditorCmd(selectedCommand)
 		}
 	case "esc", "ctrl+c":
 		return m, tea.Quit
@@ -187,21 +235,68 @@ func (m CLITUIModel) updateSelecting(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// selectedCommand returns the command of the highlighted memory or AI suggestion
+func (m CLITUIModel) selectedCommand() string {
+	if m.selectedIndex >= 0 && m.selectedIndex < len(m.ranked) {
+		return m.ranked[m.selectedIndex].Command
+	}
+	return ""
+}
+
+// recordAccepted counts the choice of the highlighted suggestion if it comes from memory
+func (m CLITUIModel) recordAccepted() {
+	if m.selectedIndex < len(m.ranked) && m.ranked[m.selectedIndex].Memory != nil {
+		m.service.recordAccepted(m.ranked[m.selectedIndex].Memory.Entry.ID)
+	}
+}
+
+// copyOnSelect copies the selected command to the clipboard if copy_on_select
+// is set in the config; the TUI draws on stderr, so the OSC 52 sequence goes there
+func (m *CLITUIModel) copyOnSelect(command string) {
+	if m.service.configManager == nil || !m.service.configManager.GetConfig().Behavior.CopyOnSelect {
+		return
+	}
+
+	if err := tui.CopyToClipboard(command, os.Stderr); err != nil {
+		m.copyNotice = fmt.Sprintf("⚠️  Could not copy the command: %v", err)
+		return
+	}
+	m.copyNotice = "📋 Copied to the clipboard"
+}
+
+// startEditing moves to editing state with the given command
+func (m *CLITUIModel) startEditing(command string) {
+	m.editingCommand = command
+	m.input.SetValue(command)
+	m.input.Focus()
+	m.state = StateEditing
+}
+
+// handleEditorFinished executes the command read back from $EDITOR, or keeps
+// editing inline if the editor failed or the file was emptied
+func (m CLITUIModel) handleEditorFinished(msg tui.EditorFinishedMsg) (tea.Model, tea.Cmd) {
+	if m.state != StateEditing || msg.Err != nil || msg.Command == "" {
+		return m, nil
+	}
+
+	m.input.SetValue(msg.Command)
+	return m.confirmOrExecute(msg.Command)
+}
+
 // updateEditing handles updates in editing state
 func (m CLITUIModel) updateEditing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter":
 		// Execute the edited command
-		command := m.input.Value()
-		if command != "" {
-			m.state = StateExecuting
-			m.executing = true
-			m.executionOutput = []string{}
-			return m, m.executeCommand(command)
+		if command := m.input.Value(); command != "" {
+			return m.confirmOrExecute(command)
 		}
 	case "tab":
 		// Trigger path completion
 		return m.handleTabCompletion()
+	case "ctrl+o":
+		// Continue editing in $EDITOR
+		return m, tui.OpenInEditorCmd(m.input.Value())
 	case "esc":
 		// Go back to selection
 		m.state = StateSelecting
@@ -217,6 +312,110 @@ func (m CLITUIModel) updateEditing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// confirmOrExecute runs command, or first asks to confirm it with the checks
+// of CLIService.executeCommand: dangerous commands, suggestions the AI marked
+// unsafe and, with behavior.confirm_all, every command
+func (m CLITUIModel) confirmOrExecute(command string) (tea.Model, tea.Cmd) {
+	// The checks look at what runs if the command is a session alias
+	resolved := m.executor.Resolve(command)
+	danger := m.executor.ExplainDanger(resolved)
+	isDangerous := danger.Level != utils.DangerNone
+	unsafe := m.selectedIndex < len(m.ranked) && !m.ranked[m.selectedIndex].Safe
+	confirmAll := m.service.configManager != nil && m.service.configManager.GetConfig().Behavior.ConfirmAll
+
+	if !isDangerous && !unsafe && !confirmAll {
+		return m.startExecuting(command)
+	}
+
+	var details []string
+	if isDangerous || unsafe {
+		details = append(details, "⚠️  SAFETY WARNING: This command may be dangerous")
+	} else {
+		details = append(details, "🛡️  Paranoid mode: confirm before running")
+	}
+	if resolved != command {
+		details = append(details, fmt.Sprintf("🔍 Command: %s (alias %s)", resolved, executor.CommandProgram(command)))
+	} else {
+		details = append(details, "🔍 Command: "+command)
+	}
+	if isDangerous {
+		details = append(details, "🚩 Reason: "+danger.String())
+	}
+
+	// A single key is too easy to fumble for irreversible commands
+	m.requiredConfirmation = ""
+	if danger.Level == utils.DangerCritical {
+		details = append(details, "🛑 CRITICAL: This command can irreversibly destroy data or the system")
+		m.requiredConfirmation = criticalConfirmationPhrase
+		m.confirmInput.SetValue("")
+		m.confirmInput.Placeholder = criticalConfirmationPhrase
+		m.confirmInput.Focus()
+	}
+
+	m.pendingCommand = command
+	m.confirmDetails = details
+	m.input.Blur()
+	m.state = StateConfirming
+	return m, nil
+}
+
+// startExecuting moves to executing state and runs command
+func (m CLITUIModel) startExecuting(command string) (tea.Model, tea.Cmd) {
+	m.state = StateExecuting
+	m.executing = true
+	m.executionOutput = []string{}
+	return m, m.executeCommand(command)
+}
+
+// updateConfirming handles updates in confirmation state
+func (m CLITUIModel) updateConfirming(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.requiredConfirmation != "" {
+		return m.updateTypedConfirmation(msg)
+	}
+
+	switch msg.String() {
+	case "y", "Y":
+		return m.startExecuting(m.pendingCommand)
+	case "n", "N", "esc":
+		m.cancelConfirmation()
+	case "ctrl+c":
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// updateTypedConfirmation handles the confirmation of a critical command,
+// which only runs once the phrase is typed out
+func (m CLITUIModel) updateTypedConfirmation(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		if strings.TrimSpace(strings.ToLower(m.confirmInput.Value())) == m.requiredConfirmation {
+			m.confirmInput.Blur()
+			return m.startExecuting(m.pendingCommand)
+		}
+		m.cancelConfirmation()
+	case "esc":
+		m.cancelConfirmation()
+	case "ctrl+c":
+		return m, tea.Quit
+	default:
+		var cmd tea.Cmd
+		m.confirmInput, cmd = m.confirmInput.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// cancelConfirmation goes back to editing the pending command
+func (m *CLITUIModel) cancelConfirmation() {
+	m.pendingCommand = ""
+	m.confirmDetails = nil
+	m.requiredConfirmation = ""
+	m.confirmInput.Blur()
+	m.input.Focus()
+	m.state = StateEditing
+}
+
 // updateExecuting handles updates in executing state
 func (m CLITUIModel) updateExecuting(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
@@ -235,6 +434,19 @@ func (m CLITUIModel) updateCompleted(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 // executeCommand executes a command and returns the result
 func (m CLITUIModel) executeCommand(command string) tea.Cmd {
+	// sudo password prompts and TUI programs need the real terminal
+	if executor.NewPTYExecutor().NeedsPTY(command) {
+		return m.executeAttached(command)
+	}
+
+	// Commands reading standard input get it typed straight into the terminal
+	if executor.ReadsStdin(command) {
+		return tea.Sequence(
+			tea.Println("📥 This command reads standard input; type it and press Ctrl+D to end"),
+			m.executeAttached(command),
+		)
+	}
+
 	return tea.Cmd(func() tea.Msg {
 		ctx := context.Background()
 		result, err := m.executor.Execute(ctx, command)
@@ -247,8 +459,52 @@ func (m CLITUIModel) executeCommand(command string) tea.Cmd {
 	})
 }
 
+// executeAttached suspends the TUI and runs a command attached to the terminal,
+// so prompts such as sudo's password prompt are handled by the program itself
+func (m CLITUIModel) executeAttached(command string) tea.Cmd {
+	run := &attachedRun{executor: m.executor, command: command}
+	return tea.Exec(run, func(err error) tea.Msg {
+		// The command never ran if the terminal could not be released
+		if run.result == nil {
+			run.result = &executor.ExecutionResult{Command: command, ExitCode: -1, Error: err}
+		}
+		return commandCompleteMsg{
+			command: command,
+			result:  *run.result,
+			error:   err,
+		}
+	})
+}
+
+// attachedRun is a command run with Executor.RunAttached once the TUI has
+// released the terminal, so it is recorded in the history and run logs
+type attachedRun struct {
+	executor *executor.Executor
+	command  string
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+	result   *executor.ExecutionResult
+}
+
+// Run runs the command on the terminal streams set by the TUI
+func (r *attachedRun) Run() error {
+	var err error
+	r.result, err = r.executor.RunAttached(context.Background(), r.command, r.stdin, r.stdout, r.stderr)
+	return err
+}
+
+func (r *attachedRun) SetStdin(stdin io.Reader)   { r.stdin = stdin }
+func (r *attachedRun) SetStdout(stdout io.Writer) { r.stdout = stdout }
+func (r *attachedRun) SetStderr(stderr io.Writer) { r.stderr = stderr }
+
 // View renders the CLI-style interface
 func (m CLITUIModel) View() string {
+	return tui.TerminalCaps().Text(m.viewState())
+}
+
+// viewState renders the view of the current state
+func (m CLITUIModel) viewState() string {
 	switch m.state {
 	case StateSelecting:
 		return m.viewSelecting()
@@ -256,6 +512,8 @@ func (m CLITUIModel) View() string {
 		return m.viewEditing()
 	case StateCompleting:
 		return m.viewCompleting()
+	case StateConfirming:
+		return m.viewConfirming()
 	case StateExecuting:
 		return m.viewExecuting()
 	case StateCompleted:
@@ -270,51 +528,49 @@ func (m CLITUIModel) viewSelecting() string {
 	header := fmt.Sprintf("🤖 Processing: %s\n\nSelect a command:\n\n", m.userRequest)
 
 	var choices strings.Builder
-	currentIndex := 0
 
-	// Show memory suggestions first with M prefix
-	for i, memResult := range m.memorySuggestions {
-		checkbox := "[ ]"
-		if currentIndex == m.selectedIndex {
-			checkbox = "[●]"
-		}
+	// Narrow terminals get one line per choice, describing only the selected one
+	compact := tui.UseCompactSuggestions(m.width, m.service.compactSuggestions())
 
-		// Safety indicator based on previous success
-		safetyIcon := "✅"
-		if !memResult.Entry.Success {
-			safetyIcon = "⚠️"
+	// Memory suggestions are numbered with an M prefix and AI ones with an A
+	// prefix, under category headers if they differ
+	grouped := m.ranked.MixedCategories()
+	memoryCount, aiCount := 0, 0
+	for i, item := range m.ranked {
+		if grouped && (i == 0 || ai.CategoryKey(item.Category) != ai.CategoryKey(m.ranked[i-1].Category)) {
+			choices.WriteString(subtleStyle.Render(tui.FormatCategory(item.Category)) + "\n")
 		}
 
-		// Convert memory score to percentage
-		confidencePercent := int(memResult.Score * 100)
-		choice := fmt.Sprintf("%s M%d. %s %s (%d%%)\n      %s\n",
-			checkbox, i+1, safetyIcon, memResult.Entry.SelectedCommand, confidencePercent,
-			subtleStyle.Render(memResult.Entry.Description))
-
-		choices.WriteString(choice)
-		currentIndex++
-	}
-
-	// Show AI suggestions with A prefix
-	for i, suggestion := range m.suggestions {
 		checkbox := "[ ]"
-		if currentIndex == m.selectedIndex {
+		if i == m.selectedIndex {
 			checkbox = "[●]"
 		}
 
-		// Safety indicator
+		// Safety indicator; memory entries are safe if they succeeded before
 		safetyIcon := "✅"
-		if !suggestion.Safe {
+		if !item.Safe {
 			safetyIcon = "⚠️"
 		}
 
-		confidencePercent := int(suggestion.Confidence * 100)
-		choice := fmt.Sprintf("%s A%d. %s %s (%d%%)\n      %s\n",
-			checkbox, i+1, safetyIcon, suggestion.Command, confidencePercent,
-			subtleStyle.Render(suggestion.Description))
+		// Memory scores are shown like AI confidence
+		var label string
+		if item.Source == ai.SourceMemory {
+			memoryCount++
+			label = fmt.Sprintf("M%d", memoryCount)
+		} else {
+			aiCount++
+			label = fmt.Sprintf("A%d", aiCount)
+		}
+
+		choice := fmt.Sprintf("%s %s. %s %s (%s)\n      %s\n",
+			checkbox, label, safetyIcon, item.Command, tui.FormatConfidence(item.Confidence),
+			subtleStyle.Render(item.Description))
+		if compact {
+			choice = m.compactChoice(fmt.Sprintf("%s %s. %s ", checkbox, label, safetyIcon),
+				item.Command, item.Description, i == m.selectedIndex)
+		}
 
 		choices.WriteString(choice)
-		currentIndex++
 	}
 
 	// Show AI processing status
@@ -323,28 +579,67 @@ func (m CLITUIModel) viewSelecting() string {
 		statusLine = subtleStyle.Render("🤖 AI analyzing... Please wait for more suggestions.") + "\n\n"
 	} else if !m.aiProcessed && m.service.hasAIProvider() {
 		statusLine = subtleStyle.Render("🤖 AI will provide additional suggestions shortly.") + "\n\n"
+	} else if m.aiNotice != "" {
+		statusLine = m.aiNotice + "\n\n"
 	}
 
 	footer := "\n" + statusLine + subtleStyle.Render("↑/↓, j/k: select") + dotStyle +
 		subtleStyle.Render("enter: edit command") + dotStyle +
+		subtleStyle.Render("ctrl+o: $EDITOR") + dotStyle +
 		subtleStyle.Render("esc: quit") + "\n"
 
 	return header + choices.String() + footer
 }
 
+// compactChoice renders a choice on a single line, adding the description
+// below it when the choice is selected
+func (m CLITUIModel) compactChoice(prefix, command, description string, selected bool) string {
+	commandWidth := 0
+	if m.width > 0 {
+		commandWidth = max(m.width-lipgloss.Width(prefix), 10)
+	}
+
+	choice := prefix + tui.FitCommand(command, commandWidth) + "\n"
+	if selected && description != "" {
+		choice += "      " + subtleStyle.Render(description) + "\n"
+	}
+	return choice
+}
+
 // viewEditing renders the CLI-style command editing interface
 func (m CLITUIModel) viewEditing() string {
 	header := "✏️  Edit command (press Enter to execute, Tab for path completion):\n\n"
+	if m.copyNotice != "" {
+		header = subtleStyle.Render(m.copyNotice) + "\n" + header
+	}
 
 	inputLine := fmt.Sprintf("$ %s", m.input.View())
 
 	footer := "\n" + subtleStyle.Render("enter: execute") + dotStyle +
 		subtleStyle.Render("tab: complete") + dotStyle +
+		subtleStyle.Render("ctrl+o: $EDITOR") + dotStyle +
 		subtleStyle.Render("esc: back") + "\n"
 
 	return header + inputLine + footer
 }
 
+// viewConfirming renders why the command needs confirmation and asks for it
+func (m CLITUIModel) viewConfirming() string {
+	details := strings.Join(m.confirmDetails, "\n") + "\n\n"
+	if m.requiredConfirmation != "" {
+		prompt := fmt.Sprintf("⌨️  Type '%s' to proceed:\n%s\n", m.requiredConfirmation, m.confirmInput.View())
+		footer := "\n" + subtleStyle.Render("enter: confirm") + dotStyle +
+			subtleStyle.Render("esc: back to editing") + "\n"
+		return details + prompt + footer
+	}
+	prompt := "❓ Do you want to proceed? (y/N)\n"
+
+	footer := "\n" + subtleStyle.Render("y: execute") + dotStyle +
+		subtleStyle.Render("n, esc: back to editing") + "\n"
+
+	return details + prompt + footer
+}
+
 // viewExecuting renders the CLI-style command execution interface
 func (m CLITUIModel) viewExecuting() string {
 	return "🚀 Executing command...\n"
@@ -419,6 +714,19 @@ func (m CLITUIModel) updateCompleting(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	}
 }
 
+// handlePaste inserts pasted text while editing and ignores it elsewhere,
+// so pasted newlines or digits never submit or select a command
+func (m CLITUIModel) handlePaste(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch m.state {
+	case StateCompleting:
+		m.exitCompletionMode()
+		tui.InsertPastedText(&m.input, string(msg.Runes))
+	case StateEditing:
+		tui.InsertPastedText(&m.input, string(msg.Runes))
+	}
+	return m, nil
+}
+
 // handleTabCompletion triggers path completion
 func (m CLITUIModel) handleTabCompletion() (CLITUIModel, tea.Cmd) {
 	command := m.input.Value()
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cliCommand describes a clia subcommand for help and shell completion
+type cliCommand struct {
+	Name        string
+	Description string
+	Subcommands []string
+	Flags       []cliFlag
+}
+
+// cliFlag describes a command line flag for shell completion
+type cliFlag struct {
+	Name        string // Long name without dashes
+	Short       string // Optional one-letter name
+	Description string
+	Values      []string // Fixed values; nil means a free-form value if TakesValue
+	TakesValue  bool
+}
+
+// formatFlag is the output format flag of the memory subcommands
+var formatFlag = cliFlag{
+	Name:        "format",
+	Description: "Output format",
+	Values:      []string{"table", "plain", "json"},
+	TakesValue:  true,
+}
+
+// cliCommands lists the clia subcommands
+var cliCommands = []cliCommand{
+	{Name: "setup", Description: "Choose an AI provider and store its API key"},
+	{Name: "ask", Description: "Answer a question in plain text instead of suggesting commands",
+		Flags: []cliFlag{
+			{Name: "buffered", Description: "Print the answer once complete"},
+			{Name: "stream", Description: "Print the answer as it streams in"},
+		}},
+	{Name: "memory", Description: "List, export, delete or pin remembered commands",
+		Subcommands: []string{"list", "export", "delete", "pin", "unpin"}, Flags: []cliFlag{formatFlag}},
+	{Name: "config", Description: "Upgrade the config file to the current layout",
+		Subcommands: []string{"migrate"}},
+	{Name: "serve", Description: "Serve suggestions and explanations as a local JSON API",
+		Flags: []cliFlag{
+			{Name: "addr", Description: "Address to listen on", TakesValue: true},
+			{Name: "token", Description: "Token required as a bearer token", TakesValue: true},
+		}},
+	{Name: "cache", Description: "Show or clean up cached AI suggestions",
+		Subcommands: []string{"info", "prune", "clear"}},
+	{Name: "completion", Description: "Generate a shell completion script",
+		Subcommands: completionShells},
+	{Name: "version", Description: "Show version information"},
+	{Name: "help", Description: "Show the help message"},
+}
+
+// cliFlags lists the flags accepted before a request
+var cliFlags = []cliFlag{
+	{Name: "model", Short: "m", Description: "Use a specific model or alias", TakesValue: true},
+	{Name: "offline", Description: "Use rule-based suggestions only"},
+	{Name: "no-memory", Description: "Don't read from or save to memory"},
+	{Name: "quiet", Description: "Hide informational messages"},
+	{Name: "auto", Description: "Run a command remembered for the request without asking"},
+	{Name: "capture", Description: "Print the screen a program draws"},
+	{Name: "diff", Description: "With --capture, show what changed on the screen"},
+	{Name: "interval", Description: "With --capture, how long to wait for a frame", TakesValue: true},
+	{Name: "input-file", Description: "Analyze a file instead of piped input", TakesValue: true},
+	{Name: "help", Short: "h", Description: "Show the help message"},
+}
+
+// completionShells lists the shells completion scripts can be generated for
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// runCompletionCommand handles `clia completion <shell>`
+func runCompletionCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: clia completion <%s>", strings.Join(completionShells, "|"))
+	}
+
+	script, err := completionScript(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// completionScript returns the completion script for shell
+func completionScript(shell string) (string, error) {
+	switch strings.ToLower(shell) {
+	case "bash":
+		return bashCompletion(), nil
+	case "zsh":
+		return zshCompletion(), nil
+	case "fish":
+		return fishCompletion(), nil
+	default:
+		return "", fmt.Errorf("unsupported shell: %s (expected %s)", shell, strings.Join(completionShells, ", "))
+	}
+}
+
+// flagWords returns the flags as they are typed on the command line
+func flagWords(flags []cliFlag) []string {
+	var words []string
+	for _, flag := range flags {
+		words = append(words, "--"+flag.Name)
+		if flag.Short != "" {
+			words = append(words, "-"+flag.Short)
+		}
+	}
+	return words
+}
+
+// bashCompletion returns the bash completion script
+func bashCompletion() string {
+	var commandNames []string
+	for _, command := range cliCommands {
+		commandNames = append(commandNames, command.Name)
+	}
+
+	var b strings.Builder
+	b.WriteString("# bash completion for clia\n")
+	b.WriteString("# Load with: source <(clia completion bash)\n")
+	b.WriteString("_clia() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("    local prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n\n")
+
+	// Flag values
+	b.WriteString("    case \"$prev\" in\n")
+	for _, flag := range append(append([]cliFlag{}, cliFlags...), formatFlag) {
+		if !flag.TakesValue {
+			continue
+		}
+		fmt.Fprintf(&b, "        %s)\n", strings.Join(flagWords([]cliFlag{flag}), "|"))
+		if len(flag.Values) > 0 {
+			fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(flag.Values, " "))
+		}
+		b.WriteString("            return 0 ;;\n")
+	}
+	b.WriteString("    esac\n\n")
+
+	// Subcommands and flags in the first position
+	b.WriteString("    if [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n",
+		strings.Join(append(commandNames, flagWords(cliFlags)...), " "))
+	b.WriteString("        return 0\n")
+	b.WriteString("    fi\n\n")
+
+	// Arguments of subcommands
+	b.WriteString("    case \"${COMP_WORDS[1]}\" in\n")
+	for _, command := range cliCommands {
+		words := append(append([]string{}, command.Subcommands...), flagWords(command.Flags)...)
+		if len(words) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "        %s)\n", command.Name)
+		fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", strings.Join(words, " "))
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("complete -F _clia clia\n")
+	return b.String()
+}
+
+// zshCompletion returns the zsh completion script
+func zshCompletion() string {
+	var b strings.Builder
+	b.WriteString("#compdef clia\n")
+	b.WriteString("# Load with: source <(clia completion zsh)\n\n")
+	b.WriteString("_clia() {\n")
+
+	// Flag values
+	b.WriteString("    case \"${words[CURRENT-1]}\" in\n")
+	for _, flag := range append(append([]cliFlag{}, cliFlags...), formatFlag) {
+		if !flag.TakesValue {
+			continue
+		}
+		fmt.Fprintf(&b, "        %s)\n", strings.Join(flagWords([]cliFlag{flag}), "|"))
+		if len(flag.Values) > 0 {
+			fmt.Fprintf(&b, "            compadd -- %s\n", strings.Join(flag.Values, " "))
+		}
+		b.WriteString("            return ;;\n")
+	}
+	b.WriteString("    esac\n\n")
+
+	b.WriteString("    if (( CURRENT == 2 )); then\n")
+	b.WriteString("        local -a commands flags\n")
+	b.WriteString("        commands=(\n")
+	for _, command := range cliCommands {
+		fmt.Fprintf(&b, "            %s\n", zshQuote(command.Name+":"+command.Description))
+	}
+	b.WriteString("        )\n")
+	b.WriteString("        flags=(\n")
+	for _, flag := range cliFlags {
+		for _, word := range flagWords([]cliFlag{flag}) {
+			fmt.Fprintf(&b, "            %s\n", zshQuote(word+":"+flag.Description))
+		}
+	}
+	b.WriteString("        )\n")
+	b.WriteString("        _describe -t commands 'clia command' commands -- flags\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n\n")
+
+	b.WriteString("    case \"${words[2]}\" in\n")
+	for _, command := range cliCommands {
+		words := append(append([]string{}, command.Subcommands...), flagWords(command.Flags)...)
+		if len(words) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "        %s)\n", command.Name)
+		fmt.Fprintf(&b, "            compadd -- %s ;;\n", strings.Join(words, " "))
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("compdef _clia clia\n")
+	return b.String()
+}
+
+// fishCompletion returns the fish completion script
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString("# fish completion for clia\n")
+	b.WriteString("# Load with: clia completion fish | source\n")
+	b.WriteString("complete -c clia -f\n\n")
+
+	for _, command := range cliCommands {
+		fmt.Fprintf(&b, "complete -c clia -n '__fish_use_subcommand' -a %s -d %s\n",
+			command.Name, fishQuote(command.Description))
+	}
+	b.WriteString("\n")
+
+	for _, flag := range cliFlags {
+		b.WriteString(fishFlag(flag, "__fish_use_subcommand"))
+	}
+	b.WriteString("\n")
+
+	for _, command := range cliCommands {
+		condition := "__fish_seen_subcommand_from " + command.Name
+		if len(command.Subcommands) > 0 {
+			fmt.Fprintf(&b, "complete -c clia -n '%s; and not __fish_seen_subcommand_from %s' -a %s\n",
+				condition, strings.Join(command.Subcommands, " "), fishQuote(strings.Join(command.Subcommands, " ")))
+		}
+		for _, flag := range command.Flags {
+			b.WriteString(fishFlag(flag, condition))
+		}
+	}
+	return b.String()
+}
+
+// fishFlag returns the fish completion line of flag, active when condition holds
+func fishFlag(flag cliFlag, condition string) string {
+	line := fmt.Sprintf("complete -c clia -n '%s' -l %s", condition, flag.Name)
+	if flag.Short != "" {
+		line += " -s " + flag.Short
+	}
+	if flag.TakesValue {
+		line += " -r"
+	}
+	if len(flag.Values) > 0 {
+		line += " -a " + fishQuote(strings.Join(flag.Values, " "))
+	}
+	return line + " -d " + fishQuote(flag.Description) + "\n"
+}
+
+// zshQuote quotes s as a single-quoted zsh word
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote quotes s as a single-quoted fish word
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yourusername/clia/internal/config"
+)
+
+// runConfigCommand handles the `clia config` subcommands
+func runConfigCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: clia config migrate")
+	}
+
+	switch subcommand := strings.ToLower(args[0]); subcommand {
+	case "migrate":
+		configManager, err := config.NewManager()
+		if err != nil {
+			return fmt.Errorf("failed to initialize config manager: %w", err)
+		}
+		return migrateConfigFile(configManager)
+
+	default:
+		return fmt.Errorf("unknown config command: %s (expected migrate)", subcommand)
+	}
+}
+
+// migrateConfigFile upgrades the config file of configManager to the current
+// layout and reports what changed
+func migrateConfigFile(configManager *config.Manager) error {
+	path := configManager.GetConfigPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Printf("📄 No config file at %s, nothing to migrate\n", path)
+		return nil
+	}
+
+	if err := configManager.Load(); err != nil {
+		return err
+	}
+
+	migration, err := configManager.Migrate()
+	if err != nil {
+		return fmt.Errorf("failed to write the upgraded config file: %w", err)
+	}
+	if migration == nil {
+		if version := configManager.FileVersion(); version > config.CurrentConfigVersion {
+			fmt.Printf("⚠️  %s is version %d, newer than this clia supports (%d). Update clia to use all its settings\n",
+				path, version, config.CurrentConfigVersion)
+			return nil
+		}
+		fmt.Printf("✅ %s is up to date (version %d)\n", path, config.CurrentConfigVersion)
+		return nil
+	}
+
+	fmt.Printf("✅ Migrated %s from version %d to %d\n", path, migration.From, migration.To)
+	for _, change := range migration.Changes {
+		fmt.Printf("  • %s\n", change)
+	}
+	fmt.Printf("💾 Backup of the old file: %s\n", migration.BackupPath)
+	return nil
+}
@@ -4,70 +4,264 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/yourusername/clia/internal/ai"
 	"github.com/yourusername/clia/internal/tui"
 	"github.com/yourusername/clia/internal/version"
 )
 
+// Exit codes used by clia itself. In one-shot mode clia otherwise exits with
+// the exit code of the command it executed, so these are chosen to avoid
+// clashing with the codes ordinary commands return.
+const (
+	exitCodeSuccess       = 0   // clia finished without executing a command
+	exitCodeError         = 125 // clia itself failed, or no command could be suggested
+	exitCodeNotExecutable = 126 // the selected command could not be started
+	exitCodeCancelled     = 130 // the user quit without executing a command
+)
+
 func main() {
+	// Flags are only read before the request, which keeps its own options.
+	// --output only belongs to analysis; otherwise it is part of the request,
+	// e.g. clia save page with curl --output page.html
+	piped := hasStdinData()
+	flags, args, err := parseCLIFlags(os.Args[1:], true)
+	if flags.value("--input-file") == "" && !piped {
+		flags, args, err = parseCLIFlags(os.Args[1:], false)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitCodeError)
+	}
+
+	// A file given with --input-file is analyzed like piped input
+	inputFile := flags.value("--input-file")
+	// Analysis results are shown in a TUI unless --output raw or json prints them
+	output, err := validAnalysisOutput(flags.value("--output"))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitCodeError)
+	}
+	if inputFile != "" {
+		inputData, err := readInputFile(inputFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(exitCodeError)
+		}
+		if len(args) == 0 {
+			fmt.Println("Error: Analysis command required with --input-file")
+			fmt.Println("Example: clia --input-file data.csv make table")
+			os.Exit(exitCodeError)
+		}
+		if err := runAnalysisMode(inputData, strings.Join(args, " "), output); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(exitCodeError)
+		}
+		return
+	}
+
 	// Check for piped input first
-	if hasStdinData() {
+	if piped {
 		stdinData, err := readStdinData()
 		if err != nil {
 			fmt.Printf("Error reading stdin: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitCodeError)
 		}
 
 		// Check if we have analysis commands
-		if len(os.Args) > 1 {
-			analysisCommand := strings.Join(os.Args[1:], " ")
-			if err := runAnalysisMode(stdinData, analysisCommand); err != nil {
+		if len(args) > 0 {
+			analysisCommand := strings.Join(args, " ")
+			if err := runAnalysisMode(stdinData, analysisCommand, output); err != nil {
 				fmt.Printf("Error: %v\n", err)
-				os.Exit(1)
+				os.Exit(exitCodeError)
 			}
 			return
 		} else {
 			fmt.Println("Error: Analysis command required when using piped input")
 			fmt.Println("Example: cat data.csv | clia make table")
-			os.Exit(1)
+			os.Exit(exitCodeError)
 		}
 	}
 
 	// Handle command line arguments
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	offline := flags.isSet("--offline")
+	noMemory := flags.isSet("--no-memory")
+	quiet := flags.isSet("--quiet")
+	auto := flags.isSet("--auto")
+	capture := flags.isSet("--capture")
+	modelName := flags.value("--model")
+	maxCost, err := parseMaxCost(flags.value("--max-cost"))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitCodeError)
+	}
+	if capture {
+		if err := runCaptureCommand(args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(exitCodeError)
+		}
+		return
+	}
+	if len(args) > 0 {
+		switch args[0] {
 		case "version":
 			fmt.Printf("clia version %s (built with %s)\n", version.Version, version.GoVersion)
 			return
 		case "help", "-h", "--help":
 			printHelp()
 			return
+		case "setup":
+			if err := runSetupCommand(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitCodeError)
+			}
+			return
+		case "cache":
+			if err := runCacheCommand(args[1:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitCodeError)
+			}
+			return
+		case "completion":
+			if err := runCompletionCommand(args[1:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitCodeError)
+			}
+			return
+		case "ask":
+			if err := runAskCommand(args[1:], modelName, offline, maxCost); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitCodeError)
+			}
+			return
+		case "config":
+			if err := runConfigCommand(args[1:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitCodeError)
+			}
+			return
+		case "memory":
+			if err := runMemoryCommand(args[1:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitCodeError)
+			}
+			return
+		case "serve":
+			if err := runServeCommand(args[1:], offline, maxCost); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(exitCodeError)
+			}
+			return
 		default:
 			// If we have arguments that aren't special commands, run in CLI mode
-			userRequest := strings.Join(os.Args[1:], " ")
-			if err := runCLIMode(userRequest); err != nil {
+			userRequest := strings.Join(args, " ")
+			exitCode, err := runCLIMode(userRequest, modelName, offline, noMemory, quiet, auto, maxCost)
+			if err != nil {
 				fmt.Printf("Error: %v\n", err)
-				os.Exit(1)
+				os.Exit(exitCodeError)
 			}
-			return
+			os.Exit(exitCode)
 		}
 	}
 
 	// Start TUI application
 	model := tui.New()
+	model.SetOffline(offline)
+	model.SetMemoryPaused(noMemory)
+	model.SetQuiet(quiet)
+	if maxCost >= 0 {
+		model.SetMaxCost(maxCost)
+	}
 	program := tea.NewProgram(
 		model,
 		tea.WithAltScreen(),       // Use alternative screen buffer
 		tea.WithMouseCellMotion(), // Enable mouse support
 	)
 
-	if _, err := program.Run(); err != nil {
+	_, err = program.Run()
+	model.Close()
+	if err != nil {
 		fmt.Printf("Error starting TUI: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCodeError)
+	}
+}
+
+// leadingFlags are the flags given before the arguments of a command
+type leadingFlags struct {
+	bools  map[string]bool
+	values map[string]string
+}
+
+// isSet reports whether the boolean flag was given
+func (f leadingFlags) isSet(flag string) bool {
+	return f.bools[flag]
+}
+
+// value returns the value of flag, or "" if it was not given
+func (f leadingFlags) value(flag string) string {
+	return f.values[flag]
+}
+
+// parseLeadingFlags reads the flags at the front of args: the boolean flags
+// in boolFlags and the flags in valueFlags, given as --flag value or
+// --flag=value. It stops at the first other word, or after --, and returns
+// the remaining arguments, so options within a request are left alone, e.g.
+// clia run rsync --quiet or clia git commit -m "fix typo".
+func parseLeadingFlags(args []string, boolFlags, valueFlags []string) (leadingFlags, []string, error) {
+	flags := leadingFlags{bools: map[string]bool{}, values: map[string]string{}}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return flags, args[i+1:], nil
+		}
+		if slices.Contains(boolFlags, arg) {
+			flags.bools[arg] = true
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !slices.Contains(valueFlags, name) {
+			return flags, args[i:], nil
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return flags, nil, fmt.Errorf("%s requires a value", name)
+			}
+			value = args[i+1]
+			i++
+		}
+		flags.values[name] = value
+	}
+
+	return flags, nil, nil
+}
+
+// parseCLIFlags reads the flags clia takes before a request or an analysis
+// command, --output only with analysis
+func parseCLIFlags(args []string, analysis bool) (leadingFlags, []string, error) {
+	valueFlags := []string{"--input-file", "--max-cost", "--model"}
+	if analysis {
+		valueFlags = append(valueFlags, "--output")
 	}
+	return parseLeadingFlags(args, []string{"--offline", "--no-memory", "--quiet", "--auto", "--capture"}, valueFlags)
+}
+
+// parseMaxCost returns the budget given with --max-cost <dollars>, "$" being
+// optional, or -1 if the flag is absent
+func parseMaxCost(value string) (float64, error) {
+	if value == "" {
+		return -1, nil
+	}
+	dollars, err := strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+	if err != nil || dollars < 0 {
+		return -1, fmt.Errorf("--max-cost requires an amount in dollars, e.g. --max-cost 0.50")
+	}
+	return dollars, nil
 }
 
 func printHelp() {
@@ -75,24 +269,101 @@ func printHelp() {
 	fmt.Println("USAGE:")
 	fmt.Println("  clia                    Start the interactive TUI interface")
 	fmt.Println("  clia <request>          Process request in CLI mode and exit")
+	fmt.Println("  clia --model <name> <request>")
+	fmt.Println("                          Use a specific model or alias (e.g. fast, smart)")
+	fmt.Println("  clia --offline [request]")
+	fmt.Println("                          Use rule-based suggestions only, without API calls")
+	fmt.Println("  clia --no-memory [request]")
+	fmt.Println("                          Don't read from or save to memory this session")
+	fmt.Println("  clia --quiet [request]")
+	fmt.Println("                          Hide the welcome banner, tips and status messages")
+	fmt.Println("  clia --max-cost <dollars>")
+	fmt.Println("                          Refuse paid AI requests once the session cost this much,")
+	fmt.Println("                          estimated from model prices (see api.max_cost in the config);")
+	fmt.Println("                          models without a known price are refused")
+	fmt.Println("  clia --auto <request>   Run the command remembered for a request you often repeat,")
+	fmt.Println("                          without asking the AI (see auto_run_min_uses in the config)")
+	fmt.Println("  clia --capture [--diff] [--interval 1s] <command>")
+	fmt.Println("                          Print the screen a program draws after the interval, or with")
+	fmt.Println("                          --diff what changed on it during a second interval")
+	fmt.Println("  clia setup              Choose an AI provider and store its API key")
+	fmt.Println("  clia ask [--buffered|--stream] <question>")
+	fmt.Println("                          Answer a question in plain text, without suggesting commands;")
+	fmt.Println("                          --buffered prints it once complete (see ui.answer_rendering)")
+	fmt.Println("  clia memory list [--format table|plain|json]")
+	fmt.Println("                          List remembered commands")
+	fmt.Println("  clia memory export <file> [--format table|plain|json]")
+	fmt.Println("                          Export remembered commands to a file")
+	fmt.Println("  clia memory delete <id>")
+	fmt.Println("                          Forget a remembered command (ID or ID prefix)")
+	fmt.Println("  clia memory pin|unpin <id>")
+	fmt.Println("                          Keep a remembered command from expiring (see memory.ttl)")
+	fmt.Println("  clia config migrate     Upgrade the config file to the current layout, keeping a backup")
+	fmt.Println("  clia serve [--addr host:port] [--token token]")
+	fmt.Println("                          Serve POST /suggest and POST /explain as a local JSON API for editors")
+	fmt.Println("  clia cache [info|prune|clear]")
+	fmt.Println("                          Show or clean up cached AI suggestions")
+	fmt.Println("  clia completion <bash|zsh|fish>")
+	fmt.Println("                          Print a shell completion script")
 	fmt.Println("  clia version            Show version information")
 	fmt.Println("  clia help               Show this help message")
+	fmt.Println("\nFlags are only read before the request; end them with -- if the request starts with one.")
 	fmt.Println("\nCLI MODE EXAMPLES:")
 	fmt.Println("  clia show disk space    Get AI suggestions for disk usage commands")
 	fmt.Println("  clia list large files   Find commands to list large files")
 	fmt.Println("  clia current directory  Show current directory commands")
+	fmt.Println("  clia ask what is the difference between tar -c and -x")
 	fmt.Println("\nINTERACTIVE MODE SHORTCUTS:")
 	fmt.Println("  Ctrl+C        Quit the application")
 	fmt.Println("  Ctrl+L        Clear message history")
 	fmt.Println("  Enter         Submit your input")
+	fmt.Println("  Ctrl+O        Open the selected or edited command in $EDITOR")
+	fmt.Println("  Ctrl+S        Summarize the output of the last command")
+	fmt.Println("  Ctrl+P        Switch provider and model from a list")
+	fmt.Println("  Ctrl+D        End the input typed for a command that reads stdin")
+	fmt.Println("  Tab, ↑/↓      Accept or choose a past request suggested while typing")
 	fmt.Println("  !<command>    Execute command directly (no safety checks)")
+	fmt.Println("  @<model> ...  Use another model for this request only (or end it with --model=<model>)")
+	fmt.Println("\nEXIT CODES (CLI MODE):")
+	fmt.Println("  <n>           Exit code of the executed command")
+	fmt.Println("  0             No command was executed")
+	fmt.Println("  125           clia failed or no command could be suggested")
+	fmt.Println("  126           The selected command could not be started")
+	fmt.Println("  130           Cancelled without executing a command")
 	fmt.Println("\nCONFIGURATION:")
-	fmt.Println("  Set OPENROUTER_API_KEY or OPENAI_API_KEY environment variable")
+	fmt.Println("  Run 'clia setup', or set OPENROUTER_API_KEY or OPENAI_API_KEY,")
 	fmt.Println("  to enable AI-powered command suggestions")
+	fmt.Println("  Set CLIA_<PROVIDER>_BASE_URL (e.g. CLIA_OPENAI_BASE_URL) to send requests")
+	fmt.Println("  through a proxy or self-hosted gateway")
+	fmt.Println("  Define request templates like \"deploy to {{env}}\" under 'templates:' in the")
+	fmt.Println("  config file; matching requests get the template's prompt")
+	fmt.Println("  Add site-specific danger patterns (pattern, severity, description) to")
+	fmt.Println("  danger_patterns.yaml in the config directory")
+	fmt.Println("  Set behavior.log_runs to keep the output of every executed command in the")
+	fmt.Println("  runs directory next to the config file")
+	fmt.Println("  Set logs.history to record every executed command in history.jsonl (or")
+	fmt.Println("  history.log with logs.history_format: text); the history and run logs roll")
+	fmt.Println("  over at logs.max_file_size_mb, keeping logs.max_files old files for")
+	fmt.Println("  logs.retention_days days")
+	fmt.Println("  Set ui.compact_suggestions to list one suggestion per line; terminals")
+	fmt.Println("  narrower than 80 columns use this layout automatically")
+	fmt.Println("  Set behavior.normalize_suggestions to false to keep suggestions that only")
+	fmt.Println("  differ in flag order or quoting, like 'ls -la' and 'ls -al'")
 	fmt.Println("\nANALYSIS MODE:")
 	fmt.Println("  cat data.csv | clia make table    Convert CSV to markdown table")
 	fmt.Println("  echo 'data' | clia analyze        Analyze input data")
 	fmt.Println("  tail -f log | clia summarize       Summarize log data")
+	fmt.Println("  cat data.csv | clia select 1,3,name")
+	fmt.Println("                                    Print only the given CSV columns (no AI)")
+	fmt.Println("  cat data.csv | clia make table --columns=name,size")
+	fmt.Println("                                    Select columns before analysis")
+	fmt.Println("  clia --input-file data.csv summarize")
+	fmt.Println("                                    Analyze a file instead of piped input")
+	fmt.Println("  cat data.csv | clia summarize --output json")
+	fmt.Println("                                    Print the result without the TUI: raw prints the")
+	fmt.Println("                                    answer, json adds the analysis type, model and timing")
+	fmt.Println("  While the result streams in, Esc cancels; e edits the instruction and r re-runs it")
+	fmt.Println("  on the same data")
 	fmt.Println("\nFor more information, visit: https://github.com/yourusername/clia")
 }
 
@@ -117,8 +388,59 @@ func readStdinData() (string, error) {
 	return string(data), nil
 }
 
-// runAnalysisMode processes data analysis requests
-func runAnalysisMode(inputData, analysisCommand string) error {
+// readInputFile reads the data to analyze from the file given with --input-file
+func readInputFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read input file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("input file %s is a directory", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read input file: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("no data to analyze: %s is empty", path)
+	}
+	return string(data), nil
+}
+
+// runAnalysisMode processes data analysis requests, showing the result in the
+// analyzer TUI or printing it as output says.
+// Column selection ("select 1,3,name" or --columns=...) is applied without AI.
+func runAnalysisMode(inputData, analysisCommand, output string) error {
+	if strings.TrimSpace(analysisCommand) == "" {
+		return fmt.Errorf("analysis command required when using piped input, e.g. cat data.csv | clia make table")
+	}
+	if strings.TrimSpace(inputData) == "" {
+		return fmt.Errorf("no data to analyze: the command piped into clia printed nothing")
+	}
+
+	if spec, ok := ai.ParseSelectCommand(analysisCommand); ok {
+		projected, err := ai.SelectColumns(inputData, spec)
+		if err != nil {
+			return err
+		}
+		fmt.Print(projected)
+		return nil
+	}
+
+	analysisCommand, spec := ai.ExtractColumnsFlag(analysisCommand)
+	if spec != "" {
+		projected, err := ai.SelectColumns(inputData, spec)
+		if err != nil {
+			return err
+		}
+		inputData = projected
+	}
+
+	if output == analysisOutputRaw || output == analysisOutputJSON {
+		return runAnalysisOutput(os.Stdout, inputData, analysisCommand, output)
+	}
+
 	// Start the analyzer TUI
 	return runAnalyzerTUI(inputData, analysisCommand)
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yourusername/clia/pkg/memory"
+)
+
+// runMemoryCommand handles the `clia memory` subcommands
+func runMemoryCommand(args []string) error {
+	args, format, err := memory.ExtractFormatFlag(args)
+	if err != nil {
+		return err
+	}
+
+	memoryManager, err := memory.NewManager()
+	if err != nil {
+		return fmt.Errorf("failed to initialize memory manager: %w", err)
+	}
+
+	subcommand := "list"
+	if len(args) > 0 {
+		subcommand = strings.ToLower(args[0])
+	}
+
+	switch subcommand {
+	case "list":
+		entries := memoryManager.GetAll()
+		memory.SortByRecent(entries)
+
+		content, err := memory.FormatEntries(entries, format)
+		if err != nil {
+			return err
+		}
+		fmt.Print(content)
+		return nil
+
+	case "export":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: clia memory export <file> [--format table|plain|json]")
+		}
+		if err := memoryManager.ExportFormatted(args[1], format); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Exported memory to %s (%s)\n", args[1], format)
+		return nil
+
+	case "delete":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: clia memory delete <id>")
+		}
+		if err := memoryManager.Remove(args[1]); err != nil {
+			return err
+		}
+		memoryManager.Flush()
+		fmt.Printf("🗑️  Deleted memory entry %s\n", args[1])
+		return nil
+
+	case "pin", "unpin":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: clia memory %s <id>", subcommand)
+		}
+		if err := memoryManager.SetPinned(args[1], subcommand == "pin"); err != nil {
+			return err
+		}
+		memoryManager.Flush()
+		if subcommand == "pin" {
+			fmt.Printf("📌 Pinned memory entry %s; it will not expire\n", args[1])
+		} else {
+			fmt.Printf("Unpinned memory entry %s\n", args[1])
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown memory command: %s (expected list, export, delete, pin or unpin)", subcommand)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/yourusername/clia/internal/ai"
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+const (
+	defaultServeAddr    = "127.0.0.1:7878"
+	serveTokenEnv       = "CLIA_SERVE_TOKEN"
+	serveMaxRequestSize = 64 << 10
+	serveRequestTimeout = 60 * time.Second
+)
+
+// suggestRequest is the body of POST /suggest
+type suggestRequest struct {
+	Input string `json:"input"`
+	Model string `json:"model,omitempty"` // Model ID or alias for this request only
+}
+
+// suggestResponse is the reply to POST /suggest
+type suggestResponse struct {
+	Suggestions []ai.CommandSuggestion `json:"suggestions"`
+	Truncated   bool                   `json:"truncated,omitempty"`
+}
+
+// explainRequest is the body of POST /explain
+type explainRequest struct {
+	Command string `json:"command"`
+}
+
+// explainResponse is the reply to POST /explain. Help and Explanation are
+// empty when the system has no help for the program or no AI provider is
+// configured.
+type explainResponse struct {
+	Command     string `json:"command"`
+	Danger      string `json:"danger"` // none, warning or critical
+	Reason      string `json:"reason,omitempty"`
+	Help        string `json:"help,omitempty"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// errorResponse is the reply to a failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// runServeCommand handles `clia serve [--addr host:port] [--token token]`:
+// a local HTTP API for editors with POST /suggest and POST /explain.
+// maxCost is the budget given with --max-cost, or -1 for the one in the config.
+func runServeCommand(args []string, offline bool, maxCost float64) error {
+	flags, args, err := parseLeadingFlags(args, nil, []string{"--addr", "--token"})
+	if err != nil {
+		return err
+	}
+	addr, token := flags.value("--addr"), flags.value("--token")
+	if len(args) > 0 {
+		return fmt.Errorf("usage: clia serve [--addr host:port] [--token token]")
+	}
+	if addr == "" {
+		addr = defaultServeAddr
+	}
+	if token == "" {
+		token = os.Getenv(serveTokenEnv)
+	}
+
+	if err := checkServeAddr(addr, token); err != nil {
+		return err
+	}
+
+	service, err := initializeCLIServices(offline, maxCost)
+	if err != nil {
+		return fmt.Errorf("failed to initialize services: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	server := &http.Server{
+		Handler:           service.serveHandler(token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("🌐 Serving the clia API on http://%s (POST /suggest, POST /explain)\n", listener.Addr())
+	if token != "" {
+		fmt.Println("🔑 Requests need the header 'Authorization: Bearer <token>'")
+	}
+	fmt.Println("Press Ctrl+C to stop")
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// checkServeAddr refuses to expose the API beyond this machine without a token
+func checkServeAddr(addr, token string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	if token == "" {
+		return fmt.Errorf("%s is reachable from other machines, set a token with --token or %s", addr, serveTokenEnv)
+	}
+	return nil
+}
+
+// serveHandler routes the API requests; a non-empty token must be sent as a
+// bearer token with every request. Requests from web pages are refused: they
+// carry an Origin header or, through DNS rebinding, a Host other than the
+// loopback address being served.
+func (s *CLIService) serveHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /suggest", s.handleSuggest)
+	mux.HandleFunc("POST /explain", s.handleExplain)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeJSON(w, http.StatusForbidden, errorResponse{Error: "requests from web pages are not allowed"})
+			return
+		}
+		if !servedHost(r) {
+			writeJSON(w, http.StatusForbidden, errorResponse{Error: "unexpected Host " + r.Host})
+			return
+		}
+		if token != "" {
+			sent, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "missing or wrong token"})
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// servedHost reports whether the Host of r names the loopback address and port
+// the request came in on. Requests to other addresses are not checked, those
+// need a token.
+func servedHost(r *http.Request) bool {
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if !ok || !local.IP.IsLoopback() {
+		return true
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil || port != strconv.Itoa(local.Port) {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleSuggest answers POST /suggest {"input": "..."} with command suggestions
+func (s *CLIService) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	var req suggestRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Input) == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "input is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), serveRequestTimeout)
+	defer cancel()
+
+	var response *ai.CompletionResponse
+	var err error
+	s.aiMu.Lock()
+	if req.Model != "" {
+		response, err = s.aiService.SuggestCommandsWithModel(ctx, req.Input, req.Model)
+	} else {
+		response, err = s.aiService.SuggestCommands(ctx, req.Input)
+	}
+	s.aiMu.Unlock()
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+		return
+	}
+
+	suggestions := response.Suggestions
+	if suggestions == nil {
+		suggestions = []ai.CommandSuggestion{}
+	}
+	writeJSON(w, http.StatusOK, suggestResponse{Suggestions: suggestions, Truncated: response.Truncated})
+}
+
+// handleExplain answers POST /explain {"command": "..."} with the danger
+// assessment, the man page of the program and, with an AI provider, a plain
+// text explanation. Neither the command nor its program is ever run.
+func (s *CLIService) handleExplain(w http.ResponseWriter, r *http.Request) {
+	var req explainRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	command := strings.TrimSpace(req.Command)
+	if command == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "command is required"})
+		return
+	}
+
+	danger := utils.ExplainCommandDanger(command)
+	response := explainResponse{Command: command, Danger: danger.Level.String()}
+	if danger.Level != utils.DangerNone {
+		response.Reason = danger.String()
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), serveRequestTimeout)
+	defer cancel()
+
+	// Only the man page: the --help fallback of LookupHelp runs the program
+	if help, err := s.executor.LookupManHelp(ctx, command); err == nil {
+		response.Help = help
+	}
+	if s.hasAIProvider() {
+		question := "Explain what this shell command does, part by part: " + command
+		s.aiMu.Lock()
+		answer, err := s.aiService.Ask(ctx, question, func(string) {})
+		s.aiMu.Unlock()
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, errorResponse{Error: err.Error()})
+			return
+		}
+		response.Explanation = strings.TrimSpace(answer.Content)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// readJSON decodes the body of r into v and replies with an error if it is
+// not sent as application/json or is not valid JSON
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	// Browsers send text/plain and form bodies to any site without asking
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		writeJSON(w, http.StatusUnsupportedMediaType, errorResponse{Error: "Content-Type must be application/json"})
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, serveMaxRequestSize)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid JSON body: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// writeJSON replies with status and v encoded as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/yourusername/clia/internal/ai"
+	"github.com/yourusername/clia/internal/config"
+)
+
+// runSetupCommand handles `clia setup`, interactively choosing a provider and
+// storing its API key in the config file
+func runSetupCommand() error {
+	configManager, err := config.NewManager()
+	if err != nil {
+		return fmt.Errorf("failed to initialize config manager: %w", err)
+	}
+	if err := configManager.Load(); err != nil {
+		return err
+	}
+
+	aiService := ai.NewService().
+		SetProviderHeaders(configManager.GetProviderHeaders()).
+		SetProviderEndpoints(configManager.GetProviderEndpoints())
+	return runSetup(os.Stdin, configManager, aiService.ValidateAPIKey)
+}
+
+// runSetup runs the setup dialog reading answers from input. validate checks
+// the entered key before it is saved.
+func runSetup(input io.Reader, configManager *config.Manager, validate func(ai.ProviderType, string) error) error {
+	reader := bufio.NewReader(input)
+	providers := config.SetupProviders()
+
+	fmt.Println("👋 Choose the AI provider clia should use:")
+	for i, info := range providers {
+		fmt.Printf("  %d. %-11s %s\n", i+1, info.Name, info.Description)
+	}
+	fmt.Print("Provider [1]: ")
+
+	choice, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+	if choice == "" {
+		choice = "1"
+	}
+
+	info, ok := config.FindSetupProvider(choice)
+	if !ok {
+		return fmt.Errorf("unknown provider %q", choice)
+	}
+
+	apiKey := ""
+	if info.RequiresKey {
+		fmt.Printf("🔗 Get a %s API key at %s\n", info.Name, info.KeyURL)
+		fmt.Printf("🔑 %s API key: ", info.Name)
+
+		apiKey, err = readAPIKey(reader)
+		if err != nil {
+			return err
+		}
+		if apiKey == "" {
+			return fmt.Errorf("no API key entered")
+		}
+
+		fmt.Println("🔍 Validating API key...")
+		if err := validate(ai.ProviderType(info.Name), apiKey); err != nil {
+			return fmt.Errorf("API key validation failed: %w", err)
+		}
+	} else {
+		fmt.Printf("🔗 Make sure %s is installed and running (%s)\n", info.Name, info.KeyURL)
+	}
+
+	configManager.SetProviderKey(info.Name, apiKey)
+	if err := configManager.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("💾 Saved %s settings to %s\n", info.Name, configManager.GetConfigPath())
+	if info.EnvVar != "" {
+		fmt.Printf("💡 %s, when set, takes precedence over the stored key\n", info.EnvVar)
+	}
+	return nil
+}
+
+// readAPIKey reads an API key without echoing it when stdin is a terminal
+func readAPIKey(reader *bufio.Reader) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return readLine(reader)
+	}
+
+	key, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key: %w", err)
+	}
+	return strings.TrimSpace(string(key)), nil
+}
+
+// readLine reads one trimmed line of input
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
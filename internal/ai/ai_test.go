@@ -2,8 +2,20 @@ package ai
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/yourusername/clia/pkg/memory"
 )
 
 func TestProviderFactory(t *testing.T) {
@@ -158,6 +170,146 @@ func TestCommandSuggestions(t *testing.T) {
 	}
 }
 
+func TestGroupByCategory(t *testing.T) {
+	suggestions := CommandSuggestions{
+		{Command: "ls -la", Category: "file_management"},
+		{Command: "cd ..", Category: "navigation"},
+		{Command: "du -sh *", Category: "File Management"},
+		{Command: "pwd", Category: "navigation"},
+	}
+
+	grouped := suggestions.GroupByCategory()
+	var commands []string
+	for _, suggestion := range grouped {
+		commands = append(commands, suggestion.Command)
+	}
+	if strings.Join(commands, ", ") != "ls -la, du -sh *, cd .., pwd" {
+		t.Errorf("Expected categories kept together in rank order, got %v", commands)
+	}
+	if suggestions[1].Command != "cd .." {
+		t.Error("Expected the original suggestions to be unchanged")
+	}
+
+	if !suggestions.MixedCategories() || suggestions[:1].MixedCategories() || (CommandSuggestions{}).MixedCategories() {
+		t.Error("Expected MixedCategories to report more than one category")
+	}
+}
+
+func TestCanonicalCommand(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"ls -la", "ls -al", true},
+		{"ls -la", "ls  -a   -l", true},
+		{"ls -la", "ls -l -a -l", true},
+		{"grep -rn 'foo bar' .", `grep -nr "foo bar" .`, true},
+		{`grep "foo" src`, "grep foo src", true},
+		{"find . -name '*.go'", `find . -name "*.go"`, true},
+		{"tar -xzf a.tgz", "tar -zxf a.tgz", true},
+		{"find . -name '*.go'", "find . -name *.go", false}, // The shell expands the unquoted glob
+		{`echo "$HOME"`, `echo '$HOME'`, false},             // Double quotes expand variables
+		{"ls -la", "ls -la -- -h", false},                   // Words after -- are not options
+		{"head -n 5 file", "head -n 10 file", false},
+		{"rm -- -la", "rm -- -al", false},
+	}
+
+	for _, tt := range tests {
+		same := CanonicalCommand(tt.a) == CanonicalCommand(tt.b)
+		if same != tt.same {
+			t.Errorf("CanonicalCommand(%q) = %q, CanonicalCommand(%q) = %q, expected same=%v",
+				tt.a, CanonicalCommand(tt.a), tt.b, CanonicalCommand(tt.b), tt.same)
+		}
+	}
+
+	if got := CanonicalCommand("  ls   -la  "); got != "ls -al" {
+		t.Errorf("Expected \"ls -al\", got %q", got)
+	}
+}
+
+func TestSuggestionDeduplication(t *testing.T) {
+	suggestions := CommandSuggestions{
+		{Command: "ls -la", Confidence: 0.9},
+		{Command: "ls -al", Confidence: 0.8},
+		{Command: "ls  -la", Confidence: 0.7},
+		{Command: "ls -lah", Confidence: 0.6},
+	}
+
+	unique := suggestions.Deduplicate(CanonicalCommand)
+	if len(unique) != 2 || unique[0].Command != "ls -la" || unique[1].Command != "ls -lah" {
+		t.Errorf("Expected ls -la and ls -lah with their original text, got %+v", unique)
+	}
+
+	// Without normalization only whitespace differences are duplicates
+	unique = suggestions.Deduplicate(collapseWhitespace)
+	if len(unique) != 3 {
+		t.Errorf("Expected 3 suggestions, got %+v", unique)
+	}
+
+	// The service drops duplicates before picking the top suggestions
+	mockProvider := NewMockProvider("test", "test-model")
+	mockProvider.SetMockResponse(&CompletionResponse{Suggestions: suggestions})
+	service := NewService().SetProvider(mockProvider)
+	response, err := service.SuggestCommands(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	if len(response.Suggestions) != 2 {
+		t.Errorf("Expected 2 distinct suggestions, got %+v", response.Suggestions)
+	}
+
+	mockProvider.SetMockResponse(&CompletionResponse{Suggestions: suggestions})
+	service.SetSuggestionNormalization(false)
+	response, err = service.SuggestCommands(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	if len(response.Suggestions) != 3 {
+		t.Errorf("Expected 3 suggestions without normalization, got %+v", response.Suggestions)
+	}
+}
+
+func TestRankSuggestions(t *testing.T) {
+	suggestions := []CommandSuggestion{
+		{Command: "rm -rf build", Safe: false, Confidence: 0.95},
+		{Command: "ls  -la", Safe: true, Confidence: 0.9, Category: "files"},
+		{Command: "tree", Safe: true, Confidence: 0.5},
+		{Command: "tree", Safe: true, Confidence: 0.7},
+	}
+	memories := []memory.SearchResult{
+		{Entry: memory.MemoryEntry{ID: "m1", SelectedCommand: "ls -la", Success: true, UsageCount: 10}, Score: 0.8},
+		{Entry: memory.MemoryEntry{ID: "m2", SelectedCommand: "make clean", Success: false}, Score: 0.9},
+	}
+
+	ranked := RankSuggestions(suggestions, memories, RankOptions{PreferSafe: true})
+	var order []string
+	for _, item := range ranked {
+		order = append(order, fmt.Sprintf("%s:%s", item.Source, item.Command))
+	}
+	want := "memory:ls -la,ai:tree,ai:rm -rf build,memory:make clean"
+	if strings.Join(order, ",") != want {
+		t.Fatalf("Expected %s, got %s", want, strings.Join(order, ","))
+	}
+
+	// The memory entry wins the duplicate and takes the category of the AI
+	first := ranked[0]
+	if !first.AlsoFromAI || first.Memory == nil || first.Memory.Entry.ID != "m1" || first.Category != "files" {
+		t.Errorf("Expected the memory entry confirmed by the AI, got %+v", first)
+	}
+	if ranked[1].Confidence != 0.7 || ranked[1].Index != 3 {
+		t.Errorf("Expected the more confident duplicate, got %+v", ranked[1])
+	}
+
+	// Without the safety preference the most confident command comes first
+	ranked = RankSuggestions(suggestions, nil, RankOptions{Limit: 2})
+	if len(ranked) != 2 || ranked[0].Command != "rm -rf build" || ranked[1].Source != SourceAI {
+		t.Errorf("Expected the 2 most confident AI suggestions, got %+v", ranked)
+	}
+	if got := ranked.Suggestions(); got[1].Command != "ls  -la" {
+		t.Errorf("Expected the original command text, got %+v", got)
+	}
+}
+
 func TestAIService(t *testing.T) {
 	service := NewService()
 
@@ -217,6 +369,99 @@ func TestAIServiceWithTimeout(t *testing.T) {
 	if err == nil {
 		t.Error("Expected timeout error")
 	}
+
+	if service.SetTimeout(0).GetTimeout() != DefaultRequestTimeout {
+		t.Errorf("Expected a zero timeout to restore the default, got %v", service.GetTimeout())
+	}
+
+	// Providers leave the limit to the service timeout
+	config := DefaultProviderConfig(ProviderTypeOpenAI)
+	config.APIKey = "test-key"
+	if err := service.SetProviderByConfig(ProviderTypeOpenAI, config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Timeout != 0 {
+		t.Errorf("Expected the provider to have no timeout of its own, got %v", config.Timeout)
+	}
+}
+
+func TestMockProviderScript(t *testing.T) {
+	ctx := context.Background()
+	provider := NewMockProvider("mock", "test-model")
+	provider.SetMockResponse(&CompletionResponse{Content: "set"})
+	provider.QueueResponse(&CompletionResponse{Content: "first"}).QueueError(errors.New("second"))
+
+	// Scripted answers come first, in order
+	if resp, err := provider.Complete(ctx, &CompletionRequest{Prompt: "a"}); err != nil || resp.Content != "first" {
+		t.Errorf("Expected the first queued answer, got %v (%v)", resp, err)
+	}
+	if _, err := provider.Complete(ctx, &CompletionRequest{Prompt: "b"}); err == nil || err.Error() != "second" {
+		t.Errorf("Expected the queued error, got %v", err)
+	}
+	if resp, err := provider.Complete(ctx, &CompletionRequest{Prompt: "c"}); err != nil || resp.Content != "set" {
+		t.Errorf("Expected the answer set once the queue is empty, got %v (%v)", resp, err)
+	}
+	if requests := provider.Requests(); len(requests) != 3 || requests[2].Prompt != "c" {
+		t.Errorf("Expected the requests to be recorded, got %v", requests)
+	}
+
+	// Streaming passes the chunks set
+	provider.SetStreamChunks("hel", "lo")
+	var chunks []string
+	resp, err := CompleteStream(ctx, provider, &CompletionRequest{Prompt: "d"}, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil || resp.Content != "hello" || len(chunks) != 2 {
+		t.Errorf("Expected the answer in two chunks, got %q (%v)", chunks, err)
+	}
+
+	// A delay longer than the request may take times out
+	provider.SetDelay(time.Second)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = provider.Complete(timeoutCtx, &CompletionRequest{Prompt: "e"})
+	var aiErr *AIError
+	if !errors.As(err, &aiErr) || aiErr.Type != ErrorTypeTimeout {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
+
+func TestSuggestCommandsWithMockProvider(t *testing.T) {
+	ctx := context.Background()
+	provider := NewMockProvider("mock", "test-model")
+	service := NewService().SetProvider(provider)
+
+	// The answer of the model is parsed, ranked and limited
+	provider.QueueContent("```json\n" + `{"commands": [{"cmd": "ls -la", "description": "List files", "confidence": 0.6},
+		{"cmd": "ls -lah", "confidence": 0.9}, {"cmd": "find . -maxdepth 1", "confidence": 0.5}, {"cmd": "tree", "confidence": 0.4}]}` + "\n```")
+	resp, err := service.SuggestCommands(ctx, "list files")
+	if err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	if len(resp.Suggestions) != 3 || resp.Suggestions[0].Command != "ls -lah" || resp.Suggestions[1].Description != "List files" {
+		t.Errorf("Expected the 3 most confident suggestions, got %+v", resp.Suggestions)
+	}
+
+	// A plain answer is sent back once to be reformatted as JSON
+	provider.QueueContent("du -sh *").QueueContent(`{"commands": [{"cmd": "du -sh *", "description": "Show sizes"}]}`)
+	resp, err = service.SuggestCommands(ctx, "show sizes")
+	if err != nil || len(resp.Suggestions) != 1 || resp.Suggestions[0].Description != "Show sizes" {
+		t.Fatalf("Expected the reformatted suggestion, got %+v (%v)", resp, err)
+	}
+	if requests := provider.Requests(); len(requests) != 3 || !strings.Contains(requests[2].Prompt, "du -sh *") {
+		t.Errorf("Expected a reformat request with the plain answer, got %d requests", len(requests))
+	}
+
+	// A provider slower than the timeout fails, or falls back to rules
+	provider.SetDelay(time.Second)
+	service.SetTimeout(20 * time.Millisecond)
+	if _, err := service.SuggestCommands(ctx, "show processes"); err == nil {
+		t.Error("Expected the slow provider to time out")
+	}
+	service.SetFallbackMode(true)
+	if resp, err := service.SuggestCommands(ctx, "show processes"); err != nil || resp.Provider != "fallback" {
+		t.Errorf("Expected fallback suggestions, got %v (%v)", resp, err)
+	}
 }
 
 func TestAIServiceFallbackMode(t *testing.T) {
@@ -243,6 +488,68 @@ func TestAIServiceFallbackMode(t *testing.T) {
 	}
 }
 
+func TestAIServiceOfflineMode(t *testing.T) {
+	// Offline mode must work without any provider configured
+	service := NewService().SetOffline(true)
+	if !service.IsOffline() {
+		t.Fatal("Expected offline mode to be enabled")
+	}
+
+	resp, err := service.SuggestCommands(context.Background(), "show disk space")
+	if err != nil {
+		t.Fatalf("Expected offline suggestions, got error: %v", err)
+	}
+	if resp.Provider != "offline" {
+		t.Errorf("Expected offline provider, got '%s'", resp.Provider)
+	}
+	if len(resp.Suggestions) == 0 || resp.Suggestions[0].Command != "df -h" {
+		t.Errorf("Expected 'df -h' as top offline suggestion, got %v", resp.Suggestions)
+	}
+
+	// The provider must not be contacted while offline
+	mockProvider := NewMockProvider("test", "test-model")
+	mockProvider.SetMockError(NewAIError(ErrorTypeNetwork, "provider should not be called", nil))
+	service.SetProvider(mockProvider)
+
+	if _, err := service.SuggestCommands(context.Background(), "list files"); err != nil {
+		t.Errorf("Expected provider to be skipped in offline mode, got error: %v", err)
+	}
+
+	service.SetOffline(false)
+	if _, err := service.SuggestCommands(context.Background(), "list files"); err == nil {
+		t.Error("Expected provider error once offline mode is disabled")
+	}
+}
+
+func TestGenerateFallbackSuggestions(t *testing.T) {
+	service := NewService()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"list files", "ls -la"},
+		{"which ports are listening", "ss -tulpn"},
+		{"show git status", "git status"},
+		{"how much memory is free", "free -h"},
+		{"something unrelated", "echo 'something unrelated'"},
+	}
+
+	for _, tt := range tests {
+		suggestions := service.generateFallbackSuggestions(tt.input)
+		if len(suggestions) == 0 {
+			t.Errorf("Expected suggestions for %q", tt.input)
+			continue
+		}
+		if suggestions[0].Command != tt.expected {
+			t.Errorf("Expected %q for %q, got %q", tt.expected, tt.input, suggestions[0].Command)
+		}
+		if len(suggestions) > 3 {
+			t.Errorf("Expected at most 3 suggestions for %q, got %d", tt.input, len(suggestions))
+		}
+	}
+}
+
 func TestAIError(t *testing.T) {
 	originalErr := context.DeadlineExceeded
 	aiErr := NewAIError(ErrorTypeNetwork, "timeout occurred", originalErr)
@@ -297,6 +604,43 @@ func TestOpenRouterProvider(t *testing.T) {
 	}
 }
 
+func TestSwitchModelAlias(t *testing.T) {
+	service := NewService()
+	service.SetProvider(NewOpenRouterProvider(&ProviderConfig{
+		Name:   "openrouter",
+		APIKey: "test-openrouter-key",
+		Model:  "openai/gpt-3.5-turbo",
+	}))
+	service.SetModelAliases(map[string]map[string]string{
+		"openrouter": {"fast": "z-ai/glm-4.5-air:free"},
+		"openai":     {"smart": "gpt-4o"},
+	})
+
+	if model, ok := service.ResolveModelAlias("FAST"); !ok || model != "z-ai/glm-4.5-air:free" {
+		t.Errorf("Expected alias 'fast' to resolve, got %q (%v)", model, ok)
+	}
+
+	if err := service.SwitchModel("fast"); err != nil {
+		t.Fatalf("SwitchModel with alias failed: %v", err)
+	}
+	if got := service.provider.GetModel(); got != "z-ai/glm-4.5-air:free" {
+		t.Errorf("Expected model 'z-ai/glm-4.5-air:free', got '%s'", got)
+	}
+
+	// Plain model IDs pass through unchanged
+	if err := service.SwitchModel("openai/gpt-4"); err != nil {
+		t.Fatalf("SwitchModel with model ID failed: %v", err)
+	}
+	if got := service.provider.GetModel(); got != "openai/gpt-4" {
+		t.Errorf("Expected model 'openai/gpt-4', got '%s'", got)
+	}
+
+	// Aliases of another provider are reported instead of being used as model IDs
+	if err := service.SwitchModel("smart"); err == nil {
+		t.Error("Expected error for alias defined on a different provider")
+	}
+}
+
 func TestOpenRouterProviderValidation(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -435,3 +779,1049 @@ func TestOpenRouterProviderWithoutAPIKey(t *testing.T) {
 		t.Errorf("Expected auth error type, got %s", aiErr.Type)
 	}
 }
+
+func TestOllamaProviderTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("Expected request to /api/chat, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"model": "llama2",
+			"message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"ls -la\", \"description\": \"List files\"}]}"},
+			"done": true,
+			"total_duration": 2500000000,
+			"load_duration": 500000000,
+			"prompt_eval_count": 20,
+			"eval_count": 50,
+			"eval_duration": 1000000000
+		}`))
+	}))
+	defer server.Close()
+
+	config := DefaultProviderConfig(ProviderTypeOllama)
+	config.Endpoint = server.URL
+
+	provider, err := NewProviderFactory().Create(ProviderTypeOllama, config)
+	if err != nil {
+		t.Fatalf("Expected Ollama provider without API key, got error: %v", err)
+	}
+
+	resp, err := provider.Complete(context.Background(), &CompletionRequest{Prompt: "list files"})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+
+	if len(resp.Suggestions) != 1 || resp.Suggestions[0].Command != "ls -la" {
+		t.Errorf("Expected 'ls -la' suggestion, got %v", resp.Suggestions)
+	}
+
+	usage := resp.Usage
+	if !usage.HasTiming() {
+		t.Fatal("Expected timing information in usage")
+	}
+	if usage.TotalTokens != 70 || usage.CompletionTokens != 50 {
+		t.Errorf("Expected 70 total and 50 completion tokens, got %d and %d", usage.TotalTokens, usage.CompletionTokens)
+	}
+	if usage.LoadDuration != 500*time.Millisecond {
+		t.Errorf("Expected 500ms load duration, got %v", usage.LoadDuration)
+	}
+	if usage.TokensPerSecond() != 50 {
+		t.Errorf("Expected 50 tokens/sec, got %f", usage.TokensPerSecond())
+	}
+
+	// Remote providers report no timing
+	if (&UsageInfo{TotalTokens: 10}).HasTiming() {
+		t.Error("Expected no timing for token-only usage")
+	}
+}
+
+func TestSelectColumns(t *testing.T) {
+	data := "name,size,owner\nfoo.txt,12,alice\n\"bar, baz.txt\",7,bob\n"
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"1,3", "name,owner\nfoo.txt,alice\n\"bar, baz.txt\",bob\n"},
+		{"size,NAME", "size,name\n12,foo.txt\n7,\"bar, baz.txt\"\n"},
+		{"3, name", "owner,name\nalice,foo.txt\nbob,\"bar, baz.txt\"\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := SelectColumns(data, tt.spec)
+		if err != nil {
+			t.Errorf("SelectColumns(%q) returned error: %v", tt.spec, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("SelectColumns(%q) = %q, expected %q", tt.spec, got, tt.expected)
+		}
+	}
+
+	if got, err := SelectColumns("a\tb\n1\t2\n", "b"); err != nil || got != "b\n2\n" {
+		t.Errorf("Expected TSV selection, got %q, %v", got, err)
+	}
+
+	for _, spec := range []string{"4", "missing", ""} {
+		if _, err := SelectColumns(data, spec); err == nil {
+			t.Errorf("Expected error for column spec %q", spec)
+		}
+	}
+}
+
+func TestColumnCommands(t *testing.T) {
+	if spec, ok := ParseSelectCommand("select 1,3,name"); !ok || spec != "1,3,name" {
+		t.Errorf("ParseSelectCommand = %q, %v", spec, ok)
+	}
+	if _, ok := ParseSelectCommand("make table"); ok {
+		t.Error("Expected 'make table' not to be a select command")
+	}
+
+	command, spec := ExtractColumnsFlag("make table --columns=name,size")
+	if command != "make table" || spec != "name,size" {
+		t.Errorf("ExtractColumnsFlag = %q, %q", command, spec)
+	}
+
+	command, spec = ExtractColumnsFlag("summarize --columns 2")
+	if command != "summarize" || spec != "2" {
+		t.Errorf("ExtractColumnsFlag = %q, %q", command, spec)
+	}
+}
+
+func TestCreativity(t *testing.T) {
+	creativity, err := ParseCreativity("HIGH")
+	if err != nil || creativity != CreativityHigh {
+		t.Fatalf("ParseCreativity(HIGH) = %q, %v", creativity, err)
+	}
+	if _, err := ParseCreativity("wild"); err == nil {
+		t.Error("Expected error for unknown creativity")
+	}
+
+	if CreativityLow.Temperature() >= CreativityMedium.Temperature() ||
+		CreativityMedium.Temperature() >= CreativityHigh.Temperature() {
+		t.Error("Expected temperature to increase with creativity")
+	}
+
+	if CreativityDefault.Step(1) != CreativityHigh || CreativityDefault.Step(-1) != CreativityLow {
+		t.Error("Expected default creativity to step from medium")
+	}
+	if CreativityHigh.Step(1) != CreativityHigh || CreativityLow.Step(-1) != CreativityLow {
+		t.Error("Expected creativity steps to be clamped")
+	}
+
+	config := DefaultProviderConfig(ProviderTypeOpenAI)
+	if config.RequestTemperature(&CompletionRequest{}) != config.Temperature {
+		t.Error("Expected provider temperature when the request sets none")
+	}
+	if config.RequestTemperature(&CompletionRequest{Temperature: 1.2}) != 1.2 {
+		t.Error("Expected request temperature to override the provider default")
+	}
+}
+
+func TestSuggestionCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewSuggestionCacheAt(t.TempDir())
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	mockProvider := NewMockProvider("test", "test-model")
+	service := NewService().SetProvider(mockProvider).SetCache(cache)
+
+	first, err := service.SuggestCommands(ctx, "show disk space")
+	if err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	if first.Cached {
+		t.Error("Expected the first response to come from the provider")
+	}
+
+	// Repeated requests are served from disk even when the provider fails
+	mockProvider.SetMockError(context.DeadlineExceeded)
+	second, err := service.SuggestCommands(ctx, "  Show DISK space ")
+	if err != nil {
+		t.Fatalf("Expected cached response, got error: %v", err)
+	}
+	if !second.Cached || len(second.Suggestions) != len(first.Suggestions) {
+		t.Errorf("Expected cached suggestions, got %+v", second)
+	}
+
+	// Other models and shells use separate entries
+	files, _ := filepath.Glob(filepath.Join(cache.GetDir(), "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one cache entry, got %d", len(files))
+	}
+	entry, err := cache.readEntry(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := entry.Key
+	other := key
+	other.Model = "other-model"
+	if _, ok := cache.Get(other); ok {
+		t.Error("Expected no entry for a different model")
+	}
+	other = key
+	other.Shell = "fish"
+	if _, ok := cache.Get(other); ok {
+		t.Error("Expected no entry for a different shell")
+	}
+
+	// The prompt carries the directory listing and earlier exchanges, and
+	// the sampling settings change the answer
+	req := &CompletionRequest{Prompt: "Files: a.txt\nRequest: Show disk space", Temperature: 0.3}
+	base := NewCacheKey("Show disk space", "test", "test-model", req)
+	if NewCacheKey("show  disk space", "test", "test-model", &CompletionRequest{Prompt: "Files: a.txt\nRequest: show  disk space", Temperature: 0.3}) != base {
+		t.Error("Expected the request to match regardless of case and spacing")
+	}
+	for _, changed := range []CompletionRequest{
+		{Prompt: "Files: b.txt\nRequest: Show disk space", Temperature: 0.3},
+		{Prompt: "Earlier: du -sh\nFiles: a.txt\nRequest: Show disk space", Temperature: 0.3},
+		{Prompt: req.Prompt, Temperature: 0.9},
+		{Prompt: req.Prompt, Temperature: 0.3, Choices: 3},
+	} {
+		if NewCacheKey("Show disk space", "test", "test-model", &changed) == base {
+			t.Errorf("Expected a separate entry for %+v", changed)
+		}
+	}
+
+	// Stale entries are refreshed from the provider and pruned
+	now = now.Add(DefaultCacheTTL + time.Hour)
+	if _, ok := cache.Get(key); ok {
+		t.Error("Expected expired entry to be ignored")
+	}
+	if _, err := service.SuggestCommands(ctx, "show disk space"); err == nil {
+		t.Error("Expected expired entry to go to the provider")
+	}
+
+	removed, err := cache.Prune()
+	if err != nil || removed != 1 {
+		t.Errorf("Expected Prune to remove 1 entry, got %d (%v)", removed, err)
+	}
+	if cache.Count() != 0 {
+		t.Errorf("Expected empty cache after prune, got %d entries", cache.Count())
+	}
+}
+
+func TestProviderCustomHeaders(t *testing.T) {
+	t.Setenv("CLIA_TEST_ORG", "org-42")
+
+	var received []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Clone())
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/chat" {
+			w.Write([]byte(`{"message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"ls\"}]}"}, "done": true}`))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"ls\"}]}"}}]}`))
+	}))
+	defer server.Close()
+
+	headers := map[string]string{"X-Org-Id": "${CLIA_TEST_ORG}", "X-Proxy-Token": "static"}
+	service := NewService().SetProviderHeaders(map[string]map[string]string{
+		"openai": headers,
+		"ollama": headers,
+	})
+
+	for _, providerType := range []ProviderType{ProviderTypeOpenAI, ProviderTypeOllama} {
+		config := DefaultProviderConfig(providerType)
+		config.APIKey = "test-key"
+		config.Endpoint = server.URL
+		if err := service.SwitchProvider(providerType, config); err != nil {
+			t.Fatalf("SwitchProvider(%s) failed: %v", providerType, err)
+		}
+
+		if _, err := service.SuggestCommands(context.Background(), "list files"); err != nil {
+			t.Fatalf("SuggestCommands with %s failed: %v", providerType, err)
+		}
+
+		last := received[len(received)-1]
+		if last.Get("X-Org-Id") != "org-42" {
+			t.Errorf("%s: expected expanded X-Org-Id header, got %q", providerType, last.Get("X-Org-Id"))
+		}
+		if last.Get("X-Proxy-Token") != "static" {
+			t.Errorf("%s: expected X-Proxy-Token header, got %q", providerType, last.Get("X-Proxy-Token"))
+		}
+	}
+}
+
+func TestProviderEndpointOverride(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"ls\"}]}"}}]}`))
+	}))
+	defer server.Close()
+
+	service := NewService().SetProviderEndpoints(map[string]string{"openrouter": server.URL})
+
+	config := DefaultProviderConfig(ProviderTypeOpenRouter)
+	config.APIKey = "test-key"
+	if err := service.SwitchProvider(ProviderTypeOpenRouter, config); err != nil {
+		t.Fatalf("SwitchProvider failed: %v", err)
+	}
+	if config.Endpoint != server.URL {
+		t.Errorf("Expected endpoint override, got %q", config.Endpoint)
+	}
+
+	if _, err := service.SuggestCommands(context.Background(), "list files"); err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	if hits != 1 {
+		t.Errorf("Expected the request to go to the override endpoint, got %d requests", hits)
+	}
+}
+
+func TestProbeProviders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models": []}`))
+		case "/chat/completions":
+			if r.Header.Get("Authorization") != "Bearer good-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error": {"message": "invalid key"}}`))
+				return
+			}
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	service := NewService().SetProviderEndpoints(map[string]string{
+		"openai":     server.URL,
+		"openrouter": server.URL,
+		"ollama":     server.URL,
+	})
+
+	keys := map[ProviderType]string{ProviderTypeOpenRouter: "bad-key"}
+	probes := service.ProbeProviders(context.Background(), func(provider ProviderType) string {
+		return keys[provider]
+	})
+
+	results := make(map[ProviderType]ProviderProbe)
+	for _, probe := range probes {
+		results[probe.Type] = probe
+	}
+
+	if probe := results[ProviderTypeOllama]; !probe.Configured || !probe.Reachable {
+		t.Errorf("Expected ollama to be reachable, got %+v", probe)
+	}
+	if probe := results[ProviderTypeOpenAI]; probe.Configured || probe.Reachable {
+		t.Errorf("Expected openai without a key to be unconfigured, got %+v", probe)
+	}
+	if probe := results[ProviderTypeOpenRouter]; !probe.Configured || probe.Reachable || probe.Error == nil {
+		t.Errorf("Expected openrouter with a bad key to report an error, got %+v", probe)
+	}
+
+	// The current provider is checked with its runtime settings
+	config := DefaultProviderConfig(ProviderTypeOpenAI)
+	config.APIKey = "good-key"
+	if err := service.SwitchProvider(ProviderTypeOpenAI, config); err != nil {
+		t.Fatalf("SwitchProvider failed: %v", err)
+	}
+	for _, probe := range service.ProbeProviders(context.Background(), nil) {
+		if probe.Type == ProviderTypeOpenAI && (!probe.Current || !probe.Reachable) {
+			t.Errorf("Expected the current openai provider to be reachable, got %+v", probe)
+		}
+	}
+}
+
+func TestTruncatedResponse(t *testing.T) {
+	// The server cuts responses off unless at least needTokens are allowed
+	needTokens := 1500
+	var requested []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			MaxTokens int `json:"max_tokens"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		requested = append(requested, body.MaxTokens)
+
+		w.Header().Set("Content-Type", "application/json")
+		if body.MaxTokens < needTokens {
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"find . -na"}, "finish_reason": "length"}]}`))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"find . -name '*.jpg'\"}]}"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	config := DefaultProviderConfig(ProviderTypeOpenAI)
+	config.APIKey = "test-key"
+	config.Endpoint = server.URL
+
+	// Fallback mode must not hide the truncation
+	service := NewService().SetFallbackMode(true).SetMaxTokens(1000)
+	if err := service.SwitchProvider(ProviderTypeOpenAI, config); err != nil {
+		t.Fatalf("SwitchProvider failed: %v", err)
+	}
+
+	// The first response is truncated, the retry with a doubled budget succeeds
+	response, err := service.SuggestCommands(context.Background(), "find photos")
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if len(response.Suggestions) != 1 || response.Suggestions[0].Command != "find . -name '*.jpg'" {
+		t.Errorf("Unexpected suggestions after retry: %+v", response.Suggestions)
+	}
+	if len(requested) != 2 || requested[0] != 1000 || requested[1] != 2000 {
+		t.Errorf("Expected requests with 1000 then 2000 tokens, got %v", requested)
+	}
+
+	// When the retry is cut off too, the user is told to raise max_tokens
+	needTokens = 10000
+	requested = nil
+	_, err = service.SuggestCommands(context.Background(), "find videos")
+	var aiErr *AIError
+	if !errors.As(err, &aiErr) || aiErr.Type != ErrorTypeTruncated {
+		t.Fatalf("Expected truncation error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "max_tokens") {
+		t.Errorf("Expected error to mention max_tokens, got %q", err.Error())
+	}
+	if len(requested) != 2 {
+		t.Errorf("Expected a single retry, got %v", requested)
+	}
+}
+
+func TestReformatRetry(t *testing.T) {
+	reformatWorks := true
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		prompt := body.Messages[0].Content
+		prompts = append(prompts, prompt)
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(prompt, "Reformat your previous answer") && reformatWorks {
+			w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"du -sh *\", \"description\": \"Show sizes\"}]}"}, "finish_reason": "stop"}]}`))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Sure! Run du -sh * to see the sizes."}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	config := DefaultProviderConfig(ProviderTypeOpenAI)
+	config.APIKey = "test-key"
+	config.Endpoint = server.URL
+
+	service := NewService()
+	if err := service.SwitchProvider(ProviderTypeOpenAI, config); err != nil {
+		t.Fatalf("SwitchProvider failed: %v", err)
+	}
+
+	response, err := service.SuggestCommands(context.Background(), "show folder sizes")
+	if err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	if len(response.Suggestions) != 1 || response.Suggestions[0].Command != "du -sh *" {
+		t.Errorf("Expected the reformatted suggestion, got %+v", response.Suggestions)
+	}
+	if len(prompts) != 2 || !strings.Contains(prompts[1], "Sure! Run du -sh * to see the sizes.") {
+		t.Errorf("Expected one reformat request with the original answer, got %q", prompts)
+	}
+
+	// A reformat that fails too is not retried again; the plain answer is used
+	reformatWorks = false
+	prompts = nil
+	response, err = service.SuggestCommands(context.Background(), "show disk sizes")
+	if err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	if len(prompts) != 2 {
+		t.Errorf("Expected a single reformat attempt, got %d requests", len(prompts))
+	}
+	if len(response.Suggestions) != 1 || !strings.Contains(response.Suggestions[0].Command, "Sure!") {
+		t.Errorf("Expected the original answer as the suggestion, got %+v", response.Suggestions)
+	}
+}
+
+// listingProvider is a MockProvider listing its models and switching between them
+type listingProvider struct {
+	*MockProvider
+	models    []ModelInfo
+	requested []string // Model of each request
+}
+
+func (p *listingProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	p.requested = append(p.requested, p.model)
+	return p.MockProvider.Complete(ctx, req)
+}
+
+func (p *listingProvider) GetModels(ctx context.Context) ([]ModelInfo, error) {
+	return p.models, nil
+}
+
+func (p *listingProvider) SwitchModel(modelName string) error {
+	p.model = modelName
+	return nil
+}
+
+func TestMultipleChoices(t *testing.T) {
+	var requested []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			N int `json:"n"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		requested = append(requested, body.N)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [
+			{"index": 0, "message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"du -sh *\", \"confidence\": 0.9}]}"}, "finish_reason": "stop"},
+			{"index": 1, "message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"ncdu\", \"confidence\": 0.8}, {\"cmd\": \"du -sh *\", \"confidence\": 0.7}]}"}, "finish_reason": "stop"},
+			{"index": 2, "message": {"role": "assistant", "content": "{\"commands\": [{\"cmd\": \"df -"}, "finish_reason": "length"}
+		]}`))
+	}))
+	defer server.Close()
+
+	config := DefaultProviderConfig(ProviderTypeOpenAI)
+	config.APIKey = "test-key"
+	config.Endpoint = server.URL
+
+	service := NewService().SetChoices(3)
+	if err := service.SwitchProvider(ProviderTypeOpenAI, config); err != nil {
+		t.Fatalf("SwitchProvider failed: %v", err)
+	}
+
+	// The suggestions of all choices are merged, duplicates and cut off ones dropped
+	response, err := service.SuggestCommands(context.Background(), "show disk usage")
+	if err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	var commands []string
+	for _, suggestion := range response.Suggestions {
+		commands = append(commands, suggestion.Command)
+	}
+	if strings.Join(commands, ", ") != "du -sh *, ncdu" {
+		t.Errorf("Expected the suggestions of both complete choices, got %v", commands)
+	}
+	if response.Truncated || response.Unparsed {
+		t.Errorf("One cut off choice must not mark the response, got %+v", response)
+	}
+	if len(requested) != 1 || requested[0] != 3 {
+		t.Errorf("Expected a single request for 3 choices, got %v", requested)
+	}
+
+	// A single choice leaves n out of the request
+	requested = nil
+	service.SetChoices(1)
+	if _, err := service.SuggestCommands(context.Background(), "show free space"); err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	if len(requested) != 1 || requested[0] != 0 {
+		t.Errorf("Expected n to be left out, got %v", requested)
+	}
+}
+
+func TestSuggestCommandsWithModel(t *testing.T) {
+	ctx := context.Background()
+	provider := &listingProvider{
+		MockProvider: NewMockProvider("openrouter", "openai/gpt-3.5-turbo"),
+		models:       []ModelInfo{{ID: "openai/gpt-3.5-turbo"}, {ID: "openai/gpt-4"}},
+	}
+	service := NewService()
+	service.SetProvider(provider)
+	service.SetModelAliases(map[string]map[string]string{"openrouter": {"smart": "openai/gpt-4"}})
+
+	if _, err := service.SuggestCommandsWithModel(ctx, "list files", "OpenAI/GPT-4"); err != nil {
+		t.Fatalf("SuggestCommandsWithModel failed: %v", err)
+	}
+	if _, err := service.SuggestCommandsWithModel(ctx, "show disk usage", "smart"); err != nil {
+		t.Fatalf("SuggestCommandsWithModel with alias failed: %v", err)
+	}
+	if _, err := service.SuggestCommands(ctx, "show memory"); err != nil {
+		t.Fatalf("SuggestCommands failed: %v", err)
+	}
+	expected := []string{"openai/gpt-4", "openai/gpt-4", "openai/gpt-3.5-turbo"}
+	if strings.Join(provider.requested, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected requests with models %v, got %v", expected, provider.requested)
+	}
+
+	// Models the provider does not list are rejected without a request
+	if _, err := service.SuggestCommandsWithModel(ctx, "list files", "openai/gpt-5-ultra"); err == nil || !strings.Contains(err.Error(), "unknown model") {
+		t.Errorf("Expected an unknown model error, got %v", err)
+	}
+	if len(provider.requested) != 3 || provider.GetModel() != "openai/gpt-3.5-turbo" {
+		t.Errorf("Expected no request and the model unchanged, got %v and %s", provider.requested, provider.GetModel())
+	}
+
+	// Providers that cannot switch models report it
+	service.SetProvider(NewMockProvider("test", "test-model"))
+	if _, err := service.SuggestCommandsWithModel(ctx, "list files", "other-model"); err == nil {
+		t.Error("Expected an error for a provider without model switching")
+	}
+}
+
+func TestSummarizeOutput(t *testing.T) {
+	ctx := context.Background()
+	service := NewService()
+
+	if _, err := service.SummarizeOutput(ctx, "ls", "file.txt"); err == nil {
+		t.Error("Expected error without a provider")
+	}
+
+	mockProvider := NewMockProvider("test", "test-model")
+	mockProvider.SetMockResponse(&CompletionResponse{Content: "  3 errors, all about missing permissions in /var/log\n"})
+	service.SetProvider(mockProvider)
+
+	if _, err := service.SummarizeOutput(ctx, "ls", "  \n"); err == nil {
+		t.Error("Expected error for empty output")
+	}
+
+	summary, err := service.SummarizeOutput(ctx, "grep -r error /var/log", "permission denied\npermission denied")
+	if err != nil {
+		t.Fatalf("SummarizeOutput failed: %v", err)
+	}
+	if summary != "3 errors, all about missing permissions in /var/log" {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+
+	service.SetOffline(true)
+	if _, err := service.SummarizeOutput(ctx, "ls", "file.txt"); err == nil {
+		t.Error("Expected error in offline mode")
+	}
+}
+
+func TestStreamAnalysis(t *testing.T) {
+	mockProvider := NewMockProvider("test", "test-model")
+	mockProvider.SetMockResponse(&CompletionResponse{Content: "| name | size |"})
+	service := NewService()
+	service.SetProvider(mockProvider)
+
+	// Providers that cannot stream pass the result in one piece
+	var chunks []string
+	response, err := service.StreamAnalysis(context.Background(), "name,size\na,1\n", "make table", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("StreamAnalysis failed: %v", err)
+	}
+	if len(chunks) != 1 || chunks[0] != response.Result {
+		t.Errorf("Expected the result as one chunk, got %q", chunks)
+	}
+
+	if _, err := service.StreamAnalysis(context.Background(), "  \n", "make table", nil); err == nil {
+		t.Error("Expected an error for empty data")
+	}
+}
+
+// countingProvider counts the requests reaching a MockProvider
+type countingProvider struct {
+	*MockProvider
+	calls int
+}
+
+func (p *countingProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	p.calls++
+	return p.MockProvider.Complete(ctx, req)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	provider := &countingProvider{MockProvider: NewMockProvider("mock", "test-model")}
+	provider.SetMockError(NewAIError(ErrorTypeNetwork, "request timed out", nil))
+
+	service := NewService().SetProvider(provider).SetCircuitBreaker(3, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.SuggestCommands(ctx, fmt.Sprintf("request %d", i)); err == nil {
+			t.Fatal("Expected the provider error")
+		}
+	}
+	if state, failures, _ := service.BreakerStatus(); state != BreakerOpen || failures != 3 {
+		t.Fatalf("Expected an open circuit after 3 failures, got %s after %d", state, failures)
+	}
+
+	// An open circuit fails fast without calling the provider
+	_, err := service.SuggestCommands(ctx, "request 3")
+	var aiErr *AIError
+	if !errors.As(err, &aiErr) || aiErr.Type != ErrorTypeUnavailable {
+		t.Errorf("Expected an unavailable error, got %v", err)
+	}
+	if provider.calls != 3 {
+		t.Errorf("Expected the provider to be skipped, got %d calls", provider.calls)
+	}
+	if info := service.GetProviderInfo(); info["circuit"] != "open" {
+		t.Errorf("Expected the open circuit in the provider info, got %v", info["circuit"])
+	}
+
+	// After the cooldown one request tests the provider and closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	if state, _, _ := service.BreakerStatus(); state != BreakerHalfOpen {
+		t.Errorf("Expected a half-open circuit after the cooldown, got %s", state)
+	}
+	provider.SetMockError(nil)
+	if _, err := service.SuggestCommands(ctx, "request 4"); err != nil {
+		t.Fatalf("Expected the test request to succeed, got %v", err)
+	}
+	if state, failures, _ := service.BreakerStatus(); state != BreakerClosed || failures != 0 {
+		t.Errorf("Expected a closed circuit after a success, got %s after %d", state, failures)
+	}
+
+	// Errors about the request or the API key say nothing about the provider's health
+	provider.SetMockError(NewAIError(ErrorTypeAuth, "invalid API key", nil))
+	for i := 0; i < 5; i++ {
+		service.SuggestCommands(ctx, fmt.Sprintf("auth request %d", i))
+	}
+	if state, _, _ := service.BreakerStatus(); state != BreakerClosed {
+		t.Errorf("Expected auth errors to leave the circuit closed, got %s", state)
+	}
+}
+
+func TestAsk(t *testing.T) {
+	var prompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Stream   bool `json:"stream"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		prompt = body.Messages[0].Content
+		if !body.Stream {
+			t.Error("Expected a streaming request")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{"tar -c creates", " an archive,", " -x extracts one."} {
+			fmt.Fprintf(w, "data: {\"choices\": [{\"index\": 0, \"delta\": {\"content\": %q}}]}\n\n", chunk)
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	config := DefaultProviderConfig(ProviderTypeOpenAI)
+	config.APIKey = "test-key"
+	config.Endpoint = server.URL
+
+	service := NewService()
+	if err := service.SwitchProvider(ProviderTypeOpenAI, config); err != nil {
+		t.Fatalf("SwitchProvider failed: %v", err)
+	}
+
+	var chunks []string
+	response, err := service.Ask(context.Background(), "what's the difference between tar -c and -x", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("Ask failed: %v", err)
+	}
+	if len(chunks) != 3 || response.Content != "tar -c creates an archive, -x extracts one." {
+		t.Errorf("Expected the answer in 3 chunks, got %q as %q", response.Content, chunks)
+	}
+	if len(response.Suggestions) != 0 {
+		t.Errorf("Expected no suggestions for a question, got %+v", response.Suggestions)
+	}
+	if !strings.Contains(prompt, "what's the difference between tar -c and -x") || strings.Contains(prompt, `"commands"`) {
+		t.Errorf("Expected a plain question prompt, got %q", prompt)
+	}
+
+	// Providers that cannot stream pass the answer in one piece
+	mockProvider := NewMockProvider("test", "test-model")
+	mockProvider.SetMockResponse(&CompletionResponse{Content: "It lists files."})
+	service.SetProvider(mockProvider)
+	chunks = nil
+	if _, err := service.Ask(context.Background(), "what does ls do", func(chunk string) {
+		chunks = append(chunks, chunk)
+	}); err != nil || len(chunks) != 1 || chunks[0] != "It lists files." {
+		t.Errorf("Expected the whole answer as one chunk, got %q (%v)", chunks, err)
+	}
+
+	if _, err := service.Ask(context.Background(), "  ", func(string) {}); err == nil {
+		t.Error("Expected an error for an empty question")
+	}
+	service.SetOffline(true)
+	if _, err := service.Ask(context.Background(), "what does ls do", func(string) {}); err == nil {
+		t.Error("Expected an error in offline mode")
+	}
+}
+
+// chunkedProvider streams the mock response in two pieces
+type chunkedProvider struct {
+	*MockProvider
+}
+
+func (p chunkedProvider) StreamText(ctx context.Context, req *CompletionRequest, onChunk func(string)) (*CompletionResponse, error) {
+	response, err := p.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	half := len(response.Content) / 2
+	onChunk(response.Content[:half])
+	onChunk(response.Content[half:])
+	return response, nil
+}
+
+func TestCompleteStream(t *testing.T) {
+	mockProvider := NewMockProvider("test", "test-model")
+	mockProvider.SetMockResponse(&CompletionResponse{Content: "hello world"})
+	req := &CompletionRequest{Prompt: "greet"}
+
+	// Providers that cannot stream pass the answer in one piece
+	var chunks []string
+	response, err := CompleteStream(context.Background(), mockProvider, req, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil || response.Content != "hello world" || len(chunks) != 1 {
+		t.Fatalf("Expected the answer in one chunk, got %q (%v)", chunks, err)
+	}
+
+	chunks = nil
+	response, err = CompleteStream(context.Background(), chunkedProvider{mockProvider}, req, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil || response.Content != "hello world" || strings.Join(chunks, "|") != "hello| world" {
+		t.Errorf("Expected the answer streamed in two chunks, got %q (%v)", chunks, err)
+	}
+
+	// Without a callback nothing is streamed
+	if response, err := CompleteStream(context.Background(), chunkedProvider{mockProvider}, req, nil); err != nil || response.Content != "hello world" {
+		t.Errorf("Expected a plain completion, got %+v (%v)", response, err)
+	}
+}
+
+func TestErrorCauses(t *testing.T) {
+	statuses := []struct {
+		status int
+		cause  error
+	}{
+		{401, ErrAPIKeyInvalid},
+		{429, ErrRateLimitExceeded},
+		{503, ErrProviderNotAvailable},
+	}
+
+	for _, tt := range statuses {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(tt.status)
+			w.Write([]byte(`{"error": {"message": "failed", "type": "error"}}`))
+		}))
+
+		for _, providerType := range []ProviderType{ProviderTypeOpenAI, ProviderTypeOpenRouter} {
+			service := NewService().SetCircuitBreaker(0, 0)
+			config := DefaultProviderConfig(providerType)
+			config.APIKey = "test-key"
+			config.Endpoint = server.URL
+			if err := service.SwitchProvider(providerType, config); err != nil {
+				t.Fatalf("SwitchProvider(%s) failed: %v", providerType, err)
+			}
+
+			// The cause survives the wrapping of the service layer
+			_, err := service.SuggestCommands(context.Background(), "list files")
+			if !errors.Is(err, tt.cause) {
+				t.Errorf("%s with status %d: expected %v, got %v", providerType, tt.status, tt.cause, err)
+			}
+			if tt.cause != ErrAPIKeyInvalid && errors.Is(err, ErrAPIKeyMissing) {
+				t.Errorf("%s with status %d: unexpected missing API key", providerType, tt.status)
+			}
+		}
+		server.Close()
+	}
+
+	// Nothing listens on a closed server's address
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	for _, providerType := range []ProviderType{ProviderTypeOpenAI, ProviderTypeOllama} {
+		service := NewService()
+		config := DefaultProviderConfig(providerType)
+		config.APIKey = "test-key"
+		config.Endpoint = server.URL
+		if err := service.SwitchProvider(providerType, config); err != nil {
+			t.Fatalf("SwitchProvider(%s) failed: %v", providerType, err)
+		}
+		if _, err := service.SuggestCommands(context.Background(), "list files"); !errors.Is(err, ErrConnectionRefused) {
+			t.Errorf("%s: expected a refused connection, got %v", providerType, err)
+		}
+	}
+
+	transport := []struct {
+		err   error
+		cause error
+	}{
+		{context.DeadlineExceeded, ErrTimeout},
+		{&net.DNSError{Err: "no such host", Name: "api.example.invalid", IsNotFound: true}, ErrHostNotFound},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, ErrConnectionRefused},
+	}
+	for _, tt := range transport {
+		if err := transportError("OpenAI", tt.err); !errors.Is(err, tt.cause) {
+			t.Errorf("transportError(%v) = %v, expected %v", tt.err, err, tt.cause)
+		}
+	}
+	if err := transportError("OpenAI", errors.New("boom")); err != nil {
+		t.Errorf("Expected no cause for an unknown error, got %v", err)
+	}
+
+	// A service without a provider has no API key to use
+	if _, err := NewService().SuggestCommands(context.Background(), "list files"); !errors.Is(err, ErrAPIKeyMissing) {
+		t.Errorf("Expected a missing API key without a provider, got %v", err)
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	if got := EstimateTokens("list all files"); got != 4 {
+		t.Errorf("EstimateTokens = %d, expected 4", got)
+	}
+
+	service := NewService()
+	for model, expected := range map[string]int{
+		"gpt-4":         8192,
+		"gpt-4-turbo-1": 128000,
+		"llama2:13b":    4096,
+		"unknown-model": 0,
+	} {
+		if got := service.ContextWindow(model); got != expected {
+			t.Errorf("ContextWindow(%q) = %d, expected %d", model, got, expected)
+		}
+	}
+
+	// Context lengths reported by the provider win over the known ones
+	service.rememberContextWindows([]ModelInfo{{ID: "gpt-4", ContextSize: 32768}, {ID: "tiny-model", ContextSize: 200}})
+	if got := service.ContextWindow("gpt-4"); got != 32768 {
+		t.Errorf("Expected the reported context length, got %d", got)
+	}
+
+	// A request that does not fit is refused before it is sent
+	provider := &countingProvider{MockProvider: NewMockProvider("mock", "tiny-model")}
+	provider.SetMockResponse(&CompletionResponse{Suggestions: []CommandSuggestion{{Command: "ls -la", Confidence: 0.9}}})
+	service.SetProvider(provider).SetMaxTokens(100)
+
+	_, err := service.SuggestCommands(context.Background(), "list all files")
+	if !errors.Is(err, ErrContextTooLong) || provider.calls != 0 {
+		t.Fatalf("Expected ErrContextTooLong without a request, got %v after %d calls", err, provider.calls)
+	}
+
+	// The trimmed prompt fits
+	response, err := service.SuggestCommandsTrimmed(context.Background(), "list all files")
+	if err != nil || provider.calls != 1 {
+		t.Fatalf("Expected the trimmed request to be sent, got %v after %d calls", err, provider.calls)
+	}
+	if estimate := response.Estimate; estimate == nil || estimate.ContextWindow != 200 || estimate.ResponseTokens != 100 || estimate.Exceeds() {
+		t.Errorf("Unexpected estimate %+v", response.Estimate)
+	}
+}
+
+func TestRecommendModel(t *testing.T) {
+	models := []ModelInfo{
+		{ID: "z-ai/glm-4.5-air:free", ContextSize: 128000},
+		{ID: "meta/llama-3:free", ContextSize: 128000},
+		{ID: "tiny/model", Price: 0.0001, ContextSize: 4096},
+		{ID: "big/model", Price: 0.02, ContextSize: 200000},
+		{ID: "mid/model", Price: 0.001, ContextSize: 128000},
+		{ID: "openrouter/auto", ContextSize: 200000},
+	}
+
+	if !IsFreeModel("z-ai/glm-4.5-air:free") || IsFreeModel("z-ai/glm-4.5-air") {
+		t.Error("Expected only :free models to be free")
+	}
+
+	// The cheapest paid model with enough context
+	if model, ok := RecommendModel("z-ai/glm-4.5-air:free", models); !ok || model.ID != "mid/model" {
+		t.Errorf("Expected mid/model, got %q, %v", model.ID, ok)
+	}
+
+	// The paid variant of the same model comes first
+	paid := append(models, ModelInfo{ID: "z-ai/glm-4.5-air", Price: 0.005, ContextSize: 128000})
+	if model, ok := RecommendModel("z-ai/glm-4.5-air:free", paid); !ok || model.ID != "z-ai/glm-4.5-air" {
+		t.Errorf("Expected the paid variant, got %q, %v", model.ID, ok)
+	}
+
+	// Models without prices give no recommendation
+	if _, ok := RecommendModel("z-ai/glm-4.5-air:free", models[:2]); ok {
+		t.Error("Expected no recommendation without paid models")
+	}
+}
+
+func TestSessionBudget(t *testing.T) {
+	ctx := context.Background()
+	provider := &countingProvider{MockProvider: NewMockProvider("mock", "gpt-4")}
+	provider.SetMockResponse(&CompletionResponse{
+		Content:     `{"commands": [{"cmd": "ls", "safe": true}]}`,
+		Suggestions: []CommandSuggestion{{Command: "ls", Safe: true, Confidence: 0.9}},
+		Usage:       &UsageInfo{PromptTokens: 10000, CompletionTokens: 5000, TotalTokens: 15000},
+	})
+	service := NewService().SetProvider(provider).SetFallbackMode(true).SetBudget(0.5)
+
+	if _, err := service.SuggestCommands(ctx, "list files"); err != nil {
+		t.Fatalf("Expected the first request within the budget, got %v", err)
+	}
+	if spent := service.Spent(); spent < 0.599 || spent > 0.601 {
+		t.Errorf("Expected 10k prompt and 5k completion tokens of gpt-4 to cost $0.60, got %s", FormatCost(spent))
+	}
+
+	// Rule-based suggestions would hide why
+	_, err := service.SuggestCommands(ctx, "list more files")
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Expected the spent budget to refuse the request, got %v", err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("Expected the refused request not to reach the provider, got %d calls", provider.calls)
+	}
+	if info := service.GetProviderInfo(); info["budget"] != "$0.60 of $0.50 spent" {
+		t.Errorf("Expected the spending in the provider info, got %v", info["budget"])
+	}
+
+	service.SetBudget(0)
+	if _, err := service.SuggestCommands(ctx, "list more files"); err != nil {
+		t.Errorf("Expected no limit once the budget is removed, got %v", err)
+	}
+
+	// Free models are never refused, listed prices beat the known ones
+	free := NewService().SetProvider(NewMockProvider("mock", "llama-3:free")).SetBudget(0.01)
+	free.spent = 1
+	if _, err := free.SuggestCommands(ctx, "list files"); err != nil {
+		t.Errorf("Expected a free model to be used past the budget, got %v", err)
+	}
+	service.rememberPrices([]ModelInfo{{ID: "gpt-4", PromptPrice: 0.001, CompletionPrice: 0.002}})
+	if price, ok := service.ModelPrice("gpt-4"); !ok || price.Prompt != 0.001 {
+		t.Errorf("Expected the listed price of gpt-4, got %+v", price)
+	}
+	if _, ok := service.ModelPrice("some-unknown-model"); ok {
+		t.Error("Expected the price of an unknown model to be unknown")
+	}
+	if price, ok := service.ModelPrice("openai/gpt-3.5-turbo"); !ok || price != knownPrices["gpt-3.5-turbo"] {
+		t.Errorf("Expected the known price behind the vendor prefix, got %+v, %v", price, ok)
+	}
+
+	// A model whose price is unknown could run past the budget unnoticed,
+	// unless the provider lists it
+	unknown := NewService().SetProvider(NewMockProvider("mock", "vendor/some-model")).SetBudget(1)
+	if _, err := unknown.SuggestCommands(ctx, "list files"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected a model without price to be refused under a budget, got %v", err)
+	}
+	listing := &listingProvider{
+		MockProvider: NewMockProvider("mock", "vendor/some-model"),
+		models:       []ModelInfo{{ID: "vendor/some-model", PromptPrice: 0.00001, CompletionPrice: 0.00002}},
+	}
+	listing.SetMockResponse(&CompletionResponse{
+		Suggestions: []CommandSuggestion{{Command: "ls", Safe: true, Confidence: 0.9}},
+		Usage:       &UsageInfo{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500},
+	})
+	listed := NewService().SetProvider(listing).SetBudget(1)
+	if _, err := listed.SuggestCommands(ctx, "list files"); err != nil {
+		t.Fatalf("Expected the listed price to be used, got %v", err)
+	}
+	if spent := listed.Spent(); spent < 0.0199 || spent > 0.0201 {
+		t.Errorf("Expected the request to cost $0.02, got %s", FormatCost(spent))
+	}
+
+	models := []ModelInfo{{ID: "a/big:free", ContextSize: 128000}, {ID: "b/model"}, {ID: "b/model:free", ContextSize: 8000}}
+	if model, ok := RecommendFreeModel("b/model", models); !ok || model.ID != "b/model:free" {
+		t.Errorf("Expected the free variant of the model, got %v", model.ID)
+	}
+	if model, ok := RecommendFreeModel("c/model", models); !ok || model.ID != "a/big:free" {
+		t.Errorf("Expected the free model with the largest context, got %v", model.ID)
+	}
+}
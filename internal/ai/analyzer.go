@@ -72,6 +72,13 @@ func parseAnalysisCommand(command string) AnalysisRequest {
 
 // AnalyzeData performs data analysis using AI
 func (s *Service) AnalyzeData(ctx context.Context, inputData, analysisCommand string) (*AnalysisResponse, error) {
+	return s.StreamAnalysis(ctx, inputData, analysisCommand, nil)
+}
+
+// StreamAnalysis analyzes data like AnalyzeData, passing the result to
+// onChunk as it arrives; providers that cannot stream pass it in one piece.
+// Cancelling ctx stops the analysis.
+func (s *Service) StreamAnalysis(ctx context.Context, inputData, analysisCommand string, onChunk func(string)) (*AnalysisResponse, error) {
 	if s.provider == nil {
 		return nil, fmt.Errorf("no LLM provider configured")
 	}
@@ -80,6 +87,10 @@ func (s *Service) AnalyzeData(ctx context.Context, inputData, analysisCommand st
 		return nil, fmt.Errorf("LLM provider is not properly configured")
 	}
 
+	if strings.TrimSpace(inputData) == "" {
+		return nil, NewAIError(ErrorTypeValidation, "no data to analyze", nil)
+	}
+
 	// Parse the analysis command
 	request := parseAnalysisCommand(analysisCommand)
 	request.InputData = inputData
@@ -101,8 +112,10 @@ func (s *Service) AnalyzeData(ctx context.Context, inputData, analysisCommand st
 		Temperature: 0.1,  // Lower temperature for more consistent analysis
 	}
 
-	// Call LLM provider
-	response, err := s.provider.Complete(ctx, completionReq)
+	// Call LLM provider, streaming if asked to
+	response, err := s.guard(completionReq, func() (*CompletionResponse, error) {
+		return CompleteStream(ctx, s.provider, completionReq, onChunk)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get analysis from LLM: %w", err)
 	}
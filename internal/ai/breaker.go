@@ -0,0 +1,175 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultBreakerThreshold is the number of consecutive failures opening the circuit of a provider
+	DefaultBreakerThreshold = 3
+
+	// DefaultBreakerCooldown is how long requests to a provider with an open circuit fail fast
+	DefaultBreakerCooldown = time.Minute
+)
+
+// BreakerState is the state of the circuit breaker of a provider
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // Requests go to the provider
+	BreakerOpen     BreakerState = "open"      // Requests fail fast until the cooldown ends
+	BreakerHalfOpen BreakerState = "half-open" // The next request tests whether the provider recovered
+)
+
+// circuitBreaker counts consecutive failures of a provider. Once they reach
+// the threshold the circuit opens and requests fail fast for the cooldown;
+// after it the circuit is half-open and one request decides whether it
+// closes again or reopens.
+type circuitBreaker struct {
+	failures int
+	openedAt time.Time
+	open     bool
+}
+
+// state returns the state of the breaker at now
+func (b *circuitBreaker) state(now time.Time, cooldown time.Duration) BreakerState {
+	switch {
+	case !b.open:
+		return BreakerClosed
+	case now.Sub(b.openedAt) < cooldown:
+		return BreakerOpen
+	default:
+		return BreakerHalfOpen
+	}
+}
+
+// record counts the result of a request; err is nil on success
+func (b *circuitBreaker) record(err error, now time.Time, threshold int) {
+	if err == nil {
+		b.failures = 0
+		b.open = false
+		return
+	}
+
+	b.failures++
+	// A failed test of a half-open circuit reopens it right away
+	if b.open || b.failures >= threshold {
+		b.open = true
+		b.openedAt = now
+	}
+}
+
+// countsAsProviderFailure reports whether err says the provider is degraded,
+// like a timeout or server error, rather than a problem with the request,
+// the API key or the response content
+func countsAsProviderFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var aiErr *AIError
+	if errors.As(err, &aiErr) {
+		switch aiErr.Type {
+		case ErrorTypeAuth, ErrorTypeValidation, ErrorTypeParsing, ErrorTypeTruncated:
+			return false
+		}
+	}
+	return true
+}
+
+// SetCircuitBreaker sets after how many consecutive failures requests to a
+// provider fail fast, and for how long. A threshold of 0 disables the breaker.
+func (s *Service) SetCircuitBreaker(threshold int, cooldown time.Duration) *Service {
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+
+	s.breakerThreshold = threshold
+	s.breakerCooldown = cooldown
+	return s
+}
+
+// BreakerStatus returns the circuit breaker state of the current provider,
+// the consecutive failures and, if the circuit is open, when requests are tried again
+func (s *Service) BreakerStatus() (BreakerState, int, time.Duration) {
+	if s.provider == nil {
+		return BreakerClosed, 0, 0
+	}
+
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+
+	breaker, ok := s.breakers[s.provider.GetName()]
+	if !ok {
+		return BreakerClosed, 0, 0
+	}
+	now := time.Now()
+	state := breaker.state(now, s.breakerCooldown)
+	if state == BreakerOpen {
+		return state, breaker.failures, s.breakerCooldown - now.Sub(breaker.openedAt)
+	}
+	return state, breaker.failures, 0
+}
+
+// complete sends req to the current provider through its circuit breaker
+func (s *Service) complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	return s.guard(req, func() (*CompletionResponse, error) {
+		return s.provider.Complete(ctx, req)
+	})
+}
+
+// guard runs call, sending req to the current provider, through its circuit
+// breaker, and counts its cost against the budget of the session
+func (s *Service) guard(req *CompletionRequest, call func() (*CompletionResponse, error)) (*CompletionResponse, error) {
+	name := s.provider.GetName()
+	if err := s.checkBudget(); err != nil {
+		return nil, err
+	}
+
+	s.breakerMu.Lock()
+	breaker := s.breakers[name]
+	if breaker != nil && s.breakerThreshold > 0 && breaker.state(time.Now(), s.breakerCooldown) == BreakerOpen {
+		retryIn := s.breakerCooldown - time.Since(breaker.openedAt)
+		s.breakerMu.Unlock()
+		return nil, NewAIError(ErrorTypeUnavailable,
+			fmt.Sprintf("%s failed %d times in a row, skipping it for %s", name, breaker.failures, retryIn.Round(time.Second)), nil)
+	}
+	s.breakerMu.Unlock()
+
+	response, err := call()
+	if err == nil {
+		s.recordCost(req, response)
+	}
+	if err != nil && !countsAsProviderFailure(err) {
+		return response, err
+	}
+
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+	if s.breakerThreshold <= 0 {
+		return response, err
+	}
+	if breaker == nil {
+		breaker = &circuitBreaker{}
+		s.breakers[name] = breaker
+	}
+	wasOpen := breaker.open
+	breaker.record(err, time.Now(), s.breakerThreshold)
+	switch {
+	case breaker.open && !wasOpen:
+		log.Printf("Circuit opened for %s after %d failures", name, breaker.failures)
+	case !breaker.open && wasOpen:
+		log.Printf("Circuit closed for %s, the provider recovered", name)
+	}
+	return response, err
+}
+
+// resetBreaker forgets the failures of provider, e.g. after its configuration changed
+func (s *Service) resetBreaker(provider string) {
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+	delete(s.breakers, provider)
+}
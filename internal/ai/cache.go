@@ -0,0 +1,203 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// DefaultCacheTTL is how long cached suggestions are served before they are refreshed
+const DefaultCacheTTL = 7 * 24 * time.Hour
+
+// CacheKey identifies a cached suggestion response
+type CacheKey struct {
+	OS       string `json:"os"`
+	Shell    string `json:"shell"`
+	Request  string `json:"request"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Prompt   string `json:"prompt"` // Hash of the prompt and sampling settings
+}
+
+// NewCacheKey builds a cache key for request on the current OS and shell,
+// sent as req. Besides the request, the prompt carries the directory
+// listing, earlier exchanges and templates, so the key covers all of req;
+// the request is normalized in the prompt as well, so it matches regardless
+// of case and spacing.
+func NewCacheKey(request, provider, model string, req *CompletionRequest) CacheKey {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	if shell == "." || shell == string(filepath.Separator) {
+		shell = ""
+	}
+
+	normalized := strings.ToLower(strings.Join(strings.Fields(request), " "))
+	prompt := req.Prompt
+	if request != "" {
+		prompt = strings.ReplaceAll(prompt, request, normalized)
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%g\x00%d\x00%d", prompt, req.Temperature, req.Choices, req.MaxTokens)))
+
+	return CacheKey{
+		OS:       runtime.GOOS,
+		Shell:    shell,
+		Request:  normalized,
+		Provider: provider,
+		Model:    model,
+		Prompt:   hex.EncodeToString(sum[:]),
+	}
+}
+
+// fileName returns the name of the cache file holding the entry for the key
+func (k CacheKey) fileName() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{k.OS, k.Shell, k.Request, k.Provider, k.Model, k.Prompt}, "\x00")))
+	return hex.EncodeToString(sum[:16]) + ".json"
+}
+
+// cacheEntry is the on-disk form of a cached response
+type cacheEntry struct {
+	Key       CacheKey           `json:"key"`
+	CreatedAt time.Time          `json:"created_at"`
+	Response  CompletionResponse `json:"response"`
+}
+
+// SuggestionCache persists suggestion responses across sessions, one JSON file per key
+type SuggestionCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSuggestionCache creates a cache in the clia config directory
+func NewSuggestionCache() (*SuggestionCache, error) {
+	configDir, err := utils.GetConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return NewSuggestionCacheAt(filepath.Join(configDir, "cache")), nil
+}
+
+// NewSuggestionCacheAt creates a cache stored in dir
+func NewSuggestionCacheAt(dir string) *SuggestionCache {
+	return &SuggestionCache{
+		dir: dir,
+		ttl: DefaultCacheTTL,
+		now: time.Now,
+	}
+}
+
+// SetTTL sets how long entries stay fresh
+func (c *SuggestionCache) SetTTL(ttl time.Duration) *SuggestionCache {
+	c.ttl = ttl
+	return c
+}
+
+// GetDir returns the cache directory
+func (c *SuggestionCache) GetDir() string {
+	return c.dir
+}
+
+// Get returns the cached response for key if it exists and has not expired
+func (c *SuggestionCache) Get(key CacheKey) (*CompletionResponse, bool) {
+	entry, err := c.readEntry(filepath.Join(c.dir, key.fileName()))
+	if err != nil || entry.Key != key || c.isExpired(entry) {
+		return nil, false
+	}
+
+	response := entry.Response
+	return &response, true
+}
+
+// Put stores response under key
+func (c *SuggestionCache) Put(key CacheKey, response *CompletionResponse) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	data, err := json.Marshal(cacheEntry{
+		Key:       key,
+		CreatedAt: c.now(),
+		Response:  *response,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	// Write to a temporary file first so readers never see a partial entry
+	path := filepath.Join(c.dir, key.fileName())
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// Prune removes expired and unreadable entries and returns how many were removed
+func (c *SuggestionCache) Prune() (int, error) {
+	return c.removeEntries(func(entry *cacheEntry, err error) bool {
+		return err != nil || c.isExpired(entry)
+	})
+}
+
+// Clear removes all entries and returns how many were removed
+func (c *SuggestionCache) Clear() (int, error) {
+	return c.removeEntries(func(*cacheEntry, error) bool {
+		return true
+	})
+}
+
+// Count returns the number of entries in the cache
+func (c *SuggestionCache) Count() int {
+	files, _ := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	return len(files)
+}
+
+// removeEntries removes the entries selected by remove
+func (c *SuggestionCache) removeEntries(remove func(*cacheEntry, error) bool) (int, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list cache entries: %w", err)
+	}
+
+	removed := 0
+	for _, path := range files {
+		if !remove(c.readEntry(path)) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// readEntry reads a cache entry file
+func (c *SuggestionCache) readEntry(path string) (*cacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse cache entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// isExpired reports whether entry is older than the TTL
+func (c *SuggestionCache) isExpired(entry *cacheEntry) bool {
+	return c.ttl > 0 && c.now().Sub(entry.CreatedAt) > c.ttl
+}
@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// choiceResult is what the choices of a chat completion add up to
+type choiceResult struct {
+	content     string              // Content of the first choice
+	suggestions []CommandSuggestion // Suggestions of all choices, in order
+	truncated   bool                // Every choice stopped at the max_tokens limit
+	unparsed    bool                // No choice was suggestion JSON; the contents are used as commands as is
+}
+
+// flattenChoices parses every choice of a chat completion with parse and
+// flattens their suggestions into one list; duplicates across choices are left
+// for the ranking to drop. The contents of choices that are not suggestion JSON
+// are only used as plain commands if no choice is, and those cut off by the
+// token limit never are.
+func flattenChoices(choices []openai.ChatCompletionChoice, parse func(string) ([]CommandSuggestion, error)) choiceResult {
+	result := choiceResult{content: choices[0].Message.Content, truncated: true}
+
+	var plain []CommandSuggestion
+	parsed := false
+	for _, choice := range choices {
+		content := choice.Message.Content
+		truncated := choice.FinishReason == openai.FinishReasonLength
+		if !truncated {
+			result.truncated = false
+		}
+
+		suggestions, err := parse(content)
+		if err == nil {
+			parsed = true
+			result.suggestions = append(result.suggestions, suggestions...)
+			continue
+		}
+		if truncated {
+			// Half a JSON document is not a command
+			continue
+		}
+		plain = append(plain, CommandSuggestion{
+			Command:     strings.TrimSpace(content),
+			Description: "AI suggested command",
+			Confidence:  0.8,
+			Safe:        utils.IsCommandSafe(content),
+			Category:    "general",
+		})
+	}
+
+	if !parsed && len(plain) > 0 {
+		result.suggestions = plain
+		result.unparsed = true
+	}
+	return result
+}
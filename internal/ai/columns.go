@@ -0,0 +1,133 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseSelectCommand returns the column spec of a "select <columns>" analysis command
+func ParseSelectCommand(command string) (string, bool) {
+	fields := strings.Fields(command)
+	if len(fields) < 2 || strings.ToLower(fields[0]) != "select" {
+		return "", false
+	}
+	return strings.Join(fields[1:], " "), true
+}
+
+// ExtractColumnsFlag removes a --columns=<spec> (or --columns <spec>) flag from an
+// analysis command and returns the remaining command and the column spec
+func ExtractColumnsFlag(command string) (string, string) {
+	var remaining []string
+	spec := ""
+
+	fields := strings.Fields(command)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		switch {
+		case field == "--columns" && i+1 < len(fields):
+			spec = fields[i+1]
+			i++
+		case strings.HasPrefix(field, "--columns="):
+			spec = strings.TrimPrefix(field, "--columns=")
+		default:
+			remaining = append(remaining, field)
+		}
+	}
+
+	return strings.Join(remaining, " "), spec
+}
+
+// SelectColumns projects CSV (or TSV) data onto the columns in spec, a comma-separated
+// list of 1-based column numbers or header names. The header row is kept.
+func SelectColumns(data, spec string) (string, error) {
+	delimiter := detectDelimiter(data)
+
+	reader := csv.NewReader(strings.NewReader(strings.TrimSpace(data)))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1 // Tolerate ragged rows
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse CSV input: %w", err)
+	}
+	if len(records) == 0 {
+		return "", fmt.Errorf("no CSV data to select columns from")
+	}
+
+	indexes, err := resolveColumns(records[0], spec)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = delimiter
+
+	for _, record := range records {
+		projected := make([]string, len(indexes))
+		for i, index := range indexes {
+			if index < len(record) {
+				projected[i] = record[index]
+			}
+		}
+		if err := writer.Write(projected); err != nil {
+			return "", fmt.Errorf("failed to write CSV output: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("failed to write CSV output: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// resolveColumns maps column selectors to 0-based indexes using the header row
+func resolveColumns(header []string, spec string) ([]int, error) {
+	var indexes []int
+
+	for _, selector := range strings.Split(spec, ",") {
+		selector = strings.TrimSpace(selector)
+		if selector == "" {
+			continue
+		}
+
+		if number, err := strconv.Atoi(selector); err == nil {
+			if number < 1 || number > len(header) {
+				return nil, fmt.Errorf("column %d out of range (input has %d columns)", number, len(header))
+			}
+			indexes = append(indexes, number-1)
+			continue
+		}
+
+		index := -1
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), selector) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", selector, strings.Join(header, ", "))
+		}
+		indexes = append(indexes, index)
+	}
+
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("no columns selected")
+	}
+	return indexes, nil
+}
+
+// detectDelimiter returns a tab for TSV input and a comma otherwise
+func detectDelimiter(data string) rune {
+	firstLine := strings.SplitN(strings.TrimSpace(data), "\n", 2)[0]
+	if strings.Contains(firstLine, "\t") && !strings.Contains(firstLine, ",") {
+		return '\t'
+	}
+	return ','
+}
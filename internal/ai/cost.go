@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// TokenPrice is what a model charges, in dollars per token
+type TokenPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Free reports whether requests to the model cost nothing
+func (p TokenPrice) Free() bool {
+	return p.Prompt <= 0 && p.Completion <= 0
+}
+
+// Cost returns the price of a request of the given size
+func (p TokenPrice) Cost(promptTokens, completionTokens int) float64 {
+	return float64(promptTokens)*p.Prompt + float64(completionTokens)*p.Completion
+}
+
+// perMillion converts prices in dollars per million tokens
+func perMillion(prompt, completion float64) TokenPrice {
+	return TokenPrice{Prompt: prompt / 1e6, Completion: completion / 1e6}
+}
+
+// knownPrices lists the prices of common models by ID prefix, for providers
+// that do not report them. Longer prefixes win.
+var knownPrices = map[string]TokenPrice{
+	"gpt-3.5-turbo":   perMillion(0.5, 1.5),
+	"gpt-4":           perMillion(30, 60),
+	"gpt-4-turbo":     perMillion(10, 30),
+	"gpt-4o":          perMillion(2.5, 10),
+	"gpt-4o-mini":     perMillion(0.15, 0.6),
+	"gpt-4.1":         perMillion(2, 8),
+	"gpt-4.1-mini":    perMillion(0.4, 1.6),
+	"claude-3-haiku":  perMillion(0.25, 1.25),
+	"claude-3-sonnet": perMillion(3, 15),
+	"claude-3-opus":   perMillion(15, 75),
+}
+
+// ModelPrice returns the price of model on the current provider: nothing for
+// local models and free variants, as reported when models were listed, or
+// from the known models, also behind a vendor prefix like the openai/ of
+// OpenRouter. It reports false if the price is unknown.
+func (s *Service) ModelPrice(model string) (TokenPrice, bool) {
+	if s.GetCurrentProviderType() == ProviderTypeOllama || IsFreeModel(model) {
+		return TokenPrice{}, true
+	}
+
+	s.costMu.Lock()
+	price, ok := s.prices[model]
+	s.costMu.Unlock()
+	if ok {
+		return price, true
+	}
+
+	name := model[strings.LastIndex(model, "/")+1:]
+	best := ""
+	for prefix, known := range knownPrices {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best, price = prefix, known
+		}
+	}
+	return price, best != ""
+}
+
+// rememberPrices keeps the prices of listed models
+func (s *Service) rememberPrices(models []ModelInfo) {
+	s.costMu.Lock()
+	defer s.costMu.Unlock()
+
+	if s.prices == nil {
+		s.prices = make(map[string]TokenPrice)
+	}
+	for _, model := range models {
+		if model.PromptPrice > 0 || model.CompletionPrice > 0 {
+			s.prices[model.ID] = TokenPrice{Prompt: model.PromptPrice, Completion: model.CompletionPrice}
+		}
+	}
+}
+
+// SetBudget sets the most the requests of the session may cost, in dollars;
+// 0 sets no limit. Once it is spent, only free and local models are used.
+func (s *Service) SetBudget(dollars float64) *Service {
+	s.costMu.Lock()
+	defer s.costMu.Unlock()
+	s.budget = max(dollars, 0)
+	return s
+}
+
+// Budget returns the most the requests of the session may cost; 0 if unlimited
+func (s *Service) Budget() float64 {
+	s.costMu.Lock()
+	defer s.costMu.Unlock()
+	return s.budget
+}
+
+// Spent returns the estimated cost of the requests of the session so far
+func (s *Service) Spent() float64 {
+	s.costMu.Lock()
+	defer s.costMu.Unlock()
+	return s.spent
+}
+
+// checkBudget refuses a request to a paid model once the budget of the
+// session is spent. Under a budget, a model whose price is unknown, even
+// after listing the models of the provider, is refused, as its cost could
+// not be counted.
+func (s *Service) checkBudget() error {
+	s.costMu.Lock()
+	budget, spent := s.budget, s.spent
+	s.costMu.Unlock()
+	if budget <= 0 {
+		return nil
+	}
+
+	model := s.provider.GetModel()
+	price, ok := s.ModelPrice(model)
+	if !ok && s.listPrices() {
+		price, ok = s.ModelPrice(model)
+	}
+	if !ok {
+		return NewAIError(ErrorTypeBudget,
+			fmt.Sprintf("the price of %s is unknown, so the session budget of %s cannot be kept; use a model with a known price or remove the budget", model, FormatCost(budget)), nil)
+	}
+	if spent < budget || price.Free() {
+		return nil
+	}
+	return NewAIError(ErrorTypeBudget,
+		fmt.Sprintf("session budget of %s spent (%s), %s is a paid model", FormatCost(budget), FormatCost(spent), model), nil)
+}
+
+// listPrices lists the models of the current provider for their prices,
+// once per provider. It reports whether it listed them now.
+func (s *Service) listPrices() bool {
+	name := s.provider.GetName()
+	s.costMu.Lock()
+	listed := s.pricesListed[name]
+	if s.pricesListed == nil {
+		s.pricesListed = make(map[string]bool)
+	}
+	s.pricesListed[name] = true
+	s.costMu.Unlock()
+	if listed {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerProbeTimeout)
+	defer cancel()
+	_, err := s.GetAvailableModels(ctx)
+	return err == nil
+}
+
+// recordCost adds the cost of a request to the spending of the session. The
+// tokens reported by the provider are used, or estimated from the text.
+func (s *Service) recordCost(req *CompletionRequest, response *CompletionResponse) {
+	price, ok := s.ModelPrice(s.provider.GetModel())
+	if !ok || price.Free() {
+		return
+	}
+
+	promptTokens, completionTokens := EstimateTokens(req.Prompt), EstimateTokens(response.Content)
+	if response.Usage != nil && response.Usage.TotalTokens > 0 {
+		promptTokens, completionTokens = response.Usage.PromptTokens, response.Usage.CompletionTokens
+	}
+
+	s.costMu.Lock()
+	defer s.costMu.Unlock()
+	s.spent += price.Cost(promptTokens, completionTokens)
+}
+
+// FormatCost formats dollars, with more digits for amounts below a cent,
+// e.g. "$0.50" or "$0.0012"
+func FormatCost(dollars float64) string {
+	if dollars > 0 && dollars < 0.01 {
+		return fmt.Sprintf("$%.4f", dollars)
+	}
+	return fmt.Sprintf("$%.2f", dollars)
+}
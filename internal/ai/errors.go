@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Causes of failed requests, matched with errors.Is against the errors of
+// the providers and the service, e.g. errors.Is(err, ErrRateLimitExceeded)
+var (
+	ErrAPIKeyMissing        = errors.New("API key missing")
+	ErrAPIKeyInvalid        = errors.New("API key rejected")
+	ErrTimeout              = errors.New("request timed out")
+	ErrRateLimitExceeded    = errors.New("rate limit exceeded")
+	ErrProviderNotAvailable = errors.New("provider not available")
+	ErrHostNotFound         = errors.New("host not found")
+	ErrConnectionRefused    = errors.New("connection refused")
+	ErrContextTooLong       = errors.New("prompt exceeds the context window")
+	ErrBudgetExceeded       = errors.New("session budget spent")
+)
+
+// Is reports whether target is the cause of the error. An auth error with an
+// HTTP status rejected the key, one without found none; server errors and
+// providers skipped by the circuit breaker are not available.
+func (e *AIError) Is(target error) bool {
+	switch target {
+	case ErrAPIKeyMissing:
+		return e.Type == ErrorTypeAuth && e.Code == 0
+	case ErrAPIKeyInvalid:
+		return e.Type == ErrorTypeAuth && e.Code != 0
+	case ErrTimeout:
+		return e.Type == ErrorTypeTimeout
+	case ErrRateLimitExceeded:
+		return e.Type == ErrorTypeRateLimit
+	case ErrProviderNotAvailable:
+		return e.Type == ErrorTypeUnavailable || e.Code >= 500
+	case ErrContextTooLong:
+		return e.Type == ErrorTypeContextLength
+	case ErrBudgetExceeded:
+		return e.Type == ErrorTypeBudget
+	}
+	return false
+}
+
+// WithCode sets the HTTP status code of the response that failed
+func (e *AIError) WithCode(code int) *AIError {
+	e.Code = code
+	return e
+}
+
+// httpStatus returns the HTTP status code of a failed OpenAI-compatible
+// request, or false if no response arrived
+func httpStatus(err error) (int, bool) {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode > 0 {
+		return apiErr.HTTPStatusCode, true
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) && requestErr.HTTPStatusCode > 0 {
+		return requestErr.HTTPStatusCode, true
+	}
+	return 0, false
+}
+
+// transportError classifies an error reaching provider: timeouts, hosts that
+// do not resolve and refused connections. It returns nil for other errors.
+func transportError(provider string, err error) *AIError {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) ||
+		strings.Contains(err.Error(), "context deadline exceeded"):
+		return NewAIError(ErrorTypeTimeout, "Request timeout to "+provider, err)
+	case errors.As(err, &dnsErr) || strings.Contains(err.Error(), "no such host"):
+		return NewAIError(ErrorTypeNetwork, "Cannot resolve the host of "+provider, fmt.Errorf("%w: %w", ErrHostNotFound, err))
+	case errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(err.Error(), "connection refused") ||
+		strings.Contains(err.Error(), "actively refused"):
+		return NewAIError(ErrorTypeNetwork, provider+" refused the connection", fmt.Errorf("%w: %w", ErrConnectionRefused, err))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package ai
+
+import (
+	"net/http"
+	"os"
+)
+
+// ExpandedHeaders returns the custom request headers with environment
+// variables (e.g. ${ORG_ID}) in their values expanded
+func (c *ProviderConfig) ExpandedHeaders() map[string]string {
+	if len(c.Headers) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string, len(c.Headers))
+	for name, value := range c.Headers {
+		headers[name] = os.ExpandEnv(value)
+	}
+	return headers
+}
+
+// setHeaders adds the custom headers to req, replacing any header of the same name
+func setHeaders(req *http.Request, headers map[string]string) {
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// headerTransport adds custom headers to every request sent through it
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	setHeaders(req, t.headers)
+	return t.base.RoundTrip(req)
+}
+
+// newHTTPClient returns an HTTP client that sends the custom headers of config
+func newHTTPClient(config *ProviderConfig) *http.Client {
+	headers := config.ExpandedHeaders()
+	if len(headers) == 0 {
+		return &http.Client{}
+	}
+
+	return &http.Client{
+		Transport: &headerTransport{headers: headers, base: http.DefaultTransport},
+	}
+}
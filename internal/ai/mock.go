@@ -0,0 +1,219 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// MockProvider is a provider for tests that never leaves the process. It
+// answers with the replies queued with QueueResponse, QueueContent and
+// QueueError in order, then with the response or error set, and otherwise
+// with a single mock suggestion. Answers can be delayed, and are streamed in
+// the chunks set with SetStreamChunks.
+type MockProvider struct {
+	name       string
+	model      string
+	configured bool
+
+	mu           sync.Mutex
+	mockError    error
+	mockResponse *CompletionResponse
+	script       []mockReply
+	delay        time.Duration
+	chunks       []string
+	requests     []CompletionRequest
+}
+
+// mockReply is a scripted answer of a MockProvider
+type mockReply struct {
+	response *CompletionResponse
+	err      error
+}
+
+// NewMockProvider creates a new mock provider
+func NewMockProvider(name, model string) *MockProvider {
+	return &MockProvider{
+		name:       name,
+		model:      model,
+		configured: true,
+	}
+}
+
+// Complete implements LLMProvider
+func (m *MockProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, *req)
+	delay := m.delay
+	m.mu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, transportError(m.name, ctx.Err())
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.script) > 0 {
+		reply := m.script[0]
+		m.script = m.script[1:]
+		return reply.response, reply.err
+	}
+
+	if m.mockError != nil {
+		return nil, m.mockError
+	}
+
+	if m.mockResponse != nil {
+		return m.mockResponse, nil
+	}
+
+	// Default mock response
+	return &CompletionResponse{
+		Content: "Mock response for: " + req.Prompt,
+		Suggestions: []CommandSuggestion{
+			{
+				Command:     "echo 'mock command'",
+				Description: "Mock command suggestion",
+				Confidence:  0.9,
+				Safe:        true,
+				Category:    "test",
+			},
+		},
+		Provider: m.name,
+		Model:    m.model,
+	}, nil
+}
+
+// StreamText implements TextStreamer, passing the chunks set with
+// SetStreamChunks, or else the whole answer in one piece
+func (m *MockProvider) StreamText(ctx context.Context, req *CompletionRequest, onChunk func(string)) (*CompletionResponse, error) {
+	response, err := m.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	chunks := m.chunks
+	m.mu.Unlock()
+	if len(chunks) == 0 {
+		onChunk(response.Content)
+		return response, nil
+	}
+
+	streamed := *response
+	streamed.Content = strings.Join(chunks, "")
+	for _, chunk := range chunks {
+		if ctx.Err() != nil {
+			return nil, transportError(m.name, ctx.Err())
+		}
+		onChunk(chunk)
+	}
+	return &streamed, nil
+}
+
+// ValidateConfig implements LLMProvider
+func (m *MockProvider) ValidateConfig() error {
+	if !m.configured {
+		return fmt.Errorf("mock provider not configured")
+	}
+	return nil
+}
+
+// GetName implements LLMProvider
+func (m *MockProvider) GetName() string {
+	return m.name
+}
+
+// GetModel implements LLMProvider
+func (m *MockProvider) GetModel() string {
+	return m.model
+}
+
+// IsConfigured implements LLMProvider
+func (m *MockProvider) IsConfigured() bool {
+	return m.configured
+}
+
+// SetConfigured sets whether the provider reports being configured
+func (m *MockProvider) SetConfigured(configured bool) {
+	m.configured = configured
+}
+
+// SetMockError sets an error to be returned by Complete
+func (m *MockProvider) SetMockError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mockError = err
+}
+
+// SetMockResponse sets a response to be returned by Complete
+func (m *MockProvider) SetMockResponse(resp *CompletionResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mockResponse = resp
+}
+
+// QueueResponse adds resp to the answers given before the one set
+func (m *MockProvider) QueueResponse(resp *CompletionResponse) *MockProvider {
+	return m.queue(mockReply{response: resp})
+}
+
+// QueueError adds a failed request to the answers given before the one set
+func (m *MockProvider) QueueError(err error) *MockProvider {
+	return m.queue(mockReply{err: err})
+}
+
+// QueueContent adds the answer of a model that wrote content, parsed into
+// suggestions as the OpenAI provider does, to the answers given before the
+// one set
+func (m *MockProvider) QueueContent(content string) *MockProvider {
+	choices := []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: content}}}
+	result := flattenChoices(choices, (&OpenAIProvider{}).parseCommandSuggestions)
+	return m.QueueResponse(&CompletionResponse{
+		Content:     result.content,
+		Suggestions: result.suggestions,
+		Model:       m.model,
+		Provider:    m.name,
+		Unparsed:    result.unparsed,
+	})
+}
+
+// queue adds reply to the scripted answers
+func (m *MockProvider) queue(reply mockReply) *MockProvider {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.script = append(m.script, reply)
+	return m
+}
+
+// SetDelay makes every answer take d, or until the request is cancelled
+func (m *MockProvider) SetDelay(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.delay = d
+}
+
+// SetStreamChunks sets the pieces StreamText passes; the streamed answer is
+// their concatenation
+func (m *MockProvider) SetStreamChunks(chunks ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chunks = chunks
+}
+
+// Requests returns the requests the provider received, in order
+func (m *MockProvider) Requests() []CompletionRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]CompletionRequest(nil), m.requests...)
+}
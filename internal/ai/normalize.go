@@ -0,0 +1,142 @@
+package ai
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// shortFlagsPattern matches a cluster of single-letter options like -la
+	shortFlagsPattern = regexp.MustCompile(`^-[A-Za-z]+$`)
+
+	// plainWordPattern matches words that need no quoting in a shell
+	plainWordPattern = regexp.MustCompile(`^[A-Za-z0-9_./:=,@%+-]+$`)
+)
+
+// commandWord is a shell word of a command
+type commandWord struct {
+	text   string // Original text, including quotes
+	value  string // Text with the quotes removed
+	quoted bool   // Part of the word was quoted
+	raw    bool   // The word must be kept as written, e.g. "$HOME"
+}
+
+// CanonicalCommand returns a form of command for spotting suggestions that
+// only differ in writing: whitespace is collapsed, quoting is made uniform
+// and adjacent single-letter options are merged and sorted, so `ls -la`,
+// `ls -al` and `ls  -a -l` are all "ls -al". It is not meant to be run.
+func CanonicalCommand(command string) string {
+	words := splitCommandWords(command)
+
+	var canonical []string
+	var flags []rune
+	flushFlags := func() {
+		if len(flags) == 0 {
+			return
+		}
+		sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+		var unique []rune
+		for i, flag := range flags {
+			if i == 0 || flag != flags[i-1] {
+				unique = append(unique, flag)
+			}
+		}
+		canonical = append(canonical, "-"+string(unique))
+		flags = nil
+	}
+
+	optionsEnded := false
+	for _, word := range words {
+		if !optionsEnded && !word.quoted && shortFlagsPattern.MatchString(word.value) {
+			flags = append(flags, []rune(word.value[1:])...)
+			continue
+		}
+		flushFlags()
+		if word.value == "--" {
+			optionsEnded = true
+		}
+
+		switch {
+		case word.raw, !word.quoted:
+			canonical = append(canonical, word.text)
+		case plainWordPattern.MatchString(word.value):
+			canonical = append(canonical, word.value)
+		default:
+			canonical = append(canonical, "'"+word.value+"'")
+		}
+	}
+	flushFlags()
+
+	return strings.Join(canonical, " ")
+}
+
+// splitCommandWords splits command into shell words, keeping quoted text together
+func splitCommandWords(command string) []commandWord {
+	var words []commandWord
+	var word commandWord
+	inWord := false
+	var quote rune
+
+	for _, r := range command {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.value += string(r)
+				// Double quotes still expand variables and command substitutions;
+				// single quotes around a ' are impossible
+				if (quote == '"' && strings.ContainsRune("$`\\", r)) || r == '\'' {
+					word.raw = true
+				}
+			}
+			word.text += string(r)
+			continue
+		case r == '\'' || r == '"':
+			quote = r
+			word.quoted = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word)
+				word = commandWord{}
+				inWord = false
+			}
+			continue
+		default:
+			word.value += string(r)
+			if r == '\\' {
+				word.raw = true
+			}
+		}
+		word.text += string(r)
+		inWord = true
+	}
+
+	if inWord {
+		words = append(words, word)
+	}
+	return words
+}
+
+// Deduplicate drops suggestions whose command is a duplicate of an earlier
+// one, comparing the commands as returned by key. The original command text
+// of the kept suggestions is left unchanged.
+func (cs CommandSuggestions) Deduplicate(key func(string) string) CommandSuggestions {
+	seen := make(map[string]bool, len(cs))
+	var unique CommandSuggestions
+	for _, suggestion := range cs {
+		k := key(suggestion.Command)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		unique = append(unique, suggestion)
+	}
+	return unique
+}
+
+// collapseWhitespace returns command with runs of whitespace made single spaces
+func collapseWhitespace(command string) string {
+	return strings.Join(strings.Fields(command), " ")
+}
@@ -0,0 +1,296 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// OllamaProvider implements LLMProvider for a local Ollama server
+type OllamaProvider struct {
+	client *http.Client
+	config *ProviderConfig
+}
+
+// ollamaChatRequest is the request body of the Ollama /api/chat endpoint
+type ollamaChatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaChatMessage    `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// ollamaChatMessage is a single chat message
+type ollamaChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ollamaChatResponse is the response body of the Ollama /api/chat endpoint.
+// All durations are reported in nanoseconds.
+type ollamaChatResponse struct {
+	Model              string            `json:"model"`
+	Message            ollamaChatMessage `json:"message"`
+	Done               bool              `json:"done"`
+	DoneReason         string            `json:"done_reason,omitempty"`
+	TotalDuration      int64             `json:"total_duration"`
+	LoadDuration       int64             `json:"load_duration"`
+	PromptEvalCount    int               `json:"prompt_eval_count"`
+	PromptEvalDuration int64             `json:"prompt_eval_duration"`
+	EvalCount          int               `json:"eval_count"`
+	EvalDuration       int64             `json:"eval_duration"`
+	Error              string            `json:"error,omitempty"`
+}
+
+// NewOllamaProvider creates a new Ollama provider
+func NewOllamaProvider(config *ProviderConfig) *OllamaProvider {
+	return &OllamaProvider{
+		client: newHTTPClient(config),
+		config: config,
+	}
+}
+
+// Complete implements LLMProvider
+func (p *OllamaProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	if !p.IsConfigured() {
+		return nil, NewAIError(ErrorTypeValidation, "Ollama provider not configured", nil)
+	}
+
+	// Create context with timeout
+	if p.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.Timeout)
+		defer cancel()
+	}
+
+	maxTokens := p.config.RequestMaxTokens(req)
+
+	body, err := json.Marshal(ollamaChatRequest{
+		Model: p.config.Model,
+		Messages: []ollamaChatMessage{
+			{Role: "user", Content: req.Prompt},
+		},
+		Stream: false,
+		Options: map[string]interface{}{
+			"temperature": p.config.RequestTemperature(req),
+			"num_predict": maxTokens,
+		},
+	})
+	if err != nil {
+		return nil, NewAIError(ErrorTypeValidation, "failed to encode Ollama request", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint("/api/chat"), bytes.NewReader(body))
+	if err != nil {
+		return nil, NewAIError(ErrorTypeValidation, "failed to create Ollama request", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, p.handleOllamaError(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, NewAIError(ErrorTypeNetwork, "failed to read Ollama response", err)
+	}
+
+	var chatResp ollamaChatResponse
+	if err := json.Unmarshal(data, &chatResp); err != nil {
+		return nil, NewAIError(ErrorTypeParsing, "failed to parse Ollama response", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		message := chatResp.Error
+		if message == "" {
+			message = resp.Status
+		}
+		return nil, NewAIError(ErrorTypeUnknown, fmt.Sprintf("Ollama API error: %s", message), nil)
+	}
+
+	content := chatResp.Message.Content
+	truncated := chatResp.DoneReason == "length"
+	suggestions, parseErr := p.parseCommandSuggestions(content)
+	if parseErr != nil && truncated {
+		// Half a JSON document is not a command
+		suggestions = nil
+	} else if parseErr != nil {
+		// If parsing fails, treat the content as a plain text response
+		suggestions = []CommandSuggestion{
+			{
+				Command:     strings.TrimSpace(content),
+				Description: "AI suggested command",
+				Confidence:  0.8,
+				Safe:        utils.IsCommandSafe(content),
+				Category:    "general",
+			},
+		}
+	}
+
+	return &CompletionResponse{
+		Content:     content,
+		Suggestions: suggestions,
+		Usage: &UsageInfo{
+			PromptTokens:     chatResp.PromptEvalCount,
+			CompletionTokens: chatResp.EvalCount,
+			TotalTokens:      chatResp.PromptEvalCount + chatResp.EvalCount,
+			TotalDuration:    time.Duration(chatResp.TotalDuration),
+			LoadDuration:     time.Duration(chatResp.LoadDuration),
+			EvalDuration:     time.Duration(chatResp.EvalDuration),
+		},
+		Model:     p.config.Model,
+		Provider:  p.GetName(),
+		Truncated: truncated,
+		Unparsed:  parseErr != nil && !truncated,
+	}, nil
+}
+
+// ValidateConfig implements LLMProvider
+func (p *OllamaProvider) ValidateConfig() error {
+	if p.config == nil {
+		return fmt.Errorf("provider config is nil")
+	}
+
+	if p.config.Endpoint == "" {
+		return fmt.Errorf("Ollama endpoint is required")
+	}
+
+	if p.config.Model == "" {
+		return fmt.Errorf("Ollama model is required")
+	}
+
+	if p.config.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be greater than 0")
+	}
+
+	return nil
+}
+
+// GetName implements LLMProvider
+func (p *OllamaProvider) GetName() string {
+	return "ollama"
+}
+
+// GetModel implements LLMProvider
+func (p *OllamaProvider) GetModel() string {
+	if p.config != nil {
+		return p.config.Model
+	}
+	return ""
+}
+
+// IsConfigured implements LLMProvider
+func (p *OllamaProvider) IsConfigured() bool {
+	return p.config != nil && p.config.Endpoint != "" && p.config.Model != ""
+}
+
+// SwitchModel implements ModelSwitcher interface for Ollama
+func (p *OllamaProvider) SwitchModel(modelName string) error {
+	if p.config == nil {
+		return fmt.Errorf("provider config is nil")
+	}
+
+	p.config.Model = modelName
+	return nil
+}
+
+// endpoint joins the configured server address with an API path
+func (p *OllamaProvider) endpoint(path string) string {
+	return strings.TrimSuffix(p.config.Endpoint, "/") + path
+}
+
+// parseCommandSuggestions attempts to parse JSON command suggestions from the response
+func (p *OllamaProvider) parseCommandSuggestions(content string) ([]CommandSuggestion, error) {
+	content = strings.TrimSpace(content)
+
+	// Look for JSON block markers
+	if strings.Contains(content, "```json") {
+		start := strings.Index(content, "```json") + 7
+		end := strings.Index(content[start:], "```")
+		if end != -1 {
+			content = content[start : start+end]
+		}
+	} else if strings.Contains(content, "```") {
+		start := strings.Index(content, "```") + 3
+		end := strings.Index(content[start:], "```")
+		if end != -1 {
+			content = content[start : start+end]
+		}
+	}
+
+	var result struct {
+		Commands []CommandSuggestion `json:"commands"`
+	}
+
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, err
+	}
+
+	for i := range result.Commands {
+		if result.Commands[i].Command == "" {
+			continue
+		}
+
+		result.Commands[i].Safe = utils.IsCommandSafe(result.Commands[i].Command) &&
+			!utils.IsDangerousCommand(result.Commands[i].Command)
+
+		if result.Commands[i].Confidence == 0 {
+			result.Commands[i].Confidence = 0.7
+		}
+
+		if result.Commands[i].Category == "" {
+			result.Commands[i].Category = "general"
+		}
+	}
+
+	return result.Commands, nil
+}
+
+// TestConnection implements ConnectionTester by listing the installed models,
+// which needs no generation
+func (p *OllamaProvider) TestConnection(ctx context.Context) error {
+	if !p.IsConfigured() {
+		return NewAIError(ErrorTypeValidation, "Ollama provider not configured", nil)
+	}
+
+	testCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(testCtx, http.MethodGet, p.endpoint("/api/tags"), nil)
+	if err != nil {
+		return NewAIError(ErrorTypeValidation, "failed to create Ollama request", err)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return p.handleOllamaError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return NewAIError(ErrorTypeUnknown, fmt.Sprintf("Ollama API error: %s", resp.Status), nil)
+	}
+	return nil
+}
+
+// handleOllamaError converts transport errors to AIError
+func (p *OllamaProvider) handleOllamaError(err error) error {
+	if aiErr := transportError("Ollama", err); aiErr != nil {
+		if errors.Is(aiErr, ErrConnectionRefused) {
+			aiErr.Message = "Ollama server is not running at " + p.config.Endpoint
+		}
+		return aiErr
+	}
+
+	return NewAIError(ErrorTypeNetwork, "Network connection error", err)
+}
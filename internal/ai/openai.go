@@ -30,6 +30,8 @@ func NewOpenAIProvider(config *ProviderConfig) *OpenAIProvider {
 			clientConfig.BaseURL = config.Endpoint
 		}
 
+		clientConfig.HTTPClient = newHTTPClient(config)
+
 		client = openai.NewClientWithConfig(clientConfig)
 	}
 
@@ -61,8 +63,9 @@ func (p *OpenAIProvider) Complete(ctx context.Context, req *CompletionRequest) (
 				Content: req.Prompt,
 			},
 		},
-		MaxTokens:   p.config.MaxTokens,
-		Temperature: p.config.Temperature,
+		MaxTokens:   p.config.RequestMaxTokens(req),
+		Temperature: p.config.RequestTemperature(req),
+		N:           req.RequestedChoices(),
 	}
 
 	// Make the API call
@@ -76,31 +79,20 @@ func (p *OpenAIProvider) Complete(ctx context.Context, req *CompletionRequest) (
 		return nil, NewAIError(ErrorTypeParsing, "no choices returned from OpenAI", nil)
 	}
 
-	content := resp.Choices[0].Message.Content
-	suggestions, parseErr := p.parseCommandSuggestions(content)
-	if parseErr != nil {
-		// If parsing fails, treat the content as a plain text response
-		suggestions = []CommandSuggestion{
-			{
-				Command:     strings.TrimSpace(content),
-				Description: "AI suggested command",
-				Confidence:  0.8,
-				Safe:        utils.IsCommandSafe(content),
-				Category:    "general",
-			},
-		}
-	}
+	result := flattenChoices(resp.Choices, p.parseCommandSuggestions)
 
 	return &CompletionResponse{
-		Content:     content,
-		Suggestions: suggestions,
+		Content:     result.content,
+		Suggestions: result.suggestions,
 		Usage: &UsageInfo{
 			PromptTokens:     resp.Usage.PromptTokens,
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
 		},
-		Model:    p.config.Model,
-		Provider: p.GetName(),
+		Model:     p.config.Model,
+		Provider:  p.GetName(),
+		Truncated: result.truncated,
+		Unparsed:  result.unparsed,
 	}, nil
 }
 
@@ -202,28 +194,23 @@ func (p *OpenAIProvider) parseCommandSuggestions(content string) ([]CommandSugge
 
 // handleOpenAIError converts OpenAI errors to AIError
 func (p *OpenAIProvider) handleOpenAIError(err error) error {
-	// Check for OpenAI request error using error assertion
-	if requestErr, ok := err.(*openai.RequestError); ok {
-		switch requestErr.HTTPStatusCode {
-		case 401:
-			return NewAIError(ErrorTypeAuth, "Invalid API key or unauthorized access", err)
+	// API errors carry the HTTP status of the response
+	if status, ok := httpStatus(err); ok {
+		switch status {
+		case 401, 403:
+			return NewAIError(ErrorTypeAuth, "Invalid API key or unauthorized access", err).WithCode(status)
 		case 429:
-			return NewAIError(ErrorTypeRateLimit, "Rate limit exceeded", err)
+			return NewAIError(ErrorTypeRateLimit, "Rate limit exceeded", err).WithCode(status)
 		case 400:
-			return NewAIError(ErrorTypeValidation, "Invalid request", err)
+			return NewAIError(ErrorTypeValidation, "Invalid request", err).WithCode(status)
 		default:
-			return NewAIError(ErrorTypeUnknown, fmt.Sprintf("OpenAI API error: %s", requestErr.Error()), err)
+			return NewAIError(ErrorTypeUnknown, "OpenAI API error", err).WithCode(status)
 		}
 	}
 
 	// Check for network errors
-	if strings.Contains(err.Error(), "context deadline exceeded") {
-		return NewAIError(ErrorTypeNetwork, "Request timeout", err)
-	}
-
-	if strings.Contains(err.Error(), "no such host") ||
-		strings.Contains(err.Error(), "connection refused") {
-		return NewAIError(ErrorTypeNetwork, "Network connection error", err)
+	if aiErr := transportError("OpenAI", err); aiErr != nil {
+		return aiErr
 	}
 
 	return NewAIError(ErrorTypeUnknown, "Unexpected error", err)
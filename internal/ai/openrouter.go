@@ -34,6 +34,8 @@ func NewOpenRouterProvider(config *ProviderConfig) *OpenRouterProvider {
 			clientConfig.BaseURL = "https://openrouter.ai/api/v1"
 		}
 
+		clientConfig.HTTPClient = newHTTPClient(config)
+
 		client = openai.NewClientWithConfig(clientConfig)
 	}
 
@@ -65,8 +67,9 @@ func (p *OpenRouterProvider) Complete(ctx context.Context, req *CompletionReques
 				Content: req.Prompt,
 			},
 		},
-		MaxTokens:   p.config.MaxTokens,
-		Temperature: p.config.Temperature,
+		MaxTokens:   p.config.RequestMaxTokens(req),
+		Temperature: p.config.RequestTemperature(req),
+		N:           req.RequestedChoices(),
 	}
 
 	// Make the API call
@@ -80,31 +83,20 @@ func (p *OpenRouterProvider) Complete(ctx context.Context, req *CompletionReques
 		return nil, NewAIError(ErrorTypeParsing, "no choices returned from OpenRouter", nil)
 	}
 
-	content := resp.Choices[0].Message.Content
-	suggestions, parseErr := p.parseCommandSuggestions(content)
-	if parseErr != nil {
-		// If parsing fails, treat the content as a plain text response
-		suggestions = []CommandSuggestion{
-			{
-				Command:     strings.TrimSpace(content),
-				Description: "AI suggested command",
-				Confidence:  0.8,
-				Safe:        utils.IsCommandSafe(content),
-				Category:    "general",
-			},
-		}
-	}
+	result := flattenChoices(resp.Choices, p.parseCommandSuggestions)
 
 	return &CompletionResponse{
-		Content:     content,
-		Suggestions: suggestions,
+		Content:     result.content,
+		Suggestions: result.suggestions,
 		Usage: &UsageInfo{
 			PromptTokens:     resp.Usage.PromptTokens,
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
 		},
-		Model:    p.config.Model,
-		Provider: p.GetName(),
+		Model:     p.config.Model,
+		Provider:  p.GetName(),
+		Truncated: result.truncated,
+		Unparsed:  result.unparsed,
 	}, nil
 }
 
@@ -206,28 +198,23 @@ func (p *OpenRouterProvider) parseCommandSuggestions(content string) ([]CommandS
 
 // handleOpenRouterError converts OpenRouter errors to AIError
 func (p *OpenRouterProvider) handleOpenRouterError(err error) error {
-	// Check for OpenAI request error using error assertion (OpenRouter uses same format)
-	if requestErr, ok := err.(*openai.RequestError); ok {
-		switch requestErr.HTTPStatusCode {
-		case 401:
-			return NewAIError(ErrorTypeAuth, "Invalid OpenRouter API key or unauthorized access", err)
+	// API errors carry the HTTP status of the response (OpenRouter uses the OpenAI format)
+	if status, ok := httpStatus(err); ok {
+		switch status {
+		case 401, 403:
+			return NewAIError(ErrorTypeAuth, "Invalid OpenRouter API key or unauthorized access", err).WithCode(status)
 		case 429:
-			return NewAIError(ErrorTypeRateLimit, "OpenRouter rate limit exceeded", err)
+			return NewAIError(ErrorTypeRateLimit, "OpenRouter rate limit exceeded", err).WithCode(status)
 		case 400:
-			return NewAIError(ErrorTypeValidation, "Invalid request to OpenRouter", err)
+			return NewAIError(ErrorTypeValidation, "Invalid request to OpenRouter", err).WithCode(status)
 		default:
-			return NewAIError(ErrorTypeUnknown, fmt.Sprintf("OpenRouter API error: %s", requestErr.Error()), err)
+			return NewAIError(ErrorTypeUnknown, "OpenRouter API error", err).WithCode(status)
 		}
 	}
 
 	// Check for network errors
-	if strings.Contains(err.Error(), "context deadline exceeded") {
-		return NewAIError(ErrorTypeNetwork, "Request timeout to OpenRouter", err)
-	}
-
-	if strings.Contains(err.Error(), "no such host") ||
-		strings.Contains(err.Error(), "connection refused") {
-		return NewAIError(ErrorTypeNetwork, "Network connection error to OpenRouter", err)
+	if aiErr := transportError("OpenRouter", err); aiErr != nil {
+		return aiErr
 	}
 
 	return NewAIError(ErrorTypeUnknown, "Unexpected OpenRouter error", err)
@@ -268,6 +255,7 @@ func (p *OpenRouterProvider) GetModels(ctx context.Context) ([]ModelInfo, error)
 	// Add authorization header
 	req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
 	req.Header.Set("Content-Type", "application/json")
+	setHeaders(req, p.config.ExpandedHeaders())
 
 	// Make the request
 	client := &http.Client{Timeout: 30 * time.Second}
@@ -298,19 +286,22 @@ func (p *OpenRouterProvider) GetModels(ctx context.Context) ([]ModelInfo, error)
 
 	for _, model := range apiResponse.Data {
 		pricing := ""
+		promptPrice, completionPrice := 0.0, 0.0
 		if model.Pricing != nil && model.Pricing.Prompt != "" && model.Pricing.Completion != "" {
-			pricing = fmt.Sprintf("$%.3f/$%.3f per 1k tokens",
-				parseFloat(model.Pricing.Prompt)*1000,
-				parseFloat(model.Pricing.Completion)*1000)
+			promptPrice, completionPrice = parseFloat(model.Pricing.Prompt), parseFloat(model.Pricing.Completion)
+			pricing = fmt.Sprintf("$%.3f/$%.3f per 1k tokens", promptPrice*1000, completionPrice*1000)
 		}
 
 		modelInfo := ModelInfo{
-			ID:          model.ID,
-			Name:        model.Name,
-			Description: model.Description,
-			Pricing:     pricing,
-			ContextSize: model.ContextLength,
-			Current:     model.ID == currentModel,
+			ID:              model.ID,
+			Name:            model.Name,
+			Description:     model.Description,
+			Pricing:         pricing,
+			Price:           (promptPrice + completionPrice) * 1000,
+			PromptPrice:     promptPrice,
+			CompletionPrice: completionPrice,
+			ContextSize:     model.ContextLength,
+			Current:         model.ID == currentModel,
 		}
 
 		models = append(models, modelInfo)
@@ -336,6 +327,7 @@ func (p *OpenRouterProvider) SwitchModel(modelName string) error {
 		} else {
 			clientConfig.BaseURL = "https://openrouter.ai/api/v1"
 		}
+		clientConfig.HTTPClient = newHTTPClient(p.config)
 		p.client = openai.NewClientWithConfig(clientConfig)
 	}
 
@@ -54,6 +54,10 @@ func NewProviderFactory() *ProviderFactory {
 		return NewOpenRouterProvider(config)
 	})
 
+	factory.Register(ProviderTypeOllama, func(config *ProviderConfig) LLMProvider {
+		return NewOllamaProvider(config)
+	})
+
 	return factory
 }
 
@@ -86,6 +90,11 @@ func (f *ProviderFactory) GetSupportedProviders() []ProviderType {
 	return types
 }
 
+// RequiresAPIKey returns false for providers that run locally without authentication
+func RequiresAPIKey(providerType ProviderType) bool {
+	return providerType != ProviderTypeOllama
+}
+
 // DefaultProviderConfig returns default configuration for a provider type
 func DefaultProviderConfig(providerType ProviderType) *ProviderConfig {
 	base := &ProviderConfig{
@@ -112,81 +121,3 @@ func DefaultProviderConfig(providerType ProviderType) *ProviderConfig {
 
 	return base
 }
-
-// MockProvider is a mock implementation for testing
-type MockProvider struct {
-	name         string
-	model        string
-	configured   bool
-	mockError    error
-	mockResponse *CompletionResponse
-}
-
-// NewMockProvider creates a new mock provider
-func NewMockProvider(name, model string) *MockProvider {
-	return &MockProvider{
-		name:       name,
-		model:      model,
-		configured: true,
-	}
-}
-
-// Complete implements LLMProvider
-func (m *MockProvider) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
-	if m.mockError != nil {
-		return nil, m.mockError
-	}
-
-	if m.mockResponse != nil {
-		return m.mockResponse, nil
-	}
-
-	// Default mock response
-	return &CompletionResponse{
-		Content: "Mock response for: " + req.Prompt,
-		Suggestions: []CommandSuggestion{
-			{
-				Command:     "echo 'mock command'",
-				Description: "Mock command suggestion",
-				Confidence:  0.9,
-				Safe:        true,
-				Category:    "test",
-			},
-		},
-		Provider: m.name,
-		Model:    m.model,
-	}, nil
-}
-
-// ValidateConfig implements LLMProvider
-func (m *MockProvider) ValidateConfig() error {
-	if !m.configured {
-		return fmt.Errorf("mock provider not configured")
-	}
-	return nil
-}
-
-// GetName implements LLMProvider
-func (m *MockProvider) GetName() string {
-	return m.name
-}
-
-// GetModel implements LLMProvider
-func (m *MockProvider) GetModel() string {
-	return m.model
-}
-
-// IsConfigured implements LLMProvider
-func (m *MockProvider) IsConfigured() bool {
-	return m.configured
-}
-
-// SetMockError sets an error to be returned by Complete
-func (m *MockProvider) SetMockError(err error) {
-	m.mockError = err
-}
-
-// SetMockResponse sets a response to be returned by Complete
-func (m *MockProvider) SetMockResponse(resp *CompletionResponse) {
-	m.mockResponse = resp
-}
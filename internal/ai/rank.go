@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"sort"
+
+	"github.com/yourusername/clia/pkg/memory"
+)
+
+// SuggestionSource tells where a ranked suggestion comes from
+type SuggestionSource string
+
+const (
+	SourceMemory SuggestionSource = "memory"
+	SourceAI     SuggestionSource = "ai"
+)
+
+// RankOptions controls how RankSuggestions orders suggestions
+type RankOptions struct {
+	PreferSafe   bool                // Safe commands rank before unsafe ones whatever their score
+	Limit        int                 // Keep at most this many suggestions; 0 keeps all
+	DuplicateKey func(string) string // Compares commands for duplicates; collapses whitespace if nil
+}
+
+// RankedItem is an entry of the list returned by RankSuggestions. Memory
+// entries carry their command, description and search score as a
+// CommandSuggestion, with past success as the safety indicator.
+type RankedItem struct {
+	CommandSuggestion
+	Score      float64              // Blended ranking score
+	Source     SuggestionSource     // Where the suggestion comes from
+	Index      int                  // Position in the AI suggestions or memory results it comes from
+	Memory     *memory.SearchResult // Set for suggestions from memory
+	AlsoFromAI bool                 // Memory entry the AI suggested as well
+}
+
+// RankedItems is a slice of RankedItem with helper methods
+type RankedItems []RankedItem
+
+// MemoryScore ranks a memory search result by relevance, usage and past success
+func MemoryScore(result memory.SearchResult) float64 {
+	usage := float64(result.Entry.UsageCount) / 10.0
+	if usage > 1.0 {
+		usage = 1.0
+	}
+
+	score := result.Score*0.7 + usage*0.3
+	if !result.Entry.Success {
+		score *= 0.5
+	}
+	return score
+}
+
+// RankSuggestions merges AI suggestions and memory results into a single
+// ranked list. Duplicate commands are kept once: of two AI suggestions the more
+// confident one wins, and a memory entry wins over the AI, its rank boosted by
+// the agreement. Items are ordered by score, with safe commands first if
+// opts.PreferSafe is set.
+func RankSuggestions(suggestions []CommandSuggestion, memories []memory.SearchResult, opts RankOptions) RankedItems {
+	key := opts.DuplicateKey
+	if key == nil {
+		key = collapseWhitespace
+	}
+
+	ranked := make(RankedItems, 0, len(memories)+len(suggestions))
+	byCommand := make(map[string]int)
+
+	for i := range memories {
+		result := memories[i]
+		k := key(result.Entry.SelectedCommand)
+		item := RankedItem{
+			CommandSuggestion: CommandSuggestion{
+				Command:     result.Entry.SelectedCommand,
+				Description: result.Entry.Description,
+				Confidence:  result.Score,
+				Safe:        result.Entry.Success,
+			},
+			Score:  MemoryScore(result),
+			Source: SourceMemory,
+			Index:  i,
+			Memory: &result,
+		}
+		if index, exists := byCommand[k]; exists {
+			if item.Score > ranked[index].Score {
+				ranked[index] = item
+			}
+			continue
+		}
+		byCommand[k] = len(ranked)
+		ranked = append(ranked, item)
+	}
+
+	for i, suggestion := range suggestions {
+		k := key(suggestion.Command)
+		index, exists := byCommand[k]
+		if exists && ranked[index].Source == SourceMemory {
+			// Memory wins, but agreement with the AI boosts its rank
+			existing := &ranked[index]
+			if !existing.AlsoFromAI {
+				existing.AlsoFromAI = true
+				existing.Score += suggestion.Confidence * 0.1
+				existing.Safe = existing.Safe && suggestion.Safe
+				existing.Category = suggestion.Category
+			}
+			continue
+		}
+
+		item := RankedItem{
+			CommandSuggestion: suggestion,
+			Score:             suggestion.Confidence * 0.9,
+			Source:            SourceAI,
+			Index:             i,
+		}
+		if exists {
+			if item.Score > ranked[index].Score {
+				ranked[index] = item
+			}
+			continue
+		}
+		byCommand[k] = len(ranked)
+		ranked = append(ranked, item)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if opts.PreferSafe && ranked[i].Safe != ranked[j].Safe {
+			return ranked[i].Safe
+		}
+		return ranked[i].Score > ranked[j].Score
+	})
+
+	if opts.Limit > 0 && len(ranked) > opts.Limit {
+		ranked = ranked[:opts.Limit]
+	}
+	return ranked
+}
+
+// Suggestions returns the command suggestions of the ranked items, in order
+func (items RankedItems) Suggestions() CommandSuggestions {
+	suggestions := make(CommandSuggestions, len(items))
+	for i, item := range items {
+		suggestions[i] = item.CommandSuggestion
+	}
+	return suggestions
+}
+
+// GroupByCategory returns the items with those of the same category next to
+// each other, like CommandSuggestions.GroupByCategory
+func (items RankedItems) GroupByCategory() RankedItems {
+	rank := make(map[string]int)
+	for _, item := range items {
+		if _, ok := rank[CategoryKey(item.Category)]; !ok {
+			rank[CategoryKey(item.Category)] = len(rank)
+		}
+	}
+
+	grouped := make(RankedItems, len(items))
+	copy(grouped, items)
+	sort.SliceStable(grouped, func(i, j int) bool {
+		return rank[CategoryKey(grouped[i].Category)] < rank[CategoryKey(grouped[j].Category)]
+	})
+	return grouped
+}
+
+// MixedCategories reports whether the items span more than one category
+func (items RankedItems) MixedCategories() bool {
+	return items.Suggestions().MixedCategories()
+}
@@ -0,0 +1,69 @@
+package ai
+
+import "strings"
+
+// FreeModelSuffix marks the free variants of OpenRouter models, whose rate
+// limits are tight
+const FreeModelSuffix = ":free"
+
+// IsFreeModel reports whether model is a rate-limited free variant
+func IsFreeModel(model string) bool {
+	return strings.HasSuffix(model, FreeModelSuffix)
+}
+
+// RecommendFreeModel picks a model that costs nothing from models, for when
+// the budget of the session is spent: the free variant of current if listed,
+// or the free model with the largest context window. It reports false if
+// there is none.
+func RecommendFreeModel(current string, models []ModelInfo) (ModelInfo, bool) {
+	freeID := strings.TrimSuffix(current, FreeModelSuffix) + FreeModelSuffix
+
+	var best ModelInfo
+	found := false
+	for _, model := range models {
+		if !IsFreeModel(model.ID) {
+			continue
+		}
+		if model.ID == freeID {
+			return model, true
+		}
+		if !found || model.ContextSize > best.ContextSize {
+			best = model
+			found = true
+		}
+	}
+	return best, found
+}
+
+// RecommendModel picks an alternative with higher rate limits for the free
+// model current from models: its paid variant if listed, or the cheapest paid
+// model with a context window at least as large. It reports false if there
+// is none, e.g. when models carry no prices.
+func RecommendModel(current string, models []ModelInfo) (ModelInfo, bool) {
+	paidID := strings.TrimSuffix(current, FreeModelSuffix)
+	contextSize := 0
+	for _, model := range models {
+		if model.ID == current {
+			contextSize = model.ContextSize
+		}
+	}
+
+	var best ModelInfo
+	found := false
+	for _, model := range models {
+		if IsFreeModel(model.ID) || model.Price <= 0 {
+			continue
+		}
+		if model.ID == paidID {
+			return model, true
+		}
+		if model.ContextSize < contextSize {
+			continue
+		}
+		if !found || model.Price < best.Price {
+			best = model
+			found = true
+		}
+	}
+	return best, found
+}
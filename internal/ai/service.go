@@ -2,9 +2,12 @@ package ai
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/yourusername/clia/internal/prompt"
@@ -16,16 +19,56 @@ type Service struct {
 	promptBuilder  *prompt.PromptBuilder
 	factory        *ProviderFactory
 	fallbackMode   bool
+	offline        bool       // Skip the provider and use rule-based suggestions only
+	creativity     Creativity // Session temperature preset for suggestions
+	maxTokens      int        // Token limit for suggestions; 0 uses the provider default
+	choices        int        // Answers requested per suggestion request; 0 or 1 asks for one
+	normalize      bool       // Drop suggestions differing only in flag order or quoting
+	cache          *SuggestionCache
 	requestTimeout time.Duration
+	modelAliases   map[string]map[string]string // provider -> alias -> model ID
+	headers        map[string]map[string]string // provider -> custom request headers
+	endpoints      map[string]string            // provider -> base URL override
+
+	// Circuit breakers keyed by provider name, see breaker.go
+	breakerMu        sync.Mutex
+	breakers         map[string]*circuitBreaker
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	// Held while a request runs with a one-off model, see SuggestCommandsWithModel
+	overrideMu sync.Mutex
+
+	// Context lengths reported when models were listed, see tokens.go
+	contextMu      sync.Mutex
+	contextWindows map[string]int
+
+	// Prices reported when models were listed and the spending of the
+	// session against its budget, see cost.go
+	costMu       sync.Mutex
+	prices       map[string]TokenPrice
+	pricesListed map[string]bool // Providers whose models were listed for their prices
+	budget       float64         // Dollars; 0 is no limit
+	spent        float64
 }
 
+// DefaultRequestTimeout is how long a suggestion or answer request may take
+// unless SetTimeout says otherwise
+const DefaultRequestTimeout = 30 * time.Second
+
 // NewService creates a new AI service
 func NewService() *Service {
 	return &Service{
 		factory:        NewProviderFactory(),
 		promptBuilder:  prompt.NewPromptBuilder(),
 		fallbackMode:   false,
-		requestTimeout: 30 * time.Second,
+		normalize:      true,
+		requestTimeout: DefaultRequestTimeout,
+		modelAliases:   make(map[string]map[string]string),
+
+		breakers:         make(map[string]*circuitBreaker),
+		breakerThreshold: DefaultBreakerThreshold,
+		breakerCooldown:  DefaultBreakerCooldown,
 	}
 }
 
@@ -37,64 +80,203 @@ func (s *Service) SetProvider(provider LLMProvider) *Service {
 
 // SetProviderByConfig creates and sets a provider from configuration
 func (s *Service) SetProviderByConfig(providerType ProviderType, config *ProviderConfig) error {
-	provider, err := s.factory.Create(providerType, config)
+	provider, err := s.createProvider(providerType, config)
 	if err != nil {
 		return fmt.Errorf("failed to create provider: %w", err)
 	}
 
 	s.provider = provider
+	s.resetBreaker(provider.GetName())
 	return nil
 }
 
-// SetTimeout sets the request timeout
+// SetProviderHeaders sets the custom request headers per provider name, used
+// by providers created without headers of their own
+func (s *Service) SetProviderHeaders(headers map[string]map[string]string) *Service {
+	s.headers = headers
+	return s
+}
+
+// SetProviderEndpoints sets the base URL per provider name, e.g. for proxies
+// and self-hosted gateways; it replaces the endpoint of providers created later
+func (s *Service) SetProviderEndpoints(endpoints map[string]string) *Service {
+	s.endpoints = endpoints
+	return s
+}
+
+// createProvider creates a provider, adding the configured custom headers and base URL
+func (s *Service) createProvider(providerType ProviderType, config *ProviderConfig) (LLMProvider, error) {
+	if config != nil && config.Headers == nil {
+		config.Headers = s.headers[string(providerType)]
+	}
+	if endpoint := s.endpoints[string(providerType)]; config != nil && endpoint != "" {
+		config.Endpoint = endpoint
+	}
+	if config != nil {
+		// Requests are limited by the service timeout, which can change
+		// while the provider is in use
+		config.Timeout = 0
+	}
+	return s.factory.Create(providerType, config)
+}
+
+// SetTimeout sets how long a suggestion or answer request may take, retries
+// included; 0 or less restores DefaultRequestTimeout. Commands run by the
+// executor have a timeout of their own.
 func (s *Service) SetTimeout(timeout time.Duration) *Service {
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
 	s.requestTimeout = timeout
 	return s
 }
 
+// GetTimeout returns how long a suggestion or answer request may take
+func (s *Service) GetTimeout() time.Duration {
+	return s.requestTimeout
+}
+
+// SetMaxTokens sets the token limit for suggestion responses; 0 uses the provider default
+func (s *Service) SetMaxTokens(tokens int) *Service {
+	s.maxTokens = tokens
+	return s
+}
+
+// SetChoices sets how many answers a suggestion request asks the provider
+// for at once; their suggestions are merged. 0 or 1 asks for one.
+func (s *Service) SetChoices(choices int) *Service {
+	s.choices = choices
+	return s
+}
+
+// SetSuggestionNormalization sets whether suggestions that only differ in
+// flag order or quoting count as duplicates. Identical commands are always
+// dropped.
+func (s *Service) SetSuggestionNormalization(enabled bool) *Service {
+	s.normalize = enabled
+	return s
+}
+
 // SetFallbackMode enables/disables fallback mode
 func (s *Service) SetFallbackMode(enabled bool) *Service {
 	s.fallbackMode = enabled
 	return s
 }
 
-// SuggestCommands generates command suggestions based on natural language input
+// SetOffline enables/disables offline mode, in which the provider is never contacted
+func (s *Service) SetOffline(enabled bool) *Service {
+	s.offline = enabled
+	return s
+}
+
+// IsOffline returns true if offline mode is enabled
+func (s *Service) IsOffline() bool {
+	return s.offline
+}
+
+// SetCache sets the on-disk suggestion cache; nil disables caching
+func (s *Service) SetCache(cache *SuggestionCache) *Service {
+	s.cache = cache
+	return s
+}
+
+// GetCache returns the suggestion cache, or nil if caching is disabled
+func (s *Service) GetCache() *SuggestionCache {
+	return s.cache
+}
+
+// SetCreativity sets the temperature preset applied to subsequent suggestion requests
+func (s *Service) SetCreativity(creativity Creativity) *Service {
+	s.creativity = creativity
+	return s
+}
+
+// GetCreativity returns the current temperature preset
+func (s *Service) GetCreativity() Creativity {
+	return s.creativity
+}
+
+// SuggestCommands generates command suggestions based on natural language
+// input. Requests estimated not to fit the context window of the model fail
+// with ErrContextTooLong before they are sent.
 func (s *Service) SuggestCommands(ctx context.Context, userInput string) (*CompletionResponse, error) {
+	return s.suggestCommands(ctx, userInput, false)
+}
+
+// SuggestCommandsTrimmed suggests commands like SuggestCommands with a
+// minimal prompt, leaving out the directory context and earlier exchanges,
+// for requests that do not fit the context window of the model
+func (s *Service) SuggestCommandsTrimmed(ctx context.Context, userInput string) (*CompletionResponse, error) {
+	return s.suggestCommands(ctx, userInput, true)
+}
+
+// suggestCommands implements SuggestCommands; trimmed builds a minimal prompt
+func (s *Service) suggestCommands(ctx context.Context, userInput string, trimmed bool) (*CompletionResponse, error) {
+	if s.offline {
+		if s.provider != nil {
+			if req, err := s.suggestionRequest(ctx, userInput, trimmed); err == nil {
+				if cached, ok := s.getCachedResponse(userInput, req); ok {
+					return cached, nil
+				}
+			}
+		}
+
+		suggestions := s.generateFallbackSuggestions(userInput)
+		return &CompletionResponse{
+			Content:     fmt.Sprintf("Offline mode, generated %d rule-based suggestions", len(suggestions)),
+			Suggestions: suggestions,
+			Provider:    "offline",
+			Model:       "rule-based",
+		}, nil
+	}
+
 	if s.provider == nil {
-		return nil, fmt.Errorf("no LLM provider configured")
+		return nil, NewAIError(ErrorTypeAuth, "no LLM provider configured", nil)
 	}
 
 	if !s.provider.IsConfigured() {
-		return nil, fmt.Errorf("LLM provider is not properly configured")
+		return nil, NewAIError(ErrorTypeAuth, "LLM provider is not properly configured", nil)
 	}
 
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
 	defer cancel()
 
-	// Build prompt
-	promptText, err := s.promptBuilder.BuildCommandPrompt(ctx, userInput)
+	req, err := s.suggestionRequest(ctx, userInput, trimmed)
 	if err != nil {
-		if s.fallbackMode {
-			promptText = s.promptBuilder.BuildQuickPrompt(userInput)
-		} else {
-			return nil, fmt.Errorf("failed to build prompt: %w", err)
-		}
+		return nil, err
+	}
+	if cached, ok := s.getCachedResponse(userInput, req); ok {
+		return cached, nil
+	}
+
+	// A prompt the model cannot take in would be rejected or silently cut off
+	estimate := s.estimatePrompt(req.Prompt)
+	if estimate.Exceeds() {
+		return nil, NewAIError(ErrorTypeContextLength,
+			fmt.Sprintf("request too large for the context window: %s", estimate), nil)
 	}
 
 	// Validate prompt
-	if err := s.promptBuilder.ValidatePrompt(promptText); err != nil {
+	if err := s.promptBuilder.ValidatePrompt(req.Prompt); err != nil {
 		return nil, fmt.Errorf("invalid prompt: %w", err)
 	}
 
-	// Create completion request
-	req := &CompletionRequest{
-		Prompt: promptText,
+	// Get suggestions from LLM; a failing provider is skipped for a while
+	response, err := s.complete(ctx, req)
+	if err == nil && response.Truncated && len(response.Suggestions) == 0 {
+		response, err = s.retryTruncated(ctx, req, response)
+	}
+	if err == nil && response.Unparsed {
+		response = s.retryReformat(ctx, req, response)
 	}
-
-	// Get suggestions from LLM
-	response, err := s.provider.Complete(ctx, req)
 	if err != nil {
+		var aiErr *AIError
+		if errors.As(err, &aiErr) && (aiErr.Type == ErrorTypeTruncated || aiErr.Type == ErrorTypeBudget) {
+			// Rule-based suggestions would hide an actionable problem
+			return nil, err
+		}
+
 		// Handle different error types
 		if s.fallbackMode {
 			return s.handleFallback(userInput, err)
@@ -110,13 +292,156 @@ func (s *Service) SuggestCommands(ctx context.Context, userInput string) (*Compl
 	// Filter and sort suggestions
 	suggestions := CommandSuggestions(response.Suggestions)
 
-	// Sort by confidence and limit results
-	suggestions = suggestions.SortByConfidence().Top(3)
+	// Sort by confidence, drop duplicates and limit results
+	duplicateKey := collapseWhitespace
+	if s.normalize {
+		duplicateKey = CanonicalCommand
+	}
+	suggestions = RankSuggestions(suggestions, nil, RankOptions{Limit: 3, DuplicateKey: duplicateKey}).Suggestions()
 
 	response.Suggestions = suggestions
+	response.Estimate = &estimate
+	s.putCachedResponse(userInput, req, response)
 	return response, nil
 }
 
+// suggestionRequest builds the completion request suggesting commands for
+// userInput; trimmed builds a minimal prompt
+func (s *Service) suggestionRequest(ctx context.Context, userInput string, trimmed bool) (*CompletionRequest, error) {
+	var promptText string
+	var err error
+	if trimmed {
+		promptText = s.promptBuilder.BuildQuickPrompt(userInput)
+	} else if promptText, err = s.promptBuilder.BuildCommandPrompt(ctx, userInput); err != nil {
+		if s.fallbackMode {
+			promptText = s.promptBuilder.BuildQuickPrompt(userInput)
+		} else {
+			return nil, fmt.Errorf("failed to build prompt: %w", err)
+		}
+	}
+
+	return &CompletionRequest{
+		Prompt:      promptText,
+		MaxTokens:   s.maxTokens,
+		Temperature: s.creativity.Temperature(),
+		Choices:     s.choices,
+	}, nil
+}
+
+// maxRetryTokens caps the token limit used when retrying a truncated response
+const maxRetryTokens = 4096
+
+// retryTruncated retries a request whose response was cut off by the token
+// limit once with double the budget. If that response is cut off as well, it
+// returns an error telling the user to raise max_tokens.
+func (s *Service) retryTruncated(ctx context.Context, req *CompletionRequest, response *CompletionResponse) (*CompletionResponse, error) {
+	limit := req.MaxTokens
+	if limit <= 0 && response.Usage != nil {
+		limit = response.Usage.CompletionTokens
+	}
+
+	if limit > 0 && limit < maxRetryTokens {
+		retryReq := *req
+		retryReq.MaxTokens = min(limit*2, maxRetryTokens)
+		log.Printf("Response truncated at %d tokens, retrying with %d", limit, retryReq.MaxTokens)
+
+		retried, err := s.complete(ctx, &retryReq)
+		if err != nil {
+			return nil, err
+		}
+		if !retried.Truncated || len(retried.Suggestions) > 0 {
+			return retried, nil
+		}
+		limit = retryReq.MaxTokens
+	}
+
+	message := "the AI response was cut off by the max_tokens limit"
+	if limit > 0 {
+		message = fmt.Sprintf("the AI response was cut off by the max_tokens limit (%d tokens)", limit)
+	}
+	return nil, NewAIError(ErrorTypeTruncated, message+"; raise api.max_tokens in the config file", nil)
+}
+
+// retryReformat asks the provider once to reformat a response that could not
+// be parsed as suggestion JSON. If the reformatted response cannot be used
+// either, the original response is returned with its content as the command.
+func (s *Service) retryReformat(ctx context.Context, req *CompletionRequest, response *CompletionResponse) *CompletionResponse {
+	log.Printf("Response from %s could not be parsed, asking it to reformat as JSON", s.provider.GetName())
+
+	reformatReq := *req
+	reformatReq.Prompt = prompt.ReformatPrompt(response.Content)
+	reformatReq.Choices = 0
+
+	// The reformatted response is never reformatted again
+	reformatted, err := s.complete(ctx, &reformatReq)
+	if err != nil {
+		log.Printf("Reformat request failed: %v", err)
+		return response
+	}
+	if reformatted.Unparsed || len(reformatted.Suggestions) == 0 {
+		log.Printf("Reformatted response could not be parsed either")
+		return response
+	}
+	return reformatted
+}
+
+// getCachedResponse returns a fresh cached response for userInput, sent as
+// req, from the current provider and model
+func (s *Service) getCachedResponse(userInput string, req *CompletionRequest) (*CompletionResponse, bool) {
+	// Creativity presets ask for varied answers, so they bypass the cache
+	if s.cache == nil || s.provider == nil || s.creativity != CreativityDefault {
+		return nil, false
+	}
+
+	response, ok := s.cache.Get(NewCacheKey(userInput, s.provider.GetName(), s.provider.GetModel(), req))
+	if !ok {
+		return nil, false
+	}
+
+	response.Cached = true
+	return response, true
+}
+
+// putCachedResponse stores a successful provider response; cache errors are not fatal
+func (s *Service) putCachedResponse(userInput string, req *CompletionRequest, response *CompletionResponse) {
+	if s.cache == nil || s.creativity != CreativityDefault || len(response.Suggestions) == 0 {
+		return
+	}
+
+	key := NewCacheKey(userInput, s.provider.GetName(), s.provider.GetModel(), req)
+	if err := s.cache.Put(key, response); err != nil {
+		log.Printf("Warning: failed to cache suggestions: %v", err)
+	}
+}
+
+// SummarizeOutput asks the provider for a short plain-text summary of the
+// output of command; long output is truncated to fit the prompt
+func (s *Service) SummarizeOutput(ctx context.Context, command, output string) (string, error) {
+	if strings.TrimSpace(output) == "" {
+		return "", fmt.Errorf("no output to summarize")
+	}
+
+	if s.offline {
+		return "", fmt.Errorf("output summaries need an AI provider (offline mode is on)")
+	}
+
+	if s.provider == nil || !s.provider.IsConfigured() {
+		return "", NewAIError(ErrorTypeAuth, "no LLM provider configured", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	response, err := s.complete(ctx, &CompletionRequest{
+		Prompt: prompt.OutputSummaryPrompt(command, output),
+	})
+	if err != nil {
+		return "", fmt.Errorf("LLM completion failed: %w", err)
+	}
+
+	return strings.TrimSpace(response.Content), nil
+}
+
 // TestConnection tests the connection to the configured LLM provider
 func (s *Service) TestConnection(ctx context.Context) error {
 	if s.provider == nil {
@@ -146,7 +471,18 @@ func (s *Service) GetProviderInfo() map[string]interface{} {
 	}
 
 	info["fallback_mode"] = s.fallbackMode
+	info["offline"] = s.offline
+	info["creativity"] = string(s.creativity)
 	info["timeout"] = s.requestTimeout.String()
+	if budget := s.Budget(); budget > 0 {
+		info["budget"] = fmt.Sprintf("%s of %s spent", FormatCost(s.Spent()), FormatCost(budget))
+	}
+
+	if state, failures, retryIn := s.BreakerStatus(); state != BreakerClosed {
+		info["circuit"] = string(state)
+		info["circuit_failures"] = failures
+		info["circuit_retry_in"] = retryIn.Round(time.Second).String()
+	}
 
 	return info
 }
@@ -166,35 +502,84 @@ func (s *Service) handleFallback(userInput string, originalErr error) (*Completi
 	}, nil
 }
 
+// fallbackPattern maps request keywords to a rule-based suggestion
+type fallbackPattern struct {
+	keywords   []string
+	suggestion CommandSuggestion
+}
+
+// fallbackPatterns is the rule table used when the LLM is unavailable or offline mode is on.
+// Entries are matched in order, so earlier entries win ties in confidence.
+var fallbackPatterns = []fallbackPattern{
+	// File management
+	{[]string{"list", "files"}, CommandSuggestion{Command: "ls -la", Description: "List files with details", Confidence: 0.7, Safe: true, Category: "file_management"}},
+	{[]string{"files"}, CommandSuggestion{Command: "ls", Description: "List files", Confidence: 0.6, Safe: true, Category: "file_management"}},
+	{[]string{"large", "biggest", "largest"}, CommandSuggestion{Command: "du -ah . | sort -rh | head -20", Description: "Show the largest files and directories", Confidence: 0.7, Safe: true, Category: "file_management"}},
+	{[]string{"copy"}, CommandSuggestion{Command: "cp", Description: "Copy files", Confidence: 0.5, Safe: true, Category: "file_management"}},
+	{[]string{"move", "rename"}, CommandSuggestion{Command: "mv", Description: "Move or rename files", Confidence: 0.5, Safe: false, Category: "file_management"}},
+	{[]string{"delete", "remove"}, CommandSuggestion{Command: "rm", Description: "Delete files (use with caution)", Confidence: 0.5, Safe: false, Category: "file_management"}},
+	{[]string{"permission", "chmod"}, CommandSuggestion{Command: "ls -l", Description: "Show file permissions", Confidence: 0.6, Safe: true, Category: "file_management"}},
+	{[]string{"compress", "archive", "zip"}, CommandSuggestion{Command: "tar -czvf archive.tar.gz .", Description: "Compress the current directory into a tarball", Confidence: 0.6, Safe: true, Category: "file_management"}},
+	{[]string{"extract", "unzip", "untar"}, CommandSuggestion{Command: "tar -xzvf archive.tar.gz", Description: "Extract a gzipped tarball", Confidence: 0.6, Safe: true, Category: "file_management"}},
+
+	// Navigation
+	{[]string{"directory", "current", "where am i"}, CommandSuggestion{Command: "pwd", Description: "Show current directory", Confidence: 0.7, Safe: true, Category: "navigation"}},
+	{[]string{"tree", "structure"}, CommandSuggestion{Command: "find . -maxdepth 2 -not -path '*/.*'", Description: "Show the directory structure", Confidence: 0.6, Safe: true, Category: "navigation"}},
+
+	// Search
+	{[]string{"search", "find"}, CommandSuggestion{Command: "find . -name", Description: "Search for files by name", Confidence: 0.6, Safe: true, Category: "search"}},
+	{[]string{"grep", "text", "contains"}, CommandSuggestion{Command: "grep -rn", Description: "Search file contents recursively", Confidence: 0.6, Safe: true, Category: "search"}},
+
+	// System information
+	{[]string{"disk", "space", "storage"}, CommandSuggestion{Command: "df -h", Description: "Show filesystem disk space usage", Confidence: 0.8, Safe: true, Category: "system_info"}},
+	{[]string{"memory", "ram"}, CommandSuggestion{Command: "free -h", Description: "Show memory usage", Confidence: 0.8, Safe: true, Category: "system_info"}},
+	{[]string{"cpu", "load"}, CommandSuggestion{Command: "uptime", Description: "Show system load averages", Confidence: 0.7, Safe: true, Category: "system_info"}},
+	{[]string{"process", "running"}, CommandSuggestion{Command: "ps aux", Description: "Show running processes", Confidence: 0.7, Safe: true, Category: "system_info"}},
+	{[]string{"kill"}, CommandSuggestion{Command: "pkill", Description: "Kill processes by name (use with caution)", Confidence: 0.5, Safe: false, Category: "system_info"}},
+	{[]string{"system", "kernel", "os version"}, CommandSuggestion{Command: "uname -a", Description: "Show system information", Confidence: 0.7, Safe: true, Category: "system_info"}},
+	{[]string{"environment", "env var"}, CommandSuggestion{Command: "env", Description: "Show environment variables", Confidence: 0.7, Safe: true, Category: "system_info"}},
+	{[]string{"history"}, CommandSuggestion{Command: "history", Description: "Show shell command history", Confidence: 0.6, Safe: true, Category: "system_info"}},
+	{[]string{"log"}, CommandSuggestion{Command: "tail -n 100 /var/log/syslog", Description: "Show recent system log entries", Confidence: 0.5, Safe: true, Category: "system_info"}},
+
+	// Network
+	{[]string{"port", "listening"}, CommandSuggestion{Command: "ss -tulpn", Description: "Show listening ports", Confidence: 0.7, Safe: true, Category: "network"}},
+	{[]string{"ip address", "network", "interface"}, CommandSuggestion{Command: "ip addr", Description: "Show network interfaces and addresses", Confidence: 0.7, Safe: true, Category: "network"}},
+	{[]string{"ping", "connectivity", "internet"}, CommandSuggestion{Command: "ping -c 4 8.8.8.8", Description: "Check network connectivity", Confidence: 0.6, Safe: true, Category: "network"}},
+	{[]string{"download"}, CommandSuggestion{Command: "curl -LO", Description: "Download a file from a URL", Confidence: 0.5, Safe: true, Category: "network"}},
+
+	// Development
+	{[]string{"git", "status"}, CommandSuggestion{Command: "git status", Description: "Show git status", Confidence: 0.8, Safe: true, Category: "development"}},
+	{[]string{"commit", "git log"}, CommandSuggestion{Command: "git log --oneline -10", Description: "Show recent commits", Confidence: 0.7, Safe: true, Category: "development"}},
+	{[]string{"branch"}, CommandSuggestion{Command: "git branch -a", Description: "List git branches", Confidence: 0.7, Safe: true, Category: "development"}},
+	{[]string{"diff", "changes"}, CommandSuggestion{Command: "git diff", Description: "Show uncommitted changes", Confidence: 0.7, Safe: true, Category: "development"}},
+	{[]string{"docker", "container"}, CommandSuggestion{Command: "docker ps", Description: "List running containers", Confidence: 0.7, Safe: true, Category: "development"}},
+}
+
 // generateFallbackSuggestions generates simple rule-based command suggestions
 func (s *Service) generateFallbackSuggestions(userInput string) []CommandSuggestion {
 	input := strings.ToLower(strings.TrimSpace(userInput))
-	var suggestions []CommandSuggestion
-
-	// Simple pattern matching for common commands
-	patterns := map[string]CommandSuggestion{
-		"list":      {Command: "ls -la", Description: "List files with details", Confidence: 0.7, Safe: true, Category: "file_management"},
-		"files":     {Command: "ls", Description: "List files", Confidence: 0.7, Safe: true, Category: "file_management"},
-		"directory": {Command: "pwd", Description: "Show current directory", Confidence: 0.7, Safe: true, Category: "navigation"},
-		"current":   {Command: "pwd", Description: "Show current directory", Confidence: 0.7, Safe: true, Category: "navigation"},
-		"copy":      {Command: "cp", Description: "Copy files", Confidence: 0.5, Safe: true, Category: "file_management"},
-		"move":      {Command: "mv", Description: "Move files", Confidence: 0.5, Safe: false, Category: "file_management"},
-		"delete":    {Command: "rm", Description: "Delete files (use with caution)", Confidence: 0.5, Safe: false, Category: "file_management"},
-		"search":    {Command: "find", Description: "Search for files", Confidence: 0.6, Safe: true, Category: "search"},
-		"git":       {Command: "git status", Description: "Show git status", Confidence: 0.8, Safe: true, Category: "development"},
-		"process":   {Command: "ps aux", Description: "Show running processes", Confidence: 0.7, Safe: true, Category: "system_info"},
-	}
-
-	// Find matching patterns
-	for pattern, suggestion := range patterns {
-		if strings.Contains(input, pattern) {
-			suggestions = append(suggestions, suggestion)
+	words := strings.Fields(input)
+	var suggestions CommandSuggestions
+	seen := make(map[string]bool)
+
+	// Find matching patterns, keeping the first match for each command
+	for _, pattern := range fallbackPatterns {
+		if seen[pattern.suggestion.Command] {
+			continue
+		}
+
+		for _, keyword := range pattern.keywords {
+			if matchesKeyword(input, words, keyword) {
+				seen[pattern.suggestion.Command] = true
+				suggestions = append(suggestions, pattern.suggestion)
+				break
+			}
 		}
 	}
 
 	// If no patterns match, provide generic suggestions
 	if len(suggestions) == 0 {
-		suggestions = []CommandSuggestion{
+		return []CommandSuggestion{
 			{
 				Command:     "echo '" + userInput + "'",
 				Description: "Echo the input text",
@@ -205,7 +590,24 @@ func (s *Service) generateFallbackSuggestions(userInput string) []CommandSuggest
 		}
 	}
 
-	return suggestions
+	return RankSuggestions(suggestions, nil, RankOptions{Limit: 3}).Suggestions()
+}
+
+// matchesKeyword reports whether a fallback keyword occurs in the input.
+// Single-word keywords match whole words (including simple plurals) so that
+// e.g. "list" does not match "listening"; phrases match as substrings.
+func matchesKeyword(input string, words []string, keyword string) bool {
+	if strings.Contains(keyword, " ") {
+		return strings.Contains(input, keyword)
+	}
+
+	for _, word := range words {
+		word = strings.Trim(word, ".,;:!?'\"")
+		if word == keyword || word == keyword+"s" || word == keyword+"es" {
+			return true
+		}
+	}
+	return false
 }
 
 // GetPromptBuilder returns the prompt builder for configuration
@@ -227,7 +629,12 @@ func (s *Service) GetAvailableModels(ctx context.Context) ([]ModelInfo, error) {
 
 	// Check if provider supports model listing
 	if modelProvider, ok := s.provider.(ModelListProvider); ok {
-		return modelProvider.GetModels(ctx)
+		models, err := modelProvider.GetModels(ctx)
+		if err == nil {
+			s.rememberContextWindows(models)
+			s.rememberPrices(models)
+		}
+		return models, err
 	}
 
 	// For providers that don't support model listing, return default models
@@ -236,21 +643,81 @@ func (s *Service) GetAvailableModels(ctx context.Context) ([]ModelInfo, error) {
 
 // SwitchProvider switches to a different provider
 func (s *Service) SwitchProvider(providerType ProviderType, config *ProviderConfig) error {
-	provider, err := s.factory.Create(providerType, config)
+	provider, err := s.createProvider(providerType, config)
 	if err != nil {
 		return fmt.Errorf("failed to create provider %s: %w", providerType, err)
 	}
 
+	// New settings like an API key may fix a failing provider
 	s.provider = provider
+	s.resetBreaker(provider.GetName())
 	return nil
 }
 
-// SwitchModel switches to a different model within the current provider
+// SetModelAliases sets the model aliases, keyed by provider name and then alias
+func (s *Service) SetModelAliases(aliases map[string]map[string]string) *Service {
+	s.modelAliases = make(map[string]map[string]string, len(aliases))
+	for provider, providerAliases := range aliases {
+		s.modelAliases[provider] = make(map[string]string, len(providerAliases))
+		for alias, model := range providerAliases {
+			s.modelAliases[provider][strings.ToLower(alias)] = model
+		}
+	}
+	return s
+}
+
+// GetModelAliases returns the model aliases defined for the current provider
+func (s *Service) GetModelAliases() map[string]string {
+	aliases := make(map[string]string)
+	for alias, model := range s.modelAliases[string(s.GetCurrentProviderType())] {
+		aliases[alias] = model
+	}
+	return aliases
+}
+
+// ResolveModelAlias resolves a model alias for the current provider.
+// Names that are not aliases are returned unchanged.
+func (s *Service) ResolveModelAlias(name string) (string, bool) {
+	providerAliases := s.modelAliases[string(s.GetCurrentProviderType())]
+	if model, ok := providerAliases[strings.ToLower(name)]; ok {
+		return model, true
+	}
+	return name, false
+}
+
+// findAliasProvider returns a provider other than the current one that defines the alias
+func (s *Service) findAliasProvider(name string) (string, bool) {
+	name = strings.ToLower(name)
+	current := string(s.GetCurrentProviderType())
+
+	var providers []string
+	for provider, providerAliases := range s.modelAliases {
+		if _, ok := providerAliases[name]; ok && provider != current {
+			providers = append(providers, provider)
+		}
+	}
+	if len(providers) == 0 {
+		return "", false
+	}
+
+	sort.Strings(providers)
+	return providers[0], true
+}
+
+// SwitchModel switches to a different model within the current provider.
+// Model aliases (e.g. "fast", "smart") are resolved first.
 func (s *Service) SwitchModel(modelName string) error {
 	if s.provider == nil {
 		return fmt.Errorf("no provider configured")
 	}
 
+	if model, ok := s.ResolveModelAlias(modelName); ok {
+		modelName = model
+	} else if provider, ok := s.findAliasProvider(modelName); ok {
+		return fmt.Errorf("alias %q is defined for provider %s, switch with /provider %s first",
+			modelName, provider, provider)
+	}
+
 	// Check if provider supports model switching
 	if modelSwitcher, ok := s.provider.(ModelSwitcher); ok {
 		return modelSwitcher.SwitchModel(modelName)
@@ -261,6 +728,145 @@ func (s *Service) SwitchModel(modelName string) error {
 	return fmt.Errorf("current provider does not support dynamic model switching")
 }
 
+// ValidateModel resolves a model alias and checks the model against the
+// models the current provider lists. Models of providers that cannot list
+// their models, or not right now, are accepted as they are.
+func (s *Service) ValidateModel(ctx context.Context, modelName string) (string, error) {
+	if s.provider == nil {
+		return "", fmt.Errorf("no provider configured")
+	}
+
+	if model, ok := s.ResolveModelAlias(modelName); ok {
+		modelName = model
+	} else if provider, ok := s.findAliasProvider(modelName); ok {
+		return "", fmt.Errorf("alias %q is defined for provider %s, switch with /provider %s first",
+			modelName, provider, provider)
+	}
+
+	lister, ok := s.provider.(ModelListProvider)
+	if !ok {
+		return modelName, nil
+	}
+	models, err := lister.GetModels(ctx)
+	if err != nil || len(models) == 0 {
+		return modelName, nil
+	}
+	for _, model := range models {
+		if strings.EqualFold(model.ID, modelName) {
+			return model.ID, nil
+		}
+	}
+	return "", fmt.Errorf("unknown model %q for %s, see /model for the available models", modelName, s.provider.GetName())
+}
+
+// SuggestCommandsWithModel suggests commands like SuggestCommands using
+// another model of the current provider for this request only. The model
+// is validated with ValidateModel and the current model is restored
+// afterwards, even if the request fails.
+func (s *Service) SuggestCommandsWithModel(ctx context.Context, userInput, modelName string) (*CompletionResponse, error) {
+	if s.offline {
+		return s.SuggestCommands(ctx, userInput)
+	}
+
+	modelName, err := s.ValidateModel(ctx, modelName)
+	if err != nil {
+		return nil, err
+	}
+	switcher, ok := s.provider.(ModelSwitcher)
+	if !ok {
+		return nil, fmt.Errorf("current provider does not support dynamic model switching")
+	}
+
+	s.overrideMu.Lock()
+	defer s.overrideMu.Unlock()
+
+	previous := s.provider.GetModel()
+	if err := switcher.SwitchModel(modelName); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := switcher.SwitchModel(previous); err != nil {
+			log.Printf("Warning: failed to restore model %s: %v", previous, err)
+		}
+	}()
+
+	return s.SuggestCommands(ctx, userInput)
+}
+
+// providerProbeTimeout bounds each live provider check
+const providerProbeTimeout = 10 * time.Second
+
+// ProviderProbe is the result of a live check of one provider
+type ProviderProbe struct {
+	Type       ProviderType
+	Configured bool // Enough settings (e.g. an API key) to send requests
+	Current    bool
+	Reachable  bool
+	Latency    time.Duration
+	Error      error
+}
+
+// ProbeProviders checks every supported provider with a tiny live request and
+// returns the results sorted by provider name. The current provider is checked
+// as it is set up, including API keys entered at runtime; other providers use
+// the key returned by keyFor.
+func (s *Service) ProbeProviders(ctx context.Context, keyFor func(ProviderType) string) []ProviderProbe {
+	status := s.GetProviderStatus()
+	probes := make([]ProviderProbe, 0, len(status))
+	for providerType, info := range status {
+		probes = append(probes, ProviderProbe{Type: providerType, Current: info.Current})
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].Type < probes[j].Type })
+
+	var wg sync.WaitGroup
+	for i := range probes {
+		wg.Add(1)
+		go func(probe *ProviderProbe) {
+			defer wg.Done()
+			s.probeProvider(ctx, probe, keyFor)
+		}(&probes[i])
+	}
+	wg.Wait()
+
+	return probes
+}
+
+// probeProvider fills in the live check result of one provider
+func (s *Service) probeProvider(ctx context.Context, probe *ProviderProbe, keyFor func(ProviderType) string) {
+	provider := s.provider
+	if !probe.Current {
+		config := DefaultProviderConfig(probe.Type)
+		if keyFor != nil {
+			config.APIKey = keyFor(probe.Type)
+		}
+
+		var err error
+		if provider, err = s.createProvider(probe.Type, config); err != nil {
+			probe.Error = err
+			return
+		}
+	}
+
+	probe.Configured = provider.IsConfigured()
+	if !probe.Configured {
+		return
+	}
+
+	tester, ok := provider.(ConnectionTester)
+	if !ok {
+		probe.Error = fmt.Errorf("no live check available")
+		return
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, providerProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	probe.Error = tester.TestConnection(probeCtx)
+	probe.Latency = time.Since(start)
+	probe.Reachable = probe.Error == nil
+}
+
 // GetProviderStatus returns status information for all supported providers
 func (s *Service) GetProviderStatus() map[ProviderType]ProviderStatusInfo {
 	status := make(map[ProviderType]ProviderStatusInfo)
@@ -301,7 +907,7 @@ func (s *Service) ValidateAPIKey(providerType ProviderType, apiKey string) error
 	config := DefaultProviderConfig(providerType)
 	config.APIKey = apiKey
 
-	provider, err := s.factory.Create(providerType, config)
+	provider, err := s.createProvider(providerType, config)
 	if err != nil {
 		return fmt.Errorf("failed to create provider: %w", err)
 	}
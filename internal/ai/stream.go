@@ -0,0 +1,247 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// CompleteStream performs req with any provider, passing the answer to
+// onChunk as it arrives. Providers implementing TextStreamer stream it; the
+// answer of other providers is passed in one piece once it is complete. A nil
+// onChunk makes it a plain completion.
+func CompleteStream(ctx context.Context, provider LLMProvider, req *CompletionRequest, onChunk func(string)) (*CompletionResponse, error) {
+	if streamer, ok := provider.(TextStreamer); ok && onChunk != nil {
+		return streamer.StreamText(ctx, req, onChunk)
+	}
+
+	response, err := provider.Complete(ctx, req)
+	if err == nil && onChunk != nil {
+		onChunk(response.Content)
+	}
+	return response, err
+}
+
+// streamChatCompletion sends chatReq as a streaming request and passes the
+// text to onChunk as it arrives. It returns the whole text and whether the
+// answer was cut off by the token limit.
+func streamChatCompletion(ctx context.Context, client *openai.Client, chatReq openai.ChatCompletionRequest, onChunk func(string)) (string, bool, error) {
+	chatReq.Stream = true
+	stream, err := client.CreateChatCompletionStream(ctx, chatReq)
+	if err != nil {
+		return "", false, err
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	truncated := false
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return content.String(), truncated, nil
+		}
+		if err != nil {
+			return content.String(), truncated, err
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		choice := resp.Choices[0]
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			onChunk(choice.Delta.Content)
+		}
+		if choice.FinishReason == openai.FinishReasonLength {
+			truncated = true
+		}
+	}
+}
+
+// chatRequest builds the single-message chat request of req
+func chatRequest(config *ProviderConfig, req *CompletionRequest) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model: config.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: req.Prompt,
+			},
+		},
+		MaxTokens:   config.RequestMaxTokens(req),
+		Temperature: config.RequestTemperature(req),
+	}
+}
+
+// StreamText implements TextStreamer
+func (p *OpenAIProvider) StreamText(ctx context.Context, req *CompletionRequest, onChunk func(string)) (*CompletionResponse, error) {
+	if p.client == nil {
+		return nil, NewAIError(ErrorTypeAuth, "OpenAI client not configured", nil)
+	}
+
+	if p.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.Timeout)
+		defer cancel()
+	}
+
+	content, truncated, err := streamChatCompletion(ctx, p.client, chatRequest(p.config, req), onChunk)
+	if err != nil {
+		return nil, p.handleOpenAIError(err)
+	}
+
+	return &CompletionResponse{
+		Content:   content,
+		Model:     p.config.Model,
+		Provider:  p.GetName(),
+		Truncated: truncated,
+	}, nil
+}
+
+// StreamText implements TextStreamer
+func (p *OpenRouterProvider) StreamText(ctx context.Context, req *CompletionRequest, onChunk func(string)) (*CompletionResponse, error) {
+	if p.client == nil {
+		return nil, NewAIError(ErrorTypeAuth, "OpenRouter client not configured", nil)
+	}
+
+	if p.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.Timeout)
+		defer cancel()
+	}
+
+	content, truncated, err := streamChatCompletion(ctx, p.client, chatRequest(p.config, req), onChunk)
+	if err != nil {
+		return nil, p.handleOpenRouterError(err)
+	}
+
+	return &CompletionResponse{
+		Content:   content,
+		Model:     p.config.Model,
+		Provider:  p.GetName(),
+		Truncated: truncated,
+	}, nil
+}
+
+// StreamText implements TextStreamer; Ollama streams one JSON object per line
+func (p *OllamaProvider) StreamText(ctx context.Context, req *CompletionRequest, onChunk func(string)) (*CompletionResponse, error) {
+	if !p.IsConfigured() {
+		return nil, NewAIError(ErrorTypeValidation, "Ollama provider not configured", nil)
+	}
+
+	if p.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.Timeout)
+		defer cancel()
+	}
+
+	body, err := json.Marshal(ollamaChatRequest{
+		Model: p.config.Model,
+		Messages: []ollamaChatMessage{
+			{Role: "user", Content: req.Prompt},
+		},
+		Stream: true,
+		Options: map[string]interface{}{
+			"temperature": p.config.RequestTemperature(req),
+			"num_predict": p.config.RequestMaxTokens(req),
+		},
+	})
+	if err != nil {
+		return nil, NewAIError(ErrorTypeValidation, "failed to encode Ollama request", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint("/api/chat"), bytes.NewReader(body))
+	if err != nil {
+		return nil, NewAIError(ErrorTypeValidation, "failed to create Ollama request", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, p.handleOllamaError(err)
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var last ollamaChatResponse
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return nil, NewAIError(ErrorTypeParsing, "failed to parse Ollama response", err)
+		}
+		if chunk.Error != "" {
+			return nil, NewAIError(ErrorTypeUnknown, fmt.Sprintf("Ollama API error: %s", chunk.Error), nil)
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onChunk(chunk.Message.Content)
+		}
+		last = chunk
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, p.handleOllamaError(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, NewAIError(ErrorTypeUnknown, fmt.Sprintf("Ollama API error: %s", resp.Status), nil)
+	}
+
+	return &CompletionResponse{
+		Content: content.String(),
+		Usage: &UsageInfo{
+			PromptTokens:     last.PromptEvalCount,
+			CompletionTokens: last.EvalCount,
+			TotalTokens:      last.PromptEvalCount + last.EvalCount,
+		},
+		Model:     p.config.Model,
+		Provider:  p.GetName(),
+		Truncated: last.DoneReason == "length",
+	}, nil
+}
+
+// Ask answers a general question in plain text, like "what's the difference
+// between tar -c and -x", without suggesting commands. The answer is passed
+// to onChunk as it arrives; providers that cannot stream pass it in one piece.
+func (s *Service) Ask(ctx context.Context, question string, onChunk func(string)) (*CompletionResponse, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, fmt.Errorf("no question to answer")
+	}
+
+	if s.offline {
+		return nil, fmt.Errorf("answering questions needs an AI provider (offline mode is on)")
+	}
+
+	if s.provider == nil || !s.provider.IsConfigured() {
+		return nil, fmt.Errorf("no LLM provider configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+
+	req := &CompletionRequest{
+		Prompt:      s.promptBuilder.BuildQuestionPrompt(question),
+		Temperature: s.creativity.Temperature(),
+	}
+
+	response, err := s.guard(req, func() (*CompletionResponse, error) {
+		return CompleteStream(ctx, s.provider, req, onChunk)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("LLM completion failed: %w", err)
+	}
+
+	// An answer is never a command to run
+	response.Suggestions = nil
+	response.Unparsed = false
+	return response, nil
+}
@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// charsPerToken is the average length of a token in English text and code;
+// estimates err on the high side for prose and the low side for symbols
+const charsPerToken = 4
+
+// defaultResponseTokens is reserved for the answer when no token limit is set
+const defaultResponseTokens = 500
+
+// knownContextWindows lists the context length of common models by ID
+// prefix, for providers that do not report it. Longer prefixes win.
+var knownContextWindows = map[string]int{
+	"gpt-3.5-turbo": 16385,
+	"gpt-4":         8192,
+	"gpt-4-32k":     32768,
+	"gpt-4-turbo":   128000,
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"o1":            200000,
+	"o3":            200000,
+	"claude-3":      200000,
+	"llama2":        4096,
+	"llama3":        8192,
+	"llama3.1":      131072,
+	"codellama":     16384,
+	"mistral":       32768,
+	"phi3":          4096,
+	"z-ai/glm-4.5":  131072,
+}
+
+// EstimateTokens roughly estimates the number of tokens text takes up
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// PromptEstimate is the estimated size of a request against the context
+// window of the model it is sent to
+type PromptEstimate struct {
+	Model          string
+	PromptTokens   int
+	ResponseTokens int // Reserved for the answer
+	ContextWindow  int // 0 if the context length of the model is unknown
+}
+
+// Exceeds reports whether the prompt and the answer do not fit the context window
+func (e PromptEstimate) Exceeds() bool {
+	return e.ContextWindow > 0 && e.PromptTokens+e.ResponseTokens > e.ContextWindow
+}
+
+// String describes the estimate, e.g. "~1200 prompt tokens + 500 for the
+// answer of 4096 (llama2)"
+func (e PromptEstimate) String() string {
+	window := "unknown context window"
+	if e.ContextWindow > 0 {
+		window = fmt.Sprintf("%d", e.ContextWindow)
+	}
+	return fmt.Sprintf("~%d prompt tokens + %d for the answer of %s (%s)",
+		e.PromptTokens, e.ResponseTokens, window, e.Model)
+}
+
+// ContextWindow returns the context length of model: as reported by the
+// provider when its models were listed, or from the known models. It returns
+// 0 if the context length is unknown.
+func (s *Service) ContextWindow(model string) int {
+	s.contextMu.Lock()
+	window, ok := s.contextWindows[model]
+	s.contextMu.Unlock()
+	if ok {
+		return window
+	}
+
+	best := ""
+	for prefix, length := range knownContextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, window = prefix, length
+		}
+	}
+	return window
+}
+
+// rememberContextWindows keeps the context lengths of listed models
+func (s *Service) rememberContextWindows(models []ModelInfo) {
+	s.contextMu.Lock()
+	defer s.contextMu.Unlock()
+
+	if s.contextWindows == nil {
+		s.contextWindows = make(map[string]int)
+	}
+	for _, model := range models {
+		if model.ContextSize > 0 {
+			s.contextWindows[model.ID] = model.ContextSize
+		}
+	}
+}
+
+// estimatePrompt estimates the size of promptText sent to the current model
+func (s *Service) estimatePrompt(promptText string) PromptEstimate {
+	model := s.provider.GetModel()
+	responseTokens := s.maxTokens
+	if responseTokens <= 0 {
+		responseTokens = defaultResponseTokens
+	}
+	return PromptEstimate{
+		Model:          model,
+		PromptTokens:   EstimateTokens(promptText),
+		ResponseTokens: responseTokens,
+		ContextWindow:  s.ContextWindow(model),
+	}
+}
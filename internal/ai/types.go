@@ -2,6 +2,9 @@ package ai
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,6 +14,18 @@ type CompletionRequest struct {
 	MaxTokens   int               `json:"max_tokens,omitempty"`
 	Temperature float32           `json:"temperature,omitempty"`
 	Context     map[string]string `json:"context,omitempty"`
+	// Choices asks for that many independent answers at once, their suggestions
+	// flattened into one list; providers without support return a single one
+	Choices int `json:"choices,omitempty"`
+}
+
+// RequestedChoices returns the number of answers to ask the API for, or 0
+// when a single one is wanted and the request can leave the field out
+func (r *CompletionRequest) RequestedChoices() int {
+	if r == nil || r.Choices <= 1 {
+		return 0
+	}
+	return r.Choices
 }
 
 // CompletionResponse represents a response from an LLM provider
@@ -20,6 +35,10 @@ type CompletionResponse struct {
 	Usage       *UsageInfo          `json:"usage,omitempty"`
 	Model       string              `json:"model,omitempty"`
 	Provider    string              `json:"provider,omitempty"`
+	Cached      bool                `json:"cached,omitempty"`    // Served from the suggestion cache
+	Truncated   bool                `json:"truncated,omitempty"` // Generation stopped at the max_tokens limit
+	Unparsed    bool                `json:"unparsed,omitempty"`  // Content was not suggestion JSON and is used as the command as is
+	Estimate    *PromptEstimate     `json:"estimate,omitempty"`  // Estimated size of the request, see EstimateTokens
 }
 
 // CommandSuggestion represents a suggested command
@@ -31,11 +50,28 @@ type CommandSuggestion struct {
 	Category    string  `json:"category,omitempty"`
 }
 
-// UsageInfo represents token usage information
+// UsageInfo represents token usage information.
+// Timing fields are only reported by local providers such as Ollama.
 type UsageInfo struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	TotalTokens      int           `json:"total_tokens"`
+	TotalDuration    time.Duration `json:"total_duration,omitempty"`
+	LoadDuration     time.Duration `json:"load_duration,omitempty"`
+	EvalDuration     time.Duration `json:"eval_duration,omitempty"`
+}
+
+// HasTiming returns true if the provider reported timing information
+func (u *UsageInfo) HasTiming() bool {
+	return u != nil && (u.TotalDuration > 0 || u.EvalDuration > 0)
+}
+
+// TokensPerSecond returns the generation speed, or 0 if it is unknown
+func (u *UsageInfo) TokensPerSecond() float64 {
+	if u == nil || u.EvalDuration <= 0 {
+		return 0
+	}
+	return float64(u.CompletionTokens) / u.EvalDuration.Seconds()
 }
 
 // ProviderConfig represents configuration for an LLM provider
@@ -47,18 +83,100 @@ type ProviderConfig struct {
 	Timeout     time.Duration `json:"timeout"`
 	MaxTokens   int           `json:"max_tokens"`
 	Temperature float32       `json:"temperature"`
+	// Headers are sent with every request, e.g. for API gateways; values may reference $ENV_VARS
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// RequestTemperature returns the temperature requested by req, falling back to the
+// provider default when the request does not set one
+func (c *ProviderConfig) RequestTemperature(req *CompletionRequest) float32 {
+	if req != nil && req.Temperature > 0 {
+		return req.Temperature
+	}
+	return c.Temperature
+}
+
+// RequestMaxTokens returns the token limit requested by req, falling back to the
+// provider default when the request does not set one
+func (c *ProviderConfig) RequestMaxTokens(req *CompletionRequest) int {
+	if req != nil && req.MaxTokens > 0 {
+		return req.MaxTokens
+	}
+	return c.MaxTokens
+}
+
+// Creativity is a session-level preset for the sampling temperature of suggestions
+type Creativity string
+
+const (
+	CreativityDefault Creativity = ""       // Use the provider's configured temperature
+	CreativityLow     Creativity = "low"    // Deterministic, conventional suggestions
+	CreativityMedium  Creativity = "medium" // Balanced suggestions
+	CreativityHigh    Creativity = "high"   // More varied suggestions
+)
+
+// creativityLevels lists the presets from least to most creative
+var creativityLevels = []Creativity{CreativityLow, CreativityMedium, CreativityHigh}
+
+// ParseCreativity parses a creativity preset name
+func ParseCreativity(name string) (Creativity, error) {
+	creativity := Creativity(strings.ToLower(strings.TrimSpace(name)))
+	for _, level := range creativityLevels {
+		if creativity == level {
+			return creativity, nil
+		}
+	}
+	return CreativityDefault, fmt.Errorf("unknown creativity %q (expected low, medium or high)", name)
+}
+
+// Temperature returns the sampling temperature of the preset, or 0 for the provider default
+func (c Creativity) Temperature() float32 {
+	switch c {
+	case CreativityLow:
+		return 0.2
+	case CreativityMedium:
+		return 0.7
+	case CreativityHigh:
+		return 1.2
+	default:
+		return 0
+	}
+}
+
+// Step returns the preset delta levels above (or below, if negative) c, clamped to
+// the available presets. The default preset steps from medium.
+func (c Creativity) Step(delta int) Creativity {
+	index := 1
+	for i, level := range creativityLevels {
+		if c == level {
+			index = i
+		}
+	}
+
+	index += delta
+	if index < 0 {
+		index = 0
+	} else if index >= len(creativityLevels) {
+		index = len(creativityLevels) - 1
+	}
+	return creativityLevels[index]
 }
 
 // Error types for AI operations
 type ErrorType string
 
 const (
-	ErrorTypeAuth       ErrorType = "auth_error"
-	ErrorTypeNetwork    ErrorType = "network_error"
-	ErrorTypeRateLimit  ErrorType = "rate_limit_error"
-	ErrorTypeValidation ErrorType = "validation_error"
-	ErrorTypeParsing    ErrorType = "parsing_error"
-	ErrorTypeUnknown    ErrorType = "unknown_error"
+	ErrorTypeAuth          ErrorType = "auth_error"
+	ErrorTypeNetwork       ErrorType = "network_error"
+	ErrorTypeTimeout       ErrorType = "timeout_error"
+	ErrorTypeRateLimit     ErrorType = "rate_limit_error"
+	ErrorTypeValidation    ErrorType = "validation_error"
+	ErrorTypeParsing       ErrorType = "parsing_error"
+	ErrorTypeTruncated     ErrorType = "truncated_error"
+	ErrorTypeContextLength ErrorType = "context_length_error" // The prompt does not fit the context window of the model
+	ErrorTypeUnavailable   ErrorType = "unavailable_error"    // Skipped by the circuit breaker after repeated failures
+	ErrorTypeBudget        ErrorType = "budget_error"         // The session budget is spent, see Service.SetBudget
+	ErrorTypeUnknown       ErrorType = "unknown_error"
 )
 
 // AIError represents an AI-specific error
@@ -132,14 +250,52 @@ func (cs CommandSuggestions) Top(n int) CommandSuggestions {
 	return cs[:n]
 }
 
+// CategoryKey normalizes a suggestion category, so "File Management" and
+// "file_management" are the same category
+func CategoryKey(category string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(category, "_", " ")), "_"))
+}
+
+// GroupByCategory returns the suggestions with those of the same category
+// next to each other. Groups are ordered by their first suggestion, and
+// suggestions keep their order within a group.
+func (cs CommandSuggestions) GroupByCategory() CommandSuggestions {
+	rank := make(map[string]int)
+	for _, cmd := range cs {
+		if _, ok := rank[CategoryKey(cmd.Category)]; !ok {
+			rank[CategoryKey(cmd.Category)] = len(rank)
+		}
+	}
+
+	grouped := make(CommandSuggestions, len(cs))
+	copy(grouped, cs)
+	sort.SliceStable(grouped, func(i, j int) bool {
+		return rank[CategoryKey(grouped[i].Category)] < rank[CategoryKey(grouped[j].Category)]
+	})
+	return grouped
+}
+
+// MixedCategories reports whether the suggestions span more than one category
+func (cs CommandSuggestions) MixedCategories() bool {
+	for _, cmd := range cs {
+		if CategoryKey(cmd.Category) != CategoryKey(cs[0].Category) {
+			return true
+		}
+	}
+	return false
+}
+
 // ModelInfo represents information about an AI model
 type ModelInfo struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Pricing     string `json:"pricing"`
-	ContextSize int    `json:"context_length"`
-	Current     bool   `json:"current"`
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Description     string  `json:"description"`
+	Pricing         string  `json:"pricing"`
+	Price           float64 `json:"price,omitempty"`            // Dollars per 1k prompt and 1k completion tokens; 0 if free or unknown
+	PromptPrice     float64 `json:"prompt_price,omitempty"`     // Dollars per prompt token; 0 if free or unknown
+	CompletionPrice float64 `json:"completion_price,omitempty"` // Dollars per completion token; 0 if free or unknown
+	ContextSize     int     `json:"context_length"`
+	Current         bool    `json:"current"`
 }
 
 // ProviderStatusInfo represents the status of a provider
@@ -162,6 +318,11 @@ type ModelSwitcher interface {
 	SwitchModel(modelName string) error
 }
 
+// TextStreamer interface for providers that can stream plain-text answers
+type TextStreamer interface {
+	StreamText(ctx context.Context, req *CompletionRequest, onChunk func(string)) (*CompletionResponse, error)
+}
+
 // ConnectionTester interface for providers that support connection testing
 type ConnectionTester interface {
 	TestConnection(ctx context.Context) error
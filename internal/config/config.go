@@ -1,15 +1,37 @@
 package config
 
 import (
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/yourusername/clia/internal/termcaps"
 )
 
 // Config represents the application configuration
 type Config struct {
+	// Version is the layout version of the file, see CurrentConfigVersion
+	Version int `yaml:"version" mapstructure:"version"`
+
 	API      APIConfig      `yaml:"api" mapstructure:"api"`
 	UI       UIConfig       `yaml:"ui" mapstructure:"ui"`
 	Behavior BehaviorConfig `yaml:"behavior" mapstructure:"behavior"`
 	Context  ContextConfig  `yaml:"context" mapstructure:"context"`
+	Memory   MemoryConfig   `yaml:"memory" mapstructure:"memory"`
+	Logs     LogsConfig     `yaml:"logs" mapstructure:"logs"`
+
+	// Templates are parameterized requests keyed by name, run with `/run <name> var=value`
+	Templates map[string]RequestTemplate `yaml:"templates,omitempty" mapstructure:"templates"`
+
+	// Favorites are commands run from the favorites bar, without AI
+	Favorites []string `yaml:"favorites,omitempty" mapstructure:"favorites"`
+}
+
+// RequestTemplate is a request with {{variable}} placeholders, e.g. "deploy to {{env}}".
+// Requests following the pattern are sent to the AI with the prompt filled in.
+type RequestTemplate struct {
+	Pattern string `yaml:"pattern" mapstructure:"pattern"`
+	Prompt  string `yaml:"prompt,omitempty" mapstructure:"prompt"`
 }
 
 // APIConfig contains LLM API configuration
@@ -18,9 +40,11 @@ type APIConfig struct {
 	Key         string              `yaml:"key" mapstructure:"key"`
 	Model       string              `yaml:"model" mapstructure:"model"`
 	Endpoint    string              `yaml:"endpoint" mapstructure:"endpoint"`
-	Timeout     time.Duration       `yaml:"timeout" mapstructure:"timeout"`
+	Timeout     time.Duration       `yaml:"timeout" mapstructure:"timeout"` // How long a suggestion request may take, not the command run
 	MaxTokens   int                 `yaml:"max_tokens" mapstructure:"max_tokens"`
 	Temperature float32             `yaml:"temperature" mapstructure:"temperature"`
+	Choices     int                 `yaml:"choices" mapstructure:"choices"`   // Answers requested at once per suggestion request, merged into one list
+	MaxCost     float64             `yaml:"max_cost" mapstructure:"max_cost"` // Dollars the requests of a session may cost; 0 is no limit
 	Providers   map[string]Provider `yaml:"providers" mapstructure:"providers"`
 }
 
@@ -31,13 +55,69 @@ type Provider struct {
 	Endpoint    string  `yaml:"endpoint" mapstructure:"endpoint"`
 	MaxTokens   int     `yaml:"max_tokens" mapstructure:"max_tokens"`
 	Temperature float32 `yaml:"temperature" mapstructure:"temperature"`
+	// Aliases maps friendly names (e.g. "fast", "smart") to model IDs for this provider
+	Aliases map[string]string `yaml:"aliases" mapstructure:"aliases"`
+	// Headers are extra HTTP headers sent with every request (e.g. for API
+	// gateways); values may reference environment variables like ${ORG_ID}
+	Headers map[string]string `yaml:"headers,omitempty" mapstructure:"headers"`
 }
 
 // UIConfig contains user interface configuration
 type UIConfig struct {
-	Theme       string `yaml:"theme" mapstructure:"theme"`
+	Theme       string `yaml:"theme" mapstructure:"theme"` // "none" disables colors
 	Language    string `yaml:"language" mapstructure:"language"`
 	HistorySize int    `yaml:"history_size" mapstructure:"history_size"`
+
+	// Always show one line per suggestion; narrow terminals get this layout automatically
+	CompactSuggestions bool `yaml:"compact_suggestions" mapstructure:"compact_suggestions"`
+
+	// Override what is detected from the terminal; "auto" keeps the detected value
+	Colors    string `yaml:"colors" mapstructure:"colors"`       // "truecolor", "256", "16" or "none"
+	Emoji     string `yaml:"emoji" mapstructure:"emoji"`         // "on" or "off" for ASCII symbols
+	Clipboard string `yaml:"clipboard" mapstructure:"clipboard"` // "native", "osc52" or "both"
+
+	// How answers of ask appear: "stream" shows them as they arrive, "buffered"
+	// once complete with fewer redraws, "auto" buffers them over SSH only
+	AnswerRendering string `yaml:"answer_rendering" mapstructure:"answer_rendering"`
+
+	// Animation shown while waiting: "classic", "dots", "line", "bounce" or "pulse"
+	Spinner string `yaml:"spinner" mapstructure:"spinner"`
+
+	// Message shown while the AI works on a request; empty picks one for the language
+	ThinkingMessage string `yaml:"thinking_message" mapstructure:"thinking_message"`
+
+	// Show JSON and YAML command output formatted after the raw output
+	FormatOutput bool `yaml:"format_output" mapstructure:"format_output"`
+}
+
+// BufferAnswers reports whether answers should be shown once complete rather
+// than as they stream in, over SSH if ssh is set
+func (c UIConfig) BufferAnswers(ssh bool) bool {
+	switch strings.ToLower(c.AnswerRendering) {
+	case "buffered":
+		return true
+	case "stream":
+		return false
+	default:
+		return ssh
+	}
+}
+
+// ThinkingText returns the message shown while the AI works on a request
+func (c UIConfig) ThinkingText() string {
+	switch {
+	case c.ThinkingMessage != "":
+		return c.ThinkingMessage
+	case strings.HasPrefix(strings.ToLower(c.Language), "zh"):
+		return "思考中"
+	default:
+		return "Thinking"
+	}
+}
+
+// TerminalSettings returns the terminal capability overrides of the config
+func (c UIConfig) TerminalSettings() termcaps.Settings {
+	return termcaps.Settings{Colors: c.Colors, Emoji: c.Emoji, Clipboard: c.Clipboard}
 }
 
 // BehaviorConfig contains application behavior settings
@@ -45,6 +125,22 @@ type BehaviorConfig struct {
 	AutoExecuteSafeCommands  bool `yaml:"auto_execute_safe_commands" mapstructure:"auto_execute_safe_commands"`
 	ConfirmDangerousCommands bool `yaml:"confirm_dangerous_commands" mapstructure:"confirm_dangerous_commands"`
 	CollectUsageStats        bool `yaml:"collect_usage_stats" mapstructure:"collect_usage_stats"`
+
+	// Ask for confirmation before every suggested command, not just dangerous ones (paranoid mode)
+	ConfirmAll bool `yaml:"confirm_all" mapstructure:"confirm_all"`
+
+	// Copy a command to the clipboard whenever it is selected, before it runs
+	CopyOnSelect bool `yaml:"copy_on_select" mapstructure:"copy_on_select"`
+
+	// Treat suggestions that only differ in flag order or quoting (ls -la, ls -al) as duplicates
+	NormalizeSuggestions bool `yaml:"normalize_suggestions" mapstructure:"normalize_suggestions"`
+
+	// File of extra danger patterns; danger_patterns.yaml in the config directory when empty
+	DangerPatternsFile string `yaml:"danger_patterns_file,omitempty" mapstructure:"danger_patterns_file"`
+
+	// Write the full output of every executed command to the runs directory for auditing
+	LogRuns          bool `yaml:"log_runs" mapstructure:"log_runs"`
+	RunLogsStripANSI bool `yaml:"run_logs_strip_ansi" mapstructure:"run_logs_strip_ansi"`
 }
 
 // ContextConfig contains context collection settings
@@ -52,24 +148,66 @@ type ContextConfig struct {
 	IncludeHiddenFiles bool `yaml:"include_hidden_files" mapstructure:"include_hidden_files"`
 	MaxFilesInContext  int  `yaml:"max_files_in_context" mapstructure:"max_files_in_context"`
 	IncludeEnvVars     bool `yaml:"include_env_vars" mapstructure:"include_env_vars"`
+
+	// Add a detailed directory listing to requests that mention files ("these", "*.jpg")
+	IncludeDirectoryListing bool `yaml:"include_directory_listing" mapstructure:"include_directory_listing"`
+	MaxListingFiles         int  `yaml:"max_listing_files" mapstructure:"max_listing_files"`
+}
+
+// MemoryConfig contains command memory settings
+type MemoryConfig struct {
+	// Changes are saved once memory has been idle for SaveDelay, and at the latest after MaxSaveDelay
+	SaveDelay    time.Duration `yaml:"save_delay" mapstructure:"save_delay"`
+	MaxSaveDelay time.Duration `yaml:"max_save_delay" mapstructure:"max_save_delay"`
+
+	// With --auto, one-shot mode runs a remembered command without asking the AI
+	// when it was remembered for the same request, used at least AutoRunMinUses
+	// times, succeeded last time and scores at least AutoRunMinScore in memory
+	// search; 0 uses turn this off
+	AutoRunMinUses  int     `yaml:"auto_run_min_uses" mapstructure:"auto_run_min_uses"`
+	AutoRunMinScore float64 `yaml:"auto_run_min_score" mapstructure:"auto_run_min_score"`
+
+	// Remembered commands that have not run successfully for TTL are forgotten
+	// at startup, unless pinned with `clia memory pin`; 0 keeps them
+	TTL time.Duration `yaml:"ttl" mapstructure:"ttl"`
+}
+
+// LogsConfig contains the command history file and the size limits of it and the run logs
+type LogsConfig struct {
+	// Append a record of every executed command to the history file next to the config file
+	History       bool   `yaml:"history" mapstructure:"history"`
+	HistoryFormat string `yaml:"history_format" mapstructure:"history_format"` // jsonl or text
+
+	// The history file and run logs roll over to numbered files (history.jsonl.1, ...) at this size; 0 never rolls over
+	MaxFileSizeMB int `yaml:"max_file_size_mb" mapstructure:"max_file_size_mb"`
+	// Rolled-over files kept per log; older ones are deleted
+	MaxFiles int `yaml:"max_files" mapstructure:"max_files"`
+	// Run logs and rolled-over files older than this many days are deleted; 0 keeps them
+	RetentionDays int `yaml:"retention_days" mapstructure:"retention_days"`
 }
 
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
+		Version: CurrentConfigVersion,
 		API: APIConfig{
 			Provider:    "openai",
 			Model:       "gpt-3.5-turbo",
 			Endpoint:    "https://api.openai.com/v1",
-			Timeout:     10 * time.Second,
+			Timeout:     30 * time.Second,
 			MaxTokens:   1000,
 			Temperature: 0.7,
+			Choices:     1,
 			Providers: map[string]Provider{
 				"openai": {
 					Model:       "gpt-3.5-turbo",
 					Endpoint:    "https://api.openai.com/v1",
 					MaxTokens:   1000,
 					Temperature: 0.7,
+					Aliases: map[string]string{
+						"fast":  "gpt-3.5-turbo",
+						"smart": "gpt-4o",
+					},
 				},
 				"anthropic": {
 					Model:       "claude-3-sonnet-20240229",
@@ -88,6 +226,10 @@ func DefaultConfig() *Config {
 					Endpoint:    "https://openrouter.ai/api/v1",
 					MaxTokens:   1000,
 					Temperature: 0.7,
+					Aliases: map[string]string{
+						"fast":  "z-ai/glm-4.5-air:free",
+						"smart": "anthropic/claude-3.5-sonnet",
+					},
 				},
 			},
 		},
@@ -95,16 +237,86 @@ func DefaultConfig() *Config {
 			Theme:       "dark",
 			Language:    "en",
 			HistorySize: 100,
+			Colors:      "auto",
+			Emoji:       "auto",
+			Clipboard:   "auto",
+
+			AnswerRendering: "auto",
+			Spinner:         "classic",
 		},
 		Behavior: BehaviorConfig{
 			AutoExecuteSafeCommands:  false,
 			ConfirmDangerousCommands: true,
 			CollectUsageStats:        false,
+			NormalizeSuggestions:     true,
 		},
 		Context: ContextConfig{
 			IncludeHiddenFiles: false,
 			MaxFilesInContext:  50,
 			IncludeEnvVars:     false,
+
+			IncludeDirectoryListing: false,
+			MaxListingFiles:         50,
+		},
+		Memory: MemoryConfig{
+			SaveDelay:    2 * time.Second,
+			MaxSaveDelay: 30 * time.Second,
+
+			AutoRunMinUses:  5,
+			AutoRunMinScore: 0.8,
 		},
+		Logs: LogsConfig{
+			History:       false,
+			HistoryFormat: "jsonl",
+			MaxFileSizeMB: 10,
+			MaxFiles:      5,
+			RetentionDays: 30,
+		},
+	}
+}
+
+// ProviderSetupInfo describes how to get started with a provider during first-run setup
+type ProviderSetupInfo struct {
+	Name        string // Provider name as used by /provider
+	Description string // Short description shown in the setup menu
+	KeyURL      string // Where to obtain an API key (or install the provider)
+	EnvVar      string // Environment variable that overrides the stored key
+	RequiresKey bool   // Whether an API key is needed
+}
+
+// SetupProviders returns the providers offered by first-run setup, in menu order
+func SetupProviders() []ProviderSetupInfo {
+	return []ProviderSetupInfo{
+		{
+			Name:        "openrouter",
+			Description: "Many models behind one key, including free ones",
+			KeyURL:      "https://openrouter.ai/keys",
+			EnvVar:      "OPENROUTER_API_KEY",
+			RequiresKey: true,
+		},
+		{
+			Name:        "openai",
+			Description: "GPT models from OpenAI",
+			KeyURL:      "https://platform.openai.com/api-keys",
+			EnvVar:      "OPENAI_API_KEY",
+			RequiresKey: true,
+		},
+		{
+			Name:        "ollama",
+			Description: "Local models, no API key needed",
+			KeyURL:      "https://ollama.com/download",
+			RequiresKey: false,
+		},
+	}
+}
+
+// FindSetupProvider looks up a setup provider by menu number (1-based) or name
+func FindSetupProvider(choice string) (ProviderSetupInfo, bool) {
+	choice = strings.ToLower(strings.TrimSpace(choice))
+	for i, info := range SetupProviders() {
+		if choice == info.Name || choice == strconv.Itoa(i+1) {
+			return info, true
+		}
 	}
+	return ProviderSetupInfo{}, false
 }
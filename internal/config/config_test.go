@@ -1,8 +1,14 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/yourusername/clia/pkg/utils"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -21,8 +27,8 @@ func TestDefaultConfig(t *testing.T) {
 		t.Errorf("Expected model 'gpt-3.5-turbo', got '%s'", cfg.API.Model)
 	}
 
-	if cfg.API.Timeout != 10*time.Second {
-		t.Errorf("Expected timeout 10s, got %v", cfg.API.Timeout)
+	if cfg.API.Timeout != 30*time.Second {
+		t.Errorf("Expected timeout 30s, got %v", cfg.API.Timeout)
 	}
 
 	// Test UI config defaults
@@ -64,3 +70,492 @@ func TestDefaultConfig(t *testing.T) {
 		t.Error("IncludeEnvVars should be false by default")
 	}
 }
+
+func TestThinkingText(t *testing.T) {
+	tests := []struct {
+		ui       UIConfig
+		expected string
+	}{
+		{UIConfig{Language: "en"}, "Thinking"},
+		{UIConfig{Language: "zh-CN"}, "思考中"},
+		{UIConfig{Language: "zh", ThinkingMessage: "Working on it"}, "Working on it"},
+	}
+	for _, tt := range tests {
+		if text := tt.ui.ThinkingText(); text != tt.expected {
+			t.Errorf("ThinkingText() for %+v = %q, expected %q", tt.ui, text, tt.expected)
+		}
+	}
+
+	manager := &Manager{config: DefaultConfig()}
+	manager.GetConfig().UI.Spinner = "wheel"
+	if err := manager.ValidateConfig(); err == nil {
+		t.Error("Expected an unknown spinner to be rejected")
+	}
+}
+
+func TestGetModelAliases(t *testing.T) {
+	manager := &Manager{config: DefaultConfig()}
+
+	aliases := manager.GetModelAliases()
+	if aliases["openrouter"]["fast"] == "" {
+		t.Error("Expected a default 'fast' alias for openrouter")
+	}
+	if aliases["openai"]["smart"] == "" {
+		t.Error("Expected a default 'smart' alias for openai")
+	}
+
+	// The returned map is a copy
+	aliases["openai"]["smart"] = "changed"
+	if manager.GetModelAliases()["openai"]["smart"] == "changed" {
+		t.Error("Expected GetModelAliases to return a copy")
+	}
+}
+
+func TestManagerSaveLoad(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	path := filepath.Join(t.TempDir(), "clia", "config.yaml")
+
+	manager := &Manager{config: DefaultConfig(), configPath: path}
+	if _, _, ok := manager.GetStoredProvider(); ok {
+		t.Fatal("Expected no stored provider in the default config")
+	}
+
+	manager.SetProviderKey("openai", "sk-test")
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected config file to exist: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected config file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	loaded := &Manager{config: DefaultConfig(), configPath: path}
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	provider, key, ok := loaded.GetStoredProvider()
+	if !ok || provider != "openai" || key != "sk-test" {
+		t.Errorf("Expected stored openai key, got %q %q %v", provider, key, ok)
+	}
+	if loaded.GetConfig().API.MaxTokens != DefaultConfig().API.MaxTokens {
+		t.Error("Expected defaults to be kept for unchanged values")
+	}
+
+	// Environment variables take precedence over the stored key
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	if key := loaded.GetProviderKey("openai"); key != "sk-env" {
+		t.Errorf("Expected environment key to win, got %q", key)
+	}
+
+	// Local providers need no key
+	loaded.SetProviderKey("ollama", "")
+	if provider, _, ok := loaded.GetStoredProvider(); !ok || provider != "ollama" {
+		t.Errorf("Expected ollama to be usable without a key, got %q %v", provider, ok)
+	}
+}
+
+func TestFindSetupProvider(t *testing.T) {
+	tests := map[string]string{
+		"1":      "openrouter",
+		"2":      "openai",
+		"Ollama": "ollama",
+		" 3 ":    "ollama",
+	}
+	for choice, expected := range tests {
+		info, ok := FindSetupProvider(choice)
+		if !ok || info.Name != expected {
+			t.Errorf("FindSetupProvider(%q) = %q, %v; want %q", choice, info.Name, ok, expected)
+		}
+	}
+
+	for _, choice := range []string{"", "0", "4", "claude"} {
+		if _, ok := FindSetupProvider(choice); ok {
+			t.Errorf("Expected FindSetupProvider(%q) to fail", choice)
+		}
+	}
+}
+
+func TestGetProviderHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "api:\n  providers:\n    openai:\n      headers:\n        X-Org-Id: ${ORG_ID}\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &Manager{config: DefaultConfig(), configPath: path}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	headers := manager.GetProviderHeaders()
+	if headers["openai"]["X-Org-Id"] != "${ORG_ID}" {
+		t.Errorf("Expected unexpanded openai header, got %v", headers)
+	}
+	if _, ok := headers["openrouter"]; ok {
+		t.Error("Expected no headers for providers without any")
+	}
+}
+
+func TestGetProviderEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "api:\n  providers:\n    openai:\n      endpoint: https://gateway.internal/openai\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &Manager{config: DefaultConfig(), configPath: path}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	t.Setenv("CLIA_OPENAI_BASE_URL", "")
+	t.Setenv("CLIA_OPENROUTER_BASE_URL", "https://proxy.example.com/v1")
+
+	endpoints := manager.GetProviderEndpoints()
+	if endpoints["openai"] != "https://gateway.internal/openai" {
+		t.Errorf("Expected endpoint from the config file, got %q", endpoints["openai"])
+	}
+	if endpoints["openrouter"] != "https://proxy.example.com/v1" {
+		t.Errorf("Expected endpoint from the environment, got %q", endpoints["openrouter"])
+	}
+
+	// The environment takes precedence over the config file
+	t.Setenv("CLIA_OPENAI_BASE_URL", "https://proxy.example.com/openai")
+	if endpoint := manager.GetProviderEndpoint("openai"); endpoint != "https://proxy.example.com/openai" {
+		t.Errorf("Expected environment override, got %q", endpoint)
+	}
+}
+
+func TestGetRequestTemplates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `templates:
+  restart:
+    pattern: "restart {{service}}"
+  deploy:
+    pattern: "deploy to {{env}}"
+    prompt: "Run ./deploy.sh {{env}}"
+  broken:
+    pattern: "{{env}}"
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &Manager{config: DefaultConfig(), configPath: path}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	templates, err := manager.GetRequestTemplates()
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected an error for the invalid template, got %v", err)
+	}
+	if len(templates) != 2 || templates[0].Name != "deploy" || templates[1].Name != "restart" {
+		t.Fatalf("Expected the valid templates ordered by name, got %+v", templates)
+	}
+	if templates[0].Prompt != "Run ./deploy.sh {{env}}" {
+		t.Errorf("Unexpected prompt: %q", templates[0].Prompt)
+	}
+	if err := manager.ValidateConfig(); err == nil {
+		t.Error("Expected ValidateConfig to report the invalid template")
+	}
+}
+
+func TestLoadDangerPatterns(t *testing.T) {
+	dir := t.TempDir()
+	manager := &Manager{config: DefaultConfig(), configPath: filepath.Join(dir, "config.yaml")}
+
+	patterns, err := manager.LoadDangerPatterns()
+	if err != nil || len(patterns) != 0 {
+		t.Fatalf("Expected no patterns without a file, got %v, %v", patterns, err)
+	}
+
+	content := `patterns:
+  - pattern: '\bprodctl\s+purge\b'
+    severity: critical
+    description: Purges production data
+  - pattern: '(broken'
+    severity: warning
+`
+	if err := os.WriteFile(filepath.Join(dir, "danger_patterns.yaml"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	patterns, err = manager.LoadDangerPatterns()
+	if err == nil || !strings.Contains(err.Error(), "(broken") {
+		t.Errorf("Expected an error naming the invalid pattern, got %v", err)
+	}
+	if len(patterns) != 1 || patterns[0].Level != utils.DangerCritical || patterns[0].Description != "Purges production data" {
+		t.Errorf("Expected the valid pattern to be loaded, got %+v", patterns)
+	}
+
+	manager.config.Behavior.DangerPatternsFile = filepath.Join(dir, "site.yaml")
+	if path := manager.GetDangerPatternsPath(); path != filepath.Join(dir, "site.yaml") {
+		t.Errorf("Expected the configured path, got %q", path)
+	}
+}
+
+func TestLogsConfig(t *testing.T) {
+	dir := t.TempDir()
+	manager := &Manager{config: DefaultConfig(), configPath: filepath.Join(dir, "config.yaml")}
+
+	if path := manager.GetHistoryPath(); path != "" {
+		t.Errorf("Expected the history to be off by default, got %q", path)
+	}
+
+	manager.config.Logs.History = true
+	if path := manager.GetHistoryPath(); path != filepath.Join(dir, "history.jsonl") {
+		t.Errorf("Expected a JSONL history next to the config, got %q", path)
+	}
+	manager.config.Logs.HistoryFormat = "text"
+	if path := manager.GetHistoryPath(); path != filepath.Join(dir, "history.log") {
+		t.Errorf("Expected a text history, got %q", path)
+	}
+
+	policy := manager.GetLogRotation()
+	if policy.MaxSize != 10*1024*1024 || policy.MaxFiles != 5 || policy.MaxAge != 30*24*time.Hour {
+		t.Errorf("Unexpected default rotation %+v", policy)
+	}
+
+	manager.config.Logs.HistoryFormat = "xml"
+	if err := manager.ValidateConfig(); err == nil {
+		t.Error("Expected an unknown history format to be rejected")
+	}
+	manager.config.Logs.HistoryFormat = "jsonl"
+	manager.config.Logs.MaxFiles = -1
+	if err := manager.ValidateConfig(); err == nil {
+		t.Error("Expected negative limits to be rejected")
+	}
+}
+
+func TestConfigMigration(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	legacy := `api:
+  provider: openrouter
+  key: sk-legacy
+  providers:
+    openrouter:
+      headers:
+        X-Title: clia
+ui:
+  theme: none
+`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &Manager{config: DefaultConfig(), configPath: path}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	migration := manager.PendingMigration()
+	if migration == nil {
+		t.Fatal("Expected the legacy file to be migrated")
+	}
+	if migration.From != 1 || migration.To != CurrentConfigVersion || len(migration.Changes) != 2 {
+		t.Errorf("Unexpected migration %+v", migration)
+	}
+
+	// The key moved to the provider and its missing settings got their defaults
+	provider := manager.GetConfig().API.Providers["openrouter"]
+	if provider.Key != "sk-legacy" || manager.GetConfig().API.Key != "" {
+		t.Errorf("Expected the key to move to the provider, got %q and %q", provider.Key, manager.GetConfig().API.Key)
+	}
+	if provider.Model != "openai/gpt-3.5-turbo" || provider.Aliases["fast"] == "" || provider.Headers["X-Title"] != "clia" {
+		t.Errorf("Expected defaults next to the configured headers, got %+v", provider)
+	}
+	if manager.GetConfig().UI.Theme != "none" {
+		t.Error("Expected other settings to be kept")
+	}
+
+	// Loading leaves the file alone; migrating backs it up and writes the
+	// upgraded one
+	if data, _ := os.ReadFile(path); string(data) != legacy {
+		t.Error("Expected Load not to write the file")
+	}
+	if _, err := os.Stat(path + ".v1.bak"); !os.IsNotExist(err) {
+		t.Error("Expected Load not to back up the file")
+	}
+	migration, err := manager.Migrate()
+	if err != nil || migration == nil {
+		t.Fatalf("Expected the file to be migrated, got %+v, %v", migration, err)
+	}
+	if manager.PendingMigration() != nil {
+		t.Error("Expected no pending migration once written")
+	}
+	if again, err := manager.Migrate(); again != nil || err != nil {
+		t.Errorf("Expected nothing to migrate twice, got %+v, %v", again, err)
+	}
+	if backup, err := os.ReadFile(migration.BackupPath); err != nil || string(backup) != legacy {
+		t.Errorf("Expected a backup of the legacy file at %s: %v", migration.BackupPath, err)
+	}
+	reloaded := &Manager{config: DefaultConfig(), configPath: path}
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load of the upgraded file failed: %v", err)
+	}
+	if migration := reloaded.PendingMigration(); migration != nil || reloaded.FileVersion() != CurrentConfigVersion {
+		t.Errorf("Expected the upgraded file to be current, got %+v", migration)
+	}
+	if key := reloaded.GetConfig().API.Providers["openrouter"].Key; key != "sk-legacy" {
+		t.Errorf("Expected the migrated key to be saved, got %q", key)
+	}
+
+	// The old default timeout, which now limits suggestions, is raised;
+	// timeouts set on purpose are kept
+	for stored, expected := range map[string]time.Duration{"10s": 30 * time.Second, "45s": 45 * time.Second} {
+		timeoutPath := filepath.Join(dir, "timeout-"+stored+".yaml")
+		os.WriteFile(timeoutPath, []byte("version: 2\napi:\n  timeout: "+stored+"\n"), 0600)
+		manager = &Manager{config: DefaultConfig(), configPath: timeoutPath}
+		if err := manager.Load(); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if timeout := manager.GetConfig().API.Timeout; timeout != expected {
+			t.Errorf("Expected a stored %s to become %s, got %s", stored, expected, timeout)
+		}
+		if migration := manager.PendingMigration(); migration == nil || migration.From != 2 || (stored == "10s") != (len(migration.Changes) == 1) {
+			t.Errorf("Unexpected migration of a stored %s: %+v", stored, migration)
+		}
+	}
+
+	// Newer files are read as they are
+	newer := filepath.Join(dir, "newer.yaml")
+	os.WriteFile(newer, []byte("version: 99\nui:\n  theme: light\n"), 0600)
+	manager = &Manager{config: DefaultConfig(), configPath: newer}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if migration := manager.PendingMigration(); migration != nil || manager.FileVersion() != 99 || manager.GetConfig().UI.Theme != "light" {
+		t.Errorf("Expected a newer file to be loaded unchanged, got %+v", migration)
+	}
+
+	// Saving a setting writes an older file in the current layout, backed up
+	saving := filepath.Join(dir, "saving.yaml")
+	os.WriteFile(saving, []byte("api:\n  key: sk-old\n"), 0600)
+	manager = &Manager{config: DefaultConfig(), configPath: saving}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if backup, err := os.ReadFile(saving + ".v1.bak"); err != nil || string(backup) != "api:\n  key: sk-old\n" {
+		t.Errorf("Expected Save to back up the older file: %v", err)
+	}
+	if manager.PendingMigration() != nil || manager.FileVersion() != CurrentConfigVersion {
+		t.Error("Expected the saved file to be current")
+	}
+}
+
+func TestShareableYAML(t *testing.T) {
+	manager := &Manager{config: DefaultConfig(), configPath: filepath.Join(t.TempDir(), "config.yaml")}
+	provider := manager.config.API.Providers["openrouter"]
+	provider.Key = "sk-secret"
+	provider.Headers = map[string]string{"X-Proxy-Token": "token-secret"}
+	manager.config.API.Providers["openrouter"] = provider
+	manager.config.UI.Theme = "light"
+
+	shared, err := manager.ShareableYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(shared, "sk-secret") || strings.Contains(shared, "token-secret") {
+		t.Errorf("Expected the key and headers to be hidden, got:\n%s", shared)
+	}
+	if !strings.Contains(shared, "X-Proxy-Token: '****'") || !strings.Contains(shared, "theme: light") {
+		t.Errorf("Expected the other settings and the header names, got:\n%s", shared)
+	}
+	if manager.config.API.Providers["openrouter"].Key != "sk-secret" {
+		t.Error("Expected the config itself to keep the key")
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	manager := &Manager{config: DefaultConfig(), configPath: path}
+
+	for _, command := range []string{"git status", "make test"} {
+		if err := manager.AddFavorite(command); err != nil {
+			t.Fatalf("AddFavorite(%q) failed: %v", command, err)
+		}
+	}
+	if err := manager.AddFavorite("git status"); err == nil {
+		t.Error("Expected a duplicate favorite to be rejected")
+	}
+	if err := manager.AddFavorite("  "); err == nil {
+		t.Error("Expected an empty favorite to be rejected")
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := &Manager{config: DefaultConfig(), configPath: path}
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if favorites := loaded.GetFavorites(); len(favorites) != 2 || favorites[1] != "make test" {
+		t.Fatalf("Expected the favorites to be saved in order, got %v", favorites)
+	}
+
+	if command, err := loaded.RemoveFavorite(1); err != nil || command != "git status" {
+		t.Errorf("RemoveFavorite(1) = %q, %v", command, err)
+	}
+	if _, err := loaded.RemoveFavorite(5); err == nil {
+		t.Error("Expected removing a missing favorite to fail")
+	}
+	if favorites := loaded.GetFavorites(); len(favorites) != 1 || favorites[0] != "make test" {
+		t.Errorf("Expected the remaining favorites to move up, got %v", favorites)
+	}
+
+	for i := len(loaded.GetFavorites()); i < MaxFavorites; i++ {
+		loaded.AddFavorite(fmt.Sprintf("echo %d", i))
+	}
+	if err := loaded.AddFavorite("echo full"); err == nil {
+		t.Error("Expected a full favorites bar to reject more commands")
+	}
+}
+
+func TestPendingChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	manager := &Manager{config: DefaultConfig(), configPath: path}
+	manager.SetProviderKey("openai", "sk-first")
+	manager.AddFavorite("git status")
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if changes, err := manager.PendingChanges(); err != nil || len(changes) != 0 {
+		t.Fatalf("Expected no changes right after saving, got %v, %v", changes, err)
+	}
+
+	manager.SetTimeout(45 * time.Second)
+	changes, err := manager.PendingChanges()
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("Expected one change, got %v, %v", changes, err)
+	}
+	if got := changes[0].String(); got != "api.timeout: 30s → 45s" {
+		t.Errorf("Expected the timeout change to be described, got %q", got)
+	}
+	if changes[0].Destructive() {
+		t.Error("Expected changing the timeout not to be destructive")
+	}
+
+	manager.SetProviderKey("openai", "sk-second")
+	manager.RemoveFavorite(1)
+	changes, _ = manager.PendingChanges()
+	byKey := make(map[string]Change)
+	for _, change := range changes {
+		byKey[change.Key] = change
+	}
+	key := byKey["api.providers.openai.key"]
+	if !key.Destructive() || strings.Contains(key.String(), "sk-") {
+		t.Errorf("Expected replacing a stored key to be destructive and masked, got %q", key)
+	}
+	if favorites := byKey["favorites"]; !favorites.Destructive() || !strings.HasSuffix(favorites.String(), "→ (unset)") {
+		t.Errorf("Expected removing the last favorite to be destructive, got %q", favorites)
+	}
+}
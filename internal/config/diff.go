@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Change is a setting that differs between two configurations
+type Change struct {
+	Key string // Path of the setting in the file, e.g. "api.timeout"
+	Old string // Empty if the setting was not set
+	New string // Empty if the setting is removed
+}
+
+// Destructive reports whether the change loses a value that cannot be
+// recovered from the new file: a setting removed or a stored key replaced
+func (c Change) Destructive() bool {
+	return c.Old != "" && (c.New == "" || secretSetting(c.Key))
+}
+
+// String describes the change as "key: old → new", hiding API keys and headers
+func (c Change) String() string {
+	show := func(value string) string {
+		switch {
+		case value == "":
+			return "(unset)"
+		case secretSetting(c.Key):
+			return "****"
+		default:
+			return value
+		}
+	}
+	return fmt.Sprintf("%s: %s → %s", c.Key, show(c.Old), show(c.New))
+}
+
+// secretSetting reports whether the setting at key may hold a secret
+func secretSetting(key string) bool {
+	return key == "key" || strings.HasSuffix(key, ".key") || strings.Contains(key, ".headers.")
+}
+
+// ShareableYAML returns the current configuration as YAML with API keys and
+// headers hidden, to share it, e.g. in a bug report
+func (m *Manager) ShareableYAML() (string, error) {
+	var node yaml.Node
+	if err := node.Encode(m.config); err != nil {
+		return "", fmt.Errorf("failed to marshal config: %w", err)
+	}
+	hideSecrets(&node, "")
+
+	data, err := yaml.Marshal(&node)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return string(data), nil
+}
+
+// hideSecrets replaces the values of settings that may hold a secret below
+// node, at path in the file
+func hideSecrets(node *yaml.Node, path string) {
+	if node.Kind != yaml.MappingNode {
+		for _, child := range node.Content {
+			hideSecrets(child, path)
+		}
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if path != "" {
+			key = path + "." + key
+		}
+		if value.Kind == yaml.ScalarNode && value.Value != "" && secretSetting(key) {
+			value.Value, value.Tag, value.Style = "****", "!!str", 0
+			continue
+		}
+		hideSecrets(value, key)
+	}
+}
+
+// DiffConfig returns the settings that differ between old and new, sorted by key
+func DiffConfig(old, new *Config) ([]Change, error) {
+	before, err := flattenConfig(old)
+	if err != nil {
+		return nil, err
+	}
+	after, err := flattenConfig(new)
+	if err != nil {
+		return nil, err
+	}
+	return diffSettings(before, after), nil
+}
+
+// diffSettings compares two flattened configurations
+func diffSettings(before, after map[string]string) []Change {
+	var changes []Change
+	for key, value := range before {
+		if after[key] != value {
+			changes = append(changes, Change{Key: key, Old: value, New: after[key]})
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok && value != "" {
+			changes = append(changes, Change{Key: key, New: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// flattenConfig returns the settings of config as written to the file, keyed
+// by their dotted path. Lists are single settings. The layout version is left
+// out, Save sets it.
+func flattenConfig(config *Config) (map[string]string, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	delete(tree, "version")
+
+	settings := make(map[string]string)
+	flattenSettings("", tree, settings)
+	return settings, nil
+}
+
+// flattenSettings adds the settings under prefix in value to settings
+func flattenSettings(prefix string, value interface{}, settings map[string]string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenSettings(key, child, settings)
+		}
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = fmt.Sprint(item)
+		}
+		if len(items) > 0 {
+			settings[prefix] = "[" + strings.Join(items, ", ") + "]"
+		} else {
+			settings[prefix] = ""
+		}
+	case nil:
+		settings[prefix] = ""
+	default:
+		settings[prefix] = fmt.Sprint(value)
+	}
+}
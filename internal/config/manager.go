@@ -1,10 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"gopkg.in/yaml.v3"
+
+	"github.com/yourusername/clia/internal/prompt"
 	"github.com/yourusername/clia/pkg/utils"
 )
 
@@ -12,6 +19,15 @@ import (
 type Manager struct {
 	config     *Config
 	configPath string
+
+	// Layout version of the loaded file and the upgrade Load applied to it in
+	// memory, until Migrate or Save writes it; see migrate.go
+	fileVersion int
+	migration   *Migration
+
+	// Settings as in the file when it was last loaded or saved, see diff.go;
+	// nil until then, when the defaults stand in
+	saved map[string]string
 }
 
 // NewManager creates a new configuration manager
@@ -29,22 +45,67 @@ func NewManager() (*Manager, error) {
 	}, nil
 }
 
-// Load loads configuration from file or creates default if not exists
+// Load loads configuration from file, keeping defaults for unset values
 func (m *Manager) Load() error {
-	// Check if config file exists
-	if _, err := os.Stat(m.configPath); os.IsNotExist(err) {
+	data, err := os.ReadFile(m.configPath)
+	if os.IsNotExist(err) {
 		// Config file doesn't exist, use defaults
 		return nil
 	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
 
-	// For now, just use defaults
-	// In a full implementation, we would use viper or similar to load YAML
-	// This is sufficient for Phase 2 demonstration
+	var header struct {
+		Version int `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", m.configPath, err)
+	}
+	m.fileVersion = max(header.Version, 1)
+
+	// Older layouts are upgraded in memory only; the file is left alone
+	// until Migrate or Save
+	m.migration = nil
+	if m.fileVersion < CurrentConfigVersion {
+		if data, m.migration, err = upgradeConfigData(data, m.fileVersion); err != nil {
+			return fmt.Errorf("failed to upgrade config file %s: %w", m.configPath, err)
+		}
+	}
+
+	config := DefaultConfig()
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", m.configPath, err)
+	}
 
+	m.config = config
+	m.saved, _ = flattenConfig(config)
 	return nil
 }
 
-// Save saves current configuration to file
+// Reload reads the configuration file again and returns the settings that
+// changed. If the file cannot be read or is not valid, the current
+// configuration is kept.
+func (m *Manager) Reload() ([]Change, error) {
+	fresh := &Manager{configPath: m.configPath, config: DefaultConfig()}
+	if err := fresh.Load(); err != nil {
+		return nil, err
+	}
+	if err := fresh.ValidateConfig(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", m.configPath, err)
+	}
+
+	changes, err := DiffConfig(m.config, fresh.config)
+	if err != nil {
+		return nil, err
+	}
+	m.config, m.saved, m.fileVersion = fresh.config, fresh.saved, fresh.fileVersion
+	m.migration = fresh.migration
+	return changes, nil
+}
+
+// Save saves current configuration to file. The file may contain API keys,
+// so it is only readable by the current user.
 func (m *Manager) Save() error {
 	// Create config directory if it doesn't exist
 	configDir := filepath.Dir(m.configPath)
@@ -52,79 +113,55 @@ func (m *Manager) Save() error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	// For now, just create an empty config file
-	// In a full implementation, we would marshal the config to YAML
-	file, err := os.Create(m.configPath)
+	// Files are always written in the current layout; an older file is
+	// backed up first
+	if m.migration != nil && m.migration.BackupPath == "" {
+		backupPath, err := m.backupConfig(m.fileVersion)
+		if err != nil {
+			return err
+		}
+		m.migration.BackupPath = backupPath
+	}
+	m.config.Version = CurrentConfigVersion
+	data, err := yaml.Marshal(m.config)
 	if err != nil {
-		return fmt.Errorf("failed to create config file: %w", err)
-	}
-	defer file.Close()
-
-	// Write a basic config template
-	template := `# clia configuration file
-api:
-  provider: "openai"  # openai, anthropic, ollama, openrouter
-  key: ""  # Set via environment variable OPENAI_API_KEY, OPENROUTER_API_KEY, etc.
-  model: "gpt-3.5-turbo"
-  timeout: 10s
-  max_tokens: 1000
-  temperature: 0.7
-
-ui:
-  theme: "dark"  # dark, light
-  language: "en"  # en, zh
-  history_size: 100
-
-behavior:
-  auto_execute_safe_commands: false
-  confirm_dangerous_commands: true
-  collect_usage_stats: false
-
-context:
-  include_hidden_files: false
-  max_files_in_context: 50
-  include_env_vars: false
-
-# Provider-specific configurations
-# Uncomment and configure the provider you want to use
-
-providers:
-  openai:
-    model: "gpt-3.5-turbo"
-    endpoint: "https://api.openai.com/v1"
-    max_tokens: 1000
-    temperature: 0.7
-
-  openrouter:
-    model: "openai/gpt-3.5-turbo"  # Access OpenAI models via OpenRouter
-    # model: "anthropic/claude-3-sonnet"  # Or use Claude via OpenRouter
-    # model: "google/gemini-pro"  # Or use Gemini via OpenRouter
-    endpoint: "https://openrouter.ai/api/v1"
-    max_tokens: 1000
-    temperature: 0.7
-
-  anthropic:
-    model: "claude-3-sonnet-20240229"
-    endpoint: "https://api.anthropic.com"
-    max_tokens: 1000
-    temperature: 0.7
-
-  ollama:
-    model: "llama2"
-    endpoint: "http://localhost:11434"
-    max_tokens: 1000
-    temperature: 0.7
-
-# Environment variables to set:
-# export OPENAI_API_KEY="your-openai-key"
-# export OPENROUTER_API_KEY="your-openrouter-key"  
-# export ANTHROPIC_API_KEY="your-anthropic-key"
-`
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
 
-	_, err = file.WriteString(template)
-	return err
+	content := append([]byte(configFileHeader), data...)
+	if err := os.WriteFile(m.configPath, content, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	m.saved, _ = flattenConfig(m.config)
+	m.fileVersion = CurrentConfigVersion
+	return nil
 }
 
+// PendingChanges returns the settings Save would change in the config file,
+// compared to the file as last loaded or saved, or to the defaults if there
+// is none yet
+func (m *Manager) PendingChanges() ([]Change, error) {
+	saved := m.saved
+	if saved == nil {
+		var err error
+		if saved, err = flattenConfig(DefaultConfig()); err != nil {
+			return nil, err
+		}
+	}
+	current, err := flattenConfig(m.config)
+	if err != nil {
+		return nil, err
+	}
+	return diffSettings(saved, current), nil
+}
+
+// configFileHeader is written at the top of saved configuration files
+const configFileHeader = `# clia configuration file
+# Environment variables (OPENAI_API_KEY, OPENROUTER_API_KEY, ...) take
+# precedence over keys stored here, and CLIA_<PROVIDER>_BASE_URL over endpoints.
+# Run 'clia setup' to change the provider.
+`
+
 // GetConfig returns the current configuration
 func (m *Manager) GetConfig() *Config {
 	return m.config
@@ -140,6 +177,16 @@ func (m *Manager) SetProvider(provider string) {
 	m.config.API.Provider = provider
 }
 
+// SetTimeout sets how long a suggestion request may take
+func (m *Manager) SetTimeout(timeout time.Duration) {
+	m.config.API.Timeout = timeout
+}
+
+// SetMaxCost sets how many dollars the requests of a session may cost; 0 sets no limit
+func (m *Manager) SetMaxCost(dollars float64) {
+	m.config.API.MaxCost = dollars
+}
+
 // GetProviderConfig returns configuration for the specified provider
 func (m *Manager) GetProviderConfig(provider string) (*Provider, bool) {
 	providerConfig, exists := m.config.API.Providers[provider]
@@ -151,26 +198,294 @@ func (m *Manager) GetActiveProviderConfig() (*Provider, bool) {
 	return m.GetProviderConfig(m.config.API.Provider)
 }
 
+// SetProviderKey makes provider the active provider and stores its API key
+func (m *Manager) SetProviderKey(provider, key string) {
+	m.config.API.Provider = provider
+
+	providerConfig := m.config.API.Providers[provider]
+	providerConfig.Key = key
+	if m.config.API.Providers == nil {
+		m.config.API.Providers = make(map[string]Provider)
+	}
+	m.config.API.Providers[provider] = providerConfig
+}
+
+// GetProviderKey returns the API key of provider from its environment
+// variable or, failing that, from the config file
+func (m *Manager) GetProviderKey(provider string) string {
+	if key := os.Getenv(providerEnvVar(provider)); key != "" {
+		return key
+	}
+
+	if providerConfig, ok := m.config.API.Providers[provider]; ok && providerConfig.Key != "" {
+		return providerConfig.Key
+	}
+
+	if provider == m.config.API.Provider {
+		return m.config.API.Key
+	}
+	return ""
+}
+
+// GetStoredProvider returns the active provider and its stored API key if the
+// config file holds a usable provider setup (e.g. saved by onboarding)
+func (m *Manager) GetStoredProvider() (string, string, bool) {
+	if m == nil {
+		return "", "", false
+	}
+
+	provider := m.config.API.Provider
+	key := m.GetProviderKey(provider)
+
+	for _, info := range SetupProviders() {
+		if info.Name == provider {
+			return provider, key, key != "" || !info.RequiresKey
+		}
+	}
+	return provider, key, key != ""
+}
+
+// GetModelAliases returns the configured model aliases keyed by provider name
+func (m *Manager) GetModelAliases() map[string]map[string]string {
+	aliases := make(map[string]map[string]string)
+	for name, provider := range m.config.API.Providers {
+		if len(provider.Aliases) == 0 {
+			continue
+		}
+
+		providerAliases := make(map[string]string, len(provider.Aliases))
+		for alias, model := range provider.Aliases {
+			providerAliases[alias] = model
+		}
+		aliases[name] = providerAliases
+	}
+	return aliases
+}
+
+// GetProviderHeaders returns the configured custom request headers keyed by provider name
+func (m *Manager) GetProviderHeaders() map[string]map[string]string {
+	headers := make(map[string]map[string]string)
+	for name, provider := range m.config.API.Providers {
+		if len(provider.Headers) == 0 {
+			continue
+		}
+
+		providerHeaders := make(map[string]string, len(provider.Headers))
+		for header, value := range provider.Headers {
+			providerHeaders[header] = value
+		}
+		headers[name] = providerHeaders
+	}
+	return headers
+}
+
+// GetProviderEndpoint returns the base URL of provider from its
+// CLIA_<PROVIDER>_BASE_URL environment variable or, failing that, from the config file
+func (m *Manager) GetProviderEndpoint(provider string) string {
+	if endpoint := os.Getenv(providerBaseURLEnvVar(provider)); endpoint != "" {
+		return endpoint
+	}
+	return m.config.API.Providers[provider].Endpoint
+}
+
+// GetProviderEndpoints returns the base URL of every provider that has one, keyed by provider name
+func (m *Manager) GetProviderEndpoints() map[string]string {
+	names := make(map[string]bool)
+	for name := range m.config.API.Providers {
+		names[name] = true
+	}
+	for _, info := range SetupProviders() {
+		names[info.Name] = true
+	}
+
+	endpoints := make(map[string]string)
+	for name := range names {
+		if endpoint := m.GetProviderEndpoint(name); endpoint != "" {
+			endpoints[name] = endpoint
+		}
+	}
+	return endpoints
+}
+
+// GetRequestTemplates returns the valid request templates ordered by name, and
+// an error describing the invalid ones
+func (m *Manager) GetRequestTemplates() ([]prompt.RequestTemplate, error) {
+	names := make([]string, 0, len(m.config.Templates))
+	for name := range m.config.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var templates []prompt.RequestTemplate
+	var problems []error
+	for _, name := range names {
+		template := prompt.RequestTemplate{
+			Name:    name,
+			Pattern: m.config.Templates[name].Pattern,
+			Prompt:  m.config.Templates[name].Prompt,
+		}
+		if err := template.Validate(); err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		templates = append(templates, template)
+	}
+	return templates, errors.Join(problems...)
+}
+
+// MaxFavorites is the number of favorites, run with Alt+1 to Alt+9
+const MaxFavorites = 9
+
+// GetFavorites returns the commands of the favorites bar in order
+func (m *Manager) GetFavorites() []string {
+	return append([]string(nil), m.config.Favorites...)
+}
+
+// AddFavorite adds command to the end of the favorites bar; call Save to
+// keep it
+func (m *Manager) AddFavorite(command string) error {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return fmt.Errorf("favorite command cannot be empty")
+	}
+	for i, favorite := range m.config.Favorites {
+		if favorite == command {
+			return fmt.Errorf("%q is already favorite %d", command, i+1)
+		}
+	}
+	if len(m.config.Favorites) >= MaxFavorites {
+		return fmt.Errorf("the favorites bar is full (%d commands), remove one first", MaxFavorites)
+	}
+	m.config.Favorites = append(m.config.Favorites, command)
+	return nil
+}
+
+// RemoveFavorite removes favorite n, counting from 1, and returns its
+// command; call Save to keep the change
+func (m *Manager) RemoveFavorite(n int) (string, error) {
+	if n < 1 || n > len(m.config.Favorites) {
+		return "", fmt.Errorf("no favorite %d", n)
+	}
+	command := m.config.Favorites[n-1]
+	m.config.Favorites = append(m.config.Favorites[:n-1], m.config.Favorites[n:]...)
+	return command, nil
+}
+
+// GetRunLogDir returns the directory receiving command run logs, or an empty
+// string if run logs are disabled
+func (m *Manager) GetRunLogDir() string {
+	if !m.config.Behavior.LogRuns {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(m.configPath), "runs")
+}
+
+// GetHistoryPath returns the file receiving the command history, or an empty
+// string if the history is disabled
+func (m *Manager) GetHistoryPath() string {
+	if !m.config.Logs.History {
+		return ""
+	}
+
+	name := "history.jsonl"
+	if m.config.Logs.HistoryFormat == "text" {
+		name = "history.log"
+	}
+	return filepath.Join(filepath.Dir(m.configPath), name)
+}
+
+// GetLogRotation returns the size limits of the history file and run logs
+func (m *Manager) GetLogRotation() utils.RotationPolicy {
+	logs := m.config.Logs
+	return utils.RotationPolicy{
+		MaxSize:  int64(logs.MaxFileSizeMB) * 1024 * 1024,
+		MaxFiles: logs.MaxFiles,
+		MaxAge:   time.Duration(logs.RetentionDays) * 24 * time.Hour,
+	}
+}
+
+// dangerPatternsFile is the on-disk form of the danger patterns file
+type dangerPatternsFile struct {
+	Patterns []struct {
+		Pattern     string `yaml:"pattern"`
+		Severity    string `yaml:"severity"`
+		Description string `yaml:"description"`
+	} `yaml:"patterns"`
+}
+
+// GetDangerPatternsPath returns the path of the file with user-defined danger patterns
+func (m *Manager) GetDangerPatternsPath() string {
+	if path := m.config.Behavior.DangerPatternsFile; path != "" {
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			if home, err := utils.GetHomeDir(); err == nil {
+				return filepath.Join(home, rest)
+			}
+		}
+		return path
+	}
+	return filepath.Join(filepath.Dir(m.configPath), "danger_patterns.yaml")
+}
+
+// LoadDangerPatterns reads the user-defined danger patterns. A missing file
+// means no extra patterns; invalid entries are skipped and reported in the error.
+func (m *Manager) LoadDangerPatterns() ([]utils.DangerPattern, error) {
+	path := m.GetDangerPatternsPath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read danger patterns: %w", err)
+	}
+
+	var file dangerPatternsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse danger patterns file %s: %w", path, err)
+	}
+
+	var patterns []utils.DangerPattern
+	var problems []error
+	for _, entry := range file.Patterns {
+		pattern, err := utils.NewDangerPattern(entry.Pattern, entry.Severity, entry.Description)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(problems) > 0 {
+		return patterns, fmt.Errorf("%s: %w", path, errors.Join(problems...))
+	}
+	return patterns, nil
+}
+
 // GetAPIKeyFromEnv gets the API key from environment variables
 func (m *Manager) GetAPIKeyFromEnv() string {
-	provider := m.config.API.Provider
+	return os.Getenv(providerEnvVar(m.config.API.Provider))
+}
 
+// providerEnvVar returns the environment variable holding the API key of provider
+func providerEnvVar(provider string) string {
 	switch provider {
 	case "openai":
-		return os.Getenv("OPENAI_API_KEY")
+		return "OPENAI_API_KEY"
 	case "anthropic":
-		return os.Getenv("ANTHROPIC_API_KEY")
+		return "ANTHROPIC_API_KEY"
 	case "claude":
-		return os.Getenv("CLAUDE_API_KEY")
+		return "CLAUDE_API_KEY"
 	case "openrouter":
-		return os.Getenv("OPENROUTER_API_KEY")
+		return "OPENROUTER_API_KEY"
 	default:
 		// Try generic format: PROVIDER_API_KEY
-		envVar := fmt.Sprintf("%s_API_KEY", provider)
-		return os.Getenv(envVar)
+		return fmt.Sprintf("%s_API_KEY", provider)
 	}
 }
 
+// providerBaseURLEnvVar returns the environment variable overriding the base URL of provider
+func providerBaseURLEnvVar(provider string) string {
+	return fmt.Sprintf("CLIA_%s_BASE_URL", strings.ToUpper(provider))
+}
+
 // IsProviderConfigured checks if the current provider is properly configured
 func (m *Manager) IsProviderConfigured() bool {
 	// Check if API key is available
@@ -213,16 +528,79 @@ func (m *Manager) ValidateConfig() error {
 		return fmt.Errorf("temperature must be between 0 and 2")
 	}
 
+	if config.API.Choices < 0 || config.API.Choices > 10 {
+		return fmt.Errorf("choices must be between 0 and 10")
+	}
+
+	if config.API.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+
+	if config.API.MaxCost < 0 {
+		return fmt.Errorf("max_cost cannot be negative")
+	}
+
 	// Validate UI config
 	if config.UI.HistorySize < 0 {
 		return fmt.Errorf("history_size cannot be negative")
 	}
 
+	if err := config.UI.TerminalSettings().Validate(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(config.UI.AnswerRendering) {
+	case "", "auto", "stream", "buffered":
+	default:
+		return fmt.Errorf("answer_rendering must be auto, stream or buffered, got %q", config.UI.AnswerRendering)
+	}
+
+	switch strings.ToLower(config.UI.Spinner) {
+	case "", "classic", "dots", "line", "bounce", "pulse":
+	default:
+		return fmt.Errorf("spinner must be classic, dots, line, bounce or pulse, got %q", config.UI.Spinner)
+	}
+
 	// Validate Context config
 	if config.Context.MaxFilesInContext < 0 {
 		return fmt.Errorf("max_files_in_context cannot be negative")
 	}
 
+	if config.Context.MaxListingFiles < 0 {
+		return fmt.Errorf("max_listing_files cannot be negative")
+	}
+
+	if config.Memory.SaveDelay < 0 || config.Memory.MaxSaveDelay < 0 {
+		return fmt.Errorf("memory save delays cannot be negative")
+	}
+
+	if config.Memory.TTL < 0 {
+		return fmt.Errorf("memory ttl cannot be negative")
+	}
+
+	if config.Memory.AutoRunMinUses < 0 {
+		return fmt.Errorf("auto_run_min_uses cannot be negative")
+	}
+
+	if config.Memory.AutoRunMinScore < 0 || config.Memory.AutoRunMinScore > 1 {
+		return fmt.Errorf("auto_run_min_score must be between 0 and 1")
+	}
+
+	// Validate Logs config
+	switch config.Logs.HistoryFormat {
+	case "", "jsonl", "text":
+	default:
+		return fmt.Errorf("history_format must be jsonl or text, got %q", config.Logs.HistoryFormat)
+	}
+
+	if config.Logs.MaxFileSizeMB < 0 || config.Logs.MaxFiles < 0 || config.Logs.RetentionDays < 0 {
+		return fmt.Errorf("log size limits cannot be negative")
+	}
+
+	if _, err := m.GetRequestTemplates(); err != nil {
+		return fmt.Errorf("invalid templates: %w", err)
+	}
+
 	return nil
 }
 
@@ -236,22 +614,45 @@ func (m *Manager) GetConfigSummary() map[string]interface{} {
 			"model":       config.API.Model,
 			"max_tokens":  config.API.MaxTokens,
 			"temperature": config.API.Temperature,
+			"choices":     config.API.Choices,
+			"timeout":     config.API.Timeout.String(),
+			"max_cost":    config.API.MaxCost,
 			"configured":  m.IsProviderConfigured(),
 		},
 		"ui": map[string]interface{}{
-			"theme":        config.UI.Theme,
-			"language":     config.UI.Language,
-			"history_size": config.UI.HistorySize,
+			"theme":               config.UI.Theme,
+			"language":            config.UI.Language,
+			"history_size":        config.UI.HistorySize,
+			"compact_suggestions": config.UI.CompactSuggestions,
+			"colors":              config.UI.Colors,
+			"emoji":               config.UI.Emoji,
+			"clipboard":           config.UI.Clipboard,
+			"answer_rendering":    config.UI.AnswerRendering,
+			"spinner":             config.UI.Spinner,
+			"thinking_message":    config.UI.ThinkingText(),
+			"format_output":       config.UI.FormatOutput,
 		},
 		"behavior": map[string]interface{}{
-			"auto_execute_safe": config.Behavior.AutoExecuteSafeCommands,
-			"confirm_dangerous": config.Behavior.ConfirmDangerousCommands,
-			"collect_stats":     config.Behavior.CollectUsageStats,
+			"auto_execute_safe":     config.Behavior.AutoExecuteSafeCommands,
+			"confirm_dangerous":     config.Behavior.ConfirmDangerousCommands,
+			"confirm_all":           config.Behavior.ConfirmAll,
+			"copy_on_select":        config.Behavior.CopyOnSelect,
+			"collect_stats":         config.Behavior.CollectUsageStats,
+			"normalize_suggestions": config.Behavior.NormalizeSuggestions,
+			"log_runs":              config.Behavior.LogRuns,
+		},
+		"logs": map[string]interface{}{
+			"history":          config.Logs.History,
+			"history_format":   config.Logs.HistoryFormat,
+			"max_file_size_mb": config.Logs.MaxFileSizeMB,
+			"max_files":        config.Logs.MaxFiles,
+			"retention_days":   config.Logs.RetentionDays,
 		},
 		"context": map[string]interface{}{
-			"include_hidden":   config.Context.IncludeHiddenFiles,
-			"max_files":        config.Context.MaxFilesInContext,
-			"include_env_vars": config.Context.IncludeEnvVars,
+			"include_hidden":    config.Context.IncludeHiddenFiles,
+			"max_files":         config.Context.MaxFilesInContext,
+			"include_env_vars":  config.Context.IncludeEnvVars,
+			"directory_listing": config.Context.IncludeDirectoryListing,
 		},
 	}
 
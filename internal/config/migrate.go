@@ -0,0 +1,226 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion is the layout version of config files written by this
+// version of clia. Files without a version field are version 1.
+const CurrentConfigVersion = 3
+
+// configMigration upgrades the raw layout of a config file by one version
+// and describes the changes it made
+type configMigration func(raw map[string]interface{}) []string
+
+// configMigrations upgrade config files; the migration at index i upgrades
+// version i+1 to version i+2
+var configMigrations = []configMigration{
+	migrateProviderKeys,
+	migrateSuggestionTimeout,
+}
+
+// Migration describes the upgrade of a config file to the current layout
+type Migration struct {
+	From, To   int
+	Changes    []string
+	BackupPath string // Copy of the file before the upgrade; empty if it was not written
+}
+
+// migrateConfig upgrades the raw layout of a config file of version from to
+// CurrentConfigVersion and returns the changes made
+func migrateConfig(raw map[string]interface{}, from int) []string {
+	var changes []string
+	for version := from; version < CurrentConfigVersion; version++ {
+		if version < 1 || version > len(configMigrations) {
+			continue
+		}
+		for _, change := range configMigrations[version-1](raw) {
+			changes = append(changes, fmt.Sprintf("v%d → v%d: %s", version, version+1, change))
+		}
+	}
+	raw["version"] = CurrentConfigVersion
+	return changes
+}
+
+// migrateProviderKeys upgrades version 1, which kept the API key of the
+// active provider in api.key, to per-provider keys. Provider entries replace
+// the defaults as a whole, so settings missing from them are filled in.
+func migrateProviderKeys(raw map[string]interface{}) []string {
+	var changes []string
+	api := rawSection(raw, "api")
+	providers := rawSection(api, "providers")
+
+	if key, _ := api["key"].(string); key != "" {
+		provider, _ := api["provider"].(string)
+		if provider == "" {
+			provider = DefaultConfig().API.Provider
+		}
+		entry := rawSection(providers, provider)
+		if existing, _ := entry["key"].(string); existing == "" {
+			entry["key"] = key
+			changes = append(changes, fmt.Sprintf("moved api.key to api.providers.%s.key", provider))
+		} else {
+			changes = append(changes, fmt.Sprintf("removed api.key, api.providers.%s.key is used instead", provider))
+		}
+	}
+	delete(api, "key")
+
+	defaults := DefaultConfig().API.Providers
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		provider, known := defaults[name]
+		entry, ok := providers[name].(map[string]interface{})
+		if !known || !ok {
+			continue
+		}
+
+		var filled []string
+		for _, field := range []struct {
+			key   string
+			value interface{}
+		}{
+			{"model", provider.Model},
+			{"endpoint", provider.Endpoint},
+			{"max_tokens", provider.MaxTokens},
+			{"temperature", provider.Temperature},
+			{"aliases", provider.Aliases},
+		} {
+			if isEmptyRawValue(entry[field.key]) && !isEmptyRawValue(field.value) {
+				entry[field.key] = field.value
+				filled = append(filled, field.key)
+			}
+		}
+		if len(filled) > 0 {
+			changes = append(changes, fmt.Sprintf("added default %s to api.providers.%s", strings.Join(filled, ", "), name))
+		}
+	}
+	return changes
+}
+
+// legacyTimeout was the default of api.timeout, which files saved before
+// version 3 hold, while suggestion requests were limited to 30s regardless
+const legacyTimeout = 10 * time.Second
+
+// migrateSuggestionTimeout upgrades version 2, whose api.timeout did not
+// apply to suggestion requests. The old default would cut them to 10s, so it
+// is raised to the 30s that applied; other values were set on purpose.
+func migrateSuggestionTimeout(raw map[string]interface{}) []string {
+	api, ok := raw["api"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	value, ok := api["timeout"].(string)
+	if !ok {
+		return nil
+	}
+	if timeout, err := time.ParseDuration(value); err != nil || timeout != legacyTimeout {
+		return nil
+	}
+
+	timeout := DefaultConfig().API.Timeout
+	api["timeout"] = timeout.String()
+	return []string{fmt.Sprintf("raised api.timeout from the old default %s to %s, as it now limits suggestion requests", legacyTimeout, timeout)}
+}
+
+// rawSection returns the mapping under key in raw, creating it if needed
+func rawSection(raw map[string]interface{}, key string) map[string]interface{} {
+	if section, ok := raw[key].(map[string]interface{}); ok {
+		return section
+	}
+	section := make(map[string]interface{})
+	raw[key] = section
+	return section
+}
+
+// isEmptyRawValue reports whether a raw config value is missing or empty
+func isEmptyRawValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case int:
+		return v == 0
+	case float32:
+		return v == 0
+	case float64:
+		return v == 0
+	case map[string]string:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// upgradeConfigData migrates the content of a config file of version from
+// to the current layout
+func upgradeConfigData(data []byte, from int) ([]byte, *Migration, error) {
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	migration := &Migration{From: from, To: CurrentConfigVersion, Changes: migrateConfig(raw, from)}
+	upgraded, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return upgraded, migration, nil
+}
+
+// backupConfig copies the config file before it is upgraded, e.g. to config.yaml.v1.bak
+func (m *Manager) backupConfig(version int) (string, error) {
+	data, err := os.ReadFile(m.configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to back up config file: %w", err)
+	}
+	path := fmt.Sprintf("%s.v%d.bak", m.configPath, version)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to back up config file: %w", err)
+	}
+	return path, nil
+}
+
+// PendingMigration returns the upgrade Load applied in memory to an older
+// config file, or nil if the file is up to date. The file itself is only
+// upgraded by Migrate, or by Save when a setting changes.
+func (m *Manager) PendingMigration() *Migration {
+	if m.migration == nil || m.migration.BackupPath != "" {
+		return nil
+	}
+	return m.migration
+}
+
+// Migrate writes the upgrade of an older config file loaded by Load, after
+// backing the file up, and returns it; nil if the file was up to date
+func (m *Manager) Migrate() (*Migration, error) {
+	migration := m.PendingMigration()
+	if migration == nil {
+		return nil, nil
+	}
+	if err := m.Save(); err != nil {
+		return nil, err
+	}
+	return migration, nil
+}
+
+// FileVersion returns the layout version of the loaded config file, or
+// CurrentConfigVersion if there is none
+func (m *Manager) FileVersion() int {
+	if m.fileVersion == 0 {
+		return CurrentConfigVersion
+	}
+	return m.fileVersion
+}
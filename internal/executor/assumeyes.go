@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// assumeYesProgram is a program that asks for confirmation before changing
+// anything, like "Do you want to continue? [Y/n]"
+type assumeYesProgram struct {
+	flag        string   // Answers its questions with yes
+	subcommands []string // Subcommands that ask; any if empty
+}
+
+// assumeYesPrograms lists the programs whose questions a streamed command
+// stalls on most. The flag goes right after the program name, where all of
+// them accept it.
+var assumeYesPrograms = map[string]assumeYesProgram{
+	"apt":     {"-y", []string{"install", "reinstall", "remove", "purge", "upgrade", "full-upgrade", "dist-upgrade", "autoremove"}},
+	"apt-get": {"-y", []string{"install", "reinstall", "remove", "purge", "upgrade", "dist-upgrade", "autoremove"}},
+	"dnf":     {"-y", []string{"install", "reinstall", "remove", "erase", "upgrade", "update", "downgrade", "autoremove"}},
+	"yum":     {"-y", []string{"install", "reinstall", "remove", "erase", "upgrade", "update", "downgrade", "autoremove"}},
+	"npm":     {"--yes", []string{"init", "create", "exec"}},
+	"npx":     {"--yes", nil},
+	"pacman":  {"--noconfirm", nil},
+	"zypper":  {"--non-interactive", nil},
+}
+
+// assumeYesAnswered lists the flags that already answer with yes
+var assumeYesAnswered = map[string]bool{
+	"-y": true, "--yes": true, "--assume-yes": true, "--assumeyes": true,
+	"--noconfirm": true, "--non-interactive": true,
+}
+
+// AssumeYes returns command with the flag that makes its program answer its
+// own confirmation questions with yes, e.g. "sudo apt -y install jq" for
+// "sudo apt install jq". It returns "" if the program is not known to ask,
+// the flag is already given, or command is more than a single program run.
+func AssumeYes(command string) string {
+	command = strings.TrimSpace(command)
+	if strings.ContainsAny(command, ";&|`$()<>\n") {
+		return ""
+	}
+	words := strings.Fields(command)
+	if len(words) > 0 && words[0] == "sudo" {
+		words = words[1:]
+	}
+	if len(words) < 2 {
+		return ""
+	}
+
+	program, ok := assumeYesPrograms[filepath.Base(words[0])]
+	if !ok {
+		return ""
+	}
+	subcommand := ""
+	for _, arg := range words[1:] {
+		if assumeYesAnswered[arg] || (program.flag == "-y" && isShortFlagWith(arg, 'y')) {
+			return ""
+		}
+		if subcommand == "" && !strings.HasPrefix(arg, "-") {
+			subcommand = arg
+		}
+	}
+	if len(program.subcommands) > 0 && !slices.Contains(program.subcommands, subcommand) {
+		return ""
+	}
+
+	at := strings.Index(command, words[0]) + len(words[0])
+	return command[:at] + " " + program.flag + command[at:]
+}
+
+// isShortFlagWith reports whether arg is a group of short flags, like -qy,
+// that contains flag
+func isShortFlagWith(arg string, flag rune) bool {
+	return strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.ContainsRune(arg[1:], flag)
+}
@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// DiffFrames compares two frames as returned by Screen.Frame cell by cell,
+// text and colors alike. It returns frame b with the cells that changed since
+// frame a shown in reverse video, and each line marked "~ " if it changed or
+// indented by two spaces if not. Cleared text shows as reversed blanks. It
+// returns an empty string if the frames are the same.
+func DiffFrames(a, b string) string {
+	width := max(frameWidth(a), frameWidth(b))
+	height := max(strings.Count(a, "\n"), strings.Count(b, "\n")) + 1
+	if width == 0 {
+		return ""
+	}
+
+	before := parseFrame(a, width, height)
+	after := parseFrame(b, width, height)
+
+	changed := make([]bool, height)
+	anyChanged := false
+	for y := range after {
+		for x := range after[y] {
+			if after[y][x] != before[y][x] {
+				after[y][x].style.attrs |= attrReverse
+				changed[y] = true
+				anyChanged = true
+			}
+		}
+	}
+	if !anyChanged {
+		return ""
+	}
+
+	lines := strings.Split(renderCells(after), "\n")
+	for y, line := range lines {
+		if changed[y] {
+			lines[y] = "~ " + line
+		} else {
+			lines[y] = "  " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// frameWidth returns the number of cells of the longest line of frame
+func frameWidth(frame string) int {
+	width := 0
+	for _, line := range strings.Split(utils.StripANSI(frame), "\n") {
+		width = max(width, utf8.RuneCountInString(line))
+	}
+	return width
+}
+
+// parseFrame draws frame on a screen of the given size and returns its cells
+func parseFrame(frame string, width, height int) [][]cell {
+	screen := NewScreen(width, height)
+	screen.Write([]byte(strings.ReplaceAll(frame, "\n", "\r\n")))
+	return screen.cells
+}
@@ -3,11 +3,14 @@ package executor
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"runtime"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/yourusername/clia/pkg/utils"
 )
 
 // Executor handles command execution with timeout and platform support
@@ -17,6 +20,22 @@ type Executor struct {
 	shell      string
 	env        []string
 	ptyEnabled bool // Enable PTY support for interactive programs
+
+	// Shell state of the session, see shellstate.go
+	prevDir string            // Directory before the last cd
+	aliases map[string]string // Aliases defined with alias, expanded in the first word of commands
+
+	// Directory receiving a log file per executed command; empty disables run logs
+	runLogDir       string
+	runLogStripANSI bool
+
+	// File receiving a record of every executed command; empty disables the history
+	historyPath   string
+	historyFormat string
+	historyMu     sync.Mutex
+
+	// Bounds the size of the history file and run logs
+	logRotation utils.RotationPolicy
 }
 
 // ExecutionResult contains the result of a command execution
@@ -32,9 +51,24 @@ type ExecutionResult struct {
 
 // OutputLine represents a single line of output from a command
 type OutputLine struct {
-	Content   string    `json:"content"`
+	Content string `json:"content"`
+	// Timestamp is when the line was read from the command. Lines of a
+	// stream are sent in the order of their timestamps, whichever of
+	// stdout and stderr they were written to.
 	Timestamp time.Time `json:"timestamp"`
-	IsStderr  bool      `json:"is_stderr"`
+	// Seq numbers the lines of a stream from 1 in the order they are sent
+	Seq      uint64 `json:"seq"`
+	IsStderr bool   `json:"is_stderr"`
+	// Partial is set on a line the command is still redrawing with carriage
+	// returns, e.g. a progress bar. The next line of the same stream, partial
+	// or not, replaces it.
+	Partial bool `json:"partial,omitempty"`
+	// Result is only set on the final line of a stream, sent just before the
+	// channel closes, and carries the exit code and duration of the command
+	Result *ExecutionResult `json:"result,omitempty"`
+	// Prompt is set on a line the command waits to have answered, only sent
+	// by StreamInteractive
+	Prompt *Prompt `json:"prompt,omitempty"`
 }
 
 // New creates a new Executor with default settings
@@ -60,6 +94,11 @@ func (e *Executor) WithWorkDir(dir string) *Executor {
 	return e
 }
 
+// WorkDir returns the directory commands run in
+func (e *Executor) WorkDir() string {
+	return e.workDir
+}
+
 // WithShell sets the shell to use
 func (e *Executor) WithShell(shell string) *Executor {
 	e.shell = shell
@@ -85,6 +124,12 @@ func (e *Executor) IsPTYEnabled() bool {
 
 // Execute runs a command synchronously and returns the complete result
 func (e *Executor) Execute(ctx context.Context, command string) (*ExecutionResult, error) {
+	return e.ExecuteWithInput(ctx, command, nil)
+}
+
+// ExecuteWithInput runs a command like Execute, feeding stdin to its standard
+// input. A nil stdin gives the command no input.
+func (e *Executor) ExecuteWithInput(ctx context.Context, command string, stdin io.Reader) (*ExecutionResult, error) {
 	startTime := time.Now()
 
 	// Create context with timeout
@@ -101,6 +146,7 @@ func (e *Executor) Execute(ctx context.Context, command string) (*ExecutionResul
 			Duration: time.Since(startTime),
 		}, err
 	}
+	cmd.Stdin = stdin
 
 	// Capture output
 	stdout, err := cmd.StdoutPipe()
@@ -160,6 +206,12 @@ func (e *Executor) Execute(ctx context.Context, command string) (*ExecutionResul
 		Pid:      cmd.Process.Pid,
 	}
 
+	runLog := e.openRunLog(command, startTime)
+	runLog.Write(result.Stdout)
+	runLog.Write(result.Stderr)
+	defer runLog.Close(result)
+	defer e.recordHistory(result, startTime)
+
 	// Handle errors
 	if err1 != nil {
 		result.Error = fmt.Errorf("failed to read stdout: %w", err1)
@@ -177,10 +229,62 @@ func (e *Executor) Execute(ctx context.Context, command string) (*ExecutionResul
 	return result, nil
 }
 
+// streamBufferSize is the capacity of the channel returned by Stream. Readers
+// block when it is full, which in turn blocks the command once its pipe fills up.
+const streamBufferSize = 1024
+
 // Stream runs a command and returns a channel of output lines
 func (e *Executor) Stream(ctx context.Context, command string) (<-chan OutputLine, error) {
+	return e.StreamWithInput(ctx, command, nil)
+}
+
+// StreamWithInput runs a command like Stream, feeding stdin to its standard
+// input. A nil stdin gives the command no input.
+func (e *Executor) StreamWithInput(ctx context.Context, command string, stdin io.Reader) (<-chan OutputLine, error) {
+	return e.stream(ctx, command, e.timeout, func(cmd *exec.Cmd) (*promptTerminal, error) {
+		cmd.Stdin = stdin
+		return nil, nil
+	})
+}
+
+// StreamUntilCanceled runs a command like Stream without the executor
+// timeout: it runs until it exits or ctx is canceled, e.g. a background job.
+func (e *Executor) StreamUntilCanceled(ctx context.Context, command string) (<-chan OutputLine, error) {
+	return e.stream(ctx, command, 0, func(cmd *exec.Cmd) (*promptTerminal, error) {
+		return nil, nil
+	})
+}
+
+// StreamInteractive runs a command like Stream, keeping its standard input
+// open for answers to the prompts it asks. A line the command waits to have
+// answered, e.g. "Do you want to continue? [Y/n]", carries the Prompt; the
+// answer is written to the returned writer and closing it ends the input.
+// On Unix the input is a PTY that is also the controlling terminal of the
+// command, so prompts written to /dev/tty, like git asking for credentials,
+// are streamed too.
+func (e *Executor) StreamInteractive(ctx context.Context, command string) (<-chan OutputLine, io.WriteCloser, error) {
+	var terminal *promptTerminal
+	output, err := e.stream(ctx, command, e.timeout, func(cmd *exec.Cmd) (*promptTerminal, error) {
+		var err error
+		terminal, err = attachPromptTerminal(cmd)
+		return terminal, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return output, terminal.input, nil
+}
+
+// stream starts command with its standard input set up by attachInput and
+// streams its output, stopping it after timeout unless that is 0. A prompt
+// terminal returned by attachInput is read for output too, and prompts are
+// detected in everything the command prints.
+func (e *Executor) stream(ctx context.Context, command string, timeout time.Duration, attachInput func(*exec.Cmd) (*promptTerminal, error)) (<-chan OutputLine, error) {
 	// Create context with timeout
-	timeoutCtx, cancel := context.WithTimeout(ctx, e.timeout)
+	timeoutCtx, cancel := context.WithCancel(ctx)
+	if timeout > 0 {
+		timeoutCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
 
 	// Prepare command
 	cmd, err := e.prepareCommand(timeoutCtx, command)
@@ -188,144 +292,293 @@ func (e *Executor) Stream(ctx context.Context, command string) (<-chan OutputLin
 		cancel()
 		return nil, fmt.Errorf("failed to prepare command: %w", err)
 	}
+	terminal, err := attachInput(cmd)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to attach input: %w", err)
+	}
+	detectPrompts := terminal != nil
 
-	// Create output channel
-	outputChan := make(chan OutputLine, 100) // Buffered channel
+	// Create output channel; the readers send to lines, which are merged
+	// into outputChan in the order they were read
+	outputChan := make(chan OutputLine, streamBufferSize)
+	lines := make(chan OutputLine, streamBufferSize)
 
 	// Setup pipes
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		cancel()
+		terminal.Close()
 		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
 		cancel()
+		terminal.Close()
 		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
 	// Start command
+	startTime := time.Now()
 	if err := cmd.Start(); err != nil {
 		cancel()
+		terminal.Close()
 		return nil, fmt.Errorf("failed to start command: %w", err)
 	}
+	terminal.started()
 
 	// Start goroutines to read output
-	go e.streamReader(stdout, outputChan, false, cancel)
-	go e.streamReader(stderr, outputChan, true, cancel)
+	go mergeLines(ctx, lines, outputChan)
+	runLog := e.openRunLog(command, startTime)
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		e.streamReader(timeoutCtx, stdout, lines, false, detectPrompts, runLog)
+	}()
+	go func() {
+		defer readers.Done()
+		e.streamReader(timeoutCtx, stderr, lines, true, detectPrompts, runLog)
+	}()
+
+	// What the command writes to its terminal is output too, e.g. prompts
+	// for credentials; it is read until the terminal is closed
+	var terminalReader sync.WaitGroup
+	if terminal != nil && terminal.output != nil {
+		terminalReader.Add(1)
+		go func() {
+			defer terminalReader.Done()
+			e.streamReader(timeoutCtx, terminal.output, lines, false, true, runLog)
+		}()
+	}
+
+	// Unblock the readers on timeout even if a background child keeps the pipes open
+	go func() {
+		<-timeoutCtx.Done()
+		stdout.Close()
+		stderr.Close()
+		terminal.Close()
+	}()
 
 	// Wait for command completion in background
 	go func() {
 		defer cancel()
-		defer close(outputChan)
+		defer close(lines)
+
+		// All reads must finish before Wait closes the pipes, and before the
+		// channel is closed so readers never send on a closed channel
+		readers.Wait()
+
+		result := &ExecutionResult{
+			Command: command,
+			Pid:     cmd.Process.Pid,
+		}
 
 		err := cmd.Wait()
+		terminal.Close()
+		terminalReader.Wait()
+		result.Duration = time.Since(startTime)
 		if err != nil {
-			outputChan <- OutputLine{
-				Content:   fmt.Sprintf("Command failed: %v", err),
-				Timestamp: time.Now(),
-				IsStderr:  true,
+			result.ExitCode = -1
+			if exitError, ok := err.(*exec.ExitError); ok {
+				result.ExitCode = exitError.ExitCode()
+			} else {
+				result.Error = err
 			}
 		}
+		if timeoutCtx.Err() == context.DeadlineExceeded {
+			result.Error = fmt.Errorf("command timed out after %v", timeout)
+		}
+		runLog.Close(result)
+		e.recordHistory(result, startTime)
+
+		// The final status is sent even after a timeout; only the caller
+		// giving up on the stream drops it
+		select {
+		case lines <- OutputLine{Timestamp: time.Now(), Result: result}:
+		case <-ctx.Done():
+		}
 	}()
 
 	return outputChan, nil
 }
 
-// streamReader reads from a pipe and sends lines to the output channel
-func (e *Executor) streamReader(pipe interface {
+// sendLine sends a line to the output channel, blocking until the consumer
+// catches up or the context is done. It returns false if the context is done.
+func sendLine(ctx context.Context, outputChan chan<- OutputLine, line OutputLine) bool {
+	select {
+	case outputChan <- line:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// streamReader reads from a pipe and sends lines to the output channel,
+// writing them to the run log as well. Lines are stamped with the time their
+// first bytes were read. An incomplete line redrawn with carriage returns is
+// sent as a partial line each time it changes. With detectPrompts, an
+// incomplete last line that is a prompt is sent right away, as the command
+// waits for an answer before finishing it.
+func (e *Executor) streamReader(ctx context.Context, pipe interface {
 	Read([]byte) (int, error)
-}, outputChan chan<- OutputLine, isStderr bool, cancel context.CancelFunc) {
+}, outputChan chan<- OutputLine, isStderr, detectPrompts bool, runLog *runLog) {
 	defer func() {
 		if r := recover(); r != nil {
-			outputChan <- OutputLine{
+			sendLine(ctx, outputChan, OutputLine{
 				Content:   fmt.Sprintf("Stream reader error: %v", r),
 				Timestamp: time.Now(),
 				IsStderr:  true,
-			}
+			})
 		}
 	}()
 
 	buf := make([]byte, 4096)
 	leftover := ""
+	var leftoverAt time.Time
+	partial := "" // What was last sent of the incomplete line
 
 	for {
 		n, err := pipe.Read(buf)
 		if n > 0 {
+			readAt := time.Now()
+			if leftover == "" {
+				leftoverAt = readAt
+			}
 			data := leftover + string(buf[:n])
 			lines := strings.Split(data, "\n")
 
 			// Process all complete lines
 			for i := 0; i < len(lines)-1; i++ {
+				runLog.WriteLine(lines[i])
+				lineAt := readAt
+				if i == 0 {
+					lineAt = leftoverAt
+				}
 				if lines[i] != "" || i == 0 { // Include empty lines except pure separators
-					select {
-					case outputChan <- OutputLine{
-						Content:   lines[i],
-						Timestamp: time.Now(),
+					if !sendLine(ctx, outputChan, OutputLine{
+						Content:   overwriteLine(lines[i]),
+						Timestamp: lineAt,
 						IsStderr:  isStderr,
-					}:
-					default:
-						// Channel is full, skip this line to prevent blocking
+					}) {
+						return
 					}
 				}
 			}
 
 			// Keep the last incomplete line for next iteration
+			if len(lines) > 1 {
+				leftoverAt = readAt
+				partial = ""
+			}
 			leftover = lines[len(lines)-1]
+
+			if detectPrompts {
+				if prompt, ok := DetectPrompt(overwriteLine(leftover)); ok {
+					runLog.WriteLine(leftover)
+					if !sendLine(ctx, outputChan, OutputLine{
+						Content:   overwriteLine(leftover),
+						Timestamp: leftoverAt,
+						IsStderr:  isStderr,
+						Prompt:    &prompt,
+					}) {
+						return
+					}
+					leftover, partial = "", ""
+				}
+			}
+
+			// A line redrawn with carriage returns is shown as it changes
+			if strings.Contains(leftover, "\r") {
+				if shown := overwriteLine(leftover); shown != partial {
+					if !sendLine(ctx, outputChan, OutputLine{
+						Content:   shown,
+						Timestamp: leftoverAt,
+						IsStderr:  isStderr,
+						Partial:   true,
+					}) {
+						return
+					}
+					partial = shown
+				}
+			}
 		}
 
 		if err != nil {
 			// Send any remaining data
 			if leftover != "" {
-				select {
-				case outputChan <- OutputLine{
-					Content:   leftover,
-					Timestamp: time.Now(),
+				runLog.WriteLine(leftover)
+				sendLine(ctx, outputChan, OutputLine{
+					Content:   overwriteLine(leftover),
+					Timestamp: leftoverAt,
 					IsStderr:  isStderr,
-				}:
-				default:
-					// Channel full
-				}
+				})
 			}
 
 			if err.Error() != "EOF" {
-				select {
-				case outputChan <- OutputLine{
+				sendLine(ctx, outputChan, OutputLine{
 					Content:   fmt.Sprintf("Read error: %v", err),
 					Timestamp: time.Now(),
 					IsStderr:  true,
-				}:
-				default:
-					// Channel full
-				}
+				})
 			}
 			break
 		}
 	}
 }
 
+// Command returns an exec.Cmd configured with the executor's shell, working
+// directory and environment, for callers that attach it to the terminal themselves
+func (e *Executor) Command(ctx context.Context, command string) (*exec.Cmd, error) {
+	return e.prepareCommand(ctx, command)
+}
+
+// RunAttached runs command attached to the given terminal streams, for
+// commands that need the terminal such as sudo password prompts, and records
+// it in the history and run log like captured runs. Its output only goes to
+// the terminal, so the run log has just the header with the exit code and
+// duration. The error is set if the command could not be started or waited for.
+func (e *Executor) RunAttached(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) (*ExecutionResult, error) {
+	startTime := time.Now()
+	result := &ExecutionResult{Command: command, ExitCode: -1}
+
+	runLog := e.openRunLog(command, startTime)
+	defer func() {
+		result.Duration = time.Since(startTime)
+		runLog.Close(result)
+		e.recordHistory(result, startTime)
+	}()
+
+	cmd, err := e.prepareCommand(ctx, command)
+	if err != nil {
+		result.Error = err
+		return result, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+
+	err = cmd.Run()
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+		result.Pid = cmd.ProcessState.Pid()
+	}
+	if _, exited := err.(*exec.ExitError); err != nil && !exited {
+		result.Error = err
+		return result, err
+	}
+	return result, nil
+}
+
 // prepareCommand creates and configures the exec.Cmd
 func (e *Executor) prepareCommand(ctx context.Context, command string) (*exec.Cmd, error) {
-	var cmd *exec.Cmd
-
-	// Platform-specific command preparation
-	switch runtime.GOOS {
-	case "windows":
-		// Use cmd or powershell on Windows
-		if strings.Contains(e.shell, "powershell") || strings.Contains(e.shell, "pwsh") {
-			cmd = exec.CommandContext(ctx, e.shell, "-NoProfile", "-Command", command)
-		} else {
-			cmd = exec.CommandContext(ctx, "cmd", "/C", command)
-		}
-	default:
-		// Use shell on Unix-like systems
-		shellPath := e.shell
-		if shellPath == "" {
-			shellPath = "/bin/sh"
-		}
-		cmd = exec.CommandContext(ctx, shellPath, "-c", command)
-	}
+	return e.prepareResolved(ctx, e.expandAlias(command))
+}
+
+// prepareResolved prepares command, whose alias is already expanded
+func (e *Executor) prepareResolved(ctx context.Context, command string) (*exec.Cmd, error) {
+	// The shell invocation differs per platform, see shell_unix.go and shell_windows.go
+	name, args := shellCommand(e.shell, command)
+	cmd := exec.CommandContext(ctx, name, args...)
 
 	// Set working directory
 	if e.workDir != "" {
@@ -340,36 +593,6 @@ func (e *Executor) prepareCommand(ctx context.Context, command string) (*exec.Cm
 	return cmd, nil
 }
 
-// detectShell detects the appropriate shell for the current platform
-func detectShell() string {
-	switch runtime.GOOS {
-	case "windows":
-		// Check for PowerShell first, then fall back to cmd
-		if _, err := exec.LookPath("powershell.exe"); err == nil {
-			return "powershell.exe"
-		}
-		if _, err := exec.LookPath("pwsh.exe"); err == nil {
-			return "pwsh.exe"
-		}
-		return "cmd.exe"
-	default:
-		// Unix-like systems: check SHELL environment variable
-		if shell := os.Getenv("SHELL"); shell != "" {
-			return shell
-		}
-
-		// Check for common shells
-		shells := []string{"/bin/bash", "/usr/bin/bash", "/bin/zsh", "/usr/bin/zsh", "/bin/sh"}
-		for _, shell := range shells {
-			if _, err := os.Stat(shell); err == nil {
-				return shell
-			}
-		}
-
-		return "/bin/sh" // fallback
-	}
-}
-
 // getCurrentDir gets the current working directory
 func getCurrentDir() string {
 	if dir, err := os.Getwd(); err == nil {
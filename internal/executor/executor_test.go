@@ -2,10 +2,17 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/yourusername/clia/pkg/utils"
 )
 
 func TestNew(t *testing.T) {
@@ -153,6 +160,50 @@ func TestDetectShell(t *testing.T) {
 	}
 }
 
+func TestShellCommand(t *testing.T) {
+	type shellCase struct {
+		shell string
+		name  string
+		args  []string
+	}
+
+	tests := []shellCase{
+		{"/bin/zsh", "/bin/zsh", []string{"-c", "dir"}},
+		{"", "/bin/sh", []string{"-c", "dir"}},
+	}
+	if runtime.GOOS == "windows" {
+		tests = []shellCase{
+			{"powershell.exe", "powershell.exe", []string{"-NoProfile", "-Command", "dir"}},
+			{`C:\Windows\System32\cmd.exe`, "cmd", []string{"/C", "dir"}},
+			{"", "cmd", []string{"/C", "dir"}},
+			{`C:\Program Files\Git\bin\bash.exe`, `C:\Program Files\Git\bin\bash.exe`, []string{"-c", "dir"}},
+		}
+	}
+
+	for _, tt := range tests {
+		name, args := shellCommand(tt.shell, "dir")
+		if name != tt.name || strings.Join(args, " ") != strings.Join(tt.args, " ") {
+			t.Errorf("shellCommand(%q) = %s %v, expected %s %v", tt.shell, name, args, tt.name, tt.args)
+		}
+	}
+}
+
+func TestIsTUIProgram(t *testing.T) {
+	e := NewPTYExecutor()
+	for command, expected := range map[string]bool{
+		"vim notes.txt":                  true,
+		"/usr/bin/htop":                  true,
+		`C:\Tools\Vim\vim.exe notes.txt`: true,
+		"NANO.EXE file":                  true,
+		"ls -la":                         false,
+		"":                               false,
+	} {
+		if got := e.IsTUIProgram(command); got != expected {
+			t.Errorf("IsTUIProgram(%q) = %v, expected %v", command, got, expected)
+		}
+	}
+}
+
 func TestIsCommandSafe(t *testing.T) {
 	tests := []struct {
 		command  string
@@ -208,6 +259,50 @@ func TestIsDangerousCommand(t *testing.T) {
 	}
 }
 
+func TestUsesSudo(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected bool
+	}{
+		{"sudo apt update", true},
+		{"/usr/bin/sudo ls /root", true},
+		{"cd /tmp && sudo make install", true},
+		{"DEBIAN_FRONTEND=noninteractive sudo apt install -y git", true},
+		{"echo done; sudo -u postgres psql", true},
+		{"ls -la", false},
+		{"echo sudo", false},
+		{"grep sudo /var/log/auth.log", false},
+	}
+
+	for _, test := range tests {
+		result := UsesSudo(test.command)
+		if result != test.expected {
+			t.Errorf("UsesSudo(%q) = %v, expected %v", test.command, result, test.expected)
+		}
+	}
+}
+
+func TestSudoReadsPasswordFromStdin(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected bool
+	}{
+		{"echo secret | sudo -S apt update", true},
+		{"echo secret | sudo --stdin ls", true},
+		{"echo secret | sudo -u root -kS ls", true},
+		{"sudo apt update", false},
+		{"sudo -u postgres psql -S", false},
+		{"ls -S", false},
+	}
+
+	for _, test := range tests {
+		result := SudoReadsPasswordFromStdin(test.command)
+		if result != test.expected {
+			t.Errorf("SudoReadsPasswordFromStdin(%q) = %v, expected %v", test.command, result, test.expected)
+		}
+	}
+}
+
 func TestExecute_WorkingDirectory(t *testing.T) {
 	executor := New()
 	ctx := context.Background()
@@ -427,3 +522,1042 @@ func TestStream_Timestamps(t *testing.T) {
 		}
 	}
 }
+
+func TestStream_CarriageReturns(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Uses printf and sleep")
+	}
+
+	// A line redrawn with carriage returns is sent as it changes
+	outputChan, err := New().Stream(context.Background(), `printf '10%%\r'; sleep 0.2; printf '50%%\r'; sleep 0.2; printf '100%%\ndone\r\n'`)
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	var lines []string
+	for output := range outputChan {
+		if output.Result != nil {
+			continue
+		}
+		if output.Partial {
+			lines = append(lines, "partial "+output.Content)
+		} else {
+			lines = append(lines, output.Content)
+		}
+	}
+	expected := []string{"partial 10%", "partial 50%", "100%", "done"}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+
+	for line, expected := range map[string]string{
+		"plain":                  "plain",
+		"50%\r100%":              "100%",
+		"downloading\rdone":      "doneloading",
+		"crlf\r":                 "crlf",
+		"[##  ] 50%\r[####] 99%": "[####] 99%",
+	} {
+		if shown := overwriteLine(line); shown != expected {
+			t.Errorf("overwriteLine(%q) = %q, expected %q", line, shown, expected)
+		}
+	}
+}
+
+func TestStream_Ordering(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Uses a POSIX shell")
+	}
+
+	executor := New()
+	command := "echo out1; sleep 0.05; echo err1 >&2; sleep 0.05; echo out2; sleep 0.05; echo err2 >&2"
+	outputChan, err := executor.Stream(context.Background(), command)
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+
+	var got []string
+	var last OutputLine
+	for output := range outputChan {
+		if output.Seq != last.Seq+1 {
+			t.Errorf("Expected line %d, got %d", last.Seq+1, output.Seq)
+		}
+		if output.Timestamp.Before(last.Timestamp) {
+			t.Errorf("Line %d is older than the line before it", output.Seq)
+		}
+		last = output
+		if output.Result == nil {
+			got = append(got, output.Content)
+		}
+	}
+
+	if want := "out1 err1 out2 err2"; strings.Join(got, " ") != want {
+		t.Errorf("Expected %q in order, got %q", want, strings.Join(got, " "))
+	}
+	if last.Result == nil {
+		t.Error("Expected the final result last")
+	}
+}
+
+func TestDiffFrames(t *testing.T) {
+	a := "CPU  12%\n\x1b[0;32mok\x1b[0m\nstale"
+	b := "CPU  47%\n\x1b[0;31mok\x1b[0m"
+
+	diff := DiffFrames(a, b)
+	lines := strings.Split(diff, "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %q", diff)
+	}
+	// Only the changed digits are highlighted
+	if lines[0] != "~ CPU  \x1b[0;7m47\x1b[0m%" {
+		t.Errorf("Expected the changed number highlighted, got %q", lines[0])
+	}
+	// A change of color is a change too
+	if lines[1] != "~ \x1b[0;7;31mok\x1b[0m" {
+		t.Errorf("Expected the recolored text highlighted, got %q", lines[1])
+	}
+	// Cleared text shows as highlighted blanks
+	if lines[2] != "~ \x1b[0;7m     \x1b[0m" {
+		t.Errorf("Expected the cleared line highlighted, got %q", lines[2])
+	}
+
+	if diff := DiffFrames(a, a); diff != "" {
+		t.Errorf("Expected no diff for the same frame, got %q", diff)
+	}
+	if diff := DiffFrames("same\nold", "same\nnew"); !strings.HasPrefix(diff, "  same\n~ ") {
+		t.Errorf("Expected unchanged lines indented, got %q", diff)
+	}
+}
+
+func TestCaptureFrames(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Capturing needs a PTY")
+	}
+
+	command := `i=0; while true; do printf '\033[H\033[2Jframe %d\n' $i; i=$((i+1)); sleep 0.05; done`
+	frames, err := NewPTYExecutor().CaptureFrames(context.Background(), command, 20, 5, 200*time.Millisecond, 2)
+	if err != nil {
+		t.Fatalf("CaptureFrames failed: %v", err)
+	}
+	if len(frames) != 2 || !strings.HasPrefix(frames[0], "frame ") || frames[0] == frames[1] {
+		t.Errorf("Expected two different frames, got %q", frames)
+	}
+}
+
+func TestMergeLines(t *testing.T) {
+	start := time.Now()
+	in := make(chan OutputLine, 8)
+	out := make(chan OutputLine, 8)
+
+	// Lines read from two pipes arrive out of order, the result comes last
+	in <- OutputLine{Content: "b", Timestamp: start.Add(2 * time.Millisecond), IsStderr: true}
+	in <- OutputLine{Content: "a", Timestamp: start.Add(time.Millisecond)}
+	in <- OutputLine{Content: "c", Timestamp: start.Add(3 * time.Millisecond)}
+	in <- OutputLine{Timestamp: start.Add(3 * time.Millisecond), Result: &ExecutionResult{}}
+	close(in)
+	mergeLines(context.Background(), in, out)
+
+	var got []string
+	for line := range out {
+		if line.Result != nil {
+			got = append(got, "result")
+		} else {
+			got = append(got, line.Content)
+		}
+		if line.Seq != uint64(len(got)) {
+			t.Errorf("Expected %q to be line %d, got %d", line.Content, len(got), line.Seq)
+		}
+	}
+	if strings.Join(got, ",") != "a,b,c,result" {
+		t.Errorf("Expected a,b,c,result, got %v", got)
+	}
+
+	// Lines are dropped once the consumer gave up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	in = make(chan OutputLine, 1)
+	out = make(chan OutputLine)
+	in <- OutputLine{Content: "dropped", Timestamp: start}
+	close(in)
+	mergeLines(ctx, in, out)
+	if _, ok := <-out; ok {
+		t.Error("Expected no lines after the context is done")
+	}
+}
+
+func TestStream_HighThroughput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	executor := New()
+	outputChan, err := executor.Stream(context.Background(), "seq 1 20000")
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+
+	// No line may be dropped when the producer outpaces the consumer
+	count := 0
+	var result *ExecutionResult
+	for output := range outputChan {
+		if output.Result != nil {
+			result = output.Result
+			continue
+		}
+		count++
+	}
+
+	if count != 20000 {
+		t.Errorf("Expected 20000 lines, got %d", count)
+	}
+	if result == nil {
+		t.Error("Expected a final result after all output lines")
+	}
+}
+
+func TestStream_FinalResult(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	tests := []struct {
+		name     string
+		executor *Executor
+		command  string
+		exitCode int
+		timedOut bool
+	}{
+		{"success", New(), "echo ok", 0, false},
+		{"failure", New(), "echo oops >&2; exit 3", 3, false},
+		{"timeout", New().WithTimeout(200 * time.Millisecond), "sleep 5", -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputChan, err := tt.executor.Stream(context.Background(), tt.command)
+			if err != nil {
+				t.Fatalf("Stream failed: %v", err)
+			}
+
+			var results []*ExecutionResult
+			for output := range outputChan {
+				if output.Result != nil {
+					results = append(results, output.Result)
+				} else if len(results) > 0 {
+					t.Error("Expected the result to be the last line")
+				}
+			}
+
+			if len(results) != 1 {
+				t.Fatalf("Expected exactly one result, got %d", len(results))
+			}
+			result := results[0]
+			if result.ExitCode != tt.exitCode {
+				t.Errorf("Expected exit code %d, got %d", tt.exitCode, result.ExitCode)
+			}
+			if result.Duration <= 0 || result.Command != tt.command {
+				t.Errorf("Expected command and duration to be set, got %+v", result)
+			}
+			if timedOut := result.Error != nil && strings.Contains(result.Error.Error(), "timed out"); timedOut != tt.timedOut {
+				t.Errorf("Expected timed out = %v, got error %v", tt.timedOut, result.Error)
+			}
+		})
+	}
+}
+
+func TestDetectPrompt(t *testing.T) {
+	tests := []struct {
+		text   string
+		prompt bool
+		secret bool
+	}{
+		{"Do you want to continue? [Y/n] ", true, false},
+		{"Proceed (y/N)?", true, false},
+		{"Are you sure you want to continue connecting (yes/no/[fingerprint])? ", true, false},
+		{"Username for 'https://github.com': ", true, false},
+		{"rm: remove regular file 'notes.txt'? ", true, false},
+		{"[sudo] password for bob: ", true, true},
+		{"Password for 'https://bob@github.com': ", true, true},
+		{"Enter passphrase for key '/home/bob/.ssh/id_ed25519': ", true, true},
+		{"Reading package lists... Done", false, false},
+		{"Password updated successfully", false, false},
+		{"Downloading 45%", false, false},
+		{"", false, false},
+	}
+
+	for _, tt := range tests {
+		prompt, ok := DetectPrompt(tt.text)
+		if ok != tt.prompt || prompt.Secret != tt.secret {
+			t.Errorf("DetectPrompt(%q) = %+v, %v; want prompt %v, secret %v", tt.text, prompt, ok, tt.prompt, tt.secret)
+		}
+		if ok && prompt.Text != strings.TrimSpace(tt.text) {
+			t.Errorf("DetectPrompt(%q) text = %q", tt.text, prompt.Text)
+		}
+	}
+}
+
+func TestAssumeYes(t *testing.T) {
+	tests := map[string]string{
+		"apt install jq":                     "apt -y install jq",
+		"sudo apt-get upgrade":               "sudo apt-get -y upgrade",
+		"  dnf remove  httpd":                "dnf -y remove  httpd",
+		"npm init":                           "npm --yes init",
+		"npx create-react-app web":           "npx --yes create-react-app web",
+		"pacman -S git":                      "pacman --noconfirm -S git",
+		"/usr/bin/apt install jq":            "/usr/bin/apt -y install jq",
+		"apt -y install jq":                  "",
+		"apt-get -qy install jq":             "",
+		"dnf install --assumeyes jq":         "",
+		"apt list --installed":               "",
+		"npm install":                        "",
+		"git push":                           "",
+		"apt install jq && ls":               "",
+		"apt":                                "",
+		"yes | apt-get install jq":           "",
+		"zypper install --no-recommends vim": "zypper --non-interactive install --no-recommends vim",
+	}
+	for command, want := range tests {
+		if got := AssumeYes(command); got != want {
+			t.Errorf("AssumeYes(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestStreamInteractive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		answer  string
+		want    string
+		secret  bool
+	}{
+		{"stdout prompt", `printf 'Continue? [y/N] '; read a; echo "got $a"`, "y", "got y", false},
+		{"terminal prompt", `printf 'Password: ' >/dev/tty; read -r p </dev/tty; echo "pw $p"`, "hunter2", "pw hunter2", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputChan, input, err := New().WithTimeout(5*time.Second).StreamInteractive(context.Background(), tt.command)
+			if err != nil {
+				t.Fatalf("StreamInteractive failed: %v", err)
+			}
+			defer input.Close()
+
+			var prompts []Prompt
+			var lines []string
+			var result *ExecutionResult
+			for output := range outputChan {
+				switch {
+				case output.Result != nil:
+					result = output.Result
+				case output.Prompt != nil:
+					prompts = append(prompts, *output.Prompt)
+					if _, err := input.Write([]byte(tt.answer + "\n")); err != nil {
+						t.Fatalf("Failed to answer: %v", err)
+					}
+				default:
+					lines = append(lines, output.Content)
+				}
+			}
+
+			if len(prompts) != 1 || prompts[0].Secret != tt.secret {
+				t.Fatalf("Expected one prompt with secret = %v, got %+v", tt.secret, prompts)
+			}
+			if len(lines) != 1 || lines[0] != tt.want {
+				t.Errorf("Expected output %q after the answer, got %q", tt.want, lines)
+			}
+			if result == nil || result.ExitCode != 0 || result.Error != nil {
+				t.Errorf("Expected the command to succeed, got %+v", result)
+			}
+		})
+	}
+
+	// Closing the input ends the command waiting at a prompt
+	outputChan, input, err := New().WithTimeout(5*time.Second).StreamInteractive(context.Background(), `printf 'Continue? [y/N] '; read a || echo "no answer"`)
+	if err != nil {
+		t.Fatalf("StreamInteractive failed: %v", err)
+	}
+	var result *ExecutionResult
+	for output := range outputChan {
+		if output.Prompt != nil {
+			input.Close()
+		}
+		if output.Result != nil {
+			result = output.Result
+		}
+	}
+	if result == nil || (result.Error != nil && strings.Contains(result.Error.Error(), "timed out")) {
+		t.Errorf("Expected closing the input to end the command, got %+v", result)
+	}
+}
+
+func BenchmarkStream(b *testing.B) {
+	if runtime.GOOS == "windows" {
+		b.Skip("Skipping on Windows")
+	}
+
+	executor := New()
+	for i := 0; i < b.N; i++ {
+		outputChan, err := executor.Stream(context.Background(), "seq 1 20000")
+		if err != nil {
+			b.Fatalf("Stream failed: %v", err)
+		}
+		for range outputChan {
+		}
+	}
+}
+
+func TestRunLog(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	dir := t.TempDir()
+	executor := New().WithRunLog(dir, true)
+
+	if _, err := executor.Execute(context.Background(), "printf '\\033[31mred\\033[0m\\n'; echo oops >&2; exit 2"); err == nil {
+		t.Fatal("Expected the command to fail")
+	}
+
+	outputChan, err := executor.Stream(context.Background(), "echo streamed")
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	for range outputChan {
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 2 {
+		t.Fatalf("Expected a log file per command, got %v", files)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("Expected temporary files to be removed, got %v", leftovers)
+	}
+
+	var logs []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, string(data))
+	}
+	combined := strings.Join(logs, "\n")
+
+	for _, expected := range []string{"# Command:   printf", "# Exit code: 2", "# Duration:", "red\n", "oops\n", "# Command:   echo streamed", "# Exit code: 0", "streamed\n"} {
+		if !strings.Contains(combined, expected) {
+			t.Errorf("Expected the run logs to contain %q, got:\n%s", expected, combined)
+		}
+	}
+	if strings.Contains(combined, "\033[") {
+		t.Error("Expected ANSI sequences to be stripped")
+	}
+	if !strings.HasSuffix(files[1], "-echo-streamed.log") {
+		t.Errorf("Expected the file name to include the command, got %s", files[1])
+	}
+}
+
+func TestCommandProgram(t *testing.T) {
+	tests := map[string]string{
+		"ls -la":                            "ls",
+		"sudo LANG=C rsync -a src dst":      "rsync",
+		"sudo -u admin systemctl restart x": "systemctl",
+		"env -i FOO=bar make test":          "make",
+		"":                                  "",
+	}
+	for command, expected := range tests {
+		if program := CommandProgram(command); program != expected {
+			t.Errorf("CommandProgram(%q) = %q, expected %q", command, program, expected)
+		}
+	}
+}
+
+func TestMissingProgram(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "build.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	executor := New().WithWorkDir(dir)
+
+	tests := map[string]string{
+		"ls -la":                          "",
+		"sudo clia-no-such-program --top": "clia-no-such-program",
+		"clia-no-such-program | grep x":   "clia-no-such-program",
+		"cd /tmp && ls":                   "",
+		"export FOO=bar":                  "",
+		"source ~/.bashrc":                "",
+		"./build.sh --release":            "",
+		"./missing.sh":                    "./missing.sh",
+		"$EDITOR notes.txt":               "",
+		"":                                "",
+	}
+	for command, expected := range tests {
+		if program := executor.MissingProgram(command); program != expected {
+			t.Errorf("MissingProgram(%q) = %q, expected %q", command, program, expected)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	dir := t.TempDir()
+	tools := filepath.Join(dir, "tools")
+	if err := os.Mkdir(tools, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tools, "clia-session-tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	executor := New().WithWorkDir(dir)
+	for _, command := range []string{
+		"alias cleanup='rm -rf /'",
+		"alias build=clia-session-tool",
+		"alias broken=clia-no-such-program",
+		"export CLIA_BUILD_DIR=build PATH=" + tools + ":/usr/bin:/bin",
+	} {
+		if err := executor.ApplyStateChange(executor.DetectStateChange(command)); err != nil {
+			t.Fatalf("ApplyStateChange(%q): %v", command, err)
+		}
+	}
+
+	resolved := executor.Resolve("cleanup --no-preserve-root")
+	if resolved != "rm -rf / --no-preserve-root" {
+		t.Errorf("Resolve expanded the alias to %q", resolved)
+	}
+	if level := executor.ExplainDanger(resolved).Level; level != utils.DangerCritical {
+		t.Errorf("Expected the expanded alias to be critical, got %v", level)
+	}
+	if level := utils.ExplainCommandDangerIn("rm -rf $CLIA_BUILD_DIR/", dir).Level; level != utils.DangerCritical {
+		t.Errorf("Expected the unset variable to be critical, got %v", level)
+	}
+	if level := executor.ExplainDanger("rm -rf $CLIA_BUILD_DIR/").Level; level != utils.DangerNone {
+		t.Errorf("Expected the variable exported in the session to be set, got %v", level)
+	}
+
+	tests := map[string]string{
+		"build --release": "",
+		"broken":          "clia-no-such-program",
+		"ls":              "",
+	}
+	for command, expected := range tests {
+		if program := executor.MissingProgram(executor.Resolve(command)); program != expected {
+			t.Errorf("MissingProgram(Resolve(%q)) = %q, expected %q", command, program, expected)
+		}
+	}
+}
+
+func TestPlanUndo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	executor := New().WithWorkDir(dir)
+
+	tests := map[string]string{
+		"mv a.txt c.txt":       "mv c.txt a.txt",
+		"mv a.txt docs":        "mv docs/a.txt a.txt",
+		"mv a.txt b.txt":       "", // Overwrites b.txt
+		"mv missing.txt c.txt": "",
+		"mv -f a.txt c.txt":    "",
+		"cp a.txt c.txt":       "rm c.txt",
+		"cp a.txt docs":        "rm docs/a.txt",
+		"cp a.txt b.txt":       "",
+		"cp -r docs backup":    "",
+		"mkdir build out":      "rmdir build out",
+		"mkdir docs":           "",
+		"mkdir -p build/x":     "",
+		"touch notes.txt":      "rm notes.txt",
+		"touch a.txt":          "",
+		"ln -s a.txt link":     "rm link",
+		"ln a.txt link":        "",
+		"git add a.txt b.txt":  "git restore --staged a.txt b.txt",
+		"git add -p":           "",
+		"git commit -m x":      "",
+		"mv a.txt c.txt && ls": "",
+		"mv \"a b.txt\" c.txt": "",
+		"mv *.txt docs":        "",
+		"rm a.txt":             "",
+		"mkdir":                "",
+	}
+	for command, expected := range tests {
+		if inverse := executor.PlanUndo(command); inverse != expected {
+			t.Errorf("PlanUndo(%q) = %q, expected %q", command, inverse, expected)
+		}
+	}
+}
+
+func TestShellStateChanges(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	executor := New().WithWorkDir(dir).WithEnv([]string{"HOME=" + dir, "PATH=" + os.Getenv("PATH"), "BASE=/opt"})
+
+	kinds := map[string]ShellState{
+		"cd src":                     ShellStateDir,
+		"cd":                         ShellStateDir,
+		"export FOO=bar BAZ":         ShellStateEnv,
+		"FOO=bar":                    ShellStateEnv,
+		"unset FOO":                  ShellStateEnv,
+		"alias ll='ls -la'":          ShellStateAlias,
+		"unalias ll":                 ShellStateAlias,
+		"source venv/bin/activate":   ShellStateTransient,
+		"export NOW=$(date)":         ShellStateTransient,
+		"cd $(git rev-parse --show)": ShellStateTransient,
+		"ulimit -n 4096":             ShellStateTransient,
+		"cd src && make":             "",
+		"FOO=bar make":               "",
+		"alias":                      "",
+		"ls -la":                     "",
+	}
+	for command, expected := range kinds {
+		var kind ShellState
+		if change := executor.DetectStateChange(command); change != nil {
+			kind = change.Kind
+		}
+		if kind != expected {
+			t.Errorf("DetectStateChange(%q) = %q, expected %q", command, kind, expected)
+		}
+	}
+
+	apply := func(command string) {
+		t.Helper()
+		if err := executor.ApplyStateChange(executor.DetectStateChange(command)); err != nil {
+			t.Fatalf("ApplyStateChange(%q): %v", command, err)
+		}
+	}
+
+	apply("cd src")
+	if executor.WorkDir() != filepath.Join(dir, "src") {
+		t.Errorf("Expected cd to change the working directory, got %s", executor.WorkDir())
+	}
+	apply("cd -")
+	if executor.WorkDir() != dir {
+		t.Errorf("Expected cd - to go back, got %s", executor.WorkDir())
+	}
+	if err := executor.ApplyStateChange(executor.DetectStateChange("cd missing")); err == nil {
+		t.Error("Expected cd to a missing directory to fail")
+	}
+
+	apply(`export GREETING="hello $USER_NAME" TOOLS=${BASE}/bin`)
+	apply("alias greet='echo $GREETING from'")
+	apply("alias where=pwd")
+	result, err := executor.Execute(context.Background(), "greet $TOOLS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := strings.TrimSpace(result.Stdout); output != "hello from /opt/bin" {
+		t.Errorf("Expected the variables and alias to apply to later commands, got %q", output)
+	}
+
+	apply("unset GREETING")
+	apply("unalias greet")
+	result, err = executor.Execute(context.Background(), "where; echo \"[$GREETING]\"; type greet")
+	if err == nil {
+		t.Error("Expected the removed alias to be unknown")
+	}
+	if output := strings.TrimSpace(result.Stdout); output != dir+"\n[]" {
+		t.Errorf("Expected unset to remove the variable, got %q", output)
+	}
+}
+
+func TestManSynopsis(t *testing.T) {
+	page := "LS(1)                User Commands               LS(1)\n\nNAME\n       ls - list directory contents\n\nSYNOPSIS\n       ls [OPTION]... [FILE]...\n\nDESCRIPTION\n       List information about the FILEs.\n"
+
+	synopsis := manSynopsis(page)
+	if synopsis != "  ls [OPTION]... [FILE]..." {
+		t.Errorf("Unexpected synopsis %q", synopsis)
+	}
+	if manSynopsis("no sections here") != "" {
+		t.Error("Expected no synopsis for a page without one")
+	}
+}
+
+func TestLookupHelp(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	executor := New()
+	if _, err := executor.LookupHelp(context.Background(), "clia-no-such-program --flag"); err == nil {
+		t.Error("Expected an error for a program that does not exist")
+	}
+
+	// Scripts and programs that misread --help are never run
+	dir := t.TempDir()
+	script := filepath.Join(dir, "build.sh")
+	marker := filepath.Join(dir, "ran")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.LookupHelp(context.Background(), script+" --release"); err == nil {
+		t.Error("Expected an error for a script given by path")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected the script not to run")
+	}
+
+	// Help is found either from the man page or from --help
+	help, err := executor.LookupHelp(context.Background(), "sudo ls -la")
+	if err != nil {
+		t.Skipf("No help available for ls: %v", err)
+	}
+	if strings.TrimSpace(help) == "" {
+		t.Error("Expected help text for ls")
+	}
+}
+
+func TestLookupManHelpNeverRuns(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	// A program on PATH without a man page is not run with --help
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	program := filepath.Join(dir, "clia-test-no-man")
+	if err := os.WriteFile(program, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if _, err := New().LookupManHelp(context.Background(), "clia-test-no-man --all"); err == nil {
+		t.Error("Expected an error for a program without a man page")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected the program not to run")
+	}
+}
+
+func TestRunAttached(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	dir := t.TempDir()
+	historyPath, logDir := filepath.Join(dir, "history.log"), filepath.Join(dir, "runs")
+	executor := New().WithHistory(historyPath, HistoryFormatText).WithRunLog(logDir, true)
+
+	var stdout strings.Builder
+	result, err := executor.RunAttached(context.Background(), "echo hi; exit 4", nil, &stdout, io.Discard)
+	if err != nil || result.ExitCode != 4 || stdout.String() != "hi\n" {
+		t.Fatalf("RunAttached = %+v, %v, output %q; expected exit code 4 and hi", result, err, stdout.String())
+	}
+
+	history, err := os.ReadFile(historyPath)
+	if err != nil || !strings.Contains(string(history), "exit 4") || !strings.Contains(string(history), "echo hi; exit 4") {
+		t.Errorf("Expected the run in the history, got %q (%v)", history, err)
+	}
+	logs, err := os.ReadDir(logDir)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("Expected one run log, got %v (%v)", logs, err)
+	}
+	runLog, _ := os.ReadFile(filepath.Join(logDir, logs[0].Name()))
+	if !strings.Contains(string(runLog), "# Exit code: 4") {
+		t.Errorf("Expected the run log header, got %q", runLog)
+	}
+}
+
+func TestReadsStdin(t *testing.T) {
+	tests := map[string]bool{
+		"sort":                      true,
+		"grep error":                true,
+		"head -n 5":                 true,
+		"jq .":                      true,
+		"tr a-z A-Z":                true,
+		"cat -":                     true,
+		"sudo sort -k 2":            true,
+		"cat file.txt":              false,
+		"grep error app.log":        false,
+		"head -n 5 notes.txt":       false,
+		"ls -la":                    false,
+		"cat <<EOF\nhello\nEOF":     false,
+		"sort < names.txt":          false,
+		"ls | sort":                 false,
+		"sort | uniq -c":            true,
+		"echo hi && wc -l":          false,
+		"awk -F , '{print $1}'":     true,
+		"awk '{print $1}' data.csv": false,
+		"sort > sorted.txt":         true,
+		"grep -c error 2>&1":        true,
+		"grep 'a|b' notes.txt":      false,
+	}
+	for command, expected := range tests {
+		if got := ReadsStdin(command); got != expected {
+			t.Errorf("ReadsStdin(%q) = %v, expected %v", command, got, expected)
+		}
+	}
+}
+
+func TestExecuteWithInput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	executor := New()
+	result, err := executor.ExecuteWithInput(context.Background(), "sort", strings.NewReader("b\na\n"))
+	if err != nil {
+		t.Fatalf("ExecuteWithInput failed: %v", err)
+	}
+	if result.Stdout != "a\nb\n" {
+		t.Errorf("Expected sorted input, got %q", result.Stdout)
+	}
+
+	outputChan, err := executor.StreamWithInput(context.Background(), "wc -l", strings.NewReader("1\n2\n3\n"))
+	if err != nil {
+		t.Fatalf("StreamWithInput failed: %v", err)
+	}
+	var lines []string
+	for line := range outputChan {
+		if line.Result == nil {
+			lines = append(lines, strings.TrimSpace(line.Content))
+		}
+	}
+	if len(lines) != 1 || lines[0] != "3" {
+		t.Errorf("Expected the line count of the input, got %v", lines)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.jsonl")
+	executor := New().WithHistory(path, HistoryFormatJSONL)
+
+	executor.Execute(context.Background(), "exit 3")
+	outputChan, err := executor.Stream(context.Background(), "echo streamed")
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	for range outputChan {
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected a history file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a record per command, got %q", lines)
+	}
+	var entry HistoryEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Expected JSON records: %v", err)
+	}
+	if entry.Command != "exit 3" || entry.ExitCode != 3 || entry.Dir != executor.WorkDir() {
+		t.Errorf("Unexpected record %+v", entry)
+	}
+
+	// Text history, rolling over after every record
+	textPath := filepath.Join(dir, "history.log")
+	executor.WithHistory(textPath, HistoryFormatText).
+		WithLogRotation(utils.RotationPolicy{MaxSize: 1, MaxFiles: 1})
+	executor.Execute(context.Background(), "true")
+	executor.Execute(context.Background(), "echo second")
+	current, _ := os.ReadFile(textPath)
+	previous, _ := os.ReadFile(textPath + ".1")
+	if !strings.HasSuffix(string(current), "\techo second\n") || !strings.Contains(string(current), "\texit 0\t") {
+		t.Errorf("Expected the latest record as a text line, got %q", current)
+	}
+	if !strings.HasSuffix(string(previous), "\ttrue\n") {
+		t.Errorf("Expected the previous record in the rolled-over file, got %q", previous)
+	}
+}
+
+func TestRunLogRetention(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "20200102-150405.000-ls.log")
+	recent := filepath.Join(dir, "20990102-150405.000-ls.log")
+	other := filepath.Join(dir, "notes.txt")
+	for _, file := range []string{old, old + ".1", recent, other} {
+		os.WriteFile(file, []byte("output\n"), 0600)
+	}
+	lastMonth := time.Now().Add(-30 * 24 * time.Hour)
+	for _, file := range []string{old, old + ".1", other} {
+		os.Chtimes(file, lastMonth, lastMonth)
+	}
+
+	pruneRunLogs(dir, 7*24*time.Hour)
+
+	for file, kept := range map[string]bool{old: false, old + ".1": false, recent: true, other: true} {
+		if _, err := os.Stat(file); (err == nil) != kept {
+			t.Errorf("Expected %s kept=%v", filepath.Base(file), kept)
+		}
+	}
+}
+
+func TestPreviewDeletion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	dir := t.TempDir()
+	for i := 0; i < 12; i++ {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.o", i)), nil, 0644)
+	}
+	os.WriteFile(filepath.Join(dir, "main.c"), nil, 0644)
+
+	executor := New().WithWorkDir(dir)
+	impact, err := executor.PreviewDeletion(context.Background(), "find . -name '*.o' -delete")
+	if err != nil {
+		t.Fatalf("PreviewDeletion failed: %v", err)
+	}
+	if impact.Total != 12 || len(impact.Paths) != 10 || impact.Preview != "find . -name '*.o' -print" {
+		t.Errorf("Expected 12 paths with 10 listed, got %+v", impact)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00.o")); err != nil {
+		t.Error("Expected the preview not to delete anything")
+	}
+
+	formatted := FormatDeletionImpact(impact)
+	if !strings.Contains(formatted, "Would delete 12 paths") || !strings.Contains(formatted, "... and 2 more") {
+		t.Errorf("Unexpected impact description:\n%s", formatted)
+	}
+
+	impact, err = executor.PreviewDeletion(context.Background(), "find . -name '*.c' | xargs rm")
+	if err != nil || impact.Total != 1 || impact.Paths[0] != "./main.c" {
+		t.Errorf("Expected xargs preview to list main.c, got %+v, %v", impact, err)
+	}
+
+	if _, err := executor.PreviewDeletion(context.Background(), "rm -rf build"); err == nil {
+		t.Error("Expected no preview for a plain rm")
+	}
+}
+
+func TestScreen(t *testing.T) {
+	screen := NewScreen(20, 5)
+	write := func(s string) {
+		// Byte by byte, so sequences and characters are split across writes
+		for i := 0; i < len(s); i++ {
+			screen.Write([]byte{s[i]})
+		}
+	}
+
+	// Colored text, cursor addressing and erasing on the main screen
+	write("hello \x1b[1;31mworld\x1b[0m\r\nsecond line\x1b[1;8H!\x1b[3;1Hgone\x1b[2K→ ok")
+	expected := "hello \x1b[0;1;31mw\x1b[0m!\x1b[0;1;31mrld\x1b[0m\nsecond line\n    → ok"
+	if frame := screen.Frame(); frame != expected {
+		t.Errorf("Frame() = %q, expected %q", frame, expected)
+	}
+
+	// Long lines wrap and the bottom line scrolls
+	write("\x1b[5;1H" + strings.Repeat("x", 25))
+	lines := strings.Split(screen.Frame(), "\n")
+	if len(lines) != 5 || lines[3] != strings.Repeat("x", 20) || lines[4] != "xxxxx" || lines[0] != "second line" {
+		t.Errorf("Expected wrapping and scrolling, got %q", lines)
+	}
+
+	// The last alternate screen is the frame once the program left it
+	write("\x1b[?1049h\x1b[H\x1b[2J\x1b[38;5;208mtop\x1b[0m - 10:00\x1b[5;1H\x1b[7mq\x1b[0m")
+	write("\x1b[?1049l$ ")
+	expected = "\x1b[0;38;5;208mtop\x1b[0m - 10:00\n\n\n\n\x1b[0;7mq\x1b[0m"
+	if frame := screen.Frame(); frame != expected {
+		t.Errorf("Frame() after the alternate screen = %q, expected %q", frame, expected)
+	}
+
+	if frame := NewScreen(0, 0).Frame(); frame != "" {
+		t.Errorf("Expected an empty frame for a blank screen, got %q", frame)
+	}
+
+	// Output the screen fails to interpret is skipped instead of panicking
+	broken := NewScreen(10, 2)
+	broken.y = 5 // Drawing off the screen panics
+	broken.Write([]byte("ab"))
+	if frame := broken.Frame(); frame != "\nb" {
+		t.Errorf("Expected the failing character to be skipped, got %q", frame)
+	}
+}
+
+func TestTerminalGuard(t *testing.T) {
+	restores := 0
+	var output strings.Builder
+	guard := newTerminalGuard(func() error { restores++; return nil }, &output)
+
+	guard.Restore()
+	guard.Restore()
+	if restores != 1 || output.Len() != 0 {
+		t.Errorf("Expected one restore and the screen left alone, got %d restores and %q", restores, output.String())
+	}
+	if RestoreTerminal() {
+		t.Error("Expected no terminal to restore once the command restored it")
+	}
+
+	restores = 0
+	guard = newTerminalGuard(func() error { restores++; return nil }, &output)
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("Expected the panic to be passed on, got %v", r)
+			}
+		}()
+		defer guard.release()
+		panic("boom")
+	}()
+	if restores != 1 || output.String() != leaveAltScreen {
+		t.Errorf("Expected a panic to restore the terminal and leave the alternate screen, got %d restores and %q", restores, output.String())
+	}
+
+	restores = 0
+	newTerminalGuard(func() error { restores++; return nil }, io.Discard)
+	if !RestoreTerminal() || restores != 1 || RestoreTerminal() {
+		t.Errorf("Expected RestoreTerminal to restore a running command's terminal once, got %d restores", restores)
+	}
+}
+
+func FuzzScreen(f *testing.F) {
+	for _, seed := range []string{
+		"plain text\r\n",
+		"\x1b[1;31mred\x1b[0m",
+		"\x1b[999999999999999999999;-5H",
+		"\x1b[38;5;999;48;2;1;2mx",
+		"\x1b[0;0r\x1b[5;2r\x1b[99M\x1b[99L",
+		"\x1b[?1049h\x1b[?1049h\x1b[?1049l\x1b[?1049l",
+		"\x1b]0;title\x07\x1bP\x1b\\\x1b(B\x1b",
+		"\x1b[\x1b[\x1b[;;;;m\x1b[1000@\x1b[1000P\x1b[1000X",
+		"\xff\xfe\xe2\x82\x1b[2J\x1b8\x1b7\x1bM\x1bD\x1bE\x1bc",
+	} {
+		f.Add([]byte(seed), uint8(10), uint8(4))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, width, height uint8) {
+		// Written at once, as a headless capture reads the PTY
+		screen := NewScreen(int(width), int(height))
+		screen.Write(data)
+		frame := screen.Frame()
+
+		// Split across writes, as the output of an attached command arrives
+		split := NewScreen(int(width), int(height))
+		for i := 0; i < len(data); i += 3 {
+			split.Write(data[i:min(i+3, len(data))])
+		}
+		split.Frame()
+
+		// Compared with the frame, as the frames of a capture are
+		DiffFrames(frame, string(data))
+	})
+}
@@ -0,0 +1,164 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	helpTimeout  = 3 * time.Second // Help lookups must never hold up the confirmation
+	helpMaxLines = 12
+)
+
+// overstrikePattern matches the backspace sequences man uses for bold and underline
+var overstrikePattern = regexp.MustCompile(".\x08")
+
+// envAssignmentPattern matches a leading variable assignment like FOO=bar
+var envAssignmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// wrapperArgOptions are options of sudo and env that take a separate value
+var wrapperArgOptions = map[string]bool{"-u": true, "-g": true, "-C": true, "-D": true, "-p": true, "-U": true, "-S": true}
+
+// unsafeHelpPrograms ignore or misread --help and act on it instead: they
+// power off the machine, write to disks, signal processes, print forever or
+// run "--help" as a command (BSD env, nohup and xargs)
+var unsafeHelpPrograms = map[string]bool{
+	"shutdown": true, "reboot": true, "halt": true, "poweroff": true, "init": true, "telinit": true,
+	"dd": true, "mkfs": true, "fdisk": true, "wipefs": true, "shred": true,
+	"kill": true, "killall": true, "pkill": true,
+	"yes": true, "env": true, "nohup": true, "xargs": true, "time": true, "watch": true,
+}
+
+// CommandProgram returns the program a shell command runs, skipping sudo,
+// env and variable assignments, e.g. "rsync" for "sudo LANG=C rsync -a src dst"
+func CommandProgram(command string) string {
+	skipValue := false
+	for _, field := range strings.Fields(command) {
+		if skipValue {
+			skipValue = false
+			continue
+		}
+		if field == "sudo" || field == "env" || envAssignmentPattern.MatchString(field) {
+			continue
+		}
+		if strings.HasPrefix(field, "-") {
+			skipValue = wrapperArgOptions[field] // Options of sudo or env
+			continue
+		}
+		return strings.Trim(field, `"'(`)
+	}
+	return ""
+}
+
+// LookupHelp describes the program command runs from the system: the whatis
+// summary and man page synopsis or, when there is no man page, the first lines
+// of `<program> --help`. That last resort runs the program, so it is skipped
+// for scripts given by path and for the programs in unsafeHelpPrograms; the
+// command's own arguments are never passed.
+func (e *Executor) LookupHelp(ctx context.Context, command string) (string, error) {
+	program := CommandProgram(command)
+	if program == "" {
+		return "", fmt.Errorf("no program found in %q", command)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, helpTimeout)
+	defer cancel()
+
+	sections := e.manSections(ctx, program)
+	if len(sections) == 0 {
+		if strings.Contains(program, "/") || unsafeHelpPrograms[strings.SplitN(program, ".", 2)[0]] {
+			return "", fmt.Errorf("no man page for %s, and running %s --help is not safe", program, program)
+		}
+		if _, err := exec.LookPath(program); err != nil {
+			return "", fmt.Errorf("%s is not a program on PATH (it may be a shell builtin or alias)", program)
+		}
+		// Many programs print usage on stderr or exit non-zero after --help
+		output, _ := e.runHelpCommand(ctx, program, "--help")
+		if strings.TrimSpace(output) == "" {
+			return "", fmt.Errorf("no help found for %s", program)
+		}
+		sections = append(sections, firstLines(output, helpMaxLines))
+	}
+
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// LookupManHelp is LookupHelp without the `<program> --help` fallback: it
+// only reads the whatis summary and man page, so it never runs the program
+// and is safe for commands from untrusted callers.
+func (e *Executor) LookupManHelp(ctx context.Context, command string) (string, error) {
+	program := CommandProgram(command)
+	if program == "" {
+		return "", fmt.Errorf("no program found in %q", command)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, helpTimeout)
+	defer cancel()
+
+	sections := e.manSections(ctx, program)
+	if len(sections) == 0 {
+		return "", fmt.Errorf("no man page for %s", program)
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// manSections returns the whatis summary and man page synopsis of program,
+// whichever the system has
+func (e *Executor) manSections(ctx context.Context, program string) []string {
+	var sections []string
+	if summary, err := e.runHelpCommand(ctx, "whatis", program); err == nil {
+		sections = append(sections, firstLines(summary, 3))
+	}
+	if page, err := e.runHelpCommand(ctx, "man", program); err == nil {
+		if synopsis := manSynopsis(page); synopsis != "" {
+			sections = append(sections, "SYNOPSIS\n"+synopsis)
+		}
+	}
+	return sections
+}
+
+// runHelpCommand runs a help command without a shell and returns its combined output
+func (e *Executor) runHelpCommand(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = e.workDir
+	cmd.Env = append(append([]string{}, e.env...), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=80")
+
+	output, err := cmd.CombinedOutput()
+	return overstrikePattern.ReplaceAllString(string(output), ""), err
+}
+
+// manSynopsis extracts the SYNOPSIS section of a formatted man page
+func manSynopsis(page string) string {
+	var lines []string
+	inSynopsis := false
+	for _, line := range strings.Split(page, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !inSynopsis {
+			inSynopsis = trimmed == "SYNOPSIS"
+			continue
+		}
+		// The next unindented line is the following section heading
+		if trimmed != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			break
+		}
+		if trimmed == "" {
+			lines = append(lines, "")
+		} else {
+			lines = append(lines, "  "+trimmed)
+		}
+	}
+	return firstLines(strings.Join(lines, "\n"), helpMaxLines)
+}
+
+// firstLines returns the first n lines of text, marking any cut
+func firstLines(text string, n int) string {
+	lines := strings.Split(strings.Trim(text, "\n"), "\n")
+	if len(lines) > n {
+		lines = append(lines[:n], "...")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), " \n")
+}
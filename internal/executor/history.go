@@ -0,0 +1,96 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// History file formats
+const (
+	HistoryFormatJSONL = "jsonl" // One JSON object per command
+	HistoryFormatText  = "text"  // One tab-separated line per command
+)
+
+// HistoryEntry is the record of an executed command in the history file
+type HistoryEntry struct {
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`
+	Dir        string    `json:"dir"`
+	ExitCode   int       `json:"exit_code"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// WithHistory appends a record of every executed command to path in format
+// (HistoryFormatJSONL or HistoryFormatText). An empty path disables the history.
+func (e *Executor) WithHistory(path, format string) *Executor {
+	e.historyPath = path
+	e.historyFormat = format
+	return e
+}
+
+// WithLogRotation sets how the history file and run logs roll over and when
+// old ones are deleted
+func (e *Executor) WithLogRotation(policy utils.RotationPolicy) *Executor {
+	e.logRotation = policy
+	return e
+}
+
+// recordHistory appends result, started at startTime, to the history file
+func (e *Executor) recordHistory(result *ExecutionResult, startTime time.Time) {
+	if e.historyPath == "" {
+		return
+	}
+
+	entry := HistoryEntry{
+		Time:       startTime,
+		Command:    result.Command,
+		Dir:        e.workDir,
+		ExitCode:   result.ExitCode,
+		DurationMS: result.Duration.Milliseconds(),
+	}
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+
+	line, err := formatHistoryEntry(entry, e.historyFormat)
+	if err != nil {
+		log.Printf("Failed to record history: %v", err)
+		return
+	}
+
+	e.historyMu.Lock()
+	defer e.historyMu.Unlock()
+
+	writer := utils.NewRotatingWriter(e.historyPath, e.logRotation)
+	defer writer.Close()
+	if _, err := writer.Write(line); err != nil {
+		log.Printf("Failed to record history: %v", err)
+	}
+}
+
+// formatHistoryEntry returns the line of entry in the history file
+func formatHistoryEntry(entry HistoryEntry, format string) ([]byte, error) {
+	switch format {
+	case HistoryFormatText:
+		line := fmt.Sprintf("%s\texit %d\t%v\t%s\t%s",
+			entry.Time.Format(time.RFC3339), entry.ExitCode,
+			time.Duration(entry.DurationMS)*time.Millisecond, entry.Dir, entry.Command)
+		if entry.Error != "" {
+			line += "\t# " + entry.Error
+		}
+		return []byte(line + "\n"), nil
+	case HistoryFormatJSONL, "":
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		return append(line, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unknown history format %q", format)
+	}
+}
@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// shellBuiltins are the builtins and keywords of POSIX shells, bash and zsh,
+// which run without a program on PATH
+var shellBuiltins = map[string]bool{
+	".": true, ":": true, "[": true, "[[": true, "{": true, "!": true, "((": true,
+	"alias": true, "bg": true, "bind": true, "break": true, "builtin": true, "case": true,
+	"cd": true, "command": true, "continue": true, "declare": true, "dirs": true, "disown": true,
+	"echo": true, "eval": true, "exec": true, "exit": true, "export": true, "false": true,
+	"fc": true, "fg": true, "for": true, "function": true, "getopts": true, "hash": true,
+	"history": true, "if": true, "jobs": true, "kill": true, "let": true, "local": true,
+	"popd": true, "printf": true, "pushd": true, "pwd": true, "read": true, "readonly": true,
+	"return": true, "select": true, "set": true, "setopt": true, "shift": true, "shopt": true,
+	"source": true, "test": true, "time": true, "times": true, "trap": true, "true": true,
+	"type": true, "typeset": true, "ulimit": true, "umask": true, "unalias": true, "unset": true,
+	"unsetopt": true, "until": true, "wait": true, "whence": true, "while": true,
+}
+
+// MissingProgram returns the program command runs if it is not installed:
+// neither a shell builtin nor an executable on PATH or at the path given. It
+// returns "" when the program is found, and when it cannot tell, such as for
+// programs named by variables. Pass the command as Resolve returns it, so
+// session aliases are expanded; PATH is the one of the session. Only the
+// first program of a pipeline is checked, and aliases and functions of the
+// user's shell are not known. On Windows, where cmd and PowerShell have
+// builtins of their own, it always returns "".
+func (e *Executor) MissingProgram(command string) string {
+	if runtime.GOOS == "windows" {
+		return ""
+	}
+
+	program := CommandProgram(command)
+	if program == "" || shellBuiltins[program] || strings.ContainsAny(program, "$`*?=") {
+		return ""
+	}
+
+	if strings.Contains(program, "/") {
+		path := program
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		} else if !filepath.IsAbs(path) {
+			path = filepath.Join(e.workDir, path)
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return ""
+		}
+		return program
+	}
+
+	if e.onPath(program) {
+		return ""
+	}
+	return program
+}
+
+// onPath reports whether program is an executable in a directory of the
+// PATH commands run with
+func (e *Executor) onPath(program string) bool {
+	path, ok := e.LookupEnv("PATH")
+	if !ok {
+		_, err := exec.LookPath(program)
+		return err == nil
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(e.workDir, dir)
+		}
+		if info, err := os.Stat(filepath.Join(dir, program)); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// reorderWindow is how long mergeLines holds a line back for lines read
+// earlier from another pipe that are still on their way. Lines are stamped
+// when they are read, but the readers of stdout, stderr and the terminal race
+// to deliver them.
+const reorderWindow = 15 * time.Millisecond
+
+// mergeLines forwards the lines the readers send to in to out in the order of
+// their timestamps, numbering them with Seq, and closes out once in is
+// closed. Lines with the same timestamp keep the order they arrived in, so the
+// final Result, sent after all output, is always last. A line arriving too
+// late to be put back in order is sent with the timestamp of the line before
+// it, so the timestamps of the lines sent never decrease. When ctx is done the
+// remaining lines are dropped, but in is still drained so no reader blocks.
+func mergeLines(ctx context.Context, in <-chan OutputLine, out chan<- OutputLine) {
+	defer close(out)
+
+	var pending []OutputLine
+	var seq uint64
+	var last time.Time
+	timer := time.NewTimer(reorderWindow)
+	defer timer.Stop()
+
+	// flush sends the pending lines read before cutoff, all of them for a
+	// zero cutoff, and drops them all if the consumer gave up on the stream
+	flush := func(cutoff time.Time) {
+		sort.SliceStable(pending, func(i, j int) bool {
+			return pending[i].Timestamp.Before(pending[j].Timestamp)
+		})
+		sent := 0
+		for _, line := range pending {
+			if !cutoff.IsZero() && line.Timestamp.After(cutoff) {
+				break
+			}
+			if line.Timestamp.Before(last) {
+				line.Timestamp = last
+			}
+			last = line.Timestamp
+			seq++
+			line.Seq = seq
+			if !sendLine(ctx, out, line) {
+				pending = nil
+				return
+			}
+			sent++
+		}
+		pending = append(pending[:0], pending[sent:]...)
+	}
+
+	for {
+		select {
+		case line, ok := <-in:
+			if !ok {
+				flush(time.Time{})
+				return
+			}
+			if ctx.Err() != nil {
+				continue
+			}
+			if line.Timestamp.IsZero() {
+				line.Timestamp = time.Now()
+			}
+			pending = append(pending, line)
+		case <-timer.C:
+			timer.Reset(reorderWindow)
+			if len(pending) > 0 && ctx.Err() == nil {
+				flush(time.Now().Add(-reorderWindow))
+			}
+		}
+	}
+}
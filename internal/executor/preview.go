@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+const (
+	previewTimeout  = 5 * time.Second // Previews must never hold up the confirmation for long
+	previewMaxPaths = 10
+)
+
+// DeletionImpact is what a deleting command would remove, found by running
+// its read-only variant
+type DeletionImpact struct {
+	Preview string   // The read-only command that listed the paths
+	Paths   []string // The first paths it listed
+	Total   int      // The number of paths it listed
+}
+
+// PreviewDeletion runs the read-only variant of a command deleting files
+// through find -delete, find -exec rm or xargs rm, e.g. `find . -name '*.o'
+// -print` for `find . -name '*.o' -delete`, and reports what it would
+// remove. It never runs the command itself and fails for commands without
+// a safe preview. A session alias in command is expanded first.
+func (e *Executor) PreviewDeletion(ctx context.Context, command string) (*DeletionImpact, error) {
+	preview, ok := utils.DeletionPreview(e.Resolve(command))
+	if !ok {
+		return nil, fmt.Errorf("no read-only preview for %q", command)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+
+	cmd, err := e.prepareResolved(ctx, preview)
+	if err != nil {
+		return nil, err
+	}
+	output, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("preview timed out after %s", previewTimeout)
+	}
+	// find exits non-zero for unreadable directories but still lists the rest
+	if err != nil && len(output) == 0 {
+		return nil, fmt.Errorf("preview failed: %w", err)
+	}
+
+	impact := &DeletionImpact{Preview: preview}
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		impact.Total++
+		if len(impact.Paths) < previewMaxPaths {
+			impact.Paths = append(impact.Paths, line)
+		}
+	}
+	return impact, nil
+}
+
+// FormatDeletionImpact describes a deletion preview for confirmation dialogs
+func FormatDeletionImpact(impact *DeletionImpact) string {
+	if impact.Total == 0 {
+		return fmt.Sprintf("🔍 Would delete nothing (checked with `%s`)", impact.Preview)
+	}
+
+	noun := "paths"
+	if impact.Total == 1 {
+		noun = "path"
+	}
+	lines := []string{fmt.Sprintf("🔍 Would delete %d %s (checked with `%s`):", impact.Total, noun, impact.Preview)}
+	for _, path := range impact.Paths {
+		lines = append(lines, "  "+path)
+	}
+	if more := impact.Total - len(impact.Paths); more > 0 {
+		lines = append(lines, fmt.Sprintf("  ... and %d more", more))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,22 @@
+package executor
+
+import "strings"
+
+// overwriteLine returns what a terminal shows for line: text after a carriage
+// return overwrites the line from its start, as progress bars redraw
+// themselves. The trailing carriage return of a CRLF line ending is dropped.
+func overwriteLine(line string) string {
+	if !strings.Contains(line, "\r") {
+		return line
+	}
+
+	var shown []rune
+	for _, part := range strings.Split(line, "\r") {
+		runes := []rune(part)
+		if len(runes) < len(shown) {
+			runes = append(runes, shown[len(runes):]...)
+		}
+		shown = runes
+	}
+	return string(shown)
+}
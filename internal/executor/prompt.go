@@ -0,0 +1,70 @@
+package executor
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Prompt is a question a running command waits to have answered
+type Prompt struct {
+	Text   string // The prompt as printed, e.g. "Do you want to continue? [Y/n]"
+	Secret bool   // The answer is a password or passphrase and must not be shown
+}
+
+// secretPromptPattern matches prompts for passwords and passphrases, e.g.
+// "[sudo] password for bob:" or "Enter passphrase for key '~/.ssh/id_rsa':"
+var secretPromptPattern = regexp.MustCompile(`(?i)(password|passphrase|passcode)\b.*:$`)
+
+// promptPatterns match prompts waiting for a visible answer
+var promptPatterns = []*regexp.Regexp{
+	// Confirmations like [Y/n], (y/N) or (yes/no/[fingerprint])?
+	regexp.MustCompile(`(?i)[\[(]\s*y(es)?\s*/\s*no?\b[^\])]*[\])]\s*[?:]?$`),
+	// Credentials, e.g. "Username for 'https://github.com':"
+	regexp.MustCompile(`(?i)(username|user name|login)( for .+)?:$`),
+	// Questions like "Do you want to continue?" or "rm: remove regular file 'a'?"
+	regexp.MustCompile(`(?i)\b(continue|proceed|overwrite|remove|replace|delete)\b[^?]*\?$`),
+}
+
+// DetectPrompt reports whether text, the last line a command printed, is a
+// prompt waiting for an answer, like a y/n confirmation or a password prompt
+func DetectPrompt(text string) (Prompt, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Prompt{}, false
+	}
+
+	if secretPromptPattern.MatchString(text) {
+		return Prompt{Text: text, Secret: true}, true
+	}
+	for _, pattern := range promptPatterns {
+		if pattern.MatchString(text) {
+			return Prompt{Text: text}, true
+		}
+	}
+	return Prompt{}, false
+}
+
+// promptTerminal is the standard input of a command streamed by
+// StreamInteractive, see attachPromptTerminal
+type promptTerminal struct {
+	input   io.WriteCloser // Receives the answers to prompts
+	output  io.Reader      // What the command writes to its terminal; nil without a PTY
+	release func()         // Closes the side of the command once it started
+	close   func() error   // Closes the terminal after the command finished
+}
+
+// started releases the side of the terminal the running command now holds
+func (t *promptTerminal) started() {
+	if t != nil && t.release != nil {
+		t.release()
+	}
+}
+
+// Close closes the terminal; a nil terminal has nothing to close
+func (t *promptTerminal) Close() error {
+	if t == nil || t.close == nil {
+		return nil
+	}
+	return t.close()
+}
@@ -3,16 +3,12 @@ package executor
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"os/exec"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
-	"github.com/creack/pty"
 	"golang.org/x/term"
 )
 
@@ -29,6 +25,7 @@ type PTYResult struct {
 	Duration time.Duration `json:"duration"`
 	Error    error         `json:"error,omitempty"`
 	Pid      int           `json:"pid,omitempty"`
+	Frame    string        `json:"frame,omitempty"` // Last screen the program drew, with colors; empty if not captured
 }
 
 // NewPTYExecutor creates a new PTY-enabled executor
@@ -115,16 +112,98 @@ func (e *PTYExecutor) IsTUIProgram(command string) bool {
 
 	cmdName := parts[0]
 
-	// Handle command paths (e.g., /usr/bin/vim -> vim)
-	if strings.Contains(cmdName, "/") {
-		cmdParts := strings.Split(cmdName, "/")
-		cmdName = cmdParts[len(cmdParts)-1]
+	// Handle command paths (e.g., /usr/bin/vim -> vim, C:\Tools\vim.exe -> vim)
+	if idx := strings.LastIndexAny(cmdName, `/\`); idx >= 0 {
+		cmdName = cmdName[idx+1:]
 	}
+	cmdName = strings.TrimSuffix(strings.ToLower(cmdName), ".exe")
 
 	return e.tuiPrograms[cmdName]
 }
 
-// ExecuteInteractive runs a command with PTY support for full terminal interaction
+// NeedsPTY checks if a command must run attached to a terminal, either because
+// it is a TUI program or because sudo has to prompt for a password
+func (e *PTYExecutor) NeedsPTY(command string) bool {
+	return e.IsTUIProgram(command) || UsesSudo(command)
+}
+
+// commandPrefixes are wrappers that may precede the actual program in a command segment
+var commandPrefixes = map[string]bool{
+	"env":     true,
+	"time":    true,
+	"nohup":   true,
+	"nice":    true,
+	"command": true,
+	"exec":    true,
+}
+
+// sudoInvocations returns the arguments of every sudo invocation in a command
+func sudoInvocations(command string) [][]string {
+	// Split into segments on shell control operators
+	segments := strings.FieldsFunc(command, func(r rune) bool {
+		return r == ';' || r == '&' || r == '|' || r == '(' || r == ')' || r == '\n' || r == '`'
+	})
+
+	var invocations [][]string
+	for _, segment := range segments {
+		fields := strings.Fields(segment)
+		for i, field := range fields {
+			name := field
+			if idx := strings.LastIndex(name, "/"); idx >= 0 {
+				name = name[idx+1:]
+			}
+
+			if name == "sudo" {
+				invocations = append(invocations, fields[i+1:])
+				break
+			}
+
+			// Skip environment assignments and wrapper commands
+			if strings.Contains(field, "=") || commandPrefixes[name] || strings.HasPrefix(field, "$(") {
+				continue
+			}
+			break
+		}
+	}
+
+	return invocations
+}
+
+// UsesSudo checks if a command invokes sudo and may therefore prompt for a password
+func UsesSudo(command string) bool {
+	return len(sudoInvocations(command)) > 0
+}
+
+// SudoReadsPasswordFromStdin checks if a command feeds a password to sudo
+// via -S/--stdin, in which case the command text may contain the password
+func SudoReadsPasswordFromStdin(command string) bool {
+	// Options that take a separate value argument
+	valueOptions := map[string]bool{
+		"-u": true, "-g": true, "-p": true, "-C": true, "-D": true,
+		"-h": true, "-r": true, "-t": true, "-U": true, "-T": true,
+	}
+
+	for _, args := range sudoInvocations(command) {
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			if !strings.HasPrefix(arg, "-") || arg == "--" {
+				break
+			}
+			if arg == "--stdin" || (!strings.HasPrefix(arg, "--") && strings.Contains(arg, "S")) {
+				return true
+			}
+			if valueOptions[arg] {
+				i++
+			}
+		}
+	}
+	return false
+}
+
+// ExecuteInteractive runs a command with PTY support for full terminal
+// interaction. On Windows the command shares the console instead. The
+// terminal is restored however the command ends, including by a panic or
+// by SIGTERM.
 func (e *PTYExecutor) ExecuteInteractive(ctx context.Context, command string) (*PTYResult, error) {
 	startTime := time.Now()
 
@@ -161,50 +240,20 @@ func (e *PTYExecutor) ExecuteInteractive(ctx context.Context, command string) (*
 		}, nil
 	}
 
-	// Save current terminal state
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
-		return &PTYResult{
-			Command:  command,
-			ExitCode: -1,
-			Error:    fmt.Errorf("failed to make terminal raw: %w", err),
-			Duration: time.Since(startTime),
-		}, err
-	}
-
-	// Ensure terminal state is restored on exit
-	defer func() {
-		if restoreErr := term.Restore(int(os.Stdin.Fd()), oldState); restoreErr != nil {
-			log.Printf("Warning: Failed to restore terminal state: %v", restoreErr)
-		}
-	}()
-
-	// Create PTY and start command
-	ptmx, err := pty.Start(cmd)
+	// Run the command attached to the terminal, keeping the screen it draws;
+	// see pty_unix.go and pty_windows.go
+	width, height, _ := term.GetSize(int(os.Stdout.Fd()))
+	screen := NewScreen(width, height)
+	execErr, err := runAttached(cmd, screen)
 	if err != nil {
 		return &PTYResult{
 			Command:  command,
 			ExitCode: -1,
-			Error:    fmt.Errorf("failed to start command with PTY: %w", err),
+			Error:    err,
 			Duration: time.Since(startTime),
 		}, err
 	}
 
-	// Ensure PTY is closed on exit
-	defer func() {
-		if closeErr := ptmx.Close(); closeErr != nil {
-			log.Printf("Warning: Failed to close PTY: %v", closeErr)
-		}
-	}()
-
-	// Handle window size changes
-	e.handleWindowResize(ptmx)
-
-	// Handle input/output copying
-	e.handleIO(ptmx)
-
-	// Wait for command to complete
-	execErr := cmd.Wait()
 	duration := time.Since(startTime)
 
 	// Determine exit code
@@ -222,6 +271,7 @@ func (e *PTYExecutor) ExecuteInteractive(ctx context.Context, command string) (*
 		ExitCode: exitCode,
 		Duration: duration,
 		Pid:      cmd.Process.Pid,
+		Frame:    screen.Frame(),
 	}
 
 	if execErr != nil && exitCode != 0 {
@@ -232,62 +282,47 @@ func (e *PTYExecutor) ExecuteInteractive(ctx context.Context, command string) (*
 	return result, nil
 }
 
-// handleWindowResize sets up window resize signal handling
-func (e *PTYExecutor) handleWindowResize(ptmx *os.File) {
-	// Create channel for window size change signals
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGWINCH)
-
-	// Handle resize in a goroutine
-	go func() {
-		defer signal.Stop(ch)
-		defer close(ch)
-
-		for range ch {
-			if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
-				log.Printf("Warning: Failed to resize PTY: %v", err)
-			}
-		}
-	}()
-
-	// Set initial size
-	ch <- syscall.SIGWINCH
-}
-
-// handleIO manages bidirectional I/O between terminal and PTY
-func (e *PTYExecutor) handleIO(ptmx *os.File) {
-	// Copy input from stdin to PTY (user input to program)
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Warning: Input copy goroutine panic: %v", r)
-			}
-		}()
-
-		if _, err := io.Copy(ptmx, os.Stdin); err != nil {
-			log.Printf("Warning: Failed to copy stdin to PTY: %v", err)
-		}
-	}()
-
-	// Copy output from PTY to stdout (program output to user)
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("Warning: Output copy goroutine panic: %v", r)
-			}
-		}()
+// CaptureFrames runs command in a PTY of the given size without showing it
+// and returns count frames of what it draws, taken interval apart starting
+// interval after it started. The command is killed after the last frame, or
+// when ctx is done. A size of 0 uses 80x24.
+func (e *PTYExecutor) CaptureFrames(ctx context.Context, command string, width, height int, interval time.Duration, count int) ([]string, error) {
+	cmd, err := e.prepareCommand(ctx, command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare command: %w", err)
+	}
+	// Programs draw nothing on a terminal they do not know
+	if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+		cmd.Env = append(cmd.Env[:len(cmd.Env):len(cmd.Env)], "TERM=xterm-256color")
+	}
 
-		if _, err := io.Copy(os.Stdout, ptmx); err != nil {
-			log.Printf("Warning: Failed to copy PTY to stdout: %v", err)
+	screen := NewScreen(width, height)
+	stop, err := startHeadless(cmd, screen.width, screen.height, screen)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	frames := make([]string, 0, count)
+	for len(frames) < count {
+		select {
+		case <-ticker.C:
+			frames = append(frames, screen.Frame())
+		case <-ctx.Done():
+			return frames, ctx.Err()
 		}
-	}()
+	}
+	return frames, nil
 }
 
 // ExecuteWithAutoDetection automatically chooses between PTY and regular execution
 func (e *PTYExecutor) ExecuteWithAutoDetection(ctx context.Context, command string) (*ExecutionResult, error) {
 	// Check if command needs PTY
-	if e.IsTUIProgram(command) {
-		log.Printf("Detected TUI program, using PTY execution: %s", command)
+	if e.NeedsPTY(command) {
+		log.Printf("Detected interactive command, using PTY execution: %s", command)
 
 		ptyResult, err := e.ExecuteInteractive(ctx, command)
 		if err != nil {
@@ -0,0 +1,231 @@
+//go:build !windows
+
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// frameSettleTimeout bounds the wait for the last output of a finished command
+const frameSettleTimeout = 200 * time.Millisecond
+
+// runAttached runs cmd in a PTY connected to the terminal and waits for it,
+// drawing its output on screen as well. execErr is the result of the
+// command; err reports a failure to start it.
+func runAttached(cmd *exec.Cmd, screen io.Writer) (execErr, err error) {
+	// Save current terminal state
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make terminal raw: %w", err)
+	}
+
+	// Ensure terminal state is restored on exit, on a panic and on SIGTERM
+	guard := newTerminalGuard(func() error {
+		return term.Restore(int(os.Stdin.Fd()), oldState)
+	}, os.Stdout)
+	defer guard.release()
+
+	// Create PTY and start command
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start command with PTY: %w", err)
+	}
+
+	// Ensure PTY is closed on exit
+	defer func() {
+		if closeErr := ptmx.Close(); closeErr != nil {
+			log.Printf("Warning: Failed to close PTY: %v", closeErr)
+		}
+	}()
+
+	// Handle window size changes
+	handleWindowResize(ptmx)
+	defer abortOnSignal(cmd, guard)()
+
+	// Handle input/output copying
+	outputDone := handleIO(ptmx, screen)
+
+	// Wait for command to complete, and for the output it left in the PTY
+	execErr = cmd.Wait()
+	select {
+	case <-outputDone:
+	case <-time.After(frameSettleTimeout):
+	}
+	return execErr, nil
+}
+
+// startHeadless starts cmd in a PTY of the given size that is not connected
+// to the terminal, drawing its output on screen only. stop kills the command
+// and closes the PTY.
+func startHeadless(cmd *exec.Cmd, width, height int, screen io.Writer) (stop func(), err error) {
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: uint16(width), Rows: uint16(height)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start command with PTY: %w", err)
+	}
+	go io.Copy(screen, ptmx)
+
+	return func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		ptmx.Close()
+	}, nil
+}
+
+// handleWindowResize sets up window resize signal handling
+func handleWindowResize(ptmx *os.File) {
+	// Create channel for window size change signals
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+
+	// Handle resize in a goroutine
+	go func() {
+		defer signal.Stop(ch)
+		defer close(ch)
+
+		for range ch {
+			if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
+				log.Printf("Warning: Failed to resize PTY: %v", err)
+			}
+		}
+	}()
+
+	// Set initial size
+	ch <- syscall.SIGWINCH
+}
+
+// abortOnSignal restores the terminal when clia is told to terminate while cmd
+// runs, and passes the signal on to cmd, ending it. clia itself quits on the
+// signal as usual. The returned function stops watching.
+func abortOnSignal(cmd *exec.Cmd, guard *terminalGuard) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-ch:
+			guard.Abort()
+			cmd.Process.Signal(sig)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// handleIO manages bidirectional I/O between terminal and PTY. Output goes to
+// screen as well; the returned channel is closed when the output ends.
+func handleIO(ptmx *os.File, screen io.Writer) <-chan struct{} {
+	// Copy input from stdin to PTY (user input to program)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Warning: Input copy goroutine panic: %v", r)
+			}
+		}()
+
+		if _, err := io.Copy(ptmx, os.Stdin); err != nil {
+			log.Printf("Warning: Failed to copy stdin to PTY: %v", err)
+		}
+	}()
+
+	// Copy output from PTY to stdout (program output to user)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Warning: Output copy goroutine panic: %v", r)
+			}
+		}()
+
+		if _, err := io.Copy(io.MultiWriter(os.Stdout, screen), ptmx); err != nil && !errors.Is(err, syscall.EIO) {
+			log.Printf("Warning: Failed to copy PTY to stdout: %v", err)
+		}
+	}()
+	return done
+}
+
+// attachPromptTerminal makes a new PTY the standard input and controlling
+// terminal of cmd, leaving its output on the pipes. The terminal is raw so
+// answers reach the command as written and nothing is echoed back.
+func attachPromptTerminal(cmd *exec.Cmd) (*promptTerminal, error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PTY: %w", err)
+	}
+	if ptmx, err = pollable(ptmx); err != nil {
+		tty.Close()
+		return nil, fmt.Errorf("failed to open PTY: %w", err)
+	}
+	if _, err := term.MakeRaw(int(tty.Fd())); err != nil {
+		ptmx.Close()
+		tty.Close()
+		return nil, fmt.Errorf("failed to make PTY raw: %w", err)
+	}
+
+	cmd.Stdin = tty
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0 // Standard input of the command
+
+	return &promptTerminal{
+		input:   ptmx,
+		output:  terminalOutput{ptmx},
+		release: func() { tty.Close() },
+		close:   ptmx.Close,
+	}, nil
+}
+
+// terminalOutput reads a PTY, ending with io.EOF once the command closed its
+// side or the PTY was closed
+type terminalOutput struct {
+	ptmx *os.File
+}
+
+func (o terminalOutput) Read(p []byte) (int, error) {
+	n, err := o.ptmx.Read(p)
+	if err != nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// pollable reopens f in non-blocking mode, so that closing it interrupts a
+// read waiting for output, and closes f
+func pollable(f *os.File) (*os.File, error) {
+	// Commands started meanwhile must not inherit the copy, or closing it
+	// would not hang up the terminal
+	syscall.ForkLock.RLock()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err == nil {
+		syscall.CloseOnExec(fd)
+	}
+	syscall.ForkLock.RUnlock()
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
@@ -0,0 +1,45 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// runAttached runs cmd sharing the console of clia and waits for it. Windows
+// has no PTY to capture; console programs draw on the shared console directly,
+// so nothing is drawn on screen. execErr is the result of the command; err
+// reports a failure to start it.
+func runAttached(cmd *exec.Cmd, screen io.Writer) (execErr, err error) {
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+	return cmd.Wait(), nil
+}
+
+// startHeadless would start cmd in a PTY that is not shown; Windows has no
+// PTY to capture the screen of a program from
+func startHeadless(cmd *exec.Cmd, width, height int, screen io.Writer) (stop func(), err error) {
+	return nil, fmt.Errorf("capturing the screen of a program is not supported on Windows")
+}
+
+// attachPromptTerminal gives cmd a pipe as standard input for the answers to
+// its prompts; without a PTY, prompts written to the console are not seen
+func attachPromptTerminal(cmd *exec.Cmd) (*promptTerminal, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+
+	cmd.Stdin = r
+	return &promptTerminal{
+		input:   w,
+		release: func() { r.Close() },
+		close:   w.Close,
+	}, nil
+}
@@ -0,0 +1,168 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// runLogTimeFormat is the timestamp prefix of run log file names
+const runLogTimeFormat = "20060102-150405.000"
+
+// runLogNameMax limits the part of a run log file name taken from the command
+const runLogNameMax = 40
+
+// unsafeFileChars matches runs of characters not used in run log file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// runLogPattern matches the names of run logs and their rolled-over parts
+var runLogPattern = regexp.MustCompile(`^\d{8}-\d{6}\.\d{3}-.*\.log(\.\d+)?$`)
+
+// runLog writes the output of one command to a file in the run log directory.
+// Output goes to a temporary file first; the header with the exit code and
+// duration is only known when the command ends. A nil runLog does nothing.
+type runLog struct {
+	mu        sync.Mutex
+	path      string
+	body      *os.File
+	command   string
+	startTime time.Time
+	stripANSI bool
+	rotation  utils.RotationPolicy // Very long output rolls over to numbered files
+}
+
+// WithRunLog writes the full output of every executed command to a
+// timestamped file in dir. An empty dir disables run logs.
+func (e *Executor) WithRunLog(dir string, stripANSI bool) *Executor {
+	e.runLogDir = dir
+	e.runLogStripANSI = stripANSI
+	return e
+}
+
+// openRunLog starts the run log of command, or returns nil if run logs are
+// disabled or the file cannot be created
+func (e *Executor) openRunLog(command string, startTime time.Time) *runLog {
+	if e.runLogDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(e.runLogDir, 0700); err != nil {
+		log.Printf("Failed to create run log directory: %v", err)
+		return nil
+	}
+
+	path := filepath.Join(e.runLogDir, runLogFileName(command, startTime))
+	body, err := os.CreateTemp(e.runLogDir, ".run-*.tmp")
+	if err != nil {
+		log.Printf("Failed to create run log: %v", err)
+		return nil
+	}
+
+	pruneRunLogs(e.runLogDir, e.logRotation.MaxAge)
+
+	return &runLog{
+		path:      path,
+		body:      body,
+		command:   command,
+		startTime: startTime,
+		stripANSI: e.runLogStripANSI,
+		rotation:  e.logRotation,
+	}
+}
+
+// pruneRunLogs deletes the run logs in dir older than maxAge; 0 keeps them all
+func pruneRunLogs(dir string, maxAge time.Duration) {
+	if maxAge <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !runLogPattern.MatchString(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > maxAge {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// runLogFileName returns the file name of the run log, e.g. "20240102-150405.000-ls-la.log"
+func runLogFileName(command string, startTime time.Time) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(command, "-"), "-.")
+	if len(name) > runLogNameMax {
+		name = strings.TrimRight(name[:runLogNameMax], "-.")
+	}
+	if name == "" {
+		name = "command"
+	}
+	return startTime.Format(runLogTimeFormat) + "-" + name + ".log"
+}
+
+// Write appends output to the log
+func (l *runLog) Write(output string) {
+	if l == nil {
+		return
+	}
+	if l.stripANSI {
+		output = utils.StripANSI(output)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.body.WriteString(output)
+}
+
+// WriteLine appends one line of output to the log
+func (l *runLog) WriteLine(line string) {
+	l.Write(line + "\n")
+}
+
+// Close writes the log file with a header describing result
+func (l *runLog) Close(result *ExecutionResult) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer os.Remove(l.body.Name())
+	defer l.body.Close()
+
+	if err := l.writeFile(result); err != nil {
+		log.Printf("Failed to write run log: %v", err)
+	}
+}
+
+// writeFile writes the header followed by the captured output to the log
+// path; output beyond the maximum file size rolls over to numbered files
+func (l *runLog) writeFile(result *ExecutionResult) error {
+	file := utils.NewRotatingWriter(l.path, l.rotation)
+	defer file.Close()
+
+	header := fmt.Sprintf("# Command:   %s\n# Started:   %s\n# Exit code: %d\n# Duration:  %v\n",
+		l.command, l.startTime.Format(time.RFC3339), result.ExitCode, result.Duration.Round(time.Millisecond))
+	if result.Error != nil {
+		header += fmt.Sprintf("# Error:     %v\n", result.Error)
+	}
+	if _, err := io.WriteString(file, header+"\n"); err != nil {
+		return err
+	}
+
+	if _, err := l.body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(file, l.body)
+	return err
+}
@@ -0,0 +1,553 @@
+package executor
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// Default size of a Screen whose terminal size is unknown
+	defaultScreenWidth  = 80
+	defaultScreenHeight = 24
+
+	// Longest unfinished escape sequence kept for the next write
+	maxPendingSequence = 4096
+)
+
+// cellStyle is the SGR state of a cell: text attributes and colors
+type cellStyle struct {
+	attrs uint16 // Bit n set for SGR attribute n, 1 (bold) to 9 (strikethrough)
+	fg    string // SGR parameters of the foreground, e.g. "31" or "38;5;208"
+	bg    string
+}
+
+// sgr returns the escape sequence selecting the style from the defaults
+func (s cellStyle) sgr() string {
+	params := []string{"0"}
+	for attr := 1; attr <= 9; attr++ {
+		if s.attrs&(1<<attr) != 0 {
+			params = append(params, strconv.Itoa(attr))
+		}
+	}
+	if s.fg != "" {
+		params = append(params, s.fg)
+	}
+	if s.bg != "" {
+		params = append(params, s.bg)
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+// SGR attributes of cellStyle.attrs used outside setStyle
+const (
+	attrUnderline     = 1 << 4
+	attrReverse       = 1 << 7
+	attrStrikethrough = 1 << 9
+)
+
+// visibleBlank reports whether a space drawn in the style can be seen
+func (s cellStyle) visibleBlank() bool {
+	return s.bg != "" || s.attrs&(attrUnderline|attrReverse|attrStrikethrough) != 0
+}
+
+// cell is a character on the screen
+type cell struct {
+	r     rune
+	style cellStyle
+}
+
+// Screen keeps the picture a program draws on a terminal, so its last frame
+// can be shown after it exited. It understands the cursor movement, erasing,
+// scrolling, color and alternate screen sequences TUI programs commonly use;
+// other sequences are ignored. Screen is an io.Writer safe for concurrent use.
+type Screen struct {
+	mutex         sync.Mutex
+	width, height int
+	cells         [][]cell
+	x, y          int
+	wrapPending   bool // The last column was written; the next character wraps
+	style         cellStyle
+	top, bottom   int // Scrolling region, inclusive
+
+	savedX, savedY int
+	main           [][]cell // The main screen while the alternate screen is shown
+	altFrame       string   // The last frame of the alternate screen after it was left
+	pending        []byte   // Incomplete escape sequence or character of the last write
+}
+
+// NewScreen creates a blank screen of the given size
+func NewScreen(width, height int) *Screen {
+	if width <= 0 || height <= 0 {
+		width, height = defaultScreenWidth, defaultScreenHeight
+	}
+	return &Screen{
+		width:  width,
+		height: height,
+		cells:  blankCells(width, height),
+		bottom: height - 1,
+	}
+}
+
+// blankCells creates a grid of spaces
+func blankCells(width, height int) [][]cell {
+	cells := make([][]cell, height)
+	for y := range cells {
+		cells[y] = blankRow(width, cellStyle{})
+	}
+	return cells
+}
+
+// blankRow creates a row of spaces with the background of style
+func blankRow(width int, style cellStyle) []cell {
+	row := make([]cell, width)
+	for x := range row {
+		row[x] = cell{r: ' ', style: cellStyle{bg: style.bg}}
+	}
+	return row
+}
+
+// Write draws p on the screen
+func (s *Screen) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data := append(s.pending, p...)
+	s.pending = nil
+
+	for i := 0; i < len(data); {
+		n, complete := s.consumeSafely(data[i:])
+		if !complete {
+			if len(data)-i <= maxPendingSequence {
+				s.pending = append([]byte(nil), data[i:]...)
+			}
+			break
+		}
+		i += n
+	}
+	return len(p), nil
+}
+
+// consumeSafely is consume for output a misbehaving program controls: if
+// interpreting a sequence panics, the panic is logged and the byte starting
+// the sequence skipped, so the capture goes on with the rest of the output
+func (s *Screen) consumeSafely(data []byte) (n int, complete bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Warning: Skipping output the screen could not interpret: %v", r)
+			s.x, s.y, s.wrapPending = clamp(s.x, s.width), clamp(s.y, s.height), false
+			n, complete = 1, true
+		}
+	}()
+	return s.consume(data)
+}
+
+// consume interprets the character or sequence at the start of data and
+// returns its length, or false if data ends before it does
+func (s *Screen) consume(data []byte) (int, bool) {
+	switch b := data[0]; {
+	case b == 0x1b:
+		return s.consumeEscape(data)
+	case b == '\r':
+		s.x, s.wrapPending = 0, false
+	case b == '\n' || b == '\v' || b == '\f':
+		s.lineFeed()
+	case b == '\b':
+		if s.x > 0 {
+			s.x--
+		}
+		s.wrapPending = false
+	case b == '\t':
+		s.x = min((s.x/8+1)*8, s.width-1)
+	case b < 0x20 || b == 0x7f:
+		// Other control characters, e.g. the bell, draw nothing
+	default:
+		if !utf8.FullRune(data) {
+			return 0, false
+		}
+		r, size := utf8.DecodeRune(data)
+		s.put(r)
+		return size, true
+	}
+	return 1, true
+}
+
+// consumeEscape interprets the escape sequence at the start of data
+func (s *Screen) consumeEscape(data []byte) (int, bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+
+	switch data[1] {
+	case '[':
+		return s.consumeCSI(data)
+	case ']', 'P', '_', '^', 'X':
+		// OSC, DCS and similar strings end with BEL or ESC \
+		for i := 2; i < len(data); i++ {
+			if data[i] == 0x07 {
+				return i + 1, true
+			}
+			if data[i] == 0x1b && i+1 < len(data) && data[i+1] == '\\' {
+				return i + 2, true
+			}
+		}
+		return 0, false
+	case '7':
+		s.savedX, s.savedY = s.x, s.y
+	case '8':
+		s.x, s.y, s.wrapPending = s.savedX, s.savedY, false
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.x = 0
+		s.lineFeed()
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		s.reset()
+	default:
+		// Character set selections like ESC ( B carry intermediate bytes
+		i := 1
+		for i < len(data) && data[i] >= 0x20 && data[i] <= 0x2f {
+			i++
+		}
+		if i == len(data) {
+			return 0, false
+		}
+		return i + 1, true
+	}
+	return 2, true
+}
+
+// consumeCSI interprets the control sequence at the start of data, e.g. ESC [ 2 J
+func (s *Screen) consumeCSI(data []byte) (int, bool) {
+	end := 2
+	for end < len(data) && (data[end] < 0x40 || data[end] > 0x7e) {
+		end++
+	}
+	if end == len(data) {
+		return 0, false
+	}
+
+	params := string(data[2:end])
+	private := strings.HasPrefix(params, "?")
+	if private || strings.HasPrefix(params, ">") || strings.HasPrefix(params, "=") {
+		params = params[1:]
+	}
+	args := strings.Split(params, ";")
+	arg := func(i, fallback int) int {
+		if i >= len(args) {
+			return fallback
+		}
+		n, err := strconv.Atoi(args[i])
+		if err != nil || n == 0 {
+			return fallback
+		}
+		return n
+	}
+
+	final := data[end]
+	if private {
+		if final == 'h' || final == 'l' {
+			s.setMode(args, final == 'h')
+		}
+		return end + 1, true
+	}
+
+	s.wrapPending = false
+	switch final {
+	case 'A':
+		s.y = max(s.y-arg(0, 1), 0)
+	case 'B', 'e':
+		s.y = min(s.y+arg(0, 1), s.height-1)
+	case 'C', 'a':
+		s.x = min(s.x+arg(0, 1), s.width-1)
+	case 'D':
+		s.x = max(s.x-arg(0, 1), 0)
+	case 'E':
+		s.x, s.y = 0, min(s.y+arg(0, 1), s.height-1)
+	case 'F':
+		s.x, s.y = 0, max(s.y-arg(0, 1), 0)
+	case 'G', '`':
+		s.x = clamp(arg(0, 1)-1, s.width)
+	case 'd':
+		s.y = clamp(arg(0, 1)-1, s.height)
+	case 'H', 'f':
+		s.y, s.x = clamp(arg(0, 1)-1, s.height), clamp(arg(1, 1)-1, s.width)
+	case 'J':
+		s.eraseDisplay(arg(0, 0))
+	case 'K':
+		s.eraseLine(arg(0, 0))
+	case 'X':
+		s.erase(s.y, s.x, min(s.x+arg(0, 1), s.width))
+	case 'P':
+		row := s.cells[s.y]
+		n := min(arg(0, 1), s.width-s.x)
+		copy(row[s.x:], row[s.x+n:])
+		s.erase(s.y, s.width-n, s.width)
+	case '@':
+		row := s.cells[s.y]
+		n := min(arg(0, 1), s.width-s.x)
+		copy(row[s.x+n:], row[s.x:s.width-n])
+		s.erase(s.y, s.x, s.x+n)
+	case 'L':
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollDown(s.y, s.bottom, arg(0, 1))
+		}
+	case 'M':
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollUp(s.y, s.bottom, arg(0, 1))
+		}
+	case 'S':
+		s.scrollUp(s.top, s.bottom, arg(0, 1))
+	case 'T':
+		s.scrollDown(s.top, s.bottom, arg(0, 1))
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, s.height)-1
+		if top < bottom && bottom < s.height {
+			s.top, s.bottom = top, bottom
+			s.x, s.y = 0, 0
+		}
+	case 's':
+		s.savedX, s.savedY = s.x, s.y
+	case 'u':
+		s.x, s.y = s.savedX, s.savedY
+	case 'm':
+		s.setStyle(args)
+	}
+	return end + 1, true
+}
+
+// clamp limits a cursor position to 0..size-1
+func clamp(n, size int) int {
+	return max(0, min(n, size-1))
+}
+
+// reset blanks the screen and resets the cursor, style and modes
+func (s *Screen) reset() {
+	s.cells, s.main = blankCells(s.width, s.height), nil
+	s.x, s.y, s.savedX, s.savedY, s.wrapPending = 0, 0, 0, 0, false
+	s.style = cellStyle{}
+	s.top, s.bottom = 0, s.height-1
+}
+
+// setMode switches to or from the alternate screen; other modes are ignored
+func (s *Screen) setMode(args []string, set bool) {
+	for _, mode := range args {
+		if mode != "1049" && mode != "1047" && mode != "47" {
+			continue
+		}
+		switch {
+		case set && s.main == nil:
+			if mode == "1049" {
+				s.savedX, s.savedY = s.x, s.y
+			}
+			s.main = s.cells
+			s.cells = blankCells(s.width, s.height)
+		case !set && s.main != nil:
+			s.altFrame = s.render()
+			s.cells, s.main = s.main, nil
+			if mode == "1049" {
+				s.x, s.y = s.savedX, s.savedY
+			}
+		}
+		s.top, s.bottom = 0, s.height-1
+	}
+}
+
+// setStyle applies the parameters of an SGR sequence
+func (s *Screen) setStyle(args []string) {
+	for i := 0; i < len(args); i++ {
+		n, err := strconv.Atoi(args[i])
+		if err != nil {
+			n = 0 // An empty parameter resets like 0
+		}
+
+		switch {
+		case n == 0:
+			s.style = cellStyle{}
+		case n >= 1 && n <= 9:
+			s.style.attrs |= 1 << n
+		case n == 22:
+			s.style.attrs &^= 1<<1 | 1<<2
+		case n >= 23 && n <= 29:
+			s.style.attrs &^= 1 << (n - 20)
+		case n >= 30 && n <= 37, n >= 90 && n <= 97:
+			s.style.fg = args[i]
+		case n == 39:
+			s.style.fg = ""
+		case n >= 40 && n <= 47, n >= 100 && n <= 107:
+			s.style.bg = args[i]
+		case n == 49:
+			s.style.bg = ""
+		case n == 38 || n == 48 || n == 58:
+			// Extended colors: 38;5;<index> or 38;2;<r>;<g>;<b>
+			count := 0
+			if i+1 < len(args) && args[i+1] == "5" {
+				count = 2
+			} else if i+1 < len(args) && args[i+1] == "2" {
+				count = 4
+			}
+			if count == 0 || i+count >= len(args) {
+				return
+			}
+			color := strings.Join(args[i:i+count+1], ";")
+			if n == 38 {
+				s.style.fg = color
+			} else if n == 48 {
+				s.style.bg = color
+			}
+			i += count
+		}
+	}
+}
+
+// put writes r at the cursor and advances it
+func (s *Screen) put(r rune) {
+	if s.wrapPending {
+		s.x = 0
+		s.lineFeed()
+	}
+	s.cells[s.y][s.x] = cell{r: r, style: s.style}
+	if s.x == s.width-1 {
+		s.wrapPending = true
+	} else {
+		s.x++
+	}
+}
+
+// lineFeed moves the cursor down a line, scrolling at the bottom of the
+// scrolling region
+func (s *Screen) lineFeed() {
+	s.wrapPending = false
+	switch {
+	case s.y == s.bottom:
+		s.scrollUp(s.top, s.bottom, 1)
+	case s.y < s.height-1:
+		s.y++
+	}
+}
+
+// reverseIndex moves the cursor up a line, scrolling at the top of the
+// scrolling region
+func (s *Screen) reverseIndex() {
+	s.wrapPending = false
+	switch {
+	case s.y == s.top:
+		s.scrollDown(s.top, s.bottom, 1)
+	case s.y > 0:
+		s.y--
+	}
+}
+
+// scrollUp moves rows top..bottom up by n, blanking the rows at the bottom
+func (s *Screen) scrollUp(top, bottom, n int) {
+	n = min(n, bottom-top+1)
+	copy(s.cells[top:bottom+1], s.cells[top+n:bottom+1])
+	for y := bottom - n + 1; y <= bottom; y++ {
+		s.cells[y] = blankRow(s.width, s.style)
+	}
+}
+
+// scrollDown moves rows top..bottom down by n, blanking the rows at the top
+func (s *Screen) scrollDown(top, bottom, n int) {
+	n = min(n, bottom-top+1)
+	copy(s.cells[top+n:bottom+1], s.cells[top:bottom+1-n])
+	for y := top; y < top+n; y++ {
+		s.cells[y] = blankRow(s.width, s.style)
+	}
+}
+
+// erase blanks the cells from column start up to end of row y
+func (s *Screen) erase(y, start, end int) {
+	blank := cell{r: ' ', style: cellStyle{bg: s.style.bg}}
+	for x := start; x < end; x++ {
+		s.cells[y][x] = blank
+	}
+}
+
+// eraseLine handles EL: 0 erases to the end of the line, 1 to its start, 2 all of it
+func (s *Screen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		s.erase(s.y, s.x, s.width)
+	case 1:
+		s.erase(s.y, 0, s.x+1)
+	case 2:
+		s.erase(s.y, 0, s.width)
+	}
+}
+
+// eraseDisplay handles ED: 0 erases to the end of the screen, 1 to its
+// start, 2 and 3 all of it
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		for y := s.y + 1; y < s.height; y++ {
+			s.erase(y, 0, s.width)
+		}
+	case 1:
+		s.eraseLine(1)
+		for y := 0; y < s.y; y++ {
+			s.erase(y, 0, s.width)
+		}
+	case 2, 3:
+		for y := 0; y < s.height; y++ {
+			s.erase(y, 0, s.width)
+		}
+	}
+}
+
+// Frame returns the last picture the program drew, with its colors as SGR
+// sequences: the alternate screen it showed last, e.g. the final screen of
+// vim or htop, or else the main screen. Trailing blank lines and spaces are
+// left out, so a program that drew nothing has an empty frame.
+func (s *Screen) Frame() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.main == nil && s.altFrame != "" {
+		return s.altFrame
+	}
+	return s.render()
+}
+
+// render returns the current picture of the screen
+func (s *Screen) render() string {
+	return renderCells(s.cells)
+}
+
+// renderCells returns the picture of rows of cells with SGR sequences for
+// their styles; blank lines at the end are left out
+func renderCells(cells [][]cell) string {
+	lines := make([]string, 0, len(cells))
+	for _, row := range cells {
+		// Spaces that show nothing at the end of the line are not drawn
+		end := len(row)
+		for end > 0 && row[end-1].r == ' ' && !row[end-1].style.visibleBlank() {
+			end--
+		}
+
+		var line strings.Builder
+		style := cellStyle{}
+		for _, c := range row[:end] {
+			if c.style != style {
+				line.WriteString(c.style.sgr())
+				style = c.style
+			}
+			line.WriteRune(c.r)
+		}
+		if style != (cellStyle{}) {
+			line.WriteString("\x1b[0m")
+		}
+		lines = append(lines, line.String())
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
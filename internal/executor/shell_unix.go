@@ -0,0 +1,30 @@
+//go:build !windows
+
+package executor
+
+import "os"
+
+// shellCommand returns the program and arguments running command with shell
+func shellCommand(shell, command string) (string, []string) {
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return shell, []string{"-c", command}
+}
+
+// detectShell returns the user's shell from SHELL, or the first common shell found
+func detectShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+
+	// Check for common shells
+	shells := []string{"/bin/bash", "/usr/bin/bash", "/bin/zsh", "/usr/bin/zsh", "/bin/sh"}
+	for _, shell := range shells {
+		if _, err := os.Stat(shell); err == nil {
+			return shell
+		}
+	}
+
+	return "/bin/sh" // fallback
+}
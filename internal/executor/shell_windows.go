@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// shellCommand returns the program and arguments running command with shell.
+// PowerShell and cmd take their own flags; other shells, like the bash of
+// Git for Windows, are run with -c as on Unix.
+func shellCommand(shell, command string) (string, []string) {
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(shell), filepath.Ext(shell)))
+	switch name {
+	case "powershell", "pwsh":
+		return shell, []string{"-NoProfile", "-Command", command}
+	case "", ".", "cmd":
+		return "cmd", []string{"/C", command}
+	default:
+		return shell, []string{"-c", command}
+	}
+}
+
+// detectShell prefers PowerShell and falls back to cmd. SHELL is ignored,
+// since shells like MSYS set it to a Unix path Windows cannot run.
+func detectShell() string {
+	for _, shell := range []string{"powershell.exe", "pwsh.exe"} {
+		if _, err := exec.LookPath(shell); err == nil {
+			return shell
+		}
+	}
+	return "cmd.exe"
+}
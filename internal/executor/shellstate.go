@@ -0,0 +1,337 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// ShellState is the kind of shell state a command changes
+type ShellState string
+
+const (
+	ShellStateDir       ShellState = "directory"   // cd
+	ShellStateEnv       ShellState = "environment" // export, unset, NAME=value
+	ShellStateAlias     ShellState = "alias"       // alias, unalias
+	ShellStateTransient ShellState = "transient"   // Lost when the shell exits, e.g. source
+)
+
+// transientPrograms are builtins whose only effect is on the shell running
+// them, which exits right after
+var transientPrograms = map[string]bool{
+	"source": true, ".": true, "set": true, "shopt": true, "setopt": true, "unsetopt": true,
+	"ulimit": true, "umask": true, "pushd": true, "popd": true, "declare": true,
+	"typeset": true, "local": true, "readonly": true, "trap": true, "hash": true,
+}
+
+// StateChange is a change to the shell state a command makes. Commands run
+// in a fresh shell each, so the executor applies directory, environment and
+// alias changes itself for the commands that follow.
+type StateChange struct {
+	Kind    ShellState
+	Program string            // Builtin making the change, e.g. "export"; empty for NAME=value
+	Dir     string            // New working directory, for ShellStateDir; "-" for the previous one
+	Set     map[string]string // Variables or aliases set
+	Unset   []string          // Variables or aliases removed
+}
+
+// DetectStateChange returns the shell state command changes, or nil if it
+// changes none or uses the change in the same command, like "cd src && make".
+// Changes the executor cannot apply, such as export FOO=$(date), are
+// reported as ShellStateTransient. On Windows it always returns nil.
+func (e *Executor) DetectStateChange(command string) *StateChange {
+	if runtime.GOOS == "windows" || strings.ContainsAny(command, ";&|<>\n") {
+		return nil
+	}
+
+	words, ok := e.shellWords(command)
+	if !ok || len(words) == 0 {
+		if program := CommandProgram(command); transientPrograms[program] || stateBuiltin(program) {
+			return &StateChange{Kind: ShellStateTransient, Program: program}
+		}
+		return nil
+	}
+
+	program, args := words[0], words[1:]
+	switch {
+	case program == "cd" && len(args) <= 1:
+		dir := "~"
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		return &StateChange{Kind: ShellStateDir, Program: program, Dir: dir}
+	case program == "export" || program == "alias":
+		kind := ShellStateEnv
+		if program == "alias" {
+			kind = ShellStateAlias
+		}
+		if len(args) == 0 {
+			return nil // Only lists them
+		}
+		set, ok := assignments(args, program == "export")
+		if !ok {
+			return &StateChange{Kind: ShellStateTransient, Program: program}
+		}
+		return &StateChange{Kind: kind, Program: program, Set: set}
+	case program == "unset" || program == "unalias":
+		kind := ShellStateEnv
+		if program == "unalias" {
+			kind = ShellStateAlias
+		}
+		if len(args) == 0 || !plainArgs(args) {
+			return &StateChange{Kind: ShellStateTransient, Program: program}
+		}
+		return &StateChange{Kind: kind, Program: program, Unset: args}
+	case envAssignmentPattern.MatchString(program):
+		if set, ok := assignments(words, false); ok {
+			return &StateChange{Kind: ShellStateEnv, Set: set}
+		}
+		return nil // Variables set for a command
+	case transientPrograms[program] || stateBuiltin(program):
+		return &StateChange{Kind: ShellStateTransient, Program: program}
+	}
+	return nil
+}
+
+// stateBuiltin reports whether program changes shell state the executor
+// applies itself, once its words can be understood
+func stateBuiltin(program string) bool {
+	switch program {
+	case "cd", "export", "alias", "unset", "unalias":
+		return true
+	}
+	return false
+}
+
+// assignments parses NAME=value words; with bare set, a NAME alone, as in
+// "export NAME", keeps its current value and is skipped
+func assignments(words []string, bare bool) (map[string]string, bool) {
+	set := make(map[string]string)
+	for _, word := range words {
+		name, value, found := strings.Cut(word, "=")
+		if !found {
+			if bare && envAssignmentPattern.MatchString(name+"=") {
+				continue
+			}
+			return nil, false
+		}
+		if name == "" || strings.HasPrefix(name, "-") || (bare && !envAssignmentPattern.MatchString(word)) {
+			return nil, false
+		}
+		set[name] = value
+	}
+	return set, true
+}
+
+// ApplyStateChange applies a directory, environment or alias change to the
+// commands the executor runs from now on. Transient changes cannot be
+// applied and return an error.
+func (e *Executor) ApplyStateChange(change *StateChange) error {
+	switch change.Kind {
+	case ShellStateDir:
+		dir := e.resolvePath(change.Dir)
+		if change.Dir == "-" {
+			if e.prevDir == "" {
+				return fmt.Errorf("cd: no previous directory")
+			}
+			dir = e.prevDir
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("cd: %s: no such directory", change.Dir)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("cd: %s: not a directory", change.Dir)
+		}
+		e.prevDir, e.workDir = e.workDir, dir
+	case ShellStateEnv:
+		for _, name := range change.Unset {
+			e.setEnv(name, "", false)
+		}
+		for name, value := range change.Set {
+			e.setEnv(name, value, true)
+		}
+	case ShellStateAlias:
+		if e.aliases == nil {
+			e.aliases = make(map[string]string)
+		}
+		for _, name := range change.Unset {
+			delete(e.aliases, name)
+		}
+		for name, value := range change.Set {
+			e.aliases[name] = value
+		}
+	default:
+		return fmt.Errorf("%s only changes the shell it runs in", change.Program)
+	}
+	return nil
+}
+
+// resolvePath resolves path against the working directory and the home
+// directory of the executor's environment
+func (e *Executor) resolvePath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home := e.getenv("HOME")
+		if home == "" {
+			home, _ = os.UserHomeDir()
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(e.workDir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// getenv returns the value of a variable in the executor's environment
+func (e *Executor) getenv(name string) string {
+	value, _ := e.LookupEnv(name)
+	return value
+}
+
+// LookupEnv looks up a variable in the environment commands run with,
+// including the variables the session exported
+func (e *Executor) LookupEnv(name string) (string, bool) {
+	if len(e.env) == 0 {
+		return os.LookupEnv(name)
+	}
+	for i := len(e.env) - 1; i >= 0; i-- {
+		if key, value, _ := strings.Cut(e.env[i], "="); key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// setEnv sets or, without set, removes a variable of the executor's environment
+func (e *Executor) setEnv(name, value string, set bool) {
+	current := e.env
+	if len(current) == 0 {
+		current = os.Environ() // Commands inherit it while env is empty
+	}
+	env := make([]string, 0, len(current)+1)
+	for _, entry := range current {
+		if key, _, _ := strings.Cut(entry, "="); key != name {
+			env = append(env, entry)
+		}
+	}
+	if set {
+		env = append(env, name+"="+value)
+	}
+	e.env = env
+}
+
+// Resolve returns command as the executor runs it, with a session alias in
+// its first word expanded, for the safety checks and the confirmation to see
+// what actually runs. Run the command itself, not what Resolve returns, as
+// the executor expands the alias again.
+func (e *Executor) Resolve(command string) string {
+	return e.expandAlias(command)
+}
+
+// ExplainDanger classifies command, as Resolve returns it, like
+// utils.ExplainCommandDangerIn in the working directory and with the
+// variables of the session
+func (e *Executor) ExplainDanger(command string) utils.DangerMatch {
+	return utils.ExplainCommandDangerEnv(command, e.workDir, e.LookupEnv)
+}
+
+// expandAlias replaces the first word of command by the session alias it
+// names. Aliases later in the command, e.g. after a pipe, are not expanded.
+func (e *Executor) expandAlias(command string) string {
+	trimmed := strings.TrimLeft(command, " \t")
+	end := strings.IndexAny(trimmed, " \t;&|<>()")
+	if end < 0 {
+		end = len(trimmed)
+	}
+	if value, ok := e.aliases[trimmed[:end]]; ok {
+		return value + trimmed[end:]
+	}
+	return command
+}
+
+// shellWords splits command into words like the shell, removing quotes and
+// expanding $NAME and ${NAME} from the executor's environment. It reports
+// false for what it does not handle: command substitution, backslashes,
+// globs and unbalanced quotes.
+func (e *Executor) shellWords(command string) ([]string, bool) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' || r == '`' || (quote == 0 && strings.ContainsRune("*?[(){}", r)):
+			return nil, false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '$':
+			name, n := variableName(runes[i+1:])
+			if n == 0 {
+				return nil, false
+			}
+			word.WriteString(e.getenv(name))
+			inWord = true
+			i += n
+		case r == '"':
+			if quote == '"' {
+				quote = 0
+			} else {
+				quote = r
+			}
+			inWord = true
+		case r == '\'':
+			quote = r
+			inWord = true
+		case quote == 0 && (r == ' ' || r == '\t'):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, false
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, true
+}
+
+// variableName returns the name of the variable at the start of s, which
+// follows a $, and how many runes it takes up; 0 if there is none
+func variableName(s []rune) (string, int) {
+	if len(s) > 0 && s[0] == '{' {
+		for i := 1; i < len(s); i++ {
+			if s[i] == '}' {
+				name := string(s[1:i])
+				if !envAssignmentPattern.MatchString(name + "=") {
+					return "", 0 // Empty, or an expansion like ${NAME:-default}
+				}
+				return name, i + 1
+			}
+		}
+		return "", 0
+	}
+	n := 0
+	for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || n > 0 && s[n] >= '0' && s[n] <= '9') {
+		n++
+	}
+	return string(s[:n]), n
+}
@@ -0,0 +1,134 @@
+package executor
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// stdinFilter describes a program that reads standard input when it is given
+// no file operands
+type stdinFilter struct {
+	operands     int             // Leading operands that are not files, like the grep pattern; -1 if stdin is always read
+	valueOptions map[string]bool // Options taking a separate value, like -n in `head -n 5`
+}
+
+// stdinFilters are common programs that read standard input
+var stdinFilters = map[string]stdinFilter{
+	"cat":       {},
+	"wc":        {},
+	"sort":      {valueOptions: map[string]bool{"-k": true, "-t": true, "-o": true, "-S": true}},
+	"uniq":      {valueOptions: map[string]bool{"-f": true, "-s": true, "-w": true}},
+	"head":      {valueOptions: map[string]bool{"-n": true, "-c": true}},
+	"tail":      {valueOptions: map[string]bool{"-n": true, "-c": true}},
+	"cut":       {valueOptions: map[string]bool{"-d": true, "-f": true, "-c": true, "-b": true}},
+	"base64":    {},
+	"md5sum":    {},
+	"sha1sum":   {},
+	"sha256sum": {},
+	"gzip":      {},
+	"rev":       {},
+	"nl":        {},
+	"bc":        {},
+	"grep":      {operands: 1, valueOptions: map[string]bool{"-A": true, "-B": true, "-C": true, "-m": true}},
+	"sed":       {operands: 1},
+	"awk":       {operands: 1, valueOptions: map[string]bool{"-F": true, "-v": true}},
+	"jq":        {operands: 1, valueOptions: map[string]bool{"--arg": true, "--argjson": true}},
+	"tr":        {operands: -1},
+	"tee":       {operands: -1},
+	"xargs":     {operands: -1},
+}
+
+// ReadsStdin reports whether command likely waits for input on standard
+// input, like `sort` or `grep foo` without files. Heredocs, redirected input
+// and commands at the end of a pipe get their input from the shell instead.
+func ReadsStdin(command string) bool {
+	fields, redirected := firstCommandFields(command)
+	if redirected {
+		return false
+	}
+
+	for len(fields) > 0 && (fields[0] == "sudo" || commandPrefixes[fields[0]] || envAssignmentPattern.MatchString(fields[0])) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return false
+	}
+
+	filter, ok := stdinFilters[filepath.Base(fields[0])]
+	if !ok {
+		return false
+	}
+	if filter.operands < 0 {
+		return true
+	}
+
+	var operands []string
+	for i := 1; i < len(fields); i++ {
+		arg := fields[i]
+		if arg == "-" {
+			return true // Explicit stdin operand
+		}
+		if strings.Contains(arg, ">") {
+			if strings.HasSuffix(arg, ">") {
+				i++ // Output file of `> file`
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			if filter.valueOptions[arg] {
+				i++
+			}
+			continue
+		}
+		operands = append(operands, arg)
+	}
+	return len(operands) <= filter.operands
+}
+
+// firstCommandFields splits the first command of a pipeline or list into
+// fields, keeping quoted text together. Only the first command reads from the
+// terminal. redirected reports a heredoc or input redirection.
+func firstCommandFields(command string) (fields []string, redirected bool) {
+	var field strings.Builder
+	inField := false
+	var quote rune
+
+	for _, r := range command {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				field.WriteRune(r)
+			}
+			continue
+		case r == '\'' || r == '"':
+			quote = r
+			inField = true
+			continue
+		case r == '<':
+			return fields, true
+		case r == '&' && strings.HasSuffix(field.String(), ">"):
+			// Part of a redirection like 2>&1
+		case r == '|' || r == ';' || r == '&' || r == '\n':
+			if inField {
+				fields = append(fields, field.String())
+			}
+			return fields, false
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+			continue
+		}
+		field.WriteRune(r)
+		inField = true
+	}
+
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, false
+}
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// leaveAltScreen switches back to the main screen and shows the cursor, which
+// a full-screen program ended by a panic or a signal leaves as they were
+const leaveAltScreen = "\x1b[?1049l\x1b[?25h"
+
+// terminalGuard puts the terminal back in the mode it had before an
+// interactive command made it raw, however the command ends
+type terminalGuard struct {
+	mu      sync.Mutex
+	restore func() error // Restores the mode; nil once it did
+	output  io.Writer    // Terminal to leave the alternate screen of
+}
+
+// activeGuard is the guard of the interactive command running, if any
+var activeGuard atomic.Pointer[terminalGuard]
+
+// newTerminalGuard returns the guard restoring the terminal with restore, and
+// makes it the one RestoreTerminal uses until it restored the terminal
+func newTerminalGuard(restore func() error, output io.Writer) *terminalGuard {
+	g := &terminalGuard{restore: restore, output: output}
+	activeGuard.Store(g)
+	return g
+}
+
+// Restore restores the terminal mode; calls after the first do nothing
+func (g *terminalGuard) Restore() error {
+	activeGuard.CompareAndSwap(g, nil)
+
+	g.mu.Lock()
+	restore := g.restore
+	g.restore = nil
+	g.mu.Unlock()
+
+	if restore == nil {
+		return nil
+	}
+	return restore()
+}
+
+// Abort restores the terminal mode, leaves the alternate screen and shows the
+// cursor, for a command that did not get to clean up after itself
+func (g *terminalGuard) Abort() {
+	if err := g.Restore(); err != nil {
+		log.Printf("Warning: Failed to restore terminal state: %v", err)
+	}
+	io.WriteString(g.output, leaveAltScreen)
+}
+
+// release is deferred by the function running the command: it restores the
+// terminal mode, and on a panic aborts before passing the panic on
+func (g *terminalGuard) release() {
+	if r := recover(); r != nil {
+		g.Abort()
+		panic(r)
+	}
+	if err := g.Restore(); err != nil {
+		log.Printf("Warning: Failed to restore terminal state: %v", err)
+	}
+}
+
+// RestoreTerminal restores the terminal an interactive command that is still
+// running holds in raw mode, for a panic or signal ending clia meanwhile. It
+// reports false if no command holds the terminal.
+func RestoreTerminal() bool {
+	g := activeGuard.Load()
+	if g == nil {
+		return false
+	}
+	g.Abort()
+	return true
+}
@@ -0,0 +1,168 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// undoUnsafeChars are characters that make the words of a command depend on
+// the shell: quoting, expansion, redirection and command lists. Commands
+// containing them are never undone.
+const undoUnsafeChars = "\"'\\;&|<>$`*?()[]{}~!#"
+
+// undoPatterns maps programs to the function planning the inverse of a run
+// with the given arguments. A planner returns nil when it is not sure the
+// inverse restores what was there before.
+var undoPatterns = map[string]func(args []string, fs undoFS) []string{
+	"mv":    undoMove,
+	"cp":    undoCopy,
+	"mkdir": undoMkdir,
+	"touch": undoTouch,
+	"ln":    undoLink,
+	"git":   undoGit,
+}
+
+// undoFS tells planners about the files a command is about to change
+type undoFS struct {
+	dir string
+}
+
+// path resolves name relative to the working directory
+func (fs undoFS) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(fs.dir, name)
+}
+
+// exists reports whether name exists, and whether it is a directory
+func (fs undoFS) exists(name string) (exists, isDir bool) {
+	info, err := os.Lstat(fs.path(name))
+	if err != nil {
+		return false, false
+	}
+	return true, info.IsDir()
+}
+
+// PlanUndo returns the command reversing command, e.g. "mv b a" for "mv a b",
+// judged from the files as they are before command runs in the working
+// directory. It returns "" unless command is a plain mv, cp, mkdir, touch,
+// ln -s or git add whose inverse restores the previous state: moving or
+// copying over an existing file, for one, cannot be undone. On Windows it
+// always returns "".
+func (e *Executor) PlanUndo(command string) string {
+	if runtime.GOOS == "windows" || strings.ContainsAny(command, undoUnsafeChars) {
+		return ""
+	}
+	words := strings.Fields(command)
+	if len(words) < 2 {
+		return ""
+	}
+	plan, ok := undoPatterns[words[0]]
+	if !ok {
+		return ""
+	}
+	inverse := plan(words[1:], undoFS{dir: e.workDir})
+	if inverse == nil {
+		return ""
+	}
+	return strings.Join(inverse, " ")
+}
+
+// plainArgs reports whether args has no options, so the planners know exactly
+// what the command does
+func plainArgs(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return false
+		}
+	}
+	return len(args) > 0
+}
+
+// newPaths reports whether none of the paths exist yet
+func newPaths(paths []string, fs undoFS) bool {
+	for _, path := range paths {
+		if exists, _ := fs.exists(path); exists {
+			return false
+		}
+	}
+	return true
+}
+
+// undoMove moves a renamed file back, or out of the directory it was moved into
+func undoMove(args []string, fs undoFS) []string {
+	if len(args) != 2 || !plainArgs(args) {
+		return nil
+	}
+	src, dst := args[0], args[1]
+	if exists, _ := fs.exists(src); !exists {
+		return nil
+	}
+	if exists, isDir := fs.exists(dst); exists {
+		if !isDir {
+			return nil // Overwrites dst
+		}
+		dst = filepath.Join(dst, filepath.Base(src))
+		if exists, _ := fs.exists(dst); exists {
+			return nil
+		}
+	}
+	return []string{"mv", dst, src}
+}
+
+// undoCopy removes the copy of a file
+func undoCopy(args []string, fs undoFS) []string {
+	if len(args) != 2 || !plainArgs(args) {
+		return nil
+	}
+	src, dst := args[0], args[1]
+	if exists, isDir := fs.exists(src); !exists || isDir {
+		return nil
+	}
+	if exists, isDir := fs.exists(dst); exists {
+		if !isDir {
+			return nil // Overwrites dst
+		}
+		dst = filepath.Join(dst, filepath.Base(src))
+		if exists, _ := fs.exists(dst); exists {
+			return nil
+		}
+	}
+	return []string{"rm", dst}
+}
+
+// undoMkdir removes the directories created
+func undoMkdir(args []string, fs undoFS) []string {
+	if !plainArgs(args) || !newPaths(args, fs) {
+		return nil
+	}
+	return append([]string{"rmdir"}, args...)
+}
+
+// undoTouch removes the files created; touching existing files only changes
+// their times, which is not undone
+func undoTouch(args []string, fs undoFS) []string {
+	if !plainArgs(args) || !newPaths(args, fs) {
+		return nil
+	}
+	return append([]string{"rm"}, args...)
+}
+
+// undoLink removes the symbolic link created by ln -s target link
+func undoLink(args []string, fs undoFS) []string {
+	if len(args) != 3 || args[0] != "-s" || !plainArgs(args[1:]) || !newPaths(args[2:], fs) {
+		return nil
+	}
+	return []string{"rm", args[2]}
+}
+
+// undoGit unstages the paths of git add
+func undoGit(args []string, fs undoFS) []string {
+	if len(args) < 2 || args[0] != "add" || !plainArgs(args[1:]) {
+		return nil
+	}
+	return append([]string{"git", "restore", "--staged"}, args[1:]...)
+}
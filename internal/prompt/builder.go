@@ -3,19 +3,23 @@ package prompt
 import (
 	"context"
 	"fmt"
+	"strings"
 )
 
 // PromptBuilder builds prompts for LLM requests
 type PromptBuilder struct {
-	collector *ContextCollector
-	template  string
+	collector    *ContextCollector
+	template     string
+	conversation *Conversation
+	templates    []RequestTemplate
 }
 
 // NewPromptBuilder creates a new prompt builder
 func NewPromptBuilder() *PromptBuilder {
 	return &PromptBuilder{
-		collector: NewContextCollector(),
-		template:  SystemPrompt,
+		collector:    NewContextCollector(),
+		template:     SystemPrompt,
+		conversation: NewConversation(3),
 	}
 }
 
@@ -36,7 +40,7 @@ func (b *PromptBuilder) WithContextOptions(maxFiles int, includeHidden, includeE
 // BuildCommandPrompt builds a prompt for command suggestion
 func (b *PromptBuilder) BuildCommandPrompt(ctx context.Context, userInput string) (string, error) {
 	// Collect context
-	envContext, err := b.collector.Collect()
+	envContext, err := b.collector.CollectForRequest(userInput)
 	if err != nil {
 		// If context collection fails, use a fallback approach
 		return b.buildFallbackPrompt(userInput, err), nil
@@ -45,6 +49,16 @@ func (b *PromptBuilder) BuildCommandPrompt(ctx context.Context, userInput string
 	// Build template
 	template := NewCommandPromptTemplate(userInput, envContext)
 
+	// Requests following a user-defined template carry its instructions
+	if match, ok := b.MatchTemplate(userInput); ok {
+		template.UserInput = match.FormatForPrompt()
+	}
+
+	// Include previous exchanges when the input refines an earlier request
+	if IsFollowUp(userInput) && !b.conversation.IsEmpty() {
+		template.History = b.conversation.FormatForPrompt()
+	}
+
 	// Enhance with examples if context is rich enough
 	if envContext.FileCount > 0 || envContext.DirectoryCount > 0 {
 		template = template.EnhanceWithExamples()
@@ -67,6 +81,19 @@ func (b *PromptBuilder) BuildQuickPrompt(userInput string) string {
 	return QuickCommandPrompt(userInput, os, shell)
 }
 
+// BuildQuestionPrompt builds a prompt asking for a plain-text answer instead of commands
+func (b *PromptBuilder) BuildQuestionPrompt(question string) string {
+	os := "unknown"
+	shell := "bash"
+
+	if quickContext, err := b.collector.Collect(); err == nil {
+		os = quickContext.OS
+		shell = quickContext.Shell
+	}
+
+	return QuestionPrompt(question, os, shell)
+}
+
 // BuildCustomPrompt builds a custom prompt with variables
 func (b *PromptBuilder) BuildCustomPrompt(template, userInput string, variables map[string]string) (string, error) {
 	// Collect context for custom template
@@ -114,6 +141,48 @@ func (b *PromptBuilder) ValidatePrompt(prompt string) error {
 	return nil
 }
 
+// WithConversation sets the conversation used for follow-up requests
+func (b *PromptBuilder) WithConversation(conversation *Conversation) *PromptBuilder {
+	b.conversation = conversation
+	return b
+}
+
+// GetConversation returns the conversation used for follow-up requests
+func (b *PromptBuilder) GetConversation() *Conversation {
+	return b.conversation
+}
+
+// SetRequestTemplates sets the user-defined request templates, checked in order
+func (b *PromptBuilder) SetRequestTemplates(templates []RequestTemplate) *PromptBuilder {
+	b.templates = templates
+	return b
+}
+
+// GetRequestTemplates returns the user-defined request templates
+func (b *PromptBuilder) GetRequestTemplates() []RequestTemplate {
+	return b.templates
+}
+
+// FindTemplate returns the request template with the given name
+func (b *PromptBuilder) FindTemplate(name string) (RequestTemplate, bool) {
+	for _, template := range b.templates {
+		if strings.EqualFold(template.Name, name) {
+			return template, true
+		}
+	}
+	return RequestTemplate{}, false
+}
+
+// MatchTemplate returns the first request template that userInput follows
+func (b *PromptBuilder) MatchTemplate(userInput string) (*TemplateMatch, bool) {
+	for _, template := range b.templates {
+		if match, ok := template.Match(userInput); ok {
+			return match, true
+		}
+	}
+	return nil, false
+}
+
 // GetContextCollector returns the context collector for configuration
 func (b *PromptBuilder) GetContextCollector() *ContextCollector {
 	return b.collector
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 )
 
@@ -23,6 +25,10 @@ type Context struct {
 	DirectoryCount int      `json:"directory_count"`
 	FileCount      int      `json:"file_count"`
 
+	// Detailed listing, only collected for requests that reference files
+	Listing        []string `json:"listing,omitempty"`
+	ListingOmitted int      `json:"listing_omitted,omitempty"`
+
 	// Environment
 	EnvVars map[string]string `json:"env_vars,omitempty"`
 }
@@ -33,8 +39,17 @@ type ContextCollector struct {
 	includeHidden  bool
 	maxPathDepth   int
 	includeEnvVars bool
+
+	// Directory listing for requests that reference files (opt-in)
+	includeListing  bool
+	maxListingFiles int
+
+	workDir string // Directory described; the current directory if empty
 }
 
+// DefaultMaxListingFiles caps the directory listing so prompts stay small
+const DefaultMaxListingFiles = 50
+
 // NewContextCollector creates a new context collector
 func NewContextCollector() *ContextCollector {
 	return &ContextCollector{
@@ -42,6 +57,9 @@ func NewContextCollector() *ContextCollector {
 		includeHidden:  false, // Skip hidden files by default
 		maxPathDepth:   3,     // Limit subdirectory depth
 		includeEnvVars: false, // Don't include env vars by default for privacy
+
+		includeListing:  false,
+		maxListingFiles: DefaultMaxListingFiles,
 	}
 }
 
@@ -63,6 +81,42 @@ func (c *ContextCollector) SetIncludeEnvVars(include bool) *ContextCollector {
 	return c
 }
 
+// SetDirectoryListing sets whether a detailed listing of the working directory
+// is added for requests that reference files, and how many entries it may hold
+func (c *ContextCollector) SetDirectoryListing(include bool, maxFiles int) *ContextCollector {
+	c.includeListing = include
+	if maxFiles > 0 {
+		c.maxListingFiles = maxFiles
+	}
+	return c
+}
+
+// SetWorkDir sets the directory the context describes, e.g. after the user
+// changed directory in a session; empty uses the current directory
+func (c *ContextCollector) SetWorkDir(dir string) *ContextCollector {
+	c.workDir = dir
+	return c
+}
+
+// CollectForRequest gathers the environment context for a user request. When
+// the directory listing is enabled and the request references files, the
+// context includes a truncated listing of the working directory.
+func (c *ContextCollector) CollectForRequest(userInput string) (*Context, error) {
+	ctx, err := c.Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.includeListing && ReferencesFiles(userInput) {
+		if listing, omitted, err := c.collectListing(ctx.WorkingDir, globPatterns(userInput)); err == nil {
+			ctx.Listing = listing
+			ctx.ListingOmitted = omitted
+		}
+	}
+
+	return ctx, nil
+}
+
 // Collect gathers current environment context
 func (c *ContextCollector) Collect() (*Context, error) {
 	ctx := &Context{
@@ -71,9 +125,12 @@ func (c *ContextCollector) Collect() (*Context, error) {
 	}
 
 	// Get working directory
-	wd, err := os.Getwd()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	wd := c.workDir
+	if wd == "" {
+		var err error
+		if wd, err = os.Getwd(); err != nil {
+			return nil, fmt.Errorf("failed to get working directory: %w", err)
+		}
 	}
 	ctx.WorkingDir = wd
 
@@ -169,6 +226,117 @@ func (c *ContextCollector) collectFiles(dir string) ([]string, int, int, error)
 	return files, dirCount, fileCount, nil
 }
 
+// collectListing returns an ls-style listing of dir with at most maxListingFiles
+// entries, and the number of entries left out. Entries matching one of
+// patterns are listed first.
+func (c *ContextCollector) collectListing(dir string, patterns []string) ([]string, int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var visible []os.DirEntry
+	for _, entry := range entries {
+		if !c.includeHidden && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		visible = append(visible, entry)
+	}
+
+	if len(patterns) > 0 {
+		sort.SliceStable(visible, func(i, j int) bool {
+			return matchesAny(visible[i].Name(), patterns) && !matchesAny(visible[j].Name(), patterns)
+		})
+	}
+
+	omitted := 0
+	if len(visible) > c.maxListingFiles {
+		omitted = len(visible) - c.maxListingFiles
+		visible = visible[:c.maxListingFiles]
+	}
+
+	listing := make([]string, 0, len(visible))
+	for _, entry := range visible {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		kind, size, name := "-", formatSize(info.Size()), entry.Name()
+		if entry.IsDir() {
+			kind, size, name = "d", "-", name+"/"
+		}
+		listing = append(listing, fmt.Sprintf("%s %8s  %s  %s", kind, size, info.ModTime().Format("2006-01-02"), name))
+	}
+
+	return listing, omitted, nil
+}
+
+// formatSize formats a file size in bytes for the directory listing
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+var (
+	// filePhrasePattern matches phrases that refer to files in the current directory
+	filePhrasePattern = regexp.MustCompile(`\b(these|those|the files|all files|every file|each file|files here|this (folder|directory|dir))\b`)
+
+	// fileNamePattern matches words that look like file names or extensions (report.pdf, .jpg)
+	fileNamePattern = regexp.MustCompile(`^[\w-]*\.[a-z][a-z0-9]{0,4}$`)
+)
+
+// ReferencesFiles reports whether a request refers to files in the working
+// directory, e.g. "rename these photos", "the files", or "*.jpg"
+func ReferencesFiles(userInput string) bool {
+	input := strings.ToLower(userInput)
+	if filePhrasePattern.MatchString(input) || len(globPatterns(input)) > 0 {
+		return true
+	}
+
+	for _, word := range strings.Fields(input) {
+		if fileNamePattern.MatchString(strings.Trim(word, `"',;:!?()`)) {
+			return true
+		}
+	}
+	return false
+}
+
+// globPatterns returns the shell glob patterns in a request, e.g. *.jpg
+func globPatterns(userInput string) []string {
+	var patterns []string
+	for _, word := range strings.Fields(userInput) {
+		word = strings.Trim(word, `"',;:!()`)
+		if !strings.ContainsAny(word, "*?[") {
+			continue
+		}
+		if _, err := filepath.Match(word, ""); err == nil {
+			patterns = append(patterns, word)
+		}
+	}
+	return patterns
+}
+
+// matchesAny reports whether name matches one of the glob patterns, ignoring case
+func matchesAny(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
 // collectRelevantEnvVars collects environment variables that might be relevant for command suggestions
 func (c *ContextCollector) collectRelevantEnvVars() map[string]string {
 	relevantVars := []string{
@@ -213,6 +381,15 @@ func (ctx *Context) FormatForPrompt() string {
 		parts = append(parts, "Directory Contents: (empty or unreadable)")
 	}
 
+	// Detailed listing for requests that reference files
+	if len(ctx.Listing) > 0 {
+		parts = append(parts, "Directory Listing:")
+		parts = append(parts, ctx.Listing...)
+		if ctx.ListingOmitted > 0 {
+			parts = append(parts, fmt.Sprintf("... (%d more entries not shown)", ctx.ListingOmitted))
+		}
+	}
+
 	// Environment variables (if any)
 	if len(ctx.EnvVars) > 0 {
 		var envList []string
@@ -0,0 +1,123 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ConversationTurn represents a single request/command exchange
+type ConversationTurn struct {
+	Request string `json:"request"`
+	Command string `json:"command"`
+}
+
+// Conversation keeps a short history of recent exchanges for follow-up requests
+type Conversation struct {
+	turns    []ConversationTurn
+	maxTurns int
+	mutex    sync.RWMutex
+}
+
+// followUpPrefixes are phrases that indicate the input refers to a previous
+// exchange. Words like "use", "with" or "this" also start standalone requests,
+// e.g. "use curl to download x", so only unambiguous markers are listed.
+var followUpPrefixes = []string{
+	"now ", "also ", "instead ", "and then ", "what about ",
+}
+
+// NewConversation creates a new conversation that keeps at most maxTurns exchanges
+func NewConversation(maxTurns int) *Conversation {
+	if maxTurns <= 0 {
+		maxTurns = 3
+	}
+
+	return &Conversation{
+		turns:    make([]ConversationTurn, 0, maxTurns),
+		maxTurns: maxTurns,
+	}
+}
+
+// Add records a new exchange, dropping the oldest one when full
+func (c *Conversation) Add(request, command string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.turns = append(c.turns, ConversationTurn{Request: request, Command: command})
+	if len(c.turns) > c.maxTurns {
+		c.turns = c.turns[len(c.turns)-c.maxTurns:]
+	}
+}
+
+// SetLastCommand replaces the command of the most recent exchange (e.g. when the user picks a different suggestion)
+func (c *Conversation) SetLastCommand(command string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.turns) == 0 {
+		return
+	}
+	c.turns[len(c.turns)-1].Command = command
+}
+
+// Reset clears the conversation history
+func (c *Conversation) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.turns = c.turns[:0]
+}
+
+// Turns returns a copy of the recorded exchanges, oldest first
+func (c *Conversation) Turns() []ConversationTurn {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	turns := make([]ConversationTurn, len(c.turns))
+	copy(turns, c.turns)
+	return turns
+}
+
+// IsEmpty returns true if no exchanges have been recorded
+func (c *Conversation) IsEmpty() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return len(c.turns) == 0
+}
+
+// FormatForPrompt formats the conversation history for inclusion in a prompt
+func (c *Conversation) FormatForPrompt() string {
+	turns := c.Turns()
+	if len(turns) == 0 {
+		return ""
+	}
+
+	var parts []string
+	for i, turn := range turns {
+		parts = append(parts, fmt.Sprintf("%d. User: %s", i+1, turn.Request))
+		if turn.Command != "" {
+			parts = append(parts, fmt.Sprintf("   Command: %s", turn.Command))
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// IsFollowUp returns true if the input looks like a refinement of a previous request
+func IsFollowUp(input string) bool {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "" {
+		return false
+	}
+
+	// Pad with a space so prefixes ending in a space also match single-word inputs
+	padded := input + " "
+	for _, prefix := range followUpPrefixes {
+		if strings.HasPrefix(padded, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
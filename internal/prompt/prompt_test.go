@@ -2,6 +2,7 @@ package prompt
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
@@ -278,6 +279,82 @@ func TestPromptBuilderWithOptions(t *testing.T) {
 	}
 }
 
+func TestReferencesFiles(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"rename these photos", true},
+		{"compress the files by date", true},
+		{"convert *.jpg to png", true},
+		{"open report.pdf", true},
+		{"delete all .tmp files", true},
+		{"show disk usage", false},
+		{"install version 1.2", false},
+		{"list running processes", false},
+	}
+
+	for _, tt := range tests {
+		if got := ReferencesFiles(tt.input); got != tt.expected {
+			t.Errorf("ReferencesFiles(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestCollectForRequestListing(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg", "notes.txt", ".hidden"} {
+		if err := os.WriteFile(dir+"/"+name, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(dir+"/photos", 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	// The listing is opt-in
+	collector := NewContextCollector()
+	ctx, err := collector.CollectForRequest("rename these photos")
+	if err != nil {
+		t.Fatalf("Failed to collect context: %v", err)
+	}
+	if len(ctx.Listing) != 0 {
+		t.Errorf("Expected no listing by default, got %v", ctx.Listing)
+	}
+
+	collector.SetDirectoryListing(true, 2)
+
+	ctx, err = collector.CollectForRequest("show disk usage")
+	if err != nil {
+		t.Fatalf("Failed to collect context: %v", err)
+	}
+	if len(ctx.Listing) != 0 {
+		t.Errorf("Expected no listing for a request without file references, got %v", ctx.Listing)
+	}
+
+	ctx, err = collector.CollectForRequest("count words in *.txt")
+	if err != nil {
+		t.Fatalf("Failed to collect context: %v", err)
+	}
+	if len(ctx.Listing) != 2 || ctx.ListingOmitted != 2 {
+		t.Fatalf("Expected 2 entries with 2 omitted, got %v (%d omitted)", ctx.Listing, ctx.ListingOmitted)
+	}
+	if !strings.HasSuffix(ctx.Listing[0], "notes.txt") {
+		t.Errorf("Expected entries matching the glob first, got %v", ctx.Listing)
+	}
+	for _, line := range ctx.Listing {
+		if strings.Contains(line, ".hidden") {
+			t.Errorf("Expected hidden files to be skipped, got %q", line)
+		}
+	}
+
+	formatted := ctx.FormatForPrompt()
+	if !strings.Contains(formatted, "Directory Listing:") || !strings.Contains(formatted, "2 more entries not shown") {
+		t.Errorf("Expected listing in prompt context, got:\n%s", formatted)
+	}
+}
+
 func TestShellDetection(t *testing.T) {
 	collector := NewContextCollector()
 
@@ -315,3 +392,195 @@ func TestQuickCommandPrompt(t *testing.T) {
 		}
 	}
 }
+
+func TestIsFollowUp(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"also show hidden files", true},
+		{"instead use find", true},
+		{"Now sort by size", true},
+		{"and then delete them", true},
+		{"what about hidden files", true},
+		{"list all files", false},
+		// Standalone requests starting with words follow-ups use too
+		{"use curl to download x", false},
+		{"this directory's size", false},
+		{"with sudo restart nginx", false},
+		{"it takes long to build, show the slowest step", false},
+		{"only show running containers", false},
+		{"and gate truth table", false},
+		{"show disk usage", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsFollowUp(tt.input); got != tt.expected {
+			t.Errorf("IsFollowUp(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestConversation(t *testing.T) {
+	conversation := NewConversation(2)
+
+	if !conversation.IsEmpty() {
+		t.Error("Expected new conversation to be empty")
+	}
+
+	conversation.Add("list files", "ls")
+	conversation.Add("show hidden files", "ls -a")
+	conversation.SetLastCommand("ls -la")
+	conversation.Add("sort by size", "ls -laS")
+
+	turns := conversation.Turns()
+	if len(turns) != 2 {
+		t.Fatalf("Expected 2 turns after exceeding limit, got %d", len(turns))
+	}
+
+	if turns[0].Command != "ls -la" {
+		t.Errorf("Expected updated command 'ls -la', got '%s'", turns[0].Command)
+	}
+
+	formatted := conversation.FormatForPrompt()
+	if !strings.Contains(formatted, "sort by size") || strings.Contains(formatted, "list files") {
+		t.Errorf("Unexpected formatted conversation: %s", formatted)
+	}
+
+	conversation.Reset()
+	if !conversation.IsEmpty() {
+		t.Error("Expected conversation to be empty after reset")
+	}
+}
+
+func TestPromptBuilderFollowUp(t *testing.T) {
+	builder := NewPromptBuilder()
+	builder.GetConversation().Add("find go files", "find . -name '*.go'")
+
+	prompt, err := builder.BuildCommandPrompt(context.Background(), "now make it case insensitive")
+	if err != nil {
+		t.Fatalf("BuildCommandPrompt failed: %v", err)
+	}
+
+	if !strings.Contains(prompt, "PREVIOUS CONVERSATION") || !strings.Contains(prompt, "find . -name '*.go'") {
+		t.Error("Expected follow-up prompt to include previous conversation")
+	}
+
+	prompt, _ = builder.BuildCommandPrompt(context.Background(), "show disk usage")
+	if strings.Contains(prompt, "PREVIOUS CONVERSATION") {
+		t.Error("Expected independent request to omit previous conversation")
+	}
+}
+
+func TestRequestTemplate(t *testing.T) {
+	template := RequestTemplate{
+		Name:    "deploy",
+		Pattern: "deploy {{service}} to {{env}}",
+		Prompt:  "Deploy {{service}} with kubectl using the {{env}} context",
+	}
+	if err := template.Validate(); err != nil {
+		t.Fatalf("Expected a valid template, got %v", err)
+	}
+
+	match, ok := template.Match("Deploy  api server to prod")
+	if !ok {
+		t.Fatal("Expected the request to match the template")
+	}
+	if match.Variables["service"] != "api server" || match.Variables["env"] != "prod" {
+		t.Errorf("Unexpected variables: %v", match.Variables)
+	}
+	if match.FormatVariables() != "service=api server, env=prod" {
+		t.Errorf("Unexpected formatted variables: %q", match.FormatVariables())
+	}
+
+	for _, input := range []string{"deploy to prod", "please deploy api to prod", "deploy api to"} {
+		if _, ok := template.Match(input); ok {
+			t.Errorf("Expected %q not to match", input)
+		}
+	}
+
+	// /run fills in the same template from name=value arguments
+	variables, err := ParseTemplateArgs([]string{"service=web", "env=staging"})
+	if err != nil {
+		t.Fatalf("ParseTemplateArgs failed: %v", err)
+	}
+	filled, err := template.Fill(variables)
+	if err != nil {
+		t.Fatalf("Fill failed: %v", err)
+	}
+	if filled.Request() != "deploy web to staging" {
+		t.Errorf("Unexpected filled request: %q", filled.Request())
+	}
+	if _, err := template.Fill(map[string]string{"service": "web"}); err == nil || !strings.Contains(err.Error(), "env") {
+		t.Errorf("Expected an error naming the missing variable, got %v", err)
+	}
+	if _, err := ParseTemplateArgs([]string{"staging"}); err == nil {
+		t.Error("Expected arguments without '=' to be rejected")
+	}
+
+	invalid := []RequestTemplate{
+		{Name: "", Pattern: "deploy to {{env}}"},
+		{Name: "only", Pattern: "{{env}}"},
+		{Name: "unknown", Pattern: "deploy to {{env}}", Prompt: "deploy to {{region}}"},
+	}
+	for _, template := range invalid {
+		if err := template.Validate(); err == nil {
+			t.Errorf("Expected template %+v to be invalid", template)
+		}
+	}
+}
+
+func TestPromptBuilderTemplates(t *testing.T) {
+	builder := NewPromptBuilder().SetRequestTemplates([]RequestTemplate{
+		{Name: "deploy", Pattern: "deploy to {{env}}", Prompt: "Run ./scripts/deploy.sh {{env}} after the tests pass"},
+	})
+
+	prompt, err := builder.BuildCommandPrompt(context.Background(), "deploy to prod")
+	if err != nil {
+		t.Fatalf("BuildCommandPrompt failed: %v", err)
+	}
+	if !strings.Contains(prompt, "Run ./scripts/deploy.sh prod after the tests pass") || !strings.Contains(prompt, "Parameters: env=prod") {
+		t.Errorf("Expected the template instructions in the prompt, got:\n%s", prompt)
+	}
+
+	if _, ok := builder.FindTemplate("DEPLOY"); !ok {
+		t.Error("Expected templates to be found by name regardless of case")
+	}
+	if _, ok := builder.MatchTemplate("show disk usage"); ok {
+		t.Error("Expected unrelated requests not to match a template")
+	}
+}
+
+func TestTruncateForContext(t *testing.T) {
+	short := "line one\nline two"
+	if got := TruncateForContext(short, 100); got != short {
+		t.Errorf("Expected short text unchanged, got %q", got)
+	}
+
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("log line %d", i))
+	}
+	truncated := TruncateForContext(strings.Join(lines, "\n"), 500)
+
+	if len(truncated) > 550 {
+		t.Errorf("Expected truncated text near 500 characters, got %d", len(truncated))
+	}
+	if !strings.HasPrefix(truncated, "log line 0\n") || !strings.HasSuffix(truncated, "log line 999") {
+		t.Error("Expected the first and last lines to be kept")
+	}
+	if !strings.Contains(truncated, "lines omitted") {
+		t.Error("Expected an omission marker")
+	}
+
+	long := strings.Repeat("x", 2000)
+	if got := TruncateForContext(long, 100); len(got) > 130 || !strings.Contains(got, "truncated") {
+		t.Errorf("Expected a single long line to be cut, got %d characters", len(got))
+	}
+
+	prompt := OutputSummaryPrompt("make", strings.Repeat("error: missing file\n", 2000))
+	if len(prompt) > 8000 {
+		t.Errorf("Expected summary prompt to fit the prompt limit, got %d characters", len(prompt))
+	}
+}
@@ -0,0 +1,165 @@
+package prompt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// templateVarPattern matches {{variable}} placeholders in request templates
+var templateVarPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// whitespacePattern matches runs of whitespace in template text
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+// RequestTemplate is a parameterized request such as "deploy to {{env}}".
+// Requests matching Pattern are sent to the AI with Prompt filled in.
+type RequestTemplate struct {
+	Name    string
+	Pattern string // Request with {{variable}} placeholders
+	Prompt  string // Fuller instructions for the AI; optional
+}
+
+// TemplateMatch is a request template with its variables filled in
+type TemplateMatch struct {
+	Template  RequestTemplate
+	Variables map[string]string
+}
+
+// Variables returns the variable names of the template in order of appearance
+func (t RequestTemplate) Variables() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range templateVarPattern.FindAllStringSubmatch(t.Pattern, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// Validate checks that the template can be matched and filled in
+func (t RequestTemplate) Validate() error {
+	if t.Name == "" || strings.ContainsAny(t.Name, " \t\n") {
+		return fmt.Errorf("template name %q must be a single word", t.Name)
+	}
+	if strings.TrimSpace(templateVarPattern.ReplaceAllString(t.Pattern, "")) == "" {
+		return fmt.Errorf("template %s: pattern needs text besides variables", t.Name)
+	}
+
+	variables := make(map[string]bool)
+	for _, name := range t.Variables() {
+		variables[name] = true
+	}
+	for _, match := range templateVarPattern.FindAllStringSubmatch(t.Prompt, -1) {
+		if !variables[match[1]] {
+			return fmt.Errorf("template %s: prompt uses {{%s}}, which is not in the pattern", t.Name, match[1])
+		}
+	}
+	return nil
+}
+
+// Match extracts the template variables from input if it follows the pattern.
+// Literal text is matched case-insensitively and with any amount of whitespace.
+func (t RequestTemplate) Match(input string) (*TemplateMatch, bool) {
+	var expr strings.Builder
+	var names []string
+	expr.WriteString(`(?i)^`)
+
+	last := 0
+	for _, loc := range templateVarPattern.FindAllStringSubmatchIndex(t.Pattern, -1) {
+		expr.WriteString(literalPattern(t.Pattern[last:loc[0]]))
+		expr.WriteString(`(.+?)`)
+		names = append(names, t.Pattern[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	expr.WriteString(literalPattern(t.Pattern[last:]))
+	expr.WriteString(`$`)
+
+	groups := regexp.MustCompile(expr.String()).FindStringSubmatch(strings.TrimSpace(input))
+	if groups == nil {
+		return nil, false
+	}
+
+	variables := make(map[string]string)
+	for i, name := range names {
+		value := strings.TrimSpace(groups[i+1])
+		if previous, ok := variables[name]; ok && !strings.EqualFold(previous, value) {
+			return nil, false
+		}
+		variables[name] = value
+	}
+	return &TemplateMatch{Template: t, Variables: variables}, true
+}
+
+// Fill fills in the template with variables, e.g. from `/run deploy env=prod`
+func (t RequestTemplate) Fill(variables map[string]string) (*TemplateMatch, error) {
+	var missing []string
+	for _, name := range t.Variables() {
+		if variables[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing value for %s", strings.Join(missing, ", "))
+	}
+	return &TemplateMatch{Template: t, Variables: variables}, nil
+}
+
+// literalPattern returns a regular expression matching text literally,
+// allowing any run of whitespace where text has whitespace
+func literalPattern(text string) string {
+	parts := whitespacePattern.Split(text, -1)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return strings.Join(parts, `\s+`)
+}
+
+// Request returns the pattern with the variables filled in, e.g. "deploy to prod"
+func (m *TemplateMatch) Request() string {
+	return m.substitute(m.Template.Pattern)
+}
+
+// FormatVariables returns the variables as "name=value" pairs in pattern order
+func (m *TemplateMatch) FormatVariables() string {
+	var pairs []string
+	for _, name := range m.Template.Variables() {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, m.Variables[name]))
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// FormatForPrompt describes the request with the template instructions for the AI
+func (m *TemplateMatch) FormatForPrompt() string {
+	parts := []string{m.Request()}
+	if m.Template.Prompt != "" {
+		parts = append(parts, fmt.Sprintf("This is the %q task: %s", m.Template.Name, m.substitute(m.Template.Prompt)))
+	}
+	if variables := m.FormatVariables(); variables != "" {
+		parts = append(parts, "Parameters: "+variables)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// substitute replaces the {{variable}} placeholders in text
+func (m *TemplateMatch) substitute(text string) string {
+	return templateVarPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := templateVarPattern.FindStringSubmatch(placeholder)[1]
+		return m.Variables[name]
+	})
+}
+
+// ParseTemplateArgs parses `name=value` arguments of /run
+func ParseTemplateArgs(args []string) (map[string]string, error) {
+	variables := make(map[string]string)
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected name=value, got %q", arg)
+		}
+		variables[name] = value
+	}
+	return variables, nil
+}
@@ -48,6 +48,7 @@ type CommandPromptTemplate struct {
 	SystemPrompt string
 	Context      *Context
 	UserInput    string
+	History      string // Previous exchanges for follow-up requests
 }
 
 // NewCommandPromptTemplate creates a new command prompt template
@@ -72,6 +73,13 @@ func (t *CommandPromptTemplate) Build() string {
 		parts = append(parts, t.Context.FormatForPrompt())
 	}
 
+	// Add previous exchanges so follow-ups like "now make it recursive" can be resolved
+	if t.History != "" {
+		parts = append(parts, "\nPREVIOUS CONVERSATION:")
+		parts = append(parts, t.History)
+		parts = append(parts, "The user request below refines the most recent command above.")
+	}
+
 	// Add user request
 	parts = append(parts, "\nUSER REQUEST:")
 	parts = append(parts, t.UserInput)
@@ -193,3 +201,93 @@ Respond with JSON format:
 {"commands":[{"cmd":"command here","description":"what it does","confidence":0.9,"safe":true,"category":"category"}]}`,
 		userInput, os, shell)
 }
+
+// ReformatPrompt asks the model to restate an answer that was not in the
+// required JSON format, so answers of weaker models can still be used
+func ReformatPrompt(previousAnswer string) string {
+	return fmt.Sprintf(`Reformat your previous answer as the required JSON. Keep the same commands and
+descriptions, and reply with only the JSON, without explanations or markdown:
+{"commands":[{"cmd":"command here","description":"what it does","confidence":0.9,"safe":true,"category":"category"}]}
+
+Previous answer:
+%s`,
+		TruncateForContext(strings.TrimSpace(previousAnswer), MaxOutputContextChars))
+}
+
+// QuestionPrompt asks for a plain-text answer to a general question, e.g. about
+// the difference between two flags, instead of suggesting commands
+func QuestionPrompt(question string, os, shell string) string {
+	return fmt.Sprintf(`Answer the question below for a user working in a terminal.
+Be concise and accurate, and show short examples where they help. Reply in plain
+text, not JSON; do not format the answer as command suggestions.
+
+Operating System: %s
+Shell: %s
+
+Question: %s`,
+		os, shell, question)
+}
+
+// MaxOutputContextChars limits how much command output is included in a prompt
+const MaxOutputContextChars = 6000
+
+// OutputSummaryPrompt asks for a concise summary of the output of command
+func OutputSummaryPrompt(command, output string) string {
+	return fmt.Sprintf(`Summarize the output of the shell command below for the user in at most 3 short sentences.
+Focus on errors, warnings and the key results, grouping similar lines
+(e.g. "3 errors, all about missing permissions in /var/log"). Reply in plain text, not JSON.
+
+Command: %s
+
+Output:
+%s`,
+		command, TruncateForContext(output, MaxOutputContextChars))
+}
+
+// TruncateForContext shortens text to about maxChars characters, keeping the
+// beginning and the end (where errors and summaries usually are) and noting
+// how many lines were left out
+func TruncateForContext(text string, maxChars int) string {
+	if len(text) <= maxChars {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	budget := maxChars / 2
+
+	var head []string
+	used := 0
+	for _, line := range lines {
+		if used+len(line)+1 > budget {
+			break
+		}
+		head = append(head, line)
+		used += len(line) + 1
+	}
+
+	var tail []string
+	used = 0
+	for i := len(lines) - 1; i >= len(head); i-- {
+		if used+len(lines[i])+1 > budget {
+			break
+		}
+		tail = append([]string{lines[i]}, tail...)
+		used += len(lines[i]) + 1
+	}
+
+	omitted := len(lines) - len(head) - len(tail)
+	if omitted == 0 {
+		return text
+	}
+	if len(head) == 0 && len(tail) == 0 {
+		// A few very long lines: cut by characters instead
+		runes := []rune(text)
+		if len(runes) <= maxChars {
+			return text
+		}
+		return string(runes[:budget]) + "\n... (truncated) ...\n" + string(runes[len(runes)-budget:])
+	}
+
+	parts := append(head, fmt.Sprintf("... (%d lines omitted) ...", omitted))
+	return strings.Join(append(parts, tail...), "\n")
+}
@@ -0,0 +1,177 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/lipgloss"
+	"gopkg.in/yaml.v3"
+)
+
+// OutputRenderer formats command output in a format it recognizes, such as JSON
+type OutputRenderer interface {
+	// Format names the format, e.g. "JSON"
+	Format() string
+	// Detect reports whether output is in the format
+	Detect(output string) bool
+	// Render returns output indented and highlighted
+	Render(output string) (string, error)
+}
+
+// outputRenderers are tried in order by RenderOutput; JSON comes before YAML,
+// which JSON documents are too
+var outputRenderers = []OutputRenderer{JSONRenderer{}, YAMLRenderer{}}
+
+// RegisterOutputRenderer adds a renderer for another format, tried after the
+// ones already registered
+func RegisterOutputRenderer(r OutputRenderer) {
+	outputRenderers = append(outputRenderers, r)
+}
+
+// DetectOutputFormat returns the renderer for the format of output, or nil if
+// no renderer recognizes it
+func DetectOutputFormat(output string) OutputRenderer {
+	if strings.TrimSpace(output) == "" {
+		return nil
+	}
+	for _, r := range outputRenderers {
+		if r.Detect(output) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Highlighting of formatted output
+var (
+	keyStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("39"))  // Blue
+	stringStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("114")) // Green
+	literalStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("215")) // Orange: numbers, booleans, null
+	commentStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("243")) // Gray
+)
+
+// JSONRenderer formats a JSON object or array
+type JSONRenderer struct{}
+
+// Format returns "JSON"
+func (JSONRenderer) Format() string { return "JSON" }
+
+// Detect reports whether output is a single JSON object or array; plain
+// numbers and strings are valid JSON too, but are left alone
+func (JSONRenderer) Detect(output string) bool {
+	trimmed := strings.TrimSpace(output)
+	return (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed))
+}
+
+// Render indents output by two spaces and highlights keys and values
+func (JSONRenderer) Render(output string) (string, error) {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(strings.TrimSpace(output)), "", "  "); err != nil {
+		return "", err
+	}
+	return highlightJSON(indented.String()), nil
+}
+
+// highlightJSON colors the keys, strings and literals of indented JSON
+func highlightJSON(text string) string {
+	var out strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(runes))
+			token := string(runes[i:end])
+
+			next := end
+			for next < len(runes) && runes[next] == ' ' {
+				next++
+			}
+			if next < len(runes) && runes[next] == ':' {
+				out.WriteString(keyStyle.Render(token))
+			} else {
+				out.WriteString(stringStyle.Render(token))
+			}
+			i = end
+		case r == '-' || unicode.IsDigit(r) || unicode.IsLetter(r):
+			end := i
+			for end < len(runes) && !strings.ContainsRune(",]}\n ", runes[end]) {
+				end++
+			}
+			out.WriteString(literalStyle.Render(string(runes[i:end])))
+			i = end
+		default:
+			out.WriteRune(r)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// YAMLRenderer formats a YAML mapping or sequence
+type YAMLRenderer struct{}
+
+// Format returns "YAML"
+func (YAMLRenderer) Format() string { return "YAML" }
+
+// Detect reports whether output is a YAML mapping or sequence of several
+// lines; a single "key: value" line is more likely plain text
+func (YAMLRenderer) Detect(output string) bool {
+	trimmed := strings.TrimSpace(output)
+	if !strings.Contains(trimmed, "\n") {
+		return false
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(trimmed), &doc); err != nil || len(doc.Content) == 0 {
+		return false
+	}
+	kind := doc.Content[0].Kind
+	return kind == yaml.MappingNode || kind == yaml.SequenceNode
+}
+
+// Render re-indents output by two spaces, keeping comments, and highlights keys
+func (YAMLRenderer) Render(output string) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.TrimSpace(output)), &doc); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return highlightYAML(strings.TrimRight(buf.String(), "\n")), nil
+}
+
+// yamlKeyPattern matches the indentation, list marker and key of a YAML line
+var yamlKeyPattern = regexp.MustCompile(`^(\s*(?:- )*)([^\s#:-][^:]*?|"[^"]*"|'[^']*')(:)(\s|$)`)
+
+// highlightYAML colors the keys and comments of YAML, line by line
+func highlightYAML(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "#") {
+			lines[i] = commentStyle.Render(line)
+			continue
+		}
+		if m := yamlKeyPattern.FindStringSubmatchIndex(line); m != nil {
+			lines[i] = line[:m[3]] + keyStyle.Render(line[m[4]:m[5]]) + line[m[5]:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
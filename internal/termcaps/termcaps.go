@@ -0,0 +1,200 @@
+// Package termcaps detects what the terminal clia runs in can show: how many
+// colors, whether emoji render, and how to reach the clipboard. The UI
+// consults it so clia looks right without configuration; the ui section of
+// the config can override each detected value.
+package termcaps
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// ColorLevel is the number of colors the terminal supports
+type ColorLevel int
+
+const (
+	ColorNone      ColorLevel = iota // No colors
+	ColorBasic                       // The 16 ANSI colors
+	Color256                         // The xterm 256-color palette
+	ColorTrueColor                   // 24-bit colors
+)
+
+// String returns the config name of the level
+func (l ColorLevel) String() string {
+	switch l {
+	case ColorNone:
+		return "none"
+	case ColorBasic:
+		return "16"
+	case Color256:
+		return "256"
+	default:
+		return "truecolor"
+	}
+}
+
+// ClipboardMethod is how text is copied to the clipboard
+type ClipboardMethod string
+
+const (
+	ClipboardNative ClipboardMethod = "native" // The clipboard tool of the system (pbcopy, xclip, wl-copy, ...)
+	ClipboardOSC52  ClipboardMethod = "osc52"  // An OSC 52 sequence asking the terminal to copy
+	ClipboardBoth   ClipboardMethod = "both"   // Both, for when it is unclear which one works
+)
+
+// Caps are the capabilities of a terminal
+type Caps struct {
+	Color     ColorLevel
+	Emoji     bool            // Emoji render; ASCII replacements are used if not
+	Clipboard ClipboardMethod // How to copy to the clipboard
+	SSH       bool            // Running in an SSH session
+	ColorSet  bool            // Color comes from the config rather than detection
+}
+
+// Settings are the overrides of the ui config; empty or "auto" keeps the detected value
+type Settings struct {
+	Colors    string // "truecolor", "256", "16" or "none"
+	Emoji     string // "on" or "off"
+	Clipboard string // "native", "osc52" or "both"
+}
+
+// Detect returns the capabilities of the terminal described by the environment
+func Detect() Caps {
+	return detect(os.Getenv, runtime.GOOS)
+}
+
+func detect(getenv func(string) string, goos string) Caps {
+	term := strings.ToLower(getenv("TERM"))
+	caps := Caps{
+		SSH: getenv("SSH_CONNECTION") != "" || getenv("SSH_CLIENT") != "" || getenv("SSH_TTY") != "",
+	}
+
+	colorTerm := strings.ToLower(getenv("COLORTERM"))
+	switch {
+	case getenv("NO_COLOR") != "" || term == "dumb":
+		caps.Color = ColorNone
+	case colorTerm == "truecolor" || colorTerm == "24bit":
+		caps.Color = ColorTrueColor
+	case strings.Contains(term, "256color"):
+		caps.Color = Color256
+	case term == "":
+		// The Windows console does not set TERM but Windows Terminal does 24-bit colors
+		switch {
+		case getenv("WT_SESSION") != "":
+			caps.Color = ColorTrueColor
+		case goos == "windows":
+			caps.Color = ColorBasic
+		default:
+			caps.Color = ColorNone
+		}
+	default:
+		caps.Color = ColorBasic
+	}
+
+	caps.Emoji = emojiSupported(getenv, term, goos)
+
+	switch {
+	case term == "dumb":
+		// Escape sequences would show up as text
+		caps.Clipboard = ClipboardNative
+	case caps.SSH:
+		// The system clipboard is the one of the remote machine
+		caps.Clipboard = ClipboardOSC52
+	default:
+		caps.Clipboard = ClipboardBoth
+	}
+	return caps
+}
+
+// emojiSupported reports whether the terminal and locale can show emoji. The
+// Linux console and serial terminals lack the glyphs, and a locale that is not
+// UTF-8 cannot encode them.
+func emojiSupported(getenv func(string) string, term, goos string) bool {
+	if term == "dumb" || term == "linux" || strings.HasPrefix(term, "vt") {
+		return false
+	}
+	if goos == "windows" {
+		return getenv("WT_SESSION") != ""
+	}
+
+	// The first locale variable set decides, as for setlocale
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale := strings.ToLower(getenv(name)); locale != "" {
+			return strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8")
+		}
+	}
+	return true
+}
+
+// Validate checks that the settings are known values
+func (s Settings) Validate() error {
+	_, err := Caps{}.Override(s)
+	return err
+}
+
+// Override returns the capabilities with the settings applied
+func (c Caps) Override(s Settings) (Caps, error) {
+	switch strings.ToLower(s.Colors) {
+	case "", "auto":
+	case "truecolor", "24bit":
+		c.Color, c.ColorSet = ColorTrueColor, true
+	case "256":
+		c.Color, c.ColorSet = Color256, true
+	case "16", "basic":
+		c.Color, c.ColorSet = ColorBasic, true
+	case "none", "off":
+		c.Color, c.ColorSet = ColorNone, true
+	default:
+		return c, fmt.Errorf("colors must be auto, truecolor, 256, 16 or none, got %q", s.Colors)
+	}
+
+	switch strings.ToLower(s.Emoji) {
+	case "", "auto":
+	case "on", "true", "yes":
+		c.Emoji = true
+	case "off", "false", "no":
+		c.Emoji = false
+	default:
+		return c, fmt.Errorf("emoji must be auto, on or off, got %q", s.Emoji)
+	}
+
+	switch method := ClipboardMethod(strings.ToLower(s.Clipboard)); method {
+	case "", "auto":
+	case ClipboardNative, ClipboardOSC52, ClipboardBoth:
+		c.Clipboard = method
+	default:
+		return c, fmt.Errorf("clipboard must be auto, native, osc52 or both, got %q", s.Clipboard)
+	}
+	return c, nil
+}
+
+// asciiIcons replaces the emoji and symbols clia prints most with ASCII;
+// any other emoji becomes "*"
+var asciiIcons = strings.NewReplacer(
+	"\ufe0f", "",
+	"⚠", "!",
+	"✅", "[ok]", "✓", "[ok]",
+	"❌", "[x]", "✗", "[x]",
+	"❓", "?",
+	"❯", ">", "▸", ">", "→", "->", "•", "-",
+)
+
+// Text returns s with emoji replaced by ASCII if the terminal cannot show them
+func (c Caps) Text(s string) string {
+	if c.Emoji {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if isEmoji(r) {
+			return '*'
+		}
+		return r
+	}, asciiIcons.Replace(s))
+}
+
+// isEmoji reports whether r is in one of the pictograph blocks
+func isEmoji(r rune) bool {
+	return (r >= 0x1f300 && r <= 0x1faff) || (r >= 0x2600 && r <= 0x27bf) || (r >= 0x2300 && r <= 0x23ff)
+}
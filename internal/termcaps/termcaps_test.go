@@ -0,0 +1,77 @@
+package termcaps
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		goos      string
+		color     ColorLevel
+		emoji     bool
+		clipboard ClipboardMethod
+	}{
+		{"truecolor", map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor", "LANG": "en_US.UTF-8"}, "linux", ColorTrueColor, true, ClipboardBoth},
+		{"256 colors", map[string]string{"TERM": "screen-256color"}, "darwin", Color256, true, ClipboardBoth},
+		{"basic", map[string]string{"TERM": "xterm"}, "linux", ColorBasic, true, ClipboardBoth},
+		{"NO_COLOR", map[string]string{"TERM": "xterm-256color", "NO_COLOR": "1"}, "linux", ColorNone, true, ClipboardBoth},
+		{"dumb", map[string]string{"TERM": "dumb"}, "linux", ColorNone, false, ClipboardNative},
+		{"linux console", map[string]string{"TERM": "linux"}, "linux", ColorBasic, false, ClipboardBoth},
+		{"no UTF-8", map[string]string{"TERM": "xterm", "LANG": "en_US.UTF-8", "LC_ALL": "C"}, "linux", ColorBasic, false, ClipboardBoth},
+		{"SSH", map[string]string{"TERM": "xterm-256color", "SSH_CONNECTION": "10.0.0.1 22 10.0.0.2 22"}, "linux", Color256, true, ClipboardOSC52},
+		{"no TERM", map[string]string{}, "linux", ColorNone, true, ClipboardBoth},
+		{"Windows console", map[string]string{}, "windows", ColorBasic, false, ClipboardBoth},
+		{"Windows Terminal", map[string]string{"WT_SESSION": "1"}, "windows", ColorTrueColor, true, ClipboardBoth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caps := detect(func(name string) string { return tt.env[name] }, tt.goos)
+			if caps.Color != tt.color {
+				t.Errorf("Expected %s colors, got %s", tt.color, caps.Color)
+			}
+			if caps.Emoji != tt.emoji {
+				t.Errorf("Expected emoji %v, got %v", tt.emoji, caps.Emoji)
+			}
+			if caps.Clipboard != tt.clipboard {
+				t.Errorf("Expected clipboard %s, got %s", tt.clipboard, caps.Clipboard)
+			}
+			if caps.ColorSet {
+				t.Error("Detected colors must not count as set by the config")
+			}
+		})
+	}
+}
+
+func TestOverride(t *testing.T) {
+	detected := Caps{Color: Color256, Emoji: true, Clipboard: ClipboardOSC52, SSH: true}
+
+	caps, err := detected.Override(Settings{Colors: "auto", Emoji: "", Clipboard: "auto"})
+	if err != nil || caps != detected {
+		t.Errorf("Expected auto to keep the detected values, got %+v, %v", caps, err)
+	}
+
+	caps, err = detected.Override(Settings{Colors: "none", Emoji: "off", Clipboard: "native"})
+	if err != nil {
+		t.Fatalf("Override failed: %v", err)
+	}
+	if caps.Color != ColorNone || !caps.ColorSet || caps.Emoji || caps.Clipboard != ClipboardNative {
+		t.Errorf("Expected the settings applied, got %+v", caps)
+	}
+
+	for _, settings := range []Settings{{Colors: "lots"}, {Emoji: "maybe"}, {Clipboard: "fax"}} {
+		if err := settings.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", settings)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	text := "⚠️ Failed ❌ • see 💡 hint ✓"
+	if got := (Caps{Emoji: true}).Text(text); got != text {
+		t.Errorf("Expected emoji kept, got %q", got)
+	}
+	if got := (Caps{}).Text(text); got != "! Failed [x] - see * hint [ok]" {
+		t.Errorf("Expected ASCII symbols, got %q", got)
+	}
+}
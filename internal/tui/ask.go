@@ -0,0 +1,103 @@
+package tui
+
+import (
+	"context"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// askAnswerPrefix starts the message the answer of /ask streams into
+const askAnswerPrefix = "💬 "
+
+// handleAskCommand sends a general question to the model and streams the
+// plain-text answer into the history; nothing is suggested or executed
+func (m *Model) handleAskCommand(args []string) tea.Cmd {
+	question := strings.TrimSpace(strings.Join(args, " "))
+	switch {
+	case question == "":
+		m.addMessage("Usage: /ask <question>, e.g. /ask what's the difference between tar -c and -x", MessageTypeError)
+		return nil
+	case m.aiService == nil:
+		m.addMessage("❌ AI service not available", MessageTypeError)
+		return nil
+	case m.aiService.IsOffline():
+		m.addMessage("📴 Answering questions needs an AI provider. Turn offline mode off with /offline off", MessageTypeError)
+		return nil
+	case m.processing:
+		return nil
+	}
+
+	m.input.SetValue("")
+	m.processing = true
+	m.showSpinner = true
+	m.status = "Answering..."
+	m.addMessage("❓ "+question, MessageTypeUser)
+	m.addMessage(askAnswerPrefix, MessageTypeAssistant)
+	m.askIndex = len(m.messages) - 1
+
+	events := make(chan askEventMsg, 64)
+	aiService := m.aiService
+	go func() {
+		defer close(events)
+		response, err := aiService.Ask(context.Background(), question, func(chunk string) {
+			events <- askEventMsg{chunk: chunk}
+		})
+		events <- askEventMsg{done: true, response: response, error: err}
+	}()
+	m.askEvents = events
+
+	return tea.Batch(waitForAskEvent(events), m.spinner.TickCmd())
+}
+
+// waitForAskEvent waits for the next piece of the streamed answer
+func waitForAskEvent(events <-chan askEventMsg) tea.Cmd {
+	return func() tea.Msg {
+		event, ok := <-events
+		if !ok {
+			return askEventMsg{done: true}
+		}
+		return event
+	}
+}
+
+// handleAskEvent adds a piece of the answer to its message, or finishes the answer
+func (m *Model) handleAskEvent(msg askEventMsg) tea.Cmd {
+	if m.askEvents == nil {
+		return nil
+	}
+
+	answer := m.askIndex
+	if answer >= len(m.messages) {
+		answer = -1
+	}
+	if !msg.done {
+		if answer >= 0 {
+			// A buffered answer is shown once complete, saving a redraw per chunk
+			m.messages[answer].Content += msg.chunk
+			if !m.bufferAnswers {
+				m.updateViewportContent()
+			}
+		}
+		return waitForAskEvent(m.askEvents)
+	}
+
+	m.askEvents = nil
+	m.askIndex = -1
+	m.processing = false
+	m.showSpinner = false
+	m.status = "Ready - " + m.currentProvider + " • " + m.currentModel
+
+	switch {
+	case msg.error != nil:
+		if answer == len(m.messages)-1 && m.messages[answer].Content == askAnswerPrefix {
+			m.removeLastMessage() // Nothing was answered
+		}
+		m.addMessage("❌ "+msg.error.Error(), MessageTypeError)
+	case msg.response != nil && msg.response.Truncated:
+		m.addMessage("⚠️  The answer was cut off by the token limit", MessageTypeError)
+	default:
+		m.updateViewportContent()
+	}
+	return nil
+}
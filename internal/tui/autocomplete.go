@@ -0,0 +1,141 @@
+package tui
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/yourusername/clia/pkg/memory"
+)
+
+const (
+	autocompleteDelay      = 150 * time.Millisecond // Typing pause before memory is searched
+	autocompleteMinChars   = 3                      // Shorter input matches too much to be useful
+	autocompleteMaxResults = 5
+)
+
+var (
+	autocompleteStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("243")).
+				Padding(0, 2)
+
+	autocompleteSelectedStyle = lipgloss.NewStyle().
+					Foreground(lipgloss.Color("86")).
+					Bold(true)
+)
+
+// scheduleAutocomplete starts the debounce timer for the current input. Each
+// call invalidates earlier timers, so memory is only searched once typing pauses.
+func (m *Model) scheduleAutocomplete() tea.Cmd {
+	m.autocompleteSeq++
+	m.clearAutocomplete()
+
+	query := strings.TrimSpace(m.input.Value())
+	if !m.canAutocomplete(query) {
+		return nil
+	}
+
+	seq := m.autocompleteSeq
+	return tea.Tick(autocompleteDelay, func(time.Time) tea.Msg {
+		return autocompleteTickMsg{seq: seq, query: query}
+	})
+}
+
+// canAutocomplete reports whether past requests should be suggested for query
+func (m *Model) canAutocomplete(query string) bool {
+	if !m.memoryActive() || len([]rune(query)) < autocompleteMinChars {
+		return false
+	}
+	if strings.HasPrefix(query, "/") || strings.HasPrefix(query, "!") {
+		return false
+	}
+	return !m.inEditMode && !m.inConfirmationMode && !m.inStdinMode && !m.inPromptMode && !m.waitingAPIKey && !m.onboarding
+}
+
+// handleAutocompleteTick searches memory once the input has been stable for the debounce delay
+func (m *Model) handleAutocompleteTick(msg autocompleteTickMsg) tea.Cmd {
+	if msg.seq != m.autocompleteSeq {
+		return nil
+	}
+
+	manager := m.memoryManager
+	return func() tea.Msg {
+		options := memory.DefaultSearchOptions()
+		options.MaxResults = autocompleteMaxResults * 2 // Room for duplicate requests
+
+		results, err := manager.Search(msg.query, options)
+		if err != nil {
+			log.Printf("Memory autocomplete failed: %v", err)
+		}
+		return autocompleteResultsMsg{seq: msg.seq, query: msg.query, results: results}
+	}
+}
+
+// handleAutocompleteResults shows the past requests matching the input
+func (m *Model) handleAutocompleteResults(msg autocompleteResultsMsg) {
+	if msg.seq != m.autocompleteSeq {
+		return
+	}
+
+	m.autocomplete = nil
+	m.autocompleteIndex = -1
+	seen := map[string]bool{strings.ToLower(msg.query): true}
+	for _, result := range msg.results {
+		key := strings.ToLower(strings.TrimSpace(result.Entry.UserRequest))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		m.autocomplete = append(m.autocomplete, result.Entry)
+		if len(m.autocomplete) == autocompleteMaxResults {
+			break
+		}
+	}
+}
+
+// moveAutocomplete moves the highlighted past request by delta, wrapping around
+func (m *Model) moveAutocomplete(delta int) {
+	count := len(m.autocomplete)
+	m.autocompleteIndex = ((m.autocompleteIndex+delta)%count + count) % count
+}
+
+// acceptAutocomplete puts the highlighted (or first) past request into the input
+func (m *Model) acceptAutocomplete() {
+	index := max(m.autocompleteIndex, 0)
+	m.input.SetValue(m.autocomplete[index].UserRequest)
+	m.input.CursorEnd()
+	m.autocompleteSeq++
+	m.clearAutocomplete()
+}
+
+// clearAutocomplete hides the dropdown
+func (m *Model) clearAutocomplete() {
+	m.autocomplete = nil
+	m.autocompleteIndex = -1
+}
+
+// renderAutocomplete renders the dropdown of past requests shown under the input
+func (m Model) renderAutocomplete() string {
+	if len(m.autocomplete) == 0 {
+		return ""
+	}
+
+	var lines []string
+	for i, entry := range m.autocomplete {
+		line := fmt.Sprintf("💭 %s → %s", entry.UserRequest, entry.SelectedCommand)
+		if i == m.autocompleteIndex {
+			line = autocompleteSelectedStyle.Render("▸ " + line)
+		} else {
+			line = "  " + line
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "  Tab to accept • ↑/↓ to choose • Esc to dismiss")
+
+	return autocompleteStyle.Width(m.width).Render(strings.Join(lines, "\n"))
+}
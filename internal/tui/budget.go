@@ -0,0 +1,45 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/yourusername/clia/internal/ai"
+)
+
+// budgetTipMsg carries the free model recommended once the budget is spent
+type budgetTipMsg struct {
+	alternative ai.ModelInfo
+	found       bool
+}
+
+// budgetTip looks up a free model to switch to when err says the budget of
+// the session is spent
+func (m *Model) budgetTip(err error) tea.Cmd {
+	if !errors.Is(err, ai.ErrBudgetExceeded) || m.aiService == nil {
+		return nil
+	}
+
+	model := m.currentModel
+	aiService := m.aiService
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), aiService.GetTimeout())
+		defer cancel()
+
+		models, err := aiService.GetAvailableModels(ctx)
+		if err != nil {
+			return budgetTipMsg{}
+		}
+		alternative, found := ai.RecommendFreeModel(model, models)
+		return budgetTipMsg{alternative: alternative, found: found}
+	}
+}
+
+// handleBudgetTip offers the free model found for a spent budget
+func (m *Model) handleBudgetTip(msg budgetTipMsg) {
+	if msg.found {
+		m.addMessage(fmt.Sprintf("💡 %s is free: /model %s switches to it", msg.alternative.ID, msg.alternative.ID), MessageTypeSystem)
+	}
+}
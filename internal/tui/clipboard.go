@@ -0,0 +1,87 @@
+package tui
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/atotto/clipboard"
+
+	"github.com/yourusername/clia/internal/termcaps"
+)
+
+// writeNativeClipboard copies text with the clipboard tool of the system
+// (pbcopy, xclip, wl-copy, ...); replaced in tests
+var writeNativeClipboard = clipboard.WriteAll
+
+// CopyToClipboard copies text to the clipboard with the method of the
+// terminal, see ConfigureTerminal. The system clipboard tool copies it
+// locally; an OSC 52 sequence written to terminal, if not nil, asks the
+// terminal to copy it, which reaches the local clipboard over SSH too. When
+// both are used it fails only if neither works.
+func CopyToClipboard(text string, terminal io.Writer) error {
+	method := terminalCaps.Clipboard
+	if terminal == nil {
+		method = termcaps.ClipboardNative
+	}
+
+	var nativeErr error
+	if method != termcaps.ClipboardOSC52 {
+		nativeErr = writeNativeClipboard(text)
+		if method == termcaps.ClipboardNative {
+			return nativeErr
+		}
+	}
+
+	sequence := fmt.Sprintf("\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	if _, err := io.WriteString(terminal, sequence); err != nil {
+		if method == termcaps.ClipboardOSC52 {
+			return err
+		}
+		return nativeErr
+	}
+	return nil
+}
+
+// handleCopyConfigCommand copies the settings of the session to the
+// clipboard, with API keys and headers hidden, e.g. to attach to a bug report
+func (m *Model) handleCopyConfigCommand() {
+	if m.configManager == nil {
+		m.addMessage("❌ Configuration is not available", MessageTypeError)
+		return
+	}
+	settings, err := m.configManager.ShareableYAML()
+	if err != nil {
+		m.addMessage("❌ "+err.Error(), MessageTypeError)
+		return
+	}
+
+	terminal := m.clipboardTerminal
+	if terminal == nil {
+		terminal = os.Stdout
+	}
+	if err := CopyToClipboard(settings, terminal); err != nil {
+		m.addMessage(fmt.Sprintf("⚠️  Could not copy the settings: %v", err), MessageTypeError)
+		return
+	}
+	m.addMessage("📋 Copied the settings to the clipboard, with API keys and headers hidden", MessageTypeSystem)
+}
+
+// copyOnSelect copies a selected command to the clipboard if copy_on_select
+// is set in the config
+func (m *Model) copyOnSelect(command string) {
+	if !m.copySelected {
+		return
+	}
+
+	terminal := m.clipboardTerminal
+	if terminal == nil {
+		terminal = os.Stdout
+	}
+	if err := CopyToClipboard(command, terminal); err != nil {
+		m.addMessage(fmt.Sprintf("⚠️  Could not copy the command: %v", err), MessageTypeError)
+		return
+	}
+	m.addMessage("📋 Copied to the clipboard", MessageTypeSystem)
+}
@@ -1,8 +1,12 @@
 package tui
 
 import (
+	"fmt"
 	"github.com/yourusername/clia/internal/ai"
+	"github.com/yourusername/clia/internal/prompt"
+	"sort"
 	"strings"
+	"time"
 )
 
 // Command represents a parsed command
@@ -12,12 +16,38 @@ type Command struct {
 	Raw  string   // original input
 }
 
+// criticalConfirmationPhrase must be typed to run a command assessed as critical
+const criticalConfirmationPhrase = "yes, do it"
+
 // CommandType constants
 const (
-	CommandTypeProvider = "provider"
-	CommandTypeModel    = "model"
-	CommandTypeHelp     = "help"
-	CommandTypeStatus   = "status"
+	CommandTypeProvider   = "provider"
+	CommandTypeModel      = "model"
+	CommandTypeHelp       = "help"
+	CommandTypeStatus     = "status"
+	CommandTypeReset      = "reset"
+	CommandTypeMemory     = "memory"
+	CommandTypeOffline    = "offline"
+	CommandTypeCreativity = "creativity"
+	CommandTypeSummarize  = "summarize"
+	CommandTypeProviders  = "providers"
+	CommandTypePinMsg     = "pinmsg"
+	CommandTypeRun        = "run"
+	CommandTypeThink      = "think"
+	CommandTypeQuiet      = "quiet"
+	CommandTypeAsk        = "ask"
+	CommandTypeFav        = "fav"
+	CommandTypeJobs       = "jobs"
+	CommandTypeJob        = "job"
+	CommandTypeKill       = "kill"
+	CommandTypeParanoid   = "paranoid"
+	CommandTypeTrim       = "trim"
+	CommandTypeConfig     = "config"
+	CommandTypeUndo       = "undo"
+	CommandTypeFormat     = "format"
+	CommandTypeUntrust    = "untrust"
+	CommandTypeReload     = "reload"
+	CommandTypeCopyConfig = "copy-config"
 )
 
 // ParseCommand parses user input to extract commands
@@ -53,7 +83,11 @@ func ParseCommand(input string) *Command {
 // IsValidCommand checks if a command type is valid
 func IsValidCommand(cmdType string) bool {
 	switch cmdType {
-	case CommandTypeProvider, CommandTypeModel, CommandTypeHelp, CommandTypeStatus:
+	case CommandTypeProvider, CommandTypeModel, CommandTypeHelp, CommandTypeStatus, CommandTypeReset,
+		CommandTypeMemory, CommandTypeOffline, CommandTypeCreativity, CommandTypeSummarize, CommandTypeProviders,
+		CommandTypePinMsg, CommandTypeRun, CommandTypeThink, CommandTypeQuiet, CommandTypeAsk, CommandTypeFav,
+		CommandTypeJobs, CommandTypeJob, CommandTypeKill, CommandTypeParanoid, CommandTypeTrim, CommandTypeConfig,
+		CommandTypeUndo, CommandTypeFormat, CommandTypeUntrust, CommandTypeReload, CommandTypeCopyConfig:
 		return true
 	default:
 		return false
@@ -65,17 +99,59 @@ func GetCommandHelp() string {
 	return `Available commands:
   /provider              - List available providers and their status
   /provider <name>       - Switch to specified provider (openai, openrouter, anthropic, ollama)
+  /providers test        - Send a tiny request to every provider and report which are reachable
   /model                 - List available models for current provider
   /model <name>          - Switch to specified model
+  /model <alias>         - Switch to a configured model alias (e.g. fast, smart)
+  Ctrl+P                 - Pick provider and model from a list
   /status                - Show current configuration status
+  /reset                 - Clear the conversation context used for follow-up requests
+  /memory list [--format table|plain|json]
+                         - List remembered commands
+  /memory export <file> [--format table|plain|json]
+                         - Export remembered commands to a file
+  /memory delete <id>    - Forget a remembered command (ID or ID prefix from the list)
+  /memory off|on         - Stop or resume reading from and saving to memory this session
+  /offline [on|off]      - Toggle offline mode (rule-based suggestions, no API calls)
+  /creativity [low|medium|high]
+                         - Show or set how varied suggestions are (+/- while choosing)
+  /summarize             - Summarize the output of the last command (Ctrl+S)
+  /format [on|off]       - Show JSON or YAML output of the last command formatted, or always
+  /ask <question>        - Answer a question in plain text instead of suggesting commands
+  /pinmsg <text>         - Keep a note in sight above the messages (/pinmsg alone clears it)
+  /run <name> var=value  - Run a request template from the config file (/run lists them)
+  /fav add "<command>"   - Add a command to the favorites bar above the input
+  /fav remove <n>        - Remove favorite n from the bar
+  /fav [<n>]             - List the favorites, or run favorite n (Alt+1 to Alt+9) without AI
+  /jobs                  - List the background jobs and their status
+  /job <id>              - Show the output of a background job
+  /kill <id>             - Stop a background job (jobs run until they exit, without a timeout)
+  /think [on|off]        - Show the raw model response and the estimated prompt size with the suggestions
+  /undo                  - Reverse the last command when it has a known inverse, e.g. mv b a for mv a b
+  /untrust [<n>|all]     - List the commands you trusted by confirming them, or ask for confirmation again
+  /trim                  - Resend the last request without directory context and earlier exchanges
+  /quiet [on|off]        - Hide informational messages, keeping requests, suggestions, output and errors
+  /paranoid [on|off]     - Confirm every command before it runs, not just risky ones (confirm_all in the config)
+  /config set timeout <duration>
+                         - Set how long a suggestion may take, e.g. 45s (commands keep their own timeout)
+  /config set max_cost <dollars>
+                         - Refuse paid AI requests once the session cost this much; 0 for no limit
+  /reload                - Read the config file again after editing it, e.g. to switch provider or timeout
+  /copy-config           - Copy the settings to the clipboard, API keys and headers hidden, e.g. for a bug report
   /help                  - Show this help message
 
 Direct command execution:
   !<command>             - Execute command directly without AI processing or safety checks
+  !<command> &           - Run it as a background job, keeping the input free for more work
+
+Per-request model:
+  @<model> <request>     - Use another model for this request only, e.g. @gpt-4 find large files
+  <request> --model=<m>  - The same, picking the model at the end of the request
 
 Examples:
   /provider openrouter   - Switch to OpenRouter provider
   /model openai/gpt-4    - Switch to GPT-4 model via OpenRouter
+  /model fast            - Switch to the provider's "fast" alias
   /status                - Show current provider and model
   !ls -la                - Execute 'ls -la' command directly
   !pwd                   - Execute 'pwd' command directly`
@@ -207,6 +283,125 @@ func FormatModelList(models []ai.ModelInfo, currentModel string, limit int) stri
 	return strings.Join(lines, "\n")
 }
 
+// FormatModelDetails describes the context length and the price of a model,
+// e.g. "📏 128k tokens of context • 💲 $2.50 in / $10.00 out per 1M tokens".
+// A context length of 0 and an unpriced model are reported as unknown.
+func FormatModelDetails(contextWindow int, price ai.TokenPrice, priced bool) string {
+	context := "context length unknown"
+	if contextWindow > 0 {
+		context = FormatTokenCount(contextWindow) + " tokens of context"
+	}
+
+	pricing := "price unknown"
+	switch {
+	case priced && price.Free():
+		pricing = "free"
+	case priced:
+		pricing = fmt.Sprintf("%s in / %s out per 1M tokens",
+			ai.FormatCost(price.Prompt*1e6), ai.FormatCost(price.Completion*1e6))
+	}
+	return "📏 " + context + " • 💲 " + pricing
+}
+
+// FormatTokenCount shortens a number of tokens, e.g. 128k or 1M
+func FormatTokenCount(tokens int) string {
+	switch {
+	case tokens >= 1000000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(tokens)/1e6), ".0") + "M"
+	case tokens >= 1000:
+		return fmt.Sprintf("%dk", (tokens+500)/1000)
+	default:
+		return fmt.Sprintf("%d", tokens)
+	}
+}
+
+// FormatModelAliases formats the model aliases of the current provider for display
+func FormatModelAliases(aliases map[string]string, currentModel string) string {
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	lines := []string{"Model aliases:"}
+	for _, alias := range names {
+		current := ""
+		if aliases[alias] == currentModel {
+			current = " - Current"
+		}
+		lines = append(lines, "  "+alias+" → "+aliases[alias]+current)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// FormatProviderProbes formats the results of /providers test as a table
+func FormatProviderProbes(probes []ai.ProviderProbe) string {
+	var lines []string
+	lines = append(lines, "Provider checks:")
+	lines = append(lines, fmt.Sprintf("    %-12s %-11s %s", "PROVIDER", "CONFIGURED", "STATUS"))
+
+	for _, probe := range probes {
+		indicator := "✗"
+		configured := "no"
+		status := "not configured"
+
+		if probe.Configured {
+			configured = "yes"
+			if probe.Reachable {
+				indicator = "✓"
+				status = fmt.Sprintf("reachable (%dms)", probe.Latency.Milliseconds())
+			} else if probe.Error != nil {
+				status = "error: " + probe.Error.Error()
+			}
+		}
+
+		name := string(probe.Type)
+		if probe.Current {
+			name += "*"
+		}
+		lines = append(lines, fmt.Sprintf("  %s %-12s %-11s %s", indicator, name, configured, status))
+	}
+
+	lines = append(lines, "  * current provider")
+	return strings.Join(lines, "\n")
+}
+
+// FormatRequestTemplates formats the request templates for /run
+func FormatRequestTemplates(templates []prompt.RequestTemplate) string {
+	if len(templates) == 0 {
+		return "No request templates defined. Add them under 'templates:' in the config file, e.g.\n" +
+			"  templates:\n" +
+			"    deploy:\n" +
+			"      pattern: \"deploy to {{env}}\""
+	}
+
+	lines := []string{"Request templates:"}
+	for _, template := range templates {
+		lines = append(lines, fmt.Sprintf("  %-12s %s", template.Name, template.Pattern))
+	}
+	lines = append(lines, "Type a request following a pattern, or "+templateUsage(templates[0]))
+	return strings.Join(lines, "\n")
+}
+
+// templateUsage returns the /run invocation of template
+func templateUsage(template prompt.RequestTemplate) string {
+	usage := "/run " + template.Name
+	for _, name := range template.Variables() {
+		usage += " " + name + "=<value>"
+	}
+	return usage
+}
+
+// formatTemplateMatch describes the template a request follows
+func formatTemplateMatch(match *prompt.TemplateMatch) string {
+	text := "🧩 Using template " + match.Template.Name
+	if variables := match.FormatVariables(); variables != "" {
+		text += " (" + variables + ")"
+	}
+	return text
+}
+
 // ProviderStatus represents the configuration status of a provider
 type ProviderStatus struct {
 	Name       string `json:"name"`
@@ -232,9 +427,46 @@ func FormatStatusInfo(currentProvider, currentModel string, providerInfo map[str
 		lines = append(lines, "  Timeout: "+timeout)
 	}
 
+	if budget, ok := providerInfo["budget"].(string); ok {
+		lines = append(lines, "  Budget: "+budget)
+	}
+
 	if fallbackMode, ok := providerInfo["fallback_mode"].(bool); ok && fallbackMode {
 		lines = append(lines, "  Fallback Mode: Enabled")
 	}
 
+	if offline, ok := providerInfo["offline"].(bool); ok && offline {
+		lines = append(lines, "  Offline Mode: Enabled")
+	}
+
+	if creativity, ok := providerInfo["creativity"].(string); ok && creativity != "" {
+		lines = append(lines, "  Creativity: "+creativity)
+	}
+
+	switch circuit, _ := providerInfo["circuit"].(string); circuit {
+	case string(ai.BreakerOpen):
+		lines = append(lines, fmt.Sprintf("  Circuit: ⛔ Open after %v failures, retrying in %v",
+			providerInfo["circuit_failures"], providerInfo["circuit_retry_in"]))
+	case string(ai.BreakerHalfOpen):
+		lines = append(lines, "  Circuit: ⏳ Half-open, the next request tests the provider")
+	}
+
 	return strings.Join(lines, "\n")
 }
+
+// FormatUsageTiming formats token throughput and model load time of a local request
+func FormatUsageTiming(usage *ai.UsageInfo) string {
+	parts := []string{fmt.Sprintf("%d tokens", usage.CompletionTokens)}
+
+	if tokensPerSecond := usage.TokensPerSecond(); tokensPerSecond > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f tok/s", tokensPerSecond))
+	}
+	if usage.LoadDuration > 0 {
+		parts = append(parts, "load "+usage.LoadDuration.Round(time.Millisecond).String())
+	}
+	if usage.TotalDuration > 0 {
+		parts = append(parts, "total "+usage.TotalDuration.Round(time.Millisecond).String())
+	}
+
+	return "⏱️  " + strings.Join(parts, " • ")
+}
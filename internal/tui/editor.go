@@ -0,0 +1,136 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editorHeader is written above the command in the temporary file
+const editorHeader = "# Edit the command below, then save and quit to run it.\n" +
+	"# Lines starting with # are ignored; an empty file cancels.\n"
+
+// editorCommand returns the user's preferred editor command line
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// OpenInEditorCmd suspends the TUI, opens command in $EDITOR and reads it back on exit
+func OpenInEditorCmd(command string) tea.Cmd {
+	file, err := os.CreateTemp("", "clia-*.sh")
+	if err != nil {
+		return func() tea.Msg {
+			return EditorFinishedMsg{Err: fmt.Errorf("failed to create temporary file: %w", err)}
+		}
+	}
+	path := file.Name()
+
+	_, err = file.WriteString(editorHeader + command + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return func() tea.Msg {
+			return EditorFinishedMsg{Err: fmt.Errorf("failed to write temporary file: %w", err)}
+		}
+	}
+
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		defer os.Remove(path)
+
+		if err != nil {
+			return EditorFinishedMsg{Err: fmt.Errorf("editor %s failed: %w", editor[0], err)}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return EditorFinishedMsg{Err: fmt.Errorf("failed to read edited command: %w", err)}
+		}
+
+		return EditorFinishedMsg{Command: normalizeEditedCommand(string(data))}
+	})
+}
+
+// normalizeEditedCommand turns the edited file into a single-line command.
+// Comments and blank lines are dropped, backslash continuations and lines
+// ending in a pipe or logical operator are joined with a space, and other
+// lines are joined with "; " so they run in sequence.
+func normalizeEditedCommand(content string) string {
+	var builder strings.Builder
+	separator := ""
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		builder.WriteString(separator)
+
+		switch {
+		case strings.HasSuffix(line, "\\"):
+			builder.WriteString(strings.TrimSpace(strings.TrimSuffix(line, "\\")))
+			separator = " "
+		case strings.HasSuffix(line, "&&"), strings.HasSuffix(line, "||"), strings.HasSuffix(line, "|"):
+			builder.WriteString(line)
+			separator = " "
+		default:
+			builder.WriteString(strings.TrimSuffix(line, ";"))
+			separator = "; "
+		}
+	}
+
+	return builder.String()
+}
+
+// openEditor opens the command being edited in $EDITOR, entering edit mode
+// with the top suggestion first when called from selection mode
+func (m *Model) openEditor() tea.Cmd {
+	if m.inSelectionMode {
+		m.editHighlighted()
+	}
+
+	if !m.inEditMode {
+		return nil
+	}
+
+	m.addMessage(fmt.Sprintf("📝 Opening command in %s...", editorCommand()[0]), MessageTypeSystem)
+	return OpenInEditorCmd(m.input.Value())
+}
+
+// handleEditorFinished continues the edit with the command read back from $EDITOR
+func (m *Model) handleEditorFinished(msg EditorFinishedMsg) tea.Cmd {
+	if !m.inEditMode {
+		return nil
+	}
+
+	if msg.Err != nil {
+		m.addMessage("❌ "+msg.Err.Error(), MessageTypeError)
+		m.addMessage("💡 Keep editing inline, or press Escape to cancel", MessageTypeSystem)
+		return nil
+	}
+
+	if msg.Command == "" {
+		return m.exitEditMode(false)
+	}
+
+	// Proceed to the usual safety checks and execution with the edited text
+	m.input.SetValue(msg.Command)
+	return m.exitEditMode(true)
+}
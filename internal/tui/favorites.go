@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// favoriteUsage describes the /fav subcommands
+const favoriteUsage = `💡 Usage: /fav add "<command>" • /fav remove <n> • /fav <n> to run • /fav to list`
+
+// favorites returns the commands of the favorites bar
+func (m *Model) favorites() []string {
+	if m.configManager == nil {
+		return nil
+	}
+	return m.configManager.GetFavorites()
+}
+
+// favoriteKey returns the number of the favorite run by msg, Alt+1 to Alt+9
+func favoriteKey(msg tea.KeyMsg) (int, bool) {
+	digit, ok := strings.CutPrefix(msg.String(), "alt+")
+	if !ok || len(digit) != 1 || digit[0] < '1' || digit[0] > '9' {
+		return 0, false
+	}
+	return int(digit[0] - '0'), true
+}
+
+// handleFavCommand manages the favorites bar: `/fav add "git status"`,
+// `/fav remove 2`, `/fav 2` to run one and `/fav` to list them
+func (m *Model) handleFavCommand(cmd *Command) tea.Cmd {
+	if len(cmd.Args) == 0 {
+		m.addMessage(formatFavorites(m.favorites()), MessageTypeSystem)
+		return nil
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "add":
+		// The command is the rest of the raw input, keeping its spacing
+		_, command, _ := strings.Cut(cmd.Raw, cmd.Args[0])
+		m.addFavorite(unquote(strings.TrimSpace(command)))
+		return nil
+	case "remove", "rm", "delete":
+		if len(cmd.Args) != 2 {
+			m.addMessage(favoriteUsage, MessageTypeSystem)
+			return nil
+		}
+		m.removeFavorite(cmd.Args[1])
+		return nil
+	}
+
+	if n, err := strconv.Atoi(cmd.Args[0]); err == nil && len(cmd.Args) == 1 {
+		return m.runFavorite(n)
+	}
+	m.addMessage(favoriteUsage, MessageTypeSystem)
+	return nil
+}
+
+// addFavorite adds command to the favorites bar and saves it in the config file
+func (m *Model) addFavorite(command string) {
+	if command == "" {
+		m.addMessage(favoriteUsage, MessageTypeSystem)
+		return
+	}
+	if m.configManager == nil {
+		m.addMessage("❌ Favorites are kept in the config file, which is not available", MessageTypeError)
+		return
+	}
+	if err := m.configManager.AddFavorite(command); err != nil {
+		m.addMessage("❌ "+err.Error(), MessageTypeError)
+		return
+	}
+	if err := m.configManager.Save(); err != nil {
+		m.addMessage(fmt.Sprintf("⚠️  Failed to save favorites: %v", err), MessageTypeError)
+	}
+	n := len(m.favorites())
+	m.addMessage(fmt.Sprintf("⭐ Added favorite %d: %s (Alt+%d runs it)", n, command, n), MessageTypeSystem)
+}
+
+// removeFavorite removes the favorite numbered arg from the bar and the config file
+func (m *Model) removeFavorite(arg string) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		m.addMessage(favoriteUsage, MessageTypeSystem)
+		return
+	}
+	if m.configManager == nil {
+		m.addMessage("❌ Favorites are kept in the config file, which is not available", MessageTypeError)
+		return
+	}
+	command, err := m.configManager.RemoveFavorite(n)
+	if err != nil {
+		m.addMessage("❌ "+err.Error(), MessageTypeError)
+		return
+	}
+	if err := m.configManager.Save(); err != nil {
+		m.addMessage(fmt.Sprintf("⚠️  Failed to save favorites: %v", err), MessageTypeError)
+	}
+	m.addMessage(fmt.Sprintf("⭐ Removed favorite %d: %s", n, command), MessageTypeSystem)
+}
+
+// runFavorite runs favorite n directly, like !<command>, without asking the AI
+func (m *Model) runFavorite(n int) tea.Cmd {
+	favorites := m.favorites()
+	if n < 1 || n > len(favorites) {
+		m.addMessage(fmt.Sprintf("❌ No favorite %d. Add one with /fav add \"<command>\"", n), MessageTypeError)
+		return nil
+	}
+
+	command := favorites[n-1]
+	m.addMessage(fmt.Sprintf("⭐ %d: %s", n, command), MessageTypeUser)
+	return m.executeCommand(command, fmt.Sprintf("Favorite %d", n))
+}
+
+// formatFavorites lists the favorites with the keys running them
+func formatFavorites(favorites []string) string {
+	if len(favorites) == 0 {
+		return "⭐ No favorites yet. " + strings.TrimPrefix(favoriteUsage, "💡 ")
+	}
+	lines := []string{"⭐ Favorites:"}
+	for i, command := range favorites {
+		lines = append(lines, fmt.Sprintf("  Alt+%d  %s", i+1, command))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unquote removes one pair of quotes around s, e.g. from `"git status"`
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return s
+}
+
+// renderFavoritesBar renders the numbered favorites above the input, or
+// nothing without favorites
+func (m Model) renderFavoritesBar() string {
+	favorites := m.favorites()
+	if len(favorites) == 0 {
+		return ""
+	}
+	items := make([]string, len(favorites))
+	for i, command := range favorites {
+		items[i] = fmt.Sprintf("%d %s", i+1, command)
+	}
+	return favoritesBarStyle.Width(m.width).Render("⭐ " + strings.Join(items, " │ ") + "  (Alt+number runs)")
+}
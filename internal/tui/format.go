@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/yourusername/clia/internal/renderer"
+)
+
+// handleFormatCommand shows the output of the last command formatted, or with
+// on or off, turns formatting after every command on or off
+func (m *Model) handleFormatCommand(args []string) tea.Cmd {
+	if len(args) == 0 {
+		output := m.commandStdout()
+		r := renderer.DetectOutputFormat(output)
+		if r == nil {
+			m.addMessage("❌ The output of the last command is not JSON or YAML", MessageTypeError)
+			return nil
+		}
+		m.showFormattedOutput(r, output)
+		return nil
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "on":
+		m.SetFormatOutput(true)
+		m.addMessage("🎨 JSON and YAML output is shown formatted after the raw output", MessageTypeSystem)
+	case "off":
+		m.SetFormatOutput(false)
+		m.addMessage("🎨 Output is shown raw only; /format formats the last one", MessageTypeSystem)
+	default:
+		m.addMessage("❌ Usage: /format [on|off]", MessageTypeError)
+	}
+	return nil
+}
+
+// SetFormatOutput shows JSON and YAML output formatted after every command
+// (ui.format_output), in addition to the raw output
+func (m *Model) SetFormatOutput(enabled bool) *Model {
+	m.formatOutput = enabled
+	return m
+}
+
+// offerFormattedOutput formats the output of a command that just succeeded if
+// it is JSON or YAML, or offers to
+func (m *Model) offerFormattedOutput() {
+	output := m.commandStdout()
+	r := renderer.DetectOutputFormat(output)
+	if r == nil {
+		return
+	}
+	if m.formatOutput {
+		m.showFormattedOutput(r, output)
+		return
+	}
+	m.addMessage(fmt.Sprintf("💡 The output is %s: /format shows it formatted, /format on always does", r.Format()), MessageTypeSystem)
+}
+
+// showFormattedOutput adds output formatted by r below the raw output, which
+// stays as it was
+func (m *Model) showFormattedOutput(r renderer.OutputRenderer, output string) {
+	formatted, err := r.Render(output)
+	if err != nil {
+		m.addMessage(fmt.Sprintf("❌ Failed to format the output as %s: %v", r.Format(), err), MessageTypeError)
+		return
+	}
+	m.addMessage(fmt.Sprintf("🎨 %s output of %s:\n%s", r.Format(), m.outputCommand, formatted), MessageTypeAssistant)
+}
+
+// commandStdout returns the standard output kept of the last command
+func (m *Model) commandStdout() string {
+	var lines []string
+	for _, line := range m.executionOutput {
+		if !strings.HasPrefix(line, "[stderr] ") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,36 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// renderFrame draws the last screen of an interactive program as a bordered
+// block at most width columns wide. Longer lines are clipped without cutting
+// their escape sequences, so the colors of the program end where they should.
+func renderFrame(frame string, width int) string {
+	if !colorsEnabled {
+		frame = utils.StripANSI(frame)
+	}
+
+	inner := width - frameStyle.GetHorizontalFrameSize()
+	lines := strings.Split(frame, "\n")
+	for i, line := range lines {
+		if inner > 0 && ansi.StringWidth(line) > inner {
+			lines[i] = ansi.Truncate(line, inner, "…")
+		}
+	}
+	return frameStyle.Render(strings.Join(lines, "\n"))
+}
+
+// addFrame adds the last screen of command to the message history
+func (m *Model) addFrame(command, frame string) {
+	if strings.TrimSpace(utils.StripANSI(frame)) == "" {
+		return
+	}
+	m.addMessage("🖼️  Last screen of "+command+":", MessageTypeSystem)
+	m.addMessage(frame, MessageTypeFrame)
+}
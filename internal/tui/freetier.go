@@ -0,0 +1,69 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/yourusername/clia/internal/ai"
+)
+
+// freeTierRateLimitStreak is how many requests in a row a free model must
+// fail with a rate limit before clia recommends another model
+const freeTierRateLimitStreak = 2
+
+// freeTierTipMsg carries the model recommended for a rate-limited free model
+type freeTierTipMsg struct {
+	model       string
+	alternative ai.ModelInfo
+	found       bool
+}
+
+// trackRateLimit counts the requests in a row the current free model failed
+// with a rate limit, err being the result of the latest request
+func (m *Model) trackRateLimit(err error) {
+	if err != nil && errors.Is(err, ai.ErrRateLimitExceeded) && ai.IsFreeModel(m.currentModel) {
+		m.rateLimitStreak++
+	} else {
+		m.rateLimitStreak = 0
+	}
+}
+
+// freeTierTip looks up a model with higher limits once the current free model
+// keeps hitting its rate limit. The tip is shown once per session.
+func (m *Model) freeTierTip() tea.Cmd {
+	if m.freeTierTipShown || m.rateLimitStreak < freeTierRateLimitStreak || m.aiService == nil {
+		return nil
+	}
+	m.freeTierTipShown = true
+
+	model := m.currentModel
+	aiService := m.aiService
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), aiService.GetTimeout())
+		defer cancel()
+
+		models, err := aiService.GetAvailableModels(ctx)
+		if err != nil {
+			return freeTierTipMsg{model: model}
+		}
+		alternative, found := ai.RecommendModel(model, models)
+		return freeTierTipMsg{model: model, alternative: alternative, found: found}
+	}
+}
+
+// handleFreeTierTip shows the recommendation for a rate-limited free model
+func (m *Model) handleFreeTierTip(msg freeTierTipMsg) {
+	m.addMessage(fmt.Sprintf("💡 %s is a free model with tight rate limits", msg.model), MessageTypeSystem)
+	if !msg.found {
+		m.addMessage("💡 Wait a minute between requests, or add credits to your account and pick a paid model with /model", MessageTypeSystem)
+		return
+	}
+
+	pricing := ""
+	if msg.alternative.Pricing != "" {
+		pricing = " (" + msg.alternative.Pricing + ")"
+	}
+	m.addMessage(fmt.Sprintf("💡 %s%s has much higher limits: /model %s switches to it", msg.alternative.ID, pricing, msg.alternative.ID), MessageTypeSystem)
+}
@@ -0,0 +1,296 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/yourusername/clia/internal/executor"
+)
+
+const (
+	jobTickInterval = 200 * time.Millisecond // Background output is not shown live, so it is drained less often
+	jobOutputShown  = 100                    // Lines of output shown by /job <id>
+)
+
+// job is a command running in the background, started with !<command> &
+type job struct {
+	id        int
+	command   string
+	startedAt time.Time
+	stream    <-chan executor.OutputLine // nil until the command started and after it finished
+	output    []string                   // The last maxRetainedOutputLines lines of output
+	result    *executor.ExecutionResult  // Set when the command finished
+	err       error                      // The command could not be started
+	cancel    context.CancelFunc         // Stops the command, see /kill
+	killed    bool                       // Stopped with /kill
+}
+
+// running reports whether the job has not finished yet
+func (j *job) running() bool {
+	return j.result == nil && j.err == nil
+}
+
+// status describes the state of the job, e.g. "running 3.2s" or "exit 0 after 1.20s"
+func (j *job) status() string {
+	switch {
+	case j.err != nil:
+		return "failed to start"
+	case j.result == nil:
+		return "running " + formatElapsed(time.Since(j.startedAt))
+	case j.killed:
+		return fmt.Sprintf("killed after %.2fs", j.result.Duration.Seconds())
+	case j.result.Error != nil && j.result.ExitCode == -1:
+		return fmt.Sprintf("failed after %.2fs", j.result.Duration.Seconds())
+	default:
+		return fmt.Sprintf("exit %d after %.2fs", j.result.ExitCode, j.result.Duration.Seconds())
+	}
+}
+
+// jobStartedMsg carries the output stream of a background job once it started
+type jobStartedMsg struct {
+	id     int
+	stream <-chan executor.OutputLine
+	err    error
+}
+
+// jobTickMsg drains the output of the background jobs
+type jobTickMsg struct{}
+
+// jobTickCmd schedules the next drain of background job output
+func jobTickCmd() tea.Cmd {
+	return tea.Tick(jobTickInterval, func(time.Time) tea.Msg {
+		return jobTickMsg{}
+	})
+}
+
+// backgroundCommand splits a trailing & off command, e.g. "make test &";
+// the && of a command list is not one
+func backgroundCommand(command string) (string, bool) {
+	command = strings.TrimSpace(command)
+	if !strings.HasSuffix(command, "&") || strings.HasSuffix(command, "&&") {
+		return command, false
+	}
+	return strings.TrimSpace(strings.TrimSuffix(command, "&")), true
+}
+
+// startJob runs command as a background job; new input is accepted while it
+// runs and its output is kept for /job <id>. Jobs have no timeout, they run
+// until they exit or are stopped with /kill <id> or by quitting.
+func (m *Model) startJob(command string) tea.Cmd {
+	if command == "" {
+		m.addMessage("💡 Type a shell command before &, e.g. !make test &", MessageTypeSystem)
+		return nil
+	}
+	if executor.UsesSudo(command) || executor.NewPTYExecutor().IsTUIProgram(command) || executor.ReadsStdin(command) {
+		m.addMessage(fmt.Sprintf("⚠️  %s needs the terminal or standard input and cannot run in the background", command), MessageTypeError)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.nextJobID++
+	j := &job{id: m.nextJobID, command: command, startedAt: time.Now(), cancel: cancel}
+	m.jobs = append(m.jobs, j)
+	m.addMessage(fmt.Sprintf("🧵 Job [%d] started in the background: %s", j.id, command), MessageTypeSystem)
+	m.addMessage(fmt.Sprintf("💡 /jobs lists jobs, /job %d shows its output, /kill %d stops it", j.id, j.id), MessageTypeSystem)
+
+	cmdExecutor, id := m.executor, j.id
+	return func() tea.Msg {
+		stream, err := cmdExecutor.StreamUntilCanceled(ctx, command)
+		return jobStartedMsg{id: id, stream: stream, err: err}
+	}
+}
+
+// findJob returns the job with id, or nil
+func (m *Model) findJob(id int) *job {
+	for _, j := range m.jobs {
+		if j.id == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// runningJobs returns the number of background jobs still running
+func (m Model) runningJobs() int {
+	running := 0
+	for _, j := range m.jobs {
+		if j.running() {
+			running++
+		}
+	}
+	return running
+}
+
+// handleJobStarted attaches the output stream of a started job and drains
+// job output until all jobs finished
+func (m *Model) handleJobStarted(msg jobStartedMsg) tea.Cmd {
+	j := m.findJob(msg.id)
+	if j == nil {
+		return nil
+	}
+	if msg.err != nil {
+		j.err = msg.err
+		j.cancel()
+		m.addMessage(fmt.Sprintf("❌ Job [%d] failed to start: %v", j.id, msg.err), MessageTypeError)
+		return nil
+	}
+
+	j.stream = msg.stream
+	if m.jobsTicking {
+		return nil
+	}
+	m.jobsTicking = true
+	return jobTickCmd()
+}
+
+// handleJobTick keeps the output of every running job and reports the jobs
+// that finished
+func (m *Model) handleJobTick() tea.Cmd {
+	pending := false
+	for _, j := range m.jobs {
+		if j.stream == nil {
+			pending = pending || j.running()
+			continue
+		}
+		m.drainJob(j)
+		pending = pending || j.running()
+	}
+
+	if !pending {
+		m.jobsTicking = false
+		return nil
+	}
+	return jobTickCmd()
+}
+
+// drainJob reads the output currently available from a job, up to
+// maxStreamBatch lines
+func (m *Model) drainJob(j *job) {
+	for drained := 0; drained < maxStreamBatch; drained++ {
+		select {
+		case output, ok := <-j.stream:
+			if !ok {
+				j.stream = nil
+				if j.result == nil {
+					j.result = &executor.ExecutionResult{Command: j.command, Duration: time.Since(j.startedAt)}
+				}
+				m.reportJobDone(j)
+				return
+			}
+			if output.Result != nil {
+				j.result = output.Result
+				continue
+			}
+			if output.Partial {
+				continue // Only finished lines are kept, not each redraw of a progress bar
+			}
+			content := output.Content
+			if output.IsStderr {
+				content = "[stderr] " + content
+			}
+			j.output = append(j.output, content)
+			if len(j.output) > maxRetainedOutputLines {
+				j.output = j.output[len(j.output)-maxRetainedOutputLines:]
+			}
+		default:
+			return
+		}
+	}
+}
+
+// reportJobDone tells that a background job finished
+func (m *Model) reportJobDone(j *job) {
+	j.cancel()
+	if j.killed {
+		m.addMessage(fmt.Sprintf("🛑 Job [%d] killed: %s (%s)", j.id, j.command, j.status()), MessageTypeSystem)
+		return
+	}
+	if j.result.ExitCode == 0 && j.result.Error == nil {
+		m.addMessage(fmt.Sprintf("✅ Job [%d] done: %s (%s)", j.id, j.command, j.status()), MessageTypeSystem)
+		return
+	}
+	m.addMessage(fmt.Sprintf("❌ Job [%d] failed: %s (%s)", j.id, j.command, j.status()), MessageTypeError)
+	if j.result.Error != nil {
+		m.addMessage(fmt.Sprintf("Error: %s", j.result.Error.Error()), MessageTypeError)
+	}
+}
+
+// handleJobsCommand lists the background jobs of the session
+func (m *Model) handleJobsCommand() {
+	if len(m.jobs) == 0 {
+		m.addMessage("🧵 No background jobs. End a direct command with & to start one, e.g. !make test &", MessageTypeSystem)
+		return
+	}
+
+	lines := []string{"🧵 Background jobs:"}
+	for _, j := range m.jobs {
+		lines = append(lines, fmt.Sprintf("  [%d] %-22s %s", j.id, j.status(), j.command))
+	}
+	m.addMessage(strings.Join(lines, "\n"), MessageTypeSystem)
+}
+
+// handleJobCommand shows the output of a background job, e.g. `/job 2`
+func (m *Model) handleJobCommand(args []string) {
+	if len(args) != 1 {
+		m.addMessage("💡 Usage: /job <id> shows the output of a background job (/jobs lists them)", MessageTypeSystem)
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "%"))
+	j := m.findJob(id)
+	if err != nil || j == nil {
+		m.addMessage(fmt.Sprintf("❌ No job %s. /jobs lists the background jobs", args[0]), MessageTypeError)
+		return
+	}
+
+	m.drainJob(j)
+	lines := []string{fmt.Sprintf("🧵 Job [%d] %s: %s", j.id, j.status(), j.command)}
+	output := j.output
+	if len(output) > jobOutputShown {
+		lines = append(lines, fmt.Sprintf("  ... %d earlier lines", len(output)-jobOutputShown))
+		output = output[len(output)-jobOutputShown:]
+	}
+	if len(output) == 0 {
+		lines = append(lines, "  (no output yet)")
+	}
+	for _, line := range output {
+		lines = append(lines, "  "+line)
+	}
+	m.addMessage(strings.Join(lines, "\n"), MessageTypeSystem)
+}
+
+// handleKillCommand stops a running background job, e.g. `/kill 2`
+func (m *Model) handleKillCommand(args []string) {
+	if len(args) != 1 {
+		m.addMessage("💡 Usage: /kill <id> stops a background job (/jobs lists them)", MessageTypeSystem)
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "%"))
+	j := m.findJob(id)
+	if err != nil || j == nil {
+		m.addMessage(fmt.Sprintf("❌ No job %s. /jobs lists the background jobs", args[0]), MessageTypeError)
+		return
+	}
+	if !j.running() {
+		m.addMessage(fmt.Sprintf("💡 Job [%d] already finished (%s)", j.id, j.status()), MessageTypeSystem)
+		return
+	}
+
+	// The job is reported as killed once its stream ends
+	j.killed = true
+	j.cancel()
+	m.addMessage(fmt.Sprintf("🛑 Stopping job [%d]: %s", j.id, j.command), MessageTypeSystem)
+}
+
+// killJobs stops every background job, when the session ends
+func (m *Model) killJobs() {
+	for _, j := range m.jobs {
+		if j.running() {
+			j.killed = true
+			j.cancel()
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"io"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -13,6 +14,9 @@ import (
 type Message struct {
 	Content string
 	Type    MessageType
+	Reply   bool // Answers a slash command or pending question; shown even in quiet mode
+
+	Highlighted bool // The suggestion under the cursor in selection mode
 }
 
 // MessageType represents the type of message
@@ -23,6 +27,8 @@ const (
 	MessageTypeSystem
 	MessageTypeAssistant
 	MessageTypeError
+	MessageTypeRaw   // Raw model output shown by /think
+	MessageTypeFrame // Last screen of an interactive program, with its colors
 )
 
 // String returns the string representation of the message type
@@ -36,6 +42,10 @@ func (mt MessageType) String() string {
 		return "assistant"
 	case MessageTypeError:
 		return "error"
+	case MessageTypeRaw:
+		return "raw"
+	case MessageTypeFrame:
+		return "frame"
 	default:
 		return "unknown"
 	}
@@ -79,6 +89,10 @@ func AIRequestCmd(input string) tea.Cmd {
 // aiResponseMsg represents an AI response
 type aiResponseMsg struct {
 	suggestions []aiSuggestion
+	usage       *ai.UsageInfo      // Token usage and timing, if reported by the provider
+	cached      bool               // Served from the suggestion cache
+	raw         string             // Model output before suggestions were extracted
+	estimate    *ai.PromptEstimate // Estimated size of the request, shown in think mode
 	error       error
 }
 
@@ -88,6 +102,7 @@ type aiSuggestion struct {
 	Description string
 	Safe        bool
 	Confidence  float64
+	Category    string
 }
 
 // AIResponseCmd returns a command with AI response
@@ -133,6 +148,7 @@ func CommandCmd(command string, args []string, raw string) tea.Cmd {
 // providerSwitchMsg represents a provider switch operation
 type providerSwitchMsg struct {
 	providerType string
+	apiKey       string // Key entered by the user, saved when completing onboarding
 	success      bool
 	error        error
 	needsAPIKey  bool
@@ -169,6 +185,7 @@ func ModelListCmd(models []ai.ModelInfo, err error) tea.Cmd {
 // modelSwitchMsg represents a model switch operation
 type modelSwitchMsg struct {
 	modelName string
+	alias     string // Alias the model was resolved from, if any
 	success   bool
 	error     error
 }
@@ -234,10 +251,14 @@ func CommandSelectionCmd(index int) tea.Cmd {
 
 // commandExecutionMsg represents a command execution request
 type commandExecutionMsg struct {
-	command     string
-	description string
-	safe        bool
-	confidence  float64
+	command        string
+	description    string
+	safe           bool
+	confidence     float64
+	programChecked bool    // Run even if the program is not installed
+	undo           bool    // Reverses the last command (/undo); not saved to memory
+	runMode        runMode // Forces full terminal or streaming mode, see selection.go
+	resolved       string  // command with its session alias expanded, set by handleCommandExecution
 }
 
 // CommandExecutionCmd returns a command to execute a selected command
@@ -366,6 +387,21 @@ func CommandErrorCmd(command string, err error) tea.Cmd {
 	}
 }
 
+// outputSummaryMsg carries the model's summary of a command's output
+type outputSummaryMsg struct {
+	command string
+	summary string
+	error   error
+}
+
+// askEventMsg carries a piece of a streamed /ask answer, or its end
+type askEventMsg struct {
+	chunk    string
+	done     bool
+	response *ai.CompletionResponse
+	error    error
+}
+
 // Stream processing messages
 
 // streamTickMsg represents a tick to check for new output
@@ -403,6 +439,7 @@ type commandStreamStartMsg struct {
 	command     string
 	description string
 	stream      <-chan executor.OutputLine
+	input       io.WriteCloser // Standard input answering the prompts of the command, if it is kept open
 }
 
 // CommandStreamStartCmd returns a command to start a command stream
@@ -423,6 +460,19 @@ type memorySearchMsg struct {
 	query string
 }
 
+// autocompleteTickMsg fires when typing has paused long enough to search memory
+type autocompleteTickMsg struct {
+	seq   int
+	query string
+}
+
+// autocompleteResultsMsg carries the past requests matching the input
+type autocompleteResultsMsg struct {
+	seq     int
+	query   string
+	results []memory.SearchResult
+}
+
 // MemorySearchCmd returns a command to search memory
 func MemorySearchCmd(query string) tea.Cmd {
 	return func() tea.Msg {
@@ -578,6 +628,12 @@ func CombinedSuggestionsCmd(userRequest string, aiSuggestions []aiSuggestion, me
 	}
 }
 
+// EditorFinishedMsg carries the command read back from $EDITOR
+type EditorFinishedMsg struct {
+	Command string // Edited command, empty if the user cleared the file
+	Err     error
+}
+
 // PTY execution messages
 
 // ptyExecutionRequestMsg represents a request to execute a command with PTY
@@ -602,16 +658,48 @@ type ptyExecutionCompleteMsg struct {
 	exitCode int
 	duration time.Duration
 	error    error
+	frame    string // Last screen the program drew, see executor.Screen
 }
 
 // PTYExecutionCompleteCmd returns a command indicating PTY execution completion
-func PTYExecutionCompleteCmd(command string, exitCode int, duration time.Duration, err error) tea.Cmd {
+func PTYExecutionCompleteCmd(command string, exitCode int, duration time.Duration, err error, frame string) tea.Cmd {
 	return func() tea.Msg {
 		return ptyExecutionCompleteMsg{
 			command:  command,
 			exitCode: exitCode,
 			duration: duration,
 			error:    err,
+			frame:    frame,
 		}
 	}
 }
+
+// commandHelpMsg carries the system help for the command awaiting confirmation
+type commandHelpMsg struct {
+	command string
+	help    string
+	error   error
+}
+
+// deletionPreviewMsg carries what the command awaiting confirmation would delete
+type deletionPreviewMsg struct {
+	command string
+	impact  *executor.DeletionImpact
+	error   error
+}
+
+// switcherChoiceMsg reports the provider or model chosen in the quick switcher
+type switcherChoiceMsg struct {
+	stage switcherStage
+	id    string
+}
+
+// switcherCloseMsg closes the quick switcher
+type switcherCloseMsg struct{}
+
+// switcherModelsMsg carries the models of the provider shown in the quick switcher
+type switcherModelsMsg struct {
+	provider string
+	models   []ai.ModelInfo
+	error    error
+}
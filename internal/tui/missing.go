@@ -0,0 +1,56 @@
+package tui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// missingProgramOffer is a selected command held back because the program it
+// runs is not installed
+type missingProgramOffer struct {
+	program string
+	command commandExecutionMsg
+}
+
+// offerMissingProgram holds back a command whose program is not installed,
+// which would only fail with "command not found", and offers to ask the AI
+// how to install the program or for an alternative
+func (m *Model) offerMissingProgram(program string, msg commandExecutionMsg) {
+	m.missingProgram = &missingProgramOffer{program: program, command: msg}
+	m.addMessage(fmt.Sprintf("❓ %s is not installed or not on PATH, so %s would fail", program, msg.command), MessageTypeError)
+	m.addMessage("💡 Press 'i' to ask how to install it, 'a' to ask for an alternative, 'r' to run it anyway, or Esc to cancel", MessageTypeSystem)
+}
+
+// handleMissingProgramKey acts on a key pressed while a missing program is
+// offered. Other keys dismiss the offer and are left to the input, for which
+// it reports false.
+func (m *Model) handleMissingProgramKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	offer := m.missingProgram
+	m.missingProgram = nil
+
+	switch msg.String() {
+	case "i":
+		return m.handleAIRequest("install " + offer.program), true
+	case "a":
+		return m.handleAIRequest(alternativeRequest(offer)), true
+	case "r":
+		command := offer.command
+		command.programChecked = true
+		return m.handleCommandExecution(command), true
+	case "esc", "escape":
+		m.addMessage("❌ Command execution cancelled", MessageTypeSystem)
+		return nil, true
+	default:
+		return nil, false
+	}
+}
+
+// alternativeRequest asks for a command doing what the held back command was
+// meant to do without its missing program
+func alternativeRequest(offer *missingProgramOffer) string {
+	if offer.command.description != "" {
+		return fmt.Sprintf("%s without %s", offer.command.description, offer.program)
+	}
+	return fmt.Sprintf("do what %s does without %s", offer.command.command, offer.program)
+}
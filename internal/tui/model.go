@@ -2,7 +2,9 @@ package tui
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -15,6 +17,7 @@ import (
 	"github.com/yourusername/clia/internal/ai"
 	"github.com/yourusername/clia/internal/config"
 	"github.com/yourusername/clia/internal/executor"
+	"github.com/yourusername/clia/internal/prompt"
 	"github.com/yourusername/clia/internal/version"
 	"github.com/yourusername/clia/pkg/memory"
 	"github.com/yourusername/clia/pkg/utils"
@@ -57,20 +60,44 @@ type Model struct {
 	showSpinner     bool
 	pulseFrame      int
 	thinkingDots    string
+	thinkingText    string // Shown while the AI works on a request (ui.thinking_message)
 
 	// Command state
 	commandMode    bool
 	waitingAPIKey  bool
 	apiKeyProvider string
+	onboarding     bool // First-run provider setup in progress
 
 	// Selection state
 	inSelectionMode      bool
 	availableSuggestions []aiSuggestion
 	lastSelectedIndex    int
+	highlighted          int       // Entry of combinedSuggestions Enter selects, see selection.go
+	suggestionMessages   []int     // Index in messages of each listed suggestion
+	selectionRunMode     runMode   // How the selected command runs, chosen with i or s
+	compactSuggestions   bool      // Always show one line per suggestion, not just on narrow terminals
+	confirmAll           bool      // Paranoid mode: confirm every command, not just dangerous ones
+	copySelected         bool      // Copy selected commands to the clipboard (copy_on_select)
+	clipboardTerminal    io.Writer // Receives the OSC 52 sequence; stdout if nil
+
+	// Provider and model quick switcher overlay (Ctrl+P); nil when closed
+	switcher *quickSwitcher
 
 	// Confirmation dialog state
-	inConfirmationMode bool
-	pendingCommand     commandExecutionMsg
+	inConfirmationMode   bool
+	pendingCommand       commandExecutionMsg
+	requiredConfirmation string // Phrase that must be typed to confirm a critical command
+
+	// Standard input collection for commands that read stdin
+	inStdinMode      bool
+	stdinCommand     string
+	stdinDescription string
+	stdinLines       []string
+
+	// Prompt of the streaming command waiting for an answer
+	commandInput io.WriteCloser // Standard input of the streaming command; nil if it takes no answers
+	inPromptMode bool
+	promptSecret bool // The answer is a password and is neither shown nor echoed
 
 	// Edit mode state
 	inEditMode         bool
@@ -84,10 +111,21 @@ type Model struct {
 	executingCommand bool
 	currentCommand   string
 	currentPID       int
-	executionOutput  []string
+	executionOutput  []string // Output of the last command, kept for summaries
+	formatOutput     bool     // Show JSON and YAML output formatted after every command, see format.go
+	outputCommand    string   // Command that produced executionOutput
 	executionResult  *executionResult
 	outputStream     <-chan executor.OutputLine
 	streamActive     bool
+	partialMessages  map[bool]int              // Index in messages of the line being redrawn, by stderr or not
+	streamStartedAt  time.Time                 // When the streaming command started
+	streamElapsed    time.Duration             // Running time shown in the status bar, updated every stream tick
+	streamResult     *executor.ExecutionResult // Final status sent by the executor before the stream closes
+
+	// Background jobs started with !<command> &, see jobs.go
+	jobs        []*job
+	nextJobID   int
+	jobsTicking bool // A job tick is scheduled
 
 	// Configuration
 	configManager *config.Manager
@@ -99,9 +137,40 @@ type Model struct {
 	// Memory management
 	memoryManager       *memory.Manager
 	memorySuggestions   []memorySuggestion
-	combinedSuggestions []interface{} // Mix of aiSuggestion and memorySuggestion
-	lastUserRequest     string        // Store for memory saving
-	memoryEnabled       bool          // Whether memory is functional
+	combinedSuggestions []combinedSuggestion // Unified, deduplicated memory and AI suggestions
+	lastUserRequest     string               // Store for memory saving
+	memoryEnabled       bool                 // Whether memory is functional
+	memoryPaused        bool                 // Memory turned off for this session by the user
+	thinkMode           bool                 // Show the raw model response with suggestions (/think)
+	quiet               bool                 // Hide informational system messages (--quiet, /quiet)
+	replying            bool                 // Messages being added answer a slash command
+
+	// Selected command held back as its program is not installed, see missing.go
+	missingProgram *missingProgramOffer
+
+	// Config changes waiting for confirmation before they are saved, see settings.go
+	confirmConfigSave bool
+
+	// Rate limits hit by a free model, see freetier.go
+	rateLimitStreak  int  // Requests in a row that failed with a rate limit
+	freeTierTipShown bool // A model with higher limits was recommended
+
+	// Inverse of the running and of the last successful command, see undo.go
+	pendingUndo *undoAction
+	lastUndo    *undoAction
+
+	// Answer of /ask being streamed
+	askEvents     <-chan askEventMsg
+	askIndex      int  // Message the answer streams into, -1 if none
+	bufferAnswers bool // Show the answer once complete rather than as it streams in
+
+	// Note kept in sight above the messages with /pinmsg
+	pinnedMessage string
+
+	// Memory autocomplete dropdown shown while typing
+	autocomplete      []memory.MemoryEntry
+	autocompleteIndex int // Highlighted entry, -1 if none
+	autocompleteSeq   int // Debounce generation; stale timers and results are ignored
 }
 
 // New creates a new TUI model
@@ -123,23 +192,54 @@ func New() Model {
 		fmt.Printf("Warning: Failed to initialize config manager: %v\n", err)
 	}
 
+	var initErrors []string
+	var migrationNote string
+	if configManager != nil {
+		if err := configManager.Load(); err != nil {
+			initErrors = append(initErrors, err.Error())
+		}
+		if migration := configManager.PendingMigration(); migration != nil {
+			migrationNote = fmt.Sprintf("📄 %s is config version %d, upgraded to %d for this session only. Run 'clia config migrate' to update the file (a backup is kept)",
+				configManager.GetConfigPath(), migration.From, migration.To)
+		}
+		if err := ConfigureTerminal(configManager.GetConfig().UI.TerminalSettings()); err != nil {
+			initErrors = append(initErrors, err.Error())
+		}
+		ConfigureColors(configManager.GetConfig().UI.Theme)
+	}
+
 	// Initialize AI service
 	aiService := ai.NewService().SetFallbackMode(true)
+	if configManager != nil {
+		initErrors = append(initErrors, configureService(aiService, configManager)...)
+		aiService.SetBudget(configManager.GetConfig().API.MaxCost)
+	}
+	if cache, err := ai.NewSuggestionCache(); err == nil {
+		aiService.SetCache(cache)
+	}
 
 	// Initialize executor
 	cmdExecutor := executor.New()
+	if configManager != nil {
+		cmdExecutor.WithRunLog(configManager.GetRunLogDir(), configManager.GetConfig().Behavior.RunLogsStripANSI)
+		cmdExecutor.WithHistory(configManager.GetHistoryPath(), configManager.GetConfig().Logs.HistoryFormat).
+			WithLogRotation(configManager.GetLogRotation())
+	}
 
 	// Initialize memory manager
 	memoryManager, memoryErr := memory.NewManager()
 	memoryEnabled := memoryErr == nil
 	if memoryErr != nil {
 		fmt.Printf("Warning: Failed to initialize memory manager: %v\n", memoryErr)
+	} else if configManager != nil {
+		memoryConfig := configManager.GetConfig().Memory
+		memoryManager.SetSaveDelay(memoryConfig.SaveDelay, memoryConfig.MaxSaveDelay)
+		memoryManager.SetTTL(memoryConfig.TTL).Expire()
 	}
 
 	currentProvider := "none"
 	currentModel := "none"
-
-	var initErrors []string
+	onboarding := false
 
 	// Try to configure providers based on available API keys
 	if apiKey := os.Getenv("OPENROUTER_API_KEY"); apiKey != "" {
@@ -163,8 +263,38 @@ func New() Model {
 		} else {
 			initErrors = append(initErrors, fmt.Sprintf("Failed to configure OpenAI: %v", err))
 		}
+	} else if provider, apiKey, ok := configManager.GetStoredProvider(); ok {
+		// Provider saved by onboarding or 'clia setup'
+		config := ai.DefaultProviderConfig(ai.ProviderType(provider))
+		config.APIKey = apiKey
+		if provider == string(ai.ProviderTypeOpenRouter) {
+			config.Model = "z-ai/glm-4.5-air:free"
+		}
+
+		if err := aiService.SetProviderByConfig(ai.ProviderType(provider), config); err == nil {
+			currentProvider = provider
+			currentModel = config.Model
+		} else {
+			initErrors = append(initErrors, fmt.Sprintf("Failed to configure %s: %v", provider, err))
+		}
 	} else {
-		initErrors = append(initErrors, "No API keys found. Set OPENROUTER_API_KEY or OPENAI_API_KEY in environment.")
+		// First run: guide the user through choosing a provider
+		onboarding = true
+	}
+
+	compactSuggestions := configManager != nil && configManager.GetConfig().UI.CompactSuggestions
+	confirmAll := configManager != nil && configManager.GetConfig().Behavior.ConfirmAll
+	copySelected := configManager != nil && configManager.GetConfig().Behavior.CopyOnSelect
+	bufferAnswers := configManager != nil && configManager.GetConfig().UI.BufferAnswers(terminalCaps.SSH)
+	formatOutput := configManager != nil && configManager.GetConfig().UI.FormatOutput
+
+	var uiConfig config.UIConfig
+	if configManager != nil {
+		uiConfig = configManager.GetConfig().UI
+	}
+	spinnerType, err := ParseSpinnerType(uiConfig.Spinner)
+	if err != nil {
+		initErrors = append(initErrors, err.Error())
 	}
 
 	// Create initial model
@@ -182,16 +312,22 @@ func New() Model {
 		configManager:   configManager,
 		currentProvider: currentProvider,
 		currentModel:    currentModel,
+		onboarding:      onboarding,
 		// Animation state
-		spinner:         ProcessingSpinner,
+		spinner:         ProcessingSpinner.WithType(spinnerType),
 		animationTicker: 0,
 		showSpinner:     false,
 		pulseFrame:      0,
 		thinkingDots:    "",
+		thinkingText:    uiConfig.ThinkingText(),
 		// Selection state
 		inSelectionMode:      false,
 		availableSuggestions: []aiSuggestion{},
 		lastSelectedIndex:    -1,
+		compactSuggestions:   compactSuggestions,
+		confirmAll:           confirmAll,
+		copySelected:         copySelected,
+		formatOutput:         formatOutput,
 		// Confirmation state
 		inConfirmationMode: false,
 		pendingCommand:     commandExecutionMsg{},
@@ -213,9 +349,12 @@ func New() Model {
 		// Memory state
 		memoryManager:       memoryManager,
 		memorySuggestions:   []memorySuggestion{},
-		combinedSuggestions: []interface{}{},
+		combinedSuggestions: []combinedSuggestion{},
 		lastUserRequest:     "",
 		memoryEnabled:       memoryEnabled,
+		autocompleteIndex:   -1,
+		askIndex:            -1,
+		bufferAnswers:       bufferAnswers,
 	}
 
 	// Add welcome message
@@ -226,6 +365,9 @@ func New() Model {
 	for _, err := range initErrors {
 		model.addMessage("⚠️  "+err, MessageTypeError)
 	}
+	if migrationNote != "" {
+		model.addMessage(migrationNote, MessageTypeSystem)
+	}
 
 	if currentProvider != "none" {
 		model.addMessage(fmt.Sprintf("✅ Provider initialized: %s (model: %s)", currentProvider, currentModel), MessageTypeSystem)
@@ -242,13 +384,50 @@ func New() Model {
 		model.addMessage("⚠️  Memory disabled due to initialization error", MessageTypeError)
 	}
 
+	if onboarding {
+		model.showOnboarding()
+		return model
+	}
+
 	model.addMessage("Type your natural language command and press Enter", MessageTypeSystem)
-	model.addMessage("Commands: /provider, /model, /status, /help", MessageTypeSystem)
+	model.addMessage("Commands: /provider, /model, /status, /reset, /offline, /creativity, /help", MessageTypeSystem)
 	model.addMessage("Shortcuts: Ctrl+C (quit), Ctrl+L (clear history)", MessageTypeSystem)
 
 	return model
 }
 
+// configureService applies the settings of the config file to aiService,
+// except the provider and the budget, and returns what it had to ignore. It
+// is run at startup and again by /reload.
+func configureService(aiService *ai.Service, configManager *config.Manager) []string {
+	var warnings []string
+	aiService.SetModelAliases(configManager.GetModelAliases())
+	aiService.SetProviderHeaders(configManager.GetProviderHeaders())
+	aiService.SetProviderEndpoints(configManager.GetProviderEndpoints())
+
+	aiService.SetMaxTokens(configManager.GetConfig().API.MaxTokens)
+	aiService.SetChoices(configManager.GetConfig().API.Choices)
+	aiService.SetTimeout(configManager.GetConfig().API.Timeout)
+	aiService.SetSuggestionNormalization(configManager.GetConfig().Behavior.NormalizeSuggestions)
+
+	contextConfig := configManager.GetConfig().Context
+	aiService.GetPromptBuilder().GetContextCollector().
+		SetDirectoryListing(contextConfig.IncludeDirectoryListing, contextConfig.MaxListingFiles)
+
+	templates, err := configManager.GetRequestTemplates()
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("Ignoring invalid templates: %v", err))
+	}
+	aiService.GetPromptBuilder().SetRequestTemplates(templates)
+
+	dangerPatterns, err := configManager.LoadDangerPatterns()
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("Ignoring invalid danger patterns: %v", err))
+	}
+	utils.SetDangerPatterns(dangerPatterns)
+	return warnings
+}
+
 // Init initializes the model
 func (m Model) Init() tea.Cmd {
 	return textinput.Blink
@@ -256,12 +435,36 @@ func (m Model) Init() tea.Cmd {
 
 // addMessage adds a message to the history
 func (m *Model) addMessage(content string, msgType MessageType) {
-	msg := Message{
+	m.appendMessage(content, msgType)
+	m.updateViewportContent()
+}
+
+// appendMessage adds a message without refreshing the viewport, so a batch of
+// messages can be rendered with a single updateViewportContent call
+func (m *Model) appendMessage(content string, msgType MessageType) {
+	m.messages = append(m.messages, Message{
 		Content: content,
 		Type:    msgType,
-	}
-	m.messages = append(m.messages, msg)
-	m.updateViewportContent()
+		Reply:   m.replying || m.awaitingAnswer(),
+	})
+}
+
+// startReply marks the messages added until the returned function is called
+// as answers to a slash command, which quiet mode keeps
+func (m *Model) startReply() func() {
+	m.replying = true
+	return func() { m.replying = false }
+}
+
+// awaitingAnswer reports whether a question is pending, e.g. a confirmation,
+// whose messages must stay visible in quiet mode
+func (m *Model) awaitingAnswer() bool {
+	return m.inConfirmationMode || m.inEditMode || m.inStdinMode || m.inPromptMode || m.waitingAPIKey || m.onboarding
+}
+
+// hidden reports whether msg is left out of the history in quiet mode
+func (m *Model) hidden(msg Message) bool {
+	return m.quiet && msg.Type == MessageTypeSystem && !msg.Reply
 }
 
 // removeLastMessage removes the last message (used for removing thinking bubble)
@@ -275,19 +478,28 @@ func (m *Model) removeLastMessage() {
 // clearMessages clears all messages from history
 func (m *Model) clearMessages() {
 	m.messages = []Message{}
+	m.askIndex = -1 // A streaming answer no longer has a message to go to
+	m.suggestionMessages = nil
 	m.addMessage("History cleared", MessageTypeSystem)
 }
 
 // updateViewportContent updates the viewport with current messages
 func (m *Model) updateViewportContent() {
-	var content string
-	for i, msg := range m.messages {
-		if i > 0 {
-			content += "\n"
+	var content strings.Builder
+	for _, msg := range m.messages {
+		if m.hidden(msg) {
+			continue
+		}
+		if content.Len() > 0 {
+			content.WriteString("\n")
 		}
-		content += FormatMessage(msg)
+		if msg.Type == MessageTypeFrame {
+			content.WriteString(renderFrame(msg.Content, m.viewport.Width))
+			continue
+		}
+		content.WriteString(FormatMessage(msg))
 	}
-	m.viewport.SetContent(content)
+	m.viewport.SetContent(content.String())
 	// Scroll to bottom
 	m.viewport.GotoBottom()
 }
@@ -317,9 +529,40 @@ func (m *Model) handleWindowSizeMsg(msg tea.WindowSizeMsg) {
 // handleInputSubmit processes user input submission
 func (m *Model) handleInputSubmit() tea.Cmd {
 	input := m.input.Value()
-	if input == "" {
+
+	// Collect a line of standard input; empty lines are input too
+	if m.inStdinMode {
+		m.addStdinLine(input)
+		return nil
+	}
+
+	// Answer the prompt of the running command; an empty answer takes its default
+	if m.inPromptMode {
+		m.answerPrompt(input)
+		return nil
+	}
+
+	// Enter on an empty input runs the highlighted suggestion
+	if m.inSelectionMode && input == "" {
+		return m.handleCommandSelection(m.highlighted)
+	}
+
+	// Blank input does nothing; whitespace alone is cleared with a hint
+	if strings.TrimSpace(input) == "" {
+		if input != "" {
+			m.input.SetValue("")
+			if !m.inConfirmationMode && !m.inEditMode && !m.waitingAPIKey && !m.onboarding {
+				m.addMessage("💡 Type a request, a /command or !<command>", MessageTypeSystem)
+			}
+		}
 		return nil
 	}
+	input = strings.TrimSpace(input)
+
+	// Handle typed confirmation of a critical command
+	if m.inConfirmationMode && m.requiredConfirmation != "" {
+		return m.handleTypedConfirmation(input)
+	}
 
 	// Handle edit mode input
 	if m.inEditMode {
@@ -336,11 +579,28 @@ func (m *Model) handleInputSubmit() tea.Cmd {
 		return m.handleDirectCommand(input)
 	}
 
+	// A slash alone points to the command list instead of going to the AI
+	if input == "/" {
+		m.input.SetValue("")
+		m.addMessage("💡 Type a command after /, e.g. /help to list all commands", MessageTypeSystem)
+		return nil
+	}
+
 	// Check if input is a command
 	if cmd := ParseCommand(input); cmd != nil {
 		return m.handleCommand(cmd)
 	}
 
+	// Handle first-run provider choice
+	if m.onboarding {
+		return m.handleOnboardingChoice(input)
+	}
+
+	// A leading @model or trailing --model=model picks the model for this request only
+	if request, model := ParseModelOverride(input); model != "" {
+		return m.handleModelOverrideRequest(input, request, model)
+	}
+
 	// Regular AI request processing
 	return m.handleAIRequest(input)
 }
@@ -351,6 +611,9 @@ func (m *Model) handleCommand(cmd *Command) tea.Cmd {
 	m.addMessage(cmd.Raw, MessageTypeUser)
 	m.input.SetValue("")
 
+	// What the command reports right away stays visible in quiet mode
+	defer m.startReply()()
+
 	switch cmd.Type {
 	case CommandTypeHelp:
 		return m.handleHelpCommand()
@@ -360,6 +623,57 @@ func (m *Model) handleCommand(cmd *Command) tea.Cmd {
 		return m.handleProviderCommand(cmd.Args)
 	case CommandTypeModel:
 		return m.handleModelCommand(cmd.Args)
+	case CommandTypeReset:
+		return m.handleResetCommand()
+	case CommandTypeMemory:
+		return m.handleMemoryCommand(cmd.Args)
+	case CommandTypeOffline:
+		return m.handleOfflineCommand(cmd.Args)
+	case CommandTypeCreativity:
+		return m.handleCreativityCommand(cmd.Args)
+	case CommandTypeSummarize:
+		return m.summarizeOutput()
+	case CommandTypeProviders:
+		return m.handleProvidersCommand(cmd.Args)
+	case CommandTypePinMsg:
+		m.handlePinMsgCommand(cmd.Args)
+		return nil
+	case CommandTypeRun:
+		return m.handleRunCommand(cmd.Args)
+	case CommandTypeThink:
+		return m.handleThinkCommand(cmd.Args)
+	case CommandTypeQuiet:
+		return m.handleQuietCommand(cmd.Args)
+	case CommandTypeAsk:
+		return m.handleAskCommand(cmd.Args)
+	case CommandTypeFav:
+		return m.handleFavCommand(cmd)
+	case CommandTypeParanoid:
+		return m.handleParanoidCommand(cmd.Args)
+	case CommandTypeTrim:
+		return m.handleTrimCommand()
+	case CommandTypeConfig:
+		return m.handleConfigCommand(cmd.Args)
+	case CommandTypeUndo:
+		return m.handleUndoCommand()
+	case CommandTypeFormat:
+		return m.handleFormatCommand(cmd.Args)
+	case CommandTypeUntrust:
+		return m.handleUntrustCommand(cmd.Args)
+	case CommandTypeReload:
+		return m.handleReloadCommand()
+	case CommandTypeCopyConfig:
+		m.handleCopyConfigCommand()
+		return nil
+	case CommandTypeJobs:
+		m.handleJobsCommand()
+		return nil
+	case CommandTypeJob:
+		m.handleJobCommand(cmd.Args)
+		return nil
+	case CommandTypeKill:
+		m.handleKillCommand(cmd.Args)
+		return nil
 	default:
 		m.addMessage("Unknown command: "+cmd.Type+". Type /help for available commands.", MessageTypeError)
 		return nil
@@ -370,10 +684,45 @@ func (m *Model) handleCommand(cmd *Command) tea.Cmd {
 func (m *Model) handleAIRequest(input string) tea.Cmd {
 	// Add user message to history
 	m.addMessage(input, MessageTypeUser)
+	return m.requestSuggestions(input)
+}
+
+// requestSuggestions searches memory and asks the AI for commands for input
+func (m *Model) requestSuggestions(input string) tea.Cmd {
+	return m.requestSuggestionsWithModel(input, "")
+}
+
+// requestSuggestionsWithModel is requestSuggestions asking model instead of
+// the current model; an empty model uses the current one
+func (m *Model) requestSuggestionsWithModel(input, model string) tea.Cmd {
+	aiService := m.aiService
+	return m.startSuggestionRequest(input, func(ctx context.Context) (*ai.CompletionResponse, error) {
+		if model != "" {
+			return aiService.SuggestCommandsWithModel(ctx, input, model)
+		}
+		return aiService.SuggestCommands(ctx, input)
+	})
+}
+
+// thinkingMessage returns the message shown while the AI works on a request,
+// followed by dots
+func (m *Model) thinkingMessage(dots string) string {
+	return "🤖 " + m.thinkingText + dots
+}
+
+// startSuggestionRequest searches memory for input and sends the AI request
+// made by suggest
+func (m *Model) startSuggestionRequest(input string, suggest func(ctx context.Context) (*ai.CompletionResponse, error)) tea.Cmd {
+	if match, ok := m.aiService.GetPromptBuilder().MatchTemplate(input); ok {
+		m.addMessage(formatTemplateMatch(match), MessageTypeSystem)
+	}
 
 	// Store the user request for later memory saving
 	m.lastUserRequest = input
 
+	// Suggestions of a previous request are no longer selectable
+	m.clearSuggestions()
+
 	// Clear input and set processing state
 	m.input.SetValue("")
 	m.processing = true
@@ -384,7 +733,7 @@ func (m *Model) handleAIRequest(input string) tea.Cmd {
 
 	// Search memory first if enabled
 	var memoryCmd tea.Cmd
-	if m.memoryEnabled && m.memoryManager != nil {
+	if m.memoryActive() {
 		memoryCmd = tea.Cmd(func() tea.Msg {
 			options := memory.DefaultSearchOptions()
 			options.MaxResults = 3 // Limit memory suggestions
@@ -403,7 +752,7 @@ func (m *Model) handleAIRequest(input string) tea.Cmd {
 	// AI request command
 	aiCmd := tea.Cmd(func() tea.Msg {
 		// Add thinking bubble message
-		return addMessageMsg{Content: "🤖 思考中...", Type: MessageTypeSystem}
+		return addMessageMsg{Content: m.thinkingMessage("..."), Type: MessageTypeSystem}
 	})
 
 	// Start AI processing in background
@@ -412,10 +761,10 @@ func (m *Model) handleAIRequest(input string) tea.Cmd {
 		time.Sleep(100 * time.Millisecond)
 
 		// Run AI request in background
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), m.aiService.GetTimeout())
 		defer cancel()
 
-		response, err := m.aiService.SuggestCommands(ctx, input)
+		response, err := suggest(ctx)
 		if err != nil {
 			return aiResponseMsg{error: err}
 		}
@@ -428,10 +777,12 @@ func (m *Model) handleAIRequest(input string) tea.Cmd {
 				Description: cmd.Description,
 				Safe:        cmd.Safe,
 				Confidence:  cmd.Confidence,
+				Category:    cmd.Category,
 			})
 		}
 
-		return aiResponseMsg{suggestions: suggestions}
+		return aiResponseMsg{suggestions: suggestions, usage: response.Usage, cached: response.Cached, raw: response.Content,
+			estimate: response.Estimate}
 	})
 
 	// Return combined commands
@@ -455,10 +806,376 @@ func (m *Model) handleHelpCommand() tea.Cmd {
 func (m *Model) handleStatusCommand() tea.Cmd {
 	providerInfo := m.aiService.GetProviderInfo()
 	statusText := FormatStatusInfo(m.currentProvider, m.currentModel, providerInfo)
+	if m.memoryPaused {
+		statusText += "\nMemory: Off for this session"
+	}
 	m.addMessage(statusText, MessageTypeSystem)
 	return nil
 }
 
+// handleTrimCommand resends the last request with a minimal prompt, for
+// requests too large for the context window of the model
+func (m *Model) handleTrimCommand() tea.Cmd {
+	switch {
+	case m.lastUserRequest == "":
+		m.addMessage("❌ No request to resend", MessageTypeError)
+		return nil
+	case m.aiService == nil:
+		m.addMessage("❌ AI service not available", MessageTypeError)
+		return nil
+	}
+
+	input := m.lastUserRequest
+	m.addMessage("✂️  Resending without directory context and earlier exchanges: "+input, MessageTypeSystem)
+	aiService := m.aiService
+	return m.startSuggestionRequest(input, func(ctx context.Context) (*ai.CompletionResponse, error) {
+		return aiService.SuggestCommandsTrimmed(ctx, input)
+	})
+}
+
+// handleResetCommand clears the conversation context used for follow-up requests
+func (m *Model) handleResetCommand() tea.Cmd {
+	m.aiService.GetPromptBuilder().GetConversation().Reset()
+	m.addMessage("🔄 Conversation context cleared", MessageTypeSystem)
+	return nil
+}
+
+// handleOfflineCommand toggles offline mode, or sets it with "on"/"off"
+func (m *Model) handleOfflineCommand(args []string) tea.Cmd {
+	enabled := !m.aiService.IsOffline()
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "on":
+			enabled = true
+		case "off":
+			enabled = false
+		default:
+			m.addMessage("❌ Usage: /offline [on|off]", MessageTypeError)
+			return nil
+		}
+	}
+
+	m.SetOffline(enabled)
+	if enabled {
+		m.addMessage("📴 Offline mode enabled: using rule-based suggestions without contacting the provider", MessageTypeSystem)
+	} else {
+		m.addMessage("🌐 Offline mode disabled: suggestions come from "+m.currentProvider+" again", MessageTypeSystem)
+	}
+	return nil
+}
+
+// handleThinkCommand toggles showing the raw model response of later requests
+func (m *Model) handleThinkCommand(args []string) tea.Cmd {
+	enabled := !m.thinkMode
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "on":
+			enabled = true
+		case "off":
+			enabled = false
+		default:
+			m.addMessage("❌ Usage: /think [on|off]", MessageTypeError)
+			return nil
+		}
+	}
+
+	m.thinkMode = enabled
+	if enabled {
+		m.addMessage("🧠 Think mode on: the raw model response is shown with the suggestions", MessageTypeSystem)
+	} else {
+		m.addMessage("🧠 Think mode off", MessageTypeSystem)
+	}
+	return nil
+}
+
+// handleQuietCommand toggles or sets quiet mode
+func (m *Model) handleQuietCommand(args []string) tea.Cmd {
+	quiet := !m.quiet
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "on":
+			quiet = true
+		case "off":
+			quiet = false
+		default:
+			m.addMessage("❌ Usage: /quiet [on|off]", MessageTypeError)
+			return nil
+		}
+	}
+
+	if quiet {
+		m.addMessage("🤫 Quiet mode on: informational messages are hidden", MessageTypeSystem)
+	} else {
+		m.addMessage("🔊 Quiet mode off: hidden messages are shown again", MessageTypeSystem)
+	}
+	m.SetQuiet(quiet)
+	return nil
+}
+
+// handleParanoidCommand toggles or sets paranoid mode for the session
+func (m *Model) handleParanoidCommand(args []string) tea.Cmd {
+	confirmAll := !m.confirmAll
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "on":
+			confirmAll = true
+		case "off":
+			confirmAll = false
+		default:
+			m.addMessage("❌ Usage: /paranoid [on|off]", MessageTypeError)
+			return nil
+		}
+	}
+
+	m.SetConfirmAll(confirmAll)
+	if confirmAll {
+		m.addMessage("🛡️  Paranoid mode on: every command asks for confirmation before it runs", MessageTypeSystem)
+	} else {
+		m.addMessage("🛡️  Paranoid mode off: only risky commands ask for confirmation", MessageTypeSystem)
+	}
+	return nil
+}
+
+// handleCreativityCommand shows or sets the temperature preset for suggestions
+func (m *Model) handleCreativityCommand(args []string) tea.Cmd {
+	if len(args) == 0 {
+		creativity := m.aiService.GetCreativity()
+		if creativity == ai.CreativityDefault {
+			m.addMessage("🎨 Creativity: provider default. Use /creativity low|medium|high to change it", MessageTypeSystem)
+		} else {
+			m.addMessage(fmt.Sprintf("🎨 Creativity: %s (temperature %.1f)", creativity, creativity.Temperature()), MessageTypeSystem)
+		}
+		return nil
+	}
+
+	creativity, err := ai.ParseCreativity(args[0])
+	if err != nil {
+		m.addMessage("❌ "+err.Error(), MessageTypeError)
+		return nil
+	}
+
+	m.setCreativity(creativity)
+	return nil
+}
+
+// setCreativity applies a temperature preset to subsequent requests
+func (m *Model) setCreativity(creativity ai.Creativity) {
+	m.aiService.SetCreativity(creativity)
+	m.addMessage(fmt.Sprintf("🎨 Creativity set to %s (temperature %.1f) for the next requests",
+		creativity, creativity.Temperature()), MessageTypeSystem)
+}
+
+// SetOffline enables/disables offline mode for AI suggestions
+func (m *Model) SetOffline(enabled bool) *Model {
+	m.aiService.SetOffline(enabled)
+	return m
+}
+
+// SetQuiet hides informational system messages like the welcome banner and
+// tips, keeping requests, suggestions, command output, errors and answers to
+// slash commands. Hidden messages show again when quiet mode is turned off.
+func (m *Model) SetQuiet(quiet bool) *Model {
+	m.quiet = quiet
+	m.updateViewportContent()
+	return m
+}
+
+// SetMaxCost sets how many dollars the AI requests of the session may cost,
+// overriding max_cost of the config; 0 sets no limit
+func (m *Model) SetMaxCost(dollars float64) *Model {
+	m.aiService.SetBudget(dollars)
+	return m
+}
+
+// SetConfirmAll routes every command through the confirmation dialog, not
+// just dangerous ones (paranoid mode)
+func (m *Model) SetConfirmAll(enabled bool) *Model {
+	m.confirmAll = enabled
+	return m
+}
+
+// SetMemoryPaused turns reading from and saving to memory off (or back on) for the session
+func (m *Model) SetMemoryPaused(paused bool) *Model {
+	m.memoryPaused = paused
+	return m
+}
+
+// Close saves pending memory changes. Call it after the program exits.
+func (m Model) Close() {
+	if m.memoryManager != nil {
+		m.memoryManager.Flush()
+	}
+}
+
+// memoryActive reports whether memory should be searched and updated
+func (m *Model) memoryActive() bool {
+	return m.memoryEnabled && m.memoryManager != nil && !m.memoryPaused
+}
+
+// handleMemoryCommand handles memory listing, export and the session on/off toggle
+func (m *Model) handleMemoryCommand(args []string) tea.Cmd {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "off":
+			m.SetMemoryPaused(true)
+			m.addMessage("🔕 Memory off: nothing will be suggested from or saved to memory this session", MessageTypeSystem)
+			return nil
+		case "on":
+			m.SetMemoryPaused(false)
+			if !m.memoryEnabled || m.memoryManager == nil {
+				m.addMessage("❌ Memory is not available", MessageTypeError)
+				return nil
+			}
+			m.addMessage("💭 Memory on: suggestions and saving resumed", MessageTypeSystem)
+			return nil
+		}
+	}
+
+	if !m.memoryEnabled || m.memoryManager == nil {
+		m.addMessage("❌ Memory is not available", MessageTypeError)
+		return nil
+	}
+
+	args, format, err := memory.ExtractFormatFlag(args)
+	if err != nil {
+		m.addMessage("❌ "+err.Error(), MessageTypeError)
+		return nil
+	}
+
+	subcommand := "list"
+	if len(args) > 0 {
+		subcommand = strings.ToLower(args[0])
+	}
+
+	switch subcommand {
+	case "list":
+		entries := m.memoryManager.GetAll()
+		if len(entries) == 0 {
+			m.addMessage("💭 Memory is empty", MessageTypeSystem)
+			return nil
+		}
+
+		memory.SortByRecent(entries)
+
+		content, err := memory.FormatEntries(entries, format)
+		if err != nil {
+			m.addMessage("❌ "+err.Error(), MessageTypeError)
+			return nil
+		}
+		m.addMessage(fmt.Sprintf("💭 %d remembered commands:\n%s", len(entries), strings.TrimRight(content, "\n")), MessageTypeSystem)
+
+	case "export":
+		if len(args) < 2 {
+			m.addMessage("❌ Usage: /memory export <file> [--format table|plain|json]", MessageTypeError)
+			return nil
+		}
+
+		if err := m.memoryManager.ExportFormatted(args[1], format); err != nil {
+			m.addMessage("❌ Export failed: "+err.Error(), MessageTypeError)
+			return nil
+		}
+		m.addMessage(fmt.Sprintf("✅ Exported memory to %s (%s)", args[1], format), MessageTypeSystem)
+
+	case "delete":
+		if len(args) < 2 {
+			m.addMessage("❌ Usage: /memory delete <id>", MessageTypeError)
+			return nil
+		}
+
+		if err := m.memoryManager.Remove(args[1]); err != nil {
+			m.addMessage("❌ "+err.Error(), MessageTypeError)
+			return nil
+		}
+		m.addMessage(fmt.Sprintf("🗑️  Deleted memory entry %s", args[1]), MessageTypeSystem)
+
+	default:
+		m.addMessage("Unknown memory command: "+subcommand+". Use /memory list, /memory export <file>, /memory delete <id>, /memory on or /memory off.", MessageTypeError)
+	}
+
+	return nil
+}
+
+// rememberExchange records the command for the current request in the conversation context
+func (m *Model) rememberExchange(command string) {
+	if m.lastUserRequest == "" || command == "" {
+		return
+	}
+
+	conversation := m.aiService.GetPromptBuilder().GetConversation()
+	turns := conversation.Turns()
+	if len(turns) > 0 && turns[len(turns)-1].Request == m.lastUserRequest {
+		conversation.SetLastCommand(command)
+		return
+	}
+	conversation.Add(m.lastUserRequest, command)
+}
+
+// handlePinMsgCommand pins a note above the messages, or clears it without arguments
+func (m *Model) handlePinMsgCommand(args []string) {
+	text := utils.StripANSI(strings.Join(args, " "))
+	if text == "" {
+		if m.pinnedMessage == "" {
+			m.addMessage("💡 Usage: /pinmsg <text> to pin a note, /pinmsg to clear it", MessageTypeSystem)
+			return
+		}
+		m.pinnedMessage = ""
+		m.addMessage("📌 Pinned note cleared", MessageTypeSystem)
+		return
+	}
+
+	m.pinnedMessage = text
+	m.addMessage("📌 Note pinned above the messages", MessageTypeSystem)
+}
+
+// handleRunCommand expands a request template, e.g. `/run deploy env=prod`,
+// and lists the templates without arguments
+func (m *Model) handleRunCommand(args []string) tea.Cmd {
+	builder := m.aiService.GetPromptBuilder()
+	if len(args) == 0 {
+		m.addMessage(FormatRequestTemplates(builder.GetRequestTemplates()), MessageTypeSystem)
+		return nil
+	}
+
+	template, ok := builder.FindTemplate(args[0])
+	if !ok {
+		m.addMessage(fmt.Sprintf("❌ Unknown template: %s. Type /run to list templates.", args[0]), MessageTypeError)
+		return nil
+	}
+
+	variables, err := prompt.ParseTemplateArgs(args[1:])
+	if err == nil {
+		var match *prompt.TemplateMatch
+		if match, err = template.Fill(variables); err == nil {
+			return m.requestSuggestions(match.Request())
+		}
+	}
+	m.addMessage(fmt.Sprintf("❌ %v. Usage: %s", err, templateUsage(template)), MessageTypeError)
+	return nil
+}
+
+// handleProvidersCommand handles /providers: listing, or live checks with /providers test
+func (m *Model) handleProvidersCommand(args []string) tea.Cmd {
+	if len(args) == 0 {
+		return m.handleProviderCommand(nil)
+	}
+	if len(args) != 1 || strings.ToLower(args[0]) != "test" {
+		m.addMessage("❌ Usage: /providers [test]", MessageTypeError)
+		return nil
+	}
+
+	m.addMessage("🔍 Testing providers...", MessageTypeSystem)
+	configManager := m.configManager
+	return tea.Cmd(func() tea.Msg {
+		probes := m.aiService.ProbeProviders(context.Background(), func(provider ai.ProviderType) string {
+			if configManager == nil {
+				return ""
+			}
+			return configManager.GetProviderKey(string(provider))
+		})
+		return addMessageMsg{Content: FormatProviderProbes(probes), Type: MessageTypeSystem, Reply: true}
+	})
+}
+
 // handleProviderCommand handles provider switching
 func (m *Model) handleProviderCommand(args []string) tea.Cmd {
 	if len(args) == 0 {
@@ -478,7 +1195,7 @@ func (m *Model) handleProviderCommand(args []string) tea.Cmd {
 			}
 
 			formatted := FormatProviderList(providerStatus, m.currentProvider)
-			return addMessageMsg{Content: formatted, Type: MessageTypeSystem}
+			return addMessageMsg{Content: formatted, Type: MessageTypeSystem, Reply: true}
 		})
 	}
 
@@ -496,7 +1213,7 @@ func (m *Model) handleProviderCommand(args []string) tea.Cmd {
 			}
 		}
 
-		if config.APIKey == "" {
+		if config.APIKey == "" && ai.RequiresAPIKey(providerType) {
 			// Need API key
 			return apiKeyInputMsg{
 				providerType: providerName,
@@ -526,7 +1243,7 @@ func (m *Model) handleModelCommand(args []string) tea.Cmd {
 	if len(args) == 0 {
 		// List models
 		return tea.Cmd(func() tea.Msg {
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			ctx, cancel := context.WithTimeout(context.Background(), m.aiService.GetTimeout())
 			defer cancel()
 
 			models, err := m.aiService.GetAvailableModels(ctx)
@@ -534,12 +1251,19 @@ func (m *Model) handleModelCommand(args []string) tea.Cmd {
 		})
 	}
 
-	// Switch model
+	// Switch model, resolving aliases such as "fast" or "smart"
 	modelName := args[0]
 	return tea.Cmd(func() tea.Msg {
+		alias := ""
+		if resolved, ok := m.aiService.ResolveModelAlias(modelName); ok {
+			alias = modelName
+			modelName = resolved
+		}
+
 		err := m.aiService.SwitchModel(modelName)
 		return modelSwitchMsg{
 			modelName: modelName,
+			alias:     alias,
 			success:   err == nil,
 			error:     err,
 		}
@@ -564,6 +1288,35 @@ func (m *Model) handleAPIKeyInput(input string) tea.Cmd {
 	})
 }
 
+// aiErrorHint returns guidance for a failed AI request based on its cause,
+// or an empty string for causes without advice
+func (m *Model) aiErrorHint(err error) string {
+	var aiErr *ai.AIError
+	switch {
+	case errors.Is(err, ai.ErrAPIKeyMissing):
+		return "💡 Try: /provider openrouter (to configure provider with API key)"
+	case errors.Is(err, ai.ErrAPIKeyInvalid):
+		return "💡 " + m.currentProvider + " rejected the API key - check it in " + m.configPathForDisplay() + " or the provider's API key environment variable"
+	case errors.Is(err, ai.ErrRateLimitExceeded):
+		return "💡 Rate limit exceeded - please wait a moment and try again"
+	case errors.Is(err, ai.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "💡 Network timeout - check your internet connection and try again"
+	case errors.Is(err, ai.ErrHostNotFound):
+		return "💡 The provider's host could not be resolved - you seem to be offline or DNS is failing. /offline on gives rule-based suggestions meanwhile"
+	case errors.Is(err, ai.ErrConnectionRefused):
+		return "💡 The connection was refused - check that the server is running (e.g. ollama serve) and the endpoint in " + m.configPathForDisplay()
+	case errors.Is(err, ai.ErrProviderNotAvailable):
+		return "💡 " + m.currentProvider + " is not available right now - try again later or switch with /provider"
+	case errors.Is(err, ai.ErrBudgetExceeded):
+		return "💸 Raise the budget with /config set max_cost <dollars>, or switch to a free or local model (/provider ollama)"
+	case errors.Is(err, ai.ErrContextTooLong):
+		return "💡 Type /trim to resend it without the directory context and earlier exchanges, or pick a model with a larger context window (Ctrl+P or /model)"
+	case errors.As(err, &aiErr) && aiErr.Type == ai.ErrorTypeTruncated:
+		return "💡 Response truncated - increase max_tokens in " + m.configPathForDisplay() + " and try again"
+	}
+	return ""
+}
+
 // handleAIResponse handles AI response messages
 func (m *Model) handleAIResponse(msg aiResponseMsg) {
 	m.processing = false
@@ -571,6 +1324,7 @@ func (m *Model) handleAIResponse(msg aiResponseMsg) {
 
 	// Remove thinking bubble message
 	m.removeLastMessage()
+	m.trackRateLimit(msg.error)
 
 	if msg.error != nil {
 		// Handle AI error with more context
@@ -578,20 +1332,25 @@ func (m *Model) handleAIResponse(msg aiResponseMsg) {
 		m.addMessage(errorMsg, MessageTypeError)
 
 		// Provide helpful suggestions based on error type
-		if strings.Contains(msg.error.Error(), "not configured") || strings.Contains(msg.error.Error(), "API key") {
-			m.addMessage("💡 Try: /provider openrouter (to configure provider with API key)", MessageTypeSystem)
-		} else if strings.Contains(msg.error.Error(), "timeout") || strings.Contains(msg.error.Error(), "context deadline") {
-			m.addMessage("💡 Network timeout - check your internet connection and try again", MessageTypeSystem)
-		} else if strings.Contains(msg.error.Error(), "rate limit") {
-			m.addMessage("💡 Rate limit exceeded - please wait a moment and try again", MessageTypeSystem)
+		if hint := m.aiErrorHint(msg.error); hint != "" {
+			m.addMessage(hint, MessageTypeSystem)
 		}
 
 		m.status = fmt.Sprintf("Error - %s • %s", m.currentProvider, m.currentModel)
 		return
 	}
 
+	if m.thinkMode && msg.raw != "" {
+		m.addMessage("Raw model response:\n"+strings.TrimSpace(msg.raw), MessageTypeRaw)
+	}
+	if m.thinkMode && msg.estimate != nil {
+		m.addMessage("📏 Prompt size: "+msg.estimate.String(), MessageTypeSystem)
+	}
+
 	if len(msg.suggestions) == 0 {
-		m.addMessage("No command suggestions available", MessageTypeSystem)
+		if len(m.memorySuggestions) == 0 {
+			m.addMessage("No command suggestions available", MessageTypeSystem)
+		}
 		m.status = fmt.Sprintf("Ready - %s • %s", m.currentProvider, m.currentModel)
 		return
 	}
@@ -599,24 +1358,25 @@ func (m *Model) handleAIResponse(msg aiResponseMsg) {
 	// Store suggestions for potential selection
 	m.suggestions = msg.suggestions
 	m.availableSuggestions = msg.suggestions
-	m.inSelectionMode = true // Enable selection mode
-
-	// Display suggestions
-	for i, suggestion := range msg.suggestions {
-		safetyIndicator := "✓"
-		if !suggestion.Safe {
-			safetyIndicator = "⚠"
-		}
 
-		confidencePercent := int(suggestion.Confidence * 100)
-		suggestionText := fmt.Sprintf("%d. %s %s (%d%% confidence)\n   %s",
-			i+1, safetyIndicator, suggestion.Command, confidencePercent, suggestion.Description)
+	// Merge with memory suggestions into a single numbered list
+	m.handleCombinedSuggestions(combinedSuggestionsMsg{
+		userRequest:       m.lastUserRequest,
+		aiSuggestions:     msg.suggestions,
+		memorySuggestions: m.memorySuggestions,
+	})
 
-		m.addMessage(suggestionText, MessageTypeAssistant)
+	// Local providers report timing, which helps tuning model performance.
+	// Cached responses keep the timing of the original request, so skip it.
+	if msg.cached {
+		m.addMessage("⚡ Suggestions served from cache", MessageTypeSystem)
+	} else if msg.usage.HasTiming() {
+		m.addMessage(FormatUsageTiming(msg.usage), MessageTypeSystem)
 	}
 
-	// Add instruction message
-	m.addMessage("💡 Use 1-9 to select a command, 'e' to edit first command, or type a new request", MessageTypeSystem)
+	// Remember the top suggestion so follow-up requests can refer to it
+	m.rememberExchange(m.combinedSuggestions[0].Command)
+
 	m.status = fmt.Sprintf("Ready - %s • %s", m.currentProvider, m.currentModel)
 }
 
@@ -628,92 +1388,125 @@ func (m *Model) handleCommandSelection(index int) tea.Cmd {
 		return nil
 	}
 
-	// First check if user is selecting from memory suggestions (they use M1, M2, etc format)
-	// For simplicity, we'll handle this in the number input parsing instead
-
-	// Handle memory suggestions first (if any)
-	if len(m.memorySuggestions) > 0 {
-		// If index is within memory range, select from memory
-		if index < len(m.memorySuggestions) {
-			return m.handleMemorySelection(memorySelectionMsg{index: index})
-		}
-		// Adjust index for AI suggestions (they come after memory suggestions)
-		index -= len(m.memorySuggestions)
-	}
-
-	// Handle AI suggestions
-	if len(m.availableSuggestions) == 0 {
-		m.addMessage("❌ No AI commands available to select", MessageTypeError)
+	if len(m.combinedSuggestions) == 0 {
+		m.addMessage("❌ No commands available to select", MessageTypeError)
 		return nil
 	}
 
-	// Check if adjusted index is valid for AI suggestions
-	if index < 0 || index >= len(m.availableSuggestions) {
-		totalSuggestions := len(m.memorySuggestions) + len(m.availableSuggestions)
-		m.addMessage(fmt.Sprintf("❌ Invalid selection. Please choose 1-%d", totalSuggestions), MessageTypeError)
+	// Indices refer to the unified memory + AI list
+	if index < 0 || index >= len(m.combinedSuggestions) {
+		m.addMessage(fmt.Sprintf("❌ Invalid selection. Please choose 1-%d", len(m.combinedSuggestions)), MessageTypeError)
 		return nil
 	}
 
 	// Track the last selected index
 	m.lastSelectedIndex = index
 
-	// Get the selected AI suggestion
-	selectedSuggestion := m.availableSuggestions[index]
+	selectedSuggestion := m.combinedSuggestions[index]
 
 	// Add confirmation message
-	safetyIcon := "✓"
-	if !selectedSuggestion.Safe {
-		safetyIcon = "⚠️"
+	if selectedSuggestion.FromMemory() {
+		m.addMessage(fmt.Sprintf("Selected from memory: %s", selectedSuggestion.Command), MessageTypeUser)
+	} else {
+		safetyIcon := "✓"
+		if !selectedSuggestion.Safe {
+			safetyIcon = "⚠️"
+		}
+		m.addMessage(fmt.Sprintf("Selected: %s %s", safetyIcon, selectedSuggestion.Command), MessageTypeUser)
 	}
+	m.rememberExchange(selectedSuggestion.Command)
+	if selectedSuggestion.FromMemory() {
+		m.recordAccepted(selectedSuggestion.Memory.Entry.ID)
+	}
+	m.copyOnSelect(selectedSuggestion.Command)
 
-	m.addMessage(fmt.Sprintf("Selected: %s %s", safetyIcon, selectedSuggestion.Command), MessageTypeUser)
+	msg := commandExecutionMsg{
+		command:     selectedSuggestion.Command,
+		description: selectedSuggestion.Description,
+		safe:        selectedSuggestion.Safe,
+		confidence:  selectedSuggestion.Confidence,
+		runMode:     m.selectionRunMode,
+	}
 
 	// Clear selection mode
-	m.inSelectionMode = false
-	m.availableSuggestions = []aiSuggestion{}
-	m.memorySuggestions = []memorySuggestion{}
+	m.clearSuggestions()
 
 	// Return command to execute the selected command
-	return CommandExecutionCmd(
-		selectedSuggestion.Command,
-		selectedSuggestion.Description,
-		selectedSuggestion.Safe,
-		selectedSuggestion.Confidence,
-	)
+	return func() tea.Msg { return msg }
 }
 
 // handleCommandExecution handles the execution of a selected command
 func (m *Model) handleCommandExecution(msg commandExecutionMsg) tea.Cmd {
-	// Perform detailed safety analysis using utils package
-	isDangerous := utils.IsDangerousCommand(msg.command)
-
-	// If command is dangerous or AI marked it as unsafe, request confirmation
-	if isDangerous || !msg.safe {
-		var reason string
-		if isDangerous {
-			reason = "Command contains potentially dangerous operations"
-		} else {
-			reason = "AI confidence indicates this command may be risky"
+	// The checks below look at what actually runs, which for a session alias
+	// is its expansion
+	msg.resolved = m.executor.Resolve(msg.command)
+
+	// A program that is not installed only fails with "command not found"
+	if !msg.programChecked {
+		if program := m.executor.MissingProgram(msg.resolved); program != "" {
+			m.offerMissingProgram(program, msg)
+			return nil
 		}
+	}
 
+	// Perform detailed safety analysis using utils package, including what
+	// the globs and variables of an rm expand to
+	danger := m.executor.ExplainDanger(msg.resolved)
+	dangerLevel := danger.Level
+	isDangerous := dangerLevel != utils.DangerNone
+
+	// A command only the AI flagged, which the user kept confirming, runs
+	// without asking; see trust.go
+	if !isDangerous && !msg.safe && !m.confirmAll && m.trusted(msg.resolved) {
+		m.addMessage("🤝 Trusted, running without confirmation (/untrust to ask again)", MessageTypeSystem)
+		msg.safe = true
+	}
+
+	// If command is dangerous or AI marked it as unsafe, request confirmation;
+	// paranoid mode confirms every command
+	if isDangerous || !msg.safe || m.confirmAll {
 		// Store the pending command and enter confirmation mode
 		m.pendingCommand = msg
 		m.inConfirmationMode = true
 
 		// Display confirmation dialog
-		m.addMessage(fmt.Sprintf("⚠️  SAFETY WARNING: %s", reason), MessageTypeError)
-		m.addMessage(fmt.Sprintf("🔍 Command: %s", msg.command), MessageTypeSystem)
+		switch {
+		case isDangerous:
+			m.addMessage("⚠️  SAFETY WARNING: Command contains potentially dangerous operations", MessageTypeError)
+		case !msg.safe:
+			m.addMessage("⚠️  SAFETY WARNING: AI confidence indicates this command may be risky", MessageTypeError)
+		default:
+			m.addMessage("🛡️  Paranoid mode: confirm before running", MessageTypeSystem)
+		}
+		if msg.resolved != msg.command {
+			m.addMessage(fmt.Sprintf("🔍 Command: %s (alias %s)", msg.resolved, executor.CommandProgram(msg.command)), MessageTypeSystem)
+		} else {
+			m.addMessage(fmt.Sprintf("🔍 Command: %s", msg.command), MessageTypeSystem)
+		}
+		if isDangerous {
+			m.addMessage("🚩 Reason: "+danger.String(), MessageTypeSystem)
+		}
 
 		if msg.description != "" {
 			m.addMessage(fmt.Sprintf("📝 Description: %s", msg.description), MessageTypeSystem)
 		}
 
-		confidencePercent := int(msg.confidence * 100)
-		m.addMessage(fmt.Sprintf("🎯 AI Confidence: %d%%", confidencePercent), MessageTypeSystem)
+		m.addMessage("🎯 AI Confidence: "+FormatConfidence(msg.confidence), MessageTypeSystem)
+
+		if dangerLevel == utils.DangerCritical {
+			// A single key is too easy to fumble for irreversible commands
+			m.requiredConfirmation = criticalConfirmationPhrase
+			m.input.SetValue("")
+			m.input.Placeholder = fmt.Sprintf("Type '%s' to confirm...", criticalConfirmationPhrase)
+
+			m.addMessage("🛑 CRITICAL: This command can irreversibly destroy data or the system", MessageTypeError)
+			m.addMessage(fmt.Sprintf("⌨️  Type '%s' and press Enter to proceed, Esc to cancel, or ? to see what it does", criticalConfirmationPhrase), MessageTypeSystem)
+			return m.previewDeletion()
+		}
 
 		m.addMessage("❓ Do you want to proceed?", MessageTypeSystem)
-		m.addMessage("💡 Press 'y' to confirm, 'n' to cancel", MessageTypeSystem)
-		return nil
+		m.addMessage("💡 Press 'y' to confirm, 'n' to cancel, 'e' to edit it first, '?' to see what the command does", MessageTypeSystem)
+		return m.previewDeletion()
 	}
 
 	// Command is safe, proceed with execution
@@ -723,12 +1516,11 @@ func (m *Model) handleCommandExecution(msg commandExecutionMsg) tea.Cmd {
 		m.addMessage(fmt.Sprintf("📝 %s", msg.description), MessageTypeSystem)
 	}
 
-	confidencePercent := int(msg.confidence * 100)
-	m.addMessage(fmt.Sprintf("🎯 Confidence: %d%%", confidencePercent), MessageTypeSystem)
+	m.addMessage("🎯 Confidence: "+FormatConfidence(msg.confidence), MessageTypeSystem)
 
 	// Save to memory before execution
 	var memorySaveCmd tea.Cmd
-	if m.lastUserRequest != "" && m.memoryEnabled {
+	if m.lastUserRequest != "" && m.memoryActive() && !msg.undo {
 		memorySaveCmd = MemorySaveCmd(
 			m.lastUserRequest,
 			msg.command,
@@ -739,7 +1531,7 @@ func (m *Model) handleCommandExecution(msg commandExecutionMsg) tea.Cmd {
 	}
 
 	// Execute the command
-	executeCmd := m.executeCommand(msg.command, msg.description)
+	executeCmd := m.executeCommandIn(msg.command, msg.description, msg.runMode)
 
 	if memorySaveCmd != nil {
 		return tea.Batch(memorySaveCmd, executeCmd)
@@ -748,6 +1540,66 @@ func (m *Model) handleCommandExecution(msg commandExecutionMsg) tea.Cmd {
 	return executeCmd
 }
 
+// lookupCommandHelp looks up the man page summary or --help output of the
+// command awaiting confirmation in the background
+func (m *Model) lookupCommandHelp() tea.Cmd {
+	command := m.pendingCommand.resolved
+	cmdExecutor := m.executor
+	m.addMessage("📖 Looking up "+executor.CommandProgram(command)+"...", MessageTypeSystem)
+
+	return func() tea.Msg {
+		help, err := cmdExecutor.LookupHelp(context.Background(), command)
+		return commandHelpMsg{command: command, help: help, error: err}
+	}
+}
+
+// handleCommandHelp shows the help of the command awaiting confirmation
+func (m *Model) handleCommandHelp(msg commandHelpMsg) {
+	if msg.error != nil {
+		m.addMessage("📖 "+msg.error.Error(), MessageTypeSystem)
+	} else {
+		m.addMessage("📖 "+utils.StripANSI(msg.help), MessageTypeSystem)
+	}
+
+	if m.inConfirmationMode && m.pendingCommand.resolved == msg.command {
+		if m.requiredConfirmation != "" {
+			m.addMessage(fmt.Sprintf("⌨️  Type '%s' to proceed, or Esc to cancel", criticalConfirmationPhrase), MessageTypeSystem)
+		} else {
+			m.addMessage("❓ Run it? Press 'y' to confirm, 'n' to cancel, 'e' to edit it first", MessageTypeSystem)
+		}
+	}
+}
+
+// previewDeletion lists what the command awaiting confirmation would delete
+// in the background, if it deletes files through find or xargs and has a
+// read-only variant
+func (m *Model) previewDeletion() tea.Cmd {
+	command := m.pendingCommand.command
+	if _, ok := utils.DeletionPreview(m.pendingCommand.resolved); !ok {
+		return nil
+	}
+	cmdExecutor := m.executor
+
+	return func() tea.Msg {
+		impact, err := cmdExecutor.PreviewDeletion(context.Background(), command)
+		return deletionPreviewMsg{command: command, impact: impact, error: err}
+	}
+}
+
+// handleDeletionPreview shows what the command awaiting confirmation would
+// delete, unless the confirmation is over
+func (m *Model) handleDeletionPreview(msg deletionPreviewMsg) {
+	if !m.inConfirmationMode || m.pendingCommand.command != msg.command {
+		return
+	}
+
+	if msg.error != nil {
+		m.addMessage("🔍 Could not check what would be deleted: "+msg.error.Error(), MessageTypeSystem)
+		return
+	}
+	m.addMessage(executor.FormatDeletionImpact(msg.impact), MessageTypeSystem)
+}
+
 // handleConfirmationResponse handles user's response to confirmation dialog
 func (m *Model) handleConfirmationResponse(confirmed bool) tea.Cmd {
 	if !m.inConfirmationMode {
@@ -757,7 +1609,12 @@ func (m *Model) handleConfirmationResponse(confirmed bool) tea.Cmd {
 
 	// Exit confirmation mode
 	m.inConfirmationMode = false
+	if m.requiredConfirmation != "" {
+		m.requiredConfirmation = ""
+		m.input.Placeholder = "Type your command request here..."
+	}
 
+	m.recordConfirmation(m.pendingCommand, confirmed)
 	if confirmed {
 		m.addMessage("✅ Command confirmed by user", MessageTypeSystem)
 
@@ -769,11 +1626,19 @@ func (m *Model) handleConfirmationResponse(confirmed bool) tea.Cmd {
 			m.addMessage(fmt.Sprintf("📝 %s", cmd.description), MessageTypeSystem)
 		}
 
-		confidencePercent := int(cmd.confidence * 100)
-		m.addMessage(fmt.Sprintf("🎯 Confidence: %d%%", confidencePercent), MessageTypeSystem)
+		m.addMessage("🎯 Confidence: "+FormatConfidence(cmd.confidence), MessageTypeSystem)
+
+		// The user just confirmed, so the program need not ask again; a
+		// streamed command would stall on its question. In the full terminal
+		// the user answers it as usual.
+		command := cmd.command
+		if withYes := executor.AssumeYes(command); withYes != "" && !m.runsInTerminal(command, cmd.runMode) {
+			m.addMessage("⏩ Answering its own questions with yes, as you confirmed: "+withYes, MessageTypeSystem)
+			command = withYes
+		}
 
 		// Execute the command - return the command for execution
-		return m.executeCommand(cmd.command, cmd.description)
+		return m.executeCommandIn(command, cmd.description, cmd.runMode)
 
 	} else {
 		m.addMessage("❌ Command execution cancelled by user", MessageTypeSystem)
@@ -786,6 +1651,38 @@ func (m *Model) handleConfirmationResponse(confirmed bool) tea.Cmd {
 	return nil
 }
 
+// editPendingCommand leaves the confirmation dialog for edit mode with the
+// command awaiting confirmation, so an almost right command can be fixed. The
+// edited command goes through the safety check again.
+func (m *Model) editPendingCommand() {
+	if !m.inConfirmationMode {
+		return
+	}
+
+	pending := m.pendingCommand
+	m.inConfirmationMode = false
+	m.pendingCommand = commandExecutionMsg{}
+
+	m.enterEditMode(aiSuggestion{
+		Command:     pending.command,
+		Description: pending.description,
+		Safe:        pending.safe,
+		Confidence:  pending.confidence,
+	})
+}
+
+// handleTypedConfirmation checks the phrase typed to confirm a critical command
+func (m *Model) handleTypedConfirmation(input string) tea.Cmd {
+	m.input.SetValue("")
+
+	if !strings.EqualFold(strings.TrimSpace(input), m.requiredConfirmation) {
+		m.addMessage("❌ Confirmation phrase did not match", MessageTypeError)
+		return m.handleConfirmationResponse(false)
+	}
+
+	return m.handleConfirmationResponse(true)
+}
+
 // handleConfirmationRequest handles a confirmation request message
 func (m *Model) handleConfirmationRequest(msg confirmationRequestMsg) {
 	// This method could be used for external confirmation requests
@@ -815,37 +1712,143 @@ func (m *Model) handleConfirmationResponseMsg(msg confirmationResponseMsg) {
 
 // executeCommand executes a command using the executor
 func (m *Model) executeCommand(command, description string) tea.Cmd {
+	return m.executeCommandIn(command, description, runModeAuto)
+}
+
+// executeCommandIn is executeCommand running command in mode instead of the
+// mode detected for it; sudo always runs in full terminal mode
+func (m *Model) executeCommandIn(command, description string, mode runMode) tea.Cmd {
 	// Check if already executing a command
 	if m.executingCommand {
-		m.addMessage("⚠️  Another command is already running. Please wait for it to complete.", MessageTypeError)
+		m.addMessage("⚠️  Another command is already running. Please wait for it to complete, or end a direct command with & to run it in the background.", MessageTypeError)
+		return nil
+	}
+
+	// Each command runs in a fresh shell, so cd, export and alias are applied
+	// to the session instead, see shellstate.go
+	if change := m.executor.DetectStateChange(command); change != nil && m.applyStateChange(change) {
 		return nil
 	}
 
-	// Check if this is an interactive program that needs PTY
+	// Check if this is an interactive program that needs PTY, looking through
+	// a session alias; the PTY executor knows no aliases, so it is given the
+	// expansion. Keep in line with runsInTerminal.
+	resolved := m.executor.Resolve(command)
 	ptyExecutor := executor.NewPTYExecutor()
-	if ptyExecutor.IsTUIProgram(command) {
+	if executor.UsesSudo(resolved) {
+		// sudo prompts for the password on the terminal; it is typed straight into
+		// sudo and never passes through clia's input, logs or memory
+		m.addMessage(fmt.Sprintf("🔐 Command requires sudo: %s", command), MessageTypeSystem)
+		m.addMessage("💡 Running in full terminal mode so you can enter your password securely.", MessageTypeSystem)
+		return PTYExecutionRequestCmd(resolved, description)
+	}
+	if mode == runModeInteractive {
+		m.addMessage(fmt.Sprintf("🎮 Running in full terminal mode as chosen: %s", command), MessageTypeSystem)
+		m.addMessage("💡 Press any key when finished.", MessageTypeSystem)
+		return PTYExecutionRequestCmd(resolved, description)
+	}
+	if mode == runModeAuto && ptyExecutor.IsTUIProgram(resolved) {
 		m.addMessage(fmt.Sprintf("🎮 Running interactive program: %s", command), MessageTypeSystem)
 		m.addMessage("💡 The program will run in full terminal mode. Press any key when finished.", MessageTypeSystem)
-		return PTYExecutionRequestCmd(command, description)
+		return PTYExecutionRequestCmd(resolved, description)
 	}
 
+	// Commands waiting for standard input would otherwise see none
+	if executor.ReadsStdin(resolved) {
+		m.startStdinInput(command, description)
+		return nil
+	}
+
+	return m.runCommand(command, description, "")
+}
+
+// runsInTerminal reports whether executeCommandIn runs command in full
+// terminal mode rather than streaming its output
+func (m *Model) runsInTerminal(command string, mode runMode) bool {
+	resolved := m.executor.Resolve(command)
+	return executor.UsesSudo(resolved) || mode == runModeInteractive ||
+		(mode == runModeAuto && executor.NewPTYExecutor().IsTUIProgram(resolved))
+}
+
+// runCommand starts a regular command, feeding it stdin if not empty
+func (m *Model) runCommand(command, description, stdin string) tea.Cmd {
 	// Update execution state for regular commands
 	m.executingCommand = true
 	m.currentCommand = command
+	m.outputCommand = command
 	m.executionOutput = []string{}
 	m.executionResult = nil
+	m.planUndo(command)
 
 	// Start streaming command execution for regular commands
-	return m.startStreamingExecution(command, description)
+	return m.startStreamingExecution(command, description, stdin)
+}
+
+// startStdinInput collects standard input for command from the input line
+func (m *Model) startStdinInput(command, description string) {
+	m.inStdinMode = true
+	m.stdinCommand = command
+	m.stdinDescription = description
+	m.stdinLines = nil
+	m.input.SetValue("")
+	m.input.Placeholder = "Type a line of input..."
+
+	m.addMessage(fmt.Sprintf("📥 %s reads standard input", command), MessageTypeSystem)
+	m.addMessage("💡 Type it line by line, pressing Enter after each; Ctrl+D to end and run, Esc to cancel", MessageTypeSystem)
+}
+
+// addStdinLine adds a line to the standard input being collected
+func (m *Model) addStdinLine(line string) {
+	m.stdinLines = append(m.stdinLines, line)
+	m.input.SetValue("")
+	m.addMessage("⌨️  "+line, MessageTypeUser)
+}
+
+// finishStdinInput ends standard input collection, running the command with
+// the collected lines or cancelling it
+func (m *Model) finishStdinInput(run bool) tea.Cmd {
+	command, description := m.stdinCommand, m.stdinDescription
+	stdin := ""
+	if len(m.stdinLines) > 0 {
+		stdin = strings.Join(m.stdinLines, "\n") + "\n"
+	}
+
+	m.inStdinMode = false
+	m.stdinCommand = ""
+	m.stdinDescription = ""
+	m.stdinLines = nil
+	m.input.Placeholder = "Type your command request here..."
+
+	if !run {
+		m.addMessage("❌ Command execution cancelled", MessageTypeSystem)
+		return nil
+	}
+
+	// A line still in the input was meant to be sent too
+	if line := m.input.Value(); line != "" {
+		stdin += line + "\n"
+		m.input.SetValue("")
+	}
+
+	m.addMessage(fmt.Sprintf("📥 Sending %d line(s) of input", strings.Count(stdin, "\n")), MessageTypeSystem)
+	return m.runCommand(command, description, stdin)
 }
 
 // startStreamingExecution starts command execution with real-time output streaming
-func (m *Model) startStreamingExecution(command, description string) tea.Cmd {
+func (m *Model) startStreamingExecution(command, description, stdin string) tea.Cmd {
 	return tea.Cmd(func() tea.Msg {
 		ctx := context.Background()
 
-		// Start the command stream
-		outputChan, err := m.executor.Stream(ctx, command)
+		// Start the command stream; without collected input, its standard
+		// input stays open for answers to the prompts it asks
+		var outputChan <-chan executor.OutputLine
+		var input io.WriteCloser
+		var err error
+		if stdin != "" {
+			outputChan, err = m.executor.StreamWithInput(ctx, command, strings.NewReader(stdin))
+		} else {
+			outputChan, input, err = m.executor.StreamInteractive(ctx, command)
+		}
 		if err != nil {
 			return CommandErrorCmd(command, err)()
 		}
@@ -858,6 +1861,7 @@ func (m *Model) startStreamingExecution(command, description string) tea.Cmd {
 			command:     command,
 			description: description,
 			stream:      outputChan,
+			input:       input,
 		}
 	})
 }
@@ -871,7 +1875,7 @@ func (m *Model) handleCommandStart(msg commandStartMsg) {
 // handleCommandOutput handles command output message
 func (m *Model) handleCommandOutput(msg commandOutputMsg) {
 	// Add output to buffer
-	m.executionOutput = append(m.executionOutput, msg.content)
+	m.retainOutput(msg.content, msg.isStderr)
 
 	// Display output in TUI
 	outputType := MessageTypeAssistant
@@ -905,6 +1909,7 @@ func (m *Model) handleCommandComplete(msg commandCompleteMsg) {
 	if msg.stdout != "" {
 		lines := strings.Split(strings.TrimSpace(msg.stdout), "\n")
 		for _, line := range lines {
+			m.retainOutput(line, false)
 			if strings.TrimSpace(line) != "" {
 				m.addMessage(fmt.Sprintf("📤 %s", line), MessageTypeAssistant)
 			}
@@ -915,6 +1920,7 @@ func (m *Model) handleCommandComplete(msg commandCompleteMsg) {
 	if msg.stderr != "" {
 		lines := strings.Split(strings.TrimSpace(msg.stderr), "\n")
 		for _, line := range lines {
+			m.retainOutput(line, true)
 			if strings.TrimSpace(line) != "" {
 				m.addMessage(fmt.Sprintf("❌ %s", line), MessageTypeError)
 			}
@@ -930,6 +1936,10 @@ func (m *Model) handleCommandComplete(msg commandCompleteMsg) {
 			m.addMessage(fmt.Sprintf("Error: %s", msg.error.Error()), MessageTypeError)
 		}
 	}
+	m.offerUndo(msg.command, msg.exitCode == 0 && msg.error == nil)
+	if msg.exitCode == 0 {
+		m.offerFormattedOutput()
+	}
 
 	// Reset current command tracking
 	m.currentCommand = ""
@@ -963,7 +1973,7 @@ func (m *Model) enterEditMode(suggestion aiSuggestion) {
 	m.originalCommand = suggestion.Command
 
 	// Clear available suggestions since we're now editing
-	m.availableSuggestions = []aiSuggestion{}
+	m.clearSuggestions()
 
 	// Update input to show the command being edited
 	m.input.SetValue(suggestion.Command)
@@ -977,7 +1987,7 @@ func (m *Model) enterEditMode(suggestion aiSuggestion) {
 
 	m.addMessage(fmt.Sprintf("📝 Edit Mode: %s %s", safetyIcon, suggestion.Command), MessageTypeSystem)
 	m.addMessage(fmt.Sprintf("📋 Original: %s", suggestion.Description), MessageTypeSystem)
-	m.addMessage("💡 Edit the command above, then press Enter to execute or Escape to cancel", MessageTypeSystem)
+	m.addMessage("💡 Edit the command above, then press Enter to execute or Escape to cancel (Ctrl+O opens $EDITOR)", MessageTypeSystem)
 }
 
 // exitEditMode exits edit mode and returns to normal mode
@@ -997,6 +2007,8 @@ func (m *Model) exitEditMode(save bool) tea.Cmd {
 			m.addMessage(fmt.Sprintf("✅ Command unchanged: %s", editedCommand), MessageTypeSystem)
 		}
 
+		m.rememberExchange(editedCommand)
+
 		// Create execution message with edited command
 		cmd = CommandExecutionCmd(
 			editedCommand,
@@ -1038,15 +2050,9 @@ func (m *Model) handleEditModeInput() tea.Cmd {
 // handleDirectCommand handles direct command execution (starting with '!')
 func (m *Model) handleDirectCommand(input string) tea.Cmd {
 	// Extract the actual command by removing the '!' prefix
-	if len(input) < 2 {
-		m.addMessage("❌ Empty direct command. Usage: !<command>", MessageTypeError)
-		m.input.SetValue("")
-		return nil
-	}
-
-	command := strings.TrimSpace(input[1:])
+	command := strings.TrimSpace(strings.TrimPrefix(input, "!"))
 	if command == "" {
-		m.addMessage("❌ Empty direct command. Usage: !<command>", MessageTypeError)
+		m.addMessage("💡 Type a shell command after !, e.g. !ls -la. It runs directly, without AI or safety checks", MessageTypeSystem)
 		m.input.SetValue("")
 		return nil
 	}
@@ -1055,6 +2061,11 @@ func (m *Model) handleDirectCommand(input string) tea.Cmd {
 	m.addMessage(input, MessageTypeUser)
 	m.input.SetValue("")
 
+	// A trailing & runs the command as a background job
+	if command, background := backgroundCommand(command); background {
+		return m.startJob(command)
+	}
+
 	// Show direct execution message (no safety checks warning)
 	m.addMessage(fmt.Sprintf("⚡ Direct execution (no safety checks): %s", command), MessageTypeSystem)
 
@@ -1065,7 +2076,11 @@ func (m *Model) handleDirectCommand(input string) tea.Cmd {
 // handleCommandStreamStart handles the start of a command stream
 func (m *Model) handleCommandStreamStart(msg commandStreamStartMsg) tea.Cmd {
 	m.outputStream = msg.stream
+	m.commandInput = msg.input
 	m.streamActive = true
+	m.streamStartedAt = time.Now()
+	m.streamElapsed = 0
+	m.streamResult = nil
 
 	m.addMessage(fmt.Sprintf("🚀 Streaming: %s", msg.command), MessageTypeSystem)
 	if msg.description != "" {
@@ -1076,53 +2091,100 @@ func (m *Model) handleCommandStreamStart(msg commandStreamStartMsg) tea.Cmd {
 	return StreamTickCmd()
 }
 
-// handleStreamTick processes stream output from the running command
+// maxStreamBatch is the maximum number of output lines drained per stream tick
+const maxStreamBatch = 500
+
+// handleStreamTick drains the output currently available from the running
+// command (up to maxStreamBatch lines) and renders it with one viewport update
 func (m *Model) handleStreamTick() tea.Cmd {
 	if !m.streamActive || m.outputStream == nil {
 		return nil
 	}
 
-	// Non-blocking read from stream
-	select {
-	case output, ok := <-m.outputStream:
-		if !ok {
-			// Stream closed - reset all execution state
-			m.streamActive = false
-			m.outputStream = nil
-			m.executingCommand = false
+	m.streamElapsed = time.Since(m.streamStartedAt)
 
-			// Reset command tracking
-			command := m.currentCommand
-			m.currentCommand = ""
-			m.currentPID = 0
+	drained := 0
+	closed := false
 
-			// Add completion message
-			if command != "" {
-				m.addMessage(fmt.Sprintf("✅ Command completed: %s", command), MessageTypeSystem)
+drain:
+	for drained < maxStreamBatch {
+		// Non-blocking read from stream
+		select {
+		case output, ok := <-m.outputStream:
+			if !ok {
+				closed = true
+				break drain
+			}
+			if output.Result != nil {
+				m.streamResult = output.Result
+				continue
+			}
+			drained++
+			if !output.Partial {
+				m.retainOutput(output.Content, output.IsStderr)
+			}
+			if output.Prompt != nil {
+				m.dropPartial(output.IsStderr)
+				m.startPrompt(*output.Prompt)
+				continue
 			}
 
-			return nil
+			// Process the output line
+			m.showOutputLine(output)
+		default:
+			// No more data available right now
+			break drain
 		}
+	}
 
-		// Process the output line
-		if strings.TrimSpace(output.Content) != "" {
-			outputType := MessageTypeAssistant
-			prefix := "📤"
-			if output.IsStderr {
-				outputType = MessageTypeError
-				prefix = "❌"
-			}
+	if closed {
+		m.releaseCommandInput()
+	}
 
-			m.addMessage(fmt.Sprintf("%s %s", prefix, output.Content), outputType)
+	if closed && m.streamResult != nil {
+		// Report the exit code and duration sent by the executor
+		result := m.streamResult
+		m.streamResult = nil
+		m.handleStreamEnd(streamEndMsg{
+			command:  result.Command,
+			exitCode: result.ExitCode,
+			duration: result.Duration,
+			error:    result.Error,
+		})
+	} else if closed {
+		// Stream closed without a final status - reset all execution state
+		m.streamActive = false
+		m.outputStream = nil
+		m.executingCommand = false
+		m.partialMessages = nil
+		m.streamElapsed = 0
+
+		// Reset command tracking
+		command := m.currentCommand
+		m.currentCommand = ""
+		m.currentPID = 0
+
+		// Add completion message
+		if command != "" {
+			m.appendMessage(fmt.Sprintf("✅ Command completed: %s", command), MessageTypeSystem)
 		}
+	}
 
-		// Continue ticking
-		return StreamTickCmd()
+	if drained > 0 || closed {
+		m.updateViewportContent()
+	}
 
-	default:
-		// No data available, continue ticking
-		return StreamTickCmd()
+	if closed {
+		return nil
 	}
+
+	// More output is waiting, so check again right away instead of after the tick interval
+	if drained == maxStreamBatch {
+		return func() tea.Msg { return streamTickMsg{} }
+	}
+
+	// Continue ticking
+	return StreamTickCmd()
 }
 
 // handleStreamEnd handles the end of a command stream
@@ -1130,6 +2192,14 @@ func (m *Model) handleStreamEnd(msg streamEndMsg) {
 	m.streamActive = false
 	m.outputStream = nil
 	m.executingCommand = false
+	m.partialMessages = nil
+	m.streamElapsed = 0
+	m.executionResult = &executionResult{
+		Command:  msg.command,
+		ExitCode: msg.exitCode,
+		Duration: msg.duration,
+		Error:    msg.error,
+	}
 
 	// Update memory with execution result
 	if m.currentCommand != "" {
@@ -1145,6 +2215,10 @@ func (m *Model) handleStreamEnd(msg streamEndMsg) {
 			m.addMessage(fmt.Sprintf("Error: %s", msg.error.Error()), MessageTypeError)
 		}
 	}
+	m.offerUndo(msg.command, msg.exitCode == 0 && msg.error == nil)
+	if msg.exitCode == 0 {
+		m.offerFormattedOutput()
+	}
 
 	// Reset current command tracking
 	m.currentCommand = ""
@@ -1165,6 +2239,11 @@ func (m *Model) handleMemoryResults(msg memoryResultsMsg) {
 		return
 	}
 
+	// Ignore late results for a request that has since been replaced
+	if msg.query != m.lastUserRequest {
+		return
+	}
+
 	// Convert memory results to memory suggestions
 	m.memorySuggestions = make([]memorySuggestion, 0, len(msg.results))
 	for _, result := range msg.results {
@@ -1178,40 +2257,49 @@ func (m *Model) handleMemoryResults(msg memoryResultsMsg) {
 		}
 		m.memorySuggestions = append(m.memorySuggestions, suggestion)
 	}
+	m.recordPresented()
 
-	// Display memory suggestions immediately
-	m.addMessage("💭 Memory suggestions:", MessageTypeSystem)
-	for i, suggestion := range m.memorySuggestions {
-		safetyIcon := "✓"
-		if !suggestion.Entry.Success {
-			safetyIcon = "⚠"
-		}
+	// Display memory suggestions immediately, merged with AI ones if they already arrived
+	m.handleCombinedSuggestions(combinedSuggestionsMsg{
+		userRequest:       msg.query,
+		aiSuggestions:     m.availableSuggestions,
+		memorySuggestions: m.memorySuggestions,
+	})
+}
 
-		// Show usage count and last used time
-		timeAgo := time.Since(suggestion.LastUsed)
-		var timeStr string
-		if timeAgo < time.Hour {
-			timeStr = fmt.Sprintf("%.0fm ago", timeAgo.Minutes())
-		} else if timeAgo < 24*time.Hour {
-			timeStr = fmt.Sprintf("%.0fh ago", timeAgo.Hours())
-		} else {
-			timeStr = fmt.Sprintf("%.0fd ago", timeAgo.Hours()/24)
-		}
+// recordPresented counts that the memory suggestions were offered, so entries
+// that are regularly passed over rank lower
+func (m *Model) recordPresented() {
+	if !m.memoryActive() {
+		return
+	}
 
-		suggestionText := fmt.Sprintf("M%d. %s %s (used %dx, %s)\n    %s",
-			i+1, safetyIcon, suggestion.Entry.SelectedCommand,
-			suggestion.UsageCount, timeStr, suggestion.Entry.Description)
+	ids := make([]string, 0, len(m.memorySuggestions))
+	for _, suggestion := range m.memorySuggestions {
+		ids = append(ids, suggestion.Entry.ID)
+	}
+	m.memoryManager.RecordPresented(ids...)
+}
 
-		m.addMessage(suggestionText, MessageTypeAssistant)
+// recordAccepted counts that a memory suggestion was chosen, so it ranks higher
+func (m *Model) recordAccepted(entryID string) {
+	if !m.memoryActive() {
+		return
 	}
 
-	// Update selection mode to include memory suggestions
-	m.inSelectionMode = true
+	if err := m.memoryManager.RecordAccepted(entryID); err != nil {
+		log.Printf("Failed to record memory acceptance: %v", err)
+	}
 }
 
 // handleMemorySave processes memory save requests
 func (m *Model) handleMemorySave(msg memorySaveMsg) tea.Cmd {
-	if !m.memoryEnabled || m.memoryManager == nil {
+	if !m.memoryActive() {
+		return nil
+	}
+
+	// Never store commands that may carry a sudo password inline
+	if executor.SudoReadsPasswordFromStdin(msg.selectedCommand) {
 		return nil
 	}
 
@@ -1251,10 +2339,11 @@ func (m *Model) handleMemorySelection(msg memorySelectionMsg) tea.Cmd {
 
 	// Add confirmation message
 	m.addMessage(fmt.Sprintf("Selected from memory: %s", selectedMemory.Entry.SelectedCommand), MessageTypeUser)
+	m.rememberExchange(selectedMemory.Entry.SelectedCommand)
+	m.recordAccepted(selectedMemory.Entry.ID)
 
 	// Clear selection mode
-	m.inSelectionMode = false
-	m.memorySuggestions = []memorySuggestion{}
+	m.clearSuggestions()
 
 	// Execute the selected command
 	return CommandExecutionCmd(
@@ -1265,19 +2354,59 @@ func (m *Model) handleMemorySelection(msg memorySelectionMsg) tea.Cmd {
 	)
 }
 
-// handleCombinedSuggestions processes combined AI and memory suggestions
+// handleCombinedSuggestions merges memory and AI suggestions into a single
+// deduplicated, ranked list and displays it with unified numbering
 func (m *Model) handleCombinedSuggestions(msg combinedSuggestionsMsg) {
-	// This is called when we have both AI and memory suggestions
-	// For now, we display them separately, but this could be enhanced
-	// to merge and rank them together
+	m.combinedSuggestions = mergeSuggestions(msg.memorySuggestions, msg.aiSuggestions)
+	if len(m.combinedSuggestions) == 0 {
+		return
+	}
+
+	switch {
+	case len(msg.aiSuggestions) == 0:
+		m.addMessage("💭 Memory suggestions:", MessageTypeSystem)
+	case len(msg.memorySuggestions) > 0:
+		m.addMessage("📋 Suggestions from memory and AI:", MessageTypeSystem)
+	}
 
-	// AI suggestions are handled by existing handleAIResponse
-	// Memory suggestions are already displayed by handleMemoryResults
+	// Suggestions of different kinds are listed under category headers; the
+	// numbering stays continuous so the numbers still select them
+	grouped := false
+	m.combinedSuggestions, grouped = groupByCategory(m.combinedSuggestions)
+
+	// Narrow terminals get one line per suggestion, describing only the first
+	compact := UseCompactSuggestions(m.width, m.compactSuggestions)
+	m.unmarkSuggestions()
+	for i, suggestion := range m.combinedSuggestions {
+		if grouped && (i == 0 || ai.CategoryKey(suggestion.Category) != ai.CategoryKey(m.combinedSuggestions[i-1].Category)) {
+			m.addMessage(FormatCategory(suggestion.Category), MessageTypeSystem)
+		}
+		if compact {
+			m.addMessage(formatCompactSuggestion(i, suggestion, m.width, i == 0), MessageTypeAssistant)
+		} else {
+			m.addMessage(formatCombinedSuggestion(i, suggestion), MessageTypeAssistant)
+		}
+		m.suggestionMessages = append(m.suggestionMessages, len(m.messages)-1)
+	}
+	m.setHighlight(0)
+
+	m.inSelectionMode = true
+	m.addMessage("💡 Use ↑/↓ or j/k and Enter, or 1-9, to select a command, 'e' to edit the highlighted one, Ctrl+O to open it in $EDITOR, or type a new request; press Alt+I or Alt+S first to force full terminal or streaming mode", MessageTypeSystem)
+}
+
+// clearSuggestions leaves selection mode and discards all pending suggestions
+func (m *Model) clearSuggestions() {
+	m.inSelectionMode = false
+	m.selectionRunMode = runModeAuto
+	m.unmarkSuggestions()
+	m.availableSuggestions = []aiSuggestion{}
+	m.memorySuggestions = []memorySuggestion{}
+	m.combinedSuggestions = []combinedSuggestion{}
 }
 
 // Helper function to update memory after command execution
 func (m *Model) updateMemoryWithResult(command string, success bool) {
-	if !m.memoryEnabled || m.memoryManager == nil || m.lastUserRequest == "" {
+	if !m.memoryActive() || m.lastUserRequest == "" {
 		return
 	}
 
@@ -1318,12 +2447,15 @@ func (m *Model) handlePTYExecutionRequest(msg ptyExecutionRequestMsg) tea.Cmd {
 			result.ExitCode,
 			result.Duration,
 			err,
+			result.Frame,
 		)()
 	})
 }
 
 // handlePTYExecutionComplete handles completion of PTY execution
 func (m *Model) handlePTYExecutionComplete(msg ptyExecutionCompleteMsg) {
+	m.addFrame(msg.command, msg.frame)
+
 	// Display execution result
 	if msg.error != nil {
 		m.addMessage(fmt.Sprintf("❌ Interactive program failed: %s", msg.error.Error()), MessageTypeError)
@@ -1336,7 +2468,8 @@ func (m *Model) handlePTYExecutionComplete(msg ptyExecutionCompleteMsg) {
 	}
 
 	// Save to memory if we have memory enabled
-	if m.memoryEnabled && m.memoryManager != nil && m.lastUserRequest != "" && msg.error == nil {
+	if m.memoryActive() && m.lastUserRequest != "" && msg.error == nil &&
+		!executor.SudoReadsPasswordFromStdin(msg.command) {
 		success := msg.exitCode == 0
 		source := "pty"
 		description := fmt.Sprintf("Interactive program executed with PTY")
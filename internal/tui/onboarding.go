@@ -0,0 +1,96 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/yourusername/clia/internal/ai"
+	"github.com/yourusername/clia/internal/config"
+)
+
+// showOnboarding shows the first-run provider menu
+func (m *Model) showOnboarding() {
+	var lines []string
+	lines = append(lines, "👋 No AI provider is configured yet. Let's set one up:")
+	for i, info := range config.SetupProviders() {
+		lines = append(lines, fmt.Sprintf("  %d. %-11s %s", i+1, info.Name, info.Description))
+	}
+
+	m.addMessage(strings.Join(lines, "\n"), MessageTypeSystem)
+	m.addMessage("💡 Type a number or name and press Enter, or press Esc to skip and use offline suggestions", MessageTypeSystem)
+	m.input.Placeholder = "Choose a provider (1-3)..."
+}
+
+// handleOnboardingChoice handles the provider chosen in the first-run menu
+func (m *Model) handleOnboardingChoice(input string) tea.Cmd {
+	m.input.SetValue("")
+
+	info, ok := config.FindSetupProvider(input)
+	if !ok {
+		m.addMessage(fmt.Sprintf("❌ Unknown choice %q. Type a number from the list or a provider name", input), MessageTypeError)
+		return nil
+	}
+
+	m.addMessage(input, MessageTypeUser)
+
+	if info.RequiresKey {
+		m.addMessage(fmt.Sprintf("🔗 Get a %s API key at %s", info.Name, info.KeyURL), MessageTypeSystem)
+		m.handleAPIKeyInputMsg(apiKeyInputMsg{
+			providerType: info.Name,
+			prompt:       fmt.Sprintf("🔑 Paste your %s API key and press Enter (it will be saved to %s):", info.Name, m.configPathForDisplay()),
+		})
+		return nil
+	}
+
+	// Local providers need no key
+	m.addMessage(fmt.Sprintf("🔗 Make sure %s is installed and running (%s)", info.Name, info.KeyURL), MessageTypeSystem)
+	providerName := info.Name
+	return tea.Cmd(func() tea.Msg {
+		providerType := ai.ProviderType(providerName)
+		err := m.aiService.SwitchProvider(providerType, ai.DefaultProviderConfig(providerType))
+		return providerSwitchMsg{
+			providerType: providerName,
+			success:      err == nil,
+			error:        err,
+		}
+	})
+}
+
+// finishOnboarding saves the configured provider so later sessions skip setup
+func (m *Model) finishOnboarding(provider, apiKey string) {
+	m.onboarding = false
+	m.aiService.SetOffline(false)
+	m.input.Placeholder = "Type your command request here..."
+
+	if m.configManager != nil {
+		m.configManager.SetProviderKey(provider, apiKey)
+		m.saveConfig()
+	}
+
+	m.addMessage("🎉 Setup complete! Type your natural language command and press Enter", MessageTypeSystem)
+}
+
+// skipOnboarding leaves first-run setup and falls back to offline suggestions
+func (m *Model) skipOnboarding() {
+	m.onboarding = false
+	m.waitingAPIKey = false
+	m.apiKeyProvider = ""
+	m.input.EchoMode = textinput.EchoNormal
+	m.input.SetValue("")
+	m.input.Placeholder = "Type your command request here..."
+	m.aiService.SetOffline(true)
+
+	m.addMessage("⏭️  Setup skipped: using offline rule-based suggestions", MessageTypeSystem)
+	m.addMessage("💡 Configure a provider later with /provider <name> or 'clia setup'", MessageTypeSystem)
+}
+
+// configPathForDisplay returns the config file path for messages
+func (m *Model) configPathForDisplay() string {
+	if m.configManager == nil {
+		return "the config file"
+	}
+	return m.configManager.GetConfigPath()
+}
@@ -0,0 +1,58 @@
+package tui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// modelFlag picks the model of a single request at the end of the input
+const modelFlag = "--model"
+
+// ParseModelOverride splits a per-request model choice off input: a leading
+// @model, as in "@gpt-4 how do I...", or a trailing --model=model. model is
+// empty when input picks no model.
+func ParseModelOverride(input string) (request, model string) {
+	input = strings.TrimSpace(input)
+
+	if strings.HasPrefix(input, "@") {
+		name, rest, _ := strings.Cut(input[1:], " ")
+		if name != "" {
+			return strings.TrimSpace(rest), name
+		}
+		return input, ""
+	}
+
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return input, ""
+	}
+	last := fields[len(fields)-1]
+	model, ok := strings.CutPrefix(last, modelFlag+"=")
+	if !ok || model == "" {
+		return input, ""
+	}
+	return strings.TrimSpace(strings.TrimSuffix(input, last)), model
+}
+
+// handleModelOverrideRequest sends a request with the model it picked; the
+// current model is used again for the requests after it
+func (m *Model) handleModelOverrideRequest(input, request, model string) tea.Cmd {
+	m.addMessage(input, MessageTypeUser)
+	m.input.SetValue("")
+
+	switch {
+	case request == "":
+		m.addMessage("Usage: @<model> <request> or <request> --model=<model>, e.g. @gpt-4 find large files", MessageTypeError)
+		return nil
+	case m.aiService == nil:
+		m.addMessage("❌ AI service not available", MessageTypeError)
+		return nil
+	case m.aiService.IsOffline():
+		m.addMessage("📴 Offline mode uses rule-based suggestions, ignoring model "+model, MessageTypeSystem)
+		return m.requestSuggestions(request)
+	}
+
+	m.addMessage("🧠 Using "+model+" for this request", MessageTypeSystem)
+	return m.requestSuggestionsWithModel(request, model)
+}
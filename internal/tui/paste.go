@@ -0,0 +1,26 @@
+package tui
+
+import (
+	"github.com/charmbracelet/bubbles/textinput"
+
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// InsertPastedText inserts bracketed-paste content into a text input at the
+// cursor as literal text, without interpreting embedded newlines as submit
+func InsertPastedText(input *textinput.Model, content string) {
+	text := utils.SanitizePastedText(content)
+	if text == "" {
+		return
+	}
+
+	value := []rune(input.Value())
+	pos := input.Position()
+	if pos > len(value) {
+		pos = len(value)
+	}
+
+	newValue := string(value[:pos]) + text + string(value[pos:])
+	input.SetValue(newValue)
+	input.SetCursor(pos + len([]rune(text)))
+}
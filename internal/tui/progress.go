@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yourusername/clia/internal/executor"
+)
+
+// partialPrefix marks a line of output the command is still redrawing, like
+// a progress bar, until it finishes the line
+const partialPrefix = "⏳"
+
+// showOutputLine adds a line of command output to the messages. A line
+// following a partial one of the same stream replaces it in place, so
+// progress bars update instead of adding a message per redraw.
+func (m *Model) showOutputLine(output executor.OutputLine) {
+	outputType := MessageTypeAssistant
+	prefix := "📤"
+	if output.IsStderr {
+		outputType = MessageTypeError
+		prefix = "❌"
+	}
+	if output.Partial {
+		prefix = partialPrefix
+	}
+	content := fmt.Sprintf("%s %s", prefix, output.Content)
+	blank := strings.TrimSpace(output.Content) == ""
+
+	if at, ok := m.partialMessages[output.IsStderr]; ok {
+		delete(m.partialMessages, output.IsStderr)
+		if at < len(m.messages) && strings.HasPrefix(m.messages[at].Content, partialPrefix) {
+			switch {
+			case !blank:
+				m.messages[at].Content = content
+			case at == len(m.messages)-1:
+				// The command cleared the line it was redrawing
+				m.messages = m.messages[:at]
+				return
+			default:
+				m.messages[at].Content = prefix
+			}
+			if output.Partial {
+				m.rememberPartial(output.IsStderr, at)
+			}
+			return
+		}
+	}
+
+	if blank {
+		return
+	}
+	m.appendMessage(content, outputType)
+	if output.Partial {
+		m.rememberPartial(output.IsStderr, len(m.messages)-1)
+	}
+}
+
+// dropPartial removes the partial line of stdout or stderr when it is the
+// last message, for a prompt the command printed over it
+func (m *Model) dropPartial(isStderr bool) {
+	at, ok := m.partialMessages[isStderr]
+	delete(m.partialMessages, isStderr)
+	if ok && at == len(m.messages)-1 && strings.HasPrefix(m.messages[at].Content, partialPrefix) {
+		m.messages = m.messages[:at]
+	}
+}
+
+// rememberPartial records that the message at index shows the partial line
+// of stdout or stderr
+func (m *Model) rememberPartial(isStderr bool, index int) {
+	if m.partialMessages == nil {
+		m.partialMessages = make(map[bool]int)
+	}
+	m.partialMessages[isStderr] = index
+}
@@ -0,0 +1,84 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/yourusername/clia/internal/executor"
+)
+
+// startPrompt shows a prompt of the streaming command, like a y/n
+// confirmation or a password prompt, and takes the answer from the input line
+func (m *Model) startPrompt(prompt executor.Prompt) {
+	m.appendMessage("❓ "+prompt.Text, MessageTypeSystem)
+	if m.commandInput == nil {
+		m.offerAssumeYes(prompt)
+		return // The command has no input left to answer with
+	}
+
+	m.inPromptMode = true
+	m.promptSecret = prompt.Secret
+	m.input.SetValue("")
+	if prompt.Secret {
+		m.input.EchoMode = textinput.EchoPassword
+		m.input.Placeholder = "Type the password (input hidden)..."
+	} else {
+		m.input.Placeholder = "Type your answer..."
+	}
+	m.appendMessage("💡 The command is waiting for an answer: type it and press Enter, or Esc to stop the command", MessageTypeSystem)
+	m.offerAssumeYes(prompt)
+}
+
+// offerAssumeYes suggests the flag that answers the confirmation questions of
+// package managers like apt, which stall a streamed command
+func (m *Model) offerAssumeYes(prompt executor.Prompt) {
+	if withYes := executor.AssumeYes(m.currentCommand); withYes != "" && !prompt.Secret {
+		m.appendMessage("💡 To skip this question next time, run "+withYes+" (commands you confirm in clia get the flag added)", MessageTypeSystem)
+	}
+}
+
+// answerPrompt sends answer to the command waiting at a prompt
+func (m *Model) answerPrompt(answer string) {
+	shown := answer
+	switch {
+	case m.promptSecret:
+		shown = "••••••••"
+	case answer == "":
+		shown = "(default)"
+	}
+	m.addMessage("⌨️  "+shown, MessageTypeUser)
+
+	if _, err := io.WriteString(m.commandInput, answer+"\n"); err != nil {
+		m.addMessage(fmt.Sprintf("❌ Failed to send the answer: %v", err), MessageTypeError)
+	}
+	m.endPrompt()
+}
+
+// cancelPrompt closes the input of the command waiting at a prompt, which
+// stops it
+func (m *Model) cancelPrompt() {
+	m.releaseCommandInput()
+	m.addMessage("❌ Stopped the command waiting for an answer", MessageTypeSystem)
+}
+
+// endPrompt restores the input line after a prompt
+func (m *Model) endPrompt() {
+	m.inPromptMode = false
+	m.promptSecret = false
+	m.input.SetValue("")
+	m.input.EchoMode = textinput.EchoNormal
+	m.input.Placeholder = "Type your command request here..."
+}
+
+// releaseCommandInput closes the input of the streaming command, ending a
+// pending prompt
+func (m *Model) releaseCommandInput() {
+	if m.commandInput != nil {
+		m.commandInput.Close()
+		m.commandInput = nil
+	}
+	if m.inPromptMode {
+		m.endPrompt()
+	}
+}
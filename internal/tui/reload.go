@@ -0,0 +1,129 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/yourusername/clia/internal/ai"
+	"github.com/yourusername/clia/internal/config"
+)
+
+// handleReloadCommand reads the config file again after it was edited
+// elsewhere and applies it to the session, listing what changed. A file that
+// is not valid leaves the current configuration in place.
+func (m *Model) handleReloadCommand() tea.Cmd {
+	if m.configManager == nil {
+		m.addMessage("❌ Configuration not available", MessageTypeError)
+		return nil
+	}
+
+	changes, err := m.configManager.Reload()
+	if err != nil {
+		m.addMessage(fmt.Sprintf("❌ Keeping the current configuration: %v", err), MessageTypeError)
+		return nil
+	}
+	if m.confirmConfigSave {
+		// The change waiting to be saved was made to the old configuration
+		m.confirmConfigSave = false
+		m.addMessage("⚠️  The unsaved change was dropped", MessageTypeSystem)
+	}
+	if len(changes) == 0 {
+		m.addMessage("🔄 Reloaded "+m.configManager.GetConfigPath()+": nothing changed", MessageTypeSystem)
+		return nil
+	}
+
+	lines := []string{"🔄 Reloaded " + m.configManager.GetConfigPath() + ":"}
+	for _, change := range changes {
+		lines = append(lines, "  "+change.String())
+	}
+	m.addMessage(strings.Join(lines, "\n"), MessageTypeSystem)
+
+	for _, warning := range configureService(m.aiService, m.configManager) {
+		m.addMessage("⚠️  "+warning, MessageTypeError)
+	}
+	m.applyChangedSettings(changes)
+
+	if providerChanged(changes) {
+		return m.reloadProvider(changes)
+	}
+	return nil
+}
+
+// applyChangedSettings applies the settings of the session that changed in
+// the file; the others keep what commands like /paranoid set
+func (m *Model) applyChangedSettings(changes []config.Change) {
+	changed := make(map[string]bool, len(changes))
+	for _, change := range changes {
+		changed[change.Key] = true
+	}
+	cfg := m.configManager.GetConfig()
+
+	if changed["api.max_cost"] {
+		m.aiService.SetBudget(cfg.API.MaxCost)
+	}
+	if changed["ui.compact_suggestions"] {
+		m.compactSuggestions = cfg.UI.CompactSuggestions
+	}
+	if changed["behavior.confirm_all"] {
+		m.confirmAll = cfg.Behavior.ConfirmAll
+	}
+	if changed["behavior.copy_on_select"] {
+		m.copySelected = cfg.Behavior.CopyOnSelect
+	}
+	if changed["ui.format_output"] {
+		m.formatOutput = cfg.UI.FormatOutput
+	}
+	if changed["ui.thinking_message"] {
+		m.thinkingText = cfg.UI.ThinkingText()
+	}
+	if changed["ui.theme"] {
+		ConfigureColors(cfg.UI.Theme)
+	}
+}
+
+// providerChanged reports whether changes affect the provider in use: which
+// one it is, its key, model or endpoint. Model aliases apply without it.
+func providerChanged(changes []config.Change) bool {
+	for _, change := range changes {
+		switch {
+		case change.Key == "api.provider", change.Key == "api.key", change.Key == "api.model", change.Key == "api.endpoint":
+			return true
+		case strings.HasPrefix(change.Key, "api.providers.") && !strings.Contains(change.Key, ".aliases"):
+			return true
+		}
+	}
+	return false
+}
+
+// reloadProvider switches to the provider of the config file with its model,
+// keeping the current one if the file has no key for it
+func (m *Model) reloadProvider(changes []config.Change) tea.Cmd {
+	provider, apiKey, ok := m.configManager.GetStoredProvider()
+	if !ok {
+		m.addMessage(fmt.Sprintf("⚠️  No API key for %s, keeping %s", provider, m.currentProvider), MessageTypeError)
+		return nil
+	}
+
+	providerType := ai.ProviderType(provider)
+	providerConfig := ai.DefaultProviderConfig(providerType)
+	providerConfig.APIKey = apiKey
+	if providerType == ai.ProviderTypeOpenRouter {
+		providerConfig.Model = "z-ai/glm-4.5-air:free" // As at startup
+	}
+	if settings, ok := m.configManager.GetActiveProviderConfig(); ok && settings.Model != "" {
+		providerConfig.Model = settings.Model
+	} else if slices.ContainsFunc(changes, func(change config.Change) bool { return change.Key == "api.model" && change.New != "" }) {
+		providerConfig.Model = m.configManager.GetConfig().API.Model
+	}
+
+	return func() tea.Msg {
+		err := m.aiService.SwitchProvider(providerType, providerConfig)
+		return providerSwitchMsg{
+			providerType: provider,
+			success:      err == nil,
+			error:        err,
+		}
+	}
+}
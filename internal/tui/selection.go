@@ -0,0 +1,88 @@
+package tui
+
+// In selection mode a suggestion is picked by its number, or by moving the
+// highlight with the arrow keys or j/k and pressing Enter, like in the
+// selection TUI of the command line mode. Pressing Alt+I or Alt+S first
+// forces the picked command to run in full terminal mode or to stream its
+// output, for when the detection of interactive programs guesses wrong.
+
+// runMode is how a selected command runs
+type runMode int
+
+const (
+	runModeAuto        runMode = iota // Full terminal mode for detected interactive programs
+	runModeInteractive                // Always in full terminal mode
+	runModeStream                     // Always streaming the output into clia
+)
+
+// moveHighlight moves the highlight by delta entries, stopping at the ends
+// of the list
+func (m *Model) moveHighlight(delta int) {
+	if len(m.combinedSuggestions) == 0 {
+		return
+	}
+	m.setHighlight(min(max(m.highlighted+delta, 0), len(m.combinedSuggestions)-1))
+}
+
+// setHighlight highlights the suggestion at index, marking its message with
+// the cursor; compact lists show the description of that entry only
+func (m *Model) setHighlight(index int) {
+	m.highlighted = index
+	compact := UseCompactSuggestions(m.width, m.compactSuggestions)
+	for i, at := range m.suggestionMessages {
+		if at >= len(m.messages) || i >= len(m.combinedSuggestions) {
+			break
+		}
+		m.messages[at].Highlighted = i == index
+		if compact {
+			m.messages[at].Content = formatCompactSuggestion(i, m.combinedSuggestions[i], m.width, i == index)
+		}
+	}
+	m.updateViewportContent()
+}
+
+// unmarkSuggestions removes the cursor from the listed suggestions, which can
+// no longer be selected
+func (m *Model) unmarkSuggestions() {
+	for _, at := range m.suggestionMessages {
+		if at < len(m.messages) {
+			m.messages[at].Highlighted = false
+		}
+	}
+	m.suggestionMessages = nil
+	m.highlighted = 0
+}
+
+// toggleRunMode forces the next selection to run in mode, or back to the
+// detected mode if it already was
+func (m *Model) toggleRunMode(mode runMode) {
+	if m.selectionRunMode == mode {
+		mode = runModeAuto
+	}
+	m.selectionRunMode = mode
+
+	switch mode {
+	case runModeInteractive:
+		m.addMessage("🎮 The selected command runs in full terminal mode (Alt+I again for automatic)", MessageTypeSystem)
+	case runModeStream:
+		m.addMessage("📜 The selected command streams its output here (Alt+S again for automatic)", MessageTypeSystem)
+	default:
+		m.addMessage("🔀 The selected command runs in the mode detected for it", MessageTypeSystem)
+	}
+}
+
+// editHighlighted enters edit mode with the highlighted suggestion
+func (m *Model) editHighlighted() {
+	if m.highlighted >= len(m.combinedSuggestions) {
+		m.addMessage("❌ No commands available to edit", MessageTypeError)
+		return
+	}
+
+	suggestion := m.combinedSuggestions[m.highlighted]
+	m.enterEditMode(aiSuggestion{
+		Command:     suggestion.Command,
+		Description: suggestion.Description,
+		Safe:        suggestion.Safe,
+		Confidence:  suggestion.Confidence,
+	})
+}
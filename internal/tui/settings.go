@@ -0,0 +1,146 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/yourusername/clia/internal/ai"
+)
+
+// configUsage explains the settings /config can change
+const configUsage = "Usage: /config set timeout <duration> or /config set max_cost <dollars>, e.g. /config set timeout 45s"
+
+// handleConfigCommand changes a setting for the session and saves it in the
+// config file: the suggestion timeout or the budget of the session.
+func (m *Model) handleConfigCommand(args []string) tea.Cmd {
+	if len(args) == 0 {
+		if m.aiService != nil {
+			m.addMessage(fmt.Sprintf("⚙️  Suggestion timeout: %s", m.aiService.GetTimeout()), MessageTypeSystem)
+			if budget := m.aiService.Budget(); budget > 0 {
+				m.addMessage(fmt.Sprintf("⚙️  Budget: %s of %s spent", ai.FormatCost(m.aiService.Spent()), ai.FormatCost(budget)), MessageTypeSystem)
+			}
+		}
+		m.addMessage(configUsage, MessageTypeSystem)
+		return nil
+	}
+	if len(args) != 3 || strings.ToLower(args[0]) != "set" {
+		m.addMessage("❌ "+configUsage, MessageTypeError)
+		return nil
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "timeout":
+		m.setSuggestionTimeout(args[2])
+	case "max_cost", "max-cost":
+		m.setMaxCost(args[2])
+	default:
+		m.addMessage(fmt.Sprintf("❌ Unknown setting %q. %s", args[1], configUsage), MessageTypeError)
+	}
+	return nil
+}
+
+// setSuggestionTimeout limits how long the following AI requests may take.
+// Commands keep the timeout of the executor.
+func (m *Model) setSuggestionTimeout(value string) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		m.addMessage(fmt.Sprintf("❌ Invalid timeout %q: use a duration like 45s or 2m", value), MessageTypeError)
+		return
+	}
+	if m.aiService == nil {
+		m.addMessage("❌ AI service not available", MessageTypeError)
+		return
+	}
+
+	m.aiService.SetTimeout(timeout)
+	m.addMessage(fmt.Sprintf("⏱️  Suggestion timeout set to %s", timeout), MessageTypeSystem)
+	if m.configManager != nil {
+		m.configManager.SetTimeout(timeout)
+		m.saveConfig()
+	}
+}
+
+// setMaxCost sets the budget of the session; 0 removes it
+func (m *Model) setMaxCost(value string) {
+	dollars, err := strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+	if err != nil || dollars < 0 {
+		m.addMessage(fmt.Sprintf("❌ Invalid budget %q: use an amount in dollars like 0.50, or 0 for no limit", value), MessageTypeError)
+		return
+	}
+	if m.aiService == nil {
+		m.addMessage("❌ AI service not available", MessageTypeError)
+		return
+	}
+
+	m.aiService.SetBudget(dollars)
+	if dollars == 0 {
+		m.addMessage("💸 No budget: AI requests are not limited by cost", MessageTypeSystem)
+	} else {
+		m.addMessage(fmt.Sprintf("💸 Budget set to %s, %s spent so far", ai.FormatCost(dollars), ai.FormatCost(m.aiService.Spent())), MessageTypeSystem)
+	}
+	if m.configManager != nil {
+		m.configManager.SetMaxCost(dollars)
+		m.saveConfig()
+	}
+}
+
+// saveConfig shows what saving changes in the config file and saves it. If a
+// setting would be removed or a stored key replaced, it asks first.
+func (m *Model) saveConfig() {
+	changes, err := m.configManager.PendingChanges()
+	if err != nil {
+		m.addMessage(fmt.Sprintf("⚠️  Failed to compare the configuration: %v", err), MessageTypeError)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	lines := []string{"💾 Changes to " + m.configManager.GetConfigPath() + ":"}
+	destructive := false
+	for _, change := range changes {
+		lines = append(lines, "  "+change.String())
+		destructive = destructive || change.Destructive()
+	}
+	m.addMessage(strings.Join(lines, "\n"), MessageTypeSystem)
+
+	if destructive {
+		m.confirmConfigSave = true
+		m.addMessage("⚠️  This removes settings or replaces a stored key. Press 'y' to save, 'n' to keep the file as it is", MessageTypeError)
+		return
+	}
+	m.writeConfig()
+}
+
+// writeConfig saves the configuration to its file
+func (m *Model) writeConfig() {
+	if err := m.configManager.Save(); err != nil {
+		m.addMessage(fmt.Sprintf("⚠️  Failed to save configuration: %v", err), MessageTypeError)
+		return
+	}
+	m.addMessage("💾 Saved", MessageTypeSystem)
+}
+
+// handleConfigSaveKey acts on the answer to saving destructive config
+// changes. Other keys leave the file as it is and are left to the input, for
+// which it reports false.
+func (m *Model) handleConfigSaveKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	m.confirmConfigSave = false
+
+	key := msg.String()
+	if key == "y" || key == "Y" {
+		m.writeConfig()
+		return nil, true
+	}
+
+	m.addMessage("💾 Not saved: the change applies to this session only", MessageTypeSystem)
+	switch key {
+	case "n", "N", "esc", "escape":
+		return nil, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,60 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yourusername/clia/internal/executor"
+)
+
+// applyStateChange applies a cd, export or alias to the session, since the
+// shell running the command would exit and take the change with it. It
+// reports whether the command is done; builtins whose effect cannot be kept,
+// like source, are only warned about and left to run.
+func (m *Model) applyStateChange(change *executor.StateChange) bool {
+	if change.Kind == executor.ShellStateTransient {
+		m.addMessage(fmt.Sprintf("⚠️  %s only affects the shell it runs in, which exits right after, so its effect won't last", change.Program), MessageTypeError)
+		m.addMessage(fmt.Sprintf("💡 Run it together with the command that needs it, e.g. %s ... && <command>", change.Program), MessageTypeSystem)
+		return false
+	}
+
+	if err := m.executor.ApplyStateChange(change); err != nil {
+		m.addMessage("❌ "+err.Error(), MessageTypeError)
+		return true
+	}
+
+	switch change.Kind {
+	case executor.ShellStateDir:
+		if m.aiService != nil {
+			m.aiService.GetPromptBuilder().GetContextCollector().SetWorkDir(m.executor.WorkDir())
+		}
+		m.addMessage("📁 Now in "+m.executor.WorkDir(), MessageTypeSystem)
+	case executor.ShellStateEnv:
+		// Values are not shown, they may be secrets
+		if len(change.Set) > 0 {
+			m.addMessage(fmt.Sprintf("🌱 Set %s for the following commands", strings.Join(sortedKeys(change.Set), ", ")), MessageTypeSystem)
+		}
+		if len(change.Unset) > 0 {
+			m.addMessage(fmt.Sprintf("🌱 Unset %s for the following commands", strings.Join(change.Unset, ", ")), MessageTypeSystem)
+		}
+	case executor.ShellStateAlias:
+		for _, name := range sortedKeys(change.Set) {
+			m.addMessage(fmt.Sprintf("🔗 Alias %s runs %s for the rest of the session", name, change.Set[name]), MessageTypeSystem)
+		}
+		if len(change.Unset) > 0 {
+			m.addMessage(fmt.Sprintf("🔗 Removed alias %s", strings.Join(change.Unset, ", ")), MessageTypeSystem)
+		}
+	}
+	return true
+}
+
+// sortedKeys returns the keys of values in order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
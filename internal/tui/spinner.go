@@ -1,6 +1,8 @@
 package tui
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -15,8 +17,31 @@ const (
 	SpinnerSimple
 	SpinnerDots
 	SpinnerPulse
+	SpinnerBounce
 )
 
+// spinnerNames maps the names of spinner types in the config to the types;
+// "line" is the simple spinner
+var spinnerNames = map[string]SpinnerType{
+	"classic": SpinnerClassic,
+	"line":    SpinnerSimple,
+	"dots":    SpinnerDots,
+	"pulse":   SpinnerPulse,
+	"bounce":  SpinnerBounce,
+}
+
+// ParseSpinnerType returns the spinner type called name, SpinnerClassic for
+// an empty name
+func ParseSpinnerType(name string) (SpinnerType, error) {
+	if name == "" {
+		return SpinnerClassic, nil
+	}
+	if t, ok := spinnerNames[strings.ToLower(name)]; ok {
+		return t, nil
+	}
+	return SpinnerClassic, fmt.Errorf("unknown spinner %q: use classic, dots, line, bounce or pulse", name)
+}
+
 // Spinner represents an animated loading indicator
 type Spinner struct {
 	Type     SpinnerType
@@ -64,6 +89,8 @@ func (s Spinner) getFrames() []string {
 		return []string{"⠄", "⠆", "⠇", "⠋", "⠙", "⠸", "⠰", "⠠", "⠰", "⠸", "⠙", "⠋", "⠇", "⠆"}
 	case SpinnerPulse:
 		return []string{"○", "◎", "●", "◎"}
+	case SpinnerBounce:
+		return []string{"⠁", "⠂", "⠄", "⡀", "⠄", "⠂"}
 	default:
 		return []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
 	}
@@ -1,7 +1,13 @@
 package tui
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+
+	"github.com/yourusername/clia/internal/termcaps"
 )
 
 // Style definitions for the TUI
@@ -49,6 +55,16 @@ var (
 				Foreground(lipgloss.Color("204")).
 				Bold(true)
 
+	rawMessageStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("240")).
+			Faint(true)
+
+	// Border around the last screen of an interactive program
+	frameStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("240")).
+			Padding(0, 1)
+
 	// Input styles
 	inputStyle = lipgloss.NewStyle().
 			BorderStyle(lipgloss.RoundedBorder()).
@@ -61,13 +77,113 @@ var (
 	pulseColor1 = lipgloss.Color("69")  // Blue
 	pulseColor2 = lipgloss.Color("117") // Light blue
 
+	// Pinned note shown above the messages
+	pinnedMessageStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("230")).
+				Background(lipgloss.Color("237")).
+				Bold(true).
+				Padding(0, 1)
+
+	// Favorites bar shown above the input
+	favoritesBarStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("229")).
+				Padding(0, 1)
+
 	// Help text style
 	helpStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("243")).
 			Italic(true).
 			Margin(0, 2)
+
+	// Confidence styles
+	highConfidenceStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))  // Green
+	mediumConfidenceStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("214")) // Yellow
+	lowConfidenceStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("203")) // Red
 )
 
+// Confidence thresholds for color coding
+const (
+	HighConfidenceThreshold   = 0.8
+	MediumConfidenceThreshold = 0.5
+)
+
+// terminalCaps are the capabilities of the terminal, see ConfigureTerminal
+var terminalCaps = termcaps.Detect()
+
+// colorsEnabled controls whether confidence values are colored
+var colorsEnabled = terminalCaps.Color != termcaps.ColorNone
+
+// ConfigureTerminal detects the colors, emoji support and clipboard method of
+// the terminal and applies the overrides of the ui config. Invalid settings
+// are reported and the detected values kept. Call it before ConfigureColors.
+func ConfigureTerminal(settings termcaps.Settings) error {
+	detected := termcaps.Detect()
+	caps, err := detected.Override(settings)
+	if err != nil {
+		caps = detected
+	}
+
+	terminalCaps = caps
+	colorsEnabled = caps.Color != termcaps.ColorNone
+	if caps.ColorSet {
+		lipgloss.SetColorProfile(colorProfile(caps.Color))
+	}
+	return err
+}
+
+// TerminalCaps returns the capabilities set by ConfigureTerminal
+func TerminalCaps() termcaps.Caps {
+	return terminalCaps
+}
+
+// colorProfile returns the lipgloss color profile of a color level
+func colorProfile(level termcaps.ColorLevel) termenv.Profile {
+	switch level {
+	case termcaps.ColorTrueColor:
+		return termenv.TrueColor
+	case termcaps.Color256:
+		return termenv.ANSI256
+	case termcaps.ColorBasic:
+		return termenv.ANSI
+	default:
+		return termenv.Ascii
+	}
+}
+
+// ConfigureColors enables or disables colored output for the configured
+// theme. Colors are always off when the terminal has none, see
+// ConfigureTerminal.
+func ConfigureColors(theme string) {
+	switch strings.ToLower(theme) {
+	case "none", "no-color", "plain":
+		colorsEnabled = false
+	default:
+		colorsEnabled = terminalCaps.Color != termcaps.ColorNone
+	}
+}
+
+// GetConfidenceStyle returns the style for a confidence between 0 and 1
+func GetConfidenceStyle(confidence float64) lipgloss.Style {
+	switch {
+	case confidence > HighConfidenceThreshold:
+		return highConfidenceStyle
+	case confidence >= MediumConfidenceThreshold:
+		return mediumConfidenceStyle
+	default:
+		return lowConfidenceStyle
+	}
+}
+
+// FormatConfidence formats a confidence between 0 and 1 as a percentage,
+// colored by level unless colors are disabled
+func FormatConfidence(confidence float64) string {
+	percent := fmt.Sprintf("%d%%", int(confidence*100))
+	if !colorsEnabled {
+		return percent
+	}
+	return GetConfidenceStyle(confidence).Render(percent)
+}
+
 // GetMessageStyle returns the appropriate style for a message type
 func GetMessageStyle(msgType MessageType) lipgloss.Style {
 	switch msgType {
@@ -79,6 +195,8 @@ func GetMessageStyle(msgType MessageType) lipgloss.Style {
 		return assistantMessageStyle
 	case MessageTypeError:
 		return errorMessageStyle
+	case MessageTypeRaw:
+		return rawMessageStyle
 	default:
 		return systemMessageStyle
 	}
@@ -86,6 +204,9 @@ func GetMessageStyle(msgType MessageType) lipgloss.Style {
 
 // FormatMessage formats a message with the appropriate style and prefix
 func FormatMessage(msg Message) string {
+	if msg.Type == MessageTypeFrame {
+		return renderFrame(msg.Content, 0)
+	}
 	style := GetMessageStyle(msg.Type)
 
 	var prefix string
@@ -96,11 +217,17 @@ func FormatMessage(msg Message) string {
 		prefix = "⚠ "
 	case MessageTypeAssistant:
 		prefix = "🤖 "
+		if msg.Highlighted {
+			prefix = "▸  " // As wide as the icon, so the entries stay aligned
+			style = style.Bold(true)
+		}
 	case MessageTypeError:
 		prefix = "✗ "
+	case MessageTypeRaw:
+		prefix = "🧠 "
 	default:
 		prefix = "• "
 	}
 
-	return style.Render(prefix + msg.Content)
+	return style.Render(terminalCaps.Text(prefix + msg.Content))
 }
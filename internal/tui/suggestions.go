@@ -0,0 +1,192 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourusername/clia/internal/ai"
+	"github.com/yourusername/clia/pkg/memory"
+)
+
+// combinedSuggestion is an entry of the unified list of memory and AI suggestions
+type combinedSuggestion struct {
+	Command     string
+	Description string
+	Safe        bool
+	Confidence  float64
+	Score       float64           // Blended ranking score
+	Category    string            // Category given by the AI; empty for memory entries
+	Memory      *memorySuggestion // Set when the command comes from memory
+	AlsoFromAI  bool              // Memory entry the AI suggested as well
+}
+
+// FromMemory returns true if the suggestion was found in memory
+func (s combinedSuggestion) FromMemory() bool {
+	return s.Memory != nil
+}
+
+// mergeSuggestions merges memory and AI suggestions into a single ranked list
+// with ai.RankSuggestions. Identical commands are deduplicated with the memory
+// entry winning, and safe commands rank first.
+func mergeSuggestions(memorySuggestions []memorySuggestion, aiSuggestions []aiSuggestion) []combinedSuggestion {
+	results := make([]memory.SearchResult, len(memorySuggestions))
+	for i, suggestion := range memorySuggestions {
+		results[i] = memory.SearchResult{
+			Entry:     suggestion.Entry,
+			Score:     suggestion.Score,
+			Reason:    suggestion.Reason,
+			MatchType: suggestion.MatchType,
+		}
+		results[i].Entry.UsageCount = suggestion.UsageCount
+	}
+	suggestions := make([]ai.CommandSuggestion, len(aiSuggestions))
+	for i, suggestion := range aiSuggestions {
+		suggestions[i] = ai.CommandSuggestion{
+			Command:     suggestion.Command,
+			Description: suggestion.Description,
+			Confidence:  suggestion.Confidence,
+			Safe:        suggestion.Safe,
+			Category:    suggestion.Category,
+		}
+	}
+
+	ranked := ai.RankSuggestions(suggestions, results, ai.RankOptions{PreferSafe: true})
+	merged := make([]combinedSuggestion, len(ranked))
+	for i, item := range ranked {
+		merged[i] = combinedSuggestion{
+			Command:     item.Command,
+			Description: item.Description,
+			Safe:        item.Safe,
+			Confidence:  item.Confidence,
+			Score:       item.Score,
+			Category:    item.Category,
+			AlsoFromAI:  item.AlsoFromAI,
+		}
+		if item.Source == ai.SourceMemory {
+			suggestion := memorySuggestions[item.Index]
+			merged[i].Memory = &suggestion
+		}
+	}
+	return merged
+}
+
+// groupByCategory returns the suggestions with those of the same category
+// next to each other, like ai.CommandSuggestions.GroupByCategory, and whether
+// they span more than one category and are shown under category headers
+func groupByCategory(suggestions []combinedSuggestion) ([]combinedSuggestion, bool) {
+	rank := make(map[string]int)
+	for _, suggestion := range suggestions {
+		if _, ok := rank[ai.CategoryKey(suggestion.Category)]; !ok {
+			rank[ai.CategoryKey(suggestion.Category)] = len(rank)
+		}
+	}
+	if len(rank) < 2 {
+		return suggestions, false
+	}
+
+	grouped := make([]combinedSuggestion, len(suggestions))
+	copy(grouped, suggestions)
+	sort.SliceStable(grouped, func(i, j int) bool {
+		return rank[ai.CategoryKey(grouped[i].Category)] < rank[ai.CategoryKey(grouped[j].Category)]
+	})
+	return grouped, true
+}
+
+// FormatCategory formats a suggestion category as a list header, e.g.
+// "file_management" as "📂 File management"
+func FormatCategory(category string) string {
+	name := strings.ReplaceAll(ai.CategoryKey(category), "_", " ")
+	if name == "" {
+		return "📂 Other"
+	}
+	return "📂 " + strings.ToUpper(name[:1]) + name[1:]
+}
+
+// formatTimeAgo formats the time elapsed since t in a compact form
+func formatTimeAgo(t time.Time) string {
+	timeAgo := time.Since(t)
+	if timeAgo < time.Hour {
+		return fmt.Sprintf("%.0fm ago", timeAgo.Minutes())
+	} else if timeAgo < 24*time.Hour {
+		return fmt.Sprintf("%.0fh ago", timeAgo.Hours())
+	}
+	return fmt.Sprintf("%.0fd ago", timeAgo.Hours()/24)
+}
+
+// formatCombinedSuggestion formats an entry of the unified suggestion list
+func formatCombinedSuggestion(index int, suggestion combinedSuggestion) string {
+	safetyIndicator := "✓"
+	if !suggestion.Safe {
+		safetyIndicator = "⚠"
+	}
+
+	if suggestion.FromMemory() {
+		source := "💭 memory"
+		if suggestion.AlsoFromAI {
+			source = "💭 memory + AI"
+		}
+
+		return fmt.Sprintf("%d. %s %s (%s, used %dx, %s)\n   %s",
+			index+1, safetyIndicator, suggestion.Command, source,
+			suggestion.Memory.UsageCount, formatTimeAgo(suggestion.Memory.LastUsed),
+			suggestion.Description)
+	}
+
+	return fmt.Sprintf("%d. %s %s (%s confidence)\n   %s",
+		index+1, safetyIndicator, suggestion.Command, FormatConfidence(suggestion.Confidence), suggestion.Description)
+}
+
+// CompactSuggestionWidth is the terminal width below which suggestions are
+// shown one line each, as two-line entries wrap badly on narrow terminals
+const CompactSuggestionWidth = 80
+
+// UseCompactSuggestions reports whether suggestions are shown one line each,
+// because the config asks for it or the terminal is narrow. A width of 0
+// means the size is not known yet.
+func UseCompactSuggestions(width int, always bool) bool {
+	return always || (width > 0 && width < CompactSuggestionWidth)
+}
+
+// FitCommand shortens command to at most width columns, marking the cut.
+// A width of 0 or less leaves the command unchanged.
+func FitCommand(command string, width int) string {
+	runes := []rune(command)
+	if width <= 0 || len(runes) <= width {
+		return command
+	}
+	if width == 1 {
+		return "…"
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// compactSuggestionOverhead is the width taken by the message prefix, the
+// number and the icons of a compact suggestion
+const compactSuggestionOverhead = 14
+
+// formatCompactSuggestion formats an entry of the unified suggestion list as
+// a single line. The description is only shown for the highlighted entry.
+func formatCompactSuggestion(index int, suggestion combinedSuggestion, width int, highlighted bool) string {
+	safetyIndicator := "✓"
+	if !suggestion.Safe {
+		safetyIndicator = "⚠"
+	}
+
+	source := ""
+	if suggestion.FromMemory() {
+		source = "💭 "
+	}
+
+	commandWidth := 0
+	if width > 0 {
+		commandWidth = max(width-compactSuggestionOverhead, 10)
+	}
+
+	line := fmt.Sprintf("%d. %s %s%s", index+1, safetyIndicator, source, FitCommand(suggestion.Command, commandWidth))
+	if highlighted && suggestion.Description != "" {
+		line += "\n   " + suggestion.Description
+	}
+	return line
+}
@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxRetainedOutputLines bounds the output kept from the last command for summaries
+const maxRetainedOutputLines = 5000
+
+// summarizeHintLines is the output length from which the help line suggests a summary
+const summarizeHintLines = 20
+
+// retainOutput keeps a line of command output for a later summary, marking stderr lines
+func (m *Model) retainOutput(content string, isStderr bool) {
+	if isStderr {
+		content = "[stderr] " + content
+	}
+
+	m.executionOutput = append(m.executionOutput, content)
+	if len(m.executionOutput) > maxRetainedOutputLines {
+		m.executionOutput = m.executionOutput[len(m.executionOutput)-maxRetainedOutputLines:]
+	}
+}
+
+// canSummarize reports whether the last command was verbose enough to suggest a summary
+func (m Model) canSummarize() bool {
+	return !m.executingCommand && len(m.executionOutput) >= summarizeHintLines
+}
+
+// summarizeOutput sends the output of the last command to the model for a concise summary
+func (m *Model) summarizeOutput() tea.Cmd {
+	if m.executingCommand {
+		m.addMessage("⚠️  Wait for the command to finish before summarizing its output", MessageTypeError)
+		return nil
+	}
+	if m.processing {
+		return nil
+	}
+
+	output := strings.Join(m.executionOutput, "\n")
+	if strings.TrimSpace(output) == "" {
+		m.addMessage("❌ No command output to summarize. Run a command first", MessageTypeError)
+		return nil
+	}
+
+	command := m.outputCommand
+	m.processing = true
+	m.showSpinner = true
+	m.status = "Summarizing output..."
+	m.addMessage(fmt.Sprintf("🧾 Summarizing %d lines of output from: %s", len(m.executionOutput), command), MessageTypeSystem)
+
+	summaryCmd := tea.Cmd(func() tea.Msg {
+		summary, err := m.aiService.SummarizeOutput(context.Background(), command, output)
+		return outputSummaryMsg{command: command, summary: summary, error: err}
+	})
+
+	return tea.Batch(summaryCmd, m.spinner.TickCmd())
+}
+
+// handleOutputSummary shows the summary of the last command's output
+func (m *Model) handleOutputSummary(msg outputSummaryMsg) {
+	m.processing = false
+	m.showSpinner = false
+	m.status = fmt.Sprintf("Ready - %s • %s", m.currentProvider, m.currentModel)
+
+	if msg.error != nil {
+		m.addMessage("❌ Summary failed: "+msg.error.Error(), MessageTypeError)
+		return
+	}
+
+	m.addMessage("🧾 Summary: "+msg.summary, MessageTypeAssistant)
+}
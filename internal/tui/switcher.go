@@ -0,0 +1,243 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/yourusername/clia/internal/ai"
+)
+
+const switcherMaxVisible = 8 // Long model lists scroll within this many rows
+
+var (
+	switcherStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("69")).
+			Padding(0, 1)
+
+	switcherSelectedStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("86")).
+				Bold(true)
+)
+
+// switcherStage is the list shown by the quick switcher
+type switcherStage int
+
+const (
+	switcherProviders switcherStage = iota
+	switcherModels
+)
+
+// switcherItem is an entry of the quick switcher list
+type switcherItem struct {
+	id      string
+	detail  string
+	current bool
+}
+
+// quickSwitcher is the Ctrl+P overlay for switching provider and model from
+// the keyboard. It only reports the choice with switcherChoiceMsg; the model
+// applies it like /provider and /model do.
+type quickSwitcher struct {
+	stage    switcherStage
+	items    []switcherItem
+	cursor   int
+	provider string // Provider whose models are listed, or being switched to
+	loading  bool
+	err      error
+}
+
+// newProviderSwitcher lists the providers, starting at the current one
+func newProviderSwitcher(status map[ai.ProviderType]ai.ProviderStatusInfo) *quickSwitcher {
+	s := &quickSwitcher{stage: switcherProviders}
+	for providerType, info := range status {
+		detail := "not configured"
+		if info.Configured {
+			detail = "configured"
+		}
+		s.items = append(s.items, switcherItem{id: string(providerType), detail: detail, current: info.Current})
+	}
+	sort.Slice(s.items, func(i, j int) bool { return s.items[i].id < s.items[j].id })
+	s.cursor = s.currentIndex()
+	return s
+}
+
+// waitForModels shows the model stage of provider while its models load
+func (s *quickSwitcher) waitForModels(provider string) {
+	s.stage = switcherModels
+	s.provider = provider
+	s.items = nil
+	s.cursor = 0
+	s.loading = true
+	s.err = nil
+}
+
+// setModels lists the models of the provider, starting at the current one
+func (s *quickSwitcher) setModels(models []ai.ModelInfo, currentModel string, err error) {
+	s.loading = false
+	s.err = err
+	s.items = nil
+	for _, model := range models {
+		detail := model.Name
+		if detail == model.ID {
+			detail = ""
+		}
+		s.items = append(s.items, switcherItem{id: model.ID, detail: detail, current: model.ID == currentModel})
+	}
+	s.cursor = s.currentIndex()
+}
+
+// currentIndex returns the index of the current item, or 0
+func (s quickSwitcher) currentIndex() int {
+	for i, item := range s.items {
+		if item.current {
+			return i
+		}
+	}
+	return 0
+}
+
+// Update moves the cursor and reports the choice or the closing of the overlay
+func (s quickSwitcher) Update(msg tea.KeyMsg) (quickSwitcher, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k", "ctrl+k":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case "down", "j", "ctrl+j", "tab":
+		if s.cursor < len(s.items)-1 {
+			s.cursor++
+		}
+	case "enter":
+		if s.loading || len(s.items) == 0 {
+			return s, nil
+		}
+		choice := switcherChoiceMsg{stage: s.stage, id: s.items[s.cursor].id}
+		return s, func() tea.Msg { return choice }
+	case "esc", "escape", "ctrl+p":
+		return s, func() tea.Msg { return switcherCloseMsg{} }
+	}
+	return s, nil
+}
+
+// View renders the overlay with the visible part of the list
+func (s quickSwitcher) View(width int) string {
+	title := "⚡ Switch provider"
+	if s.stage == switcherModels {
+		title = "⚡ Switch model (" + s.provider + ")"
+	}
+	lines := []string{switcherSelectedStyle.Render(title)}
+
+	switch {
+	case s.loading:
+		lines = append(lines, "  Loading...")
+	case s.err != nil:
+		lines = append(lines, "  ❌ "+s.err.Error())
+	case len(s.items) == 0:
+		lines = append(lines, "  Nothing to choose from")
+	}
+
+	start := max(0, min(s.cursor-switcherMaxVisible/2, len(s.items)-switcherMaxVisible))
+	end := min(len(s.items), start+switcherMaxVisible)
+	for i := start; i < end; i++ {
+		item := s.items[i]
+		line := item.id
+		if item.detail != "" {
+			line += " - " + item.detail
+		}
+		if item.current {
+			line += " ●"
+		}
+		if i == s.cursor {
+			line = switcherSelectedStyle.Render("▸ " + line)
+		} else {
+			line = "  " + line
+		}
+		lines = append(lines, line)
+	}
+	if len(s.items) > switcherMaxVisible {
+		lines = append(lines, fmt.Sprintf("  %d of %d", s.cursor+1, len(s.items)))
+	}
+	lines = append(lines, "  ↑/↓ to choose • Enter to switch • Esc to close")
+
+	return switcherStyle.Width(max(width-2, 0)).Render(strings.Join(lines, "\n"))
+}
+
+// canOpenSwitcher reports whether the quick switcher may open; dialogs
+// waiting for typed input keep the keyboard
+func (m *Model) canOpenSwitcher() bool {
+	return m.aiService != nil && !m.waitingAPIKey && !m.onboarding && !m.inConfirmationMode &&
+		!m.inEditMode && !m.inStdinMode && !m.inPromptMode
+}
+
+// openSwitcher opens the quick switcher on the provider list
+func (m *Model) openSwitcher() {
+	m.clearAutocomplete()
+	m.switcher = newProviderSwitcher(m.aiService.GetProviderStatus())
+}
+
+// renderSwitcher renders the quick switcher overlay, if open
+func (m Model) renderSwitcher() string {
+	if m.switcher == nil {
+		return ""
+	}
+	return m.switcher.View(m.width)
+}
+
+// handleSwitcherChoice applies the provider or model chosen in the quick switcher
+func (m *Model) handleSwitcherChoice(msg switcherChoiceMsg) tea.Cmd {
+	if m.switcher == nil {
+		return nil
+	}
+
+	if msg.stage == switcherModels {
+		m.switcher = nil
+		return m.handleModelCommand([]string{msg.id})
+	}
+
+	m.switcher.waitForModels(msg.id)
+	if msg.id == m.currentProvider {
+		return m.loadSwitcherModels(msg.id)
+	}
+	// The models are listed once the provider switch succeeds
+	return m.handleProviderCommand([]string{msg.id})
+}
+
+// continueSwitcher lists the models of the provider the quick switcher
+// switched to, or closes it when the switch did not happen
+func (m *Model) continueSwitcher(msg providerSwitchMsg) tea.Cmd {
+	if m.switcher == nil || m.switcher.stage != switcherModels || m.switcher.provider != msg.providerType {
+		return nil
+	}
+	if !msg.success {
+		m.switcher = nil
+		return nil
+	}
+	return m.loadSwitcherModels(msg.providerType)
+}
+
+// loadSwitcherModels fetches the models of the current provider for the quick switcher
+func (m *Model) loadSwitcherModels(provider string) tea.Cmd {
+	aiService := m.aiService
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		models, err := aiService.GetAvailableModels(ctx)
+		return switcherModelsMsg{provider: provider, models: models, error: err}
+	}
+}
+
+// handleSwitcherModels shows the fetched models in the quick switcher
+func (m *Model) handleSwitcherModels(msg switcherModelsMsg) {
+	if m.switcher == nil || m.switcher.provider != msg.provider {
+		return
+	}
+	m.switcher.setModels(msg.models, m.currentModel, msg.error)
+}
@@ -0,0 +1,89 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/yourusername/clia/pkg/memory"
+	"github.com/yourusername/clia/pkg/utils"
+)
+
+// onlyFlaggedByAI reports whether msg needs confirmation only because the AI
+// flagged it as risky. Only these commands can become trusted: commands the
+// safety rules match, and every command in paranoid mode, always ask.
+func (m *Model) onlyFlaggedByAI(msg commandExecutionMsg) bool {
+	return !msg.safe && !m.confirmAll &&
+		m.executor.ExplainDanger(msg.resolved).Level == utils.DangerNone
+}
+
+// trusted reports whether the user confirmed command, with its alias
+// expanded, often enough for it to run without asking. Trust is kept for the
+// expansion, so redefining an alias does not carry trust over.
+func (m *Model) trusted(command string) bool {
+	return m.memoryActive() && m.memoryManager.Trusted(command)
+}
+
+// recordConfirmation remembers whether the user ran a command only the AI
+// flagged as risky, announcing when it becomes trusted
+func (m *Model) recordConfirmation(msg commandExecutionMsg, confirmed bool) {
+	if !m.memoryActive() || !m.onlyFlaggedByAI(msg) {
+		return
+	}
+	if !confirmed {
+		m.memoryManager.RecordRefusal(msg.resolved)
+		return
+	}
+	if m.memoryManager.RecordOverride(msg.resolved) {
+		m.addMessage(fmt.Sprintf("🤝 Confirmed %d times in a row: %s runs without asking from now on (/untrust to undo)", memory.TrustThreshold, msg.resolved), MessageTypeSystem)
+	}
+}
+
+// handleUntrustCommand lists the trusted commands, or makes one, picked by
+// number or by the command itself, or all of them ask for confirmation again
+func (m *Model) handleUntrustCommand(args []string) tea.Cmd {
+	if m.memoryManager == nil {
+		m.addMessage("❌ Memory is not available", MessageTypeError)
+		return nil
+	}
+	commands := m.memoryManager.TrustedCommands()
+
+	if len(args) == 0 {
+		if len(commands) == 0 {
+			m.addMessage(fmt.Sprintf("🤝 No trusted commands. Commands flagged as risky become trusted once confirmed %d times in a row.", memory.TrustThreshold), MessageTypeSystem)
+			return nil
+		}
+		lines := []string{"🤝 Trusted commands, run without confirmation:"}
+		for i, command := range commands {
+			lines = append(lines, fmt.Sprintf("  %d. %s", i+1, command))
+		}
+		lines = append(lines, "💡 /untrust <n> or /untrust all to ask for confirmation again")
+		m.addMessage(strings.Join(lines, "\n"), MessageTypeSystem)
+		return nil
+	}
+
+	targets := []string{strings.Join(args, " ")}
+	if n, err := strconv.Atoi(targets[0]); err == nil {
+		if n < 1 || n > len(commands) {
+			m.addMessage(fmt.Sprintf("❌ No trusted command %d, see /untrust", n), MessageTypeError)
+			return nil
+		}
+		targets = commands[n-1 : n]
+	} else if strings.EqualFold(targets[0], "all") {
+		targets = commands
+	}
+	if len(targets) == 0 {
+		m.addMessage("🤝 No trusted commands", MessageTypeSystem)
+		return nil
+	}
+
+	for _, command := range targets {
+		if err := m.memoryManager.Untrust(command); err != nil {
+			m.addMessage("❌ "+err.Error(), MessageTypeError)
+			return nil
+		}
+		m.addMessage("🤝 "+command+" asks for confirmation again", MessageTypeSystem)
+	}
+	return nil
+}
@@ -1,11 +1,28 @@
 package tui
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/yourusername/clia/internal/ai"
+	"github.com/yourusername/clia/internal/config"
 	"github.com/yourusername/clia/internal/executor"
+	"github.com/yourusername/clia/internal/prompt"
+	"github.com/yourusername/clia/internal/termcaps"
+	"github.com/yourusername/clia/pkg/memory"
+	"github.com/yourusername/clia/pkg/utils"
 )
 
 func TestNewModel(t *testing.T) {
@@ -120,6 +137,30 @@ func TestKeyHandling(t *testing.T) {
 	}
 }
 
+func TestPasteHandling(t *testing.T) {
+	model := New()
+	model.input.SetValue("echo ")
+	model.input.CursorEnd()
+	initialMessages := len(model.messages)
+
+	// A paste containing a newline must be inserted literally, not submitted
+	pasteMsg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("hello\nworld\n"), Paste: true}
+	updated, _ := model.Update(pasteMsg)
+	m := updated.(Model)
+
+	if got := m.input.Value(); got != "echo hello world" {
+		t.Errorf("Expected pasted text to be inserted as a single line, got %q", got)
+	}
+
+	if len(m.messages) != initialMessages {
+		t.Error("Expected paste not to submit the input")
+	}
+
+	if m.input.Position() != len("echo hello world") {
+		t.Errorf("Expected cursor after pasted text, got position %d", m.input.Position())
+	}
+}
+
 func TestMessageTypes(t *testing.T) {
 	tests := []struct {
 		msgType  MessageType
@@ -171,6 +212,74 @@ func TestFormatMessage(t *testing.T) {
 	}
 }
 
+func TestConfidenceColors(t *testing.T) {
+	defer func(enabled bool, caps termcaps.Caps) {
+		colorsEnabled, terminalCaps = enabled, caps
+	}(colorsEnabled, terminalCaps)
+	defer lipgloss.SetColorProfile(lipgloss.ColorProfile())
+	t.Setenv("TERM", "xterm-256color")
+
+	tests := []struct {
+		confidence float64
+		expected   lipgloss.Style
+	}{
+		{0.95, highConfidenceStyle},
+		{0.8, mediumConfidenceStyle},
+		{0.5, mediumConfidenceStyle},
+		{0.3, lowConfidenceStyle},
+	}
+	for _, tt := range tests {
+		got := GetConfidenceStyle(tt.confidence).GetForeground()
+		if got != tt.expected.GetForeground() {
+			t.Errorf("Confidence %.2f: expected color %v, got %v", tt.confidence, tt.expected.GetForeground(), got)
+		}
+	}
+
+	t.Setenv("NO_COLOR", "")
+	ConfigureColors("none")
+	if got := FormatConfidence(0.85); got != "85%" {
+		t.Errorf("Expected plain percentage with theme none, got %q", got)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	ConfigureTerminal(termcaps.Settings{})
+	ConfigureColors("dark")
+	if got := FormatConfidence(0.42); got != "42%" {
+		t.Errorf("Expected plain percentage with NO_COLOR, got %q", got)
+	}
+
+	t.Setenv("NO_COLOR", "")
+	ConfigureTerminal(termcaps.Settings{})
+	ConfigureColors("dark")
+	if got := FormatConfidence(0.9); !strings.Contains(got, "90%") {
+		t.Errorf("Expected colored output to contain the percentage, got %q", got)
+	}
+
+	// The config overrides the terminal, and bad settings keep what was detected
+	ConfigureTerminal(termcaps.Settings{Colors: "none"})
+	ConfigureColors("dark")
+	if got := FormatConfidence(0.9); got != "90%" {
+		t.Errorf("Expected plain percentage with colors none, got %q", got)
+	}
+	if err := ConfigureTerminal(termcaps.Settings{Colors: "lots"}); err == nil || !colorsEnabled {
+		t.Errorf("Expected an error and the detected colors, got %v", err)
+	}
+}
+
+func TestTerminalEmoji(t *testing.T) {
+	defer func(caps termcaps.Caps) { terminalCaps = caps }(terminalCaps)
+
+	msg := Message{Type: MessageTypeError, Content: "❌ Command failed"}
+	terminalCaps.Emoji = false
+	if got := utils.StripANSI(FormatMessage(msg)); !strings.Contains(got, "[x] [x] Command failed") {
+		t.Errorf("Expected ASCII symbols without emoji support, got %q", got)
+	}
+	terminalCaps.Emoji = true
+	if got := utils.StripANSI(FormatMessage(msg)); !strings.Contains(got, "✗ ❌ Command failed") {
+		t.Errorf("Expected the symbols kept, got %q", got)
+	}
+}
+
 func TestSequentialCommandExecution(t *testing.T) {
 	model := New()
 
@@ -265,15 +374,16 @@ func TestDirectCommandExecution(t *testing.T) {
 	model := New()
 
 	tests := []struct {
-		name        string
-		input       string
-		expectError bool
-		expectExec  bool
+		name       string
+		input      string
+		expectHint bool
+		expectExec bool
 	}{
 		{"Valid direct command", "!ls", false, true},
 		{"Direct command with args", "!ls -la", false, true},
 		{"Empty direct command", "!", true, false},
 		{"Space only after !", "! ", true, false},
+		{"Spaces around !", "  !  ", true, false},
 		{"Regular input", "list files", false, false},
 		{"Slash command", "/help", false, false},
 	}
@@ -290,17 +400,17 @@ func TestDirectCommandExecution(t *testing.T) {
 			// Process input
 			cmd := model.handleInputSubmit()
 
-			if tt.expectError {
-				// Should have error message in history
+			if tt.expectHint {
+				// Should explain how to run a command directly
 				found := false
 				for _, msg := range model.messages {
-					if msg.Type == MessageTypeError && strings.Contains(msg.Content, "Empty direct command") {
+					if msg.Type == MessageTypeSystem && strings.Contains(msg.Content, "Type a shell command after !") {
 						found = true
 						break
 					}
 				}
-				if !found {
-					t.Errorf("Expected error message for input %s", tt.input)
+				if !found || cmd != nil {
+					t.Errorf("Expected a usage hint for input %q", tt.input)
 				}
 			}
 
@@ -322,7 +432,7 @@ func TestDirectCommandExecution(t *testing.T) {
 				}
 			}
 
-			if !tt.expectExec && !tt.expectError {
+			if !tt.expectExec && !tt.expectHint {
 				// Regular processing - should not have direct execution message
 				for _, msg := range model.messages {
 					if strings.Contains(msg.Content, "Direct execution") {
@@ -334,6 +444,62 @@ func TestDirectCommandExecution(t *testing.T) {
 	}
 }
 
+func TestBlankInput(t *testing.T) {
+	model := New()
+	model.onboarding = false
+
+	tests := []struct {
+		input string
+		hint  string // Expected hint; empty for no message
+	}{
+		{"", ""},
+		{"   ", "Type a request, a /command or !<command>"},
+		{"\t \t", "Type a request, a /command or !<command>"},
+		{"/", "Type a command after /"},
+		{"  /  ", "Type a command after /"},
+		{"!", "Type a shell command after !"},
+	}
+	for _, tt := range tests {
+		model.messages = []Message{}
+		model.input.SetValue(tt.input)
+		if cmd := model.handleInputSubmit(); cmd != nil {
+			t.Errorf("Expected nothing to run for %q", tt.input)
+		}
+		if model.input.Value() != "" {
+			t.Errorf("Expected the input to be cleared for %q", tt.input)
+		}
+		if model.processing {
+			t.Errorf("Expected no AI request for %q", tt.input)
+		}
+
+		if tt.hint == "" {
+			if len(model.messages) != 0 {
+				t.Errorf("Expected no message for %q, got %q", tt.input, model.messages[0].Content)
+			}
+			continue
+		}
+		if len(model.messages) != 1 || model.messages[0].Type != MessageTypeSystem || !strings.Contains(model.messages[0].Content, tt.hint) {
+			t.Errorf("Expected the hint %q for %q, got %v", tt.hint, tt.input, model.messages)
+		}
+	}
+
+	// Requests are trimmed before they are sent
+	model.input.SetValue("  list files  ")
+	if cmd := model.handleInputSubmit(); cmd == nil || model.lastUserRequest != "list files" {
+		t.Errorf("Expected the trimmed request to be sent, got %q", model.lastUserRequest)
+	}
+
+	// Whitespace in a confirmation neither confirms nor cancels
+	model.clearSuggestions()
+	model.processing = false
+	model.handleCommandExecution(commandExecutionMsg{command: "rm -rf /", safe: false})
+	model.input.SetValue("  ")
+	model.handleInputSubmit()
+	if !model.inConfirmationMode {
+		t.Error("Expected whitespace to keep the confirmation open")
+	}
+}
+
 func TestDirectCommandNoSafetyChecks(t *testing.T) {
 	model := New()
 
@@ -365,3 +531,2257 @@ func TestDirectCommandNoSafetyChecks(t *testing.T) {
 		t.Error("Expected no confirmation dialog for direct command execution")
 	}
 }
+
+func TestMergeSuggestions(t *testing.T) {
+	memorySuggestions := []memorySuggestion{
+		{
+			Entry:      memory.MemoryEntry{SelectedCommand: "ls  -la", Description: "List all files", Success: true},
+			Score:      0.9,
+			UsageCount: 5,
+			LastUsed:   time.Now(),
+		},
+	}
+	aiSuggestions := []aiSuggestion{
+		{Command: "ls -la", Description: "List files in long format", Safe: true, Confidence: 0.95},
+		{Command: "find . -maxdepth 1", Description: "Find files", Safe: true, Confidence: 0.6},
+	}
+
+	merged := mergeSuggestions(memorySuggestions, aiSuggestions)
+
+	if len(merged) != 2 {
+		t.Fatalf("Expected duplicate command to be merged into 2 suggestions, got %d", len(merged))
+	}
+
+	if !merged[0].FromMemory() || !merged[0].AlsoFromAI {
+		t.Error("Expected memory entry to win the duplicate and be marked as also suggested by AI")
+	}
+
+	if merged[0].Description != "List all files" {
+		t.Errorf("Expected memory description to be kept, got %q", merged[0].Description)
+	}
+
+	if merged[1].Command != "find . -maxdepth 1" || merged[1].FromMemory() {
+		t.Errorf("Expected AI-only suggestion second, got %+v", merged[1])
+	}
+}
+
+func TestCombinedSuggestionSelection(t *testing.T) {
+	model := New()
+	model.lastUserRequest = "list files"
+
+	model.handleMemoryResults(memoryResultsMsg{
+		query: "list files",
+		results: []memory.SearchResult{
+			{Entry: memory.MemoryEntry{SelectedCommand: "ls -la", Success: true, UsageCount: 3, Timestamp: time.Now()}, Score: 0.8},
+		},
+	})
+	model.handleAIResponse(aiResponseMsg{suggestions: []aiSuggestion{
+		{Command: "ls -la", Safe: true, Confidence: 0.9},
+		{Command: "tree -L 1", Safe: true, Confidence: 0.7},
+	}})
+
+	if len(model.combinedSuggestions) != 2 {
+		t.Fatalf("Expected 2 unified suggestions, got %d", len(model.combinedSuggestions))
+	}
+
+	// Index 1 maps to the second entry of the merged list
+	cmd := model.handleCommandSelection(1)
+	if cmd == nil {
+		t.Fatal("Expected selection to return an execution command")
+	}
+
+	execMsg, ok := cmd().(commandExecutionMsg)
+	if !ok {
+		t.Fatal("Expected selection to produce a commandExecutionMsg")
+	}
+	if execMsg.command != "tree -L 1" {
+		t.Errorf("Expected 'tree -L 1' to be selected, got %q", execMsg.command)
+	}
+
+	if model.inSelectionMode || len(model.combinedSuggestions) != 0 {
+		t.Error("Expected selection mode to be cleared after selecting a command")
+	}
+}
+
+func TestSuggestionRunMode(t *testing.T) {
+	model := New()
+	model.onboarding = false
+	suggest := func(suggestions ...aiSuggestion) {
+		model.handleAIResponse(aiResponseMsg{suggestions: suggestions})
+	}
+	press := func(keys ...string) tea.Cmd {
+		var cmd tea.Cmd
+		for _, key := range keys {
+			letter, alt := strings.CutPrefix(key, "alt+")
+			var updated tea.Model
+			updated, cmd = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(letter), Alt: alt})
+			model = updated.(Model)
+		}
+		return cmd
+	}
+	selectAndRun := func(keys ...string) tea.Cmd {
+		msg, ok := press(keys...)().(commandExecutionMsg)
+		if !ok {
+			t.Fatalf("Expected %v to select a command", keys)
+		}
+		return model.handleCommandExecution(msg)
+	}
+
+	// Alt+I runs a command not detected as interactive in full terminal mode
+	suggest(aiSuggestion{Command: "echo hi", Safe: true, Confidence: 0.9})
+	cmd := selectAndRun("alt+i", "1")
+	if _, ok := cmd().(ptyExecutionRequestMsg); !ok || model.executingCommand {
+		t.Error("Expected 'echo hi' to run in full terminal mode")
+	}
+
+	// Pressing it again goes back to the detected mode
+	suggest(aiSuggestion{Command: "echo hi", Safe: true, Confidence: 0.9})
+	press("alt+i", "alt+i")
+	if model.selectionRunMode != runModeAuto || model.input.Value() != "" {
+		t.Errorf("Expected Alt+I twice to restore automatic mode without typing, got %d and %q", model.selectionRunMode, model.input.Value())
+	}
+
+	// Plain letters start a new request
+	press("s", "i", "f", "t")
+	if model.selectionRunMode != runModeAuto || model.input.Value() != "sift" {
+		t.Errorf("Expected s and i to be typed, got %d and %q", model.selectionRunMode, model.input.Value())
+	}
+	model.input.SetValue("")
+
+	// The choice is kept while the command waits for confirmation
+	suggest(aiSuggestion{Command: "echo risky", Safe: false, Confidence: 0.4})
+	selectAndRun("alt+i", "1")
+	if !model.inConfirmationMode {
+		t.Fatal("Expected the unsafe command to ask for confirmation")
+	}
+	updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	model = updated.(Model)
+	if _, ok := cmd().(ptyExecutionRequestMsg); !ok {
+		t.Error("Expected the confirmed command to run in full terminal mode")
+	}
+
+	// Alt+S streams a program detected as interactive
+	suggest(aiSuggestion{Command: "top", Safe: true, Confidence: 0.9})
+	selectAndRun("alt+s", "1")
+	if !model.executingCommand || model.currentCommand != "top" {
+		t.Error("Expected 'top' to stream its output")
+	}
+	if model.selectionRunMode != runModeAuto {
+		t.Error("Expected the mode to apply to one selection only")
+	}
+}
+
+func TestSuggestionHighlight(t *testing.T) {
+	model := New()
+	model.onboarding = false
+	model.lastUserRequest = "list files"
+	model.handleAIResponse(aiResponseMsg{suggestions: []aiSuggestion{
+		{Command: "ls -la", Description: "List files", Safe: true, Confidence: 0.9},
+		{Command: "tree -L 1", Description: "Show a tree", Safe: true, Confidence: 0.8},
+		{Command: "du -sh *", Description: "Show sizes", Safe: true, Confidence: 0.7},
+	}})
+
+	press := func(keys ...tea.KeyMsg) {
+		for _, key := range keys {
+			updated, _ := model.Update(key)
+			model = updated.(Model)
+		}
+	}
+	highlighted := func() string {
+		for _, msg := range model.messages {
+			if msg.Highlighted {
+				return msg.Content
+			}
+		}
+		return ""
+	}
+
+	if model.highlighted != 0 || !strings.HasPrefix(highlighted(), "1. ✓ ls -la") {
+		t.Fatalf("Expected the first suggestion to be highlighted, got %q", highlighted())
+	}
+	if !strings.Contains(FormatMessage(Message{Content: "1. ✓ ls -la", Type: MessageTypeAssistant, Highlighted: true}), "▸") {
+		t.Error("Expected a cursor marker on the highlighted suggestion")
+	}
+
+	// Arrows and j/k move the highlight, stopping at the ends
+	press(tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")}, tea.KeyMsg{Type: tea.KeyDown})
+	if model.highlighted != 2 || !strings.HasPrefix(highlighted(), "3. ✓ du -sh *") {
+		t.Fatalf("Expected the last suggestion to be highlighted, got %q", highlighted())
+	}
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("k")})
+	if model.highlighted != 1 || model.input.Value() != "" {
+		t.Fatalf("Expected k to move up without typing, got %d and %q", model.highlighted, model.input.Value())
+	}
+
+	// Enter runs the highlighted suggestion
+	updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = updated.(Model)
+	if cmd == nil {
+		t.Fatal("Expected Enter to select the highlighted suggestion")
+	}
+	if model.inSelectionMode || highlighted() != "" {
+		t.Error("Expected selection mode to end without a cursor left on the list")
+	}
+	if execMsg, ok := cmd().(commandExecutionMsg); !ok || execMsg.command != "tree -L 1" {
+		t.Errorf("Expected 'tree -L 1' to be selected, got %+v", execMsg)
+	}
+
+	// Once a new request is typed, j and k are text again; e edits the highlighted entry
+	model.handleAIResponse(aiResponseMsg{suggestions: []aiSuggestion{
+		{Command: "ls", Safe: true, Confidence: 0.9},
+		{Command: "ls -a", Safe: true, Confidence: 0.8},
+	}})
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	if !model.inEditMode || model.editingCommand != "ls -a" {
+		t.Errorf("Expected to edit the highlighted suggestion, got %q", model.editingCommand)
+	}
+}
+
+func TestSuggestionCategoryGroups(t *testing.T) {
+	model := New()
+	model.lastUserRequest = "clean up and go home"
+	model.handleWindowSizeMsg(tea.WindowSizeMsg{Width: 100, Height: 200})
+
+	model.handleAIResponse(aiResponseMsg{suggestions: []aiSuggestion{
+		{Command: "rm -r build", Safe: true, Confidence: 0.9, Category: "file_management"},
+		{Command: "cd ~", Safe: true, Confidence: 0.8, Category: "navigation"},
+		{Command: "rm *.tmp", Safe: true, Confidence: 0.7, Category: "file_management"},
+	}})
+
+	var listed []string
+	for _, suggestion := range model.combinedSuggestions {
+		listed = append(listed, suggestion.Command)
+	}
+	if strings.Join(listed, ", ") != "rm -r build, rm *.tmp, cd ~" {
+		t.Fatalf("Expected suggestions grouped by category, got %v", listed)
+	}
+
+	view := model.viewport.View()
+	files := strings.Index(view, "📂 File management")
+	navigation := strings.Index(view, "📂 Navigation")
+	if files < 0 || navigation < files || !strings.Contains(view, "2. ✓ rm *.tmp") || !strings.Contains(view, "3. ✓ cd ~") {
+		t.Errorf("Expected category headers with continuous numbering, got:\n%s", view)
+	}
+
+	// The numbers select in display order
+	execMsg := model.handleCommandSelection(2)().(commandExecutionMsg)
+	if execMsg.command != "cd ~" {
+		t.Errorf("Expected 'cd ~' for the third entry, got %q", execMsg.command)
+	}
+
+	// A single category needs no headers
+	model.handleAIResponse(aiResponseMsg{suggestions: []aiSuggestion{
+		{Command: "ls", Safe: true, Confidence: 0.9, Category: "file_management"},
+		{Command: "ls -la", Safe: true, Confidence: 0.8, Category: "file_management"},
+	}})
+	if count := strings.Count(model.viewport.View(), "📂"); count != 2 {
+		t.Errorf("Expected no headers for a single category, got %d headers", count)
+	}
+}
+
+func TestStreamPartialLines(t *testing.T) {
+	model := New()
+	model.executingCommand = true
+	model.streamActive = true
+	outputChan := make(chan executor.OutputLine, 10)
+	model.outputStream = outputChan
+	initialMessages := len(model.messages)
+
+	// Redraws of a progress bar update one message, marked until finished
+	outputChan <- executor.OutputLine{Content: "[#   ] 25%", Partial: true}
+	outputChan <- executor.OutputLine{Content: "warning", IsStderr: true}
+	outputChan <- executor.OutputLine{Content: "[##  ] 50%", Partial: true}
+	model.handleStreamTick()
+	if got := len(model.messages) - initialMessages; got != 2 {
+		t.Fatalf("Expected the progress line and the warning, got %d messages", got)
+	}
+	if content := model.messages[initialMessages].Content; content != "⏳ [##  ] 50%" {
+		t.Errorf("Expected the progress line to be redrawn in place, got %q", content)
+	}
+
+	outputChan <- executor.OutputLine{Content: "[####] 100%"}
+	outputChan <- executor.OutputLine{Content: "done"}
+	model.handleStreamTick()
+	if content := model.messages[initialMessages].Content; content != "📤 [####] 100%" {
+		t.Errorf("Expected the finished line in place of the progress line, got %q", content)
+	}
+	if content := model.messages[len(model.messages)-1].Content; content != "📤 done" {
+		t.Errorf("Expected the next line to be added after, got %q", content)
+	}
+	if len(model.executionOutput) != 3 {
+		t.Errorf("Expected only finished lines to be kept for summaries, got %q", model.executionOutput)
+	}
+
+	// A line cleared once finished disappears
+	outputChan <- executor.OutputLine{Content: "spinner", Partial: true}
+	outputChan <- executor.OutputLine{Content: "  "}
+	model.handleStreamTick()
+	if content := model.messages[len(model.messages)-1].Content; content != "📤 done" {
+		t.Errorf("Expected the cleared line to be removed, got %q", content)
+	}
+}
+
+func TestStreamTickDrainsBatch(t *testing.T) {
+	model := New()
+	model.executingCommand = true
+	model.currentCommand = "seq 1 600"
+	model.streamActive = true
+
+	outputChan := make(chan executor.OutputLine, 600)
+	for i := 0; i < 600; i++ {
+		outputChan <- executor.OutputLine{Content: "line"}
+	}
+	close(outputChan)
+	model.outputStream = outputChan
+
+	initialMessages := len(model.messages)
+
+	// The first tick drains a full batch and asks to be called again immediately
+	if cmd := model.handleStreamTick(); cmd == nil {
+		t.Fatal("Expected another tick while output is pending")
+	}
+	if got := len(model.messages) - initialMessages; got != maxStreamBatch {
+		t.Errorf("Expected %d lines after first tick, got %d", maxStreamBatch, got)
+	}
+
+	// The second tick drains the rest and sees the stream close
+	if cmd := model.handleStreamTick(); cmd != nil {
+		t.Error("Expected no further ticks after the stream closed")
+	}
+	if got := len(model.messages) - initialMessages; got != 601 {
+		t.Errorf("Expected 600 lines plus completion message, got %d", got)
+	}
+	if model.streamActive {
+		t.Error("Expected stream to be inactive after completion")
+	}
+}
+
+func TestStreamTimer(t *testing.T) {
+	tests := []struct {
+		elapsed  time.Duration
+		expected string
+	}{
+		{12400 * time.Millisecond, "12.4s"},
+		{185 * time.Second, "3m05s"},
+	}
+	for _, tt := range tests {
+		if got := formatElapsed(tt.elapsed); got != tt.expected {
+			t.Errorf("formatElapsed(%v) = %q, expected %q", tt.elapsed, got, tt.expected)
+		}
+	}
+
+	model := New()
+	model.executingCommand = true
+	model.currentCommand = "sleep 10"
+
+	outputChan := make(chan executor.OutputLine)
+	model.handleCommandStreamStart(commandStreamStartMsg{command: "sleep 10", stream: outputChan})
+	model.streamStartedAt = time.Now().Add(-2 * time.Second)
+
+	// Each tick updates the elapsed time shown in the status bar
+	if cmd := model.handleStreamTick(); cmd == nil {
+		t.Fatal("Expected ticks to continue while the command runs")
+	}
+	if model.streamElapsed < 2*time.Second {
+		t.Errorf("Expected elapsed time of at least 2s, got %v", model.streamElapsed)
+	}
+	if !strings.Contains(model.renderStatusBar(), "⏱") {
+		t.Error("Expected the status bar to show the timer")
+	}
+
+	close(outputChan)
+	model.handleStreamTick()
+	if strings.Contains(model.renderStatusBar(), "⏱") {
+		t.Error("Expected the timer to stop when the stream ends")
+	}
+}
+
+func TestStreamEndResult(t *testing.T) {
+	model := New()
+	model.executingCommand = true
+	model.currentCommand = "make test"
+
+	outputChan := make(chan executor.OutputLine, 3)
+	model.handleCommandStreamStart(commandStreamStartMsg{command: "make test", stream: outputChan})
+
+	outputChan <- executor.OutputLine{Content: "FAIL", IsStderr: true}
+	outputChan <- executor.OutputLine{Result: &executor.ExecutionResult{Command: "make test", ExitCode: 2, Duration: 1500 * time.Millisecond}}
+	close(outputChan)
+
+	if cmd := model.handleStreamTick(); cmd != nil {
+		t.Error("Expected no further ticks after the stream closed")
+	}
+
+	if model.executionResult == nil {
+		t.Fatal("Expected the stream result to be recorded")
+	}
+	if model.executionResult.ExitCode != 2 || model.executionResult.Duration != 1500*time.Millisecond {
+		t.Errorf("Unexpected execution result: %+v", model.executionResult)
+	}
+	if model.executingCommand || model.streamActive {
+		t.Error("Expected execution state to be reset")
+	}
+
+	last := model.messages[len(model.messages)-1].Content
+	if !strings.Contains(last, "exit code 2") || !strings.Contains(last, "1.50s") {
+		t.Errorf("Expected exit code and duration in the completion message, got %q", last)
+	}
+	if len(model.executionOutput) != 1 {
+		t.Errorf("Expected only output lines to be retained, got %v", model.executionOutput)
+	}
+}
+
+// promptInput records the answers sent to a command waiting at a prompt
+type promptInput struct {
+	strings.Builder
+	closed bool
+}
+
+func (p *promptInput) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestCommandPrompt(t *testing.T) {
+	model := New()
+	model.onboarding = false
+	model.executingCommand = true
+	model.currentCommand = "git push"
+
+	input := &promptInput{}
+	outputChan := make(chan executor.OutputLine, 4)
+	model.handleCommandStreamStart(commandStreamStartMsg{command: "git push", stream: outputChan, input: input})
+
+	// A password prompt hides the answer
+	outputChan <- executor.OutputLine{Content: "Password for 'https://bob@github.com': ", Prompt: &executor.Prompt{Text: "Password for 'https://bob@github.com':", Secret: true}}
+	model.handleStreamTick()
+	if !model.inPromptMode || model.input.EchoMode != textinput.EchoPassword {
+		t.Fatal("Expected a hidden prompt for the password")
+	}
+	if !model.awaitingAnswer() {
+		t.Error("Expected the prompt to be awaiting an answer")
+	}
+
+	model.input.SetValue("hunter2")
+	model.handleInputSubmit()
+	if input.String() != "hunter2\n" {
+		t.Errorf("Expected the answer to be sent to the command, got %q", input.String())
+	}
+	if model.inPromptMode || model.input.EchoMode != textinput.EchoNormal {
+		t.Error("Expected the input line to be restored after answering")
+	}
+	for _, msg := range model.messages {
+		if strings.Contains(msg.Content, "hunter2") {
+			t.Errorf("Expected the password to stay hidden, got message %q", msg.Content)
+		}
+	}
+
+	// An empty answer takes the default of a confirmation
+	outputChan <- executor.OutputLine{Content: "Do you want to continue? [Y/n] ", Prompt: &executor.Prompt{Text: "Do you want to continue? [Y/n]"}}
+	model.handleStreamTick()
+	model.input.SetValue("")
+	model.handleInputSubmit()
+	if input.String() != "hunter2\n\n" {
+		t.Errorf("Expected an empty answer to be sent, got %q", input.String())
+	}
+
+	// Esc at a prompt closes the input of the command
+	outputChan <- executor.OutputLine{Content: "Continue? [y/N] ", Prompt: &executor.Prompt{Text: "Continue? [y/N]"}}
+	model.handleStreamTick()
+	updated, _ := model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	model = updated.(Model)
+	if model.inPromptMode || !input.closed {
+		t.Error("Expected Esc to close the input of the command")
+	}
+
+	close(outputChan)
+	model.handleStreamTick()
+	if model.commandInput != nil {
+		t.Error("Expected the input to be released when the command ends")
+	}
+}
+
+func TestAssumeYesAfterConfirmation(t *testing.T) {
+	// Confirmations are remembered, so repeated runs must not make the
+	// command trusted in the real memory file
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	model := New()
+	model.onboarding = false
+
+	// Confirming in clia answers the questions of the package manager
+	model.handleCommandExecution(commandExecutionMsg{command: "apt install jq", safe: false, programChecked: true})
+	if !model.inConfirmationMode {
+		t.Fatal("Expected the command to ask for confirmation")
+	}
+	if cmd := model.handleConfirmationResponse(true); cmd == nil {
+		t.Fatal("Expected the command to run")
+	}
+	if model.currentCommand != "apt -y install jq" {
+		t.Errorf("Expected -y to be added, got %q", model.currentCommand)
+	}
+	model.executingCommand = false
+
+	// In the full terminal the user answers the questions
+	for _, msg := range []commandExecutionMsg{
+		{command: "sudo apt install jq", safe: false, programChecked: true},
+		{command: "apt install jq", safe: false, programChecked: true, runMode: runModeInteractive},
+	} {
+		model.handleCommandExecution(msg)
+		cmd := model.handleConfirmationResponse(true)
+		if cmd == nil {
+			t.Fatalf("Expected %q to run", msg.command)
+		}
+		if request, ok := cmd().(ptyExecutionRequestMsg); !ok || request.command != msg.command {
+			t.Errorf("Expected %q to run unchanged in the full terminal, got %#v", msg.command, request)
+		}
+	}
+
+	// A command that asks while streaming is offered the flag
+	model.currentCommand = "npm init"
+	model.startPrompt(executor.Prompt{Text: "Is this OK? (yes/no)"})
+	if last := model.messages[len(model.messages)-1].Content; !strings.Contains(last, "npm --yes init") {
+		t.Errorf("Expected the flag to be offered, got %q", last)
+	}
+	model.currentCommand = "git push"
+	model.startPrompt(executor.Prompt{Text: "Continue? [y/N]"})
+	if last := model.messages[len(model.messages)-1].Content; strings.Contains(last, "skip this question") {
+		t.Errorf("Expected no flag for unknown programs, got %q", last)
+	}
+}
+
+func BenchmarkStreamTick(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		model := New()
+		model.streamActive = true
+
+		outputChan := make(chan executor.OutputLine, 5000)
+		for j := 0; j < 5000; j++ {
+			outputChan <- executor.OutputLine{Content: "output line"}
+		}
+		close(outputChan)
+		model.outputStream = outputChan
+
+		for model.streamActive {
+			model.handleStreamTick()
+		}
+	}
+}
+
+func TestCriticalCommandRequiresTypedConfirmation(t *testing.T) {
+	model := New()
+
+	cmd := model.handleCommandExecution(commandExecutionMsg{command: "rm -rf /", safe: false})
+	if cmd != nil {
+		t.Fatal("Expected critical command not to execute without confirmation")
+	}
+	if !model.inConfirmationMode || model.requiredConfirmation != criticalConfirmationPhrase {
+		t.Fatal("Expected critical command to require a typed confirmation phrase")
+	}
+
+	// A single 'y' is treated as typed text, not as confirmation
+	updated, _ := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	model = updated.(Model)
+	if !model.inConfirmationMode {
+		t.Fatal("Expected 'y' not to confirm a critical command")
+	}
+
+	// A wrong phrase cancels the command
+	if cmd := model.handleTypedConfirmation("yes"); cmd != nil {
+		t.Error("Expected wrong phrase not to execute the command")
+	}
+	if model.inConfirmationMode || model.requiredConfirmation != "" {
+		t.Error("Expected wrong phrase to cancel the confirmation")
+	}
+
+	// Warning-level commands keep the single-key confirmation
+	model.handleCommandExecution(commandExecutionMsg{command: "curl https://example.com", safe: true})
+	if !model.inConfirmationMode || model.requiredConfirmation != "" {
+		t.Error("Expected warning-level command to use y/n confirmation")
+	}
+
+	// The dialog cites the pattern that matched
+	cited := false
+	for _, msg := range model.messages {
+		if strings.Contains(msg.Content, "🚩") && strings.Contains(msg.Content, `"curl"`) {
+			cited = true
+		}
+	}
+	if !cited {
+		t.Error("Expected the confirmation to cite the matched pattern")
+	}
+}
+
+func TestAIErrorHint(t *testing.T) {
+	model := New()
+	model.currentProvider = "openai"
+
+	tests := []struct {
+		err  error
+		hint string
+	}{
+		{ai.NewAIError(ai.ErrorTypeAuth, "no LLM provider configured", nil), "/provider"},
+		{ai.NewAIError(ai.ErrorTypeAuth, "Invalid API key", nil).WithCode(401), "rejected the API key"},
+		{fmt.Errorf("LLM completion failed: %w", ai.NewAIError(ai.ErrorTypeRateLimit, "Rate limit exceeded", nil)), "Rate limit"},
+		{ai.NewAIError(ai.ErrorTypeTimeout, "Request timeout", nil), "Network timeout"},
+		{ai.NewAIError(ai.ErrorTypeNetwork, "Cannot resolve", fmt.Errorf("%w: lookup", ai.ErrHostNotFound)), "offline"},
+		{ai.NewAIError(ai.ErrorTypeNetwork, "refused", fmt.Errorf("%w: dial", ai.ErrConnectionRefused)), "server is running"},
+		{ai.NewAIError(ai.ErrorTypeUnknown, "OpenAI API error", nil).WithCode(503), "not available"},
+		{ai.NewAIError(ai.ErrorTypeTruncated, "cut off", nil), "max_tokens"},
+		{ai.NewAIError(ai.ErrorTypeContextLength, "request too large", nil), "/trim"},
+		// Words in the message no longer pick the hint
+		{fmt.Errorf("model mentions an API key and a timeout"), ""},
+	}
+	for _, tt := range tests {
+		hint := model.aiErrorHint(tt.err)
+		if tt.hint == "" && hint != "" || !strings.Contains(hint, tt.hint) {
+			t.Errorf("aiErrorHint(%v) = %q, expected it to mention %q", tt.err, hint, tt.hint)
+		}
+	}
+}
+
+func TestTrimCommand(t *testing.T) {
+	model := New()
+	model.onboarding = false
+
+	model.handleCommand(&Command{Type: CommandTypeTrim})
+	if last := model.messages[len(model.messages)-1]; last.Type != MessageTypeError {
+		t.Errorf("Expected an error without a request to resend, got %q", last.Content)
+	}
+
+	model.lastUserRequest = "list all files"
+	if cmd := model.handleCommand(&Command{Type: CommandTypeTrim}); cmd == nil || !model.processing {
+		t.Fatal("Expected /trim to resend the last request")
+	}
+
+	// Think mode shows the estimated prompt size
+	model.thinkMode = true
+	model.addMessage("🤖 思考中...", MessageTypeSystem)
+	estimate := &ai.PromptEstimate{Model: "llama2", PromptTokens: 120, ResponseTokens: 500, ContextWindow: 4096}
+	model.handleAIResponse(aiResponseMsg{suggestions: []aiSuggestion{{Command: "ls -la", Safe: true}}, estimate: estimate})
+	found := false
+	for _, msg := range model.messages {
+		found = found || strings.Contains(msg.Content, "~120 prompt tokens + 500 for the answer of 4096 (llama2)")
+	}
+	if !found {
+		t.Error("Expected the prompt estimate in think mode")
+	}
+}
+
+func TestAliasIsCheckedExpanded(t *testing.T) {
+	model := New()
+	if err := model.executor.ApplyStateChange(model.executor.DetectStateChange("alias wipe='rm -rf /'")); err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd := model.handleCommandExecution(commandExecutionMsg{command: "wipe", safe: true}); cmd != nil {
+		t.Fatal("Expected the alias of a critical command not to run without confirmation")
+	}
+	if model.requiredConfirmation != criticalConfirmationPhrase {
+		t.Error("Expected the alias to be as critical as its expansion")
+	}
+	shown := false
+	for _, msg := range model.messages {
+		if strings.Contains(msg.Content, "Command: rm -rf / (alias wipe)") {
+			shown = true
+		}
+	}
+	if !shown {
+		t.Error("Expected the confirmation to show what the alias runs")
+	}
+}
+
+func TestParanoidMode(t *testing.T) {
+	model := New()
+	model.onboarding = false
+	model.SetConfirmAll(true)
+
+	// Even a safe command asks for confirmation
+	if cmd := model.handleCommandExecution(commandExecutionMsg{command: "ls -la", description: "List files", safe: true, confidence: 0.95}); cmd != nil {
+		t.Error("Expected paranoid mode to hold the command for confirmation")
+	}
+	if !model.inConfirmationMode || model.requiredConfirmation != "" {
+		t.Fatal("Expected a y/n confirmation for a safe command")
+	}
+	shown := ""
+	for _, msg := range model.messages {
+		shown += msg.Content + "\n"
+	}
+	for _, want := range []string{"Paranoid mode", "Command: ls -la", "List files", "Confidence"} {
+		if !strings.Contains(shown, want) {
+			t.Errorf("Expected the confirmation to show %q, got %q", want, shown)
+		}
+	}
+	if strings.Contains(shown, "SAFETY WARNING") {
+		t.Error("Expected no safety warning for a safe command")
+	}
+	if cmd := model.handleConfirmationResponse(true); cmd == nil {
+		t.Error("Expected the confirmed command to run")
+	}
+	model.executingCommand = false
+
+	model.handleParanoidCommand([]string{"off"})
+	if model.confirmAll {
+		t.Fatal("Expected /paranoid off to turn paranoid mode off")
+	}
+	if cmd := model.handleCommandExecution(commandExecutionMsg{command: "ls -la", safe: true}); cmd == nil || model.inConfirmationMode {
+		t.Error("Expected safe commands to run without confirmation again")
+	}
+}
+
+func TestConfigTimeoutCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	model := New()
+	if model.configManager == nil {
+		t.Skip("config manager not available")
+	}
+
+	model.handleConfigCommand([]string{"set", "timeout", "45s"})
+	if got := model.aiService.GetTimeout(); got != 45*time.Second {
+		t.Errorf("Expected the suggestion timeout to be 45s, got %v", got)
+	}
+	if got := model.configManager.GetConfig().API.Timeout; got != 45*time.Second {
+		t.Errorf("Expected the config to keep the 45s timeout, got %v", got)
+	}
+
+	model.handleConfigCommand([]string{"set", "max_cost", "$0.50"})
+	if model.aiService.Budget() != 0.5 || model.configManager.GetConfig().API.MaxCost != 0.5 {
+		t.Errorf("Expected a budget of $0.50, got %v", model.aiService.Budget())
+	}
+
+	for _, args := range [][]string{{"set", "timeout", "soon"}, {"set", "timeout", "-5s"}, {"set", "max_cost", "-1"}, {"set", "colors", "on"}, {"timeout"}} {
+		model.handleConfigCommand(args)
+		if last := model.messages[len(model.messages)-1]; last.Type != MessageTypeError {
+			t.Errorf("Expected /config %s to be rejected, got %q", strings.Join(args, " "), last.Content)
+		}
+	}
+	if got := model.aiService.GetTimeout(); got != 45*time.Second {
+		t.Errorf("Expected rejected values to keep the 45s timeout, got %v", got)
+	}
+}
+
+func TestConfigSaveConfirmation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	model := New()
+	if model.configManager == nil {
+		t.Skip("config manager not available")
+	}
+	model.onboarding = false
+	path := model.configManager.GetConfigPath()
+
+	model.handleConfigCommand([]string{"set", "timeout", "45s"})
+	if !strings.Contains(model.messages[len(model.messages)-2].Content, "api.timeout: 30s → 45s") {
+		t.Errorf("Expected the change to be previewed, got %q", model.messages[len(model.messages)-2].Content)
+	}
+	if model.confirmConfigSave {
+		t.Fatal("Expected a timeout change to be saved without asking")
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(saved), "45s") {
+		t.Fatalf("Expected the timeout to be saved, got %v", err)
+	}
+
+	model.configManager.SetProviderKey("openai", "sk-first")
+	model.saveConfig()
+	model.configManager.SetProviderKey("openai", "sk-second")
+	model.saveConfig()
+	if !model.confirmConfigSave {
+		t.Fatal("Expected replacing a stored key to ask before saving")
+	}
+	updated, _ := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	model = updated.(Model)
+	if model.confirmConfigSave || model.input.Value() != "" {
+		t.Error("Expected 'n' to answer the question, not go to the input")
+	}
+	if saved, _ := os.ReadFile(path); !strings.Contains(string(saved), "sk-first") {
+		t.Error("Expected 'n' to keep the stored key in the file")
+	}
+
+	model.saveConfig()
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	model = updated.(Model)
+	if saved, _ := os.ReadFile(path); !strings.Contains(string(saved), "sk-second") {
+		t.Error("Expected 'y' to save the new key")
+	}
+}
+
+func TestReloadCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	model := New()
+	if model.configManager == nil {
+		t.Skip("config manager not available")
+	}
+	model.onboarding = false
+	model.confirmAll = true // Set with /paranoid, not in the file
+
+	// The file is edited elsewhere
+	edited, err := config.NewManager()
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	edited.SetTimeout(45 * time.Second)
+	edited.SetProvider("ollama")
+	edited.GetConfig().API.Providers = map[string]config.Provider{"ollama": {Model: "llama3.1"}}
+	if err := edited.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	cmd := model.handleCommand(&Command{Type: CommandTypeReload, Raw: "/reload"})
+	if model.aiService.GetTimeout() != 45*time.Second || !model.confirmAll {
+		t.Errorf("Expected the new timeout and the session settings kept, got %s", model.aiService.GetTimeout())
+	}
+	if report := model.messages[len(model.messages)-1].Content; !strings.Contains(report, "api.timeout: 30s → 45s") || !strings.Contains(report, "api.provider: openai → ollama") {
+		t.Errorf("Expected the changes to be listed, got %q", report)
+	}
+	if cmd == nil {
+		t.Fatal("Expected the provider to be switched")
+	}
+	switched, ok := cmd().(providerSwitchMsg)
+	if !ok || !switched.success {
+		t.Fatalf("Expected the switch to ollama to succeed, got %+v", switched)
+	}
+	model.handleProviderSwitchMsg(switched)
+	if model.currentProvider != "ollama" || model.currentModel != "llama3.1" {
+		t.Errorf("Expected ollama with llama3.1, got %s with %s", model.currentProvider, model.currentModel)
+	}
+
+	// Nothing changed since
+	if cmd := model.handleReloadCommand(); cmd != nil || !strings.Contains(model.messages[len(model.messages)-1].Content, "nothing changed") {
+		t.Errorf("Expected nothing to change, got %q", model.messages[len(model.messages)-1].Content)
+	}
+
+	// An invalid file keeps the current configuration
+	edited.SetTimeout(time.Minute)
+	edited.GetConfig().API.MaxTokens = -1
+	if err := edited.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	model.handleReloadCommand()
+	if last := model.messages[len(model.messages)-1]; last.Type != MessageTypeError || !strings.Contains(last.Content, "max_tokens") {
+		t.Errorf("Expected the validation error, got %q", last.Content)
+	}
+	if model.aiService.GetTimeout() != 45*time.Second || model.configManager.GetConfig().API.MaxTokens <= 0 {
+		t.Error("Expected the current configuration to be kept")
+	}
+}
+
+func TestConfirmationHelpKey(t *testing.T) {
+	model := New()
+	model.handleCommandExecution(commandExecutionMsg{command: "curl https://example.com", safe: true})
+
+	updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("?")})
+	model = updated.(Model)
+	if cmd == nil {
+		t.Fatal("Expected '?' to look up the command help")
+	}
+	if !model.inConfirmationMode {
+		t.Fatal("Expected '?' to keep the confirmation open")
+	}
+
+	model.handleCommandHelp(commandHelpMsg{command: "curl https://example.com", help: "curl - transfer a URL"})
+	last := model.messages[len(model.messages)-2]
+	if !strings.Contains(last.Content, "curl - transfer a URL") {
+		t.Errorf("Expected the help to be shown, got %q", last.Content)
+	}
+
+	model.handleCommandHelp(commandHelpMsg{command: "curl https://example.com", error: fmt.Errorf("no help found for curl")})
+	if last := model.messages[len(model.messages)-2]; !strings.Contains(last.Content, "no help found") {
+		t.Errorf("Expected a missing help message, got %q", last.Content)
+	}
+	if !model.inConfirmationMode {
+		t.Error("Expected the confirmation to stay open after showing help")
+	}
+}
+
+func TestConfirmationEditKey(t *testing.T) {
+	model := New()
+	model.handleCommandExecution(commandExecutionMsg{command: "curl https://example.com", description: "Fetch", safe: false})
+
+	updated, _ := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	model = updated.(Model)
+	if model.inConfirmationMode || !model.inEditMode {
+		t.Fatal("Expected 'e' to leave the confirmation for edit mode")
+	}
+	if model.input.Value() != "curl https://example.com" {
+		t.Errorf("Expected the pending command in the input, got %q", model.input.Value())
+	}
+
+	// The edited command is checked again
+	model.input.SetValue("curl -I https://example.com")
+	msg := model.exitEditMode(true)()
+	updated, _ = model.Update(msg)
+	model = updated.(Model)
+	if !model.inConfirmationMode || model.pendingCommand.command != "curl -I https://example.com" {
+		t.Errorf("Expected the edited command to need confirmation, got %+v", model.pendingCommand)
+	}
+
+	// Critical commands take a typed phrase, so 'e' is typed
+	model.handleConfirmationResponse(false)
+	model.handleCommandExecution(commandExecutionMsg{command: "rm -rf /", safe: false})
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	model = updated.(Model)
+	if !model.inConfirmationMode || model.input.Value() != "e" {
+		t.Errorf("Expected 'e' to be typed into the confirmation phrase, got %q", model.input.Value())
+	}
+}
+
+func TestSpinnerStyle(t *testing.T) {
+	for name, expected := range map[string]SpinnerType{"": SpinnerClassic, "dots": SpinnerDots, "Line": SpinnerSimple, "bounce": SpinnerBounce} {
+		if spinnerType, err := ParseSpinnerType(name); err != nil || spinnerType != expected {
+			t.Errorf("ParseSpinnerType(%q) = %v, %v, expected %v", name, spinnerType, err, expected)
+		}
+	}
+	if _, err := ParseSpinnerType("wheel"); err == nil {
+		t.Error("Expected an unknown spinner to be rejected")
+	}
+
+	bounce := NewSpinner().WithType(SpinnerBounce)
+	if bounce.View() == bounce.NextFrame().View() {
+		t.Error("Expected the bounce spinner to animate")
+	}
+
+	// The thinking message follows the config and keeps animating its dots
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	model := New()
+	model.thinkingText = "Pondering"
+	model.processing = true
+	model.addMessage(model.thinkingMessage("..."), MessageTypeSystem)
+	model.pulseFrame = 9
+	updated, _ := model.Update(SpinnerTickMsg{})
+	model = updated.(Model)
+	if last := model.messages[len(model.messages)-1].Content; last != "🤖 Pondering." {
+		t.Errorf("Expected the thinking message to animate, got %q", last)
+	}
+}
+
+func TestShellStateCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	model := New()
+	model.onboarding = false
+	model.executor = executor.New().WithWorkDir(dir)
+
+	// cd changes the directory of the session instead of a shell that exits
+	if cmd := model.executeCommand("cd src", "Enter src"); cmd != nil || model.executingCommand {
+		t.Fatal("Expected cd to be applied without running a shell")
+	}
+	if model.executor.WorkDir() != filepath.Join(dir, "src") {
+		t.Errorf("Expected the session to be in src, got %s", model.executor.WorkDir())
+	}
+	collected, err := model.aiService.GetPromptBuilder().GetContextCollector().Collect()
+	if err != nil || collected.WorkingDir != filepath.Join(dir, "src") {
+		t.Errorf("Expected requests to describe the new directory, got %+v, %v", collected, err)
+	}
+
+	model.executeCommand("export API_TOKEN=secret", "")
+	if last := model.messages[len(model.messages)-1].Content; !strings.Contains(last, "API_TOKEN") || strings.Contains(last, "secret") {
+		t.Errorf("Expected the variable to be set without showing its value, got %q", last)
+	}
+
+	// What cannot be kept is run with a warning
+	if cmd := model.executeCommand("source env.sh", ""); cmd == nil {
+		t.Error("Expected source to run")
+	}
+	shown := ""
+	for _, msg := range model.messages {
+		shown += msg.Content + "\n"
+	}
+	if !strings.Contains(shown, "source only affects the shell it runs in") {
+		t.Errorf("Expected a warning that source won't last, got %q", shown)
+	}
+}
+
+func TestFormatOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	model := New()
+	model.onboarding = false
+	lastMessage := func() string {
+		return utils.StripANSI(model.messages[len(model.messages)-1].Content)
+	}
+
+	// JSON output is offered formatted, stderr aside
+	model.outputCommand = "curl -s api/users/1"
+	model.executionOutput = []string{`{"id": 1, "name": "Ada", "tags": ["admin"], "active": true}`, "[stderr] 100 bytes"}
+	model.offerFormattedOutput()
+	if last := lastMessage(); !strings.Contains(last, "The output is JSON") {
+		t.Fatalf("Expected formatting to be offered, got %q", last)
+	}
+	model.handleFormatCommand(nil)
+	expected := "{\n  \"id\": 1,\n  \"name\": \"Ada\",\n  \"tags\": [\n    \"admin\"\n  ],\n  \"active\": true\n}"
+	if last := lastMessage(); !strings.HasSuffix(last, expected) {
+		t.Errorf("Expected the JSON to be indented, got %q", last)
+	}
+
+	// With formatting on, YAML is formatted right away
+	model.handleFormatCommand([]string{"on"})
+	model.outputCommand = "kubectl get pod web -o yaml"
+	model.executionOutput = []string{"metadata:", "    name: web   # the pod", "spec:", "    containers:", "    - image: nginx"}
+	model.offerFormattedOutput()
+	expected = "metadata:\n  name: web # the pod\nspec:\n  containers:\n    - image: nginx"
+	if last := lastMessage(); !strings.Contains(last, "YAML output of kubectl") || !strings.HasSuffix(last, expected) {
+		t.Errorf("Expected the YAML to be re-indented, got %q", last)
+	}
+
+	// Plain text is left alone
+	for _, output := range [][]string{{"total 8", "drwxr-xr-x 2 user user 4096 ."}, {"Status: ok"}, {"42"}} {
+		count := len(model.messages)
+		model.executionOutput = output
+		model.offerFormattedOutput()
+		if len(model.messages) != count {
+			t.Errorf("Expected %q not to be formatted, got %q", output, lastMessage())
+		}
+	}
+	model.handleFormatCommand(nil)
+	if model.messages[len(model.messages)-1].Type != MessageTypeError {
+		t.Error("Expected /format to report plain text output")
+	}
+}
+
+func TestFreeTierTip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	model := New()
+	model.onboarding = false
+	model.currentModel = "z-ai/glm-4.5-air:free"
+	rateLimited := ai.NewAIError(ai.ErrorTypeRateLimit, "OpenRouter rate limit exceeded", nil)
+
+	model.handleAIResponse(aiResponseMsg{error: rateLimited})
+	if model.freeTierTip() != nil {
+		t.Error("Expected no tip after a single rate limit")
+	}
+	model.handleAIResponse(aiResponseMsg{error: errors.New("network error")})
+	model.handleAIResponse(aiResponseMsg{error: rateLimited})
+	if model.freeTierTip() != nil {
+		t.Error("Expected other errors to restart the count")
+	}
+	model.handleAIResponse(aiResponseMsg{error: rateLimited})
+	if model.freeTierTip() == nil {
+		t.Fatal("Expected a tip once the free model keeps hitting its rate limit")
+	}
+	model.handleAIResponse(aiResponseMsg{error: rateLimited})
+	if model.freeTierTip() != nil {
+		t.Error("Expected the tip only once")
+	}
+
+	model.handleFreeTierTip(freeTierTipMsg{
+		model:       "z-ai/glm-4.5-air:free",
+		alternative: ai.ModelInfo{ID: "z-ai/glm-4.5-air", Pricing: "$0.200/$1.100 per 1k tokens"},
+		found:       true,
+	})
+	if last := model.messages[len(model.messages)-1].Content; !strings.Contains(last, "/model z-ai/glm-4.5-air switches") {
+		t.Errorf("Expected the paid variant to be recommended, got %q", last)
+	}
+}
+
+func TestUndoCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	model := New()
+	model.onboarding = false
+	model.executor = executor.New().WithWorkDir(dir)
+
+	if cmd := model.handleUndoCommand(); cmd != nil {
+		t.Error("Expected nothing to undo before a command ran")
+	}
+
+	// A failed command offers no undo
+	model.planUndo("mv a.txt b.txt")
+	model.offerUndo("mv a.txt b.txt", false)
+	if model.lastUndo != nil {
+		t.Fatal("Expected no undo for a failed command")
+	}
+
+	model.planUndo("mv a.txt b.txt")
+	model.offerUndo("mv a.txt b.txt", true)
+	if model.lastUndo == nil || model.lastUndo.inverse != "mv b.txt a.txt" {
+		t.Fatalf("Expected /undo to move the file back, got %+v", model.lastUndo)
+	}
+	if last := model.messages[len(model.messages)-1].Content; !strings.Contains(last, "/undo") || !strings.Contains(last, "mv b.txt a.txt") {
+		t.Errorf("Expected the undo to be offered, got %q", last)
+	}
+
+	if cmd := model.handleUndoCommand(); cmd == nil {
+		t.Fatal("Expected the inverse to run")
+	}
+	if model.lastUndo != nil {
+		t.Error("Expected the undo to be used up")
+	}
+	shown := ""
+	for _, msg := range model.messages {
+		shown += msg.Content + "\n"
+	}
+	if !strings.Contains(shown, "Executing safe command: mv b.txt a.txt") || !strings.Contains(shown, "Undo mv a.txt b.txt") {
+		t.Errorf("Expected the inverse to go through the safety check, got %q", shown)
+	}
+}
+
+func TestMissingProgramOffer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	model := New()
+	model.onboarding = false
+	command := commandExecutionMsg{command: "clia-no-such-top -d 5", description: "Watch processes", safe: true}
+	press := func(key string) tea.Cmd {
+		updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)})
+		model = updated.(Model)
+		return cmd
+	}
+
+	if cmd := model.handleCommandExecution(command); cmd != nil || model.missingProgram == nil {
+		t.Fatal("Expected the command to be held back")
+	}
+	if model.executingCommand {
+		t.Error("Expected nothing to run")
+	}
+
+	// 'i' asks how to install the program
+	if cmd := press("i"); cmd == nil || model.lastUserRequest != "install clia-no-such-top" {
+		t.Errorf("Expected an install request, got %q", model.lastUserRequest)
+	}
+	if model.missingProgram != nil {
+		t.Error("Expected the offer to be over")
+	}
+
+	// 'a' asks for an alternative
+	model.processing = false
+	model.handleCommandExecution(command)
+	press("a")
+	if model.lastUserRequest != "Watch processes without clia-no-such-top" {
+		t.Errorf("Expected a request for an alternative, got %q", model.lastUserRequest)
+	}
+
+	// Other keys dismiss the offer and are typed
+	model.processing = false
+	model.handleCommandExecution(command)
+	press("h")
+	if model.missingProgram != nil || model.input.Value() != "h" {
+		t.Errorf("Expected the key to be typed, got %q", model.input.Value())
+	}
+
+	// Programs that are installed run as before
+	model.input.SetValue("")
+	model.handleCommandExecution(commandExecutionMsg{command: "ls -la", safe: false})
+	if model.missingProgram != nil || !model.inConfirmationMode {
+		t.Error("Expected an installed program to go on to the confirmation")
+	}
+}
+
+func TestDeletionPreviewConfirmation(t *testing.T) {
+	model := New()
+	command := "find . -name '*.o' -delete"
+	if cmd := model.handleCommandExecution(commandExecutionMsg{command: command, safe: true}); cmd == nil {
+		t.Fatal("Expected the confirmation to preview what would be deleted")
+	}
+	if !model.inConfirmationMode {
+		t.Fatal("Expected find -delete to need a confirmation")
+	}
+
+	impact := &executor.DeletionImpact{Preview: "find . -name '*.o' -print", Paths: []string{"./a.o", "./b.o"}, Total: 2}
+	model.handleDeletionPreview(deletionPreviewMsg{command: command, impact: impact})
+	last := model.messages[len(model.messages)-1].Content
+	if !strings.Contains(last, "Would delete 2 paths") || !strings.Contains(last, "./b.o") {
+		t.Errorf("Expected the preview to be shown, got %q", last)
+	}
+
+	// A preview arriving after the confirmation ended is dropped
+	model.handleConfirmationResponse(false)
+	count := len(model.messages)
+	model.handleDeletionPreview(deletionPreviewMsg{command: command, impact: impact})
+	if len(model.messages) != count {
+		t.Error("Expected a late preview not to be shown")
+	}
+
+	// Commands without a read-only variant are not previewed
+	if cmd := model.handleCommandExecution(commandExecutionMsg{command: "curl https://example.com", safe: true}); cmd != nil {
+		t.Error("Expected no preview for a command that deletes nothing")
+	}
+}
+
+func TestParseModelOverride(t *testing.T) {
+	tests := []struct {
+		input   string
+		request string
+		model   string
+	}{
+		{"@gpt-4 how do I find large files", "how do I find large files", "gpt-4"},
+		{"  @openai/gpt-4   list ports ", "list ports", "openai/gpt-4"},
+		{"how do I find large files --model=gpt-4", "how do I find large files", "gpt-4"},
+		{"list ports --model=smart", "list ports", "smart"},
+		{"@gpt-4", "", "gpt-4"},
+		{"@ list files", "@ list files", ""},
+		{"email me@example.com", "email me@example.com", ""},
+		{"explain the --model flag", "explain the --model flag", ""},
+		{"--model=", "--model=", ""},
+	}
+	for _, tt := range tests {
+		request, model := ParseModelOverride(tt.input)
+		if request != tt.request || model != tt.model {
+			t.Errorf("ParseModelOverride(%q) = %q, %q, expected %q, %q", tt.input, request, model, tt.request, tt.model)
+		}
+	}
+}
+
+func TestModelSwitchDetails(t *testing.T) {
+	model := New()
+	model.onboarding = false
+	model.aiService.SetProvider(ai.NewMockProvider("mock", "gpt-4o"))
+
+	model.handleModelSwitchMsg(modelSwitchMsg{modelName: "gpt-4o", success: true})
+	if last := model.messages[len(model.messages)-1]; last.Content != "📏 128k tokens of context • 💲 $2.50 in / $10.00 out per 1M tokens" {
+		t.Errorf("Expected the context length and price of gpt-4o, got %q", last.Content)
+	}
+
+	model.handleModelSwitchMsg(modelSwitchMsg{modelName: "my-model", success: true})
+	details := model.messages[len(model.messages)-2].Content
+	if details != "📏 context length unknown • 💲 price unknown" || !strings.Contains(model.messages[len(model.messages)-1].Content, "/model lists") {
+		t.Errorf("Expected unknown details with a hint, got %q", details)
+	}
+
+	model.handleModelSwitchMsg(modelSwitchMsg{modelName: "llama-3:free", success: true})
+	if !strings.Contains(model.messages[len(model.messages)-2].Content, "💲 free") {
+		t.Errorf("Expected a free model to say so, got %q", model.messages[len(model.messages)-2].Content)
+	}
+
+	for tokens, want := range map[int]string{512: "512", 4096: "4k", 131072: "131k", 1000000: "1M", 1047576: "1M"} {
+		if got := FormatTokenCount(tokens); got != want {
+			t.Errorf("FormatTokenCount(%d) = %q, expected %q", tokens, got, want)
+		}
+	}
+}
+
+func TestModelOverrideInput(t *testing.T) {
+	model := New()
+	model.onboarding = false
+
+	model.input.SetValue("@gpt-4")
+	if cmd := model.handleInputSubmit(); cmd != nil {
+		t.Error("Expected no request without text after the model")
+	}
+	if last := model.messages[len(model.messages)-1]; last.Type != MessageTypeError || !strings.Contains(last.Content, "Usage: @<model>") {
+		t.Errorf("Expected a usage hint, got %q", last.Content)
+	}
+
+	model.input.SetValue("@gpt-4 find large files")
+	if cmd := model.handleInputSubmit(); cmd == nil {
+		t.Fatal("Expected the request to be sent")
+	}
+	if model.lastUserRequest != "find large files" {
+		t.Errorf("Expected the model prefix to be stripped, got %q", model.lastUserRequest)
+	}
+	found := false
+	for _, msg := range model.messages {
+		if strings.Contains(msg.Content, "Using gpt-4 for this request") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected a note about the one-off model")
+	}
+}
+
+func TestStdinInput(t *testing.T) {
+	model := New()
+
+	if cmd := model.executeCommand("sort", ""); cmd != nil {
+		t.Fatal("Expected a command reading stdin to wait for input")
+	}
+	if !model.inStdinMode || model.stdinCommand != "sort" {
+		t.Fatal("Expected stdin mode for sort")
+	}
+
+	for _, line := range []string{"banana", "", "apple"} {
+		model.input.SetValue(line)
+		updated, _ := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		model = updated.(Model)
+	}
+	if len(model.stdinLines) != 3 {
+		t.Fatalf("Expected 3 lines of input including the empty one, got %q", model.stdinLines)
+	}
+
+	updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyCtrlD})
+	model = updated.(Model)
+	if cmd == nil || model.inStdinMode || !model.executingCommand {
+		t.Fatal("Expected Ctrl+D to run the command")
+	}
+
+	// Esc cancels the command
+	model = New()
+	model.executeCommand("grep foo", "")
+	updated, cmd = model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	model = updated.(Model)
+	if cmd != nil || model.inStdinMode || model.executingCommand {
+		t.Error("Expected Esc to cancel the command")
+	}
+}
+
+func TestCompactSuggestions(t *testing.T) {
+	if UseCompactSuggestions(0, false) || UseCompactSuggestions(120, false) {
+		t.Error("Expected the regular layout on wide or unsized terminals")
+	}
+	if !UseCompactSuggestions(60, false) || !UseCompactSuggestions(120, true) {
+		t.Error("Expected the compact layout on narrow terminals or when configured")
+	}
+	if FitCommand("abcdef", 4) != "abc…" || FitCommand("abc", 4) != "abc" || FitCommand("abcdef", 0) != "abcdef" {
+		t.Error("Unexpected FitCommand result")
+	}
+
+	model := New()
+	model.width = 60
+	model.handleCombinedSuggestions(combinedSuggestionsMsg{
+		aiSuggestions: []aiSuggestion{
+			{Command: "ls -la", Description: "List files", Safe: true, Confidence: 0.9},
+			{Command: "du -sh *", Description: "Show sizes", Safe: true, Confidence: 0.8},
+		},
+	})
+
+	var lines []string
+	for _, msg := range model.messages {
+		if msg.Type == MessageTypeAssistant {
+			lines = append(lines, msg.Content)
+		}
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 suggestions, got %q", lines)
+	}
+	if lines[0] != "1. ✓ ls -la\n   List files" {
+		t.Errorf("Expected the first suggestion to show its description, got %q", lines[0])
+	}
+	if lines[1] != "2. ✓ du -sh *" {
+		t.Errorf("Expected a single line for the other suggestions, got %q", lines[1])
+	}
+}
+
+func TestQuickSwitcher(t *testing.T) {
+	model := New()
+	model.onboarding = false
+
+	updated, _ := model.Update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	model = updated.(Model)
+	if model.switcher == nil || model.switcher.stage != switcherProviders || len(model.switcher.items) == 0 {
+		t.Fatal("Expected Ctrl+P to open the provider list")
+	}
+	if !strings.Contains(model.renderSwitcher(), "Switch provider") {
+		t.Error("Expected the overlay to be rendered")
+	}
+
+	// Keys go to the overlay, not the input
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	model = updated.(Model)
+	if model.input.Value() != "" {
+		t.Error("Expected keys not to reach the input while the overlay is open")
+	}
+
+	// Choosing the current provider lists its models
+	cmd := model.handleSwitcherChoice(switcherChoiceMsg{stage: switcherProviders, id: model.currentProvider})
+	if cmd == nil || !model.switcher.loading {
+		t.Fatal("Expected the models of the provider to be loaded")
+	}
+	model.handleSwitcherModels(switcherModelsMsg{
+		provider: model.currentProvider,
+		models:   []ai.ModelInfo{{ID: "fast-model"}, {ID: "smart-model", Name: "Smart"}},
+	})
+	if len(model.switcher.items) != 2 || model.switcher.stage != switcherModels {
+		t.Fatalf("Expected 2 models, got %+v", model.switcher.items)
+	}
+
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	model = updated.(Model)
+	updated, cmd = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = updated.(Model)
+	choice, ok := cmd().(switcherChoiceMsg)
+	if !ok || choice.stage != switcherModels || choice.id != "smart-model" {
+		t.Fatalf("Expected smart-model to be chosen, got %+v", choice)
+	}
+	if cmd := model.handleSwitcherChoice(choice); cmd == nil || model.switcher != nil {
+		t.Error("Expected choosing a model to switch to it and close the overlay")
+	}
+
+	// Esc closes the overlay
+	model.openSwitcher()
+	updated, cmd = model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	model = updated.(Model)
+	updated, _ = model.Update(cmd())
+	model = updated.(Model)
+	if model.switcher != nil {
+		t.Error("Expected Esc to close the overlay")
+	}
+}
+
+func TestOfflineCommand(t *testing.T) {
+	model := New()
+	model.SetOffline(false)
+
+	model.handleCommand(ParseCommand("/offline"))
+	if !model.aiService.IsOffline() {
+		t.Fatal("Expected /offline to enable offline mode")
+	}
+	if !strings.Contains(model.renderStatusBar(), "offline") {
+		t.Error("Expected status bar to show the offline indicator")
+	}
+
+	model.handleCommand(ParseCommand("/offline"))
+	if model.aiService.IsOffline() {
+		t.Error("Expected second /offline to disable offline mode")
+	}
+
+	model.handleCommand(ParseCommand("/offline on"))
+	if !model.aiService.IsOffline() {
+		t.Error("Expected /offline on to enable offline mode")
+	}
+
+	model.handleCommand(ParseCommand("/offline off"))
+	if model.aiService.IsOffline() {
+		t.Error("Expected /offline off to disable offline mode")
+	}
+}
+
+func TestFormatUsageTiming(t *testing.T) {
+	usage := &ai.UsageInfo{
+		CompletionTokens: 50,
+		TotalDuration:    2500 * time.Millisecond,
+		LoadDuration:     500 * time.Millisecond,
+		EvalDuration:     time.Second,
+	}
+
+	formatted := FormatUsageTiming(usage)
+	for _, expected := range []string{"50 tokens", "50.0 tok/s", "load 500ms", "total 2.5s"} {
+		if !strings.Contains(formatted, expected) {
+			t.Errorf("Expected %q in %q", expected, formatted)
+		}
+	}
+}
+
+func TestNormalizeEditedCommand(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{editorHeader + "ls -la\n", "ls -la"},
+		{"find . -name '*.go' \\\n  -type f\n", "find . -name '*.go' -type f"},
+		{"cat file |\n  grep foo\n", "cat file | grep foo"},
+		{"cd /tmp\nls\n", "cd /tmp; ls"},
+		{"make build &&\nmake test\n", "make build && make test"},
+		{editorHeader + "\n\n", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeEditedCommand(tt.content); got != tt.expected {
+			t.Errorf("normalizeEditedCommand(%q) = %q, expected %q", tt.content, got, tt.expected)
+		}
+	}
+}
+
+func TestEditorFinished(t *testing.T) {
+	model := New()
+	model.enterEditMode(aiSuggestion{Command: "ls", Description: "List files", Safe: true, Confidence: 0.9})
+
+	// An editor failure keeps edit mode so the user can continue inline
+	model.handleEditorFinished(EditorFinishedMsg{Err: fmt.Errorf("exit status 1")})
+	if !model.inEditMode || model.input.Value() != "ls" {
+		t.Fatal("Expected editor failure to keep editing the original command")
+	}
+
+	// A saved command proceeds to execution
+	cmd := model.handleEditorFinished(EditorFinishedMsg{Command: "ls -la /tmp"})
+	if cmd == nil {
+		t.Fatal("Expected edited command to proceed to execution")
+	}
+	if model.inEditMode {
+		t.Error("Expected edit mode to end after the editor returns")
+	}
+
+	msg, ok := cmd().(commandExecutionMsg)
+	if !ok || msg.command != "ls -la /tmp" {
+		t.Errorf("Expected execution of the edited command, got %#v", msg)
+	}
+
+	// An emptied file cancels the edit
+	model.enterEditMode(aiSuggestion{Command: "ls", Safe: true})
+	if cmd := model.handleEditorFinished(EditorFinishedMsg{}); cmd != nil {
+		t.Error("Expected empty editor result to cancel without executing")
+	}
+	if model.inEditMode {
+		t.Error("Expected empty editor result to exit edit mode")
+	}
+}
+
+func TestCreativityCommand(t *testing.T) {
+	model := New()
+
+	model.handleCommand(ParseCommand("/creativity high"))
+	if model.aiService.GetCreativity() != ai.CreativityHigh {
+		t.Fatal("Expected /creativity high to set high creativity")
+	}
+	if !strings.Contains(model.renderStatusBar(), "high") {
+		t.Error("Expected status bar to show the creativity setting")
+	}
+
+	model.handleCommand(ParseCommand("/creativity wild"))
+	if model.aiService.GetCreativity() != ai.CreativityHigh {
+		t.Error("Expected invalid creativity to keep the current setting")
+	}
+
+	// +/- adjust creativity while choosing a suggestion
+	model.inSelectionMode = true
+	updated, _ := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("-")})
+	model = updated.(Model)
+	if model.aiService.GetCreativity() != ai.CreativityMedium {
+		t.Errorf("Expected '-' to lower creativity to medium, got %q", model.aiService.GetCreativity())
+	}
+	if model.input.Value() != "" {
+		t.Error("Expected '-' not to be typed into the input")
+	}
+}
+
+func TestOnboarding(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("OPENROUTER_API_KEY", "")
+	t.Setenv("OPENAI_API_KEY", "")
+
+	model := New()
+	if !model.onboarding {
+		t.Fatal("Expected onboarding without any configured provider")
+	}
+
+	model.handleOnboardingChoice("7")
+	if model.waitingAPIKey {
+		t.Error("Expected an unknown choice to keep showing the menu")
+	}
+
+	model.handleOnboardingChoice("1")
+	if !model.waitingAPIKey || model.apiKeyProvider != "openrouter" {
+		t.Errorf("Expected an openrouter API key prompt, got waiting=%v provider=%q", model.waitingAPIKey, model.apiKeyProvider)
+	}
+
+	model.skipOnboarding()
+	if model.onboarding || model.waitingAPIKey {
+		t.Error("Expected skip to leave onboarding")
+	}
+	if !model.aiService.IsOffline() {
+		t.Error("Expected skip to fall back to offline mode")
+	}
+
+	model.onboarding = true
+	model.finishOnboarding("openai", "sk-test")
+	if model.onboarding || model.aiService.IsOffline() {
+		t.Error("Expected finishing onboarding to leave offline mode")
+	}
+	if provider, key, ok := model.configManager.GetStoredProvider(); !ok || provider != "openai" || key != "sk-test" {
+		t.Errorf("Expected onboarding to save the provider, got %q %q %v", provider, key, ok)
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	model := New()
+	model.onboarding = false
+	model.width = 120
+	if bar := model.renderFavoritesBar(); bar != "" {
+		t.Errorf("Expected no favorites bar without favorites, got %q", bar)
+	}
+
+	model.handleFavCommand(ParseCommand(`/fav add "git status"`))
+	model.handleFavCommand(ParseCommand(`/fav add grep -rn  TODO .`))
+	if favorites := model.favorites(); len(favorites) != 2 || favorites[0] != "git status" || favorites[1] != "grep -rn  TODO ." {
+		t.Fatalf("Expected both favorites, got %q", favorites)
+	}
+	if bar := model.renderFavoritesBar(); !strings.Contains(bar, "1 git status") || !strings.Contains(bar, "2 grep") {
+		t.Errorf("Expected the numbered favorites in the bar, got %q", bar)
+	}
+
+	// Favorites are saved in the config file
+	reloaded := New()
+	if favorites := reloaded.favorites(); len(favorites) != 2 {
+		t.Errorf("Expected the favorites to be persisted, got %q", favorites)
+	}
+
+	// Alt+1 runs the first favorite without asking the AI
+	updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("1"), Alt: true})
+	model = updated.(Model)
+	if cmd == nil || model.currentCommand != "git status" {
+		t.Errorf("Expected Alt+1 to run git status, got %q", model.currentCommand)
+	}
+	model.executingCommand = false
+
+	model.handleFavCommand(ParseCommand("/fav remove 1"))
+	if favorites := model.favorites(); len(favorites) != 1 || favorites[0] != "grep -rn  TODO ." {
+		t.Errorf("Expected the first favorite to be removed, got %q", favorites)
+	}
+	if cmd := model.handleFavCommand(ParseCommand("/fav 4")); cmd != nil {
+		t.Error("Expected a missing favorite not to run")
+	}
+	if last := model.messages[len(model.messages)-1].Content; !strings.Contains(last, "No favorite 4") {
+		t.Errorf("Expected a missing favorite to be reported, got %q", last)
+	}
+}
+
+func TestBackgroundCommand(t *testing.T) {
+	tests := []struct {
+		input      string
+		command    string
+		background bool
+	}{
+		{"make test &", "make test", true},
+		{"sleep 5&", "sleep 5", true},
+		{"make && make install", "make && make install", false},
+		{"make test &&", "make test &&", false},
+		{"ls", "ls", false},
+	}
+	for _, tt := range tests {
+		command, background := backgroundCommand(tt.input)
+		if command != tt.command || background != tt.background {
+			t.Errorf("backgroundCommand(%q) = %q, %v; want %q, %v", tt.input, command, background, tt.command, tt.background)
+		}
+	}
+}
+
+func TestBackgroundJobs(t *testing.T) {
+	model := New()
+	model.onboarding = false
+
+	cmd := model.handleDirectCommand("!echo first; sleep 0.2; echo second &")
+	if cmd == nil || len(model.jobs) != 1 {
+		t.Fatal("Expected a background job to start")
+	}
+	if model.executingCommand {
+		t.Error("Expected the input to stay free while the job runs")
+	}
+	if tick := model.handleJobStarted(cmd().(jobStartedMsg)); tick == nil {
+		t.Fatal("Expected job output to be drained")
+	}
+	if !strings.Contains(model.renderStatusBar(), "1 job") {
+		t.Error("Expected the status bar to count the running job")
+	}
+
+	// A second job runs alongside the first
+	second := model.handleDirectCommand("!echo other &")
+	model.handleJobStarted(second().(jobStartedMsg))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for model.runningJobs() > 0 && time.Now().Before(deadline) {
+		model.handleJobTick()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if model.runningJobs() != 0 {
+		t.Fatal("Expected both jobs to finish")
+	}
+	if cmd := model.handleJobTick(); cmd != nil || model.jobsTicking {
+		t.Error("Expected ticking to stop once all jobs finished")
+	}
+
+	model.handleJobsCommand()
+	list := model.messages[len(model.messages)-1].Content
+	if !strings.Contains(list, "[1] exit 0") || !strings.Contains(list, "[2] exit 0") {
+		t.Errorf("Expected both finished jobs to be listed, got %q", list)
+	}
+
+	model.handleJobCommand([]string{"1"})
+	output := model.messages[len(model.messages)-1].Content
+	if !strings.Contains(output, "first") || !strings.Contains(output, "second") || strings.Contains(output, "other") {
+		t.Errorf("Expected the job to keep its own output, got %q", output)
+	}
+
+	model.handleJobCommand([]string{"7"})
+	if last := model.messages[len(model.messages)-1].Content; !strings.Contains(last, "No job 7") {
+		t.Errorf("Expected a missing job to be reported, got %q", last)
+	}
+}
+
+func TestBackgroundJobKill(t *testing.T) {
+	model := New()
+	model.onboarding = false
+	model.executor = executor.New().WithTimeout(100 * time.Millisecond)
+
+	// Jobs outlive the timeout of the executor
+	cmd := model.handleDirectCommand("!sleep 0.3; echo done &")
+	model.handleJobStarted(cmd().(jobStartedMsg))
+	deadline := time.Now().Add(5 * time.Second)
+	for model.runningJobs() > 0 && time.Now().Before(deadline) {
+		model.handleJobTick()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if j := model.findJob(1); j.result == nil || j.result.Error != nil || j.result.ExitCode != 0 {
+		t.Fatalf("Expected the job to finish past the executor timeout, got %s", j.status())
+	}
+
+	// /kill stops a running job
+	cmd = model.handleDirectCommand("!sleep 30 &")
+	model.handleJobStarted(cmd().(jobStartedMsg))
+	model.handleCommand(ParseCommand("/kill 2"))
+	deadline = time.Now().Add(5 * time.Second)
+	for model.runningJobs() > 0 && time.Now().Before(deadline) {
+		model.handleJobTick()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if j := model.findJob(2); j.running() || !strings.HasPrefix(j.status(), "killed") {
+		t.Errorf("Expected the job to be killed, got %s", j.status())
+	}
+
+	model.handleCommand(ParseCommand("/kill 2"))
+	if last := model.messages[len(model.messages)-1].Content; !strings.Contains(last, "already finished") {
+		t.Errorf("Expected a finished job not to be killed again, got %q", last)
+	}
+}
+
+func TestMemoryToggle(t *testing.T) {
+	model := New()
+	model.memoryEnabled = true
+	model.memoryManager = &memory.Manager{}
+
+	model.handleCommand(ParseCommand("/memory off"))
+	if model.memoryActive() {
+		t.Fatal("Expected /memory off to disable memory")
+	}
+	if model.memoryManager == nil {
+		t.Error("Expected the memory manager to be kept")
+	}
+	if !strings.Contains(model.renderStatusBar(), "🔕") {
+		t.Error("Expected status bar to show that memory is off")
+	}
+
+	// Nothing is saved while memory is off
+	if cmd := model.handleMemorySave(memorySaveMsg{userRequest: "list files", selectedCommand: "ls"}); cmd != nil {
+		t.Error("Expected no memory save while memory is off")
+	}
+
+	model.handleCommand(ParseCommand("/memory on"))
+	if !model.memoryActive() {
+		t.Error("Expected /memory on to enable memory again")
+	}
+}
+
+func TestThinkCommand(t *testing.T) {
+	model := New()
+	raw := `{"commands": [{"cmd": "ls -la", "description": "List files"}]}`
+	suggestions := []aiSuggestion{{Command: "ls -la", Description: "List files", Safe: true, Confidence: 0.9}}
+
+	// The raw response is hidden by default
+	model.handleAIResponse(aiResponseMsg{suggestions: suggestions, raw: raw})
+	for _, msg := range model.messages {
+		if msg.Type == MessageTypeRaw {
+			t.Fatal("Expected no raw response without /think")
+		}
+	}
+
+	model.handleCommand(ParseCommand("/think"))
+	if !model.thinkMode || !strings.Contains(model.renderStatusBar(), "🧠") {
+		t.Fatal("Expected /think to enable think mode")
+	}
+
+	model.handleAIResponse(aiResponseMsg{suggestions: suggestions, raw: raw})
+	found := false
+	for _, msg := range model.messages {
+		if msg.Type == MessageTypeRaw && strings.Contains(msg.Content, raw) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected the raw response to be shown in think mode")
+	}
+
+	model.handleCommand(ParseCommand("/think off"))
+	if model.thinkMode {
+		t.Error("Expected /think off to disable think mode")
+	}
+}
+
+func TestTrustedCommand(t *testing.T) {
+	manager, err := memory.NewManagerWithConfig(memory.DefaultMemoryConfig(), t.TempDir()+"/memory.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create memory manager: %v", err)
+	}
+	t.Cleanup(manager.Flush)
+
+	model := New()
+	model.memoryEnabled = true
+	model.memoryManager = manager
+	model.confirmAll = false
+	flagged := commandExecutionMsg{command: "git push origin main", safe: false, programChecked: true}
+
+	for i := 0; i < memory.TrustThreshold; i++ {
+		model.handleCommandExecution(flagged)
+		if !model.inConfirmationMode {
+			t.Fatalf("Expected confirmation %d to be asked for", i+1)
+		}
+		model.handleConfirmationResponse(true)
+		model.executingCommand = false
+	}
+	if !manager.Trusted(flagged.command) {
+		t.Fatal("Expected the command to be trusted after enough confirmations")
+	}
+
+	model.handleCommandExecution(flagged)
+	if model.inConfirmationMode {
+		t.Error("Expected a trusted command to run without asking")
+	}
+	model.executingCommand = false
+
+	// Commands the safety rules match always ask
+	dangerous := commandExecutionMsg{command: "rm -rf /tmp/clia-trust-test", safe: false, programChecked: true}
+	for i := 0; i < memory.TrustThreshold; i++ {
+		model.handleCommandExecution(dangerous)
+		model.handleConfirmationResponse(false)
+	}
+	if manager.Trusted(dangerous.command) {
+		t.Error("Expected commands matching the safety rules never to be trusted")
+	}
+
+	model.handleCommand(&Command{Type: CommandTypeUntrust, Args: []string{"1"}})
+	if manager.Trusted(flagged.command) {
+		t.Error("Expected /untrust 1 to make the command ask again")
+	}
+	model.handleCommandExecution(flagged)
+	if !model.inConfirmationMode {
+		t.Error("Expected an untrusted command to ask again")
+	}
+}
+
+func TestMemoryAutocomplete(t *testing.T) {
+	manager, err := memory.NewManagerWithConfig(memory.DefaultMemoryConfig(), t.TempDir()+"/memory.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create memory manager: %v", err)
+	}
+	manager.Add("compress the logs folder", "tar -czf logs.tar.gz logs", "Archive logs", "ai", true)
+	manager.Add("compress the logs folder", "zip -r logs.zip logs", "Zip logs", "ai", true)
+	manager.Add("compress images", "mogrify -quality 80 *.jpg", "Compress JPEGs", "ai", true)
+	manager.Flush()
+
+	model := New()
+	model.memoryEnabled = true
+	model.memoryManager = manager
+	model.handleWindowSizeMsg(tea.WindowSizeMsg{Width: 80, Height: 24})
+
+	// Typing schedules a debounced search; only the latest timer is used
+	var updated tea.Model = model
+	for _, r := range "compress" {
+		updated, _ = updated.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	model = updated.(Model)
+	if model.input.Value() != "compress" {
+		t.Fatalf("Expected input to be typed, got %q", model.input.Value())
+	}
+	if cmd := model.handleAutocompleteTick(autocompleteTickMsg{seq: model.autocompleteSeq - 1, query: "compres"}); cmd != nil {
+		t.Error("Expected stale autocomplete timers to be ignored")
+	}
+
+	cmd := model.handleAutocompleteTick(autocompleteTickMsg{seq: model.autocompleteSeq, query: "compress"})
+	if cmd == nil {
+		t.Fatal("Expected the current timer to search memory")
+	}
+	model.handleAutocompleteResults(cmd().(autocompleteResultsMsg))
+
+	if len(model.autocomplete) != 2 {
+		t.Fatalf("Expected 2 distinct past requests, got %+v", model.autocomplete)
+	}
+	if !strings.Contains(model.View(), "💭") {
+		t.Error("Expected the dropdown to be rendered")
+	}
+
+	// Arrows choose, Tab accepts into the input without submitting
+	expected := model.autocomplete[1].UserRequest
+	updated, _ = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	updated, _ = updated.Update(tea.KeyMsg{Type: tea.KeyDown})
+	updated, _ = updated.Update(tea.KeyMsg{Type: tea.KeyTab})
+	model = updated.(Model)
+	if model.input.Value() != expected {
+		t.Errorf("Expected the second past request in the input, got %q", model.input.Value())
+	}
+	if len(model.autocomplete) != 0 {
+		t.Error("Expected the dropdown to close after accepting")
+	}
+	if len(model.messages) == 0 || model.messages[len(model.messages)-1].Type == MessageTypeUser {
+		t.Error("Expected Tab not to submit the request")
+	}
+
+	// Short input and slash commands are not completed
+	model.input.SetValue("/me")
+	if cmd := model.scheduleAutocomplete(); cmd != nil {
+		t.Error("Expected no autocomplete for slash commands")
+	}
+}
+
+func TestPinMsgCommand(t *testing.T) {
+	model := New()
+	model.handleWindowSizeMsg(tea.WindowSizeMsg{Width: 80, Height: 24})
+
+	model.handleCommand(&Command{Type: CommandTypePinMsg, Args: []string{"deploy", "after", "tests"}})
+	if model.pinnedMessage != "deploy after tests" {
+		t.Fatalf("Expected the note to be pinned, got %q", model.pinnedMessage)
+	}
+
+	view := model.View()
+	if !strings.Contains(view, "📌 deploy after tests") {
+		t.Error("Expected the pinned note above the messages")
+	}
+
+	// Without text the pin is cleared
+	model.handleCommand(&Command{Type: CommandTypePinMsg})
+	if model.pinnedMessage != "" {
+		t.Errorf("Expected the pin to be cleared, got %q", model.pinnedMessage)
+	}
+	unpinned := model.View()
+	if strings.Contains(unpinned, "📌 deploy") {
+		t.Error("Expected the pinned note to be removed from the view")
+	}
+	if lipgloss.Height(view) != lipgloss.Height(unpinned) {
+		t.Errorf("Expected the pinned note to take its line from the messages, got %d lines instead of %d",
+			lipgloss.Height(view), lipgloss.Height(unpinned))
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	model := New()
+	model.aiService.GetPromptBuilder().SetRequestTemplates([]prompt.RequestTemplate{
+		{Name: "deploy", Pattern: "deploy to {{env}}"},
+	})
+
+	// Without arguments the templates are listed
+	model.handleCommand(&Command{Type: CommandTypeRun})
+	if last := model.messages[len(model.messages)-1]; !strings.Contains(last.Content, "deploy to {{env}}") {
+		t.Errorf("Expected the templates to be listed, got %q", last.Content)
+	}
+
+	model.handleCommand(&Command{Type: CommandTypeRun, Args: []string{"deploy"}})
+	if last := model.messages[len(model.messages)-1]; last.Type != MessageTypeError || !strings.Contains(last.Content, "/run deploy env=<value>") {
+		t.Errorf("Expected a usage error for the missing variable, got %q", last.Content)
+	}
+
+	if cmd := model.handleCommand(&Command{Type: CommandTypeRun, Args: []string{"deploy", "env=prod"}}); cmd == nil {
+		t.Fatal("Expected the filled in template to be requested")
+	}
+	if model.lastUserRequest != "deploy to prod" {
+		t.Errorf("Expected the filled in request, got %q", model.lastUserRequest)
+	}
+	found := false
+	for _, msg := range model.messages {
+		if strings.Contains(msg.Content, "🧩 Using template deploy (env=prod)") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected a notice naming the template")
+	}
+}
+
+func TestFormatProviderProbes(t *testing.T) {
+	if !IsValidCommand(CommandTypeProviders) {
+		t.Error("Expected /providers to be a valid command")
+	}
+
+	formatted := FormatProviderProbes([]ai.ProviderProbe{
+		{Type: ai.ProviderTypeOllama, Configured: true, Reachable: true, Latency: 42 * time.Millisecond},
+		{Type: ai.ProviderTypeOpenAI, Current: true},
+		{Type: ai.ProviderTypeOpenRouter, Configured: true, Error: fmt.Errorf("invalid key")},
+	})
+
+	for _, expected := range []string{"reachable (42ms)", "openai*", "not configured", "error: invalid key"} {
+		if !strings.Contains(formatted, expected) {
+			t.Errorf("Expected %q in provider checks, got:\n%s", expected, formatted)
+		}
+	}
+
+	model := New()
+	if cmd := model.handleCommand(ParseCommand("/providers ping")); cmd != nil {
+		t.Error("Expected no command for an invalid subcommand")
+	}
+}
+
+func TestSummarizeOutput(t *testing.T) {
+	model := New()
+
+	if cmd := model.summarizeOutput(); cmd != nil {
+		t.Error("Expected no summary request without command output")
+	}
+
+	model.outputCommand = "make build"
+	for i := 0; i < summarizeHintLines; i++ {
+		model.retainOutput(fmt.Sprintf("warning %d", i), false)
+	}
+	model.retainOutput("permission denied", true)
+	if last := model.executionOutput[len(model.executionOutput)-1]; last != "[stderr] permission denied" {
+		t.Errorf("Expected stderr lines to be marked, got %q", last)
+	}
+
+	if !strings.Contains(model.renderHelp(), "Ctrl+S") {
+		t.Error("Expected help line to suggest a summary of verbose output")
+	}
+
+	if cmd := model.summarizeOutput(); cmd == nil {
+		t.Fatal("Expected a summary request for retained output")
+	}
+	if !model.processing {
+		t.Error("Expected processing state while summarizing")
+	}
+
+	model.handleOutputSummary(outputSummaryMsg{command: "make build", summary: "20 warnings, 1 permission error"})
+	if model.processing {
+		t.Error("Expected processing to stop after the summary")
+	}
+	if last := model.messages[len(model.messages)-1].Content; !strings.Contains(last, "20 warnings") {
+		t.Errorf("Expected summary message, got %q", last)
+	}
+
+	// Output beyond the limit keeps the most recent lines
+	for i := 0; i < maxRetainedOutputLines+10; i++ {
+		model.retainOutput("line", false)
+	}
+	if len(model.executionOutput) != maxRetainedOutputLines {
+		t.Errorf("Expected output capped at %d lines, got %d", maxRetainedOutputLines, len(model.executionOutput))
+	}
+}
+
+func TestQuietMode(t *testing.T) {
+	model := New()
+	model.onboarding = false
+	model.messages = nil
+	model.handleWindowSizeMsg(tea.WindowSizeMsg{Width: 100, Height: 200})
+
+	model.addMessage("💡 A helpful tip", MessageTypeSystem)
+	model.addMessage("list files", MessageTypeUser)
+	model.addMessage("❌ Something failed", MessageTypeError)
+
+	model.SetQuiet(true)
+	view := model.viewport.View()
+	if strings.Contains(view, "helpful tip") {
+		t.Error("Expected system messages to be hidden in quiet mode")
+	}
+	if !strings.Contains(view, "list files") || !strings.Contains(view, "Something failed") {
+		t.Error("Expected user and error messages to stay visible in quiet mode")
+	}
+	if !strings.Contains(model.renderStatusBar(), "quiet") {
+		t.Error("Expected quiet mode in the status bar")
+	}
+
+	// Answers to slash commands and pending questions stay visible
+	model.handleCommand(ParseCommand("/status"))
+	last := model.messages[len(model.messages)-1]
+	if model.hidden(last) {
+		t.Errorf("Expected the /status answer to stay visible, got %+v", last)
+	}
+	model.inConfirmationMode = true
+	model.addMessage("❓ Do you want to proceed?", MessageTypeSystem)
+	model.inConfirmationMode = false
+	if !strings.Contains(model.viewport.View(), "Do you want to proceed?") {
+		t.Error("Expected the confirmation question to stay visible")
+	}
+
+	// Turning quiet mode off shows the hidden messages again
+	model.handleCommand(ParseCommand("/quiet off"))
+	if model.quiet || !strings.Contains(model.viewport.View(), "helpful tip") {
+		t.Error("Expected /quiet off to show hidden messages")
+	}
+
+	model.handleCommand(ParseCommand("/quiet"))
+	if !model.quiet {
+		t.Error("Expected /quiet to toggle quiet mode on")
+	}
+}
+
+func TestAskCommand(t *testing.T) {
+	model := New()
+	model.onboarding = false
+
+	if cmd := model.handleCommand(ParseCommand("/ask")); cmd != nil {
+		t.Error("Expected no request without a question")
+	}
+
+	mockProvider := ai.NewMockProvider("test", "test-model")
+	mockProvider.SetMockResponse(&ai.CompletionResponse{Content: "-c creates an archive, -x extracts one"})
+	model.aiService.SetProvider(mockProvider)
+	model.aiService.SetOffline(false)
+
+	cmd := model.handleCommand(ParseCommand("/ask what's the difference between tar -c and -x"))
+	if cmd == nil || !model.processing {
+		t.Fatal("Expected the question to be sent")
+	}
+	if question := model.messages[len(model.messages)-2]; question.Type != MessageTypeUser ||
+		!strings.Contains(question.Content, "tar -c and -x") {
+		t.Errorf("Expected the question in the history, got %+v", question)
+	}
+
+	// Feed the streamed answer back like the program loop does
+	for {
+		msg := waitForAskEvent(model.askEvents)().(askEventMsg)
+		model.handleAskEvent(msg)
+		if msg.done {
+			break
+		}
+	}
+	if model.processing {
+		t.Error("Expected processing to stop after the answer")
+	}
+	answer := model.messages[len(model.messages)-1]
+	if answer.Type != MessageTypeAssistant || answer.Content != askAnswerPrefix+"-c creates an archive, -x extracts one" {
+		t.Errorf("Expected the streamed answer, got %+v", answer)
+	}
+	if len(model.combinedSuggestions) != 0 || model.inSelectionMode {
+		t.Error("Expected no suggestions for a question")
+	}
+
+	// A buffered answer is shown once complete
+	model.bufferAnswers = true
+	model.viewport.Width, model.viewport.Height = 80, 40
+	mockProvider.SetMockResponse(&ai.CompletionResponse{Content: "-t lists the contents"})
+	model.handleCommand(ParseCommand("/ask what does tar -t do"))
+	msg := waitForAskEvent(model.askEvents)().(askEventMsg)
+	if msg.done {
+		t.Fatal("Expected a chunk of the answer before the end")
+	}
+	model.handleAskEvent(msg)
+	if strings.Contains(model.viewport.View(), "lists the contents") {
+		t.Error("Expected the buffered answer to stay hidden while it streams in")
+	}
+	for !msg.done {
+		msg = waitForAskEvent(model.askEvents)().(askEventMsg)
+		model.handleAskEvent(msg)
+	}
+	if !strings.Contains(model.viewport.View(), "lists the contents") {
+		t.Error("Expected the buffered answer to be shown once complete")
+	}
+}
+
+func TestInteractiveFrame(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	model := New()
+	model.onboarding = false
+	model.viewport.Width = 24
+
+	frame := "\x1b[0;1;32m  PID USER      COMMAND\x1b[0m\n    1 root      init"
+	model.handlePTYExecutionComplete(ptyExecutionCompleteMsg{command: "htop", exitCode: 0, frame: frame})
+
+	last := model.messages[len(model.messages)-2]
+	if last.Type != MessageTypeFrame || last.Content != frame {
+		t.Fatalf("Expected the frame in the history, got %+v", last)
+	}
+
+	// Lines are clipped to the viewport without cutting escape sequences
+	rendered := renderFrame(frame, model.viewport.Width)
+	for _, line := range strings.Split(rendered, "\n") {
+		if width := lipgloss.Width(line); width > model.viewport.Width {
+			t.Errorf("Line %q is %d columns wide, expected at most %d", line, width, model.viewport.Width)
+		}
+	}
+	if !strings.Contains(rendered, "\x1b[0;1;32m  PID USER") || !strings.Contains(rendered, "…") {
+		t.Errorf("Expected the clipped line to keep its colors, got %q", rendered)
+	}
+	if !strings.Contains(model.viewport.View(), "PID USER") {
+		t.Error("Expected the frame in the viewport")
+	}
+
+	// Programs that drew nothing add no frame
+	count := len(model.messages)
+	model.handlePTYExecutionComplete(ptyExecutionCompleteMsg{command: "true", frame: "\x1b[0m \n"})
+	for _, msg := range model.messages[count:] {
+		if msg.Type == MessageTypeFrame {
+			t.Error("Expected no frame for an empty screen")
+		}
+	}
+}
+
+func TestCopyOnSelect(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	var copied string
+	nativeErr := errors.New("no clipboard tool")
+	writeNativeClipboard = func(text string) error {
+		copied = text
+		return nativeErr
+	}
+	defer func(caps termcaps.Caps) {
+		writeNativeClipboard, terminalCaps = clipboard.WriteAll, caps
+	}(terminalCaps)
+	terminalCaps.Clipboard = termcaps.ClipboardBoth
+
+	model := New()
+	var terminal bytes.Buffer
+	model.clipboardTerminal = &terminal
+	selectFirst := func() {
+		model.inSelectionMode = true
+		model.combinedSuggestions = []combinedSuggestion{{Command: "ls -la", Safe: true}}
+		model.handleCommandSelection(0)
+	}
+
+	// Off by default
+	selectFirst()
+	if copied != "" || terminal.Len() != 0 {
+		t.Fatal("Expected nothing copied without copy_on_select")
+	}
+
+	// The terminal copies it even without a clipboard tool, e.g. over SSH
+	model.copySelected = true
+	selectFirst()
+	if copied != "ls -la" {
+		t.Errorf("Expected the command copied natively, got %q", copied)
+	}
+	if terminal.String() != "\x1b]52;c;"+base64.StdEncoding.EncodeToString([]byte("ls -la"))+"\a" {
+		t.Errorf("Expected an OSC 52 sequence, got %q", terminal.String())
+	}
+	if last := model.messages[len(model.messages)-1]; !strings.Contains(last.Content, "Copied") {
+		t.Errorf("Expected a note that the command was copied, got %q", last.Content)
+	}
+
+	if err := CopyToClipboard("ls", nil); err != nativeErr {
+		t.Errorf("Expected the native error without a terminal, got %v", err)
+	}
+
+	// Over SSH only the terminal can reach the local clipboard
+	terminalCaps.Clipboard = termcaps.ClipboardOSC52
+	copied = ""
+	terminal.Reset()
+	if err := CopyToClipboard("pwd", &terminal); err != nil || copied != "" || terminal.Len() == 0 {
+		t.Errorf("Expected only an OSC 52 sequence, got %v, %q, %q", err, copied, terminal.String())
+	}
+
+	// A dumb terminal gets no escape sequences
+	terminalCaps.Clipboard = termcaps.ClipboardNative
+	terminal.Reset()
+	if err := CopyToClipboard("pwd", &terminal); err != nativeErr || copied != "pwd" || terminal.Len() != 0 {
+		t.Errorf("Expected only the native clipboard, got %v, %q, %q", err, copied, terminal.String())
+	}
+
+	// /copy-config copies the settings without secrets
+	nativeErr = nil
+	provider := model.configManager.GetConfig().API.Providers["openai"]
+	provider.Key = "sk-secret"
+	model.configManager.GetConfig().API.Providers["openai"] = provider
+	model.handleCommand(&Command{Type: CommandTypeCopyConfig})
+	if !strings.Contains(copied, "providers:") || strings.Contains(copied, "sk-secret") {
+		t.Errorf("Expected the settings without the key, got %q", copied)
+	}
+}
@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// undoAction is the command reversing an executed command
+type undoAction struct {
+	command string // Command that ran
+	inverse string // Command reversing it
+}
+
+// planUndo works out the inverse of command before it runs, when the files
+// it changes are still as they were. Any earlier undo goes stale.
+func (m *Model) planUndo(command string) {
+	m.lastUndo = nil
+	m.pendingUndo = nil
+	if inverse := m.executor.PlanUndo(command); inverse != "" {
+		m.pendingUndo = &undoAction{command: command, inverse: inverse}
+	}
+}
+
+// offerUndo makes the inverse of command available to /undo if it succeeded
+func (m *Model) offerUndo(command string, succeeded bool) {
+	undo := m.pendingUndo
+	m.pendingUndo = nil
+	if undo == nil || undo.command != command || !succeeded {
+		return
+	}
+	m.lastUndo = undo
+	m.addMessage("↩️  /undo reverses it with: "+undo.inverse, MessageTypeSystem)
+}
+
+// handleUndoCommand runs the inverse of the last command through the usual
+// safety checks
+func (m *Model) handleUndoCommand() tea.Cmd {
+	undo := m.lastUndo
+	if undo == nil {
+		m.addMessage("❌ Nothing to undo: only plain mv, cp, mkdir, touch, ln -s and git add can be reversed, right after they ran", MessageTypeError)
+		return nil
+	}
+	if m.executingCommand {
+		m.addMessage("⚠️  Wait for the running command to finish before undoing", MessageTypeError)
+		return nil
+	}
+
+	m.lastUndo = nil
+	return m.handleCommandExecution(commandExecutionMsg{
+		command:     undo.inverse,
+		description: fmt.Sprintf("Undo %s", undo.command),
+		safe:        true,
+		confidence:  1.0,
+		undo:        true,
+	})
+}
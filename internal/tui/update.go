@@ -20,14 +20,102 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.handleWindowSizeMsg(msg)
 
 	case tea.KeyMsg:
+		// Bracketed paste arrives as a single key message; insert it literally so
+		// pasted newlines or digits never submit input or select a command
+		if msg.Paste {
+			InsertPastedText(&m.input, string(msg.Runes))
+			return m, nil
+		}
+
+		// The quick switcher overlay takes all keys while open
+		if m.switcher != nil && msg.String() != "ctrl+c" {
+			*m.switcher, cmd = m.switcher.Update(msg)
+			return m, cmd
+		}
+
+		// A command whose program is not installed waits for a choice
+		if m.missingProgram != nil && m.input.Value() == "" {
+			if cmd, handled := m.handleMissingProgramKey(msg); handled {
+				return m, cmd
+			}
+		}
+
+		// Config changes that lose settings wait for a yes or no
+		if m.confirmConfigSave && m.input.Value() == "" {
+			if cmd, handled := m.handleConfigSaveKey(msg); handled {
+				return m, cmd
+			}
+		}
+
+		// Keys that act on the memory autocomplete dropdown
+		if len(m.autocomplete) > 0 && !m.inSelectionMode {
+			switch msg.String() {
+			case "tab":
+				m.acceptAutocomplete()
+				return m, nil
+			case "up":
+				m.moveAutocomplete(-1)
+				return m, nil
+			case "down":
+				m.moveAutocomplete(1)
+				return m, nil
+			case "esc", "escape":
+				m.autocompleteSeq++
+				m.clearAutocomplete()
+				return m, nil
+			case "enter":
+				if m.autocompleteIndex >= 0 {
+					m.acceptAutocomplete()
+				}
+			}
+		}
+
+		// Alt+1 to Alt+9 run a command of the favorites bar
+		if n, ok := favoriteKey(msg); ok && !m.awaitingAnswer() {
+			return m, m.runFavorite(n)
+		}
+
+		inputBefore := m.input.Value()
+
 		switch msg.String() {
 		case "ctrl+c":
+			m.killJobs()
 			return m, tea.Quit
 
 		case "ctrl+l":
 			m.clearMessages()
 			return m, nil
 
+		case "ctrl+p":
+			// Switch provider and model from the keyboard
+			if m.canOpenSwitcher() {
+				m.openSwitcher()
+			} else {
+				m.input, cmd = m.input.Update(msg)
+				if cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			}
+
+		case "ctrl+d":
+			// End standard input and run the command waiting for it
+			if m.inStdinMode {
+				if cmd := m.finishStdinInput(true); cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			} else {
+				m.input, cmd = m.input.Update(msg)
+				if cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			}
+
+		case "ctrl+s":
+			// Summarize the output of the last command
+			if cmd := m.summarizeOutput(); cmd != nil {
+				cmds = append(cmds, cmd)
+			}
+
 		case "enter":
 			if cmd := m.handleInputSubmit(); cmd != nil {
 				cmds = append(cmds, cmd)
@@ -49,43 +137,121 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 
+		case "up", "down", "k", "j":
+			// Move the highlight in selection mode; j and k only before typing
+			arrow := msg.String() == "up" || msg.String() == "down"
+			if m.inSelectionMode && (arrow || m.input.Value() == "") {
+				if msg.String() == "up" || msg.String() == "k" {
+					m.moveHighlight(-1)
+				} else {
+					m.moveHighlight(1)
+				}
+			} else {
+				m.input, cmd = m.input.Update(msg)
+				if cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			}
+
 		case "e":
 			// Handle edit command when in selection mode
 			if m.inSelectionMode {
-				// Enter edit mode with the first available suggestion
-				if len(m.availableSuggestions) > 0 {
-					m.enterEditMode(m.availableSuggestions[0])
+				// Enter edit mode with the highlighted suggestion
+				m.editHighlighted()
+			} else if m.inConfirmationMode && m.requiredConfirmation == "" {
+				// Edit the command awaiting confirmation before deciding
+				m.editPendingCommand()
+			} else {
+				// Not in selection mode, handle as regular input
+				m.input, cmd = m.input.Update(msg)
+				if cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			}
+
+		case "alt+i", "alt+s":
+			// Force how the selected command runs; a modifier, so typing a
+			// new request starting with i or s is not taken for it
+			if m.inSelectionMode {
+				if msg.String() == "alt+i" {
+					m.toggleRunMode(runModeInteractive)
 				} else {
-					m.addMessage("❌ No commands available to edit", MessageTypeError)
+					m.toggleRunMode(runModeStream)
+				}
+			}
+
+		case "+", "-":
+			// Adjust creativity while choosing a suggestion, before typing a new request
+			if m.inSelectionMode && m.input.Value() == "" {
+				delta := 1
+				if msg.String() == "-" {
+					delta = -1
 				}
+				m.setCreativity(m.aiService.GetCreativity().Step(delta))
 			} else {
-				// Not in selection mode, handle as regular input
 				m.input, cmd = m.input.Update(msg)
 				if cmd != nil {
 					cmds = append(cmds, cmd)
 				}
 			}
 
-		case "escape":
+		case "ctrl+o":
+			// Open the command in $EDITOR from edit or selection mode
+			if m.inEditMode || m.inSelectionMode {
+				if cmd := m.openEditor(); cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			} else {
+				m.input, cmd = m.input.Update(msg)
+				if cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			}
+
+		case "esc", "escape":
 			// Handle escape key
-			if m.inEditMode {
+			if m.inStdinMode {
+				// Cancel the command waiting for standard input
+				m.finishStdinInput(false)
+			} else if m.inPromptMode {
+				// Stop the command waiting at a prompt
+				m.cancelPrompt()
+			} else if m.inConfirmationMode {
+				// Cancel a pending confirmation
+				if cmd := m.handleConfirmationResponse(false); cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			} else if m.inEditMode {
 				// Exit edit mode without saving
 				if cmd := m.exitEditMode(false); cmd != nil {
 					cmds = append(cmds, cmd)
 				}
 			} else if m.inSelectionMode {
 				// Exit selection mode
-				m.inSelectionMode = false
-				m.availableSuggestions = []aiSuggestion{}
+				m.clearSuggestions()
 				m.addMessage("Selection mode cancelled", MessageTypeSystem)
+			} else if m.onboarding {
+				m.skipOnboarding()
 			} else {
 				// Clear input in normal mode
 				m.input.SetValue("")
 			}
 
+		case "?":
+			// Look up what the command awaiting confirmation does
+			if m.inConfirmationMode && m.input.Value() == "" {
+				cmds = append(cmds, m.lookupCommandHelp())
+			} else {
+				m.input, cmd = m.input.Update(msg)
+				if cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			}
+
 		case "y", "Y":
 			// Handle confirmation - confirm command execution
-			if m.inConfirmationMode {
+			// (critical commands need a typed phrase, so keys go to the input)
+			if m.inConfirmationMode && m.requiredConfirmation == "" {
 				if cmd := m.handleConfirmationResponse(true); cmd != nil {
 					cmds = append(cmds, cmd)
 				}
@@ -99,7 +265,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case "n", "N":
 			// Handle confirmation - cancel command execution
-			if m.inConfirmationMode {
+			if m.inConfirmationMode && m.requiredConfirmation == "" {
 				if cmd := m.handleConfirmationResponse(false); cmd != nil {
 					cmds = append(cmds, cmd)
 				}
@@ -119,23 +285,72 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+		// Search memory for past requests as the user types
+		if m.input.Value() != inputBefore {
+			if cmd := m.scheduleAutocomplete(); cmd != nil {
+				cmds = append(cmds, cmd)
+			}
+		}
+
+	case autocompleteTickMsg:
+		if cmd := m.handleAutocompleteTick(msg); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+
+	case autocompleteResultsMsg:
+		m.handleAutocompleteResults(msg)
+
+	case commandHelpMsg:
+		m.handleCommandHelp(msg)
+
+	case deletionPreviewMsg:
+		m.handleDeletionPreview(msg)
+
 	case clearHistoryMsg:
 		m.clearMessages()
 
 	case addMessageMsg:
+		m.replying = msg.Reply
 		m.addMessage(msg.Content, msg.Type)
+		m.replying = false
 
 	case aiProcessingMsg:
 		// Just update UI, processing state already set
 
 	case aiResponseMsg:
 		m.handleAIResponse(msg)
+		if cmd := m.freeTierTip(); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+		if cmd := m.budgetTip(msg.error); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+
+	case freeTierTipMsg:
+		m.handleFreeTierTip(msg)
+
+	case budgetTipMsg:
+		m.handleBudgetTip(msg)
 
 	case commandMsg:
 		// Command messages are handled in handleInputSubmit
 
 	case providerSwitchMsg:
 		m.handleProviderSwitchMsg(msg)
+		if cmd := m.continueSwitcher(msg); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+
+	case switcherChoiceMsg:
+		if cmd := m.handleSwitcherChoice(msg); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+
+	case switcherCloseMsg:
+		m.switcher = nil
+
+	case switcherModelsMsg:
+		m.handleSwitcherModels(msg)
 
 	case modelListMsg:
 		m.handleModelListMsg(msg)
@@ -144,11 +359,26 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.handleModelSwitchMsg(msg)
 
 	case apiKeyInputMsg:
+		// The key is typed into the input, so the overlay must go
+		m.switcher = nil
 		m.handleAPIKeyInputMsg(msg)
 
 	case apiKeySubmitMsg:
 		return m.handleAPIKeySubmitMsg(msg)
 
+	case outputSummaryMsg:
+		m.handleOutputSummary(msg)
+
+	case askEventMsg:
+		if cmd := m.handleAskEvent(msg); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+
+	case EditorFinishedMsg:
+		if cmd := m.handleEditorFinished(msg); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+
 	case commandSelectionMsg:
 		if cmd := m.handleCommandSelection(msg.index); cmd != nil {
 			cmds = append(cmds, cmd)
@@ -182,6 +412,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			cmds = append(cmds, cmd)
 		}
 
+	case jobStartedMsg:
+		if cmd := m.handleJobStarted(msg); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+
+	case jobTickMsg:
+		if cmd := m.handleJobTick(); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+
 	case streamTickMsg:
 		if cmd := m.handleStreamTick(); cmd != nil {
 			cmds = append(cmds, cmd)
@@ -240,8 +480,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.thinkingDots = "..."
 			}
 			// Update the last message if it's a thinking message
-			if len(m.messages) > 0 && strings.Contains(m.messages[len(m.messages)-1].Content, "思考中") {
-				m.messages[len(m.messages)-1].Content = fmt.Sprintf("🤖 思考中%s", m.thinkingDots)
+			if len(m.messages) > 0 && strings.HasPrefix(m.messages[len(m.messages)-1].Content, m.thinkingMessage("")) {
+				m.messages[len(m.messages)-1].Content = m.thinkingMessage(m.thinkingDots)
 				m.updateViewportContent()
 			}
 		}
@@ -272,6 +512,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 // handleProviderSwitchMsg handles provider switch results
 func (m *Model) handleProviderSwitchMsg(msg providerSwitchMsg) {
+	defer m.startReply()()
+
 	if msg.needsAPIKey {
 		m.addMessage(fmt.Sprintf("🔑 %s provider needs API key configuration", msg.providerType), MessageTypeSystem)
 		return
@@ -286,17 +528,34 @@ func (m *Model) handleProviderSwitchMsg(msg providerSwitchMsg) {
 		}
 		m.status = fmt.Sprintf("Ready - %s • %s", m.currentProvider, m.currentModel)
 		m.addMessage(fmt.Sprintf("✅ Switched to %s provider", msg.providerType), MessageTypeSystem)
+
+		if m.onboarding {
+			m.finishOnboarding(msg.providerType, msg.apiKey)
+		}
 	} else {
 		errorMsg := "Failed to switch provider"
 		if msg.error != nil {
 			errorMsg += ": " + msg.error.Error()
 		}
 		m.addMessage("❌ "+errorMsg, MessageTypeError)
+
+		if m.onboarding {
+			m.addMessage("💡 Choose a provider again, or press Esc to skip setup", MessageTypeSystem)
+		}
 	}
 }
 
 // handleModelListMsg handles model list results
 func (m *Model) handleModelListMsg(msg modelListMsg) {
+	defer m.startReply()()
+
+	// Aliases are listed even if fetching the model list fails
+	defer func() {
+		if aliases := m.aiService.GetModelAliases(); len(aliases) > 0 {
+			m.addMessage(FormatModelAliases(aliases, m.currentModel), MessageTypeSystem)
+		}
+	}()
+
 	if msg.error != nil {
 		m.addMessage("❌ Failed to fetch models: "+msg.error.Error(), MessageTypeError)
 		return
@@ -317,10 +576,17 @@ func (m *Model) handleModelListMsg(msg modelListMsg) {
 
 // handleModelSwitchMsg handles model switch results
 func (m *Model) handleModelSwitchMsg(msg modelSwitchMsg) {
+	defer m.startReply()()
+
 	if msg.success {
 		m.currentModel = msg.modelName
 		m.status = fmt.Sprintf("Ready - %s • %s", m.currentProvider, m.currentModel)
-		m.addMessage(fmt.Sprintf("✅ Switched to model: %s", msg.modelName), MessageTypeSystem)
+		if msg.alias != "" {
+			m.addMessage(fmt.Sprintf("✅ Switched to model: %s (alias: %s)", msg.modelName, msg.alias), MessageTypeSystem)
+		} else {
+			m.addMessage(fmt.Sprintf("✅ Switched to model: %s", msg.modelName), MessageTypeSystem)
+		}
+		m.describeModel(msg.modelName)
 	} else {
 		errorMsg := "Failed to switch model"
 		if msg.error != nil {
@@ -330,6 +596,23 @@ func (m *Model) handleModelSwitchMsg(msg modelSwitchMsg) {
 	}
 }
 
+// describeModel shows the context length and price of model, as known from
+// listing the models of the provider or from the common models; nothing is
+// fetched for it
+func (m *Model) describeModel(model string) {
+	price, priced := m.aiService.ModelPrice(model)
+	contextWindow := m.aiService.ContextWindow(model)
+	details := FormatModelDetails(contextWindow, price, priced)
+	if m.aiService.GetCurrentProviderType() == ai.ProviderTypeOllama {
+		details += " (runs locally)"
+	}
+	m.addMessage(details, MessageTypeSystem)
+
+	if contextWindow == 0 || !priced {
+		m.addMessage("💡 /model lists the models of the provider, which fills in what it reports about them", MessageTypeSystem)
+	}
+}
+
 // handleAPIKeyInputMsg handles API key input requests
 func (m *Model) handleAPIKeyInputMsg(msg apiKeyInputMsg) {
 	m.addMessage(msg.prompt, MessageTypeSystem)
@@ -362,6 +645,7 @@ func (m *Model) handleAPIKeySubmitMsg(msg apiKeySubmitMsg) (tea.Model, tea.Cmd)
 		err = m.aiService.SwitchProvider(providerType, config)
 		return providerSwitchMsg{
 			providerType: msg.providerType,
+			apiKey:       msg.apiKey,
 			success:      err == nil,
 			error:        err,
 		}
@@ -3,8 +3,11 @@ package tui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
+
+	"github.com/yourusername/clia/internal/ai"
 )
 
 // View renders the TUI interface
@@ -16,6 +19,28 @@ func (m Model) View() string {
 	// Render status bar
 	statusBar := m.renderStatusBar()
 
+	// The pinned note, favorites bar and memory autocomplete take their room
+	// from the content area
+	pinned := m.renderPinnedMessage()
+	favorites := m.renderFavoritesBar()
+	dropdown := m.renderAutocomplete()
+	if switcher := m.renderSwitcher(); switcher != "" {
+		dropdown = switcher
+	}
+	reserved := 0
+	for _, section := range []string{pinned, favorites, dropdown} {
+		if section != "" {
+			reserved += lipgloss.Height(section)
+		}
+	}
+	if reserved > 0 {
+		atBottom := m.viewport.AtBottom()
+		m.viewport.Height = max(1, m.viewport.Height-reserved)
+		if atBottom {
+			m.viewport.GotoBottom()
+		}
+	}
+
 	// Render content area
 	content := m.renderContent()
 
@@ -26,13 +51,20 @@ func (m Model) View() string {
 	help := m.renderHelp()
 
 	// Combine all sections
-	return lipgloss.JoinVertical(
-		lipgloss.Left,
-		statusBar,
-		content,
-		inputArea,
-		help,
-	)
+	sections := []string{statusBar}
+	if pinned != "" {
+		sections = append(sections, pinned)
+	}
+	sections = append(sections, content)
+	if favorites != "" {
+		sections = append(sections, favorites)
+	}
+	sections = append(sections, inputArea)
+	if dropdown != "" {
+		sections = append(sections, dropdown)
+	}
+	sections = append(sections, help)
+	return lipgloss.JoinVertical(lipgloss.Left, sections...)
 }
 
 // renderStatusBar renders the top status bar
@@ -42,7 +74,31 @@ func (m Model) renderStatusBar() string {
 	if m.showSpinner {
 		statusText = fmt.Sprintf("%s %s", m.spinner.View(), statusText)
 	}
-	leftStatus := statusStyle.Render(fmt.Sprintf("clia • %s", statusText))
+	if m.streamActive {
+		statusText += " • ⏱ " + formatElapsed(m.streamElapsed)
+	}
+	if running := m.runningJobs(); running > 0 {
+		statusText += fmt.Sprintf(" • 🧵 %d job(s)", running)
+	}
+	if m.aiService != nil && m.aiService.IsOffline() {
+		statusText += " • 📴 offline"
+	}
+	if m.memoryPaused {
+		statusText += " • 🔕 memory off"
+	}
+	if m.thinkMode {
+		statusText += " • 🧠 think"
+	}
+	if m.quiet {
+		statusText += " • 🤫 quiet"
+	}
+	if m.confirmAll {
+		statusText += " • 🛡️ paranoid"
+	}
+	if m.aiService != nil && m.aiService.GetCreativity() != ai.CreativityDefault {
+		statusText += " • 🎨 " + string(m.aiService.GetCreativity())
+	}
+	leftStatus := statusStyle.Render(terminalCaps.Text(fmt.Sprintf("clia • %s", statusText)))
 
 	// Right side: message count and dimensions
 	rightStatus := encodingStyle.Render(fmt.Sprintf("Messages: %d | %dx%d",
@@ -56,6 +112,14 @@ func (m Model) renderStatusBar() string {
 	return statusBarStyle.Render(leftStatus + spacer + rightStatus)
 }
 
+// renderPinnedMessage renders the note pinned with /pinmsg above the messages
+func (m Model) renderPinnedMessage() string {
+	if m.pinnedMessage == "" {
+		return ""
+	}
+	return pinnedMessageStyle.Width(m.width).Render("📌 " + m.pinnedMessage)
+}
+
 // renderContent renders the main content area with message history
 func (m Model) renderContent() string {
 	content := contentStyle.Render(m.viewport.View())
@@ -102,11 +166,26 @@ func (m Model) renderInputArea() string {
 // renderHelp renders the help text at the bottom
 func (m Model) renderHelp() string {
 	helpText := "Press Ctrl+C to quit • Ctrl+L to clear history • Enter to submit • !<command> for direct execution"
+	if m.inStdinMode {
+		helpText = "Enter to add a line • Ctrl+D to end input and run • Esc to cancel"
+	} else if m.inPromptMode {
+		helpText = "Enter to send your answer • Esc to stop the command"
+	} else if m.canSummarize() {
+		helpText += " • Ctrl+S to summarize output"
+	}
 	return helpStyle.
 		Width(m.width).
 		Render(helpText)
 }
 
+// formatElapsed formats the running time of a command, e.g. 12.4s or 3m05s
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
+
 // max returns the maximum of two integers
 func max(a, b int) int {
 	if a > b {
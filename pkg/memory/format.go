@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// OutputFormat represents a format for listing or exporting memory entries
+type OutputFormat string
+
+const (
+	FormatTable OutputFormat = "table" // Aligned columns for humans
+	FormatPlain OutputFormat = "plain" // One "request -> command" line per entry
+	FormatJSON  OutputFormat = "json"  // JSON array for tooling
+)
+
+// ParseOutputFormat parses a format name, defaulting to table when empty
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch OutputFormat(strings.ToLower(strings.TrimSpace(name))) {
+	case "", FormatTable:
+		return FormatTable, nil
+	case FormatPlain:
+		return FormatPlain, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown format %q (expected table, plain or json)", name)
+	}
+}
+
+// ExtractFormatFlag removes a --format <name> (or --format=<name>, -f <name>)
+// flag from args and returns the remaining arguments and the parsed format
+func ExtractFormatFlag(args []string) ([]string, OutputFormat, error) {
+	var remaining []string
+	name := ""
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--format" || arg == "-f":
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("%s requires a value (table, plain or json)", arg)
+			}
+			name = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--format="):
+			name = strings.TrimPrefix(arg, "--format=")
+		default:
+			remaining = append(remaining, arg)
+		}
+	}
+
+	format, err := ParseOutputFormat(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return remaining, format, nil
+}
+
+// FormatEntries renders memory entries in the given format
+func FormatEntries(entries []MemoryEntry, format OutputFormat) (string, error) {
+	switch format {
+	case FormatTable, "":
+		return formatTable(entries), nil
+	case FormatPlain:
+		return formatPlain(entries), nil
+	case FormatJSON:
+		if entries == nil {
+			entries = []MemoryEntry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal memory entries: %w", err)
+		}
+		return string(data) + "\n", nil
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// formatTable renders entries as aligned columns
+func formatTable(entries []MemoryEntry) string {
+	var buf bytes.Buffer
+	writer := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(writer, "#\tID\tREQUEST\tCOMMAND\tUSED\tLAST USED\tSTATUS")
+	for i, entry := range entries {
+		status := "ok"
+		if !entry.Success {
+			status = "failed"
+		}
+		if entry.Pinned {
+			status += ", pinned"
+		}
+
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%dx\t%s\t%s\n",
+			i+1,
+			entry.ShortID(),
+			truncate(entry.UserRequest, 40),
+			truncate(entry.SelectedCommand, 50),
+			entry.UsageCount,
+			entry.Timestamp.Format("2006-01-02 15:04"),
+			status)
+	}
+
+	writer.Flush()
+	return buf.String()
+}
+
+// formatPlain renders entries as "request -> command" lines
+func formatPlain(entries []MemoryEntry) string {
+	var builder strings.Builder
+	for _, entry := range entries {
+		builder.WriteString(entry.String())
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// truncate shortens a string to limit runes, replacing the tail with an ellipsis
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// ExportFormatted writes all memory entries to a file in the given format
+func (m *Manager) ExportFormatted(filePath string, format OutputFormat) error {
+	content, err := FormatEntries(m.GetAll(), format)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	return nil
+}
@@ -22,6 +22,33 @@ type Manager struct {
 	mutex      sync.RWMutex
 	storage    *Storage
 	search     *Search
+
+	// Changes are saved once memory has been idle for SaveDelay (debounced)
+	saves      sync.WaitGroup // Pending debounced save
+	saveTimer  *time.Timer
+	dirty      bool      // Changes not yet saved
+	dirtySince time.Time // Time of the oldest unsaved change
+
+	// Results of recent searches, dropped whenever memory changes
+	searchMutex sync.Mutex
+	searchCache map[searchKey]cachedSearch
+}
+
+const (
+	searchCacheSize = 64          // Recent searches kept
+	searchCacheTTL  = time.Minute // Scores depend on the age of entries, so results go stale
+)
+
+// searchKey identifies a search by its normalized query and options
+type searchKey struct {
+	query   string
+	options SearchOptions
+}
+
+// cachedSearch holds the results of a recent search
+type cachedSearch struct {
+	results []SearchResult
+	at      time.Time
 }
 
 // NewManager creates a new memory manager
@@ -85,6 +112,7 @@ func (m *Manager) Load() error {
 	}
 
 	m.memory = memory
+	m.invalidateSearches()
 	return nil
 }
 
@@ -93,18 +121,172 @@ func (m *Manager) Save() error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	return m.save()
+}
+
+// Flush saves pending changes right away and waits for the save to complete.
+// Call it before the program exits.
+func (m *Manager) Flush() {
+	m.savePending()
+	m.saves.Wait()
+}
+
+// save writes memory to file, settling any pending debounced save (requires lock)
+func (m *Manager) save() error {
+	if m.dirty {
+		m.dirty = false
+		m.saveTimer.Stop()
+		m.saveTimer = nil
+		defer m.saves.Done()
+	}
+
 	m.memory.Metadata.LastUpdated = time.Now()
 	m.memory.Metadata.TotalEntries = len(m.memory.Entries)
 
 	return m.storage.Save(m.memory)
 }
 
-// Search searches for relevant memory entries
+// scheduleSave marks memory as changed and (re)starts the save timer, so a
+// burst of changes results in a single write. The save is never postponed by
+// more than MaxSaveDelay after the first unsaved change (requires lock).
+func (m *Manager) scheduleSave() {
+	m.invalidateSearches()
+
+	now := time.Now()
+	if !m.dirty {
+		m.dirty = true
+		m.dirtySince = now
+		m.saves.Add(1)
+	}
+
+	delay := m.config.SaveDelay
+	if m.config.MaxSaveDelay > 0 {
+		if remaining := m.dirtySince.Add(m.config.MaxSaveDelay).Sub(now); remaining < delay {
+			delay = remaining
+		}
+	}
+
+	// A timer that already fired finds nothing left to do after it acquires the lock
+	if m.saveTimer != nil {
+		m.saveTimer.Stop()
+	}
+	m.saveTimer = time.AfterFunc(delay, m.savePending)
+}
+
+// savePending saves memory if it has unsaved changes
+func (m *Manager) savePending() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.dirty {
+		return
+	}
+	if err := m.save(); err != nil {
+		log.Printf("Warning: Failed to save memory: %v", err)
+	}
+}
+
+// SetSaveDelay sets how long memory waits for further changes before saving,
+// and the longest a change may stay unsaved. A zero delay saves right away.
+func (m *Manager) SetSaveDelay(delay, maxDelay time.Duration) *Manager {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.config.SaveDelay = delay
+	m.config.MaxSaveDelay = maxDelay
+	return m
+}
+
+// SetTTL sets how long an entry may go without a successful run before it
+// expires; 0 keeps entries however long ago they last worked
+func (m *Manager) SetTTL(ttl time.Duration) *Manager {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.config.TTL = ttl
+	return m
+}
+
+// Expire removes the entries past their TTL and returns how many it removed.
+// Cleanup removes them too, along with old and rarely used entries.
+func (m *Manager) Expire() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	kept := m.memory.Entries[:0]
+	for _, entry := range m.memory.Entries {
+		if !entry.Expired(m.config.TTL, now) {
+			kept = append(kept, entry)
+		}
+	}
+
+	removed := len(m.memory.Entries) - len(kept)
+	if removed > 0 {
+		log.Printf("Memory expiry: removed %d entries not verified within %s", removed, m.config.TTL)
+		m.memory.Entries = kept
+		m.scheduleSave()
+	}
+	return removed
+}
+
+// Search searches for relevant memory entries. Trivial queries are not
+// searched for, and repeated searches are answered from a cache until memory
+// changes.
 func (m *Manager) Search(query string, options SearchOptions) ([]SearchResult, error) {
+	if IsTrivialQuery(query) {
+		return []SearchResult{}, nil
+	}
+
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	return m.search.Search(query, m.memory.Entries, options)
+	if len(m.memory.Entries) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	key := searchKey{query: m.normalizeRequest(query), options: options}
+	if results, ok := m.cachedSearch(key); ok {
+		return results, nil
+	}
+
+	results, err := m.search.Search(query, m.memory.Entries, options)
+	if err != nil {
+		return nil, err
+	}
+	m.cacheSearch(key, results)
+	return append([]SearchResult(nil), results...), nil
+}
+
+// cachedSearch returns a copy of the cached results of a recent search
+func (m *Manager) cachedSearch(key searchKey) ([]SearchResult, bool) {
+	m.searchMutex.Lock()
+	defer m.searchMutex.Unlock()
+
+	cached, ok := m.searchCache[key]
+	if !ok || time.Since(cached.at) > searchCacheTTL {
+		return nil, false
+	}
+	return append([]SearchResult{}, cached.results...), true
+}
+
+// cacheSearch remembers the results of a search; a full cache starts over
+func (m *Manager) cacheSearch(key searchKey, results []SearchResult) {
+	m.searchMutex.Lock()
+	defer m.searchMutex.Unlock()
+
+	if m.searchCache == nil || len(m.searchCache) >= searchCacheSize {
+		m.searchCache = make(map[searchKey]cachedSearch)
+	}
+	m.searchCache[key] = cachedSearch{results: results, at: time.Now()}
+}
+
+// invalidateSearches drops the cached search results after memory changed
+func (m *Manager) invalidateSearches() {
+	m.searchMutex.Lock()
+	defer m.searchMutex.Unlock()
+
+	m.searchCache = nil
 }
 
 // Add adds a new memory entry
@@ -112,16 +294,25 @@ func (m *Manager) Add(userRequest, selectedCommand, description, source string,
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	// Escape sequences from pasted or captured text would corrupt the YAML file
+	userRequest = utils.StripANSI(userRequest)
+	selectedCommand = utils.StripANSI(selectedCommand)
+	description = utils.StripANSI(description)
+
 	// Normalize the request
 	normalizedRequest := m.normalizeRequest(userRequest)
 
 	// Check if similar entry already exists
+	now := time.Now()
 	existingEntry := m.findSimilarEntry(normalizedRequest, selectedCommand)
 	if existingEntry != nil {
 		// Update existing entry
 		existingEntry.UsageCount++
-		existingEntry.Timestamp = time.Now()
+		existingEntry.Timestamp = now
 		existingEntry.Success = success
+		if success {
+			existingEntry.LastVerified = now
+		}
 		if description != "" {
 			existingEntry.Description = description
 		}
@@ -134,10 +325,13 @@ func (m *Manager) Add(userRequest, selectedCommand, description, source string,
 			SelectedCommand:   selectedCommand,
 			Description:       description,
 			Success:           success,
-			Timestamp:         time.Now(),
+			Timestamp:         now,
 			UsageCount:        1,
 			Source:            source,
 		}
+		if success {
+			entry.LastVerified = now
+		}
 
 		if !entry.IsValid() {
 			return fmt.Errorf("invalid memory entry: %+v", entry)
@@ -151,81 +345,145 @@ func (m *Manager) Add(userRequest, selectedCommand, description, source string,
 		m.cleanup()
 	}
 
-	// Auto-save
-	go func() {
-		if err := m.Save(); err != nil {
-			log.Printf("Warning: Failed to save memory: %v", err)
-		}
-	}()
-
+	m.scheduleSave()
 	return nil
 }
 
-// Remove removes a memory entry by ID
+// Remove removes a memory entry by ID or unique ID prefix
 func (m *Manager) Remove(id string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	for i, entry := range m.memory.Entries {
-		if entry.ID == id {
-			// Remove entry
-			m.memory.Entries = append(m.memory.Entries[:i], m.memory.Entries[i+1:]...)
+	index, err := m.findEntryIndex(id)
+	if err != nil {
+		return err
+	}
 
-			// Auto-save
-			go func() {
-				if err := m.Save(); err != nil {
-					log.Printf("Warning: Failed to save memory after removal: %v", err)
-				}
-			}()
+	// Remove entry
+	m.memory.Entries = append(m.memory.Entries[:index], m.memory.Entries[index+1:]...)
+
+	m.scheduleSave()
+	return nil
+}
+
+// Update updates an existing memory entry by ID or unique ID prefix
+func (m *Manager) Update(id string, updates map[string]interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	index, err := m.findEntryIndex(id)
+	if err != nil {
+		return err
+	}
+	entry := &m.memory.Entries[index]
+
+	// Apply updates
+	if val, ok := updates["user_request"].(string); ok {
+		entry.UserRequest = utils.StripANSI(val)
+		entry.NormalizedRequest = m.normalizeRequest(entry.UserRequest)
+	}
+	if val, ok := updates["selected_command"].(string); ok {
+		entry.SelectedCommand = utils.StripANSI(val)
+	}
+	if val, ok := updates["description"].(string); ok {
+		entry.Description = utils.StripANSI(val)
+	}
+	if val, ok := updates["success"].(bool); ok {
+		entry.Success = val
+	}
+	if val, ok := updates["source"].(string); ok {
+		entry.Source = val
+	}
+
+	// Update timestamp
+	entry.Timestamp = time.Now()
+
+	m.scheduleSave()
+	return nil
+}
+
+// SetPinned pins or unpins a memory entry by ID or unique ID prefix. Pinned
+// entries never expire and are kept by Cleanup.
+func (m *Manager) SetPinned(id string, pinned bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	index, err := m.findEntryIndex(id)
+	if err != nil {
+		return err
+	}
+	m.memory.Entries[index].Pinned = pinned
 
-			return nil
+	m.scheduleSave()
+	return nil
+}
+
+// RecordPresented counts that the entries with the given IDs were offered as suggestions
+func (m *Manager) RecordPresented(ids ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	presented := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		presented[id] = true
+	}
+
+	changed := false
+	for i := range m.memory.Entries {
+		if presented[m.memory.Entries[i].ID] {
+			m.memory.Entries[i].PresentedCount++
+			changed = true
 		}
 	}
 
-	return fmt.Errorf("memory entry with ID %s not found", id)
+	if changed {
+		m.scheduleSave()
+	}
 }
 
-// Update updates an existing memory entry
-func (m *Manager) Update(id string, updates map[string]interface{}) error {
+// RecordAccepted counts that the entry with the given ID was chosen from the suggestions
+func (m *Manager) RecordAccepted(id string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	for i, entry := range m.memory.Entries {
-		if entry.ID == id {
-			// Apply updates
-			if val, ok := updates["user_request"].(string); ok {
-				entry.UserRequest = val
-				entry.NormalizedRequest = m.normalizeRequest(val)
-			}
-			if val, ok := updates["selected_command"].(string); ok {
-				entry.SelectedCommand = val
-			}
-			if val, ok := updates["description"].(string); ok {
-				entry.Description = val
-			}
-			if val, ok := updates["success"].(bool); ok {
-				entry.Success = val
-			}
-			if val, ok := updates["source"].(string); ok {
-				entry.Source = val
-			}
+	index, err := m.findEntryIndex(id)
+	if err != nil {
+		return err
+	}
+	entry := &m.memory.Entries[index]
 
-			// Update timestamp
-			entry.Timestamp = time.Now()
-			m.memory.Entries[i] = entry
+	entry.AcceptanceCount++
+	if entry.PresentedCount < entry.AcceptanceCount {
+		entry.PresentedCount = entry.AcceptanceCount
+	}
 
-			// Auto-save
-			go func() {
-				if err := m.Save(); err != nil {
-					log.Printf("Warning: Failed to save memory after update: %v", err)
-				}
-			}()
+	m.scheduleSave()
+	return nil
+}
 
-			return nil
+// minIDPrefixLength is the shortest ID prefix accepted in place of a full ID
+const minIDPrefixLength = 4
+
+// findEntryIndex returns the index of the entry with the given ID, or with
+// the given ID prefix if exactly one entry has it (requires lock)
+func (m *Manager) findEntryIndex(id string) (int, error) {
+	match := -1
+	for i, entry := range m.memory.Entries {
+		if entry.ID == id {
+			return i, nil
+		}
+		if len(id) >= minIDPrefixLength && strings.HasPrefix(entry.ID, id) {
+			if match >= 0 {
+				return -1, fmt.Errorf("memory entry ID %s is ambiguous", id)
+			}
+			match = i
 		}
 	}
 
-	return fmt.Errorf("memory entry with ID %s not found", id)
+	if match < 0 {
+		return -1, fmt.Errorf("memory entry with ID %s not found", id)
+	}
+	return match, nil
 }
 
 // GetAll returns all memory entries
@@ -268,7 +526,7 @@ func (m *Manager) GetStats() map[string]interface{} {
 	}
 }
 
-// Cleanup removes old and low-usage entries
+// Cleanup removes old, low-usage and expired entries. Pinned entries are kept.
 func (m *Manager) Cleanup() error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -276,7 +534,7 @@ func (m *Manager) Cleanup() error {
 	m.cleanup()
 
 	// Save after cleanup
-	return m.storage.Save(m.memory)
+	return m.save()
 }
 
 // cleanup performs internal cleanup (requires lock)
@@ -286,15 +544,24 @@ func (m *Manager) cleanup() {
 	now := time.Now()
 	for _, entry := range m.memory.Entries {
 		// Keep entry if it meets retention criteria
-		if entry.UsageCount >= m.config.MinUsageCount &&
-			now.Sub(entry.Timestamp) <= m.config.MaxAge {
+		if entry.Pinned || (entry.UsageCount >= m.config.MinUsageCount &&
+			now.Sub(entry.Timestamp) <= m.config.MaxAge &&
+			!entry.Expired(m.config.TTL, now)) {
 			keepEntries = append(keepEntries, entry)
 		}
 	}
 
-	// Sort by relevance score and keep top entries
-	sort.Slice(keepEntries, func(i, j int) bool {
-		return keepEntries[i].RelevanceScore() > keepEntries[j].RelevanceScore()
+	// Sort pinned entries first, then by relevance score, and keep top entries;
+	// ties keep a deterministic order
+	sort.SliceStable(keepEntries, func(i, j int) bool {
+		if keepEntries[i].Pinned != keepEntries[j].Pinned {
+			return keepEntries[i].Pinned
+		}
+		scoreI, scoreJ := keepEntries[i].RelevanceScore(), keepEntries[j].RelevanceScore()
+		if scoreI != scoreJ {
+			return scoreI > scoreJ
+		}
+		return keepEntries[i].ID < keepEntries[j].ID
 	})
 
 	// Limit to max entries
@@ -304,6 +571,7 @@ func (m *Manager) cleanup() {
 
 	log.Printf("Memory cleanup: %d -> %d entries", len(m.memory.Entries), len(keepEntries))
 	m.memory.Entries = keepEntries
+	m.invalidateSearches()
 }
 
 // Export exports memory to a file
@@ -347,12 +615,16 @@ func (m *Manager) Import(filePath string, merge bool) error {
 		m.memory = importedMemory
 	}
 
+	// Imported entries may reuse IDs of existing ones
+	AssignIDs(m.memory.Entries)
+	m.invalidateSearches()
+
 	// Cleanup if necessary
 	if len(m.memory.Entries) > m.config.MaxEntries {
 		m.cleanup()
 	}
 
-	return m.storage.Save(m.memory)
+	return m.save()
 }
 
 // normalizeRequest normalizes a user request for better matching
@@ -1,8 +1,11 @@
 package memory
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -155,6 +158,7 @@ func TestManager(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
+	t.Cleanup(manager.Flush) // Finish background saves before the temp dir is removed
 
 	// Test adding entries
 	err = manager.Add("list files", "ls -la", "List files", "test", true)
@@ -357,6 +361,7 @@ func TestManagerCleanup(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create manager: %v", err)
 	}
+	t.Cleanup(manager.Flush) // Finish background saves before the temp dir is removed
 
 	// Add entries with different usage counts
 	entries := []struct {
@@ -401,6 +406,82 @@ func TestManagerCleanup(t *testing.T) {
 	}
 }
 
+// TestMemoryExpiry tests that entries not verified within the TTL expire
+func TestMemoryExpiry(t *testing.T) {
+	ttl := 30 * 24 * time.Hour
+	now := time.Now()
+
+	// The boundary itself is still fresh
+	entry := MemoryEntry{Timestamp: now, LastVerified: now.Add(-ttl)}
+	if entry.Expired(ttl, now) {
+		t.Error("Entry verified exactly one TTL ago should not expire yet")
+	}
+	entry.LastVerified = now.Add(-ttl - time.Second)
+	if !entry.Expired(ttl, now) {
+		t.Error("Entry verified longer than the TTL ago should expire")
+	}
+	if entry.Expired(0, now) {
+		t.Error("A TTL of 0 should keep entries")
+	}
+	entry.Pinned = true
+	if entry.Expired(ttl, now) {
+		t.Error("Pinned entries should not expire")
+	}
+
+	// Recent use does not count, only successful runs; old entries count from their last use
+	failing := MemoryEntry{Timestamp: now, LastVerified: now.Add(-2 * ttl)}
+	legacy := MemoryEntry{Timestamp: now.Add(-2 * ttl)}
+	if !failing.Expired(ttl, now) || !legacy.Expired(ttl, now) {
+		t.Error("Expected entries without a recent successful run to expire")
+	}
+
+	manager, err := NewManagerWithConfig(DefaultMemoryConfig(), filepath.Join(t.TempDir(), "memory.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	t.Cleanup(manager.Flush)
+	manager.SetTTL(ttl)
+
+	for _, request := range []string{"stale", "pinned", "fresh", "broken"} {
+		if err := manager.Add(request+" request", request+" command", "", "test", true); err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+	}
+	if err := manager.Add("broken request", "broken command", "", "test", false); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+	for i := range manager.memory.Entries {
+		entry := &manager.memory.Entries[i]
+		if entry.LastVerified.IsZero() {
+			t.Fatalf("Expected a successful run to set last_verified for %q", entry.UserRequest)
+		}
+		if entry.UserRequest != "fresh request" {
+			entry.LastVerified = now.Add(-ttl - time.Hour)
+		}
+	}
+	if err := manager.SetPinned("pinned", true); err == nil {
+		t.Fatal("Expected an unknown ID to be rejected")
+	}
+	for _, entry := range manager.GetAll() {
+		if entry.UserRequest == "pinned request" {
+			if err := manager.SetPinned(entry.ID, true); err != nil {
+				t.Fatalf("SetPinned failed: %v", err)
+			}
+		}
+	}
+
+	if removed := manager.Expire(); removed != 2 {
+		t.Errorf("Expected the stale and broken entries to expire, removed %d", removed)
+	}
+	var kept []string
+	for _, entry := range manager.GetAll() {
+		kept = append(kept, entry.UserRequest)
+	}
+	if strings.Join(kept, ",") != "pinned request,fresh request" {
+		t.Errorf("Expected the pinned and fresh entries kept, got %v", kept)
+	}
+}
+
 // TestStorageBackup tests backup functionality
 func TestStorageBackup(t *testing.T) {
 	tempDir := t.TempDir()
@@ -468,11 +549,11 @@ func BenchmarkSearch(b *testing.B) {
 	entries := make([]MemoryEntry, 1000)
 	for i := 0; i < 1000; i++ {
 		entries[i] = MemoryEntry{
-			ID:                string(rune(i)),
-			UserRequest:       "test request " + string(rune(i)),
-			NormalizedRequest: "test request " + string(rune(i)),
-			SelectedCommand:   "test command " + string(rune(i)),
-			Description:       "Test description " + string(rune(i)),
+			ID:                fmt.Sprintf("bench-%d", i),
+			UserRequest:       fmt.Sprintf("test request %d", i),
+			NormalizedRequest: fmt.Sprintf("test request %d", i),
+			SelectedCommand:   fmt.Sprintf("test command %d", i),
+			Description:       fmt.Sprintf("Test description %d", i),
 			Success:           true,
 			Timestamp:         time.Now(),
 			UsageCount:        i % 10,
@@ -489,3 +570,416 @@ func BenchmarkSearch(b *testing.B) {
 		}
 	}
 }
+
+// TestFormatEntries tests the list/export formatters
+func TestFormatEntries(t *testing.T) {
+	entries := []MemoryEntry{
+		{UserRequest: "list files", SelectedCommand: "ls -la", UsageCount: 3, Success: true, Timestamp: time.Now()},
+		{UserRequest: "disk usage", SelectedCommand: "df -h", UsageCount: 1, Success: false, Timestamp: time.Now()},
+	}
+
+	table, err := FormatEntries(entries, FormatTable)
+	if err != nil {
+		t.Fatalf("Failed to format table: %v", err)
+	}
+	if !strings.Contains(table, "REQUEST") || !strings.Contains(table, "ls -la") || !strings.Contains(table, "failed") {
+		t.Errorf("Unexpected table output:\n%s", table)
+	}
+
+	plain, err := FormatEntries(entries, FormatPlain)
+	if err != nil {
+		t.Fatalf("Failed to format plain: %v", err)
+	}
+	if plain != "list files -> ls -la\ndisk usage -> df -h\n" {
+		t.Errorf("Unexpected plain output: %q", plain)
+	}
+
+	jsonOutput, err := FormatEntries(entries, FormatJSON)
+	if err != nil {
+		t.Fatalf("Failed to format JSON: %v", err)
+	}
+	var decoded []MemoryEntry
+	if err := json.Unmarshal([]byte(jsonOutput), &decoded); err != nil {
+		t.Fatalf("JSON output is not valid: %v", err)
+	}
+	if len(decoded) != 2 || decoded[1].SelectedCommand != "df -h" {
+		t.Errorf("Unexpected decoded entries: %+v", decoded)
+	}
+
+	if _, err := ParseOutputFormat("xml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+	if format, _ := ParseOutputFormat(""); format != FormatTable {
+		t.Errorf("Expected default format table, got %s", format)
+	}
+}
+
+func TestManagerStripsANSI(t *testing.T) {
+	manager, err := NewManagerWithConfig(DefaultMemoryConfig(), filepath.Join(t.TempDir(), "memory.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	t.Cleanup(manager.Flush)
+
+	err = manager.Add("\x1b[1mshow disk\x1b[0m", "\x1b[32mdf -h\x1b[0m\x1b]0;title\x07", "Disk \x1b[4musage", "test", true)
+	if err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	entry := manager.GetAll()[0]
+	if entry.UserRequest != "show disk" || entry.SelectedCommand != "df -h" || entry.Description != "Disk usage" {
+		t.Errorf("Expected escape sequences to be stripped, got %q %q %q", entry.UserRequest, entry.SelectedCommand, entry.Description)
+	}
+
+	if err := manager.Update(entry.ID, map[string]interface{}{"selected_command": "df -h \x1b[K"}); err != nil {
+		t.Fatalf("Failed to update entry: %v", err)
+	}
+	if got := manager.GetAll()[0].SelectedCommand; got != "df -h " {
+		t.Errorf("Expected updated command without escape sequences, got %q", got)
+	}
+
+	keywords := NewSearch().extractKeywords("\x1b[31mdisk\x1b[0m space")
+	if strings.Join(keywords, " ") != "disk space" {
+		t.Errorf("Expected keywords without color codes, got %v", keywords)
+	}
+}
+
+func TestStableEntryIDs(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "memory.yaml")
+	config := DefaultMemoryConfig()
+	config.MaxEntries = 500
+
+	manager, err := NewManagerWithConfig(config, tempFile)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	t.Cleanup(manager.Flush)
+
+	for i := 0; i < 200; i++ {
+		if err := manager.Add(fmt.Sprintf("request %d", i), fmt.Sprintf("echo %d", i), "", "test", true); err != nil {
+			t.Fatalf("Failed to add entry %d: %v", i, err)
+		}
+	}
+	manager.Flush()
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	ids := make(map[string]string)
+	for _, entry := range manager.GetAll() {
+		if entry.ID == "" || ids[entry.ID] != "" {
+			t.Fatalf("Expected unique non-empty IDs, got %q twice", entry.ID)
+		}
+		ids[entry.ID] = entry.SelectedCommand
+	}
+
+	reloaded, err := NewManagerWithConfig(config, tempFile)
+	if err != nil {
+		t.Fatalf("Failed to reload manager: %v", err)
+	}
+	t.Cleanup(reloaded.Flush)
+
+	entries := reloaded.GetAll()
+	if len(entries) != 200 {
+		t.Fatalf("Expected 200 entries after reload, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if ids[entry.ID] != entry.SelectedCommand {
+			t.Errorf("Entry %q changed ID across save/load", entry.SelectedCommand)
+		}
+	}
+
+	// Updates and removals by ID prefix work after reload
+	target := entries[10]
+	if err := reloaded.Update(target.ShortID(), map[string]interface{}{"description": "updated"}); err != nil {
+		t.Fatalf("Failed to update by short ID: %v", err)
+	}
+	if err := reloaded.Remove(target.ID); err != nil {
+		t.Fatalf("Failed to remove by ID: %v", err)
+	}
+	if err := reloaded.Remove(target.ID); err == nil {
+		t.Error("Expected error removing an already removed entry")
+	}
+}
+
+func TestAssignIDs(t *testing.T) {
+	timestamp := time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC)
+	entries := []MemoryEntry{
+		{ID: "dup", UserRequest: "a", SelectedCommand: "ls", Timestamp: timestamp},
+		{ID: "dup", UserRequest: "b", SelectedCommand: "pwd", Timestamp: timestamp},
+		{UserRequest: "c", SelectedCommand: "df", Timestamp: timestamp},
+		{UserRequest: "c", SelectedCommand: "df", Timestamp: timestamp},
+	}
+
+	if changed := AssignIDs(entries); changed != 3 {
+		t.Errorf("Expected 3 IDs to be assigned, got %d", changed)
+	}
+	if entries[0].ID != "dup" {
+		t.Error("Expected the first entry to keep its ID")
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.ID] {
+			t.Errorf("Duplicate ID %q after AssignIDs", entry.ID)
+		}
+		seen[entry.ID] = true
+	}
+
+	// Derived IDs are the same every time
+	again := []MemoryEntry{{UserRequest: "c", SelectedCommand: "df", Timestamp: timestamp}}
+	AssignIDs(again)
+	if again[0].ID != entries[2].ID {
+		t.Errorf("Expected stable derived ID, got %q and %q", again[0].ID, entries[2].ID)
+	}
+
+	// Ties in timestamp are ordered by ID
+	SortByRecent(entries)
+	for i := 1; i < len(entries); i++ {
+		if entries[i-1].ID > entries[i].ID {
+			t.Errorf("Expected entries with equal timestamps ordered by ID, got %q before %q", entries[i-1].ID, entries[i].ID)
+		}
+	}
+}
+
+func TestDebouncedSave(t *testing.T) {
+	memoryFile := filepath.Join(t.TempDir(), "memory.yaml")
+	manager, err := NewManagerWithConfig(DefaultMemoryConfig(), memoryFile)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	manager.SetSaveDelay(time.Hour, 0)
+	t.Cleanup(manager.Flush)
+
+	// A burst of changes is kept in memory until the save delay passes
+	for i := 0; i < 5; i++ {
+		if err := manager.Add(fmt.Sprintf("request %d", i), fmt.Sprintf("echo %d", i), "", "test", true); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if _, err := os.Stat(memoryFile); !os.IsNotExist(err) {
+		t.Fatal("Expected no write before the save delay passes")
+	}
+
+	// Flush saves right away, e.g. on quit
+	manager.Flush()
+	loaded, err := NewStorage(memoryFile).Load()
+	if err != nil {
+		t.Fatalf("Expected the memory file after Flush: %v", err)
+	}
+	if len(loaded.Entries) != 5 {
+		t.Errorf("Expected 5 saved entries, got %d", len(loaded.Entries))
+	}
+
+	// Steady activity is saved at the latest after the maximum delay
+	manager.SetSaveDelay(time.Hour, 50*time.Millisecond)
+	if err := manager.Add("request 5", "echo 5", "", "test", true); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		loaded, err = NewStorage(memoryFile).Load()
+		if err == nil && len(loaded.Entries) == 6 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the maximum save delay to force a save")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAcceptanceRanking(t *testing.T) {
+	manager, err := NewManagerWithConfig(DefaultMemoryConfig(), filepath.Join(t.TempDir(), "memory.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	manager.SetSaveDelay(time.Hour, 0)
+	t.Cleanup(manager.Flush)
+
+	if err := manager.Add("show disk usage of filesystems", "df -h", "", "ai", true); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := manager.Add("show disk usage of this folder", "du -sh .", "", "ai", true); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	entries := manager.GetAll()
+	ids := map[string]string{}
+	for _, entry := range entries {
+		ids[entry.SelectedCommand] = entry.ID
+	}
+
+	// du is offered alongside df every time but always chosen over it
+	for i := 0; i < 5; i++ {
+		manager.RecordPresented(ids["df -h"], ids["du -sh ."])
+		if err := manager.RecordAccepted(ids["du -sh ."]); err != nil {
+			t.Fatalf("RecordAccepted failed: %v", err)
+		}
+	}
+	if err := manager.RecordAccepted("missing"); err == nil {
+		t.Error("Expected an error accepting an unknown entry")
+	}
+
+	results, err := manager.Search("show disk usage", DefaultSearchOptions())
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) < 2 || results[0].Entry.SelectedCommand != "du -sh ." {
+		t.Fatalf("Expected the chosen entry first, got %+v", results)
+	}
+	if results[0].Score <= results[1].Score || results[0].Score > 1.0 {
+		t.Errorf("Unexpected scores %.3f and %.3f", results[0].Score, results[1].Score)
+	}
+
+	for _, entry := range manager.GetAll() {
+		if entry.PresentedCount != 5 {
+			t.Errorf("Expected %q presented 5 times, got %d", entry.SelectedCommand, entry.PresentedCount)
+		}
+	}
+
+	neutral := MemoryEntry{}
+	if neutral.AcceptanceFactor() != 1.0 {
+		t.Errorf("Expected a neutral factor for new entries, got %.3f", neutral.AcceptanceFactor())
+	}
+	always := MemoryEntry{PresentedCount: 1000, AcceptanceCount: 2000}
+	if factor := always.AcceptanceFactor(); factor > 1.2 || factor < 1.19 {
+		t.Errorf("Expected the factor capped near 1.2, got %.3f", factor)
+	}
+}
+
+func TestIsTrivialQuery(t *testing.T) {
+	tests := map[string]bool{
+		"":               true,
+		" l ":            true,
+		"the":            true,
+		"to the and":     true,
+		"ls":             false,
+		"list the files": false,
+	}
+	for query, expected := range tests {
+		if got := IsTrivialQuery(query); got != expected {
+			t.Errorf("IsTrivialQuery(%q) = %v, expected %v", query, got, expected)
+		}
+	}
+}
+
+func TestSearchCache(t *testing.T) {
+	manager, err := NewManagerWithConfig(DefaultMemoryConfig(), filepath.Join(t.TempDir(), "memory.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	manager.SetSaveDelay(time.Hour, 0)
+	t.Cleanup(manager.Flush)
+
+	if err := manager.Add("list files", "ls -la", "List files", "ai", true); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if results, _ := manager.Search("the", DefaultSearchOptions()); len(results) != 0 {
+		t.Errorf("Expected no results for a stop word, got %+v", results)
+	}
+
+	results, err := manager.Search("list files", DefaultSearchOptions())
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %+v (%v)", results, err)
+	}
+	if _, ok := manager.cachedSearch(searchKey{query: "list files", options: DefaultSearchOptions()}); !ok {
+		t.Fatal("Expected the search to be cached")
+	}
+
+	// Callers may modify the results without touching the cache
+	results[0].Score = -1
+	again, _ := manager.Search("  List   FILES ", DefaultSearchOptions())
+	if len(again) != 1 || again[0].Score < 0 {
+		t.Errorf("Expected the cached results unchanged, got %+v", again)
+	}
+
+	// Changes to memory drop the cache, and the entry index follows edits
+	if err := manager.Update(results[0].Entry.ID, map[string]interface{}{"user_request": "show processes"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, ok := manager.cachedSearch(searchKey{query: "list files", options: DefaultSearchOptions()}); ok {
+		t.Error("Expected an update to drop the cached searches")
+	}
+	results, _ = manager.Search("show processes", DefaultSearchOptions())
+	if len(results) != 1 || results[0].MatchType != MatchTypeExact {
+		t.Errorf("Expected the edited request to match exactly, got %+v", results)
+	}
+}
+
+// BenchmarkManagerSearch benchmarks searches repeated while memory is unchanged
+func BenchmarkManagerSearch(b *testing.B) {
+	manager, err := NewManagerWithConfig(DefaultMemoryConfig(), filepath.Join(b.TempDir(), "memory.yaml"))
+	if err != nil {
+		b.Fatalf("Failed to create manager: %v", err)
+	}
+	manager.SetSaveDelay(time.Hour, 0)
+	for i := 0; i < 1000; i++ {
+		manager.memory.Entries = append(manager.memory.Entries, MemoryEntry{
+			ID:                fmt.Sprintf("bench-%d", i),
+			UserRequest:       fmt.Sprintf("test request %d", i),
+			NormalizedRequest: fmt.Sprintf("test request %d", i),
+			SelectedCommand:   fmt.Sprintf("test command %d", i),
+			Success:           true,
+			Timestamp:         time.Now(),
+			UsageCount:        i % 10,
+		})
+	}
+
+	options := DefaultSearchOptions()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := manager.Search("test request", options); err != nil {
+			b.Fatalf("Search failed: %v", err)
+		}
+	}
+}
+
+func TestTrust(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.yaml")
+	manager, err := NewManagerWithConfig(DefaultMemoryConfig(), path)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	for i := 1; i < TrustThreshold; i++ {
+		if manager.RecordOverride("curl  -s example.com") {
+			t.Fatalf("Expected %d confirmations not to trust the command", i)
+		}
+	}
+	manager.RecordRefusal("curl -s example.com")
+	for i := 1; i < TrustThreshold; i++ {
+		manager.RecordOverride("curl -s example.com")
+	}
+	if manager.Trusted("curl -s example.com") {
+		t.Fatal("Expected a refusal to start counting again")
+	}
+	if !manager.RecordOverride("curl -s example.com") || !manager.Trusted("curl   -s example.com") {
+		t.Fatal("Expected the command to be trusted after enough confirmations in a row")
+	}
+	if manager.Trusted("curl -s example.org") {
+		t.Error("Expected only the exact command to be trusted")
+	}
+
+	manager.RecordRefusal("curl -s example.com")
+	if !manager.Trusted("curl -s example.com") {
+		t.Error("Expected declining a trusted command to keep it trusted")
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := NewManagerWithConfig(DefaultMemoryConfig(), path)
+	if err != nil {
+		t.Fatalf("Failed to load manager: %v", err)
+	}
+	if commands := loaded.TrustedCommands(); len(commands) != 1 || commands[0] != "curl -s example.com" {
+		t.Fatalf("Expected the trusted command to be saved, got %v", commands)
+	}
+	if err := loaded.Untrust("curl -s example.com"); err != nil {
+		t.Fatalf("Untrust failed: %v", err)
+	}
+	if loaded.Trusted("curl -s example.com") || loaded.Untrust("curl -s example.com") == nil {
+		t.Error("Expected the command to ask again once untrusted")
+	}
+}
@@ -3,41 +3,115 @@ package memory
 import (
 	"sort"
 	"strings"
+	"sync"
 	"unicode"
+
+	"github.com/yourusername/clia/pkg/utils"
 )
 
+// minQueryLength is the length of the shortest query worth searching for
+const minQueryLength = 2
+
+// stopWords are left out of keywords
+var stopWords = map[string]bool{
+	"the": true, "a": true, "an": true, "and": true, "or": true, "but": true,
+	"in": true, "on": true, "at": true, "to": true, "for": true, "of": true,
+	"with": true, "by": true, "is": true, "are": true, "was": true, "were": true,
+	"be": true, "been": true, "have": true, "has": true, "had": true, "do": true,
+	"does": true, "did": true, "will": true, "would": true, "could": true, "should": true,
+	"i": true, "you": true, "he": true, "she": true, "it": true, "we": true, "they": true,
+}
+
+// commonCommands are the programs recognized as command patterns
+var commonCommands = map[string]bool{
+	"ls": true, "cd": true, "pwd": true, "cat": true, "grep": true, "find": true,
+	"cp": true, "mv": true, "rm": true, "mkdir": true, "rmdir": true, "chmod": true,
+	"tar": true, "zip": true, "unzip": true, "gzip": true, "gunzip": true,
+	"wget": true, "curl": true, "ssh": true, "scp": true, "rsync": true,
+	"git": true, "npm": true, "pip": true, "apt": true, "yum": true, "brew": true,
+	"docker": true, "kubectl": true, "vim": true, "nano": true, "emacs": true,
+}
+
+// actionSynonyms map action words to words and programs with the same meaning
+var actionSynonyms = map[string][]string{
+	"list":     {"ls", "dir", "show", "display", "find"},
+	"find":     {"search", "locate", "grep", "look"},
+	"copy":     {"cp", "duplicate", "backup"},
+	"move":     {"mv", "rename", "relocate"},
+	"delete":   {"rm", "remove", "erase"},
+	"extract":  {"unzip", "tar", "decompress"},
+	"compress": {"zip", "tar", "gzip"},
+	"edit":     {"vim", "nano", "modify"},
+	"install":  {"apt", "yum", "brew", "pip"},
+	"download": {"wget", "curl", "fetch"},
+}
+
+// entryIndex holds what searches derive from the text of an entry, so it is
+// computed once per entry rather than once per entry per search
+type entryIndex struct {
+	request, command, description string // The text the index was built from
+
+	keywords []string // Keywords of the request and description
+	commands []string // Command patterns of the selected command
+	words    []string // Words of the request and selected command
+}
+
+// matches reports whether the index was built from the current text of entry
+func (i *entryIndex) matches(entry *MemoryEntry) bool {
+	return i.request == entry.NormalizedRequest &&
+		i.command == entry.SelectedCommand &&
+		i.description == entry.Description
+}
+
 // Search handles searching through memory entries
 type Search struct {
-	// Cache for expensive operations
-	keywordCache map[string][]string
+	mutex sync.Mutex             // Guards index; searches may run concurrently
+	index map[string]*entryIndex // By entry ID
 }
 
 // NewSearch creates a new search instance
 func NewSearch() *Search {
 	return &Search{
-		keywordCache: make(map[string][]string),
+		index: make(map[string]*entryIndex),
+	}
+}
+
+// IsTrivialQuery reports whether query is too short or made of stop words
+// only, so searching memory for it cannot find anything useful
+func IsTrivialQuery(query string) bool {
+	words := strings.Fields(strings.ToLower(query))
+	if len(strings.Join(words, " ")) < minQueryLength {
+		return true
+	}
+	for _, word := range words {
+		if !stopWords[word] {
+			return false
+		}
 	}
+	return true
 }
 
 // Search searches for relevant memory entries based on a query
 func (s *Search) Search(query string, entries []MemoryEntry, options SearchOptions) ([]SearchResult, error) {
-	if query == "" {
+	if IsTrivialQuery(query) {
 		return []SearchResult{}, nil
 	}
 
 	normalizedQuery := s.normalizeQuery(query)
 	queryKeywords := s.extractKeywords(normalizedQuery)
+	queryWords := strings.Fields(normalizedQuery)
+	indexes := s.indexEntries(entries)
 
 	var results []SearchResult
 
-	for _, entry := range entries {
+	for i, entry := range entries {
 		// Skip failed entries if not including failures
 		if !options.IncludeFailures && !entry.Success {
 			continue
 		}
 
 		// Calculate relevance score
-		score, matchType, reason := s.calculateRelevance(normalizedQuery, queryKeywords, entry)
+		score, matchType, reason := s.calculateRelevance(normalizedQuery, queryKeywords, queryWords, entry, indexes[i])
 
 		// Filter by minimum score
 		if score >= options.MinScore {
@@ -61,8 +135,51 @@ func (s *Search) Search(query string, entries []MemoryEntry, options SearchOptio
 	return results, nil
 }
 
+// indexEntries returns the index of each of entries, building the indexes of
+// new and changed entries and dropping those of entries no longer searched
+func (s *Search) indexEntries(entries []MemoryEntry) []*entryIndex {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	indexes := make([]*entryIndex, len(entries))
+	for i := range entries {
+		entry := &entries[i]
+		index, ok := s.index[entry.ID]
+		if !ok || !index.matches(entry) {
+			index = s.buildIndex(entry)
+			s.index[entry.ID] = index
+		}
+		indexes[i] = index
+	}
+
+	// Removed entries leave stale indexes behind; rebuild the map now and then
+	if len(s.index) > 2*len(entries)+16 {
+		s.index = make(map[string]*entryIndex, len(entries))
+		for i, index := range indexes {
+			s.index[entries[i].ID] = index
+		}
+	}
+	return indexes
+}
+
+// buildIndex derives the search index of entry
+func (s *Search) buildIndex(entry *MemoryEntry) *entryIndex {
+	index := &entryIndex{
+		request:     entry.NormalizedRequest,
+		command:     entry.SelectedCommand,
+		description: entry.Description,
+		keywords:    s.extractKeywords(entry.NormalizedRequest),
+		commands:    s.extractCommandPatterns(entry.SelectedCommand),
+		words:       strings.Fields(entry.NormalizedRequest + " " + entry.SelectedCommand),
+	}
+	if entry.Description != "" {
+		index.keywords = append(index.keywords, s.extractKeywords(strings.ToLower(entry.Description))...)
+	}
+	return index
+}
+
 // calculateRelevance calculates the relevance score for a memory entry
-func (s *Search) calculateRelevance(query string, queryKeywords []string, entry MemoryEntry) (float64, MatchType, string) {
+func (s *Search) calculateRelevance(query string, queryKeywords, queryWords []string, entry MemoryEntry, index *entryIndex) (float64, MatchType, string) {
 	var maxScore float64
 	var bestMatchType MatchType
 	var bestReason string
@@ -82,29 +199,32 @@ func (s *Search) calculateRelevance(query string, queryKeywords []string, entry
 	}
 
 	// 3. Keyword matching
-	if keywordScore, reason := s.checkKeywordMatch(queryKeywords, entry); keywordScore > maxScore {
+	if keywordScore, reason := s.checkKeywordMatch(queryKeywords, index); keywordScore > maxScore {
 		maxScore = keywordScore
 		bestMatchType = MatchTypeKeyword
 		bestReason = reason
 	}
 
 	// 4. Command pattern matching
-	if commandScore, reason := s.checkCommandMatch(query, entry); commandScore > maxScore {
+	if commandScore, reason := s.checkCommandMatch(query, index); commandScore > maxScore {
 		maxScore = commandScore
 		bestMatchType = MatchTypeCommand
 		bestReason = reason
 	}
 
 	// 5. Semantic similarity (simple)
-	if semanticScore, reason := s.checkSemanticMatch(query, entry); semanticScore > maxScore {
+	if semanticScore, reason := s.checkSemanticMatch(queryWords, index); semanticScore > maxScore {
 		maxScore = semanticScore
 		bestMatchType = MatchTypeSemantic
 		bestReason = reason
 	}
 
-	// Apply entry relevance boost
+	// Apply entry relevance boost, and rank entries by how often they were chosen
 	entryRelevance := entry.RelevanceScore()
-	finalScore := maxScore * (0.7 + entryRelevance*0.3)
+	finalScore := maxScore * (0.7 + entryRelevance*0.3) * entry.AcceptanceFactor()
+	if finalScore > 1.0 {
+		finalScore = 1.0
+	}
 
 	return finalScore, bestMatchType, bestReason
 }
@@ -149,15 +269,12 @@ func (s *Search) checkFuzzyMatch(query string, entry MemoryEntry) (float64, stri
 }
 
 // checkKeywordMatch checks for keyword-based matching
-func (s *Search) checkKeywordMatch(queryKeywords []string, entry MemoryEntry) (float64, string) {
+func (s *Search) checkKeywordMatch(queryKeywords []string, index *entryIndex) (float64, string) {
 	if len(queryKeywords) == 0 {
 		return 0.0, ""
 	}
 
-	entryKeywords := s.extractKeywords(entry.NormalizedRequest)
-	if entry.Description != "" {
-		entryKeywords = append(entryKeywords, s.extractKeywords(strings.ToLower(entry.Description))...)
-	}
+	entryKeywords := index.keywords
 
 	// Count matching keywords
 	matchCount := 0
@@ -185,10 +302,10 @@ func (s *Search) checkKeywordMatch(queryKeywords []string, entry MemoryEntry) (f
 }
 
 // checkCommandMatch checks for command pattern similarity
-func (s *Search) checkCommandMatch(query string, entry MemoryEntry) (float64, string) {
+func (s *Search) checkCommandMatch(query string, index *entryIndex) (float64, string) {
 	// Extract command-like patterns from query
 	queryCommands := s.extractCommandPatterns(query)
-	entryCommands := s.extractCommandPatterns(entry.SelectedCommand)
+	entryCommands := index.commands
 
 	if len(queryCommands) == 0 || len(entryCommands) == 0 {
 		return 0.0, ""
@@ -219,25 +336,11 @@ func (s *Search) checkCommandMatch(query string, entry MemoryEntry) (float64, st
 }
 
 // checkSemanticMatch checks for semantic similarity (simple implementation)
-func (s *Search) checkSemanticMatch(query string, entry MemoryEntry) (float64, string) {
+func (s *Search) checkSemanticMatch(queryWords []string, index *entryIndex) (float64, string) {
 	// Simple semantic matching based on action words
-	actionMap := map[string][]string{
-		"list":     {"ls", "dir", "show", "display", "find"},
-		"find":     {"search", "locate", "grep", "look"},
-		"copy":     {"cp", "duplicate", "backup"},
-		"move":     {"mv", "rename", "relocate"},
-		"delete":   {"rm", "remove", "erase"},
-		"extract":  {"unzip", "tar", "decompress"},
-		"compress": {"zip", "tar", "gzip"},
-		"edit":     {"vim", "nano", "modify"},
-		"install":  {"apt", "yum", "brew", "pip"},
-		"download": {"wget", "curl", "fetch"},
-	}
-
-	queryWords := strings.Fields(query)
-	entryWords := strings.Fields(entry.NormalizedRequest + " " + entry.SelectedCommand)
-
-	for action, synonyms := range actionMap {
+	entryWords := index.words
+
+	for action, synonyms := range actionSynonyms {
 		queryHasAction := false
 		entryHasAction := false
 
@@ -315,25 +418,13 @@ func (s *Search) normalizeQuery(query string) string {
 
 // extractKeywords extracts keywords from a string
 func (s *Search) extractKeywords(text string) []string {
-	// Check cache first
-	if keywords, exists := s.keywordCache[text]; exists {
-		return keywords
-	}
-
-	// Split into words and filter
-	words := strings.FieldsFunc(text, func(r rune) bool {
+	// Split into words and filter, ignoring escape sequences so color codes
+	// like "[31m" don't become keywords
+	words := strings.FieldsFunc(utils.StripANSI(text), func(r rune) bool {
 		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
 	})
 
 	var keywords []string
-	stopWords := map[string]bool{
-		"the": true, "a": true, "an": true, "and": true, "or": true, "but": true,
-		"in": true, "on": true, "at": true, "to": true, "for": true, "of": true,
-		"with": true, "by": true, "is": true, "are": true, "was": true, "were": true,
-		"be": true, "been": true, "have": true, "has": true, "had": true, "do": true,
-		"does": true, "did": true, "will": true, "would": true, "could": true, "should": true,
-		"i": true, "you": true, "he": true, "she": true, "it": true, "we": true, "they": true,
-	}
 
 	for _, word := range words {
 		word = strings.ToLower(word)
@@ -342,8 +433,6 @@ func (s *Search) extractKeywords(text string) []string {
 		}
 	}
 
-	// Cache the result
-	s.keywordCache[text] = keywords
 	return keywords
 }
 
@@ -364,15 +453,6 @@ func (s *Search) extractCommandPatterns(text string) []string {
 
 // isCommandLike checks if a word looks like a command
 func (s *Search) isCommandLike(word string) bool {
-	commonCommands := map[string]bool{
-		"ls": true, "cd": true, "pwd": true, "cat": true, "grep": true, "find": true,
-		"cp": true, "mv": true, "rm": true, "mkdir": true, "rmdir": true, "chmod": true,
-		"tar": true, "zip": true, "unzip": true, "gzip": true, "gunzip": true,
-		"wget": true, "curl": true, "ssh": true, "scp": true, "rsync": true,
-		"git": true, "npm": true, "pip": true, "apt": true, "yum": true, "brew": true,
-		"docker": true, "kubectl": true, "vim": true, "nano": true, "emacs": true,
-	}
-
 	return commonCommands[strings.ToLower(word)]
 }
 
@@ -397,40 +477,34 @@ func (s *Search) calculateEditDistanceSimilarity(s1, s2 string) float64 {
 	return similarity
 }
 
-// editDistance calculates the edit distance between two strings
+// editDistance calculates the edit distance between two strings, keeping
+// only two rows of the distance matrix
 func (s *Search) editDistance(s1, s2 string) int {
 	len1, len2 := len(s1), len(s2)
 
-	// Create a matrix to store distances
-	matrix := make([][]int, len1+1)
-	for i := range matrix {
-		matrix[i] = make([]int, len2+1)
-	}
-
-	// Initialize first row and column
-	for i := 0; i <= len1; i++ {
-		matrix[i][0] = i
-	}
+	previous := make([]int, len2+1)
+	current := make([]int, len2+1)
 	for j := 0; j <= len2; j++ {
-		matrix[0][j] = j
+		previous[j] = j
 	}
 
-	// Fill the matrix
 	for i := 1; i <= len1; i++ {
+		current[0] = i
 		for j := 1; j <= len2; j++ {
 			cost := 0
 			if s1[i-1] != s2[j-1] {
 				cost = 1
 			}
 
-			matrix[i][j] = min(
-				min(matrix[i-1][j]+1, matrix[i][j-1]+1), // min of deletion and insertion
-				matrix[i-1][j-1]+cost,                   // substitution
+			current[j] = min(
+				min(previous[j]+1, current[j-1]+1), // min of deletion and insertion
+				previous[j-1]+cost,                 // substitution
 			)
 		}
+		previous, current = current, previous
 	}
 
-	return matrix[len1][len2]
+	return previous[len2]
 }
 
 // containsAny checks if any of the items are contained in the target string
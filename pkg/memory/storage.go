@@ -97,9 +97,10 @@ func (s *Storage) Save(memory *Memory) error {
 
 	content := header + string(data)
 
-	// Write to temporary file first
+	// Write to temporary file first, synced so the rename never exposes a partial file
 	tempFile := s.filePath + ".tmp"
-	if err := os.WriteFile(tempFile, []byte(content), 0644); err != nil {
+	if err := writeFileSync(tempFile, []byte(content), 0644); err != nil {
+		os.Remove(tempFile)
 		return fmt.Errorf("failed to write temporary file: %w", err)
 	}
 
@@ -118,6 +119,23 @@ func (s *Storage) Save(memory *Memory) error {
 	return nil
 }
 
+// writeFileSync writes data to path and flushes it to disk before returning
+func writeFileSync(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
 // createBackup creates a backup of the current memory file
 func (s *Storage) createBackup() error {
 	// Check if source file exists
@@ -236,6 +254,9 @@ func (s *Storage) validateMemory(memory *Memory) error {
 		memory.Metadata.Version = "1.0"
 	}
 
+	// Entries from older files or hand edits may lack a unique ID
+	AssignIDs(memory.Entries)
+
 	// Validate entries
 	validEntries := make([]MemoryEntry, 0, len(memory.Entries))
 	for i, entry := range memory.Entries {
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TrustThreshold is how many times in a row a command flagged as risky must
+// be confirmed before it is trusted
+const TrustThreshold = 3
+
+// Trust records the user confirming a command flagged as risky, which is
+// trusted and runs without asking once confirmed TrustThreshold times in a row
+type Trust struct {
+	Command       string    `yaml:"command" json:"command"`
+	Confirmations int       `yaml:"confirmations" json:"confirmations"`
+	Trusted       bool      `yaml:"trusted,omitempty" json:"trusted,omitempty"`
+	LastConfirmed time.Time `yaml:"last_confirmed" json:"last_confirmed"`
+}
+
+// trustKey is the form commands are matched in: the exact command, with its
+// whitespace collapsed
+func trustKey(command string) string {
+	return strings.Join(strings.Fields(command), " ")
+}
+
+// findTrust returns the trust record of command, or nil (requires lock)
+func (m *Manager) findTrust(command string) *Trust {
+	key := trustKey(command)
+	for i := range m.memory.Trust {
+		if m.memory.Trust[i].Command == key {
+			return &m.memory.Trust[i]
+		}
+	}
+	return nil
+}
+
+// RecordOverride counts that the user confirmed command although it was
+// flagged as risky. It reports true when this makes the command trusted.
+func (m *Manager) RecordOverride(command string) bool {
+	key := trustKey(command)
+	if key == "" {
+		return false
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	trust := m.findTrust(key)
+	if trust == nil {
+		m.memory.Trust = append(m.memory.Trust, Trust{Command: key})
+		trust = &m.memory.Trust[len(m.memory.Trust)-1]
+	}
+	trust.Confirmations++
+	trust.LastConfirmed = time.Now()
+
+	newlyTrusted := !trust.Trusted && trust.Confirmations >= TrustThreshold
+	trust.Trusted = trust.Trusted || newlyTrusted
+
+	m.scheduleSave()
+	return newlyTrusted
+}
+
+// RecordRefusal forgets the confirmations of command when the user declines
+// to run it, so only commands confirmed every time become trusted
+func (m *Manager) RecordRefusal(command string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if trust := m.findTrust(command); trust != nil && !trust.Trusted {
+		m.removeTrust(trust.Command)
+		m.scheduleSave()
+	}
+}
+
+// Trusted reports whether the user trusts command to run without confirmation
+func (m *Manager) Trusted(command string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	trust := m.findTrust(command)
+	return trust != nil && trust.Trusted
+}
+
+// TrustedCommands returns the commands the user trusts, in the order they
+// were first confirmed
+func (m *Manager) TrustedCommands() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var commands []string
+	for _, trust := range m.memory.Trust {
+		if trust.Trusted {
+			commands = append(commands, trust.Command)
+		}
+	}
+	return commands
+}
+
+// Untrust makes command ask for confirmation again, and forgets its
+// confirmations
+func (m *Manager) Untrust(command string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	trust := m.findTrust(command)
+	if trust == nil || !trust.Trusted {
+		return fmt.Errorf("%s is not trusted", trustKey(command))
+	}
+	m.removeTrust(trust.Command)
+
+	m.scheduleSave()
+	return nil
+}
+
+// removeTrust deletes the trust record of the command with the given key (requires lock)
+func (m *Manager) removeTrust(key string) {
+	for i := range m.memory.Trust {
+		if m.memory.Trust[i].Command == key {
+			m.memory.Trust = append(m.memory.Trust[:i], m.memory.Trust[i+1:]...)
+			return
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package memory
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
 	"time"
 )
 
@@ -15,11 +19,21 @@ type MemoryEntry struct {
 	Timestamp         time.Time `yaml:"timestamp" json:"timestamp"`
 	UsageCount        int       `yaml:"usage_count" json:"usage_count"`
 	Source            string    `yaml:"source" json:"source"` // "ai", "fallback", "manual"
+
+	// How often the entry was offered as a suggestion, and how often it was then chosen
+	PresentedCount  int `yaml:"presented_count,omitempty" json:"presented_count,omitempty"`
+	AcceptanceCount int `yaml:"acceptance_count,omitempty" json:"acceptance_count,omitempty"`
+
+	// Time of the last successful run; entries not verified within the TTL expire
+	LastVerified time.Time `yaml:"last_verified,omitempty" json:"last_verified,omitempty"`
+	// Pinned entries never expire or age out
+	Pinned bool `yaml:"pinned,omitempty" json:"pinned,omitempty"`
 }
 
 // Memory represents the complete memory structure
 type Memory struct {
 	Entries  []MemoryEntry `yaml:"entries" json:"entries"`
+	Trust    []Trust       `yaml:"trust,omitempty" json:"trust,omitempty"` // Commands flagged as risky the user confirmed, see trust.go
 	Metadata Metadata      `yaml:"metadata" json:"metadata"`
 }
 
@@ -77,6 +91,9 @@ type MemoryConfig struct {
 	MaxAge            time.Duration `yaml:"max_age" json:"max_age"`                       // Maximum age for entries
 	BackupCount       int           `yaml:"backup_count" json:"backup_count"`             // Number of backup files to keep
 	EnableCompression bool          `yaml:"enable_compression" json:"enable_compression"` // Enable gzip compression
+	SaveDelay         time.Duration `yaml:"save_delay" json:"save_delay"`                 // Idle time after a change before memory is saved
+	MaxSaveDelay      time.Duration `yaml:"max_save_delay" json:"max_save_delay"`         // Longest time a change stays unsaved during steady activity
+	TTL               time.Duration `yaml:"ttl" json:"ttl"`                               // Entries not run successfully for this long expire; 0 never
 }
 
 // DefaultMemoryConfig returns the default configuration
@@ -89,6 +106,8 @@ func DefaultMemoryConfig() MemoryConfig {
 		MaxAge:            90 * 24 * time.Hour, // 90 days
 		BackupCount:       3,
 		EnableCompression: false,
+		SaveDelay:         2 * time.Second,
+		MaxSaveDelay:      30 * time.Second,
 	}
 }
 
@@ -123,11 +142,94 @@ func (e *MemoryEntry) IsValid() bool {
 		!e.Timestamp.IsZero()
 }
 
+// shortIDLength is the number of ID characters shown in listings
+const shortIDLength = 8
+
+// ShortID returns the abbreviated ID shown in listings
+func (e *MemoryEntry) ShortID() string {
+	if len(e.ID) <= shortIDLength {
+		return e.ID
+	}
+	return e.ID[:shortIDLength]
+}
+
+// EntryID derives a stable ID from the content and timestamp of an entry,
+// used for entries that were stored without one
+func EntryID(e *MemoryEntry) string {
+	sum := sha256.Sum256([]byte(e.UserRequest + "\x00" + e.SelectedCommand + "\x00" +
+		e.Timestamp.UTC().Format(time.RFC3339Nano)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// AssignIDs gives entries without an ID, or with an ID already used by an
+// earlier entry, a content-derived ID that is the same every time the entries
+// are loaded. It returns the number of entries that were changed.
+func AssignIDs(entries []MemoryEntry) int {
+	used := make(map[string]bool, len(entries))
+	changed := 0
+
+	for i := range entries {
+		entry := &entries[i]
+		if entry.ID != "" && !used[entry.ID] {
+			used[entry.ID] = true
+			continue
+		}
+
+		base := EntryID(entry)
+		id := base
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+
+		entry.ID = id
+		used[id] = true
+		changed++
+	}
+
+	return changed
+}
+
+// SortByRecent orders entries newest first, breaking ties by ID so the order is deterministic
+func SortByRecent(entries []MemoryEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Timestamp.Equal(entries[j].Timestamp) {
+			return entries[i].Timestamp.After(entries[j].Timestamp)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+}
+
 // Age returns the age of the memory entry
 func (e *MemoryEntry) Age() time.Duration {
 	return time.Since(e.Timestamp)
 }
 
+// Expired reports whether the entry was not run successfully within ttl at
+// now. Entries saved before successful runs were recorded count from their
+// last use. Pinned entries and a ttl of 0 never expire.
+func (e *MemoryEntry) Expired(ttl time.Duration, now time.Time) bool {
+	if ttl <= 0 || e.Pinned {
+		return false
+	}
+
+	verified := e.LastVerified
+	if verified.IsZero() {
+		verified = e.Timestamp
+	}
+	return now.Sub(verified) > ttl
+}
+
+// AcceptanceFactor scales the search relevance of the entry by how often it
+// was chosen when suggested, from 0.8 for entries always passed over to 1.2
+// for entries always chosen. Entries rarely suggested stay close to 1.
+func (e *MemoryEntry) AcceptanceFactor() float64 {
+	accepted := min(e.AcceptanceCount, e.PresentedCount)
+
+	// Smoothing keeps a single choice from swinging the ranking
+	rate := (float64(accepted) + 1) / (float64(e.PresentedCount) + 2)
+	return 0.8 + 0.4*rate
+}
+
 // RelevanceScore calculates a combined relevance score based on usage and recency
 func (e *MemoryEntry) RelevanceScore() float64 {
 	// Base score from usage count (logarithmic scale)
@@ -0,0 +1,352 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// shellToken is a word or control operator of a command line
+type shellToken struct {
+	value    string // The word with quotes removed, or the operator
+	start    int    // Byte offsets of the token in the command
+	end      int
+	operator bool // One of | || & && ; or a newline
+}
+
+// tokenizeShell splits command into words and control operators, keeping
+// quoted text together and recording where each token is
+func tokenizeShell(command string) []shellToken {
+	var tokens []shellToken
+	var word strings.Builder
+	start := -1
+	var quote rune
+
+	endWord := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, shellToken{value: word.String(), start: start, end: end})
+		}
+		word.Reset()
+		start = -1
+	}
+
+	escaped := false
+	for i, r := range command {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			if start < 0 {
+				start = i
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			if start < 0 {
+				start = i
+			}
+		case r == ' ' || r == '\t':
+			endWord(i)
+		case r == '|' || r == '&' || r == ';' || r == '\n':
+			endWord(i)
+			// A second | or & extends the operator, e.g. || and &&
+			if n := len(tokens); n > 0 && tokens[n-1].operator && tokens[n-1].end == i &&
+				(r == '|' || r == '&') && tokens[n-1].value == string(r) {
+				tokens[n-1].value += string(r)
+				tokens[n-1].end = i + 1
+				continue
+			}
+			tokens = append(tokens, shellToken{value: string(r), start: i, end: i + 1, operator: true})
+		default:
+			word.WriteRune(r)
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	endWord(len(command))
+
+	return tokens
+}
+
+// simpleCommand is a command of a pipeline as a range of tokens
+type simpleCommand struct {
+	words   []shellToken
+	piped   bool // Receives the output of the previous command through |
+	program int  // Index in words of the program, after sudo, env and assignments
+}
+
+// splitSimpleCommands groups tokens into simple commands
+func splitSimpleCommands(tokens []shellToken) []simpleCommand {
+	var commands []simpleCommand
+	current := simpleCommand{}
+	for _, token := range tokens {
+		if !token.operator {
+			current.words = append(current.words, token)
+			continue
+		}
+		if len(current.words) > 0 {
+			commands = append(commands, current)
+		}
+		current = simpleCommand{piped: token.value == "|"}
+	}
+	if len(current.words) > 0 {
+		commands = append(commands, current)
+	}
+
+	for i := range commands {
+		commands[i].program = programIndex(commands[i].words)
+	}
+	return commands
+}
+
+// programIndex returns the index of the program in words, skipping sudo,
+// command wrappers and variable assignments, or len(words) if there is none
+func programIndex(words []shellToken) int {
+	for i, word := range words {
+		if word.value == "sudo" || commandWrappers[word.value] || strings.HasPrefix(word.value, "-") ||
+			(strings.Contains(word.value, "=") && !strings.HasPrefix(word.value, "=")) {
+			continue
+		}
+		return i
+	}
+	return len(words)
+}
+
+// name returns the program name of the command, e.g. "rm" for "sudo /bin/rm"
+func (c simpleCommand) name() string {
+	if c.program >= len(c.words) {
+		return ""
+	}
+	return filepath.Base(c.words[c.program].value)
+}
+
+// xargsValueOptions are xargs options followed by a separate value
+var xargsValueOptions = map[string]bool{
+	"-I": true, "-n": true, "-P": true, "-L": true, "-d": true, "-s": true, "-E": true, "-a": true,
+	"--max-args": true, "--max-procs": true, "--delimiter": true, "--replace": true, "--arg-file": true,
+}
+
+// xargsRunsRemoval reports whether an xargs command runs rm on its input
+func (c simpleCommand) xargsRunsRemoval() bool {
+	words := c.words[c.program+1:]
+	for i := 0; i < len(words); i++ {
+		word := words[i].value
+		if strings.HasPrefix(word, "-") {
+			if xargsValueOptions[word] {
+				i++
+			}
+			continue
+		}
+		if word == "sudo" {
+			continue
+		}
+		return filepath.Base(word) == "rm"
+	}
+	return false
+}
+
+// findDeletion describes an action of a find command that deletes what it finds
+type findDeletion struct {
+	start, end int // Byte range of the action, e.g. `-exec rm {} \;`
+}
+
+// findDeletions returns the deleting actions of a find command: -delete and
+// -exec, -execdir, -ok or -okdir running rm
+func (c simpleCommand) findDeletions() []findDeletion {
+	var deletions []findDeletion
+	words := c.words[c.program+1:]
+	for i := 0; i < len(words); i++ {
+		switch words[i].value {
+		case "-delete":
+			deletions = append(deletions, findDeletion{start: words[i].start, end: words[i].end})
+		case "-exec", "-execdir", "-ok", "-okdir":
+			end := i + 1
+			for end < len(words) && words[end].value != ";" && words[end].value != "+" {
+				end++
+			}
+			program := simpleCommand{words: words[i+1 : end]}
+			program.program = programIndex(program.words)
+			if program.name() == "rm" {
+				last := words[min(end, len(words)-1)]
+				deletions = append(deletions, findDeletion{start: words[i].start, end: last.end})
+			}
+			i = end
+		}
+	}
+	return deletions
+}
+
+// explainDeletion recognizes commands that delete files without starting
+// with rm: `find ... -delete`, `find ... -exec rm` and `... | xargs rm`.
+// A find starting at a critical path like / or ~ is critical.
+func explainDeletion(command string) DangerMatch {
+	commands := splitSimpleCommands(tokenizeShell(command))
+	for _, cmd := range commands {
+		switch cmd.name() {
+		case "find":
+			if len(cmd.findDeletions()) == 0 {
+				continue
+			}
+			for _, word := range cmd.words[cmd.program+1:] {
+				if strings.HasPrefix(word.value, "-") || strings.HasPrefix(word.value, "(") || word.value == "!" {
+					break
+				}
+				path := strings.ToLower(word.value)
+				if criticalRemovalTargets[strings.TrimSuffix(path, "/")] || criticalRemovalTargets[path] {
+					return DangerMatch{
+						Level:       DangerCritical,
+						Pattern:     "find " + word.value + " -delete",
+						Description: "deletes files found anywhere under " + word.value,
+					}
+				}
+			}
+			return DangerMatch{Level: DangerWarning, Pattern: "find -delete", Description: "deletes the files find matches"}
+		case "xargs":
+			if cmd.piped && cmd.xargsRunsRemoval() {
+				return DangerMatch{Level: DangerWarning, Pattern: "| xargs rm", Description: "deletes the files listed by the commands before it"}
+			}
+		}
+	}
+	return DangerMatch{}
+}
+
+// previewPrograms may run to list what a deleting pipeline would delete;
+// they only read files
+var previewPrograms = map[string]bool{
+	"find": true, "fd": true, "ls": true, "grep": true, "egrep": true, "fgrep": true, "rg": true,
+	"locate": true, "cat": true, "echo": true, "printf": true, "sort": true, "uniq": true,
+	"head": true, "tail": true, "cut": true, "tr": true,
+}
+
+// findSideEffects are find actions that write or run commands
+var findSideEffects = map[string]bool{
+	"-delete": true, "-exec": true, "-execdir": true, "-ok": true, "-okdir": true,
+	"-fprint": true, "-fprint0": true, "-fprintf": true, "-fls": true,
+}
+
+// previewOptionEffects are options of preview programs that run commands or
+// write files: single letters, which may be grouped like -Hx, and long options,
+// which GNU tools let users abbreviate
+var previewOptionEffects = map[string]struct {
+	short string
+	long  []string
+}{
+	"fd":   {short: "xX", long: []string{"--exec", "--exec-batch"}},
+	"rg":   {long: []string{"--pre"}},
+	"sort": {short: "o", long: []string{"--output"}},
+}
+
+// hasOptionEffects reports whether a preview program is given an option that
+// runs commands or writes files
+func (c simpleCommand) hasOptionEffects() bool {
+	effects, ok := previewOptionEffects[c.name()]
+	if !ok {
+		return false
+	}
+	for _, word := range c.words[c.program+1:] {
+		value := word.value
+		switch {
+		case strings.HasPrefix(value, "--") && len(value) > 2:
+			name, _, _ := strings.Cut(value, "=")
+			for _, long := range effects.long {
+				if strings.HasPrefix(long, name) {
+					return true
+				}
+			}
+		case strings.HasPrefix(value, "-") && effects.short != "":
+			if strings.ContainsAny(value[1:], effects.short) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeletionPreview returns a read-only variant of a command that deletes
+// files through find or xargs, listing what it would delete: -delete and
+// -exec rm become -print and a trailing `| xargs rm` is dropped. ok is false
+// when the command does not delete this way or its preview could have side
+// effects, e.g. because it chains other commands or pipes from a program
+// that writes.
+func DeletionPreview(command string) (preview string, ok bool) {
+	tokens := tokenizeShell(command)
+	for _, token := range tokens {
+		if token.operator && token.value != "|" {
+			return "", false // Other commands would run in the preview too
+		}
+	}
+
+	commands := splitSimpleCommands(tokens)
+	for i, cmd := range commands {
+		switch {
+		case cmd.name() == "find" && len(cmd.findDeletions()) > 0:
+			if i != len(commands)-1 {
+				return "", false // find -delete is expected to end the pipeline
+			}
+			preview = replaceFindDeletions(command, cmd.findDeletions())
+			return preview, readOnlyPipeline(preview)
+		case cmd.name() == "xargs" && cmd.piped && cmd.xargsRunsRemoval():
+			preview = strings.TrimSpace(command[:pipeStart(tokens, cmd.words[0].start)])
+			return preview, preview != "" && readOnlyPipeline(preview)
+		}
+	}
+	return "", false
+}
+
+// replaceFindDeletions replaces the deleting actions of a find command with -print
+func replaceFindDeletions(command string, deletions []findDeletion) string {
+	var preview strings.Builder
+	last := 0
+	for _, deletion := range deletions {
+		preview.WriteString(command[last:deletion.start])
+		preview.WriteString("-print")
+		last = deletion.end
+	}
+	preview.WriteString(command[last:])
+	return strings.TrimSpace(preview.String())
+}
+
+// pipeStart returns the offset of the | operator before the token at offset
+func pipeStart(tokens []shellToken, offset int) int {
+	start := 0
+	for _, token := range tokens {
+		if token.start >= offset {
+			break
+		}
+		if token.operator && token.value == "|" {
+			start = token.start
+		}
+	}
+	return start
+}
+
+// readOnlyPipeline reports whether every command of pipeline only reads files
+func readOnlyPipeline(pipeline string) bool {
+	if strings.ContainsAny(pipeline, "><`") || strings.Contains(pipeline, "$(") {
+		return false // Redirections and command substitutions could write
+	}
+
+	for _, cmd := range splitSimpleCommands(tokenizeShell(pipeline)) {
+		if cmd.program != 0 || !previewPrograms[cmd.name()] {
+			return false // sudo, env and assignments are not needed to list files
+		}
+		if cmd.hasOptionEffects() {
+			return false // fd -x, rg --pre and sort -o run commands or write
+		}
+		if cmd.name() == "find" {
+			for _, word := range cmd.words[1:] {
+				if findSideEffects[word.value] {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
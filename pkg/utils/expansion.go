@@ -0,0 +1,371 @@
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// broadRemovalFiles is the number of files from which a removal is reported
+	broadRemovalFiles = 100
+
+	// maxCountedFiles stops counting in huge directory trees; the count runs
+	// while the confirmation is shown, so it must stay quick
+	maxCountedFiles = 5000
+)
+
+// shellWord is a word of a command after variable expansion
+type shellWord struct {
+	raw       string   // The word as written
+	value     string   // The word with variables expanded and quotes removed
+	glob      bool     // Has unquoted glob characters the shell expands
+	emptyVars []string // Variables that expanded to nothing
+}
+
+// ExplainCommandDangerIn classifies a command like ExplainCommandDanger and
+// also looks at what an rm would remove when run in dir: variables that are
+// unset or empty, like $BUILD_DIR in `rm -rf $BUILD_DIR/`, turning the target
+// into the root filesystem, and globs matching many files. Globs are expanded
+// and counted without running anything; an empty dir is the current directory.
+func ExplainCommandDangerIn(command, dir string) DangerMatch {
+	return ExplainCommandDangerEnv(command, dir, os.LookupEnv)
+}
+
+// ExplainCommandDangerEnv is ExplainCommandDangerIn expanding variables with
+// lookupEnv instead of the environment of clia, e.g. with the variables a
+// session exported
+func ExplainCommandDangerEnv(command, dir string, lookupEnv func(string) (string, bool)) DangerMatch {
+	match := ExplainCommandDanger(command)
+	if match.Level == DangerCritical {
+		return match
+	}
+
+	if expansion := explainExpansion(command, dir, lookupEnv); expansion.Level != DangerNone && expansion.Level >= match.Level {
+		return expansion
+	}
+	return match
+}
+
+// explainExpansion checks the targets of every rm in command after variable
+// and glob expansion
+func explainExpansion(command, dir string, lookupEnv func(string) (string, bool)) DangerMatch {
+	var worst DangerMatch
+	for _, words := range splitShellCommands(command, lookupEnv) {
+		if match := explainRemoval(words, dir); match.Level > worst.Level {
+			worst = match
+		}
+	}
+	return worst
+}
+
+// explainRemoval checks the targets of words if they are an rm command
+func explainRemoval(words []shellWord, dir string) DangerMatch {
+	// Skip wrappers like sudo and variable assignments
+	for len(words) > 0 && (words[0].value == "sudo" || commandWrappers[words[0].value] ||
+		(strings.Contains(words[0].value, "=") && !strings.HasPrefix(words[0].value, "="))) {
+		words = words[1:]
+	}
+	if len(words) == 0 || filepath.Base(words[0].value) != "rm" {
+		return DangerMatch{}
+	}
+
+	recursive := false
+	optionsEnded := false
+	var targets []shellWord
+	for _, word := range words[1:] {
+		switch {
+		case optionsEnded || !strings.HasPrefix(word.value, "-") || word.value == "-":
+			targets = append(targets, word)
+		case word.value == "--":
+			optionsEnded = true
+		case word.value == "--recursive":
+			recursive = true
+		case !strings.HasPrefix(word.value, "--") && strings.ContainsAny(word.value, "rR"):
+			recursive = true
+		}
+	}
+
+	files := 0
+	var broadest shellWord
+	for _, target := range targets {
+		if len(target.emptyVars) > 0 && target.value != "" {
+			path := filepath.Clean(target.value)
+			if recursive && (criticalRemovalTargets[path] || criticalRemovalTargets[target.value]) {
+				return DangerMatch{
+					Level:   DangerCritical,
+					Pattern: target.raw,
+					Description: fmt.Sprintf("$%s is empty, so the target expands to %s",
+						strings.Join(target.emptyVars, ", $"), target.value),
+				}
+			}
+		}
+
+		if !target.glob {
+			continue
+		}
+		if count := countRemovedFiles(target.value, dir, recursive); count > files {
+			files = count
+			broadest = target
+		}
+	}
+
+	if files < broadRemovalFiles {
+		return DangerMatch{}
+	}
+	description := fmt.Sprintf("this will delete %s files", formatCount(files))
+	if files >= maxCountedFiles {
+		description = fmt.Sprintf("this will delete more than %s files", formatCount(maxCountedFiles))
+	}
+	return DangerMatch{Level: DangerWarning, Pattern: broadest.raw, Description: description}
+}
+
+// countRemovedFiles expands pattern in dir and counts the matching files,
+// and matching directories with their contents if recursive
+func countRemovedFiles(pattern, dir string, recursive bool) int {
+	if !filepath.IsAbs(pattern) && dir != "" {
+		pattern = filepath.Join(dir, pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, match := range matches {
+		info, err := os.Lstat(match)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			count++
+			continue
+		}
+		if !recursive {
+			continue // rm refuses to remove directories without -r
+		}
+
+		filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+			count++
+			if count >= maxCountedFiles {
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if count >= maxCountedFiles {
+			return maxCountedFiles
+		}
+	}
+	return count
+}
+
+// formatCount formats n with thousands separators, e.g. 4,213
+func formatCount(n int) string {
+	digits := fmt.Sprintf("%d", n)
+	var formatted strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			formatted.WriteByte(',')
+		}
+		formatted.WriteRune(digit)
+	}
+	return formatted.String()
+}
+
+// commandWrappers run the command that follows them
+var commandWrappers = map[string]bool{
+	"env": true, "time": true, "nohup": true, "nice": true, "command": true, "exec": true,
+}
+
+// splitShellCommands splits command into simple commands on ; & | and
+// newlines and each of them into words, expanding variables like the shell.
+// Variables assigned by an earlier command of the line, like D in
+// `D=build; rm -rf $D/*`, expand to the value assigned.
+func splitShellCommands(command string, lookupEnv func(string) (string, bool)) [][]shellWord {
+	var commands [][]shellWord
+	var words []shellWord
+	var word shellWord
+	inWord := false
+	var quote rune
+
+	assigned := make(map[string]string)
+	lookup := func(name string) (string, bool) {
+		if value, ok := assigned[name]; ok {
+			return value, true
+		}
+		return lookupEnv(name)
+	}
+
+	endWord := func() {
+		if inWord {
+			words = append(words, word)
+		}
+		word = shellWord{}
+		inWord = false
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.value += string(r)
+			}
+		case r == '$' && i+1 < len(runes):
+			name, value, width := expandVariable(runes[i+1:], lookup)
+			if width == 0 {
+				word.value += "$"
+				break
+			}
+			if value == "" {
+				word.emptyVars = append(word.emptyVars, name)
+			}
+			word.value += value
+			word.raw += string(runes[i : i+1+width])
+			i += width
+			inWord = true
+			continue
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.value += string(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.raw += string(r)
+			r = runes[i]
+			word.value += string(r)
+		case r == ' ' || r == '\t':
+			endWord()
+			continue
+		case r == ';' || r == '&' || r == '|' || r == '\n':
+			endWord()
+			if len(words) > 0 {
+				commands = append(commands, words)
+			}
+			// Pipelines and background commands run in a subshell, whose
+			// assignments do not last
+			if r == ';' || r == '\n' || (r == '&' && i+1 < len(runes) && runes[i+1] == '&') {
+				recordAssignments(words, assigned)
+			}
+			words = nil
+			continue
+		default:
+			if r == '*' || r == '?' || r == '[' {
+				word.glob = true
+			}
+			word.value += string(r)
+		}
+		word.raw += string(r)
+		inWord = true
+	}
+
+	endWord()
+	if len(words) > 0 {
+		commands = append(commands, words)
+	}
+	return commands
+}
+
+// recordAssignments adds the variables words assign to assigned if they are
+// a command of assignments only, optionally exported, like `D=build`.
+// Assignments before a program, like `D=build make`, only apply to it.
+func recordAssignments(words []shellWord, assigned map[string]string) {
+	if len(words) > 0 && (words[0].value == "export" || words[0].value == "local" || words[0].value == "readonly") {
+		words = words[1:]
+	}
+	for _, word := range words {
+		name, _, ok := strings.Cut(word.value, "=")
+		if !ok || name == "" || !isName(name) {
+			return
+		}
+	}
+	for _, word := range words {
+		name, value, _ := strings.Cut(word.value, "=")
+		assigned[name] = value
+	}
+}
+
+// isName reports whether s is a valid variable name
+func isName(s string) bool {
+	for i, r := range s {
+		if !isNameRune(r, i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// expandVariable expands the variable reference at the start of rest (after
+// the $) and returns its name, its value and the number of runes it spans.
+// ${VAR:-default} uses the default when VAR is empty and ${VAR:+alt} the
+// alternative when it is not; ${VAR:?} and other forms that stop the shell
+// on an empty value expand to a placeholder.
+func expandVariable(rest []rune, lookupEnv func(string) (string, bool)) (name, value string, width int) {
+	if rest[0] == '{' {
+		end := 1
+		for end < len(rest) && rest[end] != '}' {
+			end++
+		}
+		if end == len(rest) {
+			return "", "", 0
+		}
+		inner := string(rest[1:end])
+		width = end + 1
+
+		name, operator, operand := inner, "", ""
+		if i := strings.IndexAny(inner, ":-=?+"); i > 0 {
+			name = inner[:i]
+			operator = strings.TrimPrefix(inner[i:], ":")
+			if operator != "" {
+				operand = operator[1:]
+				operator = operator[:1]
+			}
+		}
+
+		value, _ = lookupEnv(name)
+		switch operator {
+		case "-", "=":
+			if value == "" {
+				value = operand
+			}
+		case "+":
+			if value != "" {
+				value = operand
+			}
+		case "?":
+			if value == "" {
+				value = "<" + name + ">" // The shell refuses to run the command
+			}
+		}
+		return name, value, width
+	}
+
+	for width < len(rest) && isNameRune(rest[width], width == 0) {
+		width++
+	}
+	if width == 0 {
+		return "", "", 0
+	}
+	name = string(rest[:width])
+	value, _ = lookupEnv(name)
+	return name, value, width
+}
+
+// isNameRune reports whether r may appear in a variable name; names cannot start with a digit
+func isNameRune(r rune, first bool) bool {
+	switch {
+	case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return true
+	default:
+		return !first && r >= '0' && r <= '9'
+	}
+}
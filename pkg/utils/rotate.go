@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotationPolicy bounds the disk space taken by a log file
+type RotationPolicy struct {
+	MaxSize  int64         // Size at which the file rolls over to a numbered file; 0 never rolls over
+	MaxFiles int           // Rolled-over files kept (file.1 is the newest); older ones are deleted
+	MaxAge   time.Duration // Rolled-over files older than this are deleted; 0 keeps them
+}
+
+// RotatingWriter appends to a log file, rolling it over to numbered files
+// (history.jsonl.1, history.jsonl.2, ...) when it would grow beyond the
+// maximum size. Writes are never split, so a record larger than the
+// maximum size gets a file of its own.
+type RotatingWriter struct {
+	mu     sync.Mutex
+	path   string
+	policy RotationPolicy
+	file   *os.File
+	size   int64
+}
+
+// NewRotatingWriter creates a writer appending to path; the file is opened on the first write
+func NewRotatingWriter(path string, policy RotationPolicy) *RotatingWriter {
+	return &RotatingWriter{path: path, policy: policy}
+}
+
+// Write implements io.Writer
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.policy.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.policy.MaxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// open opens the log file for appending
+func (w *RotatingWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0700); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+// rotate shifts the numbered files up by one, moves the current file to
+// file.1, deletes the files beyond the policy and starts a new file
+func (w *RotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	if w.policy.MaxFiles <= 0 {
+		os.Remove(w.path)
+	} else {
+		os.Remove(w.numbered(w.policy.MaxFiles))
+		for i := w.policy.MaxFiles - 1; i >= 1; i-- {
+			os.Rename(w.numbered(i), w.numbered(i+1))
+		}
+		if err := os.Rename(w.path, w.numbered(1)); err != nil {
+			return fmt.Errorf("failed to roll over log file: %w", err)
+		}
+	}
+	w.prune()
+
+	return w.open()
+}
+
+// numbered returns the path of the i-th rolled-over file
+func (w *RotatingWriter) numbered(i int) string {
+	return w.path + "." + strconv.Itoa(i)
+}
+
+// prune deletes rolled-over files beyond MaxFiles, e.g. left by a larger
+// earlier setting, and those older than MaxAge
+func (w *RotatingWriter) prune() {
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return
+	}
+
+	for _, match := range matches {
+		i, err := strconv.Atoi(strings.TrimPrefix(match, w.path+"."))
+		if err != nil || i < 1 {
+			continue
+		}
+		if i > w.policy.MaxFiles {
+			os.Remove(match)
+			continue
+		}
+		if info, err := os.Stat(match); err == nil && w.policy.MaxAge > 0 && time.Since(info.ModTime()) > w.policy.MaxAge {
+			os.Remove(match)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 )
@@ -95,34 +97,362 @@ func IsCommandSafe(command string) bool {
 	return false
 }
 
-// IsDangerousCommand checks if a command is potentially dangerous
+// dangerousPatterns are substrings of potentially dangerous commands
+var dangerousPatterns = []string{
+	"rm -rf /",
+	"rm -rf *",
+	":(){ :|:& };:", // Fork bomb
+	"dd if=/dev/zero",
+	"mkfs",
+	"fdisk",
+	"format c:",
+	"> /dev/sda",
+	"curl", // Could download malicious content
+	"wget", // Could download malicious content
+	"chmod 777",
+	"chown -R",
+	"shutdown",
+	"reboot",
+	"halt",
+	"poweroff",
+}
+
+// IsDangerousCommand checks if a command is potentially dangerous, including
+// user-defined danger patterns
 func IsDangerousCommand(command string) bool {
-	command = strings.TrimSpace(strings.ToLower(command))
+	return ExplainCommandDanger(command).Level != DangerNone
+}
+
+// DangerLevel represents how destructive a command may be
+type DangerLevel int
+
+const (
+	DangerNone     DangerLevel = iota // No known dangerous operations
+	DangerWarning                     // Potentially dangerous, needs a y/n confirmation
+	DangerCritical                    // May irrecoverably destroy data or the system, needs a typed confirmation
+)
 
-	dangerousPatterns := []string{
-		"rm -rf /",
-		"rm -rf *",
-		":(){ :|:& };:", // Fork bomb
-		"dd if=/dev/zero",
-		"mkfs",
-		"fdisk",
-		"format c:",
-		"> /dev/sda",
-		"curl", // Could download malicious content
-		"wget", // Could download malicious content
-		"chmod 777",
-		"chown -R",
-		"shutdown",
-		"reboot",
-		"halt",
-		"poweroff",
+// String returns the name of the danger level
+func (l DangerLevel) String() string {
+	switch l {
+	case DangerWarning:
+		return "warning"
+	case DangerCritical:
+		return "critical"
+	default:
+		return "none"
 	}
+}
 
-	for _, dangerous := range dangerousPatterns {
-		if strings.Contains(command, dangerous) {
-			return true
+// criticalPatterns match commands that can wipe a disk, the root filesystem or the home directory
+var criticalPatterns = []DangerPattern{
+	mustDangerPattern(`\bmkfs(\.[a-z0-9]+)?\b`, "creates a filesystem, erasing the device"),
+	mustDangerPattern(`\b(fdisk|sfdisk|parted|wipefs)\s+.*/dev/`, "partitions or wipes a disk"),
+	mustDangerPattern(`\bdd\s+.*\bof=/dev/(sd|hd|vd|xvd|nvme|mmcblk|disk)`, "writes directly to a block device"),
+	mustDangerPattern(`>\s*/dev/(sd|hd|vd|xvd|nvme|mmcblk|disk)`, "writes directly to a block device"),
+	mustDangerPattern(`\bshred\s+.*/dev/`, "shreds a device"),
+	mustDangerPattern(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`, "fork bomb"),
+	mustDangerPattern(`\b(chmod|chown)\s+(-[a-z]*\s+)*-[a-z]*r[a-z]*\s+\S+\s+/(\s|$)`,
+		"recursively changes permissions of the root filesystem"),
+	mustDangerPattern(`\bformat\s+[a-z]:`, "formats a drive"),
+}
+
+// mustDangerPattern compiles a built-in critical pattern
+func mustDangerPattern(pattern, description string) DangerPattern {
+	return DangerPattern{
+		Pattern:     pattern,
+		Level:       DangerCritical,
+		Description: description,
+		regexp:      regexp.MustCompile(pattern),
+	}
+}
+
+// criticalRemovalTargets are paths whose recursive removal destroys the system or all user data
+var criticalRemovalTargets = map[string]bool{
+	"/": true, "/*": true, "~": true, "~/": true, "~/*": true,
+	"$home": true, "$home/": true, "$home/*": true, "${home}": true,
+	"/bin": true, "/boot": true, "/dev": true, "/etc": true, "/home": true, "/lib": true,
+	"/opt": true, "/root": true, "/sbin": true, "/usr": true, "/var": true,
+}
+
+// isCriticalRemoval checks for a recursive rm of the root filesystem, the home
+// directory or a top-level system directory
+func isCriticalRemoval(command string) bool {
+	segments := strings.FieldsFunc(command, func(r rune) bool {
+		return r == ';' || r == '&' || r == '|' || r == '\n'
+	})
+
+	for _, segment := range segments {
+		fields := strings.Fields(segment)
+		for i, field := range fields {
+			if field != "rm" && !strings.HasSuffix(field, "/rm") {
+				continue
+			}
+
+			recursive := false
+			var targets []string
+			for _, arg := range fields[i+1:] {
+				switch {
+				case arg == "--recursive":
+					recursive = true
+				case arg == "--no-preserve-root":
+					return true
+				case strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--"):
+					if strings.ContainsAny(arg, "rR") {
+						recursive = true
+					}
+				case !strings.HasPrefix(arg, "-"):
+					targets = append(targets, strings.Trim(arg, `"'`))
+				}
+			}
+
+			if !recursive {
+				continue
+			}
+			for _, target := range targets {
+				if criticalRemovalTargets[strings.TrimSuffix(target, "/")] || criticalRemovalTargets[target] {
+					return true
+				}
+			}
 		}
 	}
 
 	return false
 }
+
+// AssessCommandDanger classifies a command into a danger level
+func AssessCommandDanger(command string) DangerLevel {
+	return ExplainCommandDanger(command).Level
+}
+
+// DangerMatch is the danger level of a command and the pattern that decided it
+type DangerMatch struct {
+	Level       DangerLevel
+	Pattern     string // Empty when no pattern matched
+	Description string
+}
+
+// String describes the matched pattern for confirmation dialogs
+func (m DangerMatch) String() string {
+	if m.Description == "" {
+		return fmt.Sprintf("matches %q", m.Pattern)
+	}
+	return fmt.Sprintf("%s (matches %q)", m.Description, m.Pattern)
+}
+
+// ExplainCommandDanger classifies a command like AssessCommandDanger and
+// reports which pattern matched. Built-in critical patterns always apply;
+// user-defined patterns come next and may raise the level or, with severity
+// "none", exempt a command from the built-in warnings. Deletions through
+// find -delete, find -exec rm and xargs rm are warnings, or critical when
+// find starts at the root filesystem or the home directory.
+func ExplainCommandDanger(command string) DangerMatch {
+	normalized := strings.ToLower(strings.Join(strings.Fields(command), " "))
+
+	if isCriticalRemoval(normalized) {
+		return DangerMatch{
+			Level:       DangerCritical,
+			Pattern:     "rm -r <system or home directory>",
+			Description: "recursively removes the root filesystem, a system directory or the home directory",
+		}
+	}
+
+	for _, pattern := range criticalPatterns {
+		if pattern.regexp.MatchString(normalized) {
+			return pattern.match()
+		}
+	}
+
+	deletion := explainDeletion(command)
+	if deletion.Level == DangerCritical {
+		return deletion
+	}
+
+	var allowed *DangerPattern
+	var custom *DangerPattern
+	for i, pattern := range customDangerPatterns {
+		if !pattern.regexp.MatchString(command) {
+			continue
+		}
+		if pattern.Level == DangerNone {
+			if allowed == nil {
+				allowed = &customDangerPatterns[i]
+			}
+		} else if custom == nil || pattern.Level > custom.Level {
+			custom = &customDangerPatterns[i]
+		}
+	}
+	if custom != nil {
+		return custom.match()
+	}
+	if allowed != nil {
+		return allowed.match()
+	}
+
+	if deletion.Level != DangerNone {
+		return deletion
+	}
+
+	lowered := strings.TrimSpace(strings.ToLower(command))
+	for _, dangerous := range dangerousPatterns {
+		if strings.Contains(lowered, dangerous) {
+			return DangerMatch{Level: DangerWarning, Pattern: dangerous, Description: "potentially dangerous operation"}
+		}
+	}
+
+	return DangerMatch{Level: DangerNone}
+}
+
+// DangerPattern is a regular expression marking matching commands with a danger level
+type DangerPattern struct {
+	Pattern     string
+	Level       DangerLevel
+	Description string
+
+	regexp *regexp.Regexp
+}
+
+// match returns the danger match for a command matching the pattern
+func (p DangerPattern) match() DangerMatch {
+	return DangerMatch{Level: p.Level, Pattern: p.Pattern, Description: p.Description}
+}
+
+// customDangerPatterns are the user-defined patterns set with SetDangerPatterns
+var customDangerPatterns []DangerPattern
+
+// NewDangerPattern compiles a user-defined danger pattern. Severity is
+// "warning", "critical" or "none" (exempts matching commands from built-in warnings).
+// Patterns are matched against the command as typed; use (?i) to ignore case.
+func NewDangerPattern(pattern, severity, description string) (DangerPattern, error) {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return DangerPattern{}, fmt.Errorf("invalid danger pattern %q: %w", pattern, err)
+	}
+
+	level, ok := ParseDangerLevel(severity)
+	if !ok {
+		return DangerPattern{}, fmt.Errorf("invalid severity %q for danger pattern %q (expected warning, critical or none)", severity, pattern)
+	}
+
+	return DangerPattern{
+		Pattern:     pattern,
+		Level:       level,
+		Description: description,
+		regexp:      compiled,
+	}, nil
+}
+
+// ParseDangerLevel parses a danger level name as returned by DangerLevel.String
+func ParseDangerLevel(name string) (DangerLevel, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "warning", "":
+		return DangerWarning, true
+	case "critical":
+		return DangerCritical, true
+	case "none":
+		return DangerNone, true
+	default:
+		return DangerNone, false
+	}
+}
+
+// SetDangerPatterns sets the user-defined danger patterns used in addition to the built-in ones
+func SetDangerPatterns(patterns []DangerPattern) {
+	customDangerPatterns = patterns
+}
+
+// SanitizePastedText turns pasted content into a single line of literal text.
+// Line breaks and tabs become spaces so an embedded newline can never act as a
+// submit. Escape sequences, e.g. the colors of text copied from a terminal,
+// are removed whole and remaining control characters are dropped.
+func SanitizePastedText(text string) string {
+	text = StripANSI(text)
+
+	var builder strings.Builder
+	builder.Grow(len(text))
+
+	lastWasSpace := false
+	for _, r := range text {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			if !lastWasSpace {
+				builder.WriteRune(' ')
+				lastWasSpace = true
+			}
+		case r < 0x20 || r == 0x7f:
+			// Drop other control characters
+		default:
+			builder.WriteRune(r)
+			lastWasSpace = r == ' '
+		}
+	}
+
+	return strings.TrimSpace(builder.String())
+}
+
+// StripANSI removes ANSI escape sequences from s: CSI sequences (colors, cursor
+// movement), OSC/DCS strings (titles, hyperlinks) and two-character escapes.
+// Incomplete sequences at the end of s are dropped as well.
+func StripANSI(s string) string {
+	if !strings.ContainsAny(s, "\x1b\u009b\u009d") {
+		return s
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(s))
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == 0x1b && i+1 < len(runes) && runes[i+1] == '[':
+			i = skipCSI(runes, i+2)
+		case r == 0x9b:
+			i = skipCSI(runes, i+1)
+		case r == 0x1b && i+1 < len(runes) && strings.ContainsRune("]PX^_", runes[i+1]):
+			i = skipControlString(runes, i+2)
+		case r == 0x9d:
+			i = skipControlString(runes, i+1)
+		case r == 0x1b:
+			// Two-character escape, possibly with intermediate bytes (e.g. ESC ( B)
+			i++
+			for i < len(runes) && runes[i] >= 0x20 && runes[i] <= 0x2f {
+				i++
+			}
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String()
+}
+
+// skipCSI returns the index of the final byte of the CSI sequence whose
+// parameters start at start, or the last index if it is incomplete
+func skipCSI(runes []rune, start int) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] >= 0x40 && runes[i] <= 0x7e {
+			return i
+		}
+		if runes[i] < 0x20 || runes[i] > 0x3f {
+			// Not a valid parameter or intermediate byte: the sequence is broken,
+			// so keep the text that follows it
+			return i - 1
+		}
+	}
+	return len(runes) - 1
+}
+
+// skipControlString returns the index of the terminator (BEL or ESC \) of the
+// OSC/DCS string starting at start, or the last index if it is unterminated
+func skipControlString(runes []rune, start int) int {
+	for i := start; i < len(runes); i++ {
+		switch {
+		case runes[i] == 0x07 || runes[i] == 0x9c:
+			return i
+		case runes[i] == 0x1b && i+1 < len(runes) && runes[i+1] == '\\':
+			return i + 1
+		}
+	}
+	return len(runes) - 1
+}
@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -137,3 +139,340 @@ func TestIsDangerousCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestSanitizePastedText(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ls -la", "ls -la"},
+		{"ls -la\n", "ls -la"},
+		{"find . -name '*.go'\r\n| wc -l", "find . -name '*.go' | wc -l"},
+		{"echo\thello", "echo hello"},
+		{"\x1b[31mred\x1b[0m", "red"},
+		{"\x1b[1;32mls\x1b[0m -la\n", "ls -la"},
+		{"\x1b]0;title\x07git status", "git status"},
+		{"\n\n", ""},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizePastedText(tt.input); got != tt.expected {
+			t.Errorf("SanitizePastedText(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestAssessCommandDanger(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected DangerLevel
+	}{
+		{"rm -rf /", DangerCritical},
+		{"sudo rm -rf /*", DangerCritical},
+		{"rm -fr ~", DangerCritical},
+		{"rm -rf $HOME", DangerCritical},
+		{"rm -r -f /etc", DangerCritical},
+		{"rm -rf --no-preserve-root /", DangerCritical},
+		{"mkfs.ext4 /dev/sdb1", DangerCritical},
+		{"dd if=/dev/zero of=/dev/sda bs=1M", DangerCritical},
+		{"echo x > /dev/nvme0n1", DangerCritical},
+		{":(){ :|:& };:", DangerCritical},
+		{"chmod -R 777 /", DangerCritical},
+		{"rm -rf *", DangerWarning},
+		{"rm -rf /tmp/cache", DangerWarning},
+		{"dd if=/dev/zero of=./disk.img bs=1M count=10", DangerWarning},
+		{"curl https://example.com", DangerWarning},
+		{"ls -la", DangerNone},
+		{"echo hello", DangerNone},
+	}
+
+	for _, tt := range tests {
+		if got := AssessCommandDanger(tt.command); got != tt.expected {
+			t.Errorf("AssessCommandDanger(%q) = %s, expected %s", tt.command, got, tt.expected)
+		}
+	}
+}
+
+func TestCustomDangerPatterns(t *testing.T) {
+	t.Cleanup(func() { SetDangerPatterns(nil) })
+
+	purge, err := NewDangerPattern(`\bprodctl\s+purge\b`, "critical", "purges production data")
+	if err != nil {
+		t.Fatalf("NewDangerPattern failed: %v", err)
+	}
+	deploy, err := NewDangerPattern(`^deploy\b`, "", "")
+	if err != nil {
+		t.Fatalf("NewDangerPattern failed: %v", err)
+	}
+	allowCurl, err := NewDangerPattern(`^curl\s+https://intranet\.example\.com/`, "none", "internal API")
+	if err != nil {
+		t.Fatalf("NewDangerPattern failed: %v", err)
+	}
+	SetDangerPatterns([]DangerPattern{deploy, purge, allowCurl})
+
+	match := ExplainCommandDanger("prodctl purge --all")
+	if match.Level != DangerCritical || match.Description != "purges production data" {
+		t.Errorf("Expected the custom critical pattern to match, got %+v", match)
+	}
+	if !strings.Contains(match.String(), `prodctl`) {
+		t.Errorf("Expected the description to cite the pattern, got %q", match.String())
+	}
+
+	if level := AssessCommandDanger("deploy web"); level != DangerWarning {
+		t.Errorf("Expected an empty severity to mean warning, got %s", level)
+	}
+	if !IsDangerousCommand("deploy web") {
+		t.Error("Expected IsDangerousCommand to use custom patterns")
+	}
+
+	// Severity "none" exempts commands from built-in warnings, but not from critical patterns
+	if level := AssessCommandDanger("curl https://intranet.example.com/status"); level != DangerNone {
+		t.Errorf("Expected the allowed command to pass, got %s", level)
+	}
+	if level := AssessCommandDanger("curl https://example.com"); level != DangerWarning {
+		t.Errorf("Expected other curl commands to keep the built-in warning, got %s", level)
+	}
+	if match := ExplainCommandDanger("rm -rf /"); match.Level != DangerCritical || match.Pattern == "" {
+		t.Errorf("Expected built-in critical patterns to be cited, got %+v", match)
+	}
+
+	if _, err := NewDangerPattern(`(unclosed`, "warning", ""); err == nil {
+		t.Error("Expected an invalid regular expression to be rejected")
+	}
+	if _, err := NewDangerPattern(`ok`, "severe", ""); err == nil {
+		t.Error("Expected an unknown severity to be rejected")
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain", "ls -la", "ls -la"},
+		{"csi color", "\x1b[31mred\x1b[0m text", "red text"},
+		{"csi cursor", "\x1b[2K\x1b[1Gdf -h", "df -h"},
+		{"csi private mode", "\x1b[?25lhidden\x1b[?25h", "hidden"},
+		{"8-bit csi", "\u009b1mbold", "bold"},
+		{"osc title bel", "\x1b]0;window title\x07echo hi", "echo hi"},
+		{"osc hyperlink st", "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"two-char escape", "\x1b(Bgrep foo\x1b=", "grep foo"},
+		{"incomplete csi", "ls -la\x1b[3", "ls -la"},
+		{"incomplete osc", "pwd\x1b]0;unterminated", "pwd"},
+		{"lone escape", "ls\x1b", "ls"},
+		{"broken csi keeps text", "\x1b[31\nnext", "\nnext"},
+		{"unicode", "echo 剩余空间 \x1b[1m✓\x1b[0m", "echo 剩余空间 ✓"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripANSI(tt.input); got != tt.expected {
+				t.Errorf("StripANSI(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpansionDanger(t *testing.T) {
+	env := map[string]string{"BUILD_DIR": "build", "EMPTY": ""}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	// Unset or empty variables turning the target into the root filesystem
+	variableTests := []struct {
+		command  string
+		expected DangerLevel
+	}{
+		{"rm -rf $UNSET_VAR/", DangerCritical},
+		{"rm -rf ${UNSET_VAR}/*", DangerCritical},
+		{`rm -rf "$EMPTY/"`, DangerCritical},
+		{"cd /tmp && sudo rm -r $EMPTY/usr", DangerCritical},
+		{"rm -f $UNSET_VAR/", DangerNone},           // Not recursive
+		{"rm -rf $BUILD_DIR/", DangerNone},          // Set
+		{"rm -rf ${UNSET_VAR:-build}/", DangerNone}, // Has a default
+		{"rm -rf ${UNSET_VAR:?}/", DangerNone},      // The shell refuses to run it
+		{"rm -rf '$UNSET_VAR/'", DangerNone},        // Single quotes do not expand
+		{"echo $UNSET_VAR/", DangerNone},
+		{"rm -rf ${BUILD_DIR:+cache}/", DangerNone},        // Set, so the alternative
+		{"rm -rf /tmp/${UNSET_VAR:+x}/", DangerNone},       // Unset, nothing, but not the root
+		{"rm -rf ${UNSET_VAR:+build}/", DangerCritical},    // Unset, so nothing
+		{"D=build; rm -rf $D/", DangerNone},                // Assigned earlier on the line
+		{"export D=build && rm -rf $D/", DangerNone},       // Exported earlier on the line
+		{"BUILD_DIR=; rm -rf $BUILD_DIR/", DangerCritical}, // Emptied earlier on the line
+		{"D=build make; rm -rf $D/", DangerCritical},       // Only set for make
+		{"D=build | true; rm -rf $D/", DangerCritical},     // Set in a subshell
+	}
+	for _, tt := range variableTests {
+		if got := explainExpansion(tt.command, t.TempDir(), lookupEnv); got.Level != tt.expected {
+			t.Errorf("explainExpansion(%q) = %v (%s), expected %v", tt.command, got.Level, got.Description, tt.expected)
+		}
+	}
+	match := explainExpansion("rm -rf $UNSET_VAR/", t.TempDir(), lookupEnv)
+	if !strings.Contains(match.String(), "$UNSET_VAR is empty") || match.Pattern != "$UNSET_VAR/" {
+		t.Errorf("Expected the empty variable to be named, got %q", match.String())
+	}
+
+	// Broad globs are counted in the directory the command runs in
+	dir := t.TempDir()
+	for i := 0; i < 150; i++ {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.txt", i)), nil, 0644)
+	}
+	os.WriteFile(filepath.Join(dir, "notes.log"), nil, 0644)
+	os.Mkdir(filepath.Join(dir, "cache"), 0755)
+	for i := 0; i < 120; i++ {
+		os.WriteFile(filepath.Join(dir, "cache", fmt.Sprintf("%d.bin", i)), nil, 0644)
+	}
+
+	globTests := []struct {
+		command  string
+		expected string // Expected description; empty for no danger
+	}{
+		{"rm *", "this will delete 151 files"},
+		{"rm *.txt", "this will delete 150 files"},
+		{"rm -rf ca*", "this will delete 121 files"},
+		{"rm -r *", "this will delete 272 files"},
+		{"rm ca*", ""},   // Directories are not removed without -r
+		{"rm *.log", ""}, // Few files
+		{"rm '*'", ""},   // Quoted, not a glob
+		{"ls *", ""},
+	}
+	for _, tt := range globTests {
+		got := explainExpansion(tt.command, dir, lookupEnv)
+		if got.Description != tt.expected {
+			t.Errorf("explainExpansion(%q) = %q, expected %q", tt.command, got.Description, tt.expected)
+		}
+	}
+
+	if got := ExplainCommandDangerIn("rm -r *", dir); got.Level != DangerWarning || !strings.Contains(got.String(), "272 files") {
+		t.Errorf("Expected the file count in the danger explanation, got %q", got.String())
+	}
+
+	for n, expected := range map[int]string{0: "0", 999: "999", 4213: "4,213", 100000: "100,000", 1234567: "1,234,567"} {
+		if got := formatCount(n); got != expected {
+			t.Errorf("formatCount(%d) = %q, expected %q", n, got, expected)
+		}
+	}
+}
+
+func TestRotatingWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.jsonl")
+	writer := NewRotatingWriter(path, RotationPolicy{MaxSize: 20, MaxFiles: 2})
+
+	// Each record is 10 bytes, so every file holds two of them
+	for i := 0; i < 7; i++ {
+		if _, err := fmt.Fprintf(writer, "record %d\n", i); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	writer.Close()
+
+	expected := map[string]string{
+		path:        "record 6\n",
+		path + ".1": "record 4\nrecord 5\n",
+		path + ".2": "record 2\nrecord 3\n",
+	}
+	for file, content := range expected {
+		data, err := os.ReadFile(file)
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %s to contain %q, got %q (%v)", filepath.Base(file), content, data, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected files beyond max_files to be deleted")
+	}
+
+	// A new writer continues the existing file, and a record larger than the limit gets its own file
+	writer = NewRotatingWriter(path, RotationPolicy{MaxSize: 20, MaxFiles: 2})
+	writer.Write([]byte("a record longer than the limit\n"))
+	writer.Close()
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "record 6\n" {
+		t.Errorf("Expected the existing file to roll over, got %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "a record longer than the limit\n" {
+		t.Errorf("Expected the long record in the current file, got %q", data)
+	}
+
+	// Without a size limit the file never rolls over
+	writer = NewRotatingWriter(path, RotationPolicy{})
+	writer.Write([]byte(strings.Repeat("x", 100) + "\n"))
+	writer.Close()
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "record 6\n" {
+		t.Errorf("Expected no rollover without a size limit, got %q", data)
+	}
+}
+
+func TestDeletionDanger(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected DangerLevel
+	}{
+		{"find . -name '*.o' -delete", DangerWarning},
+		{`find . -name "*.tmp" -exec rm {} \;`, DangerWarning},
+		{"find build -type f -exec rm -f {} +", DangerWarning},
+		{"find . -name '*.log' -execdir /bin/rm {} ';'", DangerWarning},
+		{"find . -name '*.bak' | xargs rm", DangerWarning},
+		{"find . -name '*.bak' -print0 | xargs -0 rm -f", DangerWarning},
+		{"ls *.tmp | xargs -n 10 sudo rm", DangerWarning},
+		{"find / -name core -delete", DangerCritical},
+		{"sudo find ~ -type f -delete", DangerCritical},
+		{"find $HOME/ -exec rm -rf {} +", DangerCritical},
+		{"find . -name '*.go'", DangerNone},
+		{"find . -name '*.go' -exec grep -l TODO {} +", DangerNone},
+		{"find . -type f | xargs wc -l", DangerNone},
+		{"grep -rl xargs . | xargs -I {} echo rm {}", DangerNone},
+		{"echo '-delete'", DangerNone},
+	}
+	for _, tt := range tests {
+		if got := ExplainCommandDanger(tt.command); got.Level != tt.expected {
+			t.Errorf("ExplainCommandDanger(%q) = %v (%s), expected %v", tt.command, got.Level, got.Pattern, tt.expected)
+		}
+	}
+}
+
+func TestDeletionPreview(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string // Expected preview; empty when there is none
+	}{
+		{"find . -name '*.o' -delete", "find . -name '*.o' -print"},
+		{`find . -name "*.tmp" -exec rm {} \;`, `find . -name "*.tmp" -print`},
+		{"find build -type f -exec rm -f {} + ", "find build -type f -print"},
+		{"find . -name '*.bak' | xargs rm", "find . -name '*.bak'"},
+		{"find . -name '*.bak' -print0 | xargs -0 rm -f", "find . -name '*.bak' -print0"},
+		{"ls *.tmp | grep -v keep | xargs rm", "ls *.tmp | grep -v keep"},
+		{"sudo find /var/tmp -mtime +7 -delete", ""},     // Would run as root
+		{"cd build && find . -delete", ""},               // Chains another command
+		{"find . -delete | tee deleted.txt", ""},         // Output goes on to another command
+		{"make clean-list | xargs rm", ""},               // make may write
+		{"find . -name '*.o' > list.txt | xargs rm", ""}, // Redirection
+		{"find . -exec touch {} + -exec rm {} +", ""},    // Other -exec actions
+		{"fd -e tmp | xargs rm", "fd -e tmp"},
+		{"rg -l TODO | sort -u | xargs rm", "rg -l TODO | sort -u"},
+		{"fd -e tmp -x touch {} | xargs rm", ""}, // fd runs a command
+		{"fd -HX touch | xargs rm", ""},          // Grouped with -H
+		{"fd -e tmp --exec-batch touch | xargs rm", ""},
+		{"rg -l --pre ./clean.sh TODO | xargs rm", ""}, // rg runs a preprocessor
+		{"rg -l --pre=./clean.sh TODO | xargs rm", ""},
+		{"ls *.tmp | sort -o list.txt | xargs rm", ""}, // sort writes a file
+		{"ls *.tmp | sort -uo list.txt | xargs rm", ""},
+		{"ls *.tmp | sort --outp=list.txt | xargs rm", ""}, // Abbreviated --output
+		{"find . -name '*.go'", ""},                        // Deletes nothing
+		{"rm -rf build", ""},
+	}
+	for _, tt := range tests {
+		preview, ok := DeletionPreview(tt.command)
+		if tt.expected == "" {
+			if ok {
+				t.Errorf("DeletionPreview(%q) = %q, expected no preview", tt.command, preview)
+			}
+			continue
+		}
+		if !ok || preview != tt.expected {
+			t.Errorf("DeletionPreview(%q) = %q, %v, expected %q", tt.command, preview, ok, tt.expected)
+		}
+	}
+}